@@ -0,0 +1,38 @@
+package api
+
+import "strings"
+
+// Masker hides personal data in API responses shown to callers who are not
+// allowed to see it in full.
+type Masker struct{}
+
+func NewMasker() *Masker {
+	return &Masker{}
+}
+
+// MaskEmail keeps the first character of the local part and the domain,
+// e.g. "alice@example.com" becomes "a***@example.com".
+func (m *Masker) MaskEmail(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return "***"
+	}
+
+	return email[:1] + "***" + email[at:]
+}
+
+// MaskPhone keeps only the last four digits of a phone number.
+func (m *Masker) MaskPhone(phone string) string {
+	digits := make([]rune, 0, len(phone))
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+
+	if len(digits) <= 4 {
+		return "***"
+	}
+
+	return "***" + string(digits[len(digits)-4:])
+}
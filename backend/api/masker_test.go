@@ -0,0 +1,33 @@
+package api
+
+import "testing"
+
+func TestMaskEmail(t *testing.T) {
+	tests := []struct{ email, want string }{
+		{"alice@example.com", "a***@example.com"},
+		{"a@example.com", "a***@example.com"},
+		{"first.last@mail.example.co.uk", "f***@mail.example.co.uk"},
+		{"@example.com", "***"},
+		{"not-an-email", "***"},
+		{"", "***"},
+	}
+	for _, tt := range tests {
+		if got := NewMasker().MaskEmail(tt.email); got != tt.want {
+			t.Errorf("MaskEmail(%q) = %q, want %q", tt.email, got, tt.want)
+		}
+	}
+}
+
+func TestMaskPhone(t *testing.T) {
+	tests := []struct{ phone, want string }{
+		{"+44 20 7946 0958", "***0958"},
+		{"(555) 123-4567", "***4567"},
+		{"1234", "***"},
+		{"", "***"},
+	}
+	for _, tt := range tests {
+		if got := NewMasker().MaskPhone(tt.phone); got != tt.want {
+			t.Errorf("MaskPhone(%q) = %q, want %q", tt.phone, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+var ErrMissingSiteSettings = errors.New("missing required site settings")
+
+// SiteConfig holds the commonly used site settings, read from the site
+// settings store. Each field is tagged with its setting key.
+type SiteConfig struct {
+	SiteName        string            `mapstructure:"site_name"`
+	SiteURL         string            `mapstructure:"site_url"`
+	LogoURL         string            `mapstructure:"logo_url"`
+	MaintenanceMode bool              `mapstructure:"maintenance_mode"`
+	SEODefaultTitle string            `mapstructure:"seo_default_title"`
+	SocialLinks     map[string]string `mapstructure:"social_links"`
+}
+
+// requiredSiteSettings must be set to a non-empty value.
+var requiredSiteSettings = []string{"site_name", "site_url"}
+
+// IsRequiredSiteSetting reports whether the site config cannot be loaded
+// without the setting.
+func IsRequiredSiteSetting(key string) bool {
+	for _, required := range requiredSiteSettings {
+		if key == required {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadSiteConfig reads the site settings into a SiteConfig. Settings it has
+// no field for are ignored. A missing required setting is reported as
+// ErrMissingSiteSettings, naming every missing key.
+func LoadSiteConfig(ctx context.Context, repo *repositories.SiteSettingRepository) (*SiteConfig, error) {
+	settings, err := repo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return decodeSiteConfig(settings)
+}
+
+func decodeSiteConfig(settings map[string]*models.SiteSetting) (*SiteConfig, error) {
+	values := make(map[string]interface{}, len(settings))
+	for key, setting := range settings {
+		if setting.Value != nil {
+			values[key] = setting.Value
+		}
+	}
+
+	var missing []string
+	for _, key := range requiredSiteSettings {
+		if value, ok := values[key]; !ok || value == "" {
+			missing = append(missing, key)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("%w: %s", ErrMissingSiteSettings, strings.Join(missing, ", "))
+	}
+
+	var cfg SiteConfig
+	if err := mapstructure.Decode(values, &cfg); err != nil {
+		return nil, fmt.Errorf("decoding site settings: %w", err)
+	}
+
+	return &cfg, nil
+}
+
+// SiteConfigStore holds the current SiteConfig for concurrent readers.
+type SiteConfigStore struct {
+	repo *repositories.SiteSettingRepository
+
+	mu  sync.RWMutex
+	cfg *SiteConfig
+}
+
+// NewSiteConfigStore decodes the site config from settings already read
+// from repo, failing if it cannot be decoded. Refresh reads repo again.
+func NewSiteConfigStore(repo *repositories.SiteSettingRepository, settings map[string]*models.SiteSetting) (*SiteConfigStore, error) {
+	cfg, err := decodeSiteConfig(settings)
+	if err != nil {
+		return nil, err
+	}
+	return &SiteConfigStore{repo: repo, cfg: cfg}, nil
+}
+
+// Get returns the current site config. Callers must not modify it.
+func (s *SiteConfigStore) Get() *SiteConfig {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.cfg
+}
+
+// Refresh reloads the site config. If loading fails the current config is
+// kept.
+func (s *SiteConfigStore) Refresh(ctx context.Context) error {
+	cfg, err := LoadSiteConfig(ctx, s.repo)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.cfg = cfg
+	s.mu.Unlock()
+	return nil
+}
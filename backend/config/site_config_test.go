@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// settings builds the store's view of the given values, decoded from JSON
+// as GetAll returns them.
+func settings(values map[string]interface{}) map[string]*models.SiteSetting {
+	out := make(map[string]*models.SiteSetting, len(values))
+	for key, value := range values {
+		out[key] = &models.SiteSetting{Key: key, Value: value}
+	}
+	return out
+}
+
+func TestDecodeSiteConfigIgnoresUnknownKeys(t *testing.T) {
+	cfg, err := decodeSiteConfig(settings(map[string]interface{}{
+		"site_name":        "Integrated Site",
+		"site_url":         "https://example.com",
+		"maintenance_mode": true,
+		"social_links":     map[string]interface{}{"twitter": "https://twitter.com/example"},
+		"homepage_layout":  "grid",
+		"legacy_counter":   float64(3),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &SiteConfig{
+		SiteName:        "Integrated Site",
+		SiteURL:         "https://example.com",
+		MaintenanceMode: true,
+		SocialLinks:     map[string]string{"twitter": "https://twitter.com/example"},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("config = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestDecodeSiteConfigMissingRequired(t *testing.T) {
+	tests := []struct {
+		name    string
+		values  map[string]interface{}
+		missing string
+	}{
+		{"nothing set", map[string]interface{}{"logo_url": "/logo.png"}, "site_name, site_url"},
+		{"empty name", map[string]interface{}{"site_name": "", "site_url": "https://example.com"}, "site_name"},
+		{"unset URL", map[string]interface{}{"site_name": "Integrated Site", "site_url": nil}, "site_url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decodeSiteConfig(settings(tt.values))
+			if !errors.Is(err, ErrMissingSiteSettings) {
+				t.Fatalf("err = %v, want ErrMissingSiteSettings", err)
+			}
+			if !strings.HasSuffix(err.Error(), ": "+tt.missing) {
+				t.Errorf("err = %q, want it to name %s", err, tt.missing)
+			}
+		})
+	}
+}
+
+func TestDecodeSiteConfigWrongType(t *testing.T) {
+	_, err := decodeSiteConfig(settings(map[string]interface{}{
+		"site_name":        "Integrated Site",
+		"site_url":         "https://example.com",
+		"maintenance_mode": "sometimes",
+	}))
+	if err == nil || !strings.Contains(err.Error(), "maintenance_mode") {
+		t.Errorf("err = %v, want a decoding error naming maintenance_mode", err)
+	}
+}
+
+func TestIsRequiredSiteSetting(t *testing.T) {
+	for key, want := range map[string]bool{"site_name": true, "site_url": true, "logo_url": false} {
+		if got := IsRequiredSiteSetting(key); got != want {
+			t.Errorf("IsRequiredSiteSetting(%q) = %v, want %v", key, got, want)
+		}
+	}
+}
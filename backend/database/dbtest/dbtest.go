@@ -0,0 +1,55 @@
+// Package dbtest connects tests to a real Postgres database. Tests using it
+// are skipped unless TEST_DATABASE_URL points at a database initialised
+// with db/init.sql, e.g.
+//
+//	createdb integrated_site_test
+//	psql integrated_site_test -f db/init.sql
+//	TEST_DATABASE_URL=postgres://localhost/integrated_site_test go test ./...
+//
+// Tests create their own rows with unique names and remove them when they
+// finish, so they can share the database and run in parallel.
+package dbtest
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// Pool returns a pool connected to TEST_DATABASE_URL that is closed when
+// the test ends, or skips the test when the variable is not set.
+func Pool(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	pool, err := pgxpool.Connect(context.Background(), url)
+	if err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	return pool
+}
+
+// Exec runs a statement for a test's setup or cleanup, failing the test if
+// it errors.
+func Exec(t testing.TB, pool *pgxpool.Pool, sql string, args ...interface{}) {
+	t.Helper()
+
+	if _, err := pool.Exec(context.Background(), sql, args...); err != nil {
+		t.Fatalf("%s: %v", sql, err)
+	}
+}
+
+// UniqueName returns prefix followed by a random suffix, for slugs, emails
+// and codes that must not clash with other tests' rows.
+func UniqueName(prefix string) string {
+	return prefix + "-" + uuid.NewString()[:8]
+}
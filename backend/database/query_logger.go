@@ -0,0 +1,36 @@
+package database
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// SlowQueryLogger is a pgx.Logger that only reports queries slower than the
+// threshold, with their arguments passed through a QuerySanitizer.
+type SlowQueryLogger struct {
+	threshold time.Duration
+	sanitizer *QuerySanitizer
+}
+
+func NewSlowQueryLogger(threshold time.Duration, sanitizer *QuerySanitizer) *SlowQueryLogger {
+	return &SlowQueryLogger{threshold: threshold, sanitizer: sanitizer}
+}
+
+func (l *SlowQueryLogger) Log(ctx context.Context, level pgx.LogLevel, msg string, data map[string]interface{}) {
+	if msg != "Query" && msg != "Exec" {
+		return
+	}
+
+	elapsed, _ := data["time"].(time.Duration)
+	if elapsed < l.threshold {
+		return
+	}
+
+	query, _ := data["sql"].(string)
+	args, _ := data["args"].([]interface{})
+
+	log.Printf("Slow query (%s): %s args=%v\n", elapsed, query, l.sanitizer.Sanitize(query, args))
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxLoggedStringLength = 100
+	redactedValue         = "<redacted>"
+	truncatedValue        = "<truncated>"
+)
+
+var (
+	// col = $1, col <> $1, col LIKE $1, ...
+	comparisonParamPattern = regexp.MustCompile(`(?i)([\w.]+)\s*(?:=|<>|!=|<=|>=|<|>|\bI?LIKE\b)\s*\$(\d+)`)
+	// INSERT INTO t (col, ...) VALUES ($1, ...)
+	insertPattern = regexp.MustCompile(`(?is)INSERT\s+INTO\s+[\w.]+\s*\(([^)]*)\)\s*VALUES\s*\(([^)]*)\)`)
+	paramPattern  = regexp.MustCompile(`^\$(\d+)$`)
+)
+
+// QuerySanitizer scrubs query arguments before they are written to logs.
+// Arguments bound to columns whose names start with one of the sensitive
+// prefixes are redacted and long strings are truncated.
+type QuerySanitizer struct {
+	sensitivePrefixes []string
+}
+
+func NewQuerySanitizer() *QuerySanitizer {
+	return &QuerySanitizer{
+		sensitivePrefixes: []string{"password", "token", "secret"},
+	}
+}
+
+// Sanitize returns a copy of args that is safe to log. The original slice is
+// left untouched.
+func (s *QuerySanitizer) Sanitize(query string, args []interface{}) []interface{} {
+	sensitive := s.sensitivePositions(query)
+
+	sanitized := make([]interface{}, len(args))
+	for i, arg := range args {
+		switch {
+		case sensitive[i+1]:
+			sanitized[i] = redactedValue
+		default:
+			if str, ok := arg.(string); ok && len(str) > maxLoggedStringLength {
+				sanitized[i] = truncatedValue
+			} else {
+				sanitized[i] = arg
+			}
+		}
+	}
+
+	return sanitized
+}
+
+// sensitivePositions returns the 1-based parameter positions bound to
+// sensitive columns.
+func (s *QuerySanitizer) sensitivePositions(query string) map[int]bool {
+	positions := map[int]bool{}
+
+	for _, match := range comparisonParamPattern.FindAllStringSubmatch(query, -1) {
+		if s.isSensitive(match[1]) {
+			if n, err := strconv.Atoi(match[2]); err == nil {
+				positions[n] = true
+			}
+		}
+	}
+
+	for _, match := range insertPattern.FindAllStringSubmatch(query, -1) {
+		columns := strings.Split(match[1], ",")
+		values := strings.Split(match[2], ",")
+		for i := 0; i < len(columns) && i < len(values); i++ {
+			param := paramPattern.FindStringSubmatch(strings.TrimSpace(values[i]))
+			if param == nil || !s.isSensitive(columns[i]) {
+				continue
+			}
+			if n, err := strconv.Atoi(param[1]); err == nil {
+				positions[n] = true
+			}
+		}
+	}
+
+	return positions
+}
+
+func (s *QuerySanitizer) isSensitive(column string) bool {
+	column = strings.ToLower(strings.TrimSpace(column))
+	// Drop any table qualifier, e.g. u.password_hash
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		column = column[i+1:]
+	}
+
+	for _, prefix := range s.sensitivePrefixes {
+		if strings.HasPrefix(column, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package database
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestQuerySanitizer(t *testing.T) {
+	sanitizer := NewQuerySanitizer()
+	long := strings.Repeat("x", maxLoggedStringLength+1)
+
+	tests := []struct {
+		name  string
+		query string
+		args  []interface{}
+		want  []interface{}
+	}{
+		{
+			name:  "comparison with a sensitive column",
+			query: "SELECT id FROM auth.users WHERE email = $1 AND password_hash = $2",
+			args:  []interface{}{"a@example.com", "hash"},
+			want:  []interface{}{"a@example.com", redactedValue},
+		},
+		{
+			name:  "table-qualified column",
+			query: "SELECT 1 FROM auth.refresh_tokens rt WHERE rt.token_hash <> $1 AND rt.user_id = $2",
+			args:  []interface{}{"hash", 42},
+			want:  []interface{}{redactedValue, 42},
+		},
+		{
+			name:  "insert",
+			query: "INSERT INTO webhook_endpoints (url, secret, events)\nVALUES ($1, $2, $3)",
+			args:  []interface{}{"https://example.com", "s3cret", "order.created"},
+			want:  []interface{}{"https://example.com", redactedValue, "order.created"},
+		},
+		{
+			name:  "long strings truncated",
+			query: "UPDATE blog.posts SET content = $1 WHERE id = $2",
+			args:  []interface{}{long, "id"},
+			want:  []interface{}{truncatedValue, "id"},
+		},
+		{
+			name:  "nothing sensitive",
+			query: "SELECT id FROM blog.posts WHERE slug = $1 LIMIT $2",
+			args:  []interface{}{"hello", 10},
+			want:  []interface{}{"hello", 10},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := append([]interface{}(nil), tt.args...)
+
+			got := sanitizer.Sanitize(tt.query, tt.args)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Sanitize = %v, want %v", got, tt.want)
+			}
+			if !reflect.DeepEqual(tt.args, original) {
+				t.Errorf("Sanitize changed its arguments to %v", tt.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package database
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Schemas lists the base Postgres schemas the application uses.
+var Schemas = []string{"auth", "blog", "shop", "cms"}
+
+var (
+	schemaPrefixPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*$`)
+
+	schemaMu       sync.RWMutex
+	schemaPrefix   string
+	schemaReplacer = newSchemaReplacer("")
+)
+
+// SetSchemaPrefix makes every schema name start with prefix, so that several
+// instances can share one database. An empty prefix keeps the plain schema
+// names. It is meant to be called once at startup, before any query runs.
+func SetSchemaPrefix(prefix string) error {
+	if prefix != "" && !schemaPrefixPattern.MatchString(prefix) {
+		return fmt.Errorf("invalid schema prefix %q: use lowercase letters, digits and underscores", prefix)
+	}
+
+	schemaMu.Lock()
+	defer schemaMu.Unlock()
+
+	schemaPrefix = prefix
+	schemaReplacer = newSchemaReplacer(prefix)
+	return nil
+}
+
+// SchemaName returns the configured name of the base schema, e.g. "blog"
+// becomes "test_blog" with the prefix "test_".
+func SchemaName(base string) string {
+	schemaMu.RLock()
+	defer schemaMu.RUnlock()
+
+	return schemaPrefix + base
+}
+
+// Qualify replaces the {auth}, {blog}, {shop} and {cms} placeholders in a
+// query with the configured schema names.
+func Qualify(query string) string {
+	schemaMu.RLock()
+	defer schemaMu.RUnlock()
+
+	return schemaReplacer.Replace(query)
+}
+
+func newSchemaReplacer(prefix string) *strings.Replacer {
+	pairs := make([]string, 0, len(Schemas)*2)
+	for _, base := range Schemas {
+		pairs = append(pairs, "{"+base+"}", prefix+base)
+	}
+	return strings.NewReplacer(pairs...)
+}
@@ -0,0 +1,34 @@
+package database
+
+import "testing"
+
+func TestSchemaPrefix(t *testing.T) {
+	t.Cleanup(func() { SetSchemaPrefix("") })
+
+	query := "SELECT * FROM {blog}.posts p JOIN {auth}.users u ON u.id = p.author_id"
+	if got := Qualify(query); got != "SELECT * FROM blog.posts p JOIN auth.users u ON u.id = p.author_id" {
+		t.Errorf("Qualify without a prefix = %q", got)
+	}
+
+	if err := SetSchemaPrefix("test_"); err != nil {
+		t.Fatal(err)
+	}
+	if got := Qualify(query); got != "SELECT * FROM test_blog.posts p JOIN test_auth.users u ON u.id = p.author_id" {
+		t.Errorf("Qualify with test_ = %q", got)
+	}
+	if got := Qualify("{shop}.orders, {cms}.pages"); got != "test_shop.orders, test_cms.pages" {
+		t.Errorf("Qualify with test_ = %q", got)
+	}
+	if got := SchemaName("blog"); got != "test_blog" {
+		t.Errorf("SchemaName(blog) = %q, want test_blog", got)
+	}
+
+	for _, prefix := range []string{"Test_", "test-", "1test_", "test_; DROP"} {
+		if err := SetSchemaPrefix(prefix); err == nil {
+			t.Errorf("SetSchemaPrefix(%q) succeeded, want an error", prefix)
+		}
+	}
+	if got := SchemaName("blog"); got != "test_blog" {
+		t.Errorf("SchemaName after refused prefixes = %q, want test_blog", got)
+	}
+}
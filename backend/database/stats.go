@@ -0,0 +1,45 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+)
+
+// PoolStatsLogger logs the pool's connection statistics every interval until
+// ctx is cancelled, so pool health shows up in the logs without a metrics
+// scraper. A non-positive interval disables it.
+func PoolStatsLogger(ctx context.Context, pool *pgxpool.Pool, logger *zap.Logger, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				logPoolStats(logger, pool.Stat())
+			}
+		}
+	}()
+}
+
+func logPoolStats(logger *zap.Logger, stat *pgxpool.Stat) {
+	logger.Info("database pool stats",
+		zap.Int32("total_connections", stat.TotalConns()),
+		zap.Int32("idle_connections", stat.IdleConns()),
+		zap.Int32("acquired_connections", stat.AcquiredConns()),
+		zap.Int32("constructing_connections", stat.ConstructingConns()),
+		zap.Int32("max_connections", stat.MaxConns()),
+		// The health check closes connections past their max lifetime or
+		// idle time
+		zap.Int64("emptied_by_health_check_count", stat.MaxLifetimeDestroyCount()+stat.MaxIdleDestroyCount()),
+	)
+}
@@ -0,0 +1,98 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// A lazily connecting pool never dials, so it stands in for a real one
+// without a database.
+func newFakePool(t *testing.T, maxConns int32) *pgxpool.Pool {
+	t.Helper()
+
+	config, err := pgxpool.ParseConfig("postgres://test@127.0.0.1:1/test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.LazyConnect = true
+	config.MaxConns = maxConns
+	pool, err := pgxpool.ConnectConfig(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func TestPoolStatsLoggerLogsEachTick(t *testing.T) {
+	pool := newFakePool(t, 7)
+	core, logs := observer.New(zapcore.InfoLevel)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	PoolStatsLogger(ctx, pool, zap.New(core), 10*time.Millisecond)
+
+	deadline := time.Now().Add(time.Second)
+	for logs.FilterMessage("database pool stats").Len() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d stats entries after a second, want one per 10ms tick", logs.Len())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	want := map[string]int64{
+		"total_connections":             0,
+		"idle_connections":              0,
+		"acquired_connections":          0,
+		"constructing_connections":      0,
+		"max_connections":               7,
+		"emptied_by_health_check_count": 0,
+	}
+	for i, entry := range logs.All()[:3] {
+		fields := entry.ContextMap()
+		if len(fields) != len(want) {
+			t.Errorf("tick %d logged fields %v, want %v", i+1, fields, want)
+		}
+		for key, value := range want {
+			if got, ok := fields[key]; !ok || toInt64(got) != value {
+				t.Errorf("tick %d: %s = %v, want %d", i+1, key, got, value)
+			}
+		}
+	}
+
+	cancel()
+	// Let a tick already in progress finish before counting
+	time.Sleep(20 * time.Millisecond)
+	stopped := logs.Len()
+	time.Sleep(50 * time.Millisecond)
+	if logs.Len() != stopped {
+		t.Errorf("%d entries logged after the context was cancelled", logs.Len()-stopped)
+	}
+}
+
+func TestPoolStatsLoggerDisabled(t *testing.T) {
+	core, logs := observer.New(zapcore.InfoLevel)
+
+	PoolStatsLogger(context.Background(), newFakePool(t, 1), zap.New(core), 0)
+
+	time.Sleep(20 * time.Millisecond)
+	if logs.Len() != 0 {
+		t.Errorf("%d entries with a zero interval, want none", logs.Len())
+	}
+}
+
+func toInt64(v interface{}) int64 {
+	switch n := v.(type) {
+	case int32:
+		return int64(n)
+	case int64:
+		return n
+	}
+	return -1
+}
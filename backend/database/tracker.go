@@ -0,0 +1,62 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrShuttingDown is returned for transactions started after shutdown has
+// begun waiting for the in-flight ones.
+var ErrShuttingDown = errors.New("database is shutting down")
+
+// TransactionTracker counts in-flight database transactions so shutdown can
+// wait for them to finish before the pool is closed. Once Wait is called no
+// new transactions are counted, so the count can only go down.
+type TransactionTracker struct {
+	mu     sync.Mutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+func NewTransactionTracker() *TransactionTracker {
+	return &TransactionTracker{}
+}
+
+// Add counts delta new transactions, or returns ErrShuttingDown if Wait
+// has been called.
+func (t *TransactionTracker) Add(delta int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return ErrShuttingDown
+	}
+	t.wg.Add(delta)
+	return nil
+}
+
+func (t *TransactionTracker) Done() {
+	t.wg.Done()
+}
+
+// Wait stops new transactions from being counted, then blocks until every
+// tracked transaction has finished or ctx is done, in which case ctx.Err()
+// is returned.
+func (t *TransactionTracker) Wait(ctx context.Context) error {
+	t.mu.Lock()
+	t.closed = true
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
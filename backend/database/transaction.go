@@ -0,0 +1,42 @@
+package database
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// TxBeginner starts transactions. *pgxpool.Pool is the one used outside
+// tests.
+type TxBeginner interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+}
+
+// WithTransaction runs fn inside a transaction on pool. The transaction is
+// committed if fn returns nil and rolled back otherwise, including when fn
+// panics; the panic is then passed on. Statements in fn should use the ctx
+// given to WithTransaction so that cancelling it aborts them. The
+// transaction is registered with tracker, if any, until it has ended, so
+// shutdown waits for it; once shutdown has begun, no transaction is started
+// and ErrShuttingDown is returned. Read-only transactions can pass nil.
+func WithTransaction(ctx context.Context, pool TxBeginner, tracker *TransactionTracker, fn func(tx pgx.Tx) error) error {
+	if tracker != nil {
+		if err := tracker.Add(1); err != nil {
+			return err
+		}
+		defer tracker.Done()
+	}
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction is a no-op
+	defer tx.Rollback(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
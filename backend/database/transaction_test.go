@@ -0,0 +1,136 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+)
+
+// fakeTx records how a transaction ended. Any other method panics.
+type fakeTx struct {
+	pgx.Tx
+	committed  bool
+	rolledBack bool
+}
+
+func (tx *fakeTx) Commit(ctx context.Context) error {
+	tx.committed = true
+	return nil
+}
+
+func (tx *fakeTx) Rollback(ctx context.Context) error {
+	if !tx.committed {
+		tx.rolledBack = true
+	}
+	return nil
+}
+
+type fakeBeginner struct {
+	tx *fakeTx
+}
+
+func (b *fakeBeginner) Begin(ctx context.Context) (pgx.Tx, error) {
+	return b.tx, nil
+}
+
+func TestWithTransactionCommitsOnSuccess(t *testing.T) {
+	tx := &fakeTx{}
+
+	if err := WithTransaction(context.Background(), &fakeBeginner{tx: tx}, nil, func(pgx.Tx) error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if !tx.committed || tx.rolledBack {
+		t.Errorf("committed %v, rolled back %v; want committed only", tx.committed, tx.rolledBack)
+	}
+}
+
+func TestWithTransactionRollsBackOnError(t *testing.T) {
+	tx := &fakeTx{}
+	failure := errors.New("insert failed")
+
+	err := WithTransaction(context.Background(), &fakeBeginner{tx: tx}, nil, func(pgx.Tx) error { return failure })
+	if !errors.Is(err, failure) {
+		t.Fatalf("err = %v, want %v", err, failure)
+	}
+	if tx.committed || !tx.rolledBack {
+		t.Errorf("committed %v, rolled back %v; want rolled back only", tx.committed, tx.rolledBack)
+	}
+}
+
+// A panic in fn rolls the transaction back and releases the tracker before
+// carrying on, so neither the transaction nor shutdown is left waiting.
+func TestWithTransactionRollsBackOnPanic(t *testing.T) {
+	tx := &fakeTx{}
+	tracker := NewTransactionTracker()
+
+	func() {
+		defer func() {
+			if p := recover(); p != "boom" {
+				t.Errorf("recovered %v, want the panic from fn", p)
+			}
+		}()
+		WithTransaction(context.Background(), &fakeBeginner{tx: tx}, tracker, func(pgx.Tx) error {
+			panic("boom")
+		})
+	}()
+
+	if tx.committed || !tx.rolledBack {
+		t.Errorf("committed %v, rolled back %v; want rolled back only", tx.committed, tx.rolledBack)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := tracker.Wait(ctx); err != nil {
+		t.Errorf("tracker still counts the transaction: %v", err)
+	}
+}
+
+// Shutdown waits for a transaction still running, and transactions started
+// once it has begun waiting are refused rather than racing it.
+func TestTrackerWaitsForInFlightTransaction(t *testing.T) {
+	tracker := NewTransactionTracker()
+	started, finish := make(chan struct{}), make(chan struct{})
+	go WithTransaction(context.Background(), &fakeBeginner{tx: &fakeTx{}}, tracker, func(pgx.Tx) error {
+		close(started)
+		<-finish
+		return nil
+	})
+	<-started
+
+	expired, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := tracker.Wait(expired); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait with a transaction in flight = %v, want context.Canceled", err)
+	}
+
+	err := WithTransaction(context.Background(), &fakeBeginner{tx: &fakeTx{}}, tracker, func(pgx.Tx) error {
+		t.Error("a transaction ran after shutdown began")
+		return nil
+	})
+	if !errors.Is(err, ErrShuttingDown) {
+		t.Errorf("transaction after shutdown began: err = %v, want ErrShuttingDown", err)
+	}
+
+	waited := make(chan error, 1)
+	go func() {
+		waited <- tracker.Wait(context.Background())
+	}()
+	select {
+	case err := <-waited:
+		t.Fatalf("Wait returned %v while a transaction was in flight", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(finish)
+	select {
+	case err := <-waited:
+		if err != nil {
+			t.Errorf("Wait = %v, want nil", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after the transaction finished")
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type AnalyticsHandler struct {
+	analyticsService *services.AnalyticsService
+	searchAnalytics  *services.SearchAnalyticsService
+}
+
+func NewAnalyticsHandler(analyticsService *services.AnalyticsService, searchAnalytics *services.SearchAnalyticsService) *AnalyticsHandler {
+	return &AnalyticsHandler{
+		analyticsService: analyticsService,
+		searchAnalytics:  searchAnalytics,
+	}
+}
+
+// dashboardDefaultDays is the period the dashboard covers without ?from=.
+const dashboardDefaultDays = 30
+
+// Dashboard returns the shop's figures for ?from= to ?to= (YYYY-MM-DD, to
+// inclusive) compared with the period before. It covers the last 30 days up
+// to now by default.
+func (h *AnalyticsHandler) Dashboard(c *gin.Context) {
+	to := time.Now()
+	if raw := c.Query("to"); raw != "" {
+		parsed, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be formatted as YYYY-MM-DD"})
+			return
+		}
+		// Include the whole of the final day
+		to = parsed.AddDate(0, 0, 1)
+	}
+
+	from := to.AddDate(0, 0, -dashboardDefaultDays)
+	if raw := c.Query("from"); raw != "" {
+		parsed, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be formatted as YYYY-MM-DD"})
+			return
+		}
+		from = parsed
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return
+	}
+
+	stats, err := h.analyticsService.GetDashboardStats(c.Request.Context(), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *AnalyticsHandler) CustomerLTV(c *gin.Context) {
+	top, ok := parseTop(c, 100)
+	if !ok {
+		return
+	}
+
+	var since *time.Time
+	if raw := c.Query("since"); raw != "" {
+		parsed, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be formatted as YYYY-MM-DD"})
+			return
+		}
+		since = &parsed
+	}
+
+	customers, err := h.analyticsService.TopCustomersByLTV(c.Request.Context(), top, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, customers)
+}
+
+func (h *AnalyticsHandler) TopSearches(c *gin.Context) {
+	top, ok := parseTop(c, 50)
+	if !ok {
+		return
+	}
+
+	stats, err := h.searchAnalytics.TopQueries(c.Request.Context(), top)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *AnalyticsHandler) ZeroResultSearches(c *gin.Context) {
+	top, ok := parseTop(c, 50)
+	if !ok {
+		return
+	}
+
+	stats, err := h.searchAnalytics.ZeroResultQueries(c.Request.Context(), top)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// parseTop reads the "top" query parameter, capped at 1000. It writes a 400
+// response and returns false when the value is invalid.
+func parseTop(c *gin.Context, defaultTop int) (int, bool) {
+	top, err := strconv.Atoi(c.DefaultQuery("top", strconv.Itoa(defaultTop)))
+	if err != nil || top <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "top must be a positive integer"})
+		return 0, false
+	}
+	if top > 1000 {
+		top = 1000
+	}
+	return top, true
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type AuditHandler struct {
+	auditService *services.AuditLogService
+}
+
+func NewAuditHandler(auditService *services.AuditLogService) *AuditHandler {
+	return &AuditHandler{auditService: auditService}
+}
+
+// ListAuditLog lists the audit history of ?entity= (or ?entity_type=),
+// narrowed to one entity with ?entity_id=. Updates list their changes as
+// field, old and new.
+func (h *AuditHandler) ListAuditLog(c *gin.Context) {
+	limit, offset := parsePagination(c)
+
+	entityType := c.Query("entity")
+	if entityType == "" {
+		entityType = c.Query("entity_type")
+	}
+	entries, total, err := h.auditService.List(c.Request.Context(), entityType, c.Query("entity_id"), limit, offset)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAuditEntityType) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   entries,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
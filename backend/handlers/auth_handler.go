@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+const (
+	refreshTokenCookie = "refresh_token"
+	// The cookie is only sent to the auth endpoints that need it
+	refreshTokenCookiePath = "/api/auth"
+)
+
+type AuthHandler struct {
+	authService  *services.AuthService
+	cookieDomain string
+}
+
+func NewAuthHandler(authService *services.AuthService, cookieDomain string) *AuthHandler {
+	return &AuthHandler{authService: authService, cookieDomain: cookieDomain}
+}
+
+// Login returns the tokens in the body. With remember_me the refresh token
+// is also stored in an HTTP-only cookie so web clients can refresh without
+// keeping it in script-accessible storage.
+func (h *AuthHandler) Login(c *gin.Context) {
+	var req models.LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.authService.Login(c.Request.Context(), &req)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+
+	if req.RememberMe {
+		h.setRefreshCookie(c, tokens.RefreshToken, tokens.RefreshExpiresAt)
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Refresh exchanges a refresh token for new tokens. The token is read from
+// the Authorization header, falling back to the remember-me cookie. A
+// cookie-based session keeps its cookie, now holding the new refresh token.
+func (h *AuthHandler) Refresh(c *gin.Context) {
+	refreshToken, fromCookie := "", false
+	if authHeader := c.GetHeader("Authorization"); authHeader != "" {
+		parts := strings.Split(authHeader, " ")
+		if len(parts) != 2 || parts[0] != "Bearer" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
+			return
+		}
+		refreshToken = parts[1]
+	} else if cookie, err := c.Cookie(refreshTokenCookie); err == nil && cookie != "" {
+		refreshToken, fromCookie = cookie, true
+	}
+
+	if refreshToken == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token is required"})
+		return
+	}
+
+	tokens, err := h.authService.RefreshToken(c.Request.Context(), refreshToken)
+	if err != nil {
+		if fromCookie {
+			h.clearRefreshCookie(c)
+		}
+		respondAuthError(c, err)
+		return
+	}
+
+	if fromCookie {
+		h.setRefreshCookie(c, tokens.RefreshToken, tokens.RefreshExpiresAt)
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// Logout revokes the access and refresh tokens in the body, and the refresh
+// token from the remember-me cookie if there is one, and expires the cookie.
+// An empty body is allowed for cookie-based sessions.
+func (h *AuthHandler) Logout(c *gin.Context) {
+	var req models.LogoutRequest
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	tokens := []string{req.Token, req.RefreshToken}
+	if cookie, err := c.Cookie(refreshTokenCookie); err == nil {
+		tokens = append(tokens, cookie)
+	}
+	for _, token := range tokens {
+		if token == "" {
+			continue
+		}
+		if err := h.authService.Logout(c.Request.Context(), token); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+	}
+
+	h.clearRefreshCookie(c)
+	c.Status(http.StatusNoContent)
+}
+
+// GoogleLogin signs in with a Google ID token, registering a customer the
+// first time the Google account is used.
+func (h *AuthHandler) GoogleLogin(c *gin.Context) {
+	var req models.GoogleLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	tokens, err := h.authService.LoginWithGoogle(c.Request.Context(), req.IDToken)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RequestPasswordReset emails a password reset link. It answers the same
+// whether or not an account has the email.
+func (h *AuthHandler) RequestPasswordReset(c *gin.Context) {
+	var req models.PasswordResetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		respondAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "If an account exists for this email, a reset link has been sent"})
+}
+
+// ConfirmPasswordReset sets a new password with the token from a reset
+// email.
+func (h *AuthHandler) ConfirmPasswordReset(c *gin.Context) {
+	var req models.PasswordResetConfirmRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.authService.ResetPassword(c.Request.Context(), req.Token, req.NewPassword); err != nil {
+		respondAuthError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CreateAPIKey issues the caller an API key. The key is only ever returned
+// in this response.
+func (h *AuthHandler) CreateAPIKey(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	key, err := h.authService.CreateAPIKey(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), req.Label, req.Scopes)
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"key": key})
+}
+
+// ListAPIKeys lists the caller's API keys, without the keys themselves.
+func (h *AuthHandler) ListAPIKeys(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+
+	keys, err := h.authService.ListAPIKeys(c.Request.Context(), c.MustGet("user_id").(uuid.UUID))
+	if err != nil {
+		respondAuthError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
+}
+
+func (h *AuthHandler) RevokeAPIKey(c *gin.Context) {
+	if !requireSession(c) {
+		return
+	}
+
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key ID"})
+		return
+	}
+
+	if err := h.authService.RevokeAPIKey(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), id); err != nil {
+		respondAuthError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// requireSession rejects requests authenticated with an API key, so a key
+// cannot be used to mint keys with more scopes than its own. It reports
+// whether the request may go on.
+func requireSession(c *gin.Context) bool {
+	if _, viaAPIKey := c.Get("api_key_id"); viaAPIKey {
+		c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot be managed with an API key"})
+		return false
+	}
+	return true
+}
+
+func (h *AuthHandler) setRefreshCookie(c *gin.Context, token string, expiresAt time.Time) {
+	maxAge := int(time.Until(expiresAt).Seconds())
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(refreshTokenCookie, token, maxAge, refreshTokenCookiePath, h.cookieDomain, true, true)
+}
+
+func (h *AuthHandler) clearRefreshCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(refreshTokenCookie, "", -1, refreshTokenCookiePath, h.cookieDomain, true, true)
+}
+
+func respondAuthError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidCredentials):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
+	case errors.Is(err, services.ErrUserAlreadyExists):
+		c.JSON(http.StatusConflict, gin.H{"error": "User already exists"})
+	case errors.Is(err, services.ErrOAuthAccountConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "An account with this email already exists. Sign in with your email and password instead."})
+	case errors.Is(err, services.ErrInvalidToken):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+	case errors.Is(err, services.ErrTokenAlreadyUsed):
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used"})
+	case errors.Is(err, services.ErrResetTokenInvalid), errors.Is(err, services.ErrResetTokenExpired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired reset token"})
+	case errors.Is(err, services.ErrResetTokenUsed):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset token has already been used"})
+	case errors.Is(err, services.ErrAPIKeyScopeNotGranted):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAPIKeyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// The refresh token cookie is only set when remember_me asks for it, and
+// logging out expires it.
+func TestRememberMeCookie(t *testing.T) {
+	pool := dbtest.Pool(t)
+	gin.SetMode(gin.TestMode)
+	viper.Set("auth.jwt_secret", "test-secret")
+	t.Cleanup(func() { viper.Set("auth.jwt_secret", nil) })
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("correct horse"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := dbtest.UniqueName("remember") + "@example.com"
+	dbtest.Exec(t, pool, database.Qualify(`
+		INSERT INTO {auth}.users (email, password_hash, full_name, role) VALUES ($1, $2, 'Test User', 'customer')
+	`), email, string(hash))
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.users WHERE email = $1"), email)
+	})
+
+	authService := services.NewAuthService(
+		repositories.NewUserRepository(pool, nil),
+		repositories.NewRefreshTokenRepository(pool, nil),
+		repositories.NewPasswordResetTokenRepository(pool),
+		repositories.NewAPIKeyRepository(pool),
+		repositories.NewRevokedTokenRepository(pool),
+		nil,
+		nil,
+	)
+	handler := NewAuthHandler(authService, "example.com")
+	router := gin.New()
+	router.POST("/api/auth/login", handler.Login)
+	router.POST("/api/auth/logout", handler.Logout)
+
+	login := func(rememberMe bool) (*http.Cookie, *models.TokenResponse) {
+		t.Helper()
+		body, _ := json.Marshal(models.LoginRequest{Email: email, Password: "correct horse", RememberMe: rememberMe})
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(string(body)))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("login = %d %s, want 200", w.Code, w.Body)
+		}
+		var tokens models.TokenResponse
+		if err := json.Unmarshal(w.Body.Bytes(), &tokens); err != nil {
+			t.Fatal(err)
+		}
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.Name == refreshTokenCookie {
+				return cookie, &tokens
+			}
+		}
+		return nil, &tokens
+	}
+
+	if cookie, _ := login(false); cookie != nil {
+		t.Errorf("login without remember_me set %v, want no cookie", cookie)
+	}
+
+	cookie, tokens := login(true)
+	if cookie == nil {
+		t.Fatal("login with remember_me set no refresh_token cookie")
+	}
+	if cookie.Value != tokens.RefreshToken || !cookie.HttpOnly || !cookie.Secure ||
+		cookie.SameSite != http.SameSiteStrictMode || cookie.Domain != "example.com" ||
+		cookie.Path != refreshTokenCookiePath || cookie.MaxAge <= 0 {
+		t.Errorf("cookie = %+v, want the refresh token, HTTP-only, Secure, SameSite=Strict and a max age", cookie)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/logout", nil)
+	req.AddCookie(&http.Cookie{Name: refreshTokenCookie, Value: cookie.Value})
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	if w.Code != http.StatusNoContent {
+		t.Fatalf("logout = %d %s, want 204", w.Code, w.Body)
+	}
+	cleared := false
+	for _, c := range w.Result().Cookies() {
+		cleared = cleared || (c.Name == refreshTokenCookie && c.Value == "" && c.MaxAge < 0)
+	}
+	if !cleared {
+		t.Errorf("logout Set-Cookie = %q, want the refresh_token cookie expired", w.Header().Values("Set-Cookie"))
+	}
+}
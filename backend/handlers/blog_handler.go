@@ -0,0 +1,388 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/api"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type BlogHandler struct {
+	postService     *services.PostService
+	categoryService *services.CategoryService
+	tagService      *services.TagService
+	searchAnalytics *services.SearchAnalyticsService
+	masker          *api.Masker
+}
+
+func NewBlogHandler(
+	postService *services.PostService,
+	categoryService *services.CategoryService,
+	tagService *services.TagService,
+	searchAnalytics *services.SearchAnalyticsService,
+) *BlogHandler {
+	return &BlogHandler{
+		postService:     postService,
+		categoryService: categoryService,
+		tagService:      tagService,
+		searchAnalytics: searchAnalytics,
+		masker:          api.NewMasker(),
+	}
+}
+
+// ListPosts lists published posts, newest first. Searches (?q=) and
+// category listings (?category=) are offset paginated; the plain listing is
+// cursor paginated with ?after= and returns the next page's cursor.
+func (h *BlogHandler) ListPosts(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	categorySlug := c.Query("category")
+	if query == "" && categorySlug == "" {
+		h.listPublishedPosts(c)
+		return
+	}
+
+	limit, offset := parsePagination(c)
+
+	var posts []*models.Post
+	var total int
+	var err error
+	if query != "" {
+		posts, total, err = h.postService.SearchPublished(c.Request.Context(), query, limit, offset)
+		if err == nil {
+			h.searchAnalytics.Track(c.Request.Context(), query, total)
+		}
+	} else {
+		includeChildren := c.Query("include_children") == "true"
+		posts, total, err = h.postService.ListPublishedByCategory(c.Request.Context(), categorySlug, includeChildren, limit, offset)
+	}
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   posts,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func (h *BlogHandler) listPublishedPosts(c *gin.Context) {
+	after, limit, ok := parseCursorPagination(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.postService.ListPublished(c.Request.Context(), after, limit)
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func (h *BlogHandler) GetPost(c *gin.Context) {
+	post, err := h.postService.GetPublishedBySlug(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	// Only admins get to see the author's real email address
+	if c.GetString("role") != "admin" && post.Author != nil && post.Author.User != nil {
+		post.Author.User.Email = h.masker.MaskEmail(post.Author.User.Email)
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+func (h *BlogHandler) GetPostStats(c *gin.Context) {
+	stats, err := h.postService.GetStats(
+		c.Request.Context(),
+		c.Param("slug"),
+		c.MustGet("user_id").(uuid.UUID),
+		c.GetString("role"),
+	)
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+func (h *BlogHandler) GetPostSEOScore(c *gin.Context) {
+	score, err := h.postService.GetSEOScore(
+		c.Request.Context(),
+		c.Param("slug"),
+		c.MustGet("user_id").(uuid.UUID),
+		c.GetString("role"),
+	)
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, score)
+}
+
+// CreatePost creates a post by the caller, who becomes its author.
+func (h *BlogHandler) CreatePost(c *gin.Context) {
+	var req models.CreatePostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	post, err := h.postService.CreatePost(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), &req)
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, post)
+}
+
+func (h *BlogHandler) UpdatePost(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	var req models.UpdatePostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	post, err := h.postService.UpdatePost(
+		c.Request.Context(),
+		id,
+		c.MustGet("user_id").(uuid.UUID),
+		c.GetString("role"),
+		&req,
+	)
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// Autosave stores the caller's unsaved edits of a post.
+func (h *BlogHandler) Autosave(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	var req models.AutosavePostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	autosave, err := h.postService.Autosave(
+		c.Request.Context(),
+		id,
+		c.MustGet("user_id").(uuid.UUID),
+		c.GetString("role"),
+		&req,
+	)
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, autosave)
+}
+
+// GetAutosave returns the caller's autosave of a post, or 204 if there is
+// nothing newer than the saved post to restore.
+func (h *BlogHandler) GetAutosave(c *gin.Context) {
+	// The GET routes name this segment :slug, but here it holds the post ID
+	id, err := uuid.Parse(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	autosave, err := h.postService.GetAutosave(
+		c.Request.Context(),
+		id,
+		c.MustGet("user_id").(uuid.UUID),
+		c.GetString("role"),
+	)
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+	if autosave == nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	c.JSON(http.StatusOK, autosave)
+}
+
+func (h *BlogHandler) DuplicatePost(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	post, err := h.postService.DuplicatePost(
+		c.Request.Context(),
+		id,
+		c.MustGet("user_id").(uuid.UUID),
+		c.GetString("role"),
+	)
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, post)
+}
+
+func (h *BlogHandler) DeletePost(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	if err := h.postService.Delete(c.Request.Context(), id); err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *BlogHandler) RestorePost(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	post, err := h.postService.Restore(c.Request.Context(), id)
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, post)
+}
+
+// ListDeletedPosts lists the posts in the trash, most recently deleted
+// first.
+func (h *BlogHandler) ListDeletedPosts(c *gin.Context) {
+	limit, offset := parsePagination(c)
+
+	posts, total, err := h.postService.ListDeleted(c.Request.Context(), limit, offset)
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   posts,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func (h *BlogHandler) ListCategories(c *gin.Context) {
+	tree, err := h.categoryService.GetTree(c.Request.Context())
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, tree)
+}
+
+func (h *BlogHandler) GetCategory(c *gin.Context) {
+	category, err := h.categoryService.GetBySlug(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+func (h *BlogHandler) DeleteCategory(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	if err := h.categoryService.Delete(c.Request.Context(), id); err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// CreateTags creates up to 500 tags at once for content imports. Tags that
+// already exist are counted as skipped.
+func (h *BlogHandler) CreateTags(c *gin.Context) {
+	var req models.CreateTagsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := h.tagService.CreateBatch(c.Request.Context(), &req)
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func respondBlogError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrPostNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+	case errors.Is(err, services.ErrPostForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+	case errors.Is(err, services.ErrInvalidSchedule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Scheduled posts need a scheduled_at in the future"})
+	case errors.Is(err, services.ErrMediaNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+	case errors.Is(err, services.ErrMediaNotImage), errors.Is(err, services.ErrMediaPrivate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Post was modified by someone else, reload it and try again"})
+	case errors.Is(err, services.ErrCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+	case errors.Is(err, repositories.ErrCategoryHasChildren):
+		c.JSON(http.StatusConflict, gin.H{"error": "Category has child categories"})
+	case errors.Is(err, services.ErrInvalidTag):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
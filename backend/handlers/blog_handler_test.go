@@ -0,0 +1,192 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// The author's email on a post is masked for anonymous readers and
+// customers, and shown in full to admins.
+func TestGetPostMasksAuthorEmail(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+
+	var userID, authorID uuid.UUID
+	name := dbtest.UniqueName("masked")
+	email := name + "@example.com"
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {auth}.users (email, password_hash, full_name, role)
+		VALUES ($1, 'x', 'Test Author', 'contributor')
+		RETURNING id
+	`), email).Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.users WHERE id = $1"), userID)
+	})
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.authors (user_id) VALUES ($1) RETURNING id
+	`), userID).Scan(&authorID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.posts WHERE author_id = $1"), authorID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.authors WHERE id = $1"), authorID)
+	})
+	dbtest.Exec(t, pool, database.Qualify(`
+		INSERT INTO {blog}.posts (title, slug, content, author_id, status, published_at)
+		VALUES ($1, $1, 'Content', $2, 'published', NOW())
+	`), name, authorID)
+
+	postRepo := repositories.NewPostRepository(pool, nil, repositories.NewRedirectRepository(pool))
+	postService := services.NewPostService(postRepo, nil, nil, nil, nil, nil, nil)
+	handler := NewBlogHandler(postService, nil, nil, nil)
+
+	gin.SetMode(gin.TestMode)
+	get := func(role string) string {
+		t.Helper()
+		router := gin.New()
+		router.GET("/api/blog/posts/:slug", func(c *gin.Context) {
+			if role != "" {
+				c.Set("role", role)
+			}
+		}, handler.GetPost)
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/blog/posts/"+name, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("as %q: status = %d, want 200", role, w.Code)
+		}
+		var post models.Post
+		if err := json.Unmarshal(w.Body.Bytes(), &post); err != nil {
+			t.Fatal(err)
+		}
+		if post.Author == nil || post.Author.User == nil {
+			t.Fatalf("as %q: post has no author user", role)
+		}
+		return post.Author.User.Email
+	}
+
+	masked := "m***@example.com"
+	if got := get(""); got != masked {
+		t.Errorf("anonymous reader sees %q, want %q", got, masked)
+	}
+	if got := get("customer"); got != masked {
+		t.Errorf("customer sees %q, want %q", got, masked)
+	}
+	if got := get("admin"); got != email {
+		t.Errorf("admin sees %q, want %q", got, email)
+	}
+}
+
+// An explicit save clears the editor's autosave, and an autosave older than
+// the saved post is not offered back: both answer 204.
+func TestAutosaveClearedByExplicitSave(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+
+	var userID, authorID, postID uuid.UUID
+	name := dbtest.UniqueName("autosave")
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {auth}.users (email, password_hash, full_name, role)
+		VALUES ($1, 'x', 'Test Author', 'contributor')
+		RETURNING id
+	`), name+"@example.com").Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.users WHERE id = $1"), userID)
+	})
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.authors (user_id) VALUES ($1) RETURNING id
+	`), userID).Scan(&authorID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.audit_logs WHERE actor_id = $1"), userID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.posts WHERE author_id = $1"), authorID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.authors WHERE id = $1"), authorID)
+	})
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.posts (title, slug, content, author_id, status)
+		VALUES ($1, $1, 'First draft', $2, 'draft')
+		RETURNING id
+	`), name, authorID).Scan(&postID); err != nil {
+		t.Fatal(err)
+	}
+
+	postRepo := repositories.NewPostRepository(pool, nil, repositories.NewRedirectRepository(pool))
+	autosaveRepo := repositories.NewPostAutosaveRepository(pool)
+	audit := services.NewPostAuditService(repositories.NewAuditRepository(pool))
+	postService := services.NewPostService(postRepo, nil, autosaveRepo, nil, audit, nil, nil)
+	handler := NewBlogHandler(postService, nil, nil, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Set("role", "contributor")
+	})
+	router.PUT("/api/blog/posts/:id", handler.UpdatePost)
+	router.POST("/api/blog/posts/:id/autosave", handler.Autosave)
+	router.GET("/api/blog/posts/:slug/autosave", handler.GetAutosave)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		t.Helper()
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+	autosavePath := "/api/blog/posts/" + postID.String() + "/autosave"
+
+	if w := send(http.MethodPost, autosavePath, `{"title": "Unsaved", "content": "Second draft"}`); w.Code != http.StatusOK {
+		t.Fatalf("autosave: status = %d, want 200: %s", w.Code, w.Body)
+	}
+	w := send(http.MethodGet, autosavePath, "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("autosave newer than the post: status = %d, want 200", w.Code)
+	}
+	var autosave models.PostAutosave
+	if err := json.Unmarshal(w.Body.Bytes(), &autosave); err != nil {
+		t.Fatal(err)
+	}
+	if autosave.Title != "Unsaved" || autosave.Content != "Second draft" {
+		t.Errorf("autosave = %q %q, want the unsaved edits", autosave.Title, autosave.Content)
+	}
+
+	body := `{"title": "Saved", "slug": "` + name + `", "content": "Second draft", "status": "draft", "version": 1}`
+	if w := send(http.MethodPut, "/api/blog/posts/"+postID.String(), body); w.Code != http.StatusOK {
+		t.Fatalf("update: status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if stored, err := autosaveRepo.Get(ctx, postID, userID); err != nil || stored != nil {
+		t.Errorf("autosave after an explicit save = %v, %v; want deleted", stored, err)
+	}
+	if w := send(http.MethodGet, autosavePath, ""); w.Code != http.StatusNoContent {
+		t.Errorf("after an explicit save: status = %d, want 204", w.Code)
+	}
+
+	// An autosave from before the post's last save, as left by another tab
+	if w := send(http.MethodPost, autosavePath, `{"title": "Stale", "content": "Old draft"}`); w.Code != http.StatusOK {
+		t.Fatalf("autosave: status = %d, want 200", w.Code)
+	}
+	dbtest.Exec(t, pool, database.Qualify(`
+		UPDATE {blog}.post_autosaves SET saved_at = NOW() - INTERVAL '1 hour' WHERE post_id = $1
+	`), postID)
+	if w := send(http.MethodGet, autosavePath, ""); w.Code != http.StatusNoContent {
+		t.Errorf("stale autosave: status = %d, want 204", w.Code)
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type BundleHandler struct {
+	bundleService *services.BundleService
+}
+
+func NewBundleHandler(bundleService *services.BundleService) *BundleHandler {
+	return &BundleHandler{bundleService: bundleService}
+}
+
+// GetBundle returns an active bundle with both its regular total and its
+// bundle price, so the savings can be shown.
+func (h *BundleHandler) GetBundle(c *gin.Context) {
+	bundle, err := h.bundleService.GetBySlug(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		if errors.Is(err, services.ErrBundleNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Bundle not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, bundle)
+}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type CartHandler struct {
+	cartService *services.CartService
+}
+
+func NewCartHandler(cartService *services.CartService) *CartHandler {
+	return &CartHandler{cartService: cartService}
+}
+
+// GetCart returns the caller's cart with its items, subtotal, discount and
+// total.
+func (h *CartHandler) GetCart(c *gin.Context) {
+	cart, err := h.cartService.GetCart(c.Request.Context(), c.MustGet("user_id").(uuid.UUID))
+	if err != nil {
+		respondCartError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+// AddItem adds a product to the caller's cart and returns the cart.
+func (h *CartHandler) AddItem(c *gin.Context) {
+	var req models.AddCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err := h.cartService.AddToCart(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), &req)
+	if err != nil {
+		respondCartError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+// AddBundle adds a bundle's products to the caller's cart at the bundle
+// price and returns the cart.
+func (h *CartHandler) AddBundle(c *gin.Context) {
+	var req models.AddCartBundleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err := h.cartService.AddBundle(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), &req)
+	if err != nil {
+		respondCartError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+// UpdateItem sets the quantity of an item in the caller's cart and returns
+// the cart.
+func (h *CartHandler) UpdateItem(c *gin.Context) {
+	itemID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cart item ID"})
+		return
+	}
+
+	var req models.UpdateCartItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart, err := h.cartService.UpdateItem(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), itemID, &req)
+	if err != nil {
+		respondCartError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+// RemoveItem removes an item from the caller's cart and returns the cart.
+func (h *CartHandler) RemoveItem(c *gin.Context) {
+	itemID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cart item ID"})
+		return
+	}
+
+	cart, err := h.cartService.RemoveItem(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), itemID)
+	if err != nil {
+		respondCartError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, cart)
+}
+
+// ApplyCoupon applies a coupon code to the caller's cart and returns the
+// cart with its discount.
+func (h *CartHandler) ApplyCoupon(c *gin.Context) {
+	var req models.ApplyCouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+	cart, err := h.cartService.GetCart(c.Request.Context(), userID)
+	if err != nil {
+		respondCartError(c, err)
+		return
+	}
+
+	if _, err := h.cartService.ApplyCoupon(c.Request.Context(), cart.ID, req.Code); err != nil {
+		respondCartError(c, err)
+		return
+	}
+
+	h.GetCart(c)
+}
+
+// RemoveCoupon removes the coupon from the caller's cart and returns the
+// cart.
+func (h *CartHandler) RemoveCoupon(c *gin.Context) {
+	userID := c.MustGet("user_id").(uuid.UUID)
+	cart, err := h.cartService.GetCart(c.Request.Context(), userID)
+	if err != nil {
+		respondCartError(c, err)
+		return
+	}
+
+	if err := h.cartService.RemoveCoupon(c.Request.Context(), cart.ID); err != nil {
+		respondCartError(c, err)
+		return
+	}
+
+	h.GetCart(c)
+}
+
+func respondCartError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	case errors.Is(err, services.ErrProductVariantNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product variant not found"})
+	case errors.Is(err, services.ErrBundleNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bundle not found"})
+	case errors.Is(err, services.ErrCartItemNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart item not found"})
+	case errors.Is(err, services.ErrCartBundleItem):
+		c.JSON(http.StatusConflict, gin.H{"error": "The items of a bundle can only be removed together"})
+	case errors.Is(err, services.ErrVariantRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Choose a variant of this product"})
+	case errors.Is(err, services.ErrOutOfStock):
+		c.JSON(http.StatusConflict, gin.H{"error": "Not enough stock"})
+	case errors.Is(err, services.ErrCartEmpty):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+	case errors.Is(err, services.ErrCouponNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+	case errors.Is(err, services.ErrCouponExpired),
+		errors.Is(err, services.ErrCouponUsedUp),
+		errors.Is(err, services.ErrCouponMinimumNotMet),
+		errors.Is(err, services.ErrCouponNotApplicable):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
+
@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type CommentHandler struct {
+	commentService *services.CommentService
+}
+
+func NewCommentHandler(commentService *services.CommentService) *CommentHandler {
+	return &CommentHandler{commentService: commentService}
+}
+
+// CreateComment posts the caller's comment on a post, to be shown once a
+// moderator approves it.
+func (h *CommentHandler) CreateComment(c *gin.Context) {
+	postID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	var req models.CreateCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment, err := h.commentService.Create(c.Request.Context(), postID, c.MustGet("user_id").(uuid.UUID), &req)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+// ListPostComments returns the approved comments of a post, given by ID, as
+// a tree of replies.
+func (h *CommentHandler) ListPostComments(c *gin.Context) {
+	postID, err := uuid.Parse(c.Param("slug"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid post ID"})
+		return
+	}
+
+	comments, err := h.commentService.GetThreaded(c.Request.Context(), postID)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"comments": comments})
+}
+
+func (h *CommentHandler) ReportComment(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+
+	var req models.ReportCommentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	report, err := h.commentService.Report(c.Request.Context(), id, c.MustGet("user_id").(uuid.UUID), req.Reason)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, report)
+}
+
+// ListComments serves the moderation queue, filtered by ?status=, with the
+// number of comments in it.
+func (h *CommentHandler) ListComments(c *gin.Context) {
+	limit, offset := parsePagination(c)
+
+	comments, total, err := h.commentService.ListByStatus(c.Request.Context(), c.Query("status"), limit, offset)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   comments,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// UpdateStatus moderates a comment. Moves the transition rules do not allow
+// are answered with 422 unless the request sets override.
+func (h *CommentHandler) UpdateStatus(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid comment ID"})
+		return
+	}
+
+	var req models.UpdateCommentStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	comment, err := h.commentService.SetStatus(c.Request.Context(), id, c.MustGet("user_id").(uuid.UUID), &req)
+	if err != nil {
+		respondCommentError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, comment)
+}
+
+func respondCommentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrCommentNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Comment not found"})
+	case errors.Is(err, services.ErrPostNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Post not found"})
+	case errors.Is(err, services.ErrInvalidCommentParent):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidCommentTransition):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "The comment was moderated by someone else in the meantime"})
+	case errors.Is(err, repositories.ErrAlreadyReported):
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already reported this comment"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
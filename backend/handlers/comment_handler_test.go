@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// A moderator cannot move a spam comment back without an override: the
+// attempt is refused with 422 and leaves the comment alone.
+func TestUpdateCommentStatusRejectsInvalidTransition(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+
+	var userID, authorID, postID, commentID uuid.UUID
+	name := dbtest.UniqueName("moderation")
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {auth}.users (email, password_hash, full_name, role)
+		VALUES ($1, 'x', 'Test Moderator', 'admin')
+		RETURNING id
+	`), name+"@example.com").Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.users WHERE id = $1"), userID)
+	})
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.authors (user_id) VALUES ($1) RETURNING id
+	`), userID).Scan(&authorID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.authors WHERE id = $1"), authorID)
+	})
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.posts (title, slug, content, author_id, status)
+		VALUES ($1, $1, 'Content', $2, 'published')
+		RETURNING id
+	`), name, authorID).Scan(&postID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.posts WHERE id = $1"), postID)
+	})
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.comments (post_id, user_id, content, status)
+		VALUES ($1, $2, 'Buy now', 'spam')
+		RETURNING id
+	`), postID, userID).Scan(&commentID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.audit_logs WHERE entity_id = $1"), commentID.String())
+	})
+
+	commentService := services.NewCommentService(
+		repositories.NewCommentRepository(pool, nil, repositories.NewUserRepository(pool, nil)),
+		repositories.NewCommentReportRepository(pool),
+		repositories.NewPostRepository(pool, nil, repositories.NewRedirectRepository(pool)),
+		nil,
+	)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.PUT("/admin/comments/:id/status", func(c *gin.Context) {
+		c.Set("user_id", userID)
+	}, NewCommentHandler(commentService).UpdateStatus)
+
+	put := func(body string) int {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPut, "/admin/comments/"+commentID.String()+"/status", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	if code := put(`{"status": "pending"}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("spam -> pending: status = %d, want 422", code)
+	}
+	if code := put(`{"status": "approved"}`); code != http.StatusUnprocessableEntity {
+		t.Errorf("spam -> approved: status = %d, want 422", code)
+	}
+
+	var status string
+	if err := pool.QueryRow(ctx, database.Qualify("SELECT status FROM {blog}.comments WHERE id = $1"), commentID).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status != "spam" {
+		t.Errorf("comment status = %s after refused moves, want spam", status)
+	}
+
+	if code := put(`{"status": "pending", "override": true}`); code != http.StatusOK {
+		t.Errorf("spam -> pending with override: status = %d, want 200", code)
+	}
+}
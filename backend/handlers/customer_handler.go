@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type CustomerHandler struct {
+	customerService  *services.CustomerService
+	analyticsService *services.CustomerAnalyticsService
+}
+
+func NewCustomerHandler(customerService *services.CustomerService, analyticsService *services.CustomerAnalyticsService) *CustomerHandler {
+	return &CustomerHandler{customerService: customerService, analyticsService: analyticsService}
+}
+
+// MergeCustomers moves everything from the secondary customer onto the
+// primary one and anonymizes the secondary account.
+func (h *CustomerHandler) MergeCustomers(c *gin.Context) {
+	var req models.MergeCustomersRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.customerService.Merge(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), req.PrimaryID, req.SecondaryID)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrMergeSameCustomer):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "primary_id and secondary_id must differ"})
+		case errors.Is(err, repositories.ErrCustomerNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetAnalytics returns the customer's purchase history analytics.
+func (h *CustomerHandler) GetAnalytics(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid customer ID"})
+		return
+	}
+
+	analytics, err := h.analyticsService.GetCustomerAnalytics(c.Request.Context(), id)
+	if err != nil {
+		if errors.Is(err, repositories.ErrCustomerNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Customer not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, analytics)
+}
@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type EmailQueueHandler struct {
+	queueService *services.EmailQueueService
+}
+
+func NewEmailQueueHandler(queueService *services.EmailQueueService) *EmailQueueHandler {
+	return &EmailQueueHandler{queueService: queueService}
+}
+
+// ListEmails lists the queued emails with ?status=, failed ones by default.
+func (h *EmailQueueHandler) ListEmails(c *gin.Context) {
+	limit, offset := parsePagination(c)
+
+	emails, total, err := h.queueService.List(c.Request.Context(), c.DefaultQuery("status", "failed"), limit, offset)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidEmailStatus) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "status must be pending, sent or failed"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   emails,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// RetryEmail queues an unsent email for immediate sending.
+func (h *EmailQueueHandler) RetryEmail(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email ID"})
+		return
+	}
+
+	if err := h.queueService.Retry(c.Request.Context(), id); err != nil {
+		if errors.Is(err, repositories.ErrEmailNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "No unsent email with this ID"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
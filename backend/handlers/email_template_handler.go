@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type EmailTemplateHandler struct {
+	templateService *services.EmailTemplateService
+}
+
+func NewEmailTemplateHandler(templateService *services.EmailTemplateService) *EmailTemplateHandler {
+	return &EmailTemplateHandler{templateService: templateService}
+}
+
+// ListTemplates lists every email template, with the variables each can
+// use in its description.
+func (h *EmailTemplateHandler) ListTemplates(c *gin.Context) {
+	templates, err := h.templateService.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, templates)
+}
+
+// UpdateTemplate replaces the named template with the admin's version.
+func (h *EmailTemplateHandler) UpdateTemplate(c *gin.Context) {
+	var req models.UpdateEmailTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	template, err := h.templateService.Update(c.Request.Context(), c.Param("name"), &req)
+	if err != nil {
+		respondEmailTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, template)
+}
+
+// PreviewTemplate renders the named template with sample data.
+func (h *EmailTemplateHandler) PreviewTemplate(c *gin.Context) {
+	email, err := h.templateService.Preview(c.Request.Context(), c.Param("name"))
+	if err != nil {
+		respondEmailTemplateError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, email)
+}
+
+func respondEmailTemplateError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrEmailTemplateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Email template not found"})
+	case errors.Is(err, services.ErrInvalidEmailTemplate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type EventHandler struct {
+	eventService *services.EventService
+}
+
+func NewEventHandler(eventService *services.EventService) *EventHandler {
+	return &EventHandler{eventService: eventService}
+}
+
+func (h *EventHandler) ListUpcoming(c *gin.Context) {
+	limit, offset := parsePagination(c)
+
+	events, total, err := h.eventService.ListUpcoming(c.Request.Context(), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   events,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func (h *EventHandler) CheckIn(c *gin.Context) {
+	eventID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	ticketID, err := uuid.Parse(c.Query("ticket_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ticket ID"})
+		return
+	}
+
+	ticket, err := h.eventService.CheckIn(c.Request.Context(), eventID, ticketID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrTicketNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Ticket not found"})
+		case errors.Is(err, repositories.ErrTicketCheckedIn):
+			c.JSON(http.StatusConflict, gin.H{"error": "Ticket already checked in"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, ticket)
+}
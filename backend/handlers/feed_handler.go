@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// feedSize is how many of the latest posts a feed carries.
+const feedSize = 20
+
+type FeedHandler struct {
+	postService *services.PostService
+	feedService *services.FeedService
+}
+
+func NewFeedHandler(postService *services.PostService, feedService *services.FeedService) *FeedHandler {
+	return &FeedHandler{postService: postService, feedService: feedService}
+}
+
+// CategoryFeed serves the RSS feed of a blog category. Unknown categories
+// are a 404 rather than an empty feed.
+func (h *FeedHandler) CategoryFeed(c *gin.Context) {
+	category, posts, err := h.postService.ListCategoryFeed(c.Request.Context(), c.Param("slug"), feedSize)
+	if err != nil {
+		respondBlogError(c, err)
+		return
+	}
+
+	h.renderRSS(c, h.feedService.CategoryRSS(category, posts))
+}
+
+// RSSFeed serves the RSS feed of the latest posts.
+func (h *FeedHandler) RSSFeed(c *gin.Context) {
+	feed, ok := h.latestFeed(c)
+	if !ok {
+		return
+	}
+
+	h.renderRSS(c, h.feedService.RSS(feed))
+}
+
+// AtomFeed serves the Atom feed of the latest posts.
+func (h *FeedHandler) AtomFeed(c *gin.Context) {
+	feed, ok := h.latestFeed(c)
+	if !ok {
+		return
+	}
+
+	h.renderXML(c, "application/atom+xml; charset=utf-8", h.feedService.Atom(feed))
+}
+
+// latestFeed loads the latest posts and sets the feed's validators. It
+// reports false when the response is already written: on an error, or
+// with a 304 when the client's If-None-Match has the current ETag.
+func (h *FeedHandler) latestFeed(c *gin.Context) (*services.BlogFeed, bool) {
+	feed, err := h.feedService.Latest(c.Request.Context(), feedSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return nil, false
+	}
+
+	c.Header("ETag", feed.ETag)
+	if !feed.LastModified.IsZero() {
+		c.Header("Last-Modified", feed.LastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if etagMatches(c.GetHeader("If-None-Match"), feed.ETag) {
+		c.Status(http.StatusNotModified)
+		return nil, false
+	}
+	return feed, true
+}
+
+// etagMatches reports whether an If-None-Match header lists etag. Weak
+// validators match their strong form, as RFC 9110 asks for If-None-Match.
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *FeedHandler) renderRSS(c *gin.Context, feed *services.RSSFeed) {
+	h.renderXML(c, "application/rss+xml; charset=utf-8", feed)
+}
+
+func (h *FeedHandler) renderXML(c *gin.Context, contentType string, document interface{}) {
+	body, err := xml.MarshalIndent(document, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, append([]byte(xml.Header), body...))
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// The category feed carries the category's published posts only, and an
+// unknown category is a 404.
+func TestCategoryFeed(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+
+	var userID, authorID, categoryID uuid.UUID
+	name := dbtest.UniqueName("feed")
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {auth}.users (email, password_hash, full_name, role)
+		VALUES ($1, 'x', 'Test Author', 'contributor')
+		RETURNING id
+	`), name+"@example.com").Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.users WHERE id = $1"), userID)
+	})
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.authors (user_id) VALUES ($1) RETURNING id
+	`), userID).Scan(&authorID); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.categories (name, slug, description) VALUES ($1, $1, 'Notes from the kitchen') RETURNING id
+	`), name).Scan(&categoryID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.posts WHERE author_id = $1"), authorID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.authors WHERE id = $1"), authorID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.categories WHERE id = $1"), categoryID)
+	})
+
+	posts := []struct{ title, status string }{
+		{name + "-bread", "published"},
+		{name + "-soup", "published"},
+		{name + "-draft", "draft"},
+	}
+	for _, post := range posts {
+		var postID uuid.UUID
+		if err := pool.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {blog}.posts (title, slug, content, author_id, status, published_at)
+			VALUES ($1, $1, 'Content', $2, $3, CASE WHEN $3 = 'published' THEN NOW() END)
+			RETURNING id
+		`), post.title, authorID, post.status).Scan(&postID); err != nil {
+			t.Fatal(err)
+		}
+		dbtest.Exec(t, pool, database.Qualify(`
+			INSERT INTO {blog}.post_categories (post_id, category_id) VALUES ($1, $2)
+		`), postID, categoryID)
+	}
+
+	postRepo := repositories.NewPostRepository(pool, nil, repositories.NewRedirectRepository(pool))
+	postService := services.NewPostService(postRepo, repositories.NewCategoryRepository(pool), nil, nil, nil, nil, nil)
+	handler := NewFeedHandler(postService, services.NewFeedService(postRepo, "Test Site", "https://example.com"))
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/api/blog/categories/:slug/feed.rss", handler.CategoryFeed)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/blog/categories/"+name+"/feed.rss", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	var feed struct {
+		Version string `xml:"version,attr"`
+		Channel struct {
+			Title       string `xml:"title"`
+			Description string `xml:"description"`
+			Items       []struct {
+				Title string `xml:"title"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("feed is not well-formed: %v\n%s", err, w.Body)
+	}
+	if feed.Version != "2.0" || feed.Channel.Title != "Test Site - "+name || feed.Channel.Description != "Notes from the kitchen" {
+		t.Errorf("channel = RSS %s %q %q, want RSS 2.0 titled after the site and category with its description",
+			feed.Version, feed.Channel.Title, feed.Channel.Description)
+	}
+	titles := map[string]bool{}
+	for _, item := range feed.Channel.Items {
+		titles[item.Title] = true
+	}
+	if len(titles) != 2 || !titles[posts[0].title] || !titles[posts[1].title] {
+		t.Errorf("items = %v, want the two published posts without the draft", titles)
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/blog/categories/"+name+"-missing/feed.rss", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("unknown category: status = %d, want 404", w.Code)
+	}
+}
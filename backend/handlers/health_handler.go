@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+const healthCheckTimeout = 2 * time.Second
+
+// HealthChecker probes a single dependency.
+type HealthChecker interface {
+	Name() string
+	Check(ctx context.Context) error
+}
+
+// CheckFunc adapts a function to a HealthChecker.
+func CheckFunc(name string, check func(ctx context.Context) error) HealthChecker {
+	return checkFunc{name: name, check: check}
+}
+
+type checkFunc struct {
+	name  string
+	check func(ctx context.Context) error
+}
+
+func (f checkFunc) Name() string                    { return f.name }
+func (f checkFunc) Check(ctx context.Context) error { return f.check(ctx) }
+
+// registeredCheck is a checker plus whether it is critical. A failing
+// critical dependency takes the whole service down; any other failure only
+// degrades it.
+type registeredCheck struct {
+	checker  HealthChecker
+	critical bool
+}
+
+type CheckResult struct {
+	Status    string `json:"status"`
+	LatencyMS int64  `json:"latency_ms"`
+	Error     string `json:"error,omitempty"`
+}
+
+type HealthHandler struct {
+	checks []registeredCheck
+}
+
+// NewHealthHandler checks the Postgres pool as a critical dependency.
+// Optional dependencies can be registered with AddCheck.
+func NewHealthHandler(dbPool *pgxpool.Pool) *HealthHandler {
+	return newHealthHandler(CheckFunc("postgres", dbPool.Ping))
+}
+
+// newHealthHandler checks database as the critical dependency.
+func newHealthHandler(database HealthChecker) *HealthHandler {
+	return &HealthHandler{
+		checks: []registeredCheck{
+			{checker: database, critical: true},
+		},
+	}
+}
+
+// AddCheck registers a non-critical dependency.
+func (h *HealthHandler) AddCheck(checker HealthChecker) {
+	h.checks = append(h.checks, registeredCheck{checker: checker})
+}
+
+// Health reports every dependency: 200 when all pass, 207 when a
+// non-critical one fails and 503 when a critical one fails.
+func (h *HealthHandler) Health(c *gin.Context) {
+	h.respond(c, h.checks)
+}
+
+// Live only tells the orchestrator the process is up.
+func (h *HealthHandler) Live(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Ready checks the critical dependencies only.
+func (h *HealthHandler) Ready(c *gin.Context) {
+	var critical []registeredCheck
+	for _, check := range h.checks {
+		if check.critical {
+			critical = append(critical, check)
+		}
+	}
+
+	h.respond(c, critical)
+}
+
+func (h *HealthHandler) respond(c *gin.Context, checks []registeredCheck) {
+	results := make(map[string]CheckResult, len(checks))
+	status, code := "ok", http.StatusOK
+
+	for _, check := range checks {
+		result := runCheck(c.Request.Context(), check.checker)
+		results[check.checker.Name()] = result
+
+		if result.Status == "ok" {
+			continue
+		}
+		if check.critical {
+			status, code = "down", http.StatusServiceUnavailable
+		} else if status == "ok" {
+			status, code = "degraded", http.StatusMultiStatus
+		}
+	}
+
+	c.JSON(code, gin.H{
+		"status": status,
+		"checks": results,
+		"time":   time.Now().Format(time.RFC3339),
+	})
+}
+
+func runCheck(ctx context.Context, checker HealthChecker) CheckResult {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := checker.Check(ctx)
+	result := CheckResult{Status: "ok", LatencyMS: time.Since(start).Milliseconds()}
+	if err != nil {
+		result.Status = "down"
+		result.Error = err.Error()
+	}
+
+	return result
+}
@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// stubCheck returns a checker that fails with err when it is set.
+func stubCheck(name string, err *error) HealthChecker {
+	return CheckFunc(name, func(ctx context.Context) error { return *err })
+}
+
+// Each dependency is failed on its own: the database takes the service
+// down, any other dependency only degrades it, and liveness never looks at
+// either.
+func TestHealthChecks(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	var postgresErr, smtpErr, paymentsErr error
+	handler := newHealthHandler(stubCheck("postgres", &postgresErr))
+	handler.AddCheck(stubCheck("smtp", &smtpErr))
+	handler.AddCheck(stubCheck("eversend", &paymentsErr))
+
+	router := gin.New()
+	router.GET("/health", handler.Health)
+	router.GET("/health/live", handler.Live)
+	router.GET("/health/ready", handler.Ready)
+
+	get := func(path string) (int, string, map[string]CheckResult) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		var body struct {
+			Status string                 `json:"status"`
+			Checks map[string]CheckResult `json:"checks"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		return w.Code, body.Status, body.Checks
+	}
+
+	down := errors.New("connection refused")
+	tests := []struct {
+		name       string
+		failing    *error
+		wantCode   int
+		wantStatus string
+		wantReady  int
+	}{
+		{"all pass", nil, http.StatusOK, "ok", http.StatusOK},
+		{"postgres fails", &postgresErr, http.StatusServiceUnavailable, "down", http.StatusServiceUnavailable},
+		{"smtp fails", &smtpErr, http.StatusMultiStatus, "degraded", http.StatusOK},
+		{"payments fail", &paymentsErr, http.StatusMultiStatus, "degraded", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			postgresErr, smtpErr, paymentsErr = nil, nil, nil
+			if tt.failing != nil {
+				*tt.failing = down
+			}
+
+			code, status, checks := get("/health")
+			if code != tt.wantCode || status != tt.wantStatus {
+				t.Errorf("/health = %d %s, want %d %s", code, status, tt.wantCode, tt.wantStatus)
+			}
+			if len(checks) != 3 {
+				t.Errorf("/health checked %v, want postgres, smtp and eversend", checks)
+			}
+			for name, result := range checks {
+				failed := result.Status != "ok"
+				if failed != (result.Error != "") {
+					t.Errorf("%s: status %s with error %q", name, result.Status, result.Error)
+				}
+			}
+
+			code, _, checks = get("/health/ready")
+			if code != tt.wantReady {
+				t.Errorf("/health/ready = %d, want %d", code, tt.wantReady)
+			}
+			if _, ok := checks["postgres"]; !ok || len(checks) != 1 {
+				t.Errorf("/health/ready checked %v, want postgres only", checks)
+			}
+
+			if code, status, _ := get("/health/live"); code != http.StatusOK || status != "ok" {
+				t.Errorf("/health/live = %d %s, want 200 ok", code, status)
+			}
+		})
+	}
+}
+
+// The Eversend status endpoint and the SMTP server are stood in for by local
+// servers; the health response follows whether they answer.
+func TestHealthChecksExternalServices(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	eversendStatus := http.StatusOK
+	eversend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/status" || r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("eversend got %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		w.WriteHeader(eversendStatus)
+	}))
+	defer eversend.Close()
+
+	smtpServer, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host, port, _ := net.SplitHostPort(smtpServer.Addr().String())
+	smtpPort, _ := strconv.Atoi(port)
+	smtpConfig := services.SMTPConfig{Host: host, Port: smtpPort}
+
+	var postgresErr error
+	handler := newHealthHandler(stubCheck("postgres", &postgresErr))
+	handler.AddCheck(services.NewEversendProvider(eversend.URL, "key"))
+	handler.AddCheck(CheckFunc("smtp", func(ctx context.Context) error {
+		return services.SMTPHealthCheck(smtpConfig)
+	}))
+	router := gin.New()
+	router.GET("/health", handler.Health)
+
+	health := func() (int, map[string]CheckResult) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/health", nil))
+		var body struct {
+			Checks map[string]CheckResult `json:"checks"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		return w.Code, body.Checks
+	}
+
+	if code, checks := health(); code != http.StatusOK || checks["eversend"].Status != "ok" || checks["smtp"].Status != "ok" {
+		t.Errorf("both reachable: /health = %d %v, want 200 with both ok", code, checks)
+	}
+
+	eversendStatus = http.StatusBadGateway
+	if code, checks := health(); code != http.StatusMultiStatus || checks["eversend"].Status == "ok" || checks["smtp"].Status != "ok" {
+		t.Errorf("eversend failing: /health = %d %v, want 207 with eversend failed", code, checks)
+	}
+
+	eversendStatus = http.StatusOK
+	smtpServer.Close()
+	if code, checks := health(); code != http.StatusMultiStatus || checks["smtp"].Status == "ok" || checks["eversend"].Status != "ok" {
+		t.Errorf("smtp unreachable: /health = %d %v, want 207 with smtp failed", code, checks)
+	}
+}
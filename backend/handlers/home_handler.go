@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// flashSaleSummary is the homepage countdown widget's view of a flash sale.
+type flashSaleSummary struct {
+	ID              uuid.UUID   `json:"id"`
+	Title           string      `json:"title"`
+	DiscountPercent float64     `json:"discount_percent"`
+	EndsAt          time.Time   `json:"ends_at"`
+	SecondsLeft     int64       `json:"seconds_left"`
+	ProductIDs      []uuid.UUID `json:"product_ids"`
+}
+
+type HomeHandler struct {
+	flashSaleService *services.FlashSaleService
+}
+
+func NewHomeHandler(flashSaleService *services.FlashSaleService) *HomeHandler {
+	return &HomeHandler{flashSaleService: flashSaleService}
+}
+
+// Home returns the data for the shop homepage widgets. flash_sale is null
+// when no sale is running.
+func (h *HomeHandler) Home(c *gin.Context) {
+	sale, err := h.flashSaleService.GetActive(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	var summary *flashSaleSummary
+	if sale != nil {
+		summary = &flashSaleSummary{
+			ID:              sale.ID,
+			Title:           sale.Title,
+			DiscountPercent: sale.DiscountPercent,
+			EndsAt:          sale.EndsAt,
+			SecondsLeft:     int64(time.Until(sale.EndsAt).Seconds()),
+			ProductIDs:      sale.ProductIDs,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"flash_sale": summary})
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// LocalFileHandler serves the uploads of a LocalDiskBackend: public files
+// to anyone, and private files only through a signed download link.
+type LocalFileHandler struct {
+	storage *services.LocalDiskBackend
+}
+
+func NewLocalFileHandler(storage *services.LocalDiskBackend) *LocalFileHandler {
+	return &LocalFileHandler{storage: storage}
+}
+
+// ServePublic serves the public file under the *filepath route parameter.
+// Private files are answered with 404, as if they did not exist.
+func (h *LocalFileHandler) ServePublic(c *gin.Context) {
+	path, err := h.storage.PublicPath(strings.TrimPrefix(c.Param("filepath"), "/"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.File(path)
+}
+
+// ServeSigned serves the file a link from LocalDiskBackend.PresignGet
+// points to, checking its expires and signature query parameters.
+func (h *LocalFileHandler) ServeSigned(c *gin.Context) {
+	path, err := h.storage.SignedPath(strings.TrimPrefix(c.Param("filepath"), "/"), c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	c.Header("Cache-Control", "private, no-store")
+	c.File(path)
+}
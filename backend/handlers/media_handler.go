@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type MediaHandler struct {
+	mediaService *services.MediaService
+}
+
+func NewMediaHandler(mediaService *services.MediaService) *MediaHandler {
+	return &MediaHandler{mediaService: mediaService}
+}
+
+// Upload stores a file sent as the "file" field of a multipart form, as a
+// private file when the "is_private" field is true. Public images are
+// answered with the URLs of the original and its variants, other files
+// with their media record, including the public URL of public ones.
+func (h *MediaHandler) Upload(c *gin.Context) {
+	// Leave room for the rest of the multipart body around the file
+	maxBytes := h.mediaService.MaxUploadBytes()
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxBytes+1<<20)
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": services.ErrMediaTooLarge.Error()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file is required"})
+		return
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unable to read the file"})
+		return
+	}
+	defer file.Close()
+
+	isPrivate, _ := strconv.ParseBool(c.PostForm("is_private"))
+	media, err := h.mediaService.Upload(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), file, header.Size, isPrivate)
+	if err != nil {
+		respondMediaError(c, err)
+		return
+	}
+
+	if strings.HasPrefix(media.ContentType, "image/") && !media.IsPrivate {
+		c.JSON(http.StatusCreated, models.ImageUploadResponse{
+			MediaID:   media.ID,
+			Original:  media.URL,
+			Thumbnail: media.Variants["thumbnail"],
+			Medium:    media.Variants["medium"],
+			Large:     media.Variants["large"],
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, media)
+}
+
+// GetMedia returns the original URL of an upload and its variant URLs.
+func (h *MediaHandler) GetMedia(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return
+	}
+
+	media, err := h.mediaService.Get(c.Request.Context(), id)
+	if err != nil {
+		respondMediaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, media)
+}
+
+// Download returns the URL to download an upload from. Private files get
+// a signed link that works for 15 minutes, and only their uploader and
+// admins can get one.
+func (h *MediaHandler) Download(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("media_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid media ID"})
+		return
+	}
+
+	isAdmin := c.GetString("role") == "admin"
+	url, err := h.mediaService.GetDownloadURL(c.Request.Context(), id, c.MustGet("user_id").(uuid.UUID), isAdmin, services.DownloadURLExpiry)
+	if err != nil {
+		respondMediaError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"url": url})
+}
+
+func respondMediaError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrMediaNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+	case errors.Is(err, services.ErrMediaTooLarge), errors.Is(err, services.ErrImageTooLarge):
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidImage):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrUnsupportedMediaType):
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Only JPEG, PNG and WebP images and PDF documents can be uploaded"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
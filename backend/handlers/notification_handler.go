@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// sseHeartbeatInterval keeps proxies from closing idle streams.
+const sseHeartbeatInterval = 30 * time.Second
+
+type NotificationHandler struct {
+	hub *services.NotificationHub
+}
+
+func NewNotificationHandler(hub *services.NotificationHub) *NotificationHandler {
+	return &NotificationHandler{hub: hub}
+}
+
+// Stream holds a Server-Sent Events connection open and writes each admin
+// notification as a JSON data line.
+func (h *NotificationHandler) Stream(c *gin.Context) {
+	notifications, unsubscribe := h.hub.Subscribe(c.MustGet("user_id").(uuid.UUID))
+	defer unsubscribe()
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+	c.Writer.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(c.Writer, ": heartbeat\n\n")
+			c.Writer.Flush()
+		case notification, ok := <-notifications:
+			if !ok {
+				// Replaced by a newer connection or the server is shutting down
+				return
+			}
+			data, err := json.Marshal(notification)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(c.Writer, "data: %s\n\n", data)
+			c.Writer.Flush()
+		}
+	}
+}
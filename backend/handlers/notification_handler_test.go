@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// Two admins hold a stream open; the broadcast OrderService makes for a new
+// order reaches both of them.
+func TestNotificationStreamReachesEveryAdmin(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	hub := services.NewNotificationHub()
+	router := gin.New()
+	router.GET("/admin/notifications/sse", func(c *gin.Context) {
+		c.Set("user_id", uuid.MustParse(c.Query("admin")))
+	}, NewNotificationHandler(hub).Stream)
+	server := httptest.NewServer(router)
+	defer server.Close()
+	defer hub.Close()
+
+	var streams []*bufio.Reader
+	for i := 0; i < 2; i++ {
+		// The headers are flushed after subscribing, so once they arrive the
+		// admin is connected
+		resp, err := http.Get(server.URL + "/admin/notifications/sse?admin=" + uuid.New().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if got := resp.Header.Get("Content-Type"); got != "text/event-stream" {
+			t.Fatalf("Content-Type = %q, want text/event-stream", got)
+		}
+		streams = append(streams, bufio.NewReader(resp.Body))
+	}
+
+	placed := services.AdminNotification{Type: "new_order", OrderID: uuid.New(), Total: 42.5}
+	hub.BroadcastToAdmins(placed)
+
+	for i, stream := range streams {
+		line := make(chan string, 1)
+		go func() {
+			s, _ := stream.ReadString('\n')
+			line <- s
+		}()
+
+		select {
+		case got := <-line:
+			var notification services.AdminNotification
+			if !strings.HasPrefix(got, "data: ") {
+				t.Fatalf("admin %d read %q, want a data line", i, got)
+			}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(got, "data: ")), &notification); err != nil {
+				t.Fatal(err)
+			}
+			if notification != placed {
+				t.Errorf("admin %d got %+v, want %+v", i, notification, placed)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("admin %d got no notification", i)
+		}
+	}
+}
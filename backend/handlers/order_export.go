@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// exportFlushEvery is how many rows are written between flushes of a
+// streamed export.
+const exportFlushEvery = 100
+
+var orderExportColumns = []string{
+	"order_id", "created_at", "customer_email", "status", "subtotal", "tax",
+	"shipping", "discount", "total", "payment_method", "payment_status",
+}
+
+// orderExporter writes an export in one format: Begin, a Write per row,
+// then End. Flush pushes buffered output to the underlying writer.
+type orderExporter interface {
+	ContentType() string
+	Begin() error
+	Write(row *models.OrderExportRow) error
+	End() error
+	Flush() error
+}
+
+type csvOrderExporter struct {
+	w *csv.Writer
+}
+
+func (e *csvOrderExporter) ContentType() string { return "text/csv; charset=utf-8" }
+
+func (e *csvOrderExporter) Begin() error {
+	return e.w.Write(orderExportColumns)
+}
+
+func (e *csvOrderExporter) Write(row *models.OrderExportRow) error {
+	return e.w.Write([]string{
+		row.OrderID.String(),
+		row.CreatedAt.UTC().Format(time.RFC3339),
+		row.CustomerEmail,
+		row.Status,
+		formatAmount(row.Subtotal),
+		formatAmount(row.Tax),
+		formatAmount(row.Shipping),
+		formatAmount(row.Discount),
+		formatAmount(row.Total),
+		row.PaymentMethod,
+		row.PaymentStatus,
+	})
+}
+
+func (e *csvOrderExporter) End() error { return e.Flush() }
+
+func (e *csvOrderExporter) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// jsonOrderExporter writes a JSON array with one order per line.
+type jsonOrderExporter struct {
+	w     io.Writer
+	first bool
+}
+
+func (e *jsonOrderExporter) ContentType() string { return "application/json; charset=utf-8" }
+
+func (e *jsonOrderExporter) Begin() error {
+	e.first = true
+	_, err := io.WriteString(e.w, "[\n")
+	return err
+}
+
+func (e *jsonOrderExporter) Write(row *models.OrderExportRow) error {
+	line, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+
+	if !e.first {
+		if _, err := io.WriteString(e.w, ",\n"); err != nil {
+			return err
+		}
+	}
+	e.first = false
+
+	_, err = e.w.Write(line)
+	return err
+}
+
+func (e *jsonOrderExporter) End() error {
+	_, err := io.WriteString(e.w, "\n]\n")
+	return err
+}
+
+func (e *jsonOrderExporter) Flush() error { return nil }
+
+// ExportOrders streams the orders matching status and the from/to dates as
+// CSV or JSON. Nothing is buffered beyond a batch of rows; the response is
+// sent chunked as it is produced.
+func (h *OrderHandler) ExportOrders(c *gin.Context) {
+	filter := models.OrderAdminFilter{Status: c.Query("status")}
+	if !parseOrderDateRange(c, &filter) {
+		return
+	}
+
+	format := c.DefaultQuery("format", "csv")
+	var exporter orderExporter
+	switch format {
+	case "csv":
+		exporter = &csvOrderExporter{w: csv.NewWriter(c.Writer)}
+	case "json":
+		exporter = &jsonOrderExporter{w: c.Writer}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "format must be csv or json"})
+		return
+	}
+
+	// The response starts with the first row, so a query that fails up front
+	// can still be reported with a proper status
+	started := false
+	begin := func() error {
+		started = true
+		filename := "orders-" + time.Now().UTC().Format("20060102") + "." + format
+		c.Header("Content-Type", exporter.ContentType())
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Status(http.StatusOK)
+		return exporter.Begin()
+	}
+
+	written := 0
+	err := h.orderService.ExportOrders(c.Request.Context(), filter, func(row *models.OrderExportRow) error {
+		if !started {
+			if err := begin(); err != nil {
+				return err
+			}
+		}
+
+		if err := exporter.Write(row); err != nil {
+			return err
+		}
+
+		written++
+		if written%exportFlushEvery == 0 {
+			if err := exporter.Flush(); err != nil {
+				return err
+			}
+			c.Writer.Flush()
+		}
+		return nil
+	})
+
+	if err == nil && !started {
+		err = begin()
+	}
+	if err != nil {
+		if !started {
+			respondOrderError(c, err)
+			return
+		}
+		// The status is already sent. Leaving the export unterminated makes
+		// the failure visible to JSON clients; the error is logged either way.
+		c.Error(err)
+		exporter.Flush()
+		return
+	}
+
+	if err := exporter.End(); err != nil {
+		c.Error(err)
+	}
+	c.Writer.Flush()
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
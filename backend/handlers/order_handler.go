@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type OrderHandler struct {
+	orderService *services.OrderService
+}
+
+func NewOrderHandler(orderService *services.OrderService) *OrderHandler {
+	return &OrderHandler{orderService: orderService}
+}
+
+// Checkout places the caller's cart as an order.
+func (h *OrderHandler) Checkout(c *gin.Context) {
+	var req models.CheckoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	order, err := h.orderService.Checkout(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), &req)
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, order)
+}
+
+func (h *OrderHandler) GetOrder(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	order, err := h.orderService.GetOrder(c.Request.Context(), orderID, c.MustGet("user_id").(uuid.UUID), c.GetString("role"))
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+// UpdateStatus moves an order to a new status. Moves the transition rules do
+// not allow are answered with 422.
+func (h *OrderHandler) UpdateStatus(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req models.UpdateOrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+	if err := h.orderService.Transition(c.Request.Context(), orderID, req.Status, userID); err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	h.respondOrder(c, orderID, userID)
+}
+
+// CancelOrder cancels one of the caller's own orders while it is pending.
+func (h *OrderHandler) CancelOrder(c *gin.Context) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+	if err := h.orderService.Cancel(c.Request.Context(), orderID, userID); err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	h.respondOrder(c, orderID, userID)
+}
+
+// respondOrder answers with the order as the caller may see it.
+func (h *OrderHandler) respondOrder(c *gin.Context, orderID, userID uuid.UUID) {
+	order, err := h.orderService.GetOrder(c.Request.Context(), orderID, userID, c.GetString("role"))
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, order)
+}
+
+func (h *OrderHandler) AddCustomerNote(c *gin.Context) {
+	h.addNote(c, false)
+}
+
+func (h *OrderHandler) AddInternalNote(c *gin.Context) {
+	h.addNote(c, true)
+}
+
+func (h *OrderHandler) addNote(c *gin.Context, internal bool) {
+	orderID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req models.CreateOrderNoteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.MustGet("user_id").(uuid.UUID)
+
+	var note *models.OrderNote
+	if internal {
+		note, err = h.orderService.AddInternalNote(c.Request.Context(), orderID, userID, req.Content)
+	} else {
+		note, err = h.orderService.AddCustomerNote(c.Request.Context(), orderID, userID, req.Content)
+	}
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, note)
+}
+
+func (h *OrderHandler) SearchOrders(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Query parameter q is required"})
+		return
+	}
+
+	filter := models.OrderSearchFilter{Query: query}
+
+	if dateFrom := c.Query("date_from"); dateFrom != "" {
+		from, err := time.Parse("2006-01-02", dateFrom)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_from must be formatted as YYYY-MM-DD"})
+			return
+		}
+		filter.DateFrom = &from
+	}
+	if dateTo := c.Query("date_to"); dateTo != "" {
+		to, err := time.Parse("2006-01-02", dateTo)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "date_to must be formatted as YYYY-MM-DD"})
+			return
+		}
+		// Include the whole of the final day
+		to = to.AddDate(0, 0, 1)
+		filter.DateTo = &to
+	}
+
+	limit, offset := parsePagination(c)
+
+	results, total, err := h.orderService.SearchOrders(c.Request.Context(), filter, limit, offset)
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   results,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func (h *OrderHandler) ListOrders(c *gin.Context) {
+	filter := models.OrderAdminFilter{
+		Status:        c.Query("status"),
+		PaymentStatus: c.Query("payment_status"),
+		CustomerEmail: strings.TrimSpace(c.Query("customer_email")),
+		Sort:          c.DefaultQuery("sort", "created_at_desc"),
+	}
+
+	if !repositories.ValidOrderSort(filter.Sort) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "sort must be one of created_at_asc, created_at_desc, total_asc, total_desc"})
+		return
+	}
+
+	if !parseOrderDateRange(c, &filter) {
+		return
+	}
+	if raw := c.Query("min_total"); raw != "" {
+		minTotal, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_total must be a number"})
+			return
+		}
+		filter.MinTotal = &minTotal
+	}
+	if raw := c.Query("max_total"); raw != "" {
+		maxTotal, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_total must be a number"})
+			return
+		}
+		filter.MaxTotal = &maxTotal
+	}
+
+	limit, offset := parsePagination(c)
+
+	orders, total, err := h.orderService.ListOrders(c.Request.Context(), filter, limit, offset)
+	if err != nil {
+		respondOrderError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   orders,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// parseOrderDateRange reads the from and to dates (YYYY-MM-DD) into the
+// filter. The to date is inclusive. It responds with 400 and returns false
+// when either is malformed.
+func parseOrderDateRange(c *gin.Context, filter *models.OrderAdminFilter) bool {
+	if raw := c.Query("from"); raw != "" {
+		from, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from must be formatted as YYYY-MM-DD"})
+			return false
+		}
+		filter.From = &from
+	}
+	if raw := c.Query("to"); raw != "" {
+		to, err := time.Parse("2006-01-02", raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to must be formatted as YYYY-MM-DD"})
+			return false
+		}
+		// Include the whole of the final day
+		to = to.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+	return true
+}
+
+func respondOrderError(c *gin.Context, err error) {
+	var shippingErr *services.ErrShippingNotAvailable
+	switch {
+	case errors.Is(err, services.ErrOrderNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+	case errors.Is(err, services.ErrOrderForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+	case errors.Is(err, repositories.ErrEventSoldOut):
+		c.JSON(http.StatusConflict, gin.H{"error": "Not enough tickets left for this event"})
+	case errors.Is(err, services.ErrOutOfStock):
+		c.JSON(http.StatusConflict, gin.H{"error": "Not enough stock"})
+	case errors.Is(err, services.ErrCartEmpty):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+	case errors.Is(err, services.ErrCartChanged):
+		c.JSON(http.StatusConflict, gin.H{"error": "Cart changed during checkout, please try again"})
+	case errors.Is(err, services.ErrCouponNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+	case errors.Is(err, services.ErrCouponExpired),
+		errors.Is(err, services.ErrCouponUsedUp),
+		errors.Is(err, services.ErrCouponMinimumNotMet),
+		errors.Is(err, services.ErrCouponNotApplicable):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidOrderTransition):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "The order was updated by someone else in the meantime"})
+	case errors.As(err, &shippingErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": shippingErr.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
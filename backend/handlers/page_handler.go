@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type PageHandler struct {
+	pageService *services.PageService
+}
+
+func NewPageHandler(pageService *services.PageService) *PageHandler {
+	return &PageHandler{pageService: pageService}
+}
+
+// ListPages lists the published pages, most recently updated first.
+func (h *PageHandler) ListPages(c *gin.Context) {
+	h.listPages(c, "published")
+}
+
+// GetPage returns the published page with the slug.
+func (h *PageHandler) GetPage(c *gin.Context) {
+	page, err := h.pageService.GetPublishedBySlug(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		respondPageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+// AdminListPages lists the pages of every status, narrowed to one with
+// ?status=.
+func (h *PageHandler) AdminListPages(c *gin.Context) {
+	h.listPages(c, c.Query("status"))
+}
+
+func (h *PageHandler) listPages(c *gin.Context, status string) {
+	limit, offset := parsePagination(c)
+
+	pages, total, err := h.pageService.List(c.Request.Context(), status, limit, offset)
+	if err != nil {
+		respondPageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   pages,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func (h *PageHandler) AdminGetPage(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page ID"})
+		return
+	}
+
+	page, err := h.pageService.GetByID(c.Request.Context(), id)
+	if err != nil {
+		respondPageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *PageHandler) CreatePage(c *gin.Context) {
+	var req models.PageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.pageService.Create(c.Request.Context(), &req)
+	if err != nil {
+		respondPageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, page)
+}
+
+func (h *PageHandler) UpdatePage(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page ID"})
+		return
+	}
+
+	var req models.PageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	page, err := h.pageService.Update(c.Request.Context(), id, &req)
+	if err != nil {
+		respondPageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func (h *PageHandler) DeletePage(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page ID"})
+		return
+	}
+
+	if err := h.pageService.Delete(c.Request.Context(), id); err != nil {
+		respondPageError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *PageHandler) PublishPage(c *gin.Context) {
+	h.changeStatus(c, h.pageService.Publish)
+}
+
+func (h *PageHandler) UnpublishPage(c *gin.Context) {
+	h.changeStatus(c, h.pageService.Unpublish)
+}
+
+// changeStatus applies a status change to the page and responds with the
+// page as it now is.
+func (h *PageHandler) changeStatus(c *gin.Context, change func(ctx context.Context, id uuid.UUID) error) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page ID"})
+		return
+	}
+
+	if err := change(c.Request.Context(), id); err != nil {
+		respondPageError(c, err)
+		return
+	}
+
+	page, err := h.pageService.GetByID(c.Request.Context(), id)
+	if err != nil {
+		respondPageError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, page)
+}
+
+func respondPageError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrPageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Page not found"})
+	case errors.Is(err, services.ErrPageSlugTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrInvalidPageSlug):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPageNotPublishable):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// PaginatedResponse is the envelope returned by list endpoints.
+type PaginatedResponse struct {
+	Data   interface{} `json:"data"`
+	Total  int         `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+}
+
+// parsePagination reads ?limit= and ?offset= from the query string, falling
+// back to sane defaults for missing or out-of-range values.
+func parsePagination(c *gin.Context) (limit, offset int) {
+	limit, err := strconv.Atoi(c.Query("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageLimit
+	}
+	if limit > maxPageLimit {
+		limit = maxPageLimit
+	}
+
+	offset, err = strconv.Atoi(c.Query("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	return limit, offset
+}
+
+// parseCursorPagination reads ?limit= and the ?after= cursor of a keyset
+// paginated list. It responds 400 and reports false for a malformed cursor.
+func parseCursorPagination(c *gin.Context) (after *uuid.UUID, limit int, ok bool) {
+	limit, _ = parsePagination(c)
+
+	if raw := c.Query("after"); raw != "" {
+		id, err := models.DecodeCursor(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+			return nil, 0, false
+		}
+		after = &id
+	}
+
+	return after, limit, true
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/services"
+	"github.com/adrianmcmains/integrated-site/services/payment"
+)
+
+// maxWebhookBody bounds the size of an inbound webhook payload.
+const maxWebhookBody = 1 << 20
+
+type PaymentWebhookHandler struct {
+	webhookService      *services.WebhookEventService
+	stripeWebhookSecret string
+}
+
+func NewPaymentWebhookHandler(webhookService *services.WebhookEventService, stripeWebhookSecret string) *PaymentWebhookHandler {
+	return &PaymentWebhookHandler{
+		webhookService:      webhookService,
+		stripeWebhookSecret: stripeWebhookSecret,
+	}
+}
+
+// StripeWebhook verifies and applies a Stripe event. Redeliveries of an
+// event that was already processed are acknowledged without reprocessing.
+func (h *PaymentWebhookHandler) StripeWebhook(c *gin.Context) {
+	if h.stripeWebhookSecret == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Stripe webhooks are not configured"})
+		return
+	}
+
+	payload, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxWebhookBody))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+		return
+	}
+
+	if err := payment.VerifyStripeSignature(payload, c.GetHeader(payment.StripeSignatureHeader), h.stripeWebhookSecret, time.Now()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid signature"})
+		return
+	}
+
+	var event payment.StripeEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event"})
+		return
+	}
+
+	processed, err := h.webhookService.HandleStripeEvent(c.Request.Context(), &event)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidWebhookEvent) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event"})
+			return
+		}
+		// Stripe retries on a non-2xx response
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"received": true, "duplicate": !processed})
+}
@@ -0,0 +1,692 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type ProductHandler struct {
+	productService  *services.ProductService
+	categoryService *services.ProductCategoryService
+}
+
+func NewProductHandler(productService *services.ProductService, categoryService *services.ProductCategoryService) *ProductHandler {
+	return &ProductHandler{productService: productService, categoryService: categoryService}
+}
+
+// GetProduct returns a published product. With ?country= it also tells
+// whether the product can be shipped there.
+func (h *ProductHandler) GetProduct(c *gin.Context) {
+	product, err := h.productService.GetBySlug(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	if country := c.Query("country"); country != "" {
+		canShip := product.CanShipTo(country)
+		product.CanShipToCountry = &canShip
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// productSearchResponse is a page of products with the facets of the whole
+// result set.
+type productSearchResponse struct {
+	PaginatedResponse
+	Facets models.ProductFacets `json:"facets"`
+}
+
+// ListProducts searches the published products. ?q= matches names and
+// descriptions; ?category=, ?min_price=, ?max_price=, ?in_stock=true and
+// ?attr[name]=value narrow the results.
+func (h *ProductHandler) ListProducts(c *gin.Context) {
+	limit, offset := parsePagination(c)
+
+	filter, ok := parseProductFilter(c)
+	if !ok {
+		return
+	}
+
+	result, err := h.productService.Search(c.Request.Context(), c.Query("q"), filter, limit, offset)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, productSearchResponse{
+		PaginatedResponse: PaginatedResponse{
+			Data:   result.Products,
+			Total:  result.Total,
+			Limit:  limit,
+			Offset: offset,
+		},
+		Facets: result.Facets,
+	})
+}
+
+// ListCategories returns the product category tree.
+func (h *ProductHandler) ListCategories(c *gin.Context) {
+	categories, err := h.categoryService.GetTree(c.Request.Context())
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, categories)
+}
+
+// categoryProductsResponse is a page of a category's products with the
+// category and its ancestors.
+type categoryProductsResponse struct {
+	productSearchResponse
+	Category *models.ProductCategory `json:"category"`
+}
+
+// ListCategoryProducts lists the published products of the category and of
+// every category below it. It takes the same filters as ListProducts,
+// except ?category=.
+func (h *ProductHandler) ListCategoryProducts(c *gin.Context) {
+	category, err := h.categoryService.GetBySlug(c.Request.Context(), c.Param("slug"))
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	limit, offset := parsePagination(c)
+
+	filter, ok := parseProductFilter(c)
+	if !ok {
+		return
+	}
+	filter.CategorySlug = category.Slug
+
+	result, err := h.productService.Search(c.Request.Context(), c.Query("q"), filter, limit, offset)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, categoryProductsResponse{
+		productSearchResponse: productSearchResponse{
+			PaginatedResponse: PaginatedResponse{
+				Data:   result.Products,
+				Total:  result.Total,
+				Limit:  limit,
+				Offset: offset,
+			},
+			Facets: result.Facets,
+		},
+		Category: category,
+	})
+}
+
+// AdminListProducts lists products of any status, newest first, cursor
+// paginated with ?after=. It takes the storefront filters plus
+// ?category_id= and ?featured=true|false.
+func (h *ProductHandler) AdminListProducts(c *gin.Context) {
+	after, limit, ok := parseCursorPagination(c)
+	if !ok {
+		return
+	}
+
+	filter, ok := parseProductFilter(c)
+	if !ok {
+		return
+	}
+	if raw := c.Query("category_id"); raw != "" {
+		categoryID, err := uuid.Parse(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+			return
+		}
+		filter.CategoryID = &categoryID
+	}
+	if raw := c.Query("featured"); raw != "" {
+		featured, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "featured must be true or false"})
+			return
+		}
+		filter.IsFeatured = &featured
+	}
+
+	result, err := h.productService.List(c.Request.Context(), filter, after, limit)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// parseProductFilter reads ?category=, ?min_price=, ?max_price=,
+// ?in_stock=true and ?attr[name]=value. On invalid input it responds with
+// 400 and returns false.
+func parseProductFilter(c *gin.Context) (models.ProductFilter, bool) {
+	filter := models.ProductFilter{
+		CategorySlug: c.Query("category"),
+		InStock:      c.Query("in_stock") == "true",
+		Attributes:   c.QueryMap("attr"),
+	}
+	if raw := c.Query("min_price"); raw != "" {
+		minPrice, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "min_price must be a number"})
+			return filter, false
+		}
+		filter.MinPrice = &minPrice
+	}
+	if raw := c.Query("max_price"); raw != "" {
+		maxPrice, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_price must be a number"})
+			return filter, false
+		}
+		filter.MaxPrice = &maxPrice
+	}
+	return filter, true
+}
+
+func (h *ProductHandler) CreateProduct(c *gin.Context) {
+	var req models.ProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := h.productService.Create(c.Request.Context(), &req)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, product)
+}
+
+func (h *ProductHandler) UpdateProduct(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.ProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Version == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "version is required"})
+		return
+	}
+
+	product, err := h.productService.Update(c.Request.Context(), id, c.MustGet("user_id").(uuid.UUID), &req)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// BulkMove moves products out of the category in the path into another
+// category.
+func (h *ProductHandler) BulkMove(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	var req models.BulkMoveProductsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	moved, err := h.productService.BulkMove(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), id, &req)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"moved": moved})
+}
+
+// ListRevisions lists the product's earlier content, newest first.
+func (h *ProductHandler) ListRevisions(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	limit, offset := parsePagination(c)
+	revisions, total, err := h.productService.ListRevisions(c.Request.Context(), id, limit, offset)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   revisions,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// RestoreRevision rolls the product's content back to a revision.
+func (h *ProductHandler) RestoreRevision(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+	revisionID, err := uuid.Parse(c.Param("rev_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid revision ID"})
+		return
+	}
+
+	product, err := h.productService.RestoreRevision(c.Request.Context(), id, revisionID, c.MustGet("user_id").(uuid.UUID))
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+func (h *ProductHandler) CreateDraft(c *gin.Context) {
+	var req models.CreateProductRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := h.productService.CreateDraft(c.Request.Context(), &req)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, product)
+}
+
+func (h *ProductHandler) UpdatePricing(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.UpdateProductPricingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := h.productService.UpdatePricing(c.Request.Context(), id, &req)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// DeleteProduct deletes a product that has never been ordered.
+func (h *ProductHandler) DeleteProduct(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	if err := h.productService.Delete(c.Request.Context(), id); err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *ProductHandler) RestoreProduct(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	product, err := h.productService.Restore(c.Request.Context(), id)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// ListDeletedProducts lists the products in the trash, most recently
+// deleted first.
+func (h *ProductHandler) ListDeletedProducts(c *gin.Context) {
+	limit, offset := parsePagination(c)
+
+	products, total, err := h.productService.ListDeleted(c.Request.Context(), limit, offset)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   products,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func (h *ProductHandler) UpdateStock(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.UpdateProductStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	product, err := h.productService.UpdateStock(c.Request.Context(), id, &req)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+// ValidateForPublish lists what still keeps a draft from being published.
+func (h *ProductHandler) ValidateForPublish(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	violations, err := h.productService.ValidateForPublish(c.Request.Context(), id)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"ready": len(violations) == 0, "errors": violations})
+}
+
+func (h *ProductHandler) Publish(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	product, violations, err := h.productService.Publish(c.Request.Context(), id)
+	if errors.Is(err, services.ErrProductNotPublishable) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Product is not ready to be published", "errors": violations})
+		return
+	}
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, product)
+}
+
+func (h *ProductHandler) AddImage(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.AddProductImageRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	image, err := h.productService.AddImage(c.Request.Context(), productID, &req)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, image)
+}
+
+func (h *ProductHandler) RemoveImage(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	imageID, err := uuid.Parse(c.Param("img_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image ID"})
+		return
+	}
+
+	if err := h.productService.RemoveImage(c.Request.Context(), productID, imageID); err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *ProductHandler) CreateVariant(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.ProductVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	variant, err := h.productService.CreateVariant(c.Request.Context(), productID, &req)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, variant)
+}
+
+func (h *ProductHandler) UpdateVariant(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	variantID, err := uuid.Parse(c.Param("vid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	var req models.ProductVariantRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	variant, err := h.productService.UpdateVariant(c.Request.Context(), productID, variantID, &req)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, variant)
+}
+
+func (h *ProductHandler) DeleteVariant(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	variantID, err := uuid.Parse(c.Param("vid"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	if err := h.productService.DeleteVariant(c.Request.Context(), productID, variantID); err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *ProductHandler) ReorderImages(c *gin.Context) {
+	productID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID"})
+		return
+	}
+
+	var req models.ReorderProductImagesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	images, err := h.productService.ReorderImages(c.Request.Context(), productID, req.ImageIDs)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, images)
+}
+
+func (h *ProductHandler) ListAttributeDefinitions(c *gin.Context) {
+	defs, err := h.productService.ListAttributeDefinitions(c.Request.Context())
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, defs)
+}
+
+func (h *ProductHandler) CreateAttributeDefinition(c *gin.Context) {
+	var req models.AttributeDefinitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	def, err := h.productService.CreateAttributeDefinition(c.Request.Context(), &req)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, def)
+}
+
+func (h *ProductHandler) UpdateAttributeDefinition(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attribute definition ID"})
+		return
+	}
+
+	var req models.AttributeDefinitionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	def, err := h.productService.UpdateAttributeDefinition(c.Request.Context(), id, &req)
+	if err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, def)
+}
+
+func (h *ProductHandler) DeleteAttributeDefinition(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attribute definition ID"})
+		return
+	}
+
+	if err := h.productService.DeleteAttributeDefinition(c.Request.Context(), id); err != nil {
+		respondProductError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func respondProductError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrProductNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	case errors.Is(err, services.ErrAttributeDefinitionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attribute definition not found"})
+	case errors.Is(err, services.ErrProductImageNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product image not found"})
+	case errors.Is(err, services.ErrMediaNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Media not found"})
+	case errors.Is(err, services.ErrMediaNotImage), errors.Is(err, services.ErrMediaPrivate):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrProductVariantNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product variant not found"})
+	case errors.Is(err, repositories.ErrProductRevisionNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product revision not found"})
+	case errors.Is(err, services.ErrProductCategoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product category not found"})
+	case errors.Is(err, repositories.ErrInvalidImageOrder):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, repositories.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+	case errors.Is(err, services.ErrInvalidAttributeValue):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrSKUTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": "SKU is already in use"})
+	case errors.Is(err, services.ErrProductInUse):
+		c.JSON(http.StatusConflict, gin.H{"error": "Product has been ordered and cannot be deleted"})
+	case errors.Is(err, services.ErrOutOfStock):
+		c.JSON(http.StatusConflict, gin.H{"error": "Not enough stock"})
+	case errors.Is(err, repositories.ErrConflict):
+		c.JSON(http.StatusConflict, gin.H{"error": "Product was modified by someone else, reload it and try again"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
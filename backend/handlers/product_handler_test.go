@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// An unknown target category is a 404 that moves nothing. Otherwise only the
+// requested products that are in the source category move, and the move is
+// audited once.
+func TestBulkMoveProducts(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+
+	var adminID uuid.UUID
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {auth}.users (email, password_hash, full_name, role)
+		VALUES ($1, 'x', 'Test Admin', 'admin')
+		RETURNING id
+	`), dbtest.UniqueName("admin")+"@example.com").Scan(&adminID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.users WHERE id = $1"), adminID)
+	})
+
+	categories := map[string]uuid.UUID{}
+	for _, name := range []string{"source", "target", "other"} {
+		slug := dbtest.UniqueName(name)
+		var id uuid.UUID
+		if err := pool.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.product_categories (name, slug) VALUES ($1, $1) RETURNING id
+		`), slug).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.product_categories WHERE id = $1"), id)
+		})
+		categories[name] = id
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.audit_logs WHERE actor_id = $1"), adminID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.products WHERE category_id = ANY($1)"),
+			[]uuid.UUID{categories["source"], categories["target"], categories["other"]})
+	})
+	createProduct := func(category string) uuid.UUID {
+		t.Helper()
+		slug := dbtest.UniqueName("product")
+		var id uuid.UUID
+		if err := pool.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.products (name, slug, description, price, sku, stock, category_id)
+			VALUES ($1, $1, 'A test product', 10, $1, 1, $2)
+			RETURNING id
+		`), slug, categories[category]).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	first, second, elsewhere := createProduct("source"), createProduct("source"), createProduct("other")
+	categoryOf := func(id uuid.UUID) uuid.UUID {
+		t.Helper()
+		var categoryID uuid.UUID
+		if err := pool.QueryRow(ctx, database.Qualify(`
+			SELECT category_id FROM {shop}.products WHERE id = $1
+		`), id).Scan(&categoryID); err != nil {
+			t.Fatal(err)
+		}
+		return categoryID
+	}
+
+	productRepo := repositories.NewProductRepository(pool, nil, repositories.NewRedirectRepository(pool))
+	productService := services.NewProductService(productRepo, nil, nil, nil, nil, nil, nil, nil, nil)
+	handler := NewProductHandler(productService, nil)
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/admin/shop/categories/:id/bulk-move", func(c *gin.Context) {
+		c.Set("user_id", adminID)
+		c.Set("role", "admin")
+	}, handler.BulkMove)
+	move := func(targetID uuid.UUID, productIDs ...uuid.UUID) *httptest.ResponseRecorder {
+		t.Helper()
+		ids := make([]string, len(productIDs))
+		for i, id := range productIDs {
+			ids[i] = `"` + id.String() + `"`
+		}
+		body := `{"product_ids": [` + strings.Join(ids, ", ") + `], "target_category_id": "` + targetID.String() + `"}`
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/admin/shop/categories/"+categories["source"].String()+"/bulk-move", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := move(uuid.New(), first, second); w.Code != http.StatusNotFound {
+		t.Errorf("unknown target: status = %d, want 404", w.Code)
+	}
+	if categoryOf(first) != categories["source"] || categoryOf(second) != categories["source"] {
+		t.Fatal("products moved although the target does not exist")
+	}
+
+	w := move(categories["target"], first, second, elsewhere, uuid.New())
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200: %s", w.Code, w.Body)
+	}
+	if body := strings.TrimSpace(w.Body.String()); body != `{"moved":2}` {
+		t.Errorf("body = %s, want 2 moved", body)
+	}
+	for _, id := range []uuid.UUID{first, second} {
+		if got := categoryOf(id); got != categories["target"] {
+			t.Errorf("product %s is in %s, want the target", id, got)
+		}
+	}
+	if got := categoryOf(elsewhere); got != categories["other"] {
+		t.Errorf("a product outside the source category moved to %s", got)
+	}
+
+	_, total, err := repositories.NewAuditRepository(pool).List(ctx, "product_category", categories["target"].String(), 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 {
+		t.Errorf("%d audit entries for the move, want 1", total)
+	}
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type SettingsHandler struct {
+	settingsService *services.SettingsService
+}
+
+func NewSettingsHandler(settingsService *services.SettingsService) *SettingsHandler {
+	return &SettingsHandler{settingsService: settingsService}
+}
+
+// ListSettings returns every site setting, sorted by key.
+func (h *SettingsHandler) ListSettings(c *gin.Context) {
+	settings, err := h.settingsService.All(c.Request.Context())
+	if err != nil {
+		respondSettingsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSetting sets the :key setting to the request's value, creating it
+// if needed.
+func (h *SettingsHandler) UpdateSetting(c *gin.Context) {
+	var req models.SiteSettingRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.settingsService.Set(c.Request.Context(), c.Param("key"), req.Value); err != nil {
+		respondSettingsError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func respondSettingsError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrInvalidSettingKey), errors.Is(err, services.ErrSettingRequired):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
@@ -0,0 +1,36 @@
+package handlers
+
+import (
+	"encoding/xml"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type SitemapHandler struct {
+	sitemapService *services.SitemapService
+}
+
+func NewSitemapHandler(sitemapService *services.SitemapService) *SitemapHandler {
+	return &SitemapHandler{sitemapService: sitemapService}
+}
+
+// Sitemap serves the sitemap of the site's published content. Crawlers and
+// proxies may cache it for an hour.
+func (h *SitemapHandler) Sitemap(c *gin.Context) {
+	urlSet, err := h.sitemapService.Generate(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	body, err := xml.MarshalIndent(urlSet, "", "  ")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=3600")
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", append([]byte(xml.Header), body...))
+}
@@ -0,0 +1,63 @@
+package handlers
+
+import (
+	"context"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// staticSitemapProvider lists fixed URLs.
+type staticSitemapProvider []services.SitemapURL
+
+func (p staticSitemapProvider) SitemapURLs(ctx context.Context) ([]services.SitemapURL, error) {
+	return p, nil
+}
+
+func TestSitemapIsCacheableXML(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	provider := staticSitemapProvider{
+		{Loc: "/blog/fish-&-chips", LastMod: "2026-10-01T12:30:00Z", Changefreq: "weekly", Priority: 0.7},
+		{Loc: "/pages/about", LastMod: "2026-09-30T08:00:00Z"},
+	}
+	router := gin.New()
+	router.GET("/sitemap.xml", NewSitemapHandler(services.NewSitemapService("https://example.com", provider)).Sitemap)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/sitemap.xml", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", w.Code)
+	}
+	if got := w.Header().Get("Content-Type"); !strings.HasPrefix(got, "application/xml") {
+		t.Errorf("Content-Type = %q, want application/xml", got)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=3600" {
+		t.Errorf("Cache-Control = %q, want public, max-age=3600", got)
+	}
+
+	var doc struct {
+		XMLName xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+		URLs    []struct {
+			Loc     string `xml:"loc"`
+			LastMod string `xml:"lastmod"`
+		} `xml:"url"`
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("sitemap is not well-formed: %v\n%s", err, w.Body)
+	}
+	if len(doc.URLs) != 2 {
+		t.Fatalf("sitemap has %d URLs, want 2", len(doc.URLs))
+	}
+	if doc.URLs[0].Loc != "https://example.com/blog/fish-&-chips" || doc.URLs[0].LastMod != "2026-10-01T12:30:00Z" {
+		t.Errorf("first URL = %+v, want the escaped post URL and its lastmod", doc.URLs[0])
+	}
+	if doc.URLs[1].Loc != "https://example.com/pages/about" || doc.URLs[1].LastMod != "2026-09-30T08:00:00Z" {
+		t.Errorf("second URL = %+v, want the page URL and its lastmod", doc.URLs[1])
+	}
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type TaxHandler struct {
+	taxService *services.TaxService
+}
+
+func NewTaxHandler(taxService *services.TaxService) *TaxHandler {
+	return &TaxHandler{taxService: taxService}
+}
+
+// ListRates returns every configured tax rate.
+func (h *TaxHandler) ListRates(c *gin.Context) {
+	rates, err := h.taxService.ListRates(c.Request.Context())
+	if err != nil {
+		respondTaxError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rates)
+}
+
+func (h *TaxHandler) CreateRate(c *gin.Context) {
+	var req models.TaxRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rate, err := h.taxService.CreateRate(c.Request.Context(), &req)
+	if err != nil {
+		respondTaxError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, rate)
+}
+
+func (h *TaxHandler) UpdateRate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tax rate ID"})
+		return
+	}
+
+	var req models.TaxRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rate, err := h.taxService.UpdateRate(c.Request.Context(), id, &req)
+	if err != nil {
+		respondTaxError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, rate)
+}
+
+func (h *TaxHandler) DeleteRate(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tax rate ID"})
+		return
+	}
+
+	if err := h.taxService.DeleteRate(c.Request.Context(), id); err != nil {
+		respondTaxError(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func respondTaxError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrTaxRateNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tax rate not found"})
+	case errors.Is(err, services.ErrTaxRateExists):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
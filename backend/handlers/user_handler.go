@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type UserHandler struct {
+	userService *services.UserService
+}
+
+func NewUserHandler(userService *services.UserService) *UserHandler {
+	return &UserHandler{userService: userService}
+}
+
+// ListUsers serves the admin user list. ?email= looks up a single user by
+// exact address; ?q= fuzzy-matches names and emails.
+func (h *UserHandler) ListUsers(c *gin.Context) {
+	limit, offset := parsePagination(c)
+
+	if email := strings.TrimSpace(c.Query("email")); email != "" {
+		user, err := h.userService.FindByEmail(c.Request.Context(), email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			return
+		}
+
+		users := []*models.User{}
+		if user != nil {
+			users = append(users, user)
+		}
+		c.JSON(http.StatusOK, PaginatedResponse{
+			Data:   users,
+			Total:  len(users),
+			Limit:  limit,
+			Offset: offset,
+		})
+		return
+	}
+
+	users, total, err := h.userService.List(c.Request.Context(), strings.TrimSpace(c.Query("q")), limit, offset)
+	if err != nil {
+		if errors.Is(err, services.ErrSearchTooShort) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("q must be at least %d characters", services.MinUserSearchLength)})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   users,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+// UpdateRole changes a user's role. The last admin cannot be demoted.
+func (h *UserHandler) UpdateRole(c *gin.Context) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var req models.UpdateUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err = h.userService.UpdateRole(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), id, req.Role)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidRole):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "role must be admin, contributor or customer"})
+		case errors.Is(err, repositories.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		case errors.Is(err, services.ErrLastAdmin):
+			c.JSON(http.StatusConflict, gin.H{"error": "Cannot demote the last admin"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// UpdateAvatar sets the caller's own avatar URL. An empty URL removes it.
+func (h *UserHandler) UpdateAvatar(c *gin.Context) {
+	var req models.UpdateAvatarRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	err := h.userService.UpdateAvatar(c.Request.Context(), c.MustGet("user_id").(uuid.UUID), req.AvatarURL)
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrInvalidAvatarURL):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "avatar_url must be an HTTPS URL on an allowed host"})
+		case errors.Is(err, repositories.ErrUserNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
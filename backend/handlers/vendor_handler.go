@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+type VendorHandler struct {
+	marketplaceService *services.MarketplaceService
+}
+
+func NewVendorHandler(marketplaceService *services.MarketplaceService) *VendorHandler {
+	return &VendorHandler{marketplaceService: marketplaceService}
+}
+
+func (h *VendorHandler) ListPayouts(c *gin.Context) {
+	vendorID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vendor ID"})
+		return
+	}
+
+	limit, offset := parsePagination(c)
+
+	payouts, total, err := h.marketplaceService.ListPayouts(c.Request.Context(), vendorID, limit, offset)
+	if err != nil {
+		respondVendorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   payouts,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func (h *VendorHandler) ReleasePayouts(c *gin.Context) {
+	vendorID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vendor ID"})
+		return
+	}
+
+	released, err := h.marketplaceService.ReleasePayouts(c.Request.Context(), vendorID)
+	if err != nil {
+		respondVendorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"released": released})
+}
+
+func (h *VendorHandler) ListPayoutBatches(c *gin.Context) {
+	vendorID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid vendor ID"})
+		return
+	}
+
+	limit, offset := parsePagination(c)
+
+	batches, total, err := h.marketplaceService.ListPayoutBatches(c.Request.Context(), vendorID, limit, offset)
+	if err != nil {
+		respondVendorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   batches,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func (h *VendorHandler) ListPendingBatches(c *gin.Context) {
+	limit, offset := parsePagination(c)
+
+	batches, total, err := h.marketplaceService.ListOpenPayoutBatches(c.Request.Context(), limit, offset)
+	if err != nil {
+		respondVendorError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, PaginatedResponse{
+		Data:   batches,
+		Total:  total,
+		Limit:  limit,
+		Offset: offset,
+	})
+}
+
+func respondVendorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrVendorNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Vendor not found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// startBackgroundJobs launches the periodic jobs. The returned WaitGroup is
+// released once every job has returned after ctx is cancelled.
+func startBackgroundJobs(ctx context.Context, svc *appServices) *sync.WaitGroup {
+	var wg sync.WaitGroup
+
+	// Daily jobs also run at startup, so a restart does not push them back
+	// by a day
+	runDaily(ctx, &wg, "subscriptions", svc.subscriptions.ProcessDueSubscriptions)
+	runDaily(ctx, &wg, "payouts", svc.payouts.ProcessPendingPayouts)
+	runPeriodically(ctx, &wg, "flash-sales", time.Minute, svc.flashSales.DeactivateExpired)
+	runPeriodically(ctx, &wg, "search-analytics", time.Minute, svc.searches.Flush)
+	runPeriodically(ctx, &wg, "webhook-events", 24*time.Hour, svc.webhookEvents.PruneProcessed)
+	runPeriodically(ctx, &wg, "webhook-deliveries", 24*time.Hour, svc.webhooks.PruneDeliveries)
+	runPeriodically(ctx, &wg, "revoked-tokens", time.Hour, svc.auth.PruneRevokedTokens)
+	runPeriodically(ctx, &wg, "post-autosaves", 24*time.Hour, svc.posts.PruneAutosaves)
+	runPeriodically(ctx, &wg, "scheduled-posts", time.Minute, svc.scheduler.PublishDuePosts)
+	runPeriodically(ctx, &wg, "email-queue", 15*time.Second, svc.emailWorker.ProcessQueue)
+	runPeriodically(ctx, &wg, "site-config", 5*time.Minute, svc.siteConfig.Refresh)
+	if viper.GetBool("static.watch") {
+		runPeriodically(ctx, &wg, "static-assets", 2*time.Second, svc.assets.Refresh)
+	}
+
+	return &wg
+}
+
+// runPeriodically runs fn every interval until ctx is cancelled. A run that
+// is in progress when ctx is cancelled is allowed to finish.
+func runPeriodically(ctx context.Context, wg *sync.WaitGroup, name string, interval time.Duration, fn func(context.Context) error) {
+	schedule(ctx, wg, name, interval, false, fn)
+}
+
+// runDaily runs fn once straight away and then every 24 hours, like
+// runPeriodically.
+func runDaily(ctx context.Context, wg *sync.WaitGroup, name string, fn func(context.Context) error) {
+	schedule(ctx, wg, name, 24*time.Hour, true, fn)
+}
+
+func schedule(ctx context.Context, wg *sync.WaitGroup, name string, interval time.Duration, runNow bool, fn func(context.Context) error) {
+	run := func() {
+		if err := fn(context.WithoutCancel(ctx)); err != nil {
+			log.Printf("Background job %s failed: %v\n", name, err)
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if runNow {
+			run()
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				run()
+			}
+		}
+	}()
+}
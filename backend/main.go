@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/rand"
 	"fmt"
 	"log"
 	"net/http"
@@ -11,14 +12,37 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+	"github.com/adrianmcmains/integrated-site/config"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/handlers"
+	"github.com/adrianmcmains/integrated-site/middleware"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/server"
+	"github.com/adrianmcmains/integrated-site/services"
+	"github.com/adrianmcmains/integrated-site/services/payment"
 )
 
 func main() {
 	// Load configuration
 	loadConfig()
 
+	logger, err := newLogger()
+	if err != nil {
+		log.Fatalf("Unable to create logger: %v\n", err)
+	}
+	defer logger.Sync()
+
+	// Schema prefix lets several instances share one database
+	if err := database.SetSchemaPrefix(viper.GetString("database.schema_prefix")); err != nil {
+		log.Fatalf("Invalid database configuration: %v\n", err)
+	}
+
 	// Connect to database
 	dbPool, err := connectDB()
 	if err != nil {
@@ -26,14 +50,56 @@ func main() {
 	}
 	defer dbPool.Close()
 
+	// Log pool health periodically until shutdown
+	statsCtx, stopStats := context.WithCancel(context.Background())
+	defer stopStats()
+	database.PoolStatsLogger(statsCtx, dbPool, logger, viper.GetDuration("database.stats_log_interval"))
+
+	// Site settings are read once here, for the config overrides and the
+	// site config
+	settingRepo := repositories.NewSiteSettingRepository(dbPool)
+	settings, err := settingRepo.GetAll(context.Background())
+	if err != nil {
+		log.Fatalf("Unable to load site settings: %v\n", err)
+	}
+
+	// Site settings named after a config key override it, so server-level
+	// config can be changed from the admin without editing config files.
+	// The override applies from the next start.
+	applySettingOverrides(settings)
+
+	// Track in-flight transactions so shutdown can let them finish
+	txTracker := database.NewTransactionTracker()
+
+	// Wire up repositories and services
+	svc := newAppServices(dbPool, txTracker)
+
+	// Site settings are required to start; a job refreshes them afterwards
+	svc.siteConfig, err = config.NewSiteConfigStore(settingRepo, settings)
+	if err != nil {
+		log.Fatalf("Unable to load site settings: %v\n", err)
+	}
+
+	// Static assets are fingerprinted once here; in development a job
+	// rehashes them so edits show up without a restart
+	svc.assets, err = server.NewStaticAssetServer(viper.GetString("static.dir"))
+	if err != nil {
+		log.Fatalf("Unable to fingerprint static assets: %v\n", err)
+	}
+
+	// Start background jobs; they stop when jobCtx is cancelled on shutdown
+	jobCtx, stopJobs := context.WithCancel(context.Background())
+	jobs := startBackgroundJobs(jobCtx, svc)
+
 	// Initialize router
-	router := setupRouter(dbPool)
+	router := setupRouter(svc, dbPool, logger)
 
 	// Start server
 	server := &http.Server{
 		Addr:    fmt.Sprintf(":%s", viper.GetString("server.port")),
 		Handler: router,
 	}
+	server.RegisterOnShutdown(svc.notifications.Close)
 
 	// Start server in a goroutine so it doesn't block graceful shutdown
 	go func() {
@@ -53,8 +119,35 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
+	// Requests still running after the timeout are cut off, but the
+	// transactions they started are still waited for below
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v\n", err)
+		log.Printf("Server forced to shutdown: %v\n", err)
+	}
+
+	// Stop background jobs and let any run in progress finish
+	stopJobs()
+	jobs.Wait()
+
+	// Let webhook deliveries in progress finish, retries included
+	webhookCtx, webhookCancel := context.WithTimeout(context.Background(), viper.GetDuration("webhooks.shutdown_wait_timeout"))
+	defer webhookCancel()
+
+	if err := svc.dispatcher.Wait(webhookCtx); err != nil {
+		log.Printf("Timed out waiting for webhook deliveries: %v\n", err)
+	}
+
+	// Write out searches tracked since the last flush
+	if err := svc.searches.Flush(context.Background()); err != nil {
+		log.Printf("Error flushing search analytics: %v\n", err)
+	}
+
+	// Give in-flight database transactions their own window to finish
+	txCtx, txCancel := context.WithTimeout(context.Background(), viper.GetDuration("database.shutdown_wait_timeout"))
+	defer txCancel()
+
+	if err := txTracker.Wait(txCtx); err != nil {
+		log.Printf("Timed out waiting for database transactions: %v\n", err)
 	}
 
 	log.Println("Server exited properly")
@@ -72,6 +165,49 @@ func loadConfig() {
 	viper.SetDefault("database.name", "integrated_site")
 	viper.SetDefault("database.user", "postgres")
 	viper.SetDefault("database.sslmode", "disable")
+	viper.SetDefault("database.shutdown_wait_timeout", "30s")
+	viper.SetDefault("database.schema_prefix", "")
+	viper.SetDefault("database.stats_log_interval", "60s")
+	viper.SetDefault("cors.allowed_origins", []string{"*"})
+	viper.SetDefault("tax.country_header", "CF-IPCountry")
+	viper.SetDefault("tax.inclusive_countries", []string{
+		"AT", "BE", "BG", "CY", "CZ", "DE", "DK", "EE", "ES", "FI", "FR", "GR", "HR", "HU",
+		"IE", "IT", "LT", "LU", "LV", "MT", "NL", "PL", "PT", "RO", "SE", "SI", "SK",
+	})
+	viper.SetDefault("eversend.base_url", "https://api.eversend.co")
+	viper.SetDefault("payment.currency", "usd")
+	viper.SetDefault("subscriptions.payment_provider", "stripe")
+	viper.SetDefault("email.provider", "smtp")
+	viper.SetDefault("storage.backend", "local")
+	viper.SetDefault("storage.local.dir", "uploads")
+	viper.SetDefault("storage.public_url", "http://localhost:8080/uploads")
+	viper.SetDefault("storage.local.signed_url", "http://localhost:8080/files")
+	viper.SetDefault("storage.max_bytes", 10<<20)
+	viper.SetDefault("smtp.port", 587)
+	viper.SetDefault("avatar.allowed_hosts", []string{"s3.amazonaws.com", "res.cloudinary.com"})
+	viper.SetDefault("site.name", "Integrated Site")
+	viper.SetDefault("site.url", "http://localhost:3000")
+	viper.SetDefault("rate_limit.window", "1h")
+	viper.SetDefault("rate_limit.api.authenticated", 1000)
+	viper.SetDefault("rate_limit.api.anonymous", 100)
+	viper.SetDefault("rate_limit.auth.authenticated", 100)
+	viper.SetDefault("rate_limit.auth.anonymous", 20)
+	viper.SetDefault("rate_limit.admin.authenticated", 5000)
+	viper.SetDefault("rate_limit.admin.anonymous", 0)
+	// Typo'd post and page slugs looked up per IP; the lookup runs before
+	// authentication, so only the anonymous limit applies
+	viper.SetDefault("rate_limit.fuzzy_slug.authenticated", 0)
+	viper.SetDefault("rate_limit.fuzzy_slug.anonymous", 60)
+	viper.SetDefault("rate_limit.ip.rps", 20)
+	viper.SetDefault("rate_limit.ip.burst", 40)
+	viper.SetDefault("rate_limit.user.rps", 5)
+	viper.SetDefault("rate_limit.user.burst", 10)
+	viper.SetDefault("server.trusted_proxies", []string{})
+	viper.SetDefault("static.dir", "static")
+	viper.SetDefault("static.watch", false)
+	viper.SetDefault("log.level", "debug")
+	viper.SetDefault("log.sample_rate", 1.0)
+	viper.SetDefault("webhooks.shutdown_wait_timeout", "30s")
 
 	if err := viper.ReadInConfig(); err != nil {
 		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
@@ -80,6 +216,174 @@ func loadConfig() {
 			log.Fatalf("Error reading config file: %v\n", err)
 		}
 	}
+	applyLegacyRateLimitKeys()
+}
+
+// legacyRateLimitKeys are the burst limits once configured under
+// ratelimit.* rather than rate_limit.*.
+var legacyRateLimitKeys = []string{"ip.rps", "ip.burst", "user.rps", "user.burst"}
+
+// applyLegacyRateLimitKeys carries the ratelimit.* burst limits over to
+// rate_limit.*, so older config files keep working. A rate_limit.* key in
+// the config file wins over its ratelimit.* counterpart.
+func applyLegacyRateLimitKeys() {
+	for _, key := range legacyRateLimitKeys {
+		if viper.IsSet("ratelimit."+key) && !viper.InConfig("rate_limit."+key) {
+			viper.Set("rate_limit."+key, viper.Get("ratelimit."+key))
+		}
+	}
+}
+
+// overridableConfigKeys are the config keys a site setting of the same
+// name may override. Anything else, such as secrets, database or storage
+// settings, can only be changed in the config files, so an admin account
+// cannot be used to take over the server's config.
+var overridableConfigKeys = []string{"log.level", "log.sample_rate"}
+
+// applySettingOverrides sets each of overridableConfigKeys that a site
+// setting of the same name has a value for, e.g. a "log.level" setting
+// overrides log.level. Other settings are left to the site config.
+func applySettingOverrides(settings map[string]*models.SiteSetting) {
+	for _, key := range overridableConfigKeys {
+		if setting, ok := settings[key]; ok && setting.Value != nil {
+			viper.Set(key, setting.Value)
+		}
+	}
+}
+
+// newRateLimit limits a route group to rate_limit.<group>.authenticated
+// requests per user and rate_limit.<group>.anonymous requests per IP within
+// rate_limit.window.
+//
+// The counts are kept in this process's memory, as there is no Redis to
+// share them through. That holds for a single instance; behind a load
+// balancer each instance allows the full limit, so a client can make up to
+// limit times the number of instances requests per window.
+func newRateLimit(group string) gin.HandlerFunc {
+	return middleware.RateLimitMiddleware(newRateLimiter(group), middleware.UserOrIPKey)
+}
+
+// newRateLimiter returns the limiter for rate_limit.<group>.
+func newRateLimiter(group string) *middleware.RateLimiter {
+	return middleware.NewRateLimiter(
+		viper.GetInt("rate_limit."+group+".authenticated"),
+		viper.GetInt("rate_limit."+group+".anonymous"),
+		viper.GetDuration("rate_limit.window"),
+	)
+}
+
+// newIPBurstLimit smooths out short bursts per client IP at rate_limit.ip.*,
+// except on exemptRoutes.
+func newIPBurstLimit(exemptRoutes ...string) gin.HandlerFunc {
+	return middleware.NewIPRateLimiter(rate.Limit(viper.GetFloat64("rate_limit.ip.rps")), viper.GetInt("rate_limit.ip.burst"), exemptRoutes...)
+}
+
+// newUserBurstLimit smooths out short bursts per signed-in user at
+// rate_limit.user.*.
+func newUserBurstLimit() gin.HandlerFunc {
+	return middleware.NewUserRateLimiter(rate.Limit(viper.GetFloat64("rate_limit.user.rps")), viper.GetInt("rate_limit.user.burst"))
+}
+
+// newMailer returns the Mailer for the provider set in email.provider,
+// "smtp" or "sendgrid". Without a configured SMTP server, emails are only
+// logged.
+func newMailer() services.Mailer {
+	switch provider := viper.GetString("email.provider"); provider {
+	case "sendgrid":
+		return services.NewSendGridMailer(services.SendGridConfig{
+			APIKey: viper.GetString("sendgrid.api_key"),
+			From:   viper.GetString("sendgrid.from"),
+		})
+	case "smtp":
+		host := viper.GetString("smtp.host")
+		if host == "" {
+			return services.LogMailer{}
+		}
+		return services.NewSMTPMailer(services.SMTPConfig{
+			Host:     host,
+			Port:     viper.GetInt("smtp.port"),
+			Username: viper.GetString("smtp.username"),
+			Password: viper.GetString("smtp.password"),
+			From:     viper.GetString("smtp.from"),
+		})
+	default:
+		log.Fatalf("Unknown email provider %q\n", provider)
+		return nil
+	}
+}
+
+// newWebhookCipher returns the cipher for webhook endpoint secrets, keyed
+// by security.webhook_secret_key. Without a key, outgoing webhooks are
+// disabled.
+func newWebhookCipher() *services.SecretCipher {
+	key := viper.GetString("security.webhook_secret_key")
+	if key == "" {
+		log.Println("No webhook secret key configured, outgoing webhooks are disabled")
+		return nil
+	}
+
+	cipher, err := services.NewSecretCipher(key)
+	if err != nil {
+		log.Fatalf("Invalid webhook secret key: %v\n", err)
+	}
+	return cipher
+}
+
+// newSubscriptionPayments returns the PaymentProcessor that charges
+// subscription renewals, through the payment provider named by
+// subscriptions.payment_provider in payment.currency.
+func newSubscriptionPayments() services.PaymentProcessor {
+	provider, err := payment.Get(viper.GetString("subscriptions.payment_provider"))
+	if err != nil {
+		log.Fatalf("Invalid subscription payment provider: %v\n", err)
+	}
+	return services.NewProviderPaymentProcessor(provider, viper.GetString("payment.currency"))
+}
+
+// newStorageBackend returns the StorageBackend for storage.backend, "local"
+// or "s3".
+func newStorageBackend() services.StorageBackend {
+	switch backend := viper.GetString("storage.backend"); backend {
+	case "s3":
+		s3Backend, err := services.NewS3Backend(context.Background(), services.S3Config{
+			Bucket:  viper.GetString("storage.s3.bucket"),
+			Region:  viper.GetString("storage.s3.region"),
+			BaseURL: viper.GetString("storage.public_url"),
+		})
+		if err != nil {
+			log.Fatalf("Unable to configure S3 storage: %v\n", err)
+		}
+		return s3Backend
+	case "local":
+		// Without a configured key, signed links to private files stop
+		// working when the app restarts
+		signingKey := []byte(viper.GetString("storage.local.signing_key"))
+		if len(signingKey) == 0 {
+			signingKey = make([]byte, 32)
+			if _, err := rand.Read(signingKey); err != nil {
+				log.Fatalf("Unable to generate a download signing key: %v\n", err)
+			}
+			log.Println("No storage.local.signing_key configured, private download links last until restart")
+		}
+		return services.NewLocalDiskBackend(viper.GetString("storage.local.dir"), viper.GetString("storage.public_url"),
+			viper.GetString("storage.local.signed_url"), signingKey)
+	default:
+		log.Fatalf("Unknown storage backend %q\n", backend)
+		return nil
+	}
+}
+
+// newLogger builds the JSON request logger at the configured log.level.
+func newLogger() (*zap.Logger, error) {
+	level, err := zap.ParseAtomicLevel(viper.GetString("log.level"))
+	if err != nil {
+		return nil, err
+	}
+
+	config := zap.NewProductionConfig()
+	config.Level = level
+
+	return config.Build()
 }
 
 func connectDB() (*pgxpool.Pool, error) {
@@ -97,6 +401,12 @@ func connectDB() (*pgxpool.Pool, error) {
 		return nil, err
 	}
 
+	// Log slow queries with sensitive arguments scrubbed
+	if threshold := viper.GetInt("database.slow_query_threshold_ms"); threshold > 0 {
+		config.ConnConfig.Logger = database.NewSlowQueryLogger(time.Duration(threshold)*time.Millisecond, database.NewQuerySanitizer())
+		config.ConnConfig.LogLevel = pgx.LogLevelInfo
+	}
+
 	pool, err := pgxpool.ConnectConfig(context.Background(), config)
 	if err != nil {
 		return nil, err
@@ -110,105 +420,396 @@ func connectDB() (*pgxpool.Pool, error) {
 	return pool, nil
 }
 
-func setupRouter(dbPool *pgxpool.Pool) *gin.Engine {
-	router := gin.Default()
+// appServices holds the services shared by the HTTP router and the
+// background jobs.
+type appServices struct {
+	auth              *services.AuthService
+	orders            *services.OrderService
+	subscriptions     *services.SubscriptionService
+	analytics         *services.AnalyticsService
+	posts             *services.PostService
+	categories        *services.CategoryService
+	tags              *services.TagService
+	marketplace       *services.MarketplaceService
+	events            *services.EventService
+	searches          *services.SearchAnalyticsService
+	products          *services.ProductService
+	productCategories *services.ProductCategoryService
+	notifications     *services.NotificationHub
+	users             *services.UserService
+	payouts           *services.PayoutScheduler
+	flashSales        *services.FlashSaleService
+	customers         *services.CustomerService
+	customerStats     *services.CustomerAnalyticsService
+	comments          *services.CommentService
+	webhookEvents     *services.WebhookEventService
+	webhooks          *services.WebhookService
+	dispatcher        *services.WebhookDispatcher
+	media             *services.MediaService
+	storage           services.StorageBackend
+	scheduler         *services.SchedulerService
+	emailWorker       *services.EmailWorker
+	emailQueue        *services.EmailQueueService
+	mailTemplates     *services.EmailTemplateService
+	auditLog          *services.AuditLogService
+	bundles           *services.BundleService
+	taxes             *services.TaxService
+	pages             *services.PageService
+	settings          *services.SettingsService
+	sitemap           *services.SitemapService
+	feeds             *services.FeedService
+	carts             *services.CartService
+	siteConfig        *config.SiteConfigStore
+	assets            *server.StaticAssetServer
+
+	// slugRedirects sends 404s for moved posts and pages to their new URL
+	slugRedirects gin.HandlerFunc
+}
+
+func newAppServices(dbPool *pgxpool.Pool, txTracker *database.TransactionTracker) *appServices {
+	// Repositories
+	userRepo := repositories.NewUserRepository(dbPool, txTracker)
+	refreshTokenRepo := repositories.NewRefreshTokenRepository(dbPool, txTracker)
+	revokedTokenRepo := repositories.NewRevokedTokenRepository(dbPool)
+	passwordResetTokenRepo := repositories.NewPasswordResetTokenRepository(dbPool)
+	customerRepo := repositories.NewCustomerRepository(dbPool, txTracker)
+	orderRepo := repositories.NewOrderRepository(dbPool, txTracker)
+	orderNoteRepo := repositories.NewOrderNoteRepository(dbPool)
+	subscriptionRepo := repositories.NewSubscriptionRepository(dbPool)
+	analyticsRepo := repositories.NewAnalyticsRepository(dbPool)
+	redirectRepo := repositories.NewRedirectRepository(dbPool)
+	postRepo := repositories.NewPostRepository(dbPool, txTracker, redirectRepo)
+	postAutosaveRepo := repositories.NewPostAutosaveRepository(dbPool)
+	categoryRepo := repositories.NewCategoryRepository(dbPool)
+	tagRepo := repositories.NewTagRepository(dbPool)
+	vendorRepo := repositories.NewVendorRepository(dbPool, txTracker)
+	eventRepo := repositories.NewEventRepository(dbPool)
+	searchAnalyticsRepo := repositories.NewSearchAnalyticsRepository(dbPool)
+	productRepo := repositories.NewProductRepository(dbPool, txTracker, redirectRepo)
+	productCategoryRepo := repositories.NewProductCategoryRepository(dbPool)
+	attributeDefinitionRepo := repositories.NewAttributeDefinitionRepository(dbPool)
+	productImageRepo := repositories.NewProductImageRepository(dbPool, txTracker)
+	productVariantRepo := repositories.NewProductVariantRepository(dbPool)
+	productRevisionRepo := repositories.NewProductRevisionRepository(dbPool, txTracker)
+	payoutBatchRepo := repositories.NewPayoutBatchRepository(dbPool, txTracker)
+	flashSaleRepo := repositories.NewFlashSaleRepository(dbPool)
+	commentRepo := repositories.NewCommentRepository(dbPool, txTracker, userRepo)
+	commentReportRepo := repositories.NewCommentReportRepository(dbPool)
+	pageRepo := repositories.NewPageRepository(dbPool, txTracker, redirectRepo)
+	webhookEventRepo := repositories.NewWebhookEventRepository(dbPool, txTracker)
+	webhookEndpointRepo := repositories.NewWebhookEndpointRepository(dbPool)
+	webhookDeliveryRepo := repositories.NewWebhookDeliveryRepository(dbPool)
+	webhookCircuitRepo := repositories.NewWebhookCircuitRepository(dbPool, txTracker)
+	mediaRepo := repositories.NewMediaRepository(dbPool)
+	emailQueueRepo := repositories.NewEmailQueueRepository(dbPool)
+	emailTemplateRepo := repositories.NewEmailTemplateRepository(dbPool)
+	auditRepo := repositories.NewAuditRepository(dbPool)
+	bundleRepo := repositories.NewBundleRepository(dbPool)
+	cartRepo := repositories.NewCartRepository(dbPool, txTracker)
+	couponRepo := repositories.NewCouponRepository(dbPool)
+	taxRepo := repositories.NewTaxRepository(dbPool)
+
+	// Services
+	marketplaceService := services.NewMarketplaceService(vendorRepo, payoutBatchRepo)
+	notificationHub := services.NewNotificationHub()
+	flashSaleService := services.NewFlashSaleService(flashSaleRepo)
+	bundleService := services.NewBundleService(bundleRepo)
+	mailer := newMailer()
+	storage := newStorageBackend()
+	mediaService := services.NewMediaService(mediaRepo, storage, services.NewImageService(), viper.GetInt64("storage.max_bytes"))
+	emailTemplateService := services.NewEmailTemplateService(emailTemplateRepo)
+	emailService := services.NewEmailService(emailQueueRepo, emailTemplateService, viper.GetString("site.name"), viper.GetString("site.url"))
+	taxService := services.NewTaxService(taxRepo)
+	webhookCipher := newWebhookCipher()
+	webhookDispatcher := services.NewWebhookDispatcher(webhookEndpointRepo, webhookDeliveryRepo, webhookCipher, services.NewCircuitBreaker(webhookCircuitRepo))
+	orderService := services.NewOrderService(orderRepo, productRepo, customerRepo, orderNoteRepo, cartRepo, couponRepo, taxService, marketplaceService, notificationHub, emailService, webhookDispatcher)
+	// New content types join the sitemap by adding a provider here
+	sitemapService := services.NewSitemapService(viper.GetString("site.url"),
+		services.NewPageSitemapProvider(pageRepo),
+		services.NewPostSitemapProvider(postRepo),
+		services.NewProductSitemapProvider(productRepo),
+	)
+
+	return &appServices{
+		auth: services.NewAuthService(
+			userRepo, refreshTokenRepo, passwordResetTokenRepo, repositories.NewAPIKeyRepository(dbPool), revokedTokenRepo, emailService,
+			services.NewGoogleIDTokenVerifier(viper.GetString("google.client_id")),
+		),
+		orders:            orderService,
+		subscriptions:     services.NewSubscriptionService(subscriptionRepo, customerRepo, orderService, newSubscriptionPayments()),
+		analytics:         services.NewAnalyticsService(analyticsRepo),
+		posts:             services.NewPostService(postRepo, categoryRepo, postAutosaveRepo, services.NewSEOScorer(viper.GetString("site.url")), services.NewPostAuditService(auditRepo), mediaService, webhookDispatcher),
+		categories:        services.NewCategoryService(categoryRepo),
+		tags:              services.NewTagService(tagRepo),
+		marketplace:       marketplaceService,
+		events:            services.NewEventService(eventRepo),
+		searches:          services.NewSearchAnalyticsService(searchAnalyticsRepo, 1000),
+		products:          services.NewProductService(productRepo, productRevisionRepo, attributeDefinitionRepo, productImageRepo, productVariantRepo, taxService, flashSaleService, services.NewProductAuditService(auditRepo), mediaService),
+		productCategories: services.NewProductCategoryService(productCategoryRepo),
+		notifications:     notificationHub,
+		users:             services.NewUserService(userRepo, viper.GetStringSlice("avatar.allowed_hosts")),
+		// No bank provider is integrated yet, so transfers are only logged
+		payouts:       services.NewPayoutScheduler(payoutBatchRepo, services.StubBankTransferProvider{}),
+		flashSales:    flashSaleService,
+		customers:     services.NewCustomerService(customerRepo),
+		customerStats: services.NewCustomerAnalyticsService(analyticsRepo),
+		comments:      services.NewCommentService(commentRepo, commentReportRepo, postRepo, emailService),
+		webhookEvents: services.NewWebhookEventService(webhookEventRepo, orderService),
+		webhooks:      services.NewWebhookService(webhookEndpointRepo, webhookDeliveryRepo, webhookCipher, webhookDispatcher),
+		dispatcher:    webhookDispatcher,
+		media:         mediaService,
+		storage:       storage,
+		scheduler:     services.NewSchedulerService(postRepo, emailService, webhookDispatcher),
+		emailWorker:   services.NewEmailWorker(emailQueueRepo, mailer),
+		emailQueue:    services.NewEmailQueueService(emailQueueRepo),
+		mailTemplates: emailTemplateService,
+		auditLog:      services.NewAuditLogService(auditRepo, orderRepo, userRepo, productRepo, postRepo),
+		bundles:       bundleService,
+		taxes:         taxService,
+		pages:         services.NewPageService(pageRepo),
+		settings:      services.NewSettingsService(repositories.NewSiteSettingRepository(dbPool)),
+		sitemap:       sitemapService,
+		feeds:         services.NewFeedService(postRepo, viper.GetString("site.name"), viper.GetString("site.url")),
+		carts:         services.NewCartService(cartRepo, productRepo, couponRepo, flashSaleService, bundleService),
+
+		slugRedirects: middleware.FuzzySlugMiddleware(postRepo, pageRepo, redirectRepo, newRateLimiter("fuzzy_slug")),
+	}
+}
+
+func setupRouter(svc *appServices, dbPool *pgxpool.Pool, logger *zap.Logger) *gin.Engine {
+	authService := svc.auth
+
+	// Handlers
+	authHandler := handlers.NewAuthHandler(authService, viper.GetString("auth.cookie_domain"))
+	orderHandler := handlers.NewOrderHandler(svc.orders)
+	subscriptionHandler := handlers.NewSubscriptionHandler(svc.subscriptions)
+	analyticsHandler := handlers.NewAnalyticsHandler(svc.analytics, svc.searches)
+	blogHandler := handlers.NewBlogHandler(svc.posts, svc.categories, svc.tags, svc.searches)
+	vendorHandler := handlers.NewVendorHandler(svc.marketplace)
+	eventHandler := handlers.NewEventHandler(svc.events)
+	homeHandler := handlers.NewHomeHandler(svc.flashSales)
+	feedHandler := handlers.NewFeedHandler(svc.posts, svc.feeds)
+	productHandler := handlers.NewProductHandler(svc.products, svc.productCategories)
+	bundleHandler := handlers.NewBundleHandler(svc.bundles)
+	cartHandler := handlers.NewCartHandler(svc.carts)
+	taxHandler := handlers.NewTaxHandler(svc.taxes)
+	pageHandler := handlers.NewPageHandler(svc.pages)
+	settingsHandler := handlers.NewSettingsHandler(svc.settings)
+	webhookHandler := handlers.NewWebhookHandler(svc.webhooks)
+	sitemapHandler := handlers.NewSitemapHandler(svc.sitemap)
+	notificationHandler := handlers.NewNotificationHandler(svc.notifications)
+	userHandler := handlers.NewUserHandler(svc.users)
+	customerHandler := handlers.NewCustomerHandler(svc.customers, svc.customerStats)
+	commentHandler := handlers.NewCommentHandler(svc.comments)
+	mediaHandler := handlers.NewMediaHandler(svc.media)
+	emailQueueHandler := handlers.NewEmailQueueHandler(svc.emailQueue)
+	emailTemplateHandler := handlers.NewEmailTemplateHandler(svc.mailTemplates)
+	auditHandler := handlers.NewAuditHandler(svc.auditLog)
+	paymentWebhookHandler := handlers.NewPaymentWebhookHandler(svc.webhookEvents, viper.GetString("payment.stripe.webhook_secret"))
+
+	router := gin.New()
+	// Without trusted proxies the client IP is the connection's address, so
+	// clients cannot dodge the per-IP limits with a forged X-Forwarded-For
+	if err := router.SetTrustedProxies(viper.GetStringSlice("server.trusted_proxies")); err != nil {
+		log.Fatalf("Invalid server.trusted_proxies: %v\n", err)
+	}
 
 	// Middleware
-	router.Use(gin.Logger())
+	router.Use(middleware.GinZapLogger(logger, middleware.LoggerConfig{
+		SampleRate: viper.GetFloat64("log.sample_rate"),
+	}))
 	router.Use(gin.Recovery())
-	
-	// Set up CORS
-	router.Use(func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
 
-		c.Next()
-	})
+	// Set up CORS
+	router.Use(middleware.CORSMiddleware(viper.GetStringSlice("cors.allowed_origins")))
+	// Short bursts per IP are smoothed out here; the per-group limits below
+	// cap the totals over longer windows. Payment providers deliver their
+	// webhooks in bursts from a few IPs, so those are exempt.
+	router.Use(newIPBurstLimit(
+		"/api/payment/stripe/webhook",
+		"/api/payment/eversend/webhook",
+	))
+	router.Use(svc.slugRedirects)
+
+	// Health checks. Postgres is the only dependency every instance has;
+	// there is no Redis or job queue server to check, background jobs run
+	// in-process (see startBackgroundJobs).
+	healthHandler := handlers.NewHealthHandler(dbPool)
+	if apiKey := viper.GetString("eversend.api_key"); apiKey != "" {
+		healthHandler.AddCheck(services.NewEversendProvider(viper.GetString("eversend.base_url"), apiKey))
+	}
+	if host := viper.GetString("smtp.host"); host != "" && viper.GetString("email.provider") == "smtp" {
+		smtpConfig := services.SMTPConfig{Host: host, Port: viper.GetInt("smtp.port")}
+		healthHandler.AddCheck(handlers.CheckFunc("smtp", func(ctx context.Context) error {
+			return services.SMTPHealthCheck(smtpConfig)
+		}))
+	}
+	router.GET("/health", healthHandler.Health)
+	router.GET("/health/live", healthHandler.Live)
+	router.GET("/health/ready", healthHandler.Ready)
+	router.GET("/sitemap.xml", sitemapHandler.Sitemap)
+	router.GET("/feed", feedHandler.RSSFeed)
+	router.GET("/feed/atom", feedHandler.AtomFeed)
+
+	// Fingerprinted static assets; templates link them with AssetURL
+	router.GET(server.StaticURLPrefix+"*filepath", svc.assets.Serve)
+
+	// Uploads kept on local disk are served by the app itself; private
+	// ones only through signed links
+	if local, ok := svc.storage.(*services.LocalDiskBackend); ok {
+		localFileHandler := handlers.NewLocalFileHandler(local)
+		router.GET("/uploads/*filepath", localFileHandler.ServePublic)
+		router.GET("/files/*filepath", localFileHandler.ServeSigned)
+	}
 
-	// Health check
-	router.GET("/health", func(c *gin.Context) {
-		c.JSON(http.StatusOK, gin.H{
-			"status": "ok",
-			"time":   time.Now().Format(time.RFC3339),
-		})
-	})
+	// Rate limits are per route group. Public groups check for a token
+	// first so signed-in users are counted by user instead of by IP.
+	optionalAuth := middleware.OptionalAuthMiddleware(authService)
+	apiLimit := newRateLimit("api")
+	authLimit := newRateLimit("auth")
+	adminLimit := newRateLimit("admin")
+	// Writes to these entities are recorded in the audit log. Recovery
+	// runs before them, so writes that panic are recorded too. Post and
+	// product updates are left out as their services already log them.
+	auditOrders := middleware.Audit(svc.auditLog, services.AuditEntityOrder)
+	auditUsers := middleware.Audit(svc.auditLog, services.AuditEntityUser)
+	auditProducts := middleware.Audit(svc.auditLog, services.AuditEntityProduct)
+	auditPosts := middleware.Audit(svc.auditLog, services.AuditEntityPost)
+	// Only signed-in users are held to their own bucket here; anonymous
+	// requests already went through the per-IP one
+	userLimit := newUserBurstLimit()
 
 	// API routes
 	api := router.Group("/api")
 	{
+		api.GET("/home", optionalAuth, apiLimit, homeHandler.Home)
+
 		// Blog routes
-		blog := api.Group("/blog")
+		blog := api.Group("/blog", optionalAuth, apiLimit)
 		{
-			blog.GET("/posts", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Get all posts"})
-			})
-			blog.GET("/posts/:slug", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Get post by slug"})
-			})
-			blog.GET("/categories", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Get all categories"})
-			})
+			blog.GET("/posts", blogHandler.ListPosts)
+			blog.GET("/posts/:slug", blogHandler.GetPost)
+			blog.GET("/posts/:slug/stats",
+				middleware.AuthMiddleware(authService),
+				middleware.RoleMiddleware("admin", "contributor"),
+				blogHandler.GetPostStats,
+			)
+			blog.GET("/posts/:slug/seo-score",
+				middleware.AuthMiddleware(authService),
+				middleware.RoleMiddleware("admin", "contributor"),
+				blogHandler.GetPostSEOScore,
+			)
+			blog.PUT("/posts/:id",
+				middleware.AuthMiddleware(authService),
+				middleware.RoleMiddleware("admin", "contributor"),
+				blogHandler.UpdatePost,
+			)
+			blog.POST("/posts/:id/autosave",
+				middleware.AuthMiddleware(authService),
+				middleware.RoleMiddleware("admin", "contributor"),
+				blogHandler.Autosave,
+			)
+			// Takes the post ID; GET routes name the segment :slug
+			blog.GET("/posts/:slug/autosave",
+				middleware.AuthMiddleware(authService),
+				middleware.RoleMiddleware("admin", "contributor"),
+				blogHandler.GetAutosave,
+			)
+			// Takes the post ID, like the autosave route
+			blog.GET("/posts/:slug/comments", commentHandler.ListPostComments)
+			blog.POST("/posts/:id/comments", middleware.AuthMiddleware(authService), commentHandler.CreateComment)
+			blog.POST("/comments/:id/report", middleware.AuthMiddleware(authService), commentHandler.ReportComment)
+			blog.GET("/categories", blogHandler.ListCategories)
+			blog.GET("/categories/:slug", blogHandler.GetCategory)
+			blog.GET("/categories/:slug/feed.rss", feedHandler.CategoryFeed)
 			blog.GET("/tags", func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{"message": "Get all tags"})
 			})
 		}
 
 		// Shop routes
-		shop := api.Group("/shop")
+		shop := api.Group("/shop", optionalAuth, apiLimit, middleware.TaxDisplay(
+			viper.GetString("tax.country_header"),
+			viper.GetStringSlice("tax.inclusive_countries"),
+		))
 		{
-			shop.GET("/products", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Get all products"})
-			})
-			shop.GET("/products/:slug", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Get product by slug"})
-			})
-			shop.GET("/categories", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Get all product categories"})
-			})
+			shop.GET("/products", productHandler.ListProducts)
+			shop.GET("/products/:slug", productHandler.GetProduct)
+			shop.GET("/bundles/:slug", bundleHandler.GetBundle)
+			shop.GET("/categories", productHandler.ListCategories)
+			shop.GET("/categories/:slug/products", productHandler.ListCategoryProducts)
+			shop.GET("/events", eventHandler.ListUpcoming)
 		}
 
-		// Order routes
-		orders := api.Group("/orders")
+		// Order routes. API keys need the orders:read or orders:write scope.
+		readOrders := middleware.AuthMiddleware(authService, "orders:read", "orders:write")
+		writeOrders := middleware.AuthMiddleware(authService, "orders:write")
+		orders := api.Group("/orders", optionalAuth, apiLimit, userLimit)
 		{
-			orders.POST("/", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Create new order"})
-			})
-			orders.GET("/:id", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Get order by ID"})
-			})
+			orders.POST("/",
+				writeOrders,
+				middleware.SchemaValidationMiddleware("schemas/create_order.json"),
+				auditOrders,
+				orderHandler.Checkout,
+			)
+			orders.GET("/:id", readOrders, orderHandler.GetOrder)
+			orders.POST("/:id/notes", writeOrders, auditOrders, orderHandler.AddCustomerNote)
+			orders.PUT("/:id/cancel", writeOrders, auditOrders, orderHandler.CancelOrder)
+		}
+
+		// Cart routes. API keys need the cart:write scope.
+		cart := api.Group("/cart", middleware.AuthMiddleware(authService, "cart:write"), apiLimit)
+		{
+			cart.GET("", cartHandler.GetCart)
+			cart.POST("/items", cartHandler.AddItem)
+			cart.POST("/bundles", cartHandler.AddBundle)
+			cart.PUT("/items/:id", cartHandler.UpdateItem)
+			cart.DELETE("/items/:id", cartHandler.RemoveItem)
+			cart.POST("/coupon", cartHandler.ApplyCoupon)
+			cart.DELETE("/coupon", cartHandler.RemoveCoupon)
 		}
 
 		// Auth routes
-		auth := api.Group("/auth")
+		auth := api.Group("/auth", optionalAuth, authLimit)
 		{
 			auth.POST("/register", func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{"message": "Register new user"})
 			})
-			auth.POST("/login", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Login user"})
-			})
-			auth.GET("/profile", func(c *gin.Context) {
+			auth.POST("/login", authHandler.Login)
+			auth.POST("/refresh", authHandler.Refresh)
+			auth.POST("/logout", authHandler.Logout)
+			auth.POST("/oauth/google", authHandler.GoogleLogin)
+			auth.POST("/password-reset/request", authHandler.RequestPasswordReset)
+			auth.POST("/password-reset/confirm", authHandler.ConfirmPasswordReset)
+			auth.GET("/profile", userLimit, func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{"message": "Get user profile"})
 			})
+			auth.PUT("/profile/avatar", middleware.AuthMiddleware(authService), auditUsers, userHandler.UpdateAvatar)
+			auth.GET("/subscriptions", middleware.AuthMiddleware(authService, "subscriptions:read"), subscriptionHandler.ListMine)
+			auth.GET("/api-keys", middleware.AuthMiddleware(authService), authHandler.ListAPIKeys)
+			auth.POST("/api-keys", middleware.AuthMiddleware(authService), authHandler.CreateAPIKey)
+			auth.DELETE("/api-keys/:id", middleware.AuthMiddleware(authService), authHandler.RevokeAPIKey)
 		}
 
 		// CMS routes
-		cms := api.Group("/cms")
+		cms := api.Group("/cms", optionalAuth, apiLimit)
 		{
-			cms.GET("/pages", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Get all pages"})
-			})
-			cms.GET("/pages/:slug", func(c *gin.Context) {
-				c.JSON(http.StatusOK, gin.H{"message": "Get page by slug"})
-			})
+			cms.GET("/pages", pageHandler.ListPages)
+			cms.GET("/pages/:slug", pageHandler.GetPage)
+		}
+
+		// Media routes
+		media := api.Group("/media", optionalAuth, apiLimit)
+		{
+			media.GET("/:id", mediaHandler.GetMedia)
 		}
+		api.POST("/upload",
+			middleware.AuthMiddleware(authService),
+			apiLimit,
+			middleware.RoleMiddleware("admin"),
+			mediaHandler.Upload,
+		)
+		api.GET("/downloads/:media_id", middleware.AuthMiddleware(authService), apiLimit, mediaHandler.Download)
 
 		// Payment routes
 		payment := api.Group("/payment")
@@ -219,16 +820,111 @@ func setupRouter(dbPool *pgxpool.Pool) *gin.Engine {
 			payment.POST("/eversend/webhook", func(c *gin.Context) {
 				c.JSON(http.StatusOK, gin.H{"message": "Eversend webhook handler"})
 			})
+			payment.POST("/stripe/webhook", paymentWebhookHandler.StripeWebhook)
 		}
 	}
 
-	// Admin routes (protected)
-	admin := router.Group("/admin")
+	// Admin routes (protected). Every route registered on this group
+	// requires an authenticated admin.
+	admin := router.Group("/admin",
+		middleware.AuthMiddleware(authService),
+		adminLimit,
+		middleware.RoleMiddleware("admin"),
+	)
 	{
-		admin.GET("/dashboard", func(c *gin.Context) {
-			c.JSON(http.StatusOK, gin.H{"message": "Admin dashboard data"})
-		})
+		admin.GET("/dashboard", analyticsHandler.Dashboard)
+		admin.GET("/notifications/sse", notificationHandler.Stream)
+		admin.GET("/audit", auditHandler.ListAuditLog)
+		admin.GET("/audit-log", auditHandler.ListAuditLog)
+		admin.GET("/users", userHandler.ListUsers)
+		admin.PUT("/users/:id/role", auditUsers, userHandler.UpdateRole)
+		admin.GET("/email-queue", emailQueueHandler.ListEmails)
+		admin.POST("/email-queue/:id/retry", emailQueueHandler.RetryEmail)
+		admin.GET("/email-templates", emailTemplateHandler.ListTemplates)
+		admin.PUT("/email-templates/:name", emailTemplateHandler.UpdateTemplate)
+		admin.POST("/email-templates/:name/preview", emailTemplateHandler.PreviewTemplate)
+		admin.POST("/customers/merge", customerHandler.MergeCustomers)
+		admin.GET("/customers/:id/analytics", customerHandler.GetAnalytics)
+		admin.GET("/reports/customer-ltv", analyticsHandler.CustomerLTV)
+		admin.GET("/analytics/search", analyticsHandler.TopSearches)
+		admin.GET("/analytics/search/zero-results", analyticsHandler.ZeroResultSearches)
+		admin.GET("/orders", orderHandler.ListOrders)
+		admin.GET("/orders/search", orderHandler.SearchOrders)
+		admin.GET("/orders/export", orderHandler.ExportOrders)
+		admin.POST("/orders/:id/notes", auditOrders, orderHandler.AddInternalNote)
+		admin.PUT("/orders/:id/status", auditOrders, orderHandler.UpdateStatus)
+		admin.GET("/blog/posts/deleted", blogHandler.ListDeletedPosts)
+		admin.DELETE("/blog/posts/:id", auditPosts, blogHandler.DeletePost)
+		admin.POST("/blog/posts/:id/restore", auditPosts, blogHandler.RestorePost)
+		admin.DELETE("/blog/categories/:id", blogHandler.DeleteCategory)
+		admin.POST("/blog/tags/batch", blogHandler.CreateTags)
+		admin.GET("/comments", commentHandler.ListComments)
+		admin.PUT("/comments/:id/status", commentHandler.UpdateStatus)
+		admin.GET("/subscriptions", subscriptionHandler.List)
+		admin.PUT("/subscriptions/:id/status", subscriptionHandler.UpdateStatus)
+		admin.GET("/vendors/:id/payouts", vendorHandler.ListPayouts)
+		admin.POST("/vendors/:id/payouts/release", vendorHandler.ReleasePayouts)
+		admin.GET("/vendors/:id/payout-batches", vendorHandler.ListPayoutBatches)
+		admin.GET("/payouts/pending-batches", vendorHandler.ListPendingBatches)
+		admin.POST("/events/:id/check-in", eventHandler.CheckIn)
+		admin.GET("/shop/products", productHandler.AdminListProducts)
+		admin.POST("/shop/products", auditProducts, productHandler.CreateProduct)
+		admin.PUT("/shop/products/:id", productHandler.UpdateProduct)
+		admin.DELETE("/shop/products/:id", auditProducts, productHandler.DeleteProduct)
+		admin.GET("/shop/products/deleted", productHandler.ListDeletedProducts)
+		admin.POST("/shop/products/:id/restore", auditProducts, productHandler.RestoreProduct)
+		admin.POST("/shop/products/drafts", auditProducts, productHandler.CreateDraft)
+		admin.PUT("/shop/products/:id/pricing", auditProducts, productHandler.UpdatePricing)
+		admin.PUT("/shop/products/:id/stock", auditProducts, productHandler.UpdateStock)
+		admin.GET("/shop/products/:id/publish", productHandler.ValidateForPublish)
+		admin.PUT("/shop/products/:id/publish", auditProducts, productHandler.Publish)
+		admin.POST("/shop/products/:id/images", productHandler.AddImage)
+		admin.DELETE("/shop/products/:id/images/:img_id", productHandler.RemoveImage)
+		admin.PUT("/shop/products/:id/images/reorder", productHandler.ReorderImages)
+		admin.POST("/shop/products/:id/variants", productHandler.CreateVariant)
+		admin.PUT("/shop/products/:id/variants/:vid", productHandler.UpdateVariant)
+		admin.DELETE("/shop/products/:id/variants/:vid", productHandler.DeleteVariant)
+		admin.GET("/shop/products/:id/revisions", productHandler.ListRevisions)
+		admin.POST("/shop/products/:id/revisions/:rev_id/restore", auditProducts, productHandler.RestoreRevision)
+		admin.POST("/shop/categories/:id/bulk-move", productHandler.BulkMove)
+		admin.GET("/webhooks", webhookHandler.ListWebhooks)
+		admin.POST("/webhooks", webhookHandler.CreateWebhook)
+		admin.GET("/webhooks/:id", webhookHandler.GetWebhook)
+		admin.PUT("/webhooks/:id", webhookHandler.UpdateWebhook)
+		admin.DELETE("/webhooks/:id", webhookHandler.DeleteWebhook)
+		admin.GET("/webhooks/:id/deliveries", webhookHandler.ListDeliveries)
+		admin.GET("/webhooks/dead-letter", webhookHandler.ListDeadLetters)
+		admin.POST("/webhooks/dead-letter/:id/retry", webhookHandler.RetryDeadLetter)
+		admin.POST("/webhooks/dead-letter/retry-all", webhookHandler.RetryAllDeadLetters)
+		admin.GET("/settings", settingsHandler.ListSettings)
+		admin.PUT("/settings/:key", settingsHandler.UpdateSetting)
+		admin.GET("/cms/pages", pageHandler.AdminListPages)
+		admin.POST("/cms/pages", pageHandler.CreatePage)
+		admin.GET("/cms/pages/:id", pageHandler.AdminGetPage)
+		admin.PUT("/cms/pages/:id", pageHandler.UpdatePage)
+		admin.DELETE("/cms/pages/:id", pageHandler.DeletePage)
+		admin.PUT("/cms/pages/:id/publish", pageHandler.PublishPage)
+		admin.PUT("/cms/pages/:id/unpublish", pageHandler.UnpublishPage)
+		admin.GET("/tax-rates", taxHandler.ListRates)
+		admin.POST("/tax-rates", taxHandler.CreateRate)
+		admin.PUT("/tax-rates/:id", taxHandler.UpdateRate)
+		admin.DELETE("/tax-rates/:id", taxHandler.DeleteRate)
+		admin.GET("/shop/attribute-definitions", productHandler.ListAttributeDefinitions)
+		admin.POST("/shop/attribute-definitions", productHandler.CreateAttributeDefinition)
+		admin.PUT("/shop/attribute-definitions/:id", productHandler.UpdateAttributeDefinition)
+		admin.DELETE("/shop/attribute-definitions/:id", productHandler.DeleteAttributeDefinition)
+	}
+
+	// Admin blog routes that contributors may use on their own posts
+	adminBlog := router.Group("/admin/blog",
+		middleware.AuthMiddleware(authService),
+		adminLimit,
+		middleware.RoleMiddleware("admin", "contributor"),
+	)
+	{
+		adminBlog.POST("/posts", middleware.SchemaValidationMiddleware("schemas/create_post.json"), auditPosts, blogHandler.CreatePost)
+		adminBlog.POST("/posts/:id/duplicate", auditPosts, blogHandler.DuplicatePost)
 	}
 
 	return router
-}
\ No newline at end of file
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// Only the keys in overridableConfigKeys can be overridden from the site
+// settings; a setting named after any other config key is ignored.
+func TestApplySettingOverrides(t *testing.T) {
+	settings := map[string]*models.SiteSetting{}
+	for key, value := range map[string]interface{}{
+		"log.level":         "debug",
+		"log.sample_rate":   nil,
+		"auth.jwt_secret":   "chosen-by-an-admin",
+		"database.url":      "postgres://attacker.example.com/db",
+		"storage.s3.bucket": "someone-elses-bucket",
+	} {
+		settings[key] = &models.SiteSetting{Key: key, Value: value}
+	}
+
+	viper.Set("log.level", "info")
+	viper.Set("log.sample_rate", 0.5)
+	viper.Set("auth.jwt_secret", "from-the-config-file")
+	viper.Set("database.url", "postgres://localhost/site")
+	t.Cleanup(viper.Reset)
+
+	applySettingOverrides(settings)
+
+	if got := viper.GetString("log.level"); got != "debug" {
+		t.Errorf("log.level = %q, want the setting's debug", got)
+	}
+	if got := viper.GetFloat64("log.sample_rate"); got != 0.5 {
+		t.Errorf("log.sample_rate = %v, want the config file's 0.5 as the setting is unset", got)
+	}
+	if got := viper.GetString("auth.jwt_secret"); got != "from-the-config-file" {
+		t.Errorf("auth.jwt_secret = %q, want the config file's", got)
+	}
+	if got := viper.GetString("database.url"); got != "postgres://localhost/site" {
+		t.Errorf("database.url = %q, want the config file's", got)
+	}
+	if viper.IsSet("storage.s3.bucket") {
+		t.Errorf("storage.s3.bucket = %q, want it left unset", viper.GetString("storage.s3.bucket"))
+	}
+}
+
+// The burst limits in the older ratelimit.* keys are still read, unless the
+// config file also sets the rate_limit.* key.
+func TestApplyLegacyRateLimitKeys(t *testing.T) {
+	t.Cleanup(viper.Reset)
+	viper.SetConfigType("yaml")
+	config := `
+ratelimit:
+  ip:
+    rps: 50
+    burst: 80
+  user:
+    rps: 7
+rate_limit:
+  user:
+    rps: 9
+`
+	if err := viper.ReadConfig(strings.NewReader(config)); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetDefault("rate_limit.user.burst", 10)
+
+	applyLegacyRateLimitKeys()
+
+	for key, want := range map[string]int{
+		"rate_limit.ip.rps":     50,
+		"rate_limit.ip.burst":   80,
+		"rate_limit.user.rps":   9,
+		"rate_limit.user.burst": 10,
+	} {
+		if got := viper.GetInt(key); got != want {
+			t.Errorf("%s = %d, want %d", key, got, want)
+		}
+	}
+}
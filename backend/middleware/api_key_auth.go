@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// APIKeyHeader carries an API key, as an alternative to an
+// "Authorization: ApiKey <key>" header.
+const APIKeyHeader = "X-API-Key"
+
+// APIKeyAuthMiddleware authenticates the request with an API key and sets
+// the key's user info in the context, like AuthMiddleware does for access
+// tokens. The permissions are the key's scopes, and "api_key_id" is set to
+// the key's ID. No role is set, so RoleMiddleware rejects the request. With
+// permissions given, the key must hold one of them.
+func APIKeyAuthMiddleware(authService *services.AuthService, permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		apiKey := apiKeyFromRequest(c)
+		if apiKey == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "API key is required"})
+			c.Abort()
+			return
+		}
+
+		if !authenticateAPIKey(c, authService, apiKey) {
+			return
+		}
+
+		if len(permissions) > 0 {
+			ScopeMiddleware(permissions...)(c)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// apiKeyFromRequest returns the API key in the Authorization header, with
+// the ApiKey scheme, or else in the X-API-Key header. It returns "" when
+// the request has neither.
+func apiKeyFromRequest(c *gin.Context) string {
+	if scheme, key, ok := strings.Cut(c.GetHeader("Authorization"), " "); ok && scheme == "ApiKey" {
+		return key
+	}
+	return c.GetHeader(APIKeyHeader)
+}
+
+// authenticateAPIKey validates the key and sets its user info in the
+// context. It reports false, having aborted with an error response, when
+// the key is not valid.
+func authenticateAPIKey(c *gin.Context, authService *services.AuthService, apiKey string) bool {
+	claims, err := authService.ValidateAPIKey(c.Request.Context(), apiKey)
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidAPIKey) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired API key"})
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		}
+		c.Abort()
+		return false
+	}
+
+	c.Set("user_id", claims.UserID)
+	c.Set("email", claims.Email)
+	c.Set("scopes", claims.Scopes)
+	c.Set("permissions", claims.Permissions)
+	c.Set("api_key_id", claims.KeyID)
+	return true
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// maxAuditBodyBytes is the largest response body kept as the after
+// snapshot. Larger bodies are still sent, just not recorded.
+const maxAuditBodyBytes = 1 << 20
+
+// auditResponseWriter passes the response through while keeping a copy of
+// the body.
+type auditResponseWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (w *auditResponseWriter) Write(data []byte) (int, error) {
+	w.capture(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *auditResponseWriter) WriteString(s string) (int, error) {
+	w.capture([]byte(s))
+	return w.ResponseWriter.WriteString(s)
+}
+
+func (w *auditResponseWriter) capture(data []byte) {
+	if w.overflow {
+		return
+	}
+	if w.body.Len()+len(data) > maxAuditBodyBytes {
+		w.overflow = true
+		w.body.Reset()
+		return
+	}
+	w.body.Write(data)
+}
+
+// Audit records each write to entityType made through the route in the
+// audit log, so it must run after AuthMiddleware. The entity is snapshotted
+// before the handler when the route has an :id, and the JSON object for it
+// the handler responds with is the after snapshot; handlers that respond
+// without one are snapshotted again instead. Failed writes are not
+// recorded, but a write the handler panicked in is, without changes, before
+// the panic carries on to the recovery middleware.
+func Audit(auditService *services.AuditLogService, entityType string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actorID, ok := c.Get("user_id")
+		if !ok || c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead {
+			c.Next()
+			return
+		}
+
+		actor := actorID.(uuid.UUID)
+		entry := &models.AuditLog{
+			ActorID:    &actor,
+			Action:     c.Request.Method + " " + c.FullPath(),
+			EntityType: entityType,
+			EntityID:   c.Param("id"),
+			Details: map[string]interface{}{
+				"actor_role": c.GetString("role"),
+				"ip_address": c.ClientIP(),
+			},
+		}
+		ctx := c.Request.Context()
+
+		// A creation starts from nothing
+		before := map[string]interface{}{}
+		if entry.EntityID != "" {
+			var err error
+			before, err = auditService.Snapshot(ctx, entityType, entry.EntityID)
+			if err != nil {
+				log.Printf("Failed to snapshot %s %s for the audit log: %v", entityType, entry.EntityID, err)
+			}
+		}
+
+		writer := &auditResponseWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		defer func() {
+			if p := recover(); p != nil {
+				logAuditedWrite(ctx, auditService, entry, before, nil)
+				panic(p)
+			}
+		}()
+
+		c.Next()
+
+		if c.Writer.Status() >= http.StatusBadRequest {
+			return
+		}
+		after := map[string]interface{}{}
+		if c.Request.Method != http.MethodDelete {
+			after = auditResponseSnapshot(ctx, auditService, entry, writer)
+		}
+		logAuditedWrite(ctx, auditService, entry, before, after)
+	}
+}
+
+// auditResponseSnapshot returns the JSON object the handler responded with
+// if it is the audited entity, or the entity loaded again otherwise. A
+// created entity's ID is taken from the response.
+func auditResponseSnapshot(ctx context.Context, auditService *services.AuditLogService, entry *models.AuditLog, writer *auditResponseWriter) map[string]interface{} {
+	var after map[string]interface{}
+	if !writer.overflow && writer.body.Len() > 0 {
+		if err := json.Unmarshal(writer.body.Bytes(), &after); err != nil {
+			after = nil
+		}
+	}
+	id, _ := after["id"].(string)
+	if entry.EntityID == "" {
+		entry.EntityID = id
+	}
+	if entry.EntityID == "" || (after != nil && id == entry.EntityID) {
+		return after
+	}
+
+	after, err := auditService.Snapshot(ctx, entry.EntityType, entry.EntityID)
+	if err != nil {
+		log.Printf("Failed to snapshot %s %s for the audit log: %v", entry.EntityType, entry.EntityID, err)
+	}
+	return after
+}
+
+func logAuditedWrite(ctx context.Context, auditService *services.AuditLogService, entry *models.AuditLog, before, after map[string]interface{}) {
+	if err := auditService.LogWrite(ctx, entry, before, after); err != nil {
+		log.Printf("Failed to record audit log entry for %s %s: %v", entry.EntityType, entry.EntityID, err)
+	}
+}
@@ -0,0 +1,72 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// A write the handler panics in is still recorded: Audit logs it before the
+// panic reaches the recovery middleware, which runs first.
+func TestAuditRecordsWriteThatPanics(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	auditRepo := repositories.NewAuditRepository(pool)
+	auditService := services.NewAuditLogService(auditRepo, repositories.NewOrderRepository(pool, nil),
+		repositories.NewUserRepository(pool, nil), nil, nil)
+
+	actor := &models.User{
+		Email:        dbtest.UniqueName("admin") + "@example.com",
+		PasswordHash: "x",
+		FullName:     "Test Admin",
+		Role:         "admin",
+	}
+	if err := repositories.NewUserRepository(pool, nil).Create(ctx, actor); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.users WHERE id = $1"), actor.ID)
+	})
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.audit_logs WHERE actor_id = $1"), actor.ID)
+	})
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(gin.Recovery())
+	router.PUT("/orders/:id/status",
+		func(c *gin.Context) {
+			c.Set("user_id", actor.ID)
+			c.Set("role", "admin")
+		},
+		Audit(auditService, services.AuditEntityOrder),
+		func(c *gin.Context) { panic("boom") },
+	)
+
+	orderID := uuid.NewString()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/orders/"+orderID+"/status", nil))
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status = %d, want 500 from the recovery middleware", w.Code)
+	}
+
+	entries, total, err := auditRepo.List(ctx, services.AuditEntityOrder, orderID, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 {
+		t.Fatalf("%d audit entries for the order, want 1", total)
+	}
+	if entry := entries[0]; entry.Action != "PUT /orders/:id/status" || entry.ActorID == nil || *entry.ActorID != actor.ID {
+		t.Errorf("entry = %s by %v, want PUT /orders/:id/status by %s", entry.Action, entry.ActorID, actor.ID)
+	}
+}
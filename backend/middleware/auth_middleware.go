@@ -5,23 +5,38 @@ import (
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/yourusername/integrated-site/services"
+	"github.com/adrianmcmains/integrated-site/services"
 )
 
-func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
+// AuthMiddleware authenticates the request with a Bearer access token. With
+// keyPermissions given, it also accepts an API key holding one of them, as
+// APIKeyAuthMiddleware does; otherwise API keys are rejected.
+func AuthMiddleware(authService *services.AuthService, keyPermissions ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// Get Authorization header
 		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
-			c.Abort()
-			return
-		}
 
 		// Check if header has Bearer prefix
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
+			// Try an API key before rejecting the request
+			if apiKey := apiKeyFromRequest(c); apiKey != "" {
+				if len(keyPermissions) == 0 {
+					c.JSON(http.StatusUnauthorized, gin.H{"error": "API keys are not accepted for this route"})
+					c.Abort()
+					return
+				}
+				if authenticateAPIKey(c, authService, apiKey) {
+					ScopeMiddleware(keyPermissions...)(c)
+				}
+				return
+			}
+
+			if authHeader == "" {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header is required"})
+			} else {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization header format must be Bearer {token}"})
+			}
 			c.Abort()
 			return
 		}
@@ -30,7 +45,7 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 		tokenString := parts[1]
 
 		// Validate token
-		claims, err := authService.ValidateToken(tokenString)
+		claims, err := authService.ValidateToken(c.Request.Context(), tokenString)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
 			c.Abort()
@@ -41,13 +56,24 @@ func AuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
 		c.Set("user_id", claims.UserID)
 		c.Set("email", claims.Email)
 		c.Set("role", claims.Role)
+		c.Set("scopes", claims.Scopes)
+		c.Set("permissions", claims.Permissions)
 
 		c.Next()
 	}
 }
 
+// RoleMiddleware lets the request through if the user has one of the
+// roles. Requests authenticated with an API key carry no role and are
+// rejected: keys are limited to their scopes.
 func RoleMiddleware(roles ...string) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		if _, viaAPIKey := c.Get("api_key_id"); viaAPIKey {
+			c.JSON(http.StatusForbidden, gin.H{"error": "API keys cannot access this route"})
+			c.Abort()
+			return
+		}
+
 		// Get user role from context
 		role, exists := c.Get("role")
 		if !exists {
@@ -69,4 +95,51 @@ func RoleMiddleware(roles ...string) gin.HandlerFunc {
 		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
 		c.Abort()
 	}
-}
\ No newline at end of file
+}
+
+// ScopeMiddleware lets the request through if the caller's token carries
+// one of the permissions. It reads them from the token claims set by
+// AuthMiddleware, so a permission granted after the token was issued only
+// counts once the user gets a new token.
+func ScopeMiddleware(permissions ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		granted, exists := c.Get("permissions")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+			c.Abort()
+			return
+		}
+
+		for _, held := range granted.([]string) {
+			for _, p := range permissions {
+				if held == p {
+					c.Next()
+					return
+				}
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied"})
+		c.Abort()
+	}
+}
+
+// OptionalAuthMiddleware sets the user info in the context when a valid
+// Bearer token is present, but lets anonymous requests through. Handlers of
+// public endpoints use it to decide how much to show the caller.
+func OptionalAuthMiddleware(authService *services.AuthService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parts := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			if claims, err := authService.ValidateToken(c.Request.Context(), parts[1]); err == nil {
+				c.Set("user_id", claims.UserID)
+				c.Set("email", claims.Email)
+				c.Set("role", claims.Role)
+				c.Set("scopes", claims.Scopes)
+				c.Set("permissions", claims.Permissions)
+			}
+		}
+
+		c.Next()
+	}
+}
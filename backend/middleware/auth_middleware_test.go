@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+	"github.com/adrianmcmains/integrated-site/services"
+)
+
+// memoryTokenStore is a TokenStore with nothing revoked.
+type memoryTokenStore struct{}
+
+func (memoryTokenStore) Revoke(ctx context.Context, jti string, ttl time.Duration) error {
+	return nil
+}
+
+func (memoryTokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	return false, nil
+}
+
+// testAccessToken signs an access token for a user with the role.
+func testAccessToken(t *testing.T, role string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"user_id":     uuid.NewString(),
+		"email":       "user@example.com",
+		"role":        role,
+		"permissions": []string{},
+		"exp":         time.Now().Add(time.Hour).Unix(),
+		"jti":         uuid.NewString(),
+	})
+	signed, err := token.SignedString([]byte(viper.GetString("auth.jwt_secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// An admin route turns away requests without a token with 401 and users
+// without the admin role with 403.
+func TestAuthAndRoleMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	viper.Set("auth.jwt_secret", "test-secret")
+	t.Cleanup(func() { viper.Set("auth.jwt_secret", nil) })
+
+	authService := services.NewAuthService(nil, nil, nil, nil, memoryTokenStore{}, nil, nil)
+	router := gin.New()
+	router.GET("/admin", AuthMiddleware(authService), RoleMiddleware("admin"), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"malformed header", "Token abc", http.StatusUnauthorized},
+		{"invalid token", "Bearer not-a-jwt", http.StatusUnauthorized},
+		{"wrong role", "Bearer " + testAccessToken(t, "customer"), http.StatusForbidden},
+		{"allowed role", "Bearer " + testAccessToken(t, "admin"), http.StatusOK},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			router.ServeHTTP(w, req)
+			if w.Code != tc.want {
+				t.Errorf("status = %d, want %d", w.Code, tc.want)
+			}
+		})
+	}
+}
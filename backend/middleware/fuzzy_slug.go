@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// maxFuzzySlugLength is the longest slug compared by edit distance;
+// Postgres' levenshtein refuses longer arguments.
+const maxFuzzySlugLength = 255
+
+// FuzzySlugMiddleware answers requests for /blog/<slug> and /pages/<slug>
+// that no route serves. A stored redirect for the path is followed first.
+// Otherwise a published post or page with a slug a few typos away is looked
+// up, and if there is one a permanent redirect to it is returned. Guessed
+// redirects are not stored: the path may become a real slug later, and
+// anyone could fill the redirect table with made-up paths. The lookup scans
+// every slug, so each client IP only gets as many as limiter allows; the
+// rest, and anything else, fall through to the 404.
+func FuzzySlugMiddleware(postRepo *repositories.PostRepository, pageRepo *repositories.PageRepository, redirectRepo *repositories.RedirectRepository, limiter Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.FullPath() != "" || (c.Request.Method != http.MethodGet && c.Request.Method != http.MethodHead) {
+			c.Next()
+			return
+		}
+
+		prefix, slug, ok := splitSlugPath(c.Request.URL.Path)
+		if !ok {
+			c.Next()
+			return
+		}
+
+		ctx := c.Request.Context()
+		fromPath := prefix + slug
+
+		redirect, err := redirectRepo.GetByFromPath(ctx, fromPath)
+		if err != nil {
+			c.Error(err)
+			c.Next()
+			return
+		}
+		if redirect != nil {
+			c.Redirect(redirect.StatusCode, redirect.ToPath)
+			c.Abort()
+			return
+		}
+
+		if !limiter.Allow(IPKey(c), false).Allowed {
+			c.Next()
+			return
+		}
+
+		similar, err := findSimilarSlug(ctx, postRepo, pageRepo, prefix, strings.ToLower(slug))
+		if err != nil {
+			c.Error(err)
+			c.Next()
+			return
+		}
+		if similar == "" {
+			c.Next()
+			return
+		}
+
+		c.Redirect(http.StatusMovedPermanently, prefix+similar)
+		c.Abort()
+	}
+}
+
+// splitSlugPath splits /blog/<slug> and /pages/<slug> into prefix and slug.
+func splitSlugPath(path string) (string, string, bool) {
+	for _, prefix := range []string{"/blog/", "/pages/"} {
+		if !strings.HasPrefix(path, prefix) {
+			continue
+		}
+		slug := strings.TrimSuffix(strings.TrimPrefix(path, prefix), "/")
+		if slug == "" || strings.Contains(slug, "/") || len(slug) > maxFuzzySlugLength {
+			return "", "", false
+		}
+		return prefix, slug, true
+	}
+	return "", "", false
+}
+
+func findSimilarSlug(ctx context.Context, postRepo *repositories.PostRepository, pageRepo *repositories.PageRepository, prefix, slug string) (string, error) {
+	if prefix == "/blog/" {
+		post, err := postRepo.FindSimilarSlug(ctx, slug)
+		if err != nil || post == nil {
+			return "", err
+		}
+		return post.Slug, nil
+	}
+
+	page, err := pageRepo.FindSimilarSlug(ctx, slug)
+	if err != nil || page == nil {
+		return "", err
+	}
+	return page.Slug, nil
+}
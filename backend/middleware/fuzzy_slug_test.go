@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+func TestSplitSlugPath(t *testing.T) {
+	tests := []struct {
+		path, prefix, slug string
+		ok                 bool
+	}{
+		{"/blog/postgres-tips", "/blog/", "postgres-tips", true},
+		{"/blog/postgres-tips/", "/blog/", "postgres-tips", true},
+		{"/pages/about", "/pages/", "about", true},
+		{"/blog/", "", "", false},
+		{"/blog/2024/tips", "", "", false},
+		{"/shop/mug", "", "", false},
+		{"/blog/" + strings.Repeat("a", maxFuzzySlugLength+1), "", "", false},
+	}
+	for _, tt := range tests {
+		prefix, slug, ok := splitSlugPath(tt.path)
+		if prefix != tt.prefix || slug != tt.slug || ok != tt.ok {
+			t.Errorf("splitSlugPath(%q) = %q, %q, %v; want %q, %q, %v", tt.path, prefix, slug, ok, tt.prefix, tt.slug, tt.ok)
+		}
+	}
+}
+
+// A mistyped post slug gets a 301 to the post; a slug nothing resembles,
+// and lookups beyond the client's limit, stay a 404.
+func TestFuzzySlugRedirectsToSimilarPost(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+
+	var userID, authorID uuid.UUID
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {auth}.users (email, password_hash, full_name, role)
+		VALUES ($1, 'x', 'Test Author', 'contributor')
+		RETURNING id
+	`), dbtest.UniqueName("fuzzy")+"@example.com").Scan(&userID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.users WHERE id = $1"), userID)
+	})
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.authors (user_id) VALUES ($1) RETURNING id
+	`), userID).Scan(&authorID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.posts WHERE author_id = $1"), authorID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.authors WHERE id = $1"), authorID)
+	})
+	suffix := uuid.NewString()[:8]
+	slug := "postgres-tips-" + suffix
+	dbtest.Exec(t, pool, database.Qualify(`
+		INSERT INTO {blog}.posts (title, slug, content, author_id, status, published_at)
+		VALUES ('Postgres tips', $1, 'Content', $2, 'published', NOW())
+	`), slug, authorID)
+
+	redirects := repositories.NewRedirectRepository(pool)
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(FuzzySlugMiddleware(
+		repositories.NewPostRepository(pool, nil, redirects),
+		repositories.NewPageRepository(pool, nil, redirects),
+		redirects,
+		NewRateLimiter(0, 2, time.Minute),
+	))
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w
+	}
+
+	w := get("/blog/postgress-tips-" + suffix)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/blog/"+slug {
+		t.Errorf("mistyped slug = %d to %q, want 301 to /blog/%s", w.Code, w.Header().Get("Location"), slug)
+	}
+	if redirect, err := redirects.GetByFromPath(ctx, "/blog/postgress-tips-"+suffix); err != nil || redirect != nil {
+		t.Errorf("guessed redirect stored: %v, %v", redirect, err)
+	}
+
+	if w := get("/blog/" + uuid.NewString()); w.Code != http.StatusNotFound {
+		t.Errorf("unrelated slug = %d, want 404", w.Code)
+	}
+
+	// The limit of two lookups is used up
+	if w := get("/blog/postgress-tips-" + suffix); w.Code != http.StatusNotFound {
+		t.Errorf("lookup beyond the limit = %d, want 404", w.Code)
+	}
+}
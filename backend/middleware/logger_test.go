@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestGinZapLoggerSampling(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zapcore.DebugLevel)
+	router := gin.New()
+	router.Use(GinZapLogger(zap.New(core), LoggerConfig{SampleRate: 0.1}))
+	router.GET("/:status", func(c *gin.Context) {
+		status, _ := strconv.Atoi(c.Param("status"))
+		c.Status(status)
+	})
+
+	send := func(status, n int) {
+		for i := 0; i < n; i++ {
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/"+strconv.Itoa(status), nil))
+		}
+	}
+
+	// About a tenth of the successes are logged, at debug level. The bounds
+	// are more than five standard deviations from the expected 100.
+	send(http.StatusOK, 1000)
+	ok := logs.FilterLevelExact(zapcore.DebugLevel).Len()
+	if ok < 50 || ok > 150 {
+		t.Errorf("%d of 1000 successful requests logged, want about 100", ok)
+	}
+	if logs.Len() != ok {
+		t.Errorf("successful requests were logged above debug level")
+	}
+
+	logs.TakeAll()
+	send(http.StatusNotFound, 100)
+	send(http.StatusInternalServerError, 100)
+	if got := logs.FilterLevelExact(zapcore.WarnLevel).Len(); got != 100 {
+		t.Errorf("%d of 100 client errors logged at warn, want all", got)
+	}
+	if got := logs.FilterLevelExact(zapcore.ErrorLevel).Len(); got != 100 {
+		t.Errorf("%d of 100 server errors logged at error, want all", got)
+	}
+}
+
+func TestGinZapLoggerFullSampleRateLogsEverything(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	core, logs := observer.New(zapcore.DebugLevel)
+	router := gin.New()
+	router.Use(GinZapLogger(zap.New(core), LoggerConfig{SampleRate: 1}))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	for i := 0; i < 100; i++ {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	}
+	if logs.Len() != 100 {
+		t.Errorf("%d of 100 requests logged, want all", logs.Len())
+	}
+}
@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// KeyFunc names the client a request is counted against.
+type KeyFunc func(c *gin.Context) string
+
+// UserOrIPKey counts authenticated requests against the user and anonymous
+// ones against the client IP. The user is only known to middleware that
+// runs after the auth middleware.
+func UserOrIPKey(c *gin.Context) string {
+	if userID, ok := c.Get("user_id"); ok {
+		return fmt.Sprintf("user:%v", userID)
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// UserKey counts authenticated requests against the user and leaves
+// anonymous ones unlimited. Like UserOrIPKey it must run after the auth
+// middleware.
+func UserKey(c *gin.Context) string {
+	if userID, ok := c.Get("user_id"); ok {
+		return fmt.Sprintf("user:%v", userID)
+	}
+	return ""
+}
+
+// IPKey counts every request against the client IP.
+func IPKey(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+// ExemptRoutes wraps keyFunc so that requests to the given routes, such as
+// payment provider webhooks, get an empty key and are not limited. Routes
+// are matched as registered, e.g. "/api/payment/stripe/webhook".
+func ExemptRoutes(keyFunc KeyFunc, routes ...string) KeyFunc {
+	exempt := map[string]bool{}
+	for _, route := range routes {
+		exempt[route] = true
+	}
+	return func(c *gin.Context) string {
+		if exempt[c.FullPath()] {
+			return ""
+		}
+		return keyFunc(c)
+	}
+}
+
+// Limiter decides whether a client may make another request.
+type Limiter interface {
+	// Allow counts a request against key, held to the authenticated or the
+	// anonymous limit.
+	Allow(key string, authenticated bool) RateLimitResult
+}
+
+// RateLimitResult is a Limiter's decision on one request. Limit is 0 when
+// the client is not limited; RetryAfter is set when the request is refused.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// RateLimiter counts requests per key over a sliding window. Authenticated
+// clients get their own, usually higher, limit. Counts are kept in memory,
+// so each instance of the server limits on its own.
+type RateLimiter struct {
+	authenticated int
+	anonymous     int
+	window        time.Duration
+	now           func() time.Time
+
+	mu        sync.Mutex
+	counters  map[string]*rateCounter
+	lastSweep time.Time
+}
+
+// rateCounter holds the request counts of the current fixed window and the
+// one before it. The sliding window count weighs the previous window by how
+// much of it still overlaps the sliding window.
+type rateCounter struct {
+	windowStart time.Time
+	current     int
+	previous    int
+}
+
+func NewRateLimiter(authenticated, anonymous int, window time.Duration) *RateLimiter {
+	return &RateLimiter{
+		authenticated: authenticated,
+		anonymous:     anonymous,
+		window:        window,
+		now:           time.Now,
+		counters:      map[string]*rateCounter{},
+	}
+}
+
+// Allow counts a request against key if it is within the authenticated or
+// anonymous limit. A limit of 0 turns limiting off.
+func (l *RateLimiter) Allow(key string, authenticated bool) RateLimitResult {
+	limit := l.anonymous
+	if authenticated {
+		limit = l.authenticated
+	}
+	if limit <= 0 {
+		return RateLimitResult{Allowed: true}
+	}
+
+	allowed, remaining, retryAfter := l.allow(key, limit)
+	return RateLimitResult{Allowed: allowed, Limit: limit, Remaining: remaining, RetryAfter: retryAfter}
+}
+
+// allow counts a request against key if it is within limit, and returns
+// whether it was allowed, how many requests remain and, when refused, how
+// long until the next one would be allowed.
+func (l *RateLimiter) allow(key string, limit int) (bool, int, time.Duration) {
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	counter, ok := l.counters[key]
+	if !ok {
+		counter = &rateCounter{windowStart: now.Truncate(l.window)}
+		l.counters[key] = counter
+	}
+	counter.advance(now, l.window)
+
+	elapsed := now.Sub(counter.windowStart)
+	overlap := 1 - float64(elapsed)/float64(l.window)
+	count := float64(counter.previous)*overlap + float64(counter.current)
+
+	if count+1 > float64(limit) {
+		// The weighted previous count drops as the window slides; wait until
+		// it has dropped enough, or until the next window if the current
+		// one alone is full
+		retryAfter := counter.windowStart.Add(l.window).Sub(now)
+		if counter.previous > 0 && float64(counter.current)+1 <= float64(limit) {
+			excess := count + 1 - float64(limit)
+			retryAfter = time.Duration(excess / float64(counter.previous) * float64(l.window))
+		}
+		return false, 0, retryAfter
+	}
+
+	counter.current++
+	return true, int(math.Floor(float64(limit) - count - 1)), 0
+}
+
+// advance moves the counter to the fixed window containing now.
+func (c *rateCounter) advance(now time.Time, window time.Duration) {
+	start := now.Truncate(window)
+	switch {
+	case start.Equal(c.windowStart):
+	case start.Sub(c.windowStart) == window:
+		c.previous, c.current = c.current, 0
+		c.windowStart = start
+	default:
+		c.previous, c.current = 0, 0
+		c.windowStart = start
+	}
+}
+
+// sweep drops the counters of clients that have been idle for two windows,
+// at most once per window.
+func (l *RateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+
+	for key, counter := range l.counters {
+		if now.Sub(counter.windowStart) >= 2*l.window {
+			delete(l.counters, key)
+		}
+	}
+}
+
+// RateLimitMiddleware rejects requests over the limiter's limit with 429
+// and a Retry-After header, counting them against the key keyFunc returns.
+// Requests with a user in the context are held to the authenticated limit,
+// the others to the anonymous one. Requests with an empty key are not
+// limited.
+func RateLimitMiddleware(limiter Limiter, keyFunc KeyFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := keyFunc(c)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		_, authenticated := c.Get("user_id")
+		result := limiter.Allow(key, authenticated)
+		if result.Limit > 0 {
+			c.Header("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+			c.Header("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		}
+
+		if !result.Allowed {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(result.RetryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{"error": "Too many requests, try again later"})
+			return
+		}
+
+		c.Next()
+	}
+}
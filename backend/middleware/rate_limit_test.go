@@ -0,0 +1,163 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRateLimiterSlidingWindow(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(10, 3, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	for want := 2; want >= 0; want-- {
+		result := limiter.Allow("ip:1", false)
+		if !result.Allowed || result.Limit != 3 || result.Remaining != want {
+			t.Fatalf("Allow = %+v, want allowed with %d remaining", result, want)
+		}
+	}
+	if result := limiter.Allow("ip:1", false); result.Allowed || result.RetryAfter != time.Minute {
+		t.Errorf("over the limit: Allow = %+v, want refused for a minute", result)
+	}
+	if result := limiter.Allow("ip:2", false); !result.Allowed {
+		t.Error("another client was refused")
+	}
+	if result := limiter.Allow("user:1", true); !result.Allowed || result.Limit != 10 {
+		t.Errorf("authenticated: Allow = %+v, want allowed at the authenticated limit", result)
+	}
+
+	// Halfway through the next window the previous one counts for half
+	now = now.Add(90 * time.Second)
+	if result := limiter.Allow("ip:1", false); !result.Allowed || result.Remaining != 0 {
+		t.Errorf("half a window later: Allow = %+v, want allowed with 0 remaining", result)
+	}
+	if result := limiter.Allow("ip:1", false); result.Allowed || result.RetryAfter != 10*time.Second {
+		t.Errorf("half a window later: Allow = %+v, want refused for 10s", result)
+	}
+
+	// After two idle windows the client starts over
+	now = now.Add(2 * time.Minute)
+	if result := limiter.Allow("ip:1", false); !result.Allowed || result.Remaining != 2 {
+		t.Errorf("two windows later: Allow = %+v, want allowed with 2 remaining", result)
+	}
+}
+
+func TestRateLimiterZeroLimitIsUnlimited(t *testing.T) {
+	limiter := NewRateLimiter(0, 1, time.Minute)
+	for i := 0; i < 5; i++ {
+		if result := limiter.Allow("user:1", true); !result.Allowed || result.Limit != 0 {
+			t.Fatalf("Allow = %+v, want allowed without a limit", result)
+		}
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiter(5, 1, time.Minute)
+	router := gin.New()
+	router.Use(RateLimitMiddleware(limiter, IPKey))
+	router.GET("/", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func() *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get()
+	if w.Code != http.StatusOK {
+		t.Fatalf("first request: status = %d, want 200", w.Code)
+	}
+	if w.Header().Get("X-RateLimit-Limit") != "1" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("headers = %v, want a limit of 1 with 0 remaining", w.Header())
+	}
+
+	w = get()
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("second request: status = %d, want 429", w.Code)
+	}
+	if w.Header().Get("Retry-After") == "" {
+		t.Error("429 without Retry-After")
+	}
+}
+
+func TestExemptRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiter(1, 1, time.Minute)
+	router := gin.New()
+	router.Use(RateLimitMiddleware(limiter, ExemptRoutes(IPKey, "/webhooks/:provider")))
+	router.POST("/webhooks/:provider", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.POST("/orders", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	post := func(path string) int {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodPost, path, nil))
+		return w.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := post("/webhooks/stripe"); code != http.StatusOK {
+			t.Fatalf("exempt route: request %d got %d, want 200", i+1, code)
+		}
+	}
+	if code := post("/orders"); code != http.StatusOK {
+		t.Fatalf("limited route: first request got %d, want 200", code)
+	}
+	if code := post("/orders"); code != http.StatusTooManyRequests {
+		t.Errorf("limited route: second request got %d, want 429", code)
+	}
+}
+
+// A client is counted by IP until the auth middleware has named the user,
+// after which the user has a count of their own at the higher limit.
+func TestUserOrIPKeySwitchesAfterAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	limiter := NewRateLimiter(2, 1, time.Minute)
+	signedIn := func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" {
+			c.Set("user_id", "7d0c3b52-6f1e-4c55-9a44-0f6f3c2b8e11")
+		}
+	}
+	router := gin.New()
+	router.GET("/", signedIn, RateLimitMiddleware(limiter, UserOrIPKey), func(c *gin.Context) {
+		c.String(http.StatusOK, UserOrIPKey(c))
+	})
+
+	get := func(authorized bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "203.0.113.7:1234"
+		if authorized {
+			req.Header.Set("Authorization", "Bearer token")
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get(false); w.Code != http.StatusOK || w.Body.String() != "ip:203.0.113.7" {
+		t.Fatalf("anonymous request = %d keyed %q, want 200 keyed by IP", w.Code, w.Body)
+	}
+	if w := get(false); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second anonymous request = %d, want 429", w.Code)
+	}
+
+	// The same IP signed in is a different client with its own limit
+	for i := 0; i < 2; i++ {
+		w := get(true)
+		if w.Code != http.StatusOK || w.Body.String() != "user:7d0c3b52-6f1e-4c55-9a44-0f6f3c2b8e11" {
+			t.Fatalf("authenticated request %d = %d keyed %q, want 200 keyed by user", i+1, w.Code, w.Body)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Errorf("authenticated X-RateLimit-Limit = %q, want 2", got)
+		}
+	}
+	if w := get(true); w.Code != http.StatusTooManyRequests {
+		t.Errorf("third authenticated request = %d, want 429", w.Code)
+	}
+}
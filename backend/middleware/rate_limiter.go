@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/time/rate"
+)
+
+// tokenBucketIdleTimeout is how long a client's bucket is kept after its
+// last request, and how often idle buckets are looked for.
+const tokenBucketIdleTimeout = 5 * time.Minute
+
+// TokenBucketRate allows RPS requests per second on average, in bursts of up
+// to Burst. An RPS of 0 turns limiting off.
+type TokenBucketRate struct {
+	RPS   float64
+	Burst int
+}
+
+// TokenBucketLimiter holds a token bucket per client, smoothing out short
+// bursts where RateLimiter caps totals over a longer window. A client
+// unseen for tokenBucketIdleTimeout starts over with a full bucket.
+type TokenBucketLimiter struct {
+	authenticated TokenBucketRate
+	anonymous     TokenBucketRate
+	now           func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func NewTokenBucketLimiter(authenticated, anonymous TokenBucketRate) *TokenBucketLimiter {
+	return &TokenBucketLimiter{
+		authenticated: authenticated,
+		anonymous:     anonymous,
+		now:           time.Now,
+		buckets:       map[string]*tokenBucket{},
+	}
+}
+
+// NewIPRateLimiter allows each client IP rps requests per second, in bursts
+// of up to burst, answering the rest with 429 and a Retry-After header.
+// Requests to exemptRoutes are not limited. It needs no auth middleware, so
+// it can run for every route.
+func NewIPRateLimiter(rps rate.Limit, burst int, exemptRoutes ...string) gin.HandlerFunc {
+	limiter := NewTokenBucketLimiter(
+		TokenBucketRate{RPS: float64(rps), Burst: burst},
+		TokenBucketRate{RPS: float64(rps), Burst: burst},
+	)
+	return RateLimitMiddleware(limiter, ExemptRoutes(IPKey, exemptRoutes...))
+}
+
+// NewUserRateLimiter allows each signed-in user rps requests per second, in
+// bursts of up to burst, and leaves anonymous requests alone. It must run
+// after the auth middleware.
+func NewUserRateLimiter(rps rate.Limit, burst int) gin.HandlerFunc {
+	limiter := NewTokenBucketLimiter(TokenBucketRate{RPS: float64(rps), Burst: burst}, TokenBucketRate{})
+	return RateLimitMiddleware(limiter, UserKey)
+}
+
+// Allow takes a token from key's bucket. A request that would have to wait
+// for one is refused and its token handed back. Remaining is the number of
+// whole tokens left.
+func (l *TokenBucketLimiter) Allow(key string, authenticated bool) RateLimitResult {
+	bucketRate := l.anonymous
+	if authenticated {
+		bucketRate = l.authenticated
+	}
+	if bucketRate.RPS <= 0 {
+		return RateLimitResult{Allowed: true}
+	}
+
+	now := l.now()
+	limiter := l.bucket(key, bucketRate, now)
+	result := RateLimitResult{Limit: bucketRate.Burst}
+
+	reservation := limiter.ReserveN(now, 1)
+	if !reservation.OK() {
+		// A burst of 0 never admits a request; wait for a token's worth
+		result.RetryAfter = time.Duration(float64(time.Second) / bucketRate.RPS)
+		return result
+	}
+	if delay := reservation.DelayFrom(now); delay > 0 {
+		reservation.CancelAt(now)
+		result.RetryAfter = delay
+		return result
+	}
+
+	result.Allowed = true
+	result.Remaining = int(limiter.TokensAt(now))
+	return result
+}
+
+// bucket returns key's bucket, creating a full one at bucketRate if the
+// client has none.
+func (l *TokenBucketLimiter) bucket(key string, bucketRate TokenBucketRate, now time.Time) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{limiter: rate.NewLimiter(rate.Limit(bucketRate.RPS), bucketRate.Burst)}
+		l.buckets[key] = bucket
+	}
+	bucket.lastSeen = now
+	return bucket.limiter
+}
+
+// sweep drops the buckets of clients idle for tokenBucketIdleTimeout, at
+// most once per tokenBucketIdleTimeout.
+func (l *TokenBucketLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < tokenBucketIdleTimeout {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) >= tokenBucketIdleTimeout {
+			delete(l.buckets, key)
+		}
+	}
+}
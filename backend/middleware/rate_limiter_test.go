@@ -0,0 +1,110 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+func TestTokenBucketLimiter(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewTokenBucketLimiter(TokenBucketRate{RPS: 10, Burst: 20}, TokenBucketRate{RPS: 2, Burst: 2})
+	limiter.now = func() time.Time { return now }
+
+	for want := 1; want >= 0; want-- {
+		result := limiter.Allow("ip:1", false)
+		if !result.Allowed || result.Limit != 2 || result.Remaining != want {
+			t.Fatalf("Allow = %+v, want allowed with %d remaining", result, want)
+		}
+	}
+	result := limiter.Allow("ip:1", false)
+	if result.Allowed || result.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("empty bucket: Allow = %+v, want refused for 500ms", result)
+	}
+
+	// The refused request's token was handed back, so one token is back
+	// after half a second
+	now = now.Add(500 * time.Millisecond)
+	if result := limiter.Allow("ip:1", false); !result.Allowed {
+		t.Errorf("after refilling: Allow = %+v, want allowed", result)
+	}
+	if result := limiter.Allow("ip:1", false); result.Allowed {
+		t.Error("a second request was allowed on one refilled token")
+	}
+
+	if result := limiter.Allow("user:1", true); !result.Allowed || result.Remaining != 19 {
+		t.Errorf("authenticated: Allow = %+v, want allowed from a bucket of 20", result)
+	}
+
+	// An idle client starts over with a full bucket
+	now = now.Add(tokenBucketIdleTimeout)
+	limiter.Allow("ip:2", false)
+	if _, ok := limiter.buckets["ip:1"]; ok {
+		t.Error("an idle client's bucket was kept")
+	}
+}
+
+func TestTokenBucketLimiterZeroRateIsUnlimited(t *testing.T) {
+	limiter := NewTokenBucketLimiter(TokenBucketRate{}, TokenBucketRate{RPS: 1, Burst: 1})
+	for i := 0; i < 5; i++ {
+		if result := limiter.Allow("user:1", true); !result.Allowed || result.Limit != 0 {
+			t.Fatalf("Allow = %+v, want allowed without a limit", result)
+		}
+	}
+}
+
+// The IP limiter counts every request by IP, and the user limiter counts
+// only signed-in users, each by user.
+func TestIPAndUserRateLimiters(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	userID := uuid.New()
+	router := gin.New()
+	router.Use(NewIPRateLimiter(1, 1, "/webhooks/stripe"))
+	router.GET("/webhooks/stripe", func(c *gin.Context) { c.Status(http.StatusOK) })
+	router.GET("/posts", func(c *gin.Context) { c.Status(http.StatusOK) })
+	users := router.Group("/orders", func(c *gin.Context) {
+		if c.GetHeader("Authorization") != "" {
+			c.Set("user_id", userID)
+		}
+	}, NewUserRateLimiter(1, 1))
+	users.GET("", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	get := func(path, ip string, signedIn bool) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.RemoteAddr = ip + ":1234"
+		if signedIn {
+			req.Header.Set("Authorization", "Bearer token")
+		}
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := get("/posts", "203.0.113.1", false); w.Code != http.StatusOK {
+		t.Fatalf("first request from an IP: status = %d, want 200", w.Code)
+	}
+	w := get("/posts", "203.0.113.1", false)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("second request from an IP: status = %d, Retry-After %q; want 429 with Retry-After", w.Code, w.Header().Get("Retry-After"))
+	}
+	for i := 0; i < 3; i++ {
+		if w := get("/webhooks/stripe", "203.0.113.1", false); w.Code != http.StatusOK {
+			t.Fatalf("exempt route: request %d got %d, want 200", i+1, w.Code)
+		}
+	}
+
+	// Each request comes from a new IP, so only the user limiter can refuse it
+	if w := get("/orders", "203.0.113.2", false); w.Code != http.StatusOK {
+		t.Errorf("anonymous request: status = %d, want 200", w.Code)
+	}
+	if w := get("/orders", "203.0.113.3", true); w.Code != http.StatusOK {
+		t.Fatalf("first request by a user: status = %d, want 200", w.Code)
+	}
+	if w := get("/orders", "203.0.113.4", true); w.Code != http.StatusTooManyRequests {
+		t.Errorf("second request by a user: status = %d, want 429", w.Code)
+	}
+}
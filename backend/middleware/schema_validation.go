@@ -0,0 +1,366 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/mail"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// SchemaError locates a value that does not match the schema. Path is a
+// JSONPath such as $.items[0].quantity.
+type SchemaError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// SchemaValidationMiddleware validates JSON request bodies against the JSON
+// Schema in schemaPath, which is loaded once, when the router is built. An
+// invalid body is rejected with 422 and the path of every problem found;
+// a valid one is passed on unchanged.
+//
+// Only the keywords listed on jsonSchema are supported. A schema using any
+// other keyword fails to load rather than being half enforced.
+func SchemaValidationMiddleware(schemaPath string) gin.HandlerFunc {
+	schema, err := loadJSONSchema(schemaPath)
+	if err != nil {
+		panic(fmt.Sprintf("loading JSON schema %s: %v", schemaPath, err))
+	}
+
+	return func(c *gin.Context) {
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid request body"})
+			return
+		}
+		// Handlers read the body again
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		var value interface{}
+		if err := decoder.Decode(&value); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON body"})
+			return
+		}
+
+		if errs := schema.validate("$", value, nil); len(errs) > 0 {
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"errors": errs})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// jsonSchema is the subset of JSON Schema the request schemas use.
+type jsonSchema struct {
+	Schema      string `json:"$schema"`
+	ID          string `json:"$id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+
+	Type                 schemaTypes            `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	Enum                 []interface{}          `json:"enum"`
+	Minimum              *float64               `json:"minimum"`
+	ExclusiveMinimum     *float64               `json:"exclusiveMinimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinLength            *int                   `json:"minLength"`
+	MaxLength            *int                   `json:"maxLength"`
+	MinItems             *int                   `json:"minItems"`
+	MaxItems             *int                   `json:"maxItems"`
+	Pattern              string                 `json:"pattern"`
+	Format               string                 `json:"format"`
+
+	pattern *regexp.Regexp
+}
+
+// schemaTypes holds the "type" keyword, which is a name or a list of names.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = schemaTypes{name}
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return err
+	}
+	*t = names
+	return nil
+}
+
+var schemaTypeNames = map[string]bool{
+	"object": true, "array": true, "string": true, "integer": true,
+	"number": true, "boolean": true, "null": true,
+}
+
+var schemaFormats = map[string]bool{"uuid": true, "email": true}
+
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+func loadJSONSchema(path string) (*jsonSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	decoder.UseNumber()
+	var schema jsonSchema
+	if err := decoder.Decode(&schema); err != nil {
+		return nil, err
+	}
+	if err := schema.compile("$"); err != nil {
+		return nil, err
+	}
+
+	return &schema, nil
+}
+
+// compile checks the schema's keywords and prepares its patterns.
+func (s *jsonSchema) compile(path string) error {
+	for _, name := range s.Type {
+		if !schemaTypeNames[name] {
+			return fmt.Errorf("%s: unknown type %q", path, name)
+		}
+	}
+	if s.Format != "" && !schemaFormats[s.Format] {
+		return fmt.Errorf("%s: unsupported format %q", path, s.Format)
+	}
+	if s.Pattern != "" {
+		pattern, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		s.pattern = pattern
+	}
+
+	for name, property := range s.Properties {
+		if err := property.compile(childPath(path, name)); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.compile(path + "[*]"); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validate appends the problems with value to errs and returns them.
+func (s *jsonSchema) validate(path string, value interface{}, errs []SchemaError) []SchemaError {
+	if len(s.Type) > 0 && !s.matchesType(value) {
+		return append(errs, SchemaError{Path: path, Message: "must be " + describeTypes(s.Type)})
+	}
+
+	if len(s.Enum) > 0 && !inEnum(value, s.Enum) {
+		options := make([]string, len(s.Enum))
+		for i, option := range s.Enum {
+			encoded, _ := json.Marshal(option)
+			options[i] = string(encoded)
+		}
+		errs = append(errs, SchemaError{Path: path, Message: "must be one of " + strings.Join(options, ", ")})
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		errs = s.validateObject(path, v, errs)
+	case []interface{}:
+		errs = s.validateArray(path, v, errs)
+	case string:
+		errs = s.validateString(path, v, errs)
+	case json.Number:
+		errs = s.validateNumber(path, v, errs)
+	}
+
+	return errs
+}
+
+func (s *jsonSchema) validateObject(path string, object map[string]interface{}, errs []SchemaError) []SchemaError {
+	for _, name := range s.Required {
+		if _, ok := object[name]; !ok {
+			errs = append(errs, SchemaError{Path: childPath(path, name), Message: "is required"})
+		}
+	}
+
+	// Sorted so the errors come out in a stable order
+	names := make([]string, 0, len(object))
+	for name := range object {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		property, ok := s.Properties[name]
+		if !ok {
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				errs = append(errs, SchemaError{Path: childPath(path, name), Message: "is not allowed"})
+			}
+			continue
+		}
+		errs = property.validate(childPath(path, name), object[name], errs)
+	}
+
+	return errs
+}
+
+func (s *jsonSchema) validateArray(path string, array []interface{}, errs []SchemaError) []SchemaError {
+	if s.MinItems != nil && len(array) < *s.MinItems {
+		errs = append(errs, SchemaError{Path: path, Message: fmt.Sprintf("must have at least %d items", *s.MinItems)})
+	}
+	if s.MaxItems != nil && len(array) > *s.MaxItems {
+		errs = append(errs, SchemaError{Path: path, Message: fmt.Sprintf("must have at most %d items", *s.MaxItems)})
+	}
+
+	if s.Items != nil {
+		for i, item := range array {
+			errs = s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item, errs)
+		}
+	}
+
+	return errs
+}
+
+func (s *jsonSchema) validateString(path, str string, errs []SchemaError) []SchemaError {
+	length := utf8.RuneCountInString(str)
+	if s.MinLength != nil && length < *s.MinLength {
+		errs = append(errs, SchemaError{Path: path, Message: fmt.Sprintf("must be at least %d characters long", *s.MinLength)})
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		errs = append(errs, SchemaError{Path: path, Message: fmt.Sprintf("must be at most %d characters long", *s.MaxLength)})
+	}
+	if s.pattern != nil && !s.pattern.MatchString(str) {
+		errs = append(errs, SchemaError{Path: path, Message: "must match the pattern " + s.Pattern})
+	}
+
+	switch s.Format {
+	case "uuid":
+		if _, err := uuid.Parse(str); err != nil {
+			errs = append(errs, SchemaError{Path: path, Message: "must be a UUID"})
+		}
+	case "email":
+		if _, err := mail.ParseAddress(str); err != nil {
+			errs = append(errs, SchemaError{Path: path, Message: "must be an email address"})
+		}
+	}
+
+	return errs
+}
+
+func (s *jsonSchema) validateNumber(path string, number json.Number, errs []SchemaError) []SchemaError {
+	n, err := number.Float64()
+	if err != nil {
+		return append(errs, SchemaError{Path: path, Message: "must be a number"})
+	}
+
+	if s.Minimum != nil && n < *s.Minimum {
+		errs = append(errs, SchemaError{Path: path, Message: "must be at least " + formatSchemaNumber(*s.Minimum)})
+	}
+	if s.ExclusiveMinimum != nil && n <= *s.ExclusiveMinimum {
+		errs = append(errs, SchemaError{Path: path, Message: "must be greater than " + formatSchemaNumber(*s.ExclusiveMinimum)})
+	}
+	if s.Maximum != nil && n > *s.Maximum {
+		errs = append(errs, SchemaError{Path: path, Message: "must be at most " + formatSchemaNumber(*s.Maximum)})
+	}
+
+	return errs
+}
+
+func (s *jsonSchema) matchesType(value interface{}) bool {
+	for _, name := range s.Type {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			if name == "object" {
+				return true
+			}
+		case []interface{}:
+			if name == "array" {
+				return true
+			}
+		case string:
+			if name == "string" {
+				return true
+			}
+		case bool:
+			if name == "boolean" {
+				return true
+			}
+		case nil:
+			if name == "null" {
+				return true
+			}
+		case json.Number:
+			if name == "number" {
+				return true
+			}
+			if name == "integer" {
+				n, err := v.Float64()
+				if err == nil && n == math.Trunc(n) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func inEnum(value interface{}, enum []interface{}) bool {
+	for _, option := range enum {
+		// Both sides were decoded with UseNumber, so numbers compare as text
+		if reflect.DeepEqual(value, option) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeTypes phrases a type list for an error message, e.g. "an integer"
+// or "a string or null".
+func describeTypes(types schemaTypes) string {
+	described := make([]string, len(types))
+	for i, name := range types {
+		switch name {
+		case "null":
+			described[i] = "null"
+		case "object", "array", "integer":
+			described[i] = "an " + name
+		default:
+			described[i] = "a " + name
+		}
+	}
+	return strings.Join(described, " or ")
+}
+
+func childPath(path, name string) string {
+	if identifierPattern.MatchString(name) {
+		return path + "." + name
+	}
+	return path + "[" + strconv.Quote(name) + "]"
+}
+
+func formatSchemaNumber(n float64) string {
+	return strconv.FormatFloat(n, 'f', -1, 64)
+}
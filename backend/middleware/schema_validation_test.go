@@ -0,0 +1,171 @@
+package middleware
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newSchemaTestRouter(t *testing.T, schemaPath string) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.POST("/", SchemaValidationMiddleware(schemaPath), func(c *gin.Context) {
+		// The handler must still be able to read the body
+		body, _ := io.ReadAll(c.Request.Body)
+		c.Data(http.StatusOK, "application/json", body)
+	})
+	return router
+}
+
+func postSchemaBody(router *gin.Engine, body string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestSchemaValidationMiddleware(t *testing.T) {
+	router := newSchemaTestRouter(t, "../schemas/create_order.json")
+
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantErrors []SchemaError
+	}{
+		{
+			name:       "valid order",
+			body:       `{"shipping_address":{"line1":"1 Main St","city":"Springfield","postal_code":"12345","country":"US"},"payment_method":"card"}`,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "missing required fields",
+			body:       `{"shipping_address":{"line1":"1 Main St","city":"Springfield","country":"US"}}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: []SchemaError{
+				{Path: "$.payment_method", Message: "is required"},
+				{Path: "$.shipping_address.postal_code", Message: "is required"},
+			},
+		},
+		{
+			name:       "nested values of the wrong type and shape",
+			body:       `{"shipping_address":{"line1":"","city":"Springfield","postal_code":12345,"country":"usa"},"payment_method":"card","coupon":"X"}`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: []SchemaError{
+				{Path: "$.coupon", Message: "is not allowed"},
+				{Path: "$.shipping_address.country", Message: "must match the pattern ^[A-Z]{2}$"},
+				{Path: "$.shipping_address.line1", Message: "must be at least 1 characters long"},
+				{Path: "$.shipping_address.postal_code", Message: "must be a string"},
+			},
+		},
+		{
+			name:       "not an object",
+			body:       `[]`,
+			wantStatus: http.StatusUnprocessableEntity,
+			wantErrors: []SchemaError{{Path: "$", Message: "must be an object"}},
+		},
+		{
+			name:       "malformed JSON",
+			body:       `{"payment_method":`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := postSchemaBody(router, tt.body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", w.Code, tt.wantStatus, w.Body)
+			}
+
+			switch tt.wantStatus {
+			case http.StatusOK:
+				if w.Body.String() != tt.body {
+					t.Errorf("handler read %s, want the original body", w.Body)
+				}
+			case http.StatusUnprocessableEntity:
+				var resp struct {
+					Errors []SchemaError `json:"errors"`
+				}
+				if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(resp.Errors, tt.wantErrors) {
+					t.Errorf("errors = %+v, want %+v", resp.Errors, tt.wantErrors)
+				}
+			}
+		})
+	}
+}
+
+func TestSchemaValidationMiddlewareArrayPaths(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.json")
+	schema := `{
+		"type": "object",
+		"properties": {
+			"items": {
+				"type": "array",
+				"minItems": 1,
+				"items": {
+					"type": "object",
+					"required": ["product_id", "quantity"],
+					"properties": {
+						"product_id": {"type": "string", "format": "uuid"},
+						"quantity": {"type": "integer", "minimum": 1}
+					}
+				}
+			}
+		}
+	}`
+	if err := os.WriteFile(path, []byte(schema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	router := newSchemaTestRouter(t, path)
+
+	w := postSchemaBody(router, `{"items":[{"product_id":"6f1c1a52-3c1e-4a53-9d8b-7a5bb0e2a111","quantity":2},{"product_id":"nope","quantity":1.5}]}`)
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("status = %d, want 422", w.Code)
+	}
+	var resp struct {
+		Errors []SchemaError `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	want := []SchemaError{
+		{Path: "$.items[1].product_id", Message: "must be a UUID"},
+		{Path: "$.items[1].quantity", Message: "must be an integer"},
+	}
+	if !reflect.DeepEqual(resp.Errors, want) {
+		t.Errorf("errors = %+v, want %+v", resp.Errors, want)
+	}
+
+	if w := postSchemaBody(router, `{"items":[]}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("empty items: status = %d, want 422", w.Code)
+	}
+}
+
+func TestSchemaValidationMiddlewareRejectsUnsupportedKeywords(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "oneof.json")
+	if err := os.WriteFile(path, []byte(`{"oneOf": [{"type": "string"}, {"type": "integer"}]}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("a schema using oneOf loaded without error")
+		}
+	}()
+	SchemaValidationMiddleware(path)
+}
@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TaxDisplay decides whether prices should be shown with tax included, based
+// on the visitor's country as reported by the edge proxy in countryHeader.
+// The choice is stored as "tax_display" in the context and echoed in the
+// X-Tax-Display response header.
+func TaxDisplay(countryHeader string, inclusiveCountries []string) gin.HandlerFunc {
+	inclusive := make(map[string]bool, len(inclusiveCountries))
+	for _, country := range inclusiveCountries {
+		inclusive[strings.ToUpper(country)] = true
+	}
+
+	return func(c *gin.Context) {
+		display := "exclusive"
+		if inclusive[strings.ToUpper(c.GetHeader(countryHeader))] {
+			display = "inclusive"
+		}
+
+		c.Set("tax_display", display)
+		c.Header("X-Tax-Display", display)
+
+		c.Next()
+	}
+}
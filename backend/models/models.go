@@ -1,6 +1,11 @@
 package models
 
 import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -8,42 +13,105 @@ import (
 
 // User represents a user in the system
 type User struct {
-	ID           uuid.UUID  `json:"id"`
-	Email        string     `json:"email"`
-	PasswordHash string     `json:"-"`
-	FullName     string     `json:"full_name"`
-	Role         string     `json:"role"`
-	AvatarURL    string     `json:"avatar_url,omitempty"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    time.Time  `json:"updated_at"`
+	ID            uuid.UUID  `json:"id"`
+	Email         string     `json:"email"`
+	PasswordHash  string     `json:"-"`
+	FullName      string     `json:"full_name"`
+	Role          string     `json:"role"`
+	AvatarURL     string     `json:"avatar_url,omitempty"`
+	OAuthProvider string     `json:"oauth_provider,omitempty"`
+	OAuthSubject  string     `json:"-"`
+	DeletedAt     *time.Time `json:"deleted_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// MarshalJSON falls back to the Gravatar of the user's email when they have
+// no avatar of their own. The fallback is only used in responses and never
+// stored.
+func (u User) MarshalJSON() ([]byte, error) {
+	type plainUser User
+	out := plainUser(u)
+	if out.AvatarURL == "" && out.Email != "" {
+		out.AvatarURL = GravatarURL(out.Email)
+	}
+	return json.Marshal(out)
+}
+
+// GravatarURL returns the 200px Gravatar for the email, an identicon if
+// none was uploaded.
+func GravatarURL(email string) string {
+	sum := md5.Sum([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return "https://www.gravatar.com/avatar/" + hex.EncodeToString(sum[:]) + "?d=identicon&s=200"
+}
+
+// PaginatedResult is a page of a keyset-paginated list. NextCursor is set
+// when HasMore is, and is passed back as the after cursor to fetch the next
+// page.
+type PaginatedResult[T any] struct {
+	Items      []T     `json:"items"`
+	NextCursor *string `json:"next_cursor"`
+	HasMore    bool    `json:"has_more"`
+}
+
+// EncodeCursor returns the opaque cursor pointing after the item with id.
+func EncodeCursor(id uuid.UUID) string {
+	return base64.RawURLEncoding.EncodeToString(id[:])
+}
+
+// DecodeCursor returns the item ID an EncodeCursor cursor points after.
+func DecodeCursor(cursor string) (uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return uuid.FromBytes(raw)
 }
 
 // Blog models
 type Author struct {
-	ID         uuid.UUID  `json:"id"`
-	UserID     uuid.UUID  `json:"user_id"`
-	Bio        string     `json:"bio,omitempty"`
+	ID          uuid.UUID         `json:"id"`
+	UserID      uuid.UUID         `json:"user_id"`
+	Bio         string            `json:"bio,omitempty"`
 	SocialMedia map[string]string `json:"social_media,omitempty"`
-	CreatedAt  time.Time  `json:"created_at"`
-	UpdatedAt  time.Time  `json:"updated_at"`
-	User       *User      `json:"user,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+	User        *User             `json:"user,omitempty"`
 }
 
 type Category struct {
-	ID          uuid.UUID  `json:"id"`
-	Name        string     `json:"name"`
-	Slug        string     `json:"slug"`
-	Description string     `json:"description,omitempty"`
-	CreatedAt   time.Time  `json:"created_at"`
-	UpdatedAt   time.Time  `json:"updated_at"`
+	ID          uuid.UUID        `json:"id"`
+	Name        string           `json:"name"`
+	Slug        string           `json:"slug"`
+	Description string           `json:"description,omitempty"`
+	ParentID    *uuid.UUID       `json:"parent_id,omitempty"`
+	Path        string           `json:"path,omitempty"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	Children    []*Category      `json:"children,omitempty"`
+	Breadcrumb  []*CategoryBrief `json:"breadcrumb,omitempty"`
+}
+
+// CategoryBrief identifies a category in a breadcrumb trail.
+type CategoryBrief struct {
+	ID   uuid.UUID `json:"id"`
+	Name string    `json:"name"`
+	Slug string    `json:"slug"`
 }
 
 type Tag struct {
-	ID        uuid.UUID  `json:"id"`
-	Name      string     `json:"name"`
-	Slug      string     `json:"slug"`
-	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
+	ID        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TagBatchResult reports a batch tag import. Tags holds the created tags.
+type TagBatchResult struct {
+	Created int    `json:"created"`
+	Skipped int    `json:"skipped"`
+	Tags    []*Tag `json:"tags"`
 }
 
 type Post struct {
@@ -56,6 +124,10 @@ type Post struct {
 	AuthorID      uuid.UUID   `json:"author_id"`
 	Status        string      `json:"status"`
 	PublishedAt   *time.Time  `json:"published_at,omitempty"`
+	ScheduledAt   *time.Time  `json:"scheduled_at,omitempty"`
+	Version       int         `json:"version"`
+	ClonedFrom    *uuid.UUID  `json:"cloned_from,omitempty"`
+	DeletedAt     *time.Time  `json:"deleted_at,omitempty"`
 	CreatedAt     time.Time   `json:"created_at"`
 	UpdatedAt     time.Time   `json:"updated_at"`
 	Author        *Author     `json:"author,omitempty"`
@@ -64,48 +136,475 @@ type Post struct {
 	Comments      []*Comment  `json:"comments,omitempty"`
 }
 
+// PostFilter narrows a post list. Zero values are ignored. PublishedFrom
+// is inclusive and PublishedTo exclusive.
+type PostFilter struct {
+	Status        string
+	CategorySlug  string
+	TagSlug       string
+	AuthorID      *uuid.UUID
+	PublishedFrom *time.Time
+	PublishedTo   *time.Time
+}
+
+// PostAutosave holds a user's unsaved edits of a post.
+type PostAutosave struct {
+	PostID  uuid.UUID `json:"post_id"`
+	UserID  uuid.UUID `json:"user_id"`
+	Title   string    `json:"title"`
+	Content string    `json:"content"`
+	SavedAt time.Time `json:"saved_at"`
+}
+
+// PostStats are readability statistics derived from a post's content.
+type PostStats struct {
+	PostID             uuid.UUID `json:"post_id"`
+	WordCount          int       `json:"word_count"`
+	CharCount          int       `json:"char_count"`
+	SentenceCount      int       `json:"sentence_count"`
+	ParagraphCount     int       `json:"paragraph_count"`
+	ReadingTimeMinutes int       `json:"reading_time_minutes"`
+	UniqueTagCount     int       `json:"unique_tag_count"`
+	FleschReadingEase  float64   `json:"flesch_reading_ease"`
+}
+
+// SEOScore rates a post against basic SEO checks. TotalScore is out of 100.
+type SEOScore struct {
+	PostID     uuid.UUID  `json:"post_id"`
+	TotalScore int        `json:"total_score"`
+	Checks     []SEOCheck `json:"checks"`
+}
+
+type SEOCheck struct {
+	Name       string `json:"name"`
+	Passed     bool   `json:"passed"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
 type Comment struct {
+	ID          uuid.UUID  `json:"id"`
+	PostID      uuid.UUID  `json:"post_id"`
+	UserID      uuid.UUID  `json:"user_id"`
+	Content     string     `json:"content"`
+	ParentID    *uuid.UUID `json:"parent_id,omitempty"`
+	Status      string     `json:"status"`
+	ReportCount int        `json:"report_count,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+	User        *User      `json:"user,omitempty"`
+	Parent      *Comment   `json:"parent,omitempty"`
+	Replies     []*Comment `json:"replies,omitempty"`
+}
+
+// CommentReport is a reader's complaint about a comment. Each reader can
+// report a comment once.
+type CommentReport struct {
+	ID         uuid.UUID `json:"id"`
+	CommentID  uuid.UUID `json:"comment_id"`
+	ReporterID uuid.UUID `json:"reporter_id"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// WebhookEndpoint receives signed POSTs for the events it subscribes to.
+// The signing secret is only held encrypted and is never serialized.
+type WebhookEndpoint struct {
+	ID              uuid.UUID `json:"id"`
+	URL             string    `json:"url"`
+	Events          []string  `json:"events"`
+	SecretEncrypted []byte    `json:"-"`
+	IsActive        bool      `json:"is_active"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// WebhookEndpointRequest registers or edits a webhook endpoint. Secret is
+// required to register one; when editing, an empty secret keeps the current
+// one. IsActive defaults to true when registering and to the current value
+// when editing.
+type WebhookEndpointRequest struct {
+	URL      string   `json:"url" binding:"required,url,max=512"`
+	Events   []string `json:"events" binding:"required,min=1"`
+	Secret   string   `json:"secret" binding:"omitempty,min=16"`
+	IsActive *bool    `json:"is_active"`
+}
+
+// RetryDeadLettersRequest retries the dead letters of one webhook endpoint.
+type RetryDeadLettersRequest struct {
+	EndpointID uuid.UUID `json:"endpoint_id" binding:"required"`
+}
+
+// WebhookDelivery is one attempt at delivering an event to a webhook
+// endpoint. Retries of an event share its EventID. StatusCode is nil when
+// no response came back, and Error says why a failed attempt failed.
+type WebhookDelivery struct {
+	ID         uuid.UUID `json:"id"`
+	EndpointID uuid.UUID `json:"endpoint_id"`
+	EventID    uuid.UUID `json:"event_id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode *int      `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int       `json:"duration_ms"`
+	// Payload is kept on dead letters only: the last attempts of deliveries
+	// that failed every attempt.
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	RetriedAt *time.Time      `json:"retried_at,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// WebhookCircuit is the circuit breaker state of a webhook endpoint.
+// FirstFailureAt starts the current run of consecutive failures; OpenedAt
+// is when the circuit last opened.
+type WebhookCircuit struct {
+	EndpointID          uuid.UUID  `json:"endpoint_id"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	FirstFailureAt      *time.Time `json:"first_failure_at,omitempty"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// RefreshToken records an issued refresh token by its jti claim. Tokens
+// issued by refreshing one another share a FamilyID.
+type RefreshToken struct {
 	ID        uuid.UUID  `json:"id"`
-	PostID    uuid.UUID  `json:"post_id"`
 	UserID    uuid.UUID  `json:"user_id"`
-	Content   string     `json:"content"`
-	ParentID  *uuid.UUID `json:"parent_id,omitempty"`
-	Status    string     `json:"status"`
+	FamilyID  uuid.UUID  `json:"family_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
 	CreatedAt time.Time  `json:"created_at"`
-	UpdatedAt time.Time  `json:"updated_at"`
-	User      *User      `json:"user,omitempty"`
-	Parent    *Comment   `json:"parent,omitempty"`
-	Replies   []*Comment `json:"replies,omitempty"`
 }
 
-// E-commerce models
-type ProductCategory struct {
+// PasswordResetToken is an emailed password reset link. Only the hash of
+// the token is stored.
+type PasswordResetToken struct {
+	ID        uuid.UUID  `json:"id"`
+	UserID    uuid.UUID  `json:"user_id"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at,omitempty"`
+}
+
+// APIKey gives programs access on a user's behalf. Only the hash of the key
+// is stored. Scopes are the permissions the key is limited to.
+type APIKey struct {
+	ID         uuid.UUID  `json:"id"`
+	UserID     uuid.UUID  `json:"user_id"`
+	KeyHash    string     `json:"-"`
+	Label      string     `json:"label"`
+	Scopes     []string   `json:"scopes"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// CreateAPIKeyRequest creates an API key limited to the given permissions,
+// which the user must hold.
+type CreateAPIKeyRequest struct {
+	Label  string   `json:"label" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+}
+
+// OAuthToken holds a user's tokens for a provider's API. The tokens are only
+// held encrypted and are never serialized.
+type OAuthToken struct {
+	ID                    uuid.UUID  `json:"id"`
+	UserID                uuid.UUID  `json:"user_id"`
+	Provider              string     `json:"provider"`
+	AccessTokenEncrypted  []byte     `json:"-"`
+	RefreshTokenEncrypted []byte     `json:"-"`
+	Scopes                []string   `json:"scopes"`
+	ExpiresAt             *time.Time `json:"expires_at,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+// FeatureFlag switches a feature on for part of the user base.
+type FeatureFlag struct {
+	ID             uuid.UUID          `json:"id"`
+	Key            string             `json:"key"`
+	Description    string             `json:"description,omitempty"`
+	Enabled        bool               `json:"enabled"`
+	RolloutPercent int                `json:"rollout_percent"`
+	TargetingRules FeatureFlagTargets `json:"targeting_rules"`
+	CreatedAt      time.Time          `json:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at"`
+}
+
+// FeatureFlagTargets names the roles and users a flag is always on for,
+// whatever its rollout percentage.
+type FeatureFlagTargets struct {
+	Roles   []string    `json:"roles,omitempty"`
+	UserIDs []uuid.UUID `json:"user_ids,omitempty"`
+}
+
+// AuditLog records an administrative action. ActorID is nil for actions
+// taken by the system itself.
+type AuditLog struct {
+	ID         uuid.UUID              `json:"id"`
+	ActorID    *uuid.UUID             `json:"actor_id,omitempty"`
+	Action     string                 `json:"action"`
+	EntityType string                 `json:"entity_type"`
+	EntityID   string                 `json:"entity_id"`
+	Details    map[string]interface{} `json:"details,omitempty"`
+	// ChangedFields, OldValue and NewValue record the fields an update
+	// changed; Changes presents them field by field.
+	ChangedFields []string               `json:"changed_fields,omitempty"`
+	OldValue      map[string]interface{} `json:"-"`
+	NewValue      map[string]interface{} `json:"-"`
+	Changes       []FieldChange          `json:"changes,omitempty"`
+	CreatedAt     time.Time              `json:"created_at"`
+}
+
+// FieldChange is one field an update changed.
+type FieldChange struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
+}
+
+// Media is an uploaded file. Variants maps a size name to the URL of an
+// optimized copy of an image.
+type Media struct {
+	ID          uuid.UUID         `json:"id"`
+	URL         string            `json:"url"`
+	StorageKey  string            `json:"-"`
+	ContentType string            `json:"content_type"`
+	SizeBytes   int64             `json:"size_bytes"`
+	Variants    map[string]string `json:"variants"`
+	IsPrivate   bool              `json:"is_private"`
+	UploadedBy  *uuid.UUID        `json:"uploaded_by,omitempty"`
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
+}
+
+// ImageUploadResponse answers an image upload with the URLs of the
+// original and of its WebP variants.
+type ImageUploadResponse struct {
+	MediaID   uuid.UUID `json:"media_id"`
+	Original  string    `json:"original"`
+	Thumbnail string    `json:"thumbnail"`
+	Medium    string    `json:"medium"`
+	Large     string    `json:"large"`
+}
+
+// QueuedEmail is an email waiting to be sent, sent, or given up on after
+// repeated failures.
+type QueuedEmail struct {
 	ID          uuid.UUID  `json:"id"`
-	Name        string     `json:"name"`
-	Slug        string     `json:"slug"`
-	Description string     `json:"description,omitempty"`
-	Image       string     `json:"image,omitempty"`
+	To          string     `json:"to"`
+	Subject     string     `json:"subject"`
+	BodyHTML    string     `json:"body_html"`
+	BodyText    string     `json:"body_text,omitempty"`
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"`
+	LastError   string     `json:"last_error,omitempty"`
+	ScheduledAt time.Time  `json:"scheduled_at"`
+	NextRetryAt time.Time  `json:"next_retry_at"`
+	SentAt      *time.Time `json:"sent_at,omitempty"`
 	CreatedAt   time.Time  `json:"created_at"`
 	UpdatedAt   time.Time  `json:"updated_at"`
-	Products    []*Product `json:"products,omitempty"`
+}
+
+// EmailTemplate is the template of an email the site sends. Subject and
+// TextBody use Go text/template syntax and HTMLBody html/template syntax.
+// Description lists the variables available. IsCustom tells whether an
+// admin has overridden the built-in template.
+type EmailTemplate struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Subject     string     `json:"subject"`
+	HTMLBody    string     `json:"html_body"`
+	TextBody    string     `json:"text_body"`
+	IsCustom    bool       `json:"is_custom"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+// Redirect sends requests for FromPath on to ToPath, e.g. after a slug
+// changes.
+type Redirect struct {
+	ID         uuid.UUID `json:"id"`
+	FromPath   string    `json:"from_path"`
+	ToPath     string    `json:"to_path"`
+	StatusCode int       `json:"status_code"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// E-commerce models
+
+// ProductCategory is a node of the product category tree. Children is
+// filled in when the tree is loaded, Ancestors when a single category is,
+// root first.
+type ProductCategory struct {
+	ID          uuid.UUID          `json:"id"`
+	Name        string             `json:"name"`
+	Slug        string             `json:"slug"`
+	Description string             `json:"description,omitempty"`
+	Image       string             `json:"image,omitempty"`
+	TaxRate     float64            `json:"tax_rate"`
+	ParentID    *uuid.UUID         `json:"parent_id,omitempty"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+	Children    []*ProductCategory `json:"children,omitempty"`
+	Ancestors   []*ProductCategory `json:"ancestors,omitempty"`
+	Products    []*Product         `json:"products,omitempty"`
 }
 
 type Product struct {
-	ID          uuid.UUID        `json:"id"`
-	Name        string           `json:"name"`
-	Slug        string           `json:"slug"`
-	Description string           `json:"description"`
-	Price       float64          `json:"price"`
-	SalePrice   *float64         `json:"sale_price,omitempty"`
-	SKU         string           `json:"sku"`
-	Stock       int              `json:"stock"`
-	IsFeatured  bool             `json:"is_featured"`
-	Images      []string         `json:"images,omitempty"`
-	CategoryID  uuid.UUID        `json:"category_id"`
-	CreatedAt   time.Time        `json:"created_at"`
-	UpdatedAt   time.Time        `json:"updated_at"`
-	Category    *ProductCategory `json:"category,omitempty"`
-	Attributes  []*ProductAttribute `json:"attributes,omitempty"`
+	ID          uuid.UUID         `json:"id"`
+	Name        string            `json:"name"`
+	Slug        string            `json:"slug"`
+	Description string            `json:"description"`
+	Price       float64           `json:"price"`
+	SalePrice   *float64          `json:"sale_price,omitempty"`
+	SKU         string            `json:"sku"`
+	Stock       int               `json:"stock"`
+	IsFeatured  bool              `json:"is_featured"`
+	Type        string            `json:"type"`
+	Images      []*ProductImage   `json:"images,omitempty"`
+	Variants    []*ProductVariant `json:"variants,omitempty"`
+	// PriceIncludesTax tells whether Price already contains tax. TaxRate
+	// overrides the category's rate when set.
+	PriceIncludesTax bool     `json:"price_includes_tax"`
+	TaxRate          *float64 `json:"tax_rate,omitempty"`
+	PriceExcTax      float64  `json:"price_exc_tax,omitempty"`
+	PriceIncTax      float64  `json:"price_inc_tax,omitempty"`
+	// FlashSalePrice and FlashSaleEndsAt are set while the product is in an
+	// active flash sale.
+	FlashSalePrice  *float64   `json:"flash_sale_price,omitempty"`
+	FlashSaleEndsAt *time.Time `json:"flash_sale_ends_at,omitempty"`
+	CategoryID      uuid.UUID  `json:"category_id"`
+	VendorID        *uuid.UUID `json:"vendor_id,omitempty"`
+	Status          string     `json:"status"`
+	// ShippingRestrictions lists the country codes the product can be shipped
+	// to; empty means anywhere. CanShipToCountry answers ?country= lookups.
+	ShippingRestrictions []string            `json:"shipping_restrictions"`
+	CanShipToCountry     *bool               `json:"can_ship_to_country,omitempty"`
+	Version              int                 `json:"version"`
+	DeletedAt            *time.Time          `json:"deleted_at,omitempty"`
+	CreatedAt            time.Time           `json:"created_at"`
+	UpdatedAt            time.Time           `json:"updated_at"`
+	Category             *ProductCategory    `json:"category,omitempty"`
+	Attributes           []*ProductAttribute `json:"attributes,omitempty"`
+	Event                *EventDetails       `json:"event,omitempty"`
+}
+
+// CanShipTo reports whether the product can be shipped to the country, given
+// as an ISO 3166-1 alpha-2 code.
+func (p *Product) CanShipTo(country string) bool {
+	if len(p.ShippingRestrictions) == 0 {
+		return true
+	}
+	for _, allowed := range p.ShippingRestrictions {
+		if strings.EqualFold(allowed, country) {
+			return true
+		}
+	}
+	return false
+}
+
+// ProductFilter narrows a product search or list. Zero values are ignored.
+// Attributes maps an attribute name to the value the product must have.
+type ProductFilter struct {
+	CategoryID   *uuid.UUID
+	CategorySlug string
+	MinPrice     *float64
+	MaxPrice     *float64
+	IsFeatured   *bool
+	InStock      bool
+	Attributes   map[string]string
+}
+
+// FacetedSearchResult is a page of products together with facet counts
+// over every product that matched, not just the page.
+type FacetedSearchResult struct {
+	Products []*Product    `json:"products"`
+	Total    int           `json:"total"`
+	Facets   ProductFacets `json:"facets"`
+}
+
+type ProductFacets struct {
+	Categories      []CategoryFacet                  `json:"categories"`
+	PriceRanges     []PriceRangeFacet                `json:"price_ranges"`
+	InStockCount    int                              `json:"in_stock_count"`
+	AttributeValues map[string][]AttributeValueFacet `json:"attribute_values"`
+}
+
+type CategoryFacet struct {
+	Name  string `json:"name"`
+	Slug  string `json:"slug"`
+	Count int    `json:"count"`
+}
+
+// PriceRangeFacet counts products priced from From up to, but excluding,
+// To. The top range has no upper bound.
+type PriceRangeFacet struct {
+	From  float64  `json:"from"`
+	To    *float64 `json:"to"`
+	Count int      `json:"count"`
+}
+
+type AttributeValueFacet struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// EventDetails holds the extra data for products of type "event".
+type EventDetails struct {
+	ProductID   uuid.UUID `json:"product_id"`
+	EventDate   time.Time `json:"event_date"`
+	Venue       string    `json:"venue"`
+	Address     string    `json:"address,omitempty"`
+	Capacity    int       `json:"capacity"`
+	TicketsSold int       `json:"tickets_sold"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// ProductRevision is a snapshot of a product's content, taken before the
+// product was changed. CreatedBy is the user whose change replaced it.
+type ProductRevision struct {
+	ID          uuid.UUID           `json:"id"`
+	ProductID   uuid.UUID           `json:"product_id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Price       float64             `json:"price"`
+	SalePrice   *float64            `json:"sale_price,omitempty"`
+	Attributes  []RevisionAttribute `json:"attributes"`
+	CreatedBy   *uuid.UUID          `json:"created_by,omitempty"`
+	CreatedAt   time.Time           `json:"created_at"`
+}
+
+type RevisionAttribute struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// ProductImage is one picture in a product's gallery, shown in SortOrder.
+type ProductImage struct {
+	ID        uuid.UUID `json:"id"`
+	ProductID uuid.UUID `json:"product_id"`
+	URL       string    `json:"url"`
+	AltText   string    `json:"alt_text,omitempty"`
+	SortOrder int       `json:"sort_order"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProductVariant is one version of a product, such as a size and colour,
+// with its own SKU and stock. A nil Price means the product's price.
+type ProductVariant struct {
+	ID         uuid.UUID         `json:"id"`
+	ProductID  uuid.UUID         `json:"product_id"`
+	SKU        string            `json:"sku"`
+	Attributes map[string]string `json:"attributes"`
+	Stock      int               `json:"stock"`
+	Price      *float64          `json:"price,omitempty"`
+	CreatedAt  time.Time         `json:"created_at"`
+	UpdatedAt  time.Time         `json:"updated_at"`
 }
 
 type ProductAttribute struct {
@@ -117,90 +616,521 @@ type ProductAttribute struct {
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// AttributeDefinition is the controlled vocabulary for a product attribute.
+// An empty AllowedValues accepts any value. Values of case-insensitive
+// attributes are stored lowercased.
+type AttributeDefinition struct {
+	ID              uuid.UUID `json:"id"`
+	Name            string    `json:"name"`
+	AllowedValues   []string  `json:"allowed_values"`
+	IsCaseSensitive bool      `json:"is_case_sensitive"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
 type Customer struct {
-	ID             uuid.UUID         `json:"id"`
-	UserID         uuid.UUID         `json:"user_id"`
+	ID              uuid.UUID         `json:"id"`
+	UserID          uuid.UUID         `json:"user_id"`
 	ShippingAddress map[string]string `json:"shipping_address,omitempty"`
 	BillingAddress  map[string]string `json:"billing_address,omitempty"`
-	Phone          string            `json:"phone,omitempty"`
-	CreatedAt      time.Time         `json:"created_at"`
-	UpdatedAt      time.Time         `json:"updated_at"`
-	User           *User             `json:"user,omitempty"`
-	Orders         []*Order          `json:"orders,omitempty"`
+	Phone           string            `json:"phone,omitempty"`
+	CreatedAt       time.Time         `json:"created_at"`
+	UpdatedAt       time.Time         `json:"updated_at"`
+	User            *User             `json:"user,omitempty"`
+	Orders          []*Order          `json:"orders,omitempty"`
 }
 
+// OrderStatus is where an order is in its lifecycle. The moves allowed
+// between statuses are enforced by OrderService.Transition.
+type OrderStatus string
+
+const (
+	OrderStatusPending    OrderStatus = "pending"
+	OrderStatusConfirmed  OrderStatus = "confirmed"
+	OrderStatusProcessing OrderStatus = "processing"
+	OrderStatusShipped    OrderStatus = "shipped"
+	OrderStatusDelivered  OrderStatus = "delivered"
+	OrderStatusCancelled  OrderStatus = "cancelled"
+	OrderStatusRefunded   OrderStatus = "refunded"
+)
+
+// Order is a placed order. TotalAmount is what the customer pays: the
+// items, less DiscountAmount, plus TaxAmount unless TaxInclusive says the
+// tax was already part of the prices.
 type Order struct {
 	ID              uuid.UUID         `json:"id"`
 	CustomerID      uuid.UUID         `json:"customer_id"`
-	Status          string            `json:"status"`
+	Status          OrderStatus       `json:"status"`
 	TotalAmount     float64           `json:"total_amount"`
+	CouponID        *uuid.UUID        `json:"coupon_id,omitempty"`
+	CouponCode      string            `json:"coupon_code,omitempty"`
+	DiscountAmount  float64           `json:"discount_amount"`
+	TaxAmount       float64           `json:"tax_amount"`
+	TaxRate         float64           `json:"tax_rate"`
+	TaxInclusive    bool              `json:"tax_inclusive"`
 	ShippingAddress map[string]string `json:"shipping_address"`
 	BillingAddress  map[string]string `json:"billing_address"`
 	PaymentMethod   string            `json:"payment_method"`
 	PaymentStatus   string            `json:"payment_status"`
 	TrackingNumber  string            `json:"tracking_number,omitempty"`
 	Notes           string            `json:"notes,omitempty"`
+	Version         int               `json:"version"`
 	CreatedAt       time.Time         `json:"created_at"`
 	UpdatedAt       time.Time         `json:"updated_at"`
+	CustomerName    string            `json:"customer_name,omitempty"`
+	CustomerEmail   string            `json:"customer_email,omitempty"`
 	Customer        *Customer         `json:"customer,omitempty"`
 	Items           []*OrderItem      `json:"items,omitempty"`
 	Payment         *Payment          `json:"payment,omitempty"`
+	OrderNotes      []*OrderNote      `json:"order_notes,omitempty"`
+}
+
+// OrderNote is an append-only note attached to an order. Internal notes are
+// visible to staff only.
+type OrderNote struct {
+	ID         uuid.UUID `json:"id"`
+	OrderID    uuid.UUID `json:"order_id"`
+	AuthorID   uuid.UUID `json:"author_id"`
+	Content    string    `json:"content"`
+	IsInternal bool      `json:"is_internal"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// OrderSearchFilter narrows an admin order search.
+type OrderSearchFilter struct {
+	Query    string
+	DateFrom *time.Time
+	DateTo   *time.Time
+}
+
+// OrderAdminFilter narrows the admin order list. Zero values are ignored.
+// Sort is one of the OrderSort* keys and defaults to newest first.
+// OrderExportRow is one order in an accounting export. Orders do not record
+// tax, shipping or discounts separately yet, so those are exported as zero.
+type OrderExportRow struct {
+	OrderID       uuid.UUID `json:"order_id"`
+	CreatedAt     time.Time `json:"created_at"`
+	CustomerEmail string    `json:"customer_email"`
+	Status        string    `json:"status"`
+	Subtotal      float64   `json:"subtotal"`
+	Tax           float64   `json:"tax"`
+	Shipping      float64   `json:"shipping"`
+	Discount      float64   `json:"discount"`
+	Total         float64   `json:"total"`
+	PaymentMethod string    `json:"payment_method"`
+	PaymentStatus string    `json:"payment_status"`
+}
+
+type OrderAdminFilter struct {
+	Status        string
+	PaymentStatus string
+	CustomerEmail string
+	From          *time.Time
+	To            *time.Time
+	MinTotal      *float64
+	MaxTotal      *float64
+	Sort          string
+}
+
+// OrderSearchResult is a single hit from an admin order search. MatchedIn
+// lists which fields matched the query: id, customer_email, sku, note.
+type OrderSearchResult struct {
+	OrderID       uuid.UUID `json:"order_id"`
+	CustomerEmail string    `json:"customer_email"`
+	Status        string    `json:"status"`
+	TotalAmount   float64   `json:"total_amount"`
+	CreatedAt     time.Time `json:"created_at"`
+	MatchedIn     []string  `json:"matched_in"`
+}
+
+// Cart holds the items a user means to buy. Subtotal is the sum of the
+// items' unit prices times their quantities.
+type Cart struct {
+	ID         uuid.UUID   `json:"id"`
+	UserID     uuid.UUID   `json:"user_id"`
+	Items      []*CartItem `json:"items"`
+	Subtotal   float64     `json:"subtotal"`
+	CouponID   *uuid.UUID  `json:"-"`
+	CouponCode string      `json:"coupon_code,omitempty"`
+	Discount   float64     `json:"discount"`
+	Total      float64     `json:"total"`
+	CreatedAt  time.Time   `json:"created_at"`
+	UpdatedAt  time.Time   `json:"updated_at"`
+}
+
+// TaxRate is the tax on orders shipped to matching addresses. Empty Region
+// and Postcode match any, and the rate with an empty Country is the
+// default. IsInclusive means prices there already include the tax.
+type TaxRate struct {
+	ID          uuid.UUID `json:"id"`
+	Country     string    `json:"country"`
+	Region      string    `json:"region"`
+	Postcode    string    `json:"postcode"`
+	Rate        float64   `json:"rate"`
+	IsInclusive bool      `json:"is_inclusive"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CouponType is how a coupon's value is taken off the applicable items:
+// as a percentage of their price, or as a fixed amount capped at it.
+type CouponType string
+
+const (
+	CouponTypePercent CouponType = "percent"
+	CouponTypeFixed   CouponType = "fixed"
+)
+
+// Coupon is a discount code. Nil limits do not apply, and an empty
+// ApplicableProductIDs applies the coupon to every product.
+type Coupon struct {
+	ID                   uuid.UUID   `json:"id"`
+	Code                 string      `json:"code"`
+	Type                 CouponType  `json:"type"`
+	Value                float64     `json:"value"`
+	MinOrderAmount       *float64    `json:"min_order_amount,omitempty"`
+	MaxUses              *int        `json:"max_uses,omitempty"`
+	UsedCount            int         `json:"used_count"`
+	ExpiresAt            *time.Time  `json:"expires_at,omitempty"`
+	ApplicableProductIDs []uuid.UUID `json:"applicable_product_ids"`
+	CreatedAt            time.Time   `json:"created_at"`
+	UpdatedAt            time.Time   `json:"updated_at"`
+}
+
+// CartItem is a quantity of a product, or of one of its variants, in a
+// cart. UnitPrice is the price when the item was added or last changed.
+type CartItem struct {
+	ID        uuid.UUID       `json:"id"`
+	CartID    uuid.UUID       `json:"cart_id"`
+	ProductID uuid.UUID       `json:"product_id"`
+	VariantID *uuid.UUID      `json:"variant_id,omitempty"`
+	BundleID  *uuid.UUID      `json:"bundle_id,omitempty"`
+	Quantity  int             `json:"quantity"`
+	UnitPrice float64         `json:"unit_price"`
+	CreatedAt time.Time       `json:"created_at"`
+	UpdatedAt time.Time       `json:"updated_at"`
+	Product   *Product        `json:"product,omitempty"`
+	Variant   *ProductVariant `json:"variant,omitempty"`
 }
 
 type OrderItem struct {
-	ID        uuid.UUID `json:"id"`
-	OrderID   uuid.UUID `json:"order_id"`
-	ProductID uuid.UUID `json:"product_id"`
-	Quantity  int       `json:"quantity"`
-	Price     float64   `json:"price"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	Product   *Product  `json:"product,omitempty"`
+	ID               uuid.UUID      `json:"id"`
+	OrderID          uuid.UUID      `json:"order_id"`
+	ProductID        uuid.UUID      `json:"product_id"`
+	VariantID        *uuid.UUID     `json:"variant_id,omitempty"`
+	Quantity         int            `json:"quantity"`
+	Price            float64        `json:"price"`
+	VendorID         *uuid.UUID     `json:"vendor_id,omitempty"`
+	CommissionAmount float64        `json:"commission_amount"`
+	CreatedAt        time.Time      `json:"created_at"`
+	UpdatedAt        time.Time      `json:"updated_at"`
+	Product          *Product       `json:"product,omitempty"`
+	Tickets          []*OrderTicket `json:"tickets,omitempty"`
 }
 
-type Payment struct {
+// OrderTicket is a single admission issued for an event order item. QRData
+// is the payload encoded in the ticket's QR code.
+type OrderTicket struct {
+	TicketID    uuid.UUID  `json:"ticket_id"`
+	OrderItemID uuid.UUID  `json:"order_item_id"`
+	QRData      string     `json:"qr_data"`
+	CheckedInAt *time.Time `json:"checked_in_at,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// Subscription is a recurring order for a single product.
+type Subscription struct {
+	ID            uuid.UUID `json:"id"`
+	CustomerID    uuid.UUID `json:"customer_id"`
+	ProductID     uuid.UUID `json:"product_id"`
+	Quantity      int       `json:"quantity"`
+	Interval      string    `json:"interval"`
+	NextBillingAt time.Time `json:"next_billing_at"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+	Customer      *Customer `json:"customer,omitempty"`
+	Product       *Product  `json:"product,omitempty"`
+}
+
+// Vendor is a third-party seller on the marketplace. CommissionRate is the
+// fraction of each sale kept by the platform, e.g. 0.15 for 15%.
+type Vendor struct {
 	ID             uuid.UUID         `json:"id"`
-	OrderID        uuid.UUID         `json:"order_id"`
-	Amount         float64           `json:"amount"`
-	PaymentMethod  string            `json:"payment_method"`
-	PaymentID      string            `json:"payment_id,omitempty"`
+	UserID         *uuid.UUID        `json:"user_id,omitempty"`
+	Name           string            `json:"name"`
+	Slug           string            `json:"slug"`
+	CommissionRate float64           `json:"commission_rate"`
+	BankAccount    map[string]string `json:"bank_account,omitempty"`
 	Status         string            `json:"status"`
-	TransactionData map[string]interface{} `json:"transaction_data,omitempty"`
 	CreatedAt      time.Time         `json:"created_at"`
 	UpdatedAt      time.Time         `json:"updated_at"`
 }
 
+// VendorPayout is the vendor's share of a single order item.
+type VendorPayout struct {
+	ID               uuid.UUID  `json:"id"`
+	VendorID         uuid.UUID  `json:"vendor_id"`
+	BatchID          *uuid.UUID `json:"batch_id,omitempty"`
+	OrderItemID      uuid.UUID  `json:"order_item_id"`
+	GrossAmount      float64    `json:"gross_amount"`
+	CommissionAmount float64    `json:"commission_amount"`
+	NetAmount        float64    `json:"net_amount"`
+	Status           string     `json:"status"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+// FlashSale discounts the listed products by DiscountPercent between
+// StartsAt and EndsAt.
+type FlashSale struct {
+	ID              uuid.UUID   `json:"id"`
+	Title           string      `json:"title"`
+	DiscountPercent float64     `json:"discount_percent"`
+	StartsAt        time.Time   `json:"starts_at"`
+	EndsAt          time.Time   `json:"ends_at"`
+	ProductIDs      []uuid.UUID `json:"product_ids"`
+	IsActive        bool        `json:"is_active"`
+	CreatedAt       time.Time   `json:"created_at"`
+	UpdatedAt       time.Time   `json:"updated_at"`
+}
+
+// ProductBundle sells several products together at a discount. Its price is
+// either fixed by BundlePrice or the items' total less
+// BundleDiscountPercent. RegularTotal, Price and Savings are filled in by
+// BundleService.
+type ProductBundle struct {
+	ID                    uuid.UUID            `json:"id"`
+	Name                  string               `json:"name"`
+	Slug                  string               `json:"slug"`
+	Description           string               `json:"description"`
+	BundlePrice           *float64             `json:"fixed_price,omitempty"`
+	BundleDiscountPercent *float64             `json:"discount_percent,omitempty"`
+	IsActive              bool                 `json:"is_active"`
+	Items                 []*ProductBundleItem `json:"items"`
+	RegularTotal          float64              `json:"regular_total"`
+	Price                 float64              `json:"bundle_price"`
+	Savings               float64              `json:"savings"`
+	CreatedAt             time.Time            `json:"created_at"`
+	UpdatedAt             time.Time            `json:"updated_at"`
+}
+
+// ProductBundleItem is a product in a bundle and how many of it the bundle
+// contains.
+type ProductBundleItem struct {
+	Product  *Product `json:"product"`
+	Quantity int      `json:"quantity"`
+}
+
+// PayoutBatch groups a vendor's pending payouts into a single bank
+// transfer. Attempts counts the transfers tried so far.
+type PayoutBatch struct {
+	ID          uuid.UUID `json:"id"`
+	VendorID    uuid.UUID `json:"vendor_id"`
+	TotalAmount float64   `json:"total_amount"`
+	Reference   string    `json:"reference"`
+	Status      string    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+type Payment struct {
+	ID              uuid.UUID              `json:"id"`
+	OrderID         uuid.UUID              `json:"order_id"`
+	Amount          float64                `json:"amount"`
+	PaymentMethod   string                 `json:"payment_method"`
+	PaymentID       string                 `json:"payment_id,omitempty"`
+	Status          string                 `json:"status"`
+	TransactionData map[string]interface{} `json:"transaction_data,omitempty"`
+	CreatedAt       time.Time              `json:"created_at"`
+	UpdatedAt       time.Time              `json:"updated_at"`
+}
+
+// Admin reporting models
+// DashboardStats are the shop's figures for the period from From up to To,
+// each compared with the period of the same length just before it.
+type DashboardStats struct {
+	From              time.Time        `json:"from"`
+	To                time.Time        `json:"to"`
+	Revenue           DashboardMetric  `json:"revenue"`
+	OrderCount        DashboardMetric  `json:"order_count"`
+	AverageOrderValue DashboardMetric  `json:"average_order_value"`
+	NewCustomers      DashboardMetric  `json:"new_customers"`
+	TopProducts       []ProductRevenue `json:"top_products"`
+}
+
+// DashboardMetric is a figure for a period and for the period before it.
+// Change is the relative change, 0.25 for a quarter up, and is nil when
+// the previous value is zero.
+type DashboardMetric struct {
+	Value    float64  `json:"value"`
+	Previous float64  `json:"previous"`
+	Change   *float64 `json:"change"`
+}
+
+// PeriodTotals are the order and customer totals of one period. Cancelled
+// and refunded orders do not count.
+type PeriodTotals struct {
+	Revenue      float64
+	Orders       int
+	NewCustomers int
+}
+
+// ProductRevenue is what a product's order items brought in over a period.
+type ProductRevenue struct {
+	ProductID uuid.UUID `json:"product_id"`
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	UnitsSold int       `json:"units_sold"`
+	Revenue   float64   `json:"revenue"`
+}
+
+// SearchQueryStat aggregates how often a normalized search query was run and
+// how many of those searches found nothing.
+type SearchQueryStat struct {
+	Query           string    `json:"query"`
+	Count           int       `json:"count"`
+	ZeroResultCount int       `json:"zero_result_count"`
+	LastSearchedAt  time.Time `json:"last_searched_at"`
+}
+
+// CustomerLTV is a customer's lifetime value computed from their
+// non-cancelled orders.
+type CustomerLTV struct {
+	CustomerID    uuid.UUID `json:"customer_id"`
+	Email         string    `json:"email"`
+	FullName      string    `json:"full_name"`
+	OrderCount    int       `json:"order_count"`
+	TotalSpent    float64   `json:"total_spent"`
+	AvgOrderValue float64   `json:"avg_order_value"`
+	FirstOrderAt  time.Time `json:"first_order_at"`
+	LastOrderAt   time.Time `json:"last_order_at"`
+}
+
+// CustomerAnalytics summarizes a customer's purchase history from their
+// non-cancelled orders. The times, averages and product are nil until the
+// customer has enough orders to compute them.
+type CustomerAnalytics struct {
+	CustomerID             uuid.UUID         `json:"customer_id"`
+	FirstOrderAt           *time.Time        `json:"first_order_at"`
+	LastOrderAt            *time.Time        `json:"last_order_at"`
+	TotalOrders            int               `json:"total_orders"`
+	TotalSpent             float64           `json:"total_spent"`
+	AvgDaysBetweenOrders   *float64          `json:"avg_days_between_orders"`
+	MostPurchasedProduct   *PurchasedProduct `json:"most_purchased_product"`
+	RepeatProductCount     int               `json:"repeat_product_count"`
+	PreferredPaymentMethod *string           `json:"preferred_payment_method"`
+}
+
+// PurchasedProduct is a product with the units a customer bought of it.
+type PurchasedProduct struct {
+	ProductID  uuid.UUID `json:"product_id"`
+	Name       string    `json:"name"`
+	TotalUnits int       `json:"total_units"`
+}
+
 // CMS models
+
+// SiteSetting is one entry of the site settings store. Value is any JSON
+// value: a string, number, boolean, object or array.
 type SiteSetting struct {
-	ID        uuid.UUID              `json:"id"`
-	Key       string                 `json:"key"`
-	Value     map[string]interface{} `json:"value"`
-	CreatedAt time.Time              `json:"created_at"`
-	UpdatedAt time.Time              `json:"updated_at"`
+	ID        uuid.UUID   `json:"id"`
+	Key       string      `json:"key"`
+	Value     interface{} `json:"value"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt time.Time   `json:"updated_at"`
 }
 
+// SiteSettingRequest sets a site setting. A null value unsets it.
+type SiteSettingRequest struct {
+	Value interface{} `json:"value"`
+}
+
+// Page is a CMS page. Template names the frontend layout it is rendered
+// with. New pages are drafts until published.
 type Page struct {
-	ID             uuid.UUID `json:"id"`
-	Title          string    `json:"title"`
-	Slug           string    `json:"slug"`
-	Content        string    `json:"content"`
-	MetaTitle      string    `json:"meta_title,omitempty"`
+	ID              uuid.UUID `json:"id"`
+	Title           string    `json:"title"`
+	Slug            string    `json:"slug"`
+	Content         string    `json:"content"`
+	MetaTitle       string    `json:"meta_title,omitempty"`
 	MetaDescription string    `json:"meta_description,omitempty"`
-	Status         string    `json:"status"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	Template        string    `json:"template"`
+	Status          string    `json:"status"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// PageRequest creates or edits a page. The slug is generated from the title
+// when empty, and an empty template selects the default layout.
+type PageRequest struct {
+	Title           string `json:"title" binding:"required,max=255"`
+	Slug            string `json:"slug" binding:"max=255"`
+	Content         string `json:"content" binding:"required"`
+	MetaTitle       string `json:"meta_title" binding:"max=255"`
+	MetaDescription string `json:"meta_description"`
+	Template        string `json:"template" binding:"max=50"`
+}
+
+// SitemapEntry is a published post, page or product as listed in the
+// sitemap.
+type SitemapEntry struct {
+	Slug      string
+	UpdatedAt time.Time
 }
 
 // Auth models
+
+// JWTClaims are the claims of a validated access token. Permissions are
+// the user's permissions when the token was issued, and Scopes the distinct
+// scopes they belong to.
 type JWTClaims struct {
-	UserID uuid.UUID `json:"user_id"`
-	Email  string    `json:"email"`
-	Role   string    `json:"role"`
+	UserID      uuid.UUID `json:"user_id"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	Scopes      []string  `json:"scopes"`
+	Permissions []string  `json:"permissions"`
+}
+
+// APIKeyClaims are the claims of a validated API key: its user's, with the
+// permissions narrowed to the key's scopes.
+type APIKeyClaims struct {
+	JWTClaims
+	KeyID uuid.UUID `json:"key_id"`
 }
 
+// LoginRequest signs a user in. RememberMe asks for the refresh token to be
+// kept in a cookie as well, for web clients.
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Email      string `json:"email" binding:"required,email"`
+	Password   string `json:"password" binding:"required,min=6"`
+	RememberMe bool   `json:"remember_me"`
+}
+
+// LogoutRequest carries the tokens to revoke on logout. Either may be left
+// out.
+type LogoutRequest struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// PasswordResetRequest asks for a password reset link to be emailed.
+type PasswordResetRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// PasswordResetConfirmRequest sets a new password with an emailed reset
+// token.
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6"`
+}
+
+// GoogleLoginRequest signs in with a Google ID token.
+type GoogleLoginRequest struct {
+	IDToken string `json:"id_token" binding:"required"`
 }
 
 type RegisterRequest struct {
@@ -210,9 +1140,246 @@ type RegisterRequest struct {
 	Role     string `json:"role" binding:"required,oneof=admin customer contributor"`
 }
 
+type CreateOrderNoteRequest struct {
+	Content string `json:"content" binding:"required"`
+}
+
+type UpdateAvatarRequest struct {
+	AvatarURL string `json:"avatar_url"`
+}
+
+type UpdateUserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+type MergeCustomersRequest struct {
+	PrimaryID   uuid.UUID `json:"primary_id" binding:"required"`
+	SecondaryID uuid.UUID `json:"secondary_id" binding:"required"`
+}
+
+// UpdatePostRequest replaces a post's content. Version must be the version
+// the editor started from; a stale version is rejected. ScheduledAt is when
+// a scheduled post goes live and is required for that status.
+// FeaturedMediaID sets the featured image to an uploaded image instead of
+// FeaturedImage.
+type UpdatePostRequest struct {
+	Title           string      `json:"title" binding:"required"`
+	Slug            string      `json:"slug" binding:"required"`
+	Content         string      `json:"content" binding:"required"`
+	Excerpt         string      `json:"excerpt"`
+	FeaturedImage   string      `json:"featured_image"`
+	FeaturedMediaID *uuid.UUID  `json:"featured_media_id"`
+	Status          string      `json:"status" binding:"required,oneof=draft scheduled published archived"`
+	ScheduledAt     *time.Time  `json:"scheduled_at"`
+	CategoryIDs     []uuid.UUID `json:"category_ids"`
+	TagIDs          []uuid.UUID `json:"tag_ids"`
+	Version         int         `json:"version" binding:"required,min=1"`
+}
+
+// CreatePostRequest creates a post by the caller. ScheduledAt is when a
+// scheduled post goes live and is required for that status.
+// FeaturedMediaID sets the featured image to an uploaded image instead of
+// FeaturedImage.
+type CreatePostRequest struct {
+	Title           string      `json:"title" binding:"required,max=255"`
+	Slug            string      `json:"slug" binding:"required,max=255"`
+	Content         string      `json:"content" binding:"required"`
+	Excerpt         string      `json:"excerpt"`
+	FeaturedImage   string      `json:"featured_image"`
+	FeaturedMediaID *uuid.UUID  `json:"featured_media_id"`
+	Status          string      `json:"status" binding:"required,oneof=draft scheduled published"`
+	ScheduledAt     *time.Time  `json:"scheduled_at"`
+	CategoryIDs     []uuid.UUID `json:"category_ids"`
+	TagIDs          []uuid.UUID `json:"tag_ids"`
+}
+
+// CreateTagsRequest creates tags in bulk. A missing slug is generated from
+// the name.
+type CreateTagsRequest struct {
+	Tags []TagRequest `json:"tags" binding:"required,min=1,max=500,dive"`
+}
+
+type TagRequest struct {
+	Name string `json:"name" binding:"required,max=100"`
+	Slug string `json:"slug" binding:"max=100"`
+}
+
+type UpdateEmailTemplateRequest struct {
+	Subject  string `json:"subject" binding:"required,max=255"`
+	HTMLBody string `json:"html_body" binding:"required"`
+	TextBody string `json:"text_body"`
+}
+
+type AutosavePostRequest struct {
+	Title   string `json:"title" binding:"max=255"`
+	Content string `json:"content"`
+}
+
+// ProductRequest creates or replaces a product. Attributes replace the
+// product's existing attributes. When replacing, Version must be the version
+// the editor started from; a stale version is rejected.
+type ProductRequest struct {
+	Name                 string                    `json:"name" binding:"required"`
+	Slug                 string                    `json:"slug" binding:"required"`
+	Description          string                    `json:"description" binding:"required"`
+	Price                float64                   `json:"price" binding:"required,gt=0"`
+	SalePrice            *float64                  `json:"sale_price" binding:"omitempty,gt=0"`
+	SKU                  string                    `json:"sku" binding:"required"`
+	Stock                int                       `json:"stock" binding:"min=0"`
+	IsFeatured           bool                      `json:"is_featured"`
+	Type                 string                    `json:"type" binding:"omitempty,oneof=physical digital"`
+	PriceIncludesTax     bool                      `json:"price_includes_tax"`
+	TaxRate              *float64                  `json:"tax_rate" binding:"omitempty,min=0,lt=1"`
+	CategoryID           *uuid.UUID                `json:"category_id"`
+	VendorID             *uuid.UUID                `json:"vendor_id"`
+	Attributes           []ProductAttributeRequest `json:"attributes" binding:"dive"`
+	ShippingRestrictions []string                  `json:"shipping_restrictions" binding:"dive,iso3166_1_alpha2"`
+	Version              int                       `json:"version" binding:"omitempty,min=1"`
+}
+
+// BulkMoveProductsRequest moves products out of one category into
+// TargetCategoryID.
+type BulkMoveProductsRequest struct {
+	ProductIDs       []uuid.UUID `json:"product_ids" binding:"required,min=1,max=1000"`
+	TargetCategoryID uuid.UUID   `json:"target_category_id" binding:"required"`
+}
+
+// CreateProductRequest starts a draft product from its basic info. The
+// remaining sections are filled in step by step before publishing; a
+// missing slug or SKU is generated.
+type CreateProductRequest struct {
+	Name        string     `json:"name" binding:"required,max=255"`
+	Slug        string     `json:"slug" binding:"max=255"`
+	Description string     `json:"description"`
+	SKU         string     `json:"sku" binding:"max=100"`
+	Type        string     `json:"type" binding:"omitempty,oneof=physical digital"`
+	CategoryID  *uuid.UUID `json:"category_id"`
+	VendorID    *uuid.UUID `json:"vendor_id"`
+}
+
+type UpdateProductPricingRequest struct {
+	Price            float64  `json:"price" binding:"min=0"`
+	SalePrice        *float64 `json:"sale_price" binding:"omitempty,gt=0"`
+	PriceIncludesTax bool     `json:"price_includes_tax"`
+	TaxRate          *float64 `json:"tax_rate" binding:"omitempty,min=0,lt=1"`
+}
+
+type UpdateProductStockRequest struct {
+	Stock int `json:"stock" binding:"min=0"`
+}
+
+// ValidationError describes one reason a record cannot be published.
+type ValidationError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ProductVariantRequest creates or replaces a variant. A nil Price means
+// the product's price.
+type ProductVariantRequest struct {
+	SKU        string            `json:"sku" binding:"required,max=100"`
+	Attributes map[string]string `json:"attributes" binding:"required,min=1"`
+	Stock      int               `json:"stock" binding:"min=0"`
+	Price      *float64          `json:"price" binding:"omitempty,gt=0"`
+}
+
+// CheckoutRequest orders the contents of the caller's cart. A missing
+// billing address means the shipping address.
+type CheckoutRequest struct {
+	ShippingAddress map[string]string `json:"shipping_address" binding:"required"`
+	BillingAddress  map[string]string `json:"billing_address"`
+	PaymentMethod   string            `json:"payment_method" binding:"required,max=50"`
+	Notes           string            `json:"notes" binding:"max=1000"`
+}
+
+// AddCartItemRequest adds a product to the caller's cart. VariantID is
+// required for products that have variants.
+type AddCartItemRequest struct {
+	ProductID uuid.UUID  `json:"product_id" binding:"required"`
+	VariantID *uuid.UUID `json:"variant_id"`
+	Quantity  int        `json:"quantity" binding:"required,min=1,max=100"`
+}
+
+// AddCartBundleRequest adds Quantity of a bundle to the caller's cart.
+type AddCartBundleRequest struct {
+	Slug     string `json:"slug" binding:"required"`
+	Quantity int    `json:"quantity" binding:"required,min=1,max=100"`
+}
+
+type UpdateCartItemRequest struct {
+	Quantity int `json:"quantity" binding:"required,min=1,max=100"`
+}
+
+// TaxRateRequest creates or replaces a tax rate. Country is an ISO 3166-1
+// alpha-2 code, or empty for the default rate.
+type TaxRateRequest struct {
+	Country     string  `json:"country" binding:"omitempty,len=2,alpha"`
+	Region      string  `json:"region" binding:"max=100"`
+	Postcode    string  `json:"postcode" binding:"max=20"`
+	Rate        float64 `json:"rate" binding:"gte=0,lt=1"`
+	IsInclusive bool    `json:"is_inclusive"`
+}
+
+type ApplyCouponRequest struct {
+	Code string `json:"code" binding:"required,max=50"`
+}
+
+// AddProductImageRequest adds an image by URL or, with MediaID, one that
+// was uploaded; MediaID takes precedence.
+type AddProductImageRequest struct {
+	URL     string     `json:"url" binding:"required_without=MediaID,omitempty,url,max=512"`
+	MediaID *uuid.UUID `json:"media_id"`
+	AltText string     `json:"alt_text" binding:"max=255"`
+}
+
+// ReorderProductImagesRequest lists every image of the product in its new
+// order.
+type ReorderProductImagesRequest struct {
+	ImageIDs []uuid.UUID `json:"image_ids" binding:"required"`
+}
+
+type ProductAttributeRequest struct {
+	Name  string `json:"name" binding:"required,max=100"`
+	Value string `json:"value" binding:"required,max=255"`
+}
+
+type AttributeDefinitionRequest struct {
+	Name            string   `json:"name" binding:"required,max=100"`
+	AllowedValues   []string `json:"allowed_values"`
+	IsCaseSensitive bool     `json:"is_case_sensitive"`
+}
+
+type UpdateSubscriptionStatusRequest struct {
+	Status string `json:"status" binding:"required,oneof=active paused cancelled"`
+}
+
+// CreateCommentRequest posts a comment, or a reply to ParentID.
+type CreateCommentRequest struct {
+	Content  string     `json:"content" binding:"required,max=5000"`
+	ParentID *uuid.UUID `json:"parent_id"`
+}
+
+type ReportCommentRequest struct {
+	Reason string `json:"reason" binding:"required,max=1000"`
+}
+
+// UpdateCommentStatusRequest is a moderator's decision on a comment.
+// Override skips the transition rules, e.g. to send a spam comment back to
+// pending.
+type UpdateCommentStatusRequest struct {
+	Status   string `json:"status" binding:"required,oneof=pending approved rejected spam"`
+	Override bool   `json:"override"`
+}
+
+// UpdateOrderStatusRequest moves an order to a new status.
+type UpdateOrderStatusRequest struct {
+	Status OrderStatus `json:"status" binding:"required,oneof=pending confirmed processing shipped delivered cancelled refunded"`
+}
+
 type TokenResponse struct {
-	Token        string    `json:"token"`
-	RefreshToken string    `json:"refresh_token"`
-	ExpiresAt    time.Time `json:"expires_at"`
-	User         User      `json:"user"`
-}
\ No newline at end of file
+	Token            string    `json:"token"`
+	RefreshToken     string    `json:"refresh_token"`
+	ExpiresAt        time.Time `json:"expires_at"`
+	RefreshExpiresAt time.Time `json:"refresh_expires_at"`
+	User             User      `json:"user"`
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestUserAvatarFallsBackToGravatar(t *testing.T) {
+	const gravatar = "https://www.gravatar.com/avatar/0bc83cb571cd1c50ba6f3e8a78ef1346?d=identicon&s=200"
+
+	tests := []struct {
+		name string
+		user User
+		want string
+	}{
+		{"no avatar", User{Email: "MyEmailAddress@example.com "}, gravatar},
+		{"own avatar", User{Email: "myemailaddress@example.com", AvatarURL: "https://images.example.com/a.png"}, "https://images.example.com/a.png"},
+		{"no email either", User{}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := json.Marshal(tt.user)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var out struct {
+				AvatarURL string `json:"avatar_url"`
+			}
+			if err := json.Unmarshal(data, &out); err != nil {
+				t.Fatal(err)
+			}
+			if out.AvatarURL != tt.want {
+				t.Errorf("avatar_url = %q, want %q", out.AvatarURL, tt.want)
+			}
+		})
+	}
+
+	// The fallback is only for responses
+	user := User{Email: "myemailaddress@example.com"}
+	if _, err := json.Marshal(&user); err != nil {
+		t.Fatal(err)
+	}
+	if user.AvatarURL != "" {
+		t.Errorf("marshalling stored %q as the user's avatar", user.AvatarURL)
+	}
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := uuid.New()
+	got, err := DecodeCursor(EncodeCursor(id))
+	if err != nil || got != id {
+		t.Errorf("DecodeCursor(EncodeCursor(%v)) = %v, %v", id, got, err)
+	}
+
+	for _, cursor := range []string{"not base64!", EncodeCursor(id)[:10]} {
+		if _, err := DecodeCursor(cursor); err == nil {
+			t.Errorf("DecodeCursor(%q) succeeded, want an error", cursor)
+		}
+	}
+}
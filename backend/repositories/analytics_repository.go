@@ -0,0 +1,205 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// AnalyticsRepository runs read-only aggregate queries for admin reporting.
+type AnalyticsRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewAnalyticsRepository(db *pgxpool.Pool) *AnalyticsRepository {
+	return &AnalyticsRepository{db: db}
+}
+
+// PeriodTotals returns the totals of the period from from up to to, and of
+// the period from previousFrom up to from, in one pass over each table.
+func (r *AnalyticsRepository) PeriodTotals(ctx context.Context, previousFrom, from, to time.Time) (current, previous models.PeriodTotals, err error) {
+	query := database.Qualify(`
+		SELECT o.revenue, o.orders, o.previous_revenue, o.previous_orders, c.customers, c.previous_customers
+		FROM (
+			SELECT COALESCE(SUM(total_amount) FILTER (WHERE created_at >= $2), 0) AS revenue,
+				   COUNT(*) FILTER (WHERE created_at >= $2) AS orders,
+				   COALESCE(SUM(total_amount) FILTER (WHERE created_at < $2), 0) AS previous_revenue,
+				   COUNT(*) FILTER (WHERE created_at < $2) AS previous_orders
+			FROM {shop}.orders
+			WHERE created_at >= $1 AND created_at < $3
+			  AND status NOT IN ('cancelled', 'refunded')
+		) o, (
+			SELECT COUNT(*) FILTER (WHERE created_at >= $2) AS customers,
+				   COUNT(*) FILTER (WHERE created_at < $2) AS previous_customers
+			FROM {shop}.customers
+			WHERE created_at >= $1 AND created_at < $3
+		) c
+	`)
+
+	err = r.db.QueryRow(ctx, query, previousFrom, from, to).Scan(
+		&current.Revenue,
+		&current.Orders,
+		&previous.Revenue,
+		&previous.Orders,
+		&current.NewCustomers,
+		&previous.NewCustomers,
+	)
+	return current, previous, err
+}
+
+// TopProductsByRevenue ranks products by the revenue of their items in the
+// orders placed from from up to to. Cancelled and refunded orders do not
+// count.
+func (r *AnalyticsRepository) TopProductsByRevenue(ctx context.Context, from, to time.Time, limit int) ([]models.ProductRevenue, error) {
+	query := database.Qualify(`
+		SELECT p.id, p.name, p.slug, SUM(oi.quantity), SUM(oi.price * oi.quantity)
+		FROM {shop}.orders o
+		JOIN {shop}.order_items oi ON oi.order_id = o.id
+		JOIN {shop}.products p ON p.id = oi.product_id
+		WHERE o.created_at >= $1 AND o.created_at < $2
+		  AND o.status NOT IN ('cancelled', 'refunded')
+		GROUP BY p.id, p.name, p.slug
+		ORDER BY SUM(oi.price * oi.quantity) DESC, p.name
+		LIMIT $3
+	`)
+
+	rows, err := r.db.Query(ctx, query, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []models.ProductRevenue{}
+	for rows.Next() {
+		var product models.ProductRevenue
+		if err := rows.Scan(&product.ProductID, &product.Name, &product.Slug, &product.UnitsSold, &product.Revenue); err != nil {
+			return nil, err
+		}
+		products = append(products, product)
+	}
+
+	return products, rows.Err()
+}
+
+// TopCustomersByLTV ranks customers by the sum of their non-cancelled order
+// totals. When since is set only orders placed from that time onwards count.
+func (r *AnalyticsRepository) TopCustomersByLTV(ctx context.Context, limit int, since *time.Time) ([]models.CustomerLTV, error) {
+	query := database.Qualify(`
+		SELECT c.id, COALESCE(u.email, ''), COALESCE(u.full_name, ''),
+			   COUNT(o.id), SUM(o.total_amount), AVG(o.total_amount),
+			   MIN(o.created_at), MAX(o.created_at)
+		FROM {shop}.orders o
+		JOIN {shop}.customers c ON o.customer_id = c.id
+		LEFT JOIN {auth}.users u ON c.user_id = u.id
+		WHERE o.status <> 'cancelled'
+		  AND ($2::timestamptz IS NULL OR o.created_at >= $2)
+		GROUP BY c.id, u.email, u.full_name
+		ORDER BY SUM(o.total_amount) DESC
+		LIMIT $1
+	`)
+
+	rows, err := r.db.Query(ctx, query, limit, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	customers := []models.CustomerLTV{}
+	for rows.Next() {
+		var ltv models.CustomerLTV
+		if err := rows.Scan(
+			&ltv.CustomerID,
+			&ltv.Email,
+			&ltv.FullName,
+			&ltv.OrderCount,
+			&ltv.TotalSpent,
+			&ltv.AvgOrderValue,
+			&ltv.FirstOrderAt,
+			&ltv.LastOrderAt,
+		); err != nil {
+			return nil, err
+		}
+		customers = append(customers, ltv)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return customers, nil
+}
+
+// CustomerOrderSummary fills in the order totals, first and last order and
+// most used payment method of the customer's non-cancelled orders. Returns
+// nil if the customer does not exist.
+func (r *AnalyticsRepository) CustomerOrderSummary(ctx context.Context, customerID uuid.UUID) (*models.CustomerAnalytics, error) {
+	query := database.Qualify(`
+		SELECT MIN(o.created_at), MAX(o.created_at), COUNT(o.id), COALESCE(SUM(o.total_amount), 0),
+			   (SELECT payment_method
+				FROM {shop}.orders
+				WHERE customer_id = c.id AND status <> 'cancelled'
+				GROUP BY payment_method
+				ORDER BY COUNT(*) DESC, MAX(created_at) DESC
+				LIMIT 1)
+		FROM {shop}.customers c
+		LEFT JOIN {shop}.orders o ON o.customer_id = c.id AND o.status <> 'cancelled'
+		WHERE c.id = $1
+		GROUP BY c.id
+	`)
+
+	analytics := models.CustomerAnalytics{CustomerID: customerID}
+	err := r.db.QueryRow(ctx, query, customerID).Scan(
+		&analytics.FirstOrderAt,
+		&analytics.LastOrderAt,
+		&analytics.TotalOrders,
+		&analytics.TotalSpent,
+		&analytics.PreferredPaymentMethod,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &analytics, nil
+}
+
+// CustomerProductStats returns the product the customer bought the most
+// units of, nil if none, and how many products they bought in more than one
+// order. Only non-cancelled orders count.
+func (r *AnalyticsRepository) CustomerProductStats(ctx context.Context, customerID uuid.UUID) (*models.PurchasedProduct, int, error) {
+	query := database.Qualify(`
+		WITH purchases AS (
+			SELECT oi.product_id, SUM(oi.quantity) AS units, COUNT(DISTINCT o.id) AS orders
+			FROM {shop}.order_items oi
+			JOIN {shop}.orders o ON oi.order_id = o.id
+			WHERE o.customer_id = $1 AND o.status <> 'cancelled' AND oi.product_id IS NOT NULL
+			GROUP BY oi.product_id
+		)
+		SELECT p.product_id, COALESCE(pr.name, ''), p.units,
+			   (SELECT COUNT(*) FROM purchases WHERE orders > 1)
+		FROM purchases p
+		LEFT JOIN {shop}.products pr ON p.product_id = pr.id
+		ORDER BY p.units DESC, pr.name
+		LIMIT 1
+	`)
+
+	var product models.PurchasedProduct
+	var repeatCount int
+	err := r.db.QueryRow(ctx, query, customerID).Scan(&product.ProductID, &product.Name, &product.TotalUnits, &repeatCount)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, 0, nil
+		}
+		return nil, 0, err
+	}
+
+	return &product, repeatCount, nil
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+)
+
+// Only non-cancelled orders from since onwards count towards a customer's
+// lifetime value. The orders are dated in 2099 so that since leaves out the
+// rest of the database.
+func TestTopCustomersByLTV(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	analytics := NewAnalyticsRepository(pool)
+
+	day := func(month time.Month, d int) time.Time { return time.Date(2099, month, d, 12, 0, 0, 0, time.UTC) }
+	loyal, _ := createTestCustomer(t, pool)
+	createTestOrder(t, pool, loyal.ID, "delivered", 100, day(2, 2))
+	createTestOrder(t, pool, loyal.ID, "confirmed", 50, day(2, 3))
+	createTestOrder(t, pool, loyal.ID, "cancelled", 1000, day(2, 4))
+	createTestOrder(t, pool, loyal.ID, "delivered", 500, day(1, 15))
+	newcomer, _ := createTestCustomer(t, pool)
+	createTestOrder(t, pool, newcomer.ID, "delivered", 120, day(2, 5))
+
+	since := day(2, 1)
+	customers, err := analytics.TopCustomersByLTV(ctx, 10, &since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(customers) != 2 {
+		t.Fatalf("TopCustomersByLTV = %d customers, want 2", len(customers))
+	}
+
+	first, second := customers[0], customers[1]
+	if first.CustomerID != loyal.ID || second.CustomerID != newcomer.ID {
+		t.Fatalf("ranking = %s, %s; want the loyal customer first", first.CustomerID, second.CustomerID)
+	}
+	if first.OrderCount != 2 || first.TotalSpent != 150 || first.AvgOrderValue != 75 {
+		t.Errorf("loyal customer = %d orders, %v spent, %v average; want 2, 150, 75", first.OrderCount, first.TotalSpent, first.AvgOrderValue)
+	}
+	if !first.FirstOrderAt.Equal(day(2, 2)) || !first.LastOrderAt.Equal(day(2, 3)) {
+		t.Errorf("loyal customer ordered from %v to %v, want %v to %v", first.FirstOrderAt, first.LastOrderAt, day(2, 2), day(2, 3))
+	}
+	if second.OrderCount != 1 || second.TotalSpent != 120 {
+		t.Errorf("newcomer = %d orders, %v spent; want 1, 120", second.OrderCount, second.TotalSpent)
+	}
+
+	since = day(1, 1)
+	customers, err = analytics.TopCustomersByLTV(ctx, 1, &since)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(customers) != 1 || customers[0].CustomerID != loyal.ID || customers[0].TotalSpent != 650 {
+		t.Errorf("top customer since January = %+v, want the loyal customer at 650", customers)
+	}
+}
@@ -0,0 +1,118 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// apiKeyColumns selects an API key, to be scanned by scanAPIKey.
+const apiKeyColumns = `id, user_id, key_hash, label, scopes, last_used_at, expires_at, created_at`
+
+type APIKeyRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewAPIKeyRepository(db *pgxpool.Pool) *APIKeyRepository {
+	return &APIKeyRepository{db: db}
+}
+
+func (r *APIKeyRepository) Create(ctx context.Context, key *models.APIKey) error {
+	return r.db.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {auth}.api_keys (user_id, key_hash, label, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`), key.UserID, key.KeyHash, key.Label, key.Scopes, key.ExpiresAt).Scan(&key.ID, &key.CreatedAt)
+}
+
+// GetByHash returns the key with the given hash, or nil if there is none.
+func (r *APIKeyRepository) GetByHash(ctx context.Context, keyHash string) (*models.APIKey, error) {
+	row := r.db.QueryRow(ctx, database.Qualify(`
+		SELECT `+apiKeyColumns+`
+		FROM {auth}.api_keys
+		WHERE key_hash = $1
+	`), keyHash)
+
+	key, err := scanAPIKey(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return key, nil
+}
+
+// ListForUser returns the user's keys, newest first.
+func (r *APIKeyRepository) ListForUser(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT `+apiKeyColumns+`
+		FROM {auth}.api_keys
+		WHERE user_id = $1
+		ORDER BY created_at DESC
+	`), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*models.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+// TouchLastUsed sets the key's last use to now. A key used within the last
+// minute is left alone, so busy keys do not cost a write per request.
+func (r *APIKeyRepository) TouchLastUsed(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, database.Qualify(`
+		UPDATE {auth}.api_keys
+		SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')
+	`), id)
+	return err
+}
+
+// Delete revokes one of the user's keys. Keys of other users are reported
+// as not found.
+func (r *APIKeyRepository) Delete(ctx context.Context, id, userID uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`DELETE FROM {auth}.api_keys WHERE id = $1 AND user_id = $2`), id, userID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrAPIKeyNotFound
+	}
+	return nil
+}
+
+func scanAPIKey(row pgx.Row) (*models.APIKey, error) {
+	var key models.APIKey
+	err := row.Scan(
+		&key.ID,
+		&key.UserID,
+		&key.KeyHash,
+		&key.Label,
+		&key.Scopes,
+		&key.LastUsedAt,
+		&key.ExpiresAt,
+		&key.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
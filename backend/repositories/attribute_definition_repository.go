@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+type AttributeDefinitionRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewAttributeDefinitionRepository(db *pgxpool.Pool) *AttributeDefinitionRepository {
+	return &AttributeDefinitionRepository{db: db}
+}
+
+func (r *AttributeDefinitionRepository) List(ctx context.Context) ([]*models.AttributeDefinition, error) {
+	query := database.Qualify(`
+		SELECT id, name, allowed_values, is_case_sensitive, created_at, updated_at
+		FROM {shop}.attribute_definitions
+		ORDER BY name
+	`)
+
+	return r.query(ctx, query)
+}
+
+func (r *AttributeDefinitionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.AttributeDefinition, error) {
+	query := database.Qualify(`
+		SELECT id, name, allowed_values, is_case_sensitive, created_at, updated_at
+		FROM {shop}.attribute_definitions
+		WHERE id = $1
+	`)
+
+	var def models.AttributeDefinition
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&def.ID,
+		&def.Name,
+		&def.AllowedValues,
+		&def.IsCaseSensitive,
+		&def.CreatedAt,
+		&def.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &def, nil
+}
+
+// GetByNames returns the definitions for the given attribute names, keyed by
+// lowercased name. Names without a definition are absent from the map.
+func (r *AttributeDefinitionRepository) GetByNames(ctx context.Context, names []string) (map[string]*models.AttributeDefinition, error) {
+	lowered := make([]string, 0, len(names))
+	for _, name := range names {
+		lowered = append(lowered, strings.ToLower(name))
+	}
+
+	query := database.Qualify(`
+		SELECT id, name, allowed_values, is_case_sensitive, created_at, updated_at
+		FROM {shop}.attribute_definitions
+		WHERE LOWER(name) = ANY($1)
+	`)
+
+	defs, err := r.query(ctx, query, lowered)
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]*models.AttributeDefinition, len(defs))
+	for _, def := range defs {
+		byName[strings.ToLower(def.Name)] = def
+	}
+
+	return byName, nil
+}
+
+func (r *AttributeDefinitionRepository) Create(ctx context.Context, def *models.AttributeDefinition) error {
+	query := database.Qualify(`
+		INSERT INTO {shop}.attribute_definitions (name, allowed_values, is_case_sensitive)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at, updated_at
+	`)
+
+	return r.db.QueryRow(ctx, query, def.Name, def.AllowedValues, def.IsCaseSensitive).
+		Scan(&def.ID, &def.CreatedAt, &def.UpdatedAt)
+}
+
+func (r *AttributeDefinitionRepository) Update(ctx context.Context, def *models.AttributeDefinition) error {
+	query := database.Qualify(`
+		UPDATE {shop}.attribute_definitions
+		SET name = $1, allowed_values = $2, is_case_sensitive = $3
+		WHERE id = $4
+		RETURNING updated_at
+	`)
+
+	return r.db.QueryRow(ctx, query, def.Name, def.AllowedValues, def.IsCaseSensitive, def.ID).
+		Scan(&def.UpdatedAt)
+}
+
+func (r *AttributeDefinitionRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, database.Qualify("DELETE FROM {shop}.attribute_definitions WHERE id = $1"), id)
+	return err
+}
+
+func (r *AttributeDefinitionRepository) query(ctx context.Context, query string, args ...interface{}) ([]*models.AttributeDefinition, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	defs := []*models.AttributeDefinition{}
+	for rows.Next() {
+		var def models.AttributeDefinition
+		if err := rows.Scan(
+			&def.ID,
+			&def.Name,
+			&def.AllowedValues,
+			&def.IsCaseSensitive,
+			&def.CreatedAt,
+			&def.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		defs = append(defs, &def)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return defs, nil
+}
@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// AuditRepository reads and writes the audit log.
+type AuditRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewAuditRepository(db *pgxpool.Pool) *AuditRepository {
+	return &AuditRepository{db: db}
+}
+
+// Create writes an audit entry on its own, outside any transaction.
+func (r *AuditRepository) Create(ctx context.Context, entry *models.AuditLog) error {
+	return insertAuditLog(ctx, r.db, entry)
+}
+
+// List returns a page of the audit entries for an entity type, and for one
+// entity of it when entityID is set, newest first.
+func (r *AuditRepository) List(ctx context.Context, entityType, entityID string, limit, offset int) ([]*models.AuditLog, int, error) {
+	where := []string{"entity_type = $1"}
+	args := []interface{}{entityType}
+	if entityID != "" {
+		args = append(args, entityID)
+		where = append(where, fmt.Sprintf("entity_id = $%d", len(args)))
+	}
+	args = append(args, limit, offset)
+
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT id, actor_id, action, entity_type, entity_id, details, old_value, new_value, changed_fields, created_at,
+			   COUNT(*) OVER()
+		FROM {cms}.audit_logs
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY created_at DESC, id
+		LIMIT `+fmt.Sprintf("$%d OFFSET $%d", len(args)-1, len(args))), args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	return scanAuditLogs(rows)
+}
+
+func scanAuditLogs(rows pgx.Rows) ([]*models.AuditLog, int, error) {
+	entries := []*models.AuditLog{}
+	total := 0
+	for rows.Next() {
+		var entry models.AuditLog
+		var detailsJSON, oldJSON, newJSON []byte
+		if err := rows.Scan(
+			&entry.ID, &entry.ActorID, &entry.Action, &entry.EntityType, &entry.EntityID,
+			&detailsJSON, &oldJSON, &newJSON, &entry.ChangedFields, &entry.CreatedAt, &total,
+		); err != nil {
+			return nil, 0, err
+		}
+		if err := unmarshalJSONObject(detailsJSON, &entry.Details); err != nil {
+			return nil, 0, err
+		}
+		if err := unmarshalJSONObject(oldJSON, &entry.OldValue); err != nil {
+			return nil, 0, err
+		}
+		if err := unmarshalJSONObject(newJSON, &entry.NewValue); err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	return entries, total, rows.Err()
+}
+
+// unmarshalJSONObject decodes a nullable JSONB object column.
+func unmarshalJSONObject(data []byte, dst *map[string]interface{}) error {
+	if data == nil {
+		return nil
+	}
+	return json.Unmarshal(data, dst)
+}
+
+// insertAuditLog writes an audit entry with db, which may be a transaction so
+// that the entry is only kept if the audited change commits.
+func insertAuditLog(ctx context.Context, db dbtx, entry *models.AuditLog) error {
+	details := entry.Details
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	changedFields := entry.ChangedFields
+	if changedFields == nil {
+		changedFields = []string{}
+	}
+	// Entries without a diff store NULL rather than a JSON null
+	var oldValue, newValue interface{}
+	if entry.OldValue != nil {
+		oldValue = entry.OldValue
+	}
+	if entry.NewValue != nil {
+		newValue = entry.NewValue
+	}
+
+	return db.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {cms}.audit_logs (actor_id, action, entity_type, entity_id, details, old_value, new_value, changed_fields)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`),
+		entry.ActorID,
+		entry.Action,
+		entry.EntityType,
+		entry.EntityID,
+		details,
+		oldValue,
+		newValue,
+		changedFields,
+	).Scan(&entry.ID, &entry.CreatedAt)
+}
@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+type BundleRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewBundleRepository(db *pgxpool.Pool) *BundleRepository {
+	return &BundleRepository{db: db}
+}
+
+// GetBySlug returns the active bundle with its items, or nil. Each item's
+// product carries the fields needed to price and display it.
+func (r *BundleRepository) GetBySlug(ctx context.Context, slug string) (*models.ProductBundle, error) {
+	var bundle models.ProductBundle
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		SELECT id, name, slug, description, bundle_price, bundle_discount_percent, is_active, created_at, updated_at
+		FROM {shop}.product_bundles
+		WHERE slug = $1 AND is_active
+	`), slug).Scan(
+		&bundle.ID,
+		&bundle.Name,
+		&bundle.Slug,
+		&bundle.Description,
+		&bundle.BundlePrice,
+		&bundle.BundleDiscountPercent,
+		&bundle.IsActive,
+		&bundle.CreatedAt,
+		&bundle.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT p.id, p.name, p.slug, p.price, p.sale_price, p.sku, p.stock, p.type, p.status, bi.quantity
+		FROM {shop}.product_bundle_items bi
+		JOIN {shop}.products p ON p.id = bi.product_id
+		WHERE bi.bundle_id = $1
+		ORDER BY p.name
+	`), bundle.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bundle.Items = []*models.ProductBundleItem{}
+	for rows.Next() {
+		var product models.Product
+		item := &models.ProductBundleItem{Product: &product}
+		if err := rows.Scan(
+			&product.ID, &product.Name, &product.Slug, &product.Price, &product.SalePrice,
+			&product.SKU, &product.Stock, &product.Type, &product.Status, &item.Quantity,
+		); err != nil {
+			return nil, err
+		}
+		bundle.Items = append(bundle.Items, item)
+	}
+
+	return &bundle, rows.Err()
+}
@@ -0,0 +1,327 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var (
+	ErrCartItemNotFound = errors.New("cart item not found")
+	ErrCartBundleItem   = errors.New("the items of a bundle can only be removed together")
+)
+
+type CartRepository struct {
+	db      *pgxpool.Pool
+	tracker *database.TransactionTracker
+}
+
+func NewCartRepository(db *pgxpool.Pool, tracker *database.TransactionTracker) *CartRepository {
+	return &CartRepository{db: db, tracker: tracker}
+}
+
+// GetOrCreate returns the user's cart, without its items, creating an empty
+// one if the user has none.
+func (r *CartRepository) GetOrCreate(ctx context.Context, userID uuid.UUID) (*models.Cart, error) {
+	// The no-op update makes RETURNING yield the existing row on conflict
+	cart := models.Cart{Items: []*models.CartItem{}}
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {shop}.carts (user_id)
+		VALUES ($1)
+		ON CONFLICT (user_id) DO UPDATE SET user_id = EXCLUDED.user_id
+		RETURNING id, user_id, created_at, updated_at
+	`), userID).Scan(&cart.ID, &cart.UserID, &cart.CreatedAt, &cart.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &cart, nil
+}
+
+// GetWithItems returns the cart with its applied coupon and its items,
+// oldest first, each with the product's name, slug and image and the
+// variant's SKU and attributes. It returns nil for an unknown cart.
+func (r *CartRepository) GetWithItems(ctx context.Context, cartID uuid.UUID) (*models.Cart, error) {
+	cart := models.Cart{Items: []*models.CartItem{}}
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		SELECT c.id, c.user_id, c.coupon_id, COALESCE(co.code, ''), c.created_at, c.updated_at
+		FROM {shop}.carts c
+		LEFT JOIN {shop}.coupons co ON co.id = c.coupon_id
+		WHERE c.id = $1
+	`), cartID).Scan(&cart.ID, &cart.UserID, &cart.CouponID, &cart.CouponCode, &cart.CreatedAt, &cart.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT ci.id, ci.cart_id, ci.product_id, ci.variant_id, ci.bundle_id, ci.quantity, ci.unit_price,
+			   ci.created_at, ci.updated_at,
+			   p.name, p.slug, p.stock, p.status,
+			   v.sku, v.attributes, v.stock
+		FROM {shop}.cart_items ci
+		JOIN {shop}.products p ON p.id = ci.product_id
+		LEFT JOIN {shop}.product_variants v ON v.id = ci.variant_id
+		WHERE ci.cart_id = $1
+		ORDER BY ci.created_at, ci.id
+	`), cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item := models.CartItem{Product: &models.Product{}}
+		var variantSKU *string
+		var variantAttributes map[string]string
+		var variantStock *int
+		if err := rows.Scan(
+			&item.ID, &item.CartID, &item.ProductID, &item.VariantID, &item.BundleID, &item.Quantity, &item.UnitPrice,
+			&item.CreatedAt, &item.UpdatedAt,
+			&item.Product.Name, &item.Product.Slug, &item.Product.Stock, &item.Product.Status,
+			&variantSKU, &variantAttributes, &variantStock,
+		); err != nil {
+			return nil, err
+		}
+		item.Product.ID = item.ProductID
+		if item.VariantID != nil {
+			item.Variant = &models.ProductVariant{
+				ID:         *item.VariantID,
+				ProductID:  item.ProductID,
+				SKU:        *variantSKU,
+				Attributes: variantAttributes,
+				Stock:      *variantStock,
+			}
+		}
+		cart.Items = append(cart.Items, &item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &cart, nil
+}
+
+// AddItem adds item.Quantity of the product, or of its variant, to the
+// cart, or adds to the quantity already there, at item.UnitPrice. The item
+// is filled in with the resulting line. The cart and the product's or
+// variant's row are locked, so concurrent adds of the last units cannot both
+// succeed: the one that would take the cart past the stock gets
+// ErrOutOfStock and the cart is left alone.
+func (r *CartRepository) AddItem(ctx context.Context, item *models.CartItem) error {
+	return r.AddItems(ctx, item.CartID, []*models.CartItem{item})
+}
+
+// AddItems adds the items to the cart in one transaction, as AddItem does
+// for one, so that the lines of a bundle are added all together or not at
+// all.
+func (r *CartRepository) AddItems(ctx context.Context, cartID uuid.UUID, items []*models.CartItem) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		if err := lockCart(ctx, tx, cartID); err != nil {
+			return err
+		}
+		for _, item := range items {
+			item.CartID = cartID
+			if err := addCartLine(ctx, tx, item); err != nil {
+				return err
+			}
+		}
+		return touchCart(ctx, tx, cartID)
+	})
+}
+
+// addCartLine adds the item to its line of the locked cart, the one for the
+// same product, variant and bundle, creating the line if there is none. The
+// stock is checked against every line of the product or variant, so a
+// product bought both alone and in a bundle cannot exceed it either.
+func addCartLine(ctx context.Context, tx pgx.Tx, item *models.CartItem) error {
+	stock, err := lockStock(ctx, tx, item.ProductID, item.VariantID)
+	if err != nil {
+		return err
+	}
+	inCart, err := cartQuantity(ctx, tx, item.CartID, item.ProductID, item.VariantID)
+	if err != nil {
+		return err
+	}
+	if inCart+item.Quantity > stock {
+		return ErrOutOfStock
+	}
+
+	var existingID uuid.UUID
+	var existingQuantity int
+	err = tx.QueryRow(ctx, database.Qualify(`
+		SELECT id, quantity
+		FROM {shop}.cart_items
+		WHERE cart_id = $1 AND product_id = $2 AND variant_id IS NOT DISTINCT FROM $3
+			AND bundle_id IS NOT DISTINCT FROM $4
+	`), item.CartID, item.ProductID, item.VariantID, item.BundleID).Scan(&existingID, &existingQuantity)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	quantity := existingQuantity + item.Quantity
+	if existingID == uuid.Nil {
+		err = tx.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.cart_items (cart_id, product_id, variant_id, bundle_id, quantity, unit_price)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at, updated_at
+		`), item.CartID, item.ProductID, item.VariantID, item.BundleID, quantity, item.UnitPrice).Scan(
+			&item.ID, &item.CreatedAt, &item.UpdatedAt,
+		)
+	} else {
+		item.ID = existingID
+		err = tx.QueryRow(ctx, database.Qualify(`
+			UPDATE {shop}.cart_items
+			SET quantity = $1, unit_price = $2, updated_at = NOW()
+			WHERE id = $3
+			RETURNING created_at, updated_at
+		`), quantity, item.UnitPrice, item.ID).Scan(&item.CreatedAt, &item.UpdatedAt)
+	}
+	if err != nil {
+		return err
+	}
+	item.Quantity = quantity
+
+	return nil
+}
+
+// UpdateItemQty sets the quantity of one of the cart's items, failing with
+// ErrOutOfStock if the cart would then hold more than is in stock. The
+// items of a bundle cannot be changed one by one: they give
+// ErrCartBundleItem.
+func (r *CartRepository) UpdateItemQty(ctx context.Context, cartID, itemID uuid.UUID, quantity int) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		if err := lockCart(ctx, tx, cartID); err != nil {
+			return err
+		}
+
+		var productID uuid.UUID
+		var variantID, bundleID *uuid.UUID
+		var current int
+		err := tx.QueryRow(ctx, database.Qualify(`
+			SELECT product_id, variant_id, bundle_id, quantity
+			FROM {shop}.cart_items
+			WHERE id = $1 AND cart_id = $2
+		`), itemID, cartID).Scan(&productID, &variantID, &bundleID, &current)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrCartItemNotFound
+			}
+			return err
+		}
+		if bundleID != nil {
+			return ErrCartBundleItem
+		}
+
+		stock, err := lockStock(ctx, tx, productID, variantID)
+		if err != nil {
+			return err
+		}
+		inCart, err := cartQuantity(ctx, tx, cartID, productID, variantID)
+		if err != nil {
+			return err
+		}
+		if inCart-current+quantity > stock {
+			return ErrOutOfStock
+		}
+
+		_, err = tx.Exec(ctx, database.Qualify(`
+			UPDATE {shop}.cart_items SET quantity = $1, updated_at = NOW() WHERE id = $2
+		`), quantity, itemID)
+		if err != nil {
+			return err
+		}
+
+		return touchCart(ctx, tx, cartID)
+	})
+}
+
+// RemoveItem removes one of the cart's items. Removing an item of a bundle
+// removes the whole bundle.
+func (r *CartRepository) RemoveItem(ctx context.Context, cartID, itemID uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`
+		DELETE FROM {shop}.cart_items ci
+		USING {shop}.cart_items removed
+		WHERE removed.id = $1 AND removed.cart_id = $2 AND ci.cart_id = removed.cart_id
+			AND (ci.id = removed.id OR ci.bundle_id = removed.bundle_id)
+	`), itemID, cartID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCartItemNotFound
+	}
+	return nil
+}
+
+// Clear empties the cart.
+func (r *CartRepository) Clear(ctx context.Context, cartID uuid.UUID) error {
+	_, err := r.db.Exec(ctx, database.Qualify(`DELETE FROM {shop}.cart_items WHERE cart_id = $1`), cartID)
+	return err
+}
+
+// SetCoupon applies the coupon to the cart, replacing any other. A nil
+// couponID removes the cart's coupon.
+func (r *CartRepository) SetCoupon(ctx context.Context, cartID uuid.UUID, couponID *uuid.UUID) error {
+	_, err := r.db.Exec(ctx, database.Qualify(`
+		UPDATE {shop}.carts SET coupon_id = $2, updated_at = NOW() WHERE id = $1
+	`), cartID, couponID)
+	return err
+}
+
+// lockCart locks the cart's row so that changes to its items are made one
+// at a time.
+func lockCart(ctx context.Context, tx pgx.Tx, cartID uuid.UUID) error {
+	var id uuid.UUID
+	err := tx.QueryRow(ctx, database.Qualify(`
+		SELECT id FROM {shop}.carts WHERE id = $1 FOR UPDATE
+	`), cartID).Scan(&id)
+	return err
+}
+
+func touchCart(ctx context.Context, tx pgx.Tx, cartID uuid.UUID) error {
+	_, err := tx.Exec(ctx, database.Qualify(`UPDATE {shop}.carts SET updated_at = NOW() WHERE id = $1`), cartID)
+	return err
+}
+
+// cartQuantity returns how many of the variant, or of the product when
+// variantID is nil, the cart holds across all its lines.
+func cartQuantity(ctx context.Context, tx pgx.Tx, cartID, productID uuid.UUID, variantID *uuid.UUID) (int, error) {
+	var quantity int
+	err := tx.QueryRow(ctx, database.Qualify(`
+		SELECT COALESCE(SUM(quantity), 0)
+		FROM {shop}.cart_items
+		WHERE cart_id = $1 AND product_id = $2 AND variant_id IS NOT DISTINCT FROM $3
+	`), cartID, productID, variantID).Scan(&quantity)
+	return quantity, err
+}
+
+// lockStock locks the row holding the stock of the variant, or of the
+// product when variantID is nil, until tx ends, and returns the stock. A
+// variant of another product is not found.
+func lockStock(ctx context.Context, tx pgx.Tx, productID uuid.UUID, variantID *uuid.UUID) (int, error) {
+	var stock int
+	if variantID != nil {
+		err := tx.QueryRow(ctx, database.Qualify(`
+			SELECT stock FROM {shop}.product_variants WHERE id = $1 AND product_id = $2 FOR UPDATE
+		`), *variantID, productID).Scan(&stock)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrProductVariantNotFound
+		}
+		return stock, err
+	}
+
+	err := tx.QueryRow(ctx, database.Qualify(`
+		SELECT stock FROM {shop}.products WHERE id = $1 FOR UPDATE
+	`), productID).Scan(&stock)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrProductNotFound
+	}
+	return stock, err
+}
@@ -0,0 +1,235 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var ErrCategoryHasChildren = errors.New("category has child categories")
+
+// CategoryRepository manages blog categories, which form a tree through
+// parent_id.
+type CategoryRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewCategoryRepository(db *pgxpool.Pool) *CategoryRepository {
+	return &CategoryRepository{db: db}
+}
+
+func (r *CategoryRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Category, error) {
+	return r.getOne(ctx, "id", id)
+}
+
+func (r *CategoryRepository) GetBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	return r.getOne(ctx, "slug", slug)
+}
+
+func (r *CategoryRepository) getOne(ctx context.Context, column string, value interface{}) (*models.Category, error) {
+	query := database.Qualify(`
+		SELECT id, name, slug, COALESCE(description, ''), parent_id, created_at, updated_at
+		FROM {blog}.categories
+		WHERE ` + column + ` = $1
+	`)
+
+	var category models.Category
+	err := r.db.QueryRow(ctx, query, value).Scan(
+		&category.ID,
+		&category.Name,
+		&category.Slug,
+		&category.Description,
+		&category.ParentID,
+		&category.CreatedAt,
+		&category.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+// GetTree returns the root categories with their descendants nested in
+// Children and each category's slug path filled in.
+func (r *CategoryRepository) GetTree(ctx context.Context) ([]*models.Category, error) {
+	query := database.Qualify(`
+		WITH RECURSIVE tree AS (
+			SELECT id, name, slug, description, parent_id, created_at, updated_at, 0 AS depth
+			FROM {blog}.categories
+			WHERE parent_id IS NULL
+			UNION ALL
+			SELECT c.id, c.name, c.slug, c.description, c.parent_id, c.created_at, c.updated_at, t.depth + 1
+			FROM {blog}.categories c
+			JOIN tree t ON c.parent_id = t.id
+		)
+		SELECT id, name, slug, COALESCE(description, ''), parent_id, created_at, updated_at
+		FROM tree
+		ORDER BY depth, name
+	`)
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []*models.Category{}
+	for rows.Next() {
+		var category models.Category
+		if err := rows.Scan(
+			&category.ID,
+			&category.Name,
+			&category.Slug,
+			&category.Description,
+			&category.ParentID,
+			&category.CreatedAt,
+			&category.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		categories = append(categories, &category)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return buildCategoryTree(categories), nil
+}
+
+// GetBreadcrumb returns the path from the root category down to the given
+// one, root first. It is empty if the category does not exist.
+func (r *CategoryRepository) GetBreadcrumb(ctx context.Context, categoryID uuid.UUID) ([]*models.Category, error) {
+	query := database.Qualify(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, name, slug, description, parent_id, created_at, updated_at, 0 AS depth
+			FROM {blog}.categories
+			WHERE id = $1
+			UNION ALL
+			SELECT c.id, c.name, c.slug, c.description, c.parent_id, c.created_at, c.updated_at, a.depth + 1
+			FROM {blog}.categories c
+			JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT id, name, slug, COALESCE(description, ''), parent_id, created_at, updated_at
+		FROM ancestors
+		ORDER BY depth DESC
+	`)
+
+	rows, err := r.db.Query(ctx, query, categoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	path := []*models.Category{}
+	for rows.Next() {
+		var category models.Category
+		if err := rows.Scan(
+			&category.ID,
+			&category.Name,
+			&category.Slug,
+			&category.Description,
+			&category.ParentID,
+			&category.CreatedAt,
+			&category.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		path = append(path, &category)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return path, nil
+}
+
+// GetDescendantIDs returns the ID of the category and of every category
+// below it.
+func (r *CategoryRepository) GetDescendantIDs(ctx context.Context, id uuid.UUID) ([]uuid.UUID, error) {
+	query := database.Qualify(`
+		WITH RECURSIVE descendants AS (
+			SELECT id FROM {blog}.categories WHERE id = $1
+			UNION ALL
+			SELECT c.id
+			FROM {blog}.categories c
+			JOIN descendants d ON c.parent_id = d.id
+		)
+		SELECT id FROM descendants
+	`)
+
+	rows, err := r.db.Query(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var descendantID uuid.UUID
+		if err := rows.Scan(&descendantID); err != nil {
+			return nil, err
+		}
+		ids = append(ids, descendantID)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// Delete removes a category. Categories that still have children are
+// refused with ErrCategoryHasChildren.
+func (r *CategoryRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	var hasChildren bool
+	err := r.db.QueryRow(ctx, database.Qualify(`SELECT EXISTS (SELECT 1 FROM {blog}.categories WHERE parent_id = $1)`), id).Scan(&hasChildren)
+	if err != nil {
+		return err
+	}
+	if hasChildren {
+		return ErrCategoryHasChildren
+	}
+
+	_, err = r.db.Exec(ctx, database.Qualify("DELETE FROM {blog}.categories WHERE id = $1"), id)
+	return err
+}
+
+// buildCategoryTree nests categories under their parents. Parents must come
+// before their children in the input, as they do when ordered by depth.
+func buildCategoryTree(categories []*models.Category) []*models.Category {
+	byID := make(map[uuid.UUID]*models.Category, len(categories))
+	roots := []*models.Category{}
+
+	for _, category := range categories {
+		byID[category.ID] = category
+
+		var parent *models.Category
+		if category.ParentID != nil {
+			parent = byID[*category.ParentID]
+		}
+
+		if parent == nil {
+			category.Path = category.Slug
+			roots = append(roots, category)
+			continue
+		}
+
+		category.Path = parent.Path + "/" + category.Slug
+		parent.Children = append(parent.Children, category)
+	}
+
+	return roots
+}
@@ -0,0 +1,137 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+func TestBuildCategoryTree(t *testing.T) {
+	category := func(slug string, parent *models.Category) *models.Category {
+		c := &models.Category{ID: uuid.New(), Name: slug, Slug: slug}
+		if parent != nil {
+			c.ParentID = &parent.ID
+		}
+		return c
+	}
+	tech := category("tech", nil)
+	golang := category("golang", tech)
+	tips := category("tips", golang)
+	rust := category("rust", tech)
+	travel := category("travel", nil)
+
+	// Ordered by depth, as GetTree reads them
+	roots := buildCategoryTree([]*models.Category{tech, travel, golang, rust, tips})
+
+	if len(roots) != 2 || roots[0] != tech || roots[1] != travel {
+		t.Fatalf("roots = %v, want tech and travel", roots)
+	}
+	if len(tech.Children) != 2 || tech.Children[0] != golang || tech.Children[1] != rust {
+		t.Errorf("tech has children %v, want golang and rust", tech.Children)
+	}
+	if len(golang.Children) != 1 || golang.Children[0] != tips {
+		t.Errorf("golang has children %v, want tips", golang.Children)
+	}
+	if len(travel.Children) != 0 || len(tips.Children) != 0 {
+		t.Errorf("leaves have children: travel %v, tips %v", travel.Children, tips.Children)
+	}
+
+	paths := map[*models.Category]string{
+		tech:   "tech",
+		golang: "tech/golang",
+		tips:   "tech/golang/tips",
+		rust:   "tech/rust",
+		travel: "travel",
+	}
+	for c, want := range paths {
+		if c.Path != want {
+			t.Errorf("%s: Path = %q, want %q", c.Slug, c.Path, want)
+		}
+	}
+}
+
+// With a schema prefix set, queries read the prefixed schema and leave the
+// plain one alone.
+func TestQueriesUseSchemaPrefix(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewCategoryRepository(pool)
+
+	prefix := strings.ReplaceAll(dbtest.UniqueName("test"), "-", "") + "_"
+	schema := prefix + "blog"
+	dbtest.Exec(t, pool, "CREATE SCHEMA "+schema)
+	t.Cleanup(func() { dbtest.Exec(t, pool, "DROP SCHEMA "+schema+" CASCADE") })
+	dbtest.Exec(t, pool, "CREATE TABLE "+schema+".categories (LIKE blog.categories INCLUDING DEFAULTS)")
+	slug := dbtest.UniqueName("prefixed")
+	dbtest.Exec(t, pool, "INSERT INTO "+schema+".categories (name, slug) VALUES ($1, $1)", slug)
+
+	if got, err := repo.GetBySlug(ctx, slug); err != nil || got != nil {
+		t.Fatalf("GetBySlug without a prefix = %v, %v; want nil from blog.categories", got, err)
+	}
+
+	if err := database.SetSchemaPrefix(prefix); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.SetSchemaPrefix("") })
+	got, err := repo.GetBySlug(ctx, slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.Slug != slug {
+		t.Errorf("GetBySlug with prefix %s = %v, want the category from %s.categories", prefix, got, schema)
+	}
+}
+
+func TestGetBreadcrumb(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewCategoryRepository(pool)
+
+	// Four levels, each the child of the one before
+	var ids []uuid.UUID
+	var slugs []string
+	for i := 0; i < 4; i++ {
+		slug := dbtest.UniqueName("level")
+		var parentID *uuid.UUID
+		if i > 0 {
+			parentID = &ids[i-1]
+		}
+		var id uuid.UUID
+		if err := pool.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {blog}.categories (name, slug, parent_id) VALUES ($1, $1, $2) RETURNING id
+		`), slug, parentID).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		// Cleanups run last first, so children go before their parents
+		t.Cleanup(func() {
+			dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.categories WHERE id = $1"), id)
+		})
+		ids = append(ids, id)
+		slugs = append(slugs, slug)
+	}
+
+	path, err := repo.GetBreadcrumb(ctx, ids[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(path) != 4 {
+		t.Fatalf("GetBreadcrumb = %d categories, want 4", len(path))
+	}
+	for i, category := range path {
+		if category.ID != ids[i] || category.Slug != slugs[i] {
+			t.Errorf("breadcrumb[%d] = %s, want %s", i, category.Slug, slugs[i])
+		}
+	}
+
+	if path, err := repo.GetBreadcrumb(ctx, ids[0]); err != nil || len(path) != 1 || path[0].ID != ids[0] {
+		t.Errorf("breadcrumb of the root = %v, %v; want the root alone", path, err)
+	}
+	if path, err := repo.GetBreadcrumb(ctx, uuid.New()); err != nil || len(path) != 0 {
+		t.Errorf("breadcrumb of an unknown category = %v, %v; want empty", path, err)
+	}
+}
@@ -0,0 +1,52 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// ErrAlreadyReported is returned when a reader reports the same comment a
+// second time.
+var ErrAlreadyReported = errors.New("comment already reported by this user")
+
+type CommentReportRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewCommentReportRepository(db *pgxpool.Pool) *CommentReportRepository {
+	return &CommentReportRepository{db: db}
+}
+
+// Create stores the report, failing with ErrAlreadyReported if the reporter
+// has reported the comment before.
+func (r *CommentReportRepository) Create(ctx context.Context, report *models.CommentReport) error {
+	query := database.Qualify(`
+		INSERT INTO {blog}.comment_reports (comment_id, reporter_id, reason)
+		VALUES ($1, $2, $3)
+		RETURNING id, created_at
+	`)
+
+	err := r.db.QueryRow(ctx, query, report.CommentID, report.ReporterID, report.Reason).Scan(&report.ID, &report.CreatedAt)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrAlreadyReported
+		}
+		return err
+	}
+
+	return nil
+}
+
+// DeleteForComment clears the comment's reports, e.g. once a moderator has
+// approved it.
+func (r *CommentReportRepository) DeleteForComment(ctx context.Context, commentID uuid.UUID) error {
+	_, err := r.db.Exec(ctx, database.Qualify(`DELETE FROM {blog}.comment_reports WHERE comment_id = $1`), commentID)
+	return err
+}
@@ -0,0 +1,329 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var ErrCommentNotFound = errors.New("comment not found")
+
+type CommentRepository struct {
+	db      *pgxpool.Pool
+	tracker *database.TransactionTracker
+	users   *UserRepository
+}
+
+func NewCommentRepository(db *pgxpool.Pool, tracker *database.TransactionTracker, users *UserRepository) *CommentRepository {
+	return &CommentRepository{db: db, tracker: tracker, users: users}
+}
+
+// Create inserts the comment with its status, pending unless set.
+func (r *CommentRepository) Create(ctx context.Context, comment *models.Comment) error {
+	if comment.Status == "" {
+		comment.Status = "pending"
+	}
+
+	return r.db.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.comments (post_id, user_id, content, parent_id, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`),
+		comment.PostID,
+		nullableUUID(comment.UserID),
+		comment.Content,
+		comment.ParentID,
+		comment.Status,
+	).Scan(&comment.ID, &comment.CreatedAt, &comment.UpdatedAt)
+}
+
+func (r *CommentRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Comment, error) {
+	query := database.Qualify(`
+		SELECT id, post_id, user_id, content, parent_id, status, created_at, updated_at
+		FROM {blog}.comments
+		WHERE id = $1
+	`)
+
+	rows, err := r.db.Query(ctx, query, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments, _, err := scanComments(rows, false)
+	if err != nil {
+		return nil, err
+	}
+	if len(comments) == 0 {
+		return nil, nil
+	}
+
+	return comments[0], nil
+}
+
+// ListByPost returns a page of the post's comments, oldest first, with their
+// authors loaded in a single extra query.
+func (r *CommentRepository) ListByPost(ctx context.Context, postID uuid.UUID, limit, offset int) ([]*models.Comment, error) {
+	query := database.Qualify(`
+		SELECT id, post_id, user_id, content, parent_id, status, created_at, updated_at
+		FROM {blog}.comments
+		WHERE post_id = $1
+		ORDER BY created_at, id
+		LIMIT $2 OFFSET $3
+	`)
+
+	rows, err := r.db.Query(ctx, query, postID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments, _, err := scanComments(rows, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadUsers(ctx, comments); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+// GetThreaded returns the post's comments as a tree: the top-level comments,
+// oldest first, each with its replies nested below it in Replies. The whole
+// thread is read with one recursive query, plus one for the authors.
+func (r *CommentRepository) GetThreaded(ctx context.Context, postID uuid.UUID) ([]*models.Comment, error) {
+	query := database.Qualify(`
+		WITH RECURSIVE thread AS (
+			SELECT id, post_id, user_id, content, parent_id, status, created_at, updated_at
+			FROM {blog}.comments
+			WHERE post_id = $1 AND parent_id IS NULL
+			UNION ALL
+			SELECT c.id, c.post_id, c.user_id, c.content, c.parent_id, c.status, c.created_at, c.updated_at
+			FROM {blog}.comments c
+			JOIN thread t ON c.parent_id = t.id
+		)
+		SELECT id, post_id, user_id, content, parent_id, status, created_at, updated_at
+		FROM thread
+		ORDER BY created_at, id
+	`)
+
+	rows, err := r.db.Query(ctx, query, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	comments, _, err := scanComments(rows, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := r.loadUsers(ctx, comments); err != nil {
+		return nil, err
+	}
+
+	return buildCommentTree(comments), nil
+}
+
+// ListByStatus returns a page of comments across all posts, oldest first,
+// with their authors and how often each has been reported.
+func (r *CommentRepository) ListByStatus(ctx context.Context, status string, limit, offset int) ([]*models.Comment, int, error) {
+	query := database.Qualify(`
+		SELECT c.id, c.post_id, c.user_id, c.content, c.parent_id, c.status, c.created_at, c.updated_at,
+			   (SELECT COUNT(*) FROM {blog}.comment_reports cr WHERE cr.comment_id = c.id),
+			   COUNT(*) OVER()
+		FROM {blog}.comments c
+		WHERE $1 = '' OR c.status = $1
+		ORDER BY c.created_at
+		LIMIT $2 OFFSET $3
+	`)
+
+	rows, err := r.db.Query(ctx, query, status, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	comments, total, err := scanComments(rows, true)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := r.loadUsers(ctx, comments); err != nil {
+		return nil, 0, err
+	}
+
+	return comments, total, nil
+}
+
+// Update saves the comment's content, or returns ErrCommentNotFound.
+func (r *CommentRepository) Update(ctx context.Context, comment *models.Comment) error {
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		UPDATE {blog}.comments
+		SET content = $2, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`), comment.ID, comment.Content).Scan(&comment.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrCommentNotFound
+	}
+	return err
+}
+
+// Delete removes the comment and, through their parent links, its replies.
+func (r *CommentRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`
+		WITH RECURSIVE subtree AS (
+			SELECT id FROM {blog}.comments WHERE id = $1
+			UNION ALL
+			SELECT c.id FROM {blog}.comments c JOIN subtree s ON c.parent_id = s.id
+		)
+		DELETE FROM {blog}.comments WHERE id IN (SELECT id FROM subtree)
+	`), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCommentNotFound
+	}
+	return nil
+}
+
+// UpdateStatus moves the comment from status from to status to and records
+// the change in the audit log, attributed to actorID. If the comment is no
+// longer in status from, nothing changes and ErrConflict is returned.
+func (r *CommentRepository) UpdateStatus(ctx context.Context, id uuid.UUID, from, to string, actorID uuid.UUID) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, database.Qualify(`
+			UPDATE {blog}.comments
+			SET status = $3, updated_at = NOW()
+			WHERE id = $1 AND status = $2
+		`), id, from, to)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrConflict
+		}
+
+		return insertAuditLog(ctx, tx, &models.AuditLog{
+			ActorID:    nullableUUID(actorID),
+			Action:     "comment.status_change",
+			EntityType: "comment",
+			EntityID:   id.String(),
+			Details: map[string]interface{}{
+				"from": from,
+				"to":   to,
+			},
+		})
+	})
+}
+
+// FlagIfReported sets the comment's status to flagged once it has at least
+// threshold reports. Comments already rejected or marked as spam are left
+// alone. It reports whether the comment was flagged by this call.
+func (r *CommentRepository) FlagIfReported(ctx context.Context, id uuid.UUID, threshold int) (bool, error) {
+	query := database.Qualify(`
+		UPDATE {blog}.comments
+		SET status = 'flagged'
+		WHERE id = $1
+		  AND status IN ('pending', 'approved')
+		  AND (SELECT COUNT(*) FROM {blog}.comment_reports WHERE comment_id = $1) >= $2
+	`)
+
+	tag, err := r.db.Exec(ctx, query, id, threshold)
+	if err != nil {
+		return false, err
+	}
+
+	return tag.RowsAffected() > 0, nil
+}
+
+func (r *CommentRepository) loadUsers(ctx context.Context, comments []*models.Comment) error {
+	seen := map[uuid.UUID]bool{}
+	ids := []uuid.UUID{}
+	for _, comment := range comments {
+		if comment.UserID != uuid.Nil && !seen[comment.UserID] {
+			seen[comment.UserID] = true
+			ids = append(ids, comment.UserID)
+		}
+	}
+
+	users, err := r.users.GetByIDs(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for _, comment := range comments {
+		comment.User = users[comment.UserID]
+	}
+
+	return nil
+}
+
+// scanComments reads comment rows. When withReports is set each row carries
+// a report count and a trailing COUNT(*) OVER() column.
+func scanComments(rows pgx.Rows, withReports bool) ([]*models.Comment, int, error) {
+	comments := []*models.Comment{}
+	total := 0
+	for rows.Next() {
+		var comment models.Comment
+		var userID *uuid.UUID
+		dest := []interface{}{
+			&comment.ID,
+			&comment.PostID,
+			&userID,
+			&comment.Content,
+			&comment.ParentID,
+			&comment.Status,
+			&comment.CreatedAt,
+			&comment.UpdatedAt,
+		}
+		if withReports {
+			dest = append(dest, &comment.ReportCount, &total)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, err
+		}
+		// Comments outlive deleted users
+		if userID != nil {
+			comment.UserID = *userID
+		}
+		comments = append(comments, &comment)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return comments, total, nil
+}
+
+// buildCommentTree nests each comment under its parent and returns the
+// top-level comments. Comments keep their order among their siblings.
+func buildCommentTree(comments []*models.Comment) []*models.Comment {
+	byID := make(map[uuid.UUID]*models.Comment, len(comments))
+	for _, comment := range comments {
+		byID[comment.ID] = comment
+	}
+
+	roots := []*models.Comment{}
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			roots = append(roots, comment)
+			continue
+		}
+		if parent, ok := byID[*comment.ParentID]; ok {
+			parent.Replies = append(parent.Replies, comment)
+		}
+	}
+
+	return roots
+}
@@ -0,0 +1,75 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// ErrCouponUsedUp is returned when a coupon has been used as often as it
+// may be.
+var ErrCouponUsedUp = errors.New("coupon has been used up")
+
+type CouponRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewCouponRepository(db *pgxpool.Pool) *CouponRepository {
+	return &CouponRepository{db: db}
+}
+
+// FindByCode returns the coupon with the code, matched case-insensitively,
+// or nil.
+func (r *CouponRepository) FindByCode(ctx context.Context, code string) (*models.Coupon, error) {
+	return r.getCoupon(ctx, "UPPER(code) = UPPER($1)", code)
+}
+
+func (r *CouponRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Coupon, error) {
+	return r.getCoupon(ctx, "id = $1", id)
+}
+
+func (r *CouponRepository) getCoupon(ctx context.Context, condition string, arg interface{}) (*models.Coupon, error) {
+	var coupon models.Coupon
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		SELECT id, code, type, value, min_order_amount, max_uses, used_count, expires_at,
+			   applicable_product_ids, created_at, updated_at
+		FROM {shop}.coupons
+		WHERE `+condition), arg).Scan(
+		&coupon.ID, &coupon.Code, &coupon.Type, &coupon.Value, &coupon.MinOrderAmount, &coupon.MaxUses,
+		&coupon.UsedCount, &coupon.ExpiresAt, &coupon.ApplicableProductIDs, &coupon.CreatedAt, &coupon.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &coupon, nil
+}
+
+// IncrementUsage records a use of the coupon within tx. The limit is checked
+// by the update itself, so concurrent orders cannot use a coupon more often
+// than allowed: the one over the limit gets ErrCouponUsedUp.
+func (r *CouponRepository) IncrementUsage(ctx context.Context, tx pgx.Tx, id uuid.UUID) error {
+	return incrementCouponUsage(ctx, tx, id)
+}
+
+func incrementCouponUsage(ctx context.Context, tx pgx.Tx, id uuid.UUID) error {
+	tag, err := tx.Exec(ctx, database.Qualify(`
+		UPDATE {shop}.coupons
+		SET used_count = used_count + 1, updated_at = NOW()
+		WHERE id = $1 AND (max_uses IS NULL OR used_count < max_uses)
+	`), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrCouponUsedUp
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// ErrCustomerNotFound is returned by Merge when either customer is missing.
+var (
+	ErrCustomerNotFound  = errors.New("customer not found")
+	ErrMergeSameCustomer = errors.New("cannot merge a customer into itself")
+)
+
+type CustomerRepository struct {
+	db      *pgxpool.Pool
+	tracker *database.TransactionTracker
+}
+
+func NewCustomerRepository(db *pgxpool.Pool, tracker *database.TransactionTracker) *CustomerRepository {
+	return &CustomerRepository{db: db, tracker: tracker}
+}
+
+func (r *CustomerRepository) GetByUserID(ctx context.Context, userID uuid.UUID) (*models.Customer, error) {
+	query := database.Qualify(`
+		SELECT id, user_id, shipping_address, billing_address, COALESCE(phone, ''), created_at, updated_at
+		FROM {shop}.customers
+		WHERE user_id = $1
+	`)
+
+	var customer models.Customer
+	err := r.db.QueryRow(ctx, query, userID).Scan(
+		&customer.ID,
+		&customer.UserID,
+		&customer.ShippingAddress,
+		&customer.BillingAddress,
+		&customer.Phone,
+		&customer.CreatedAt,
+		&customer.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &customer, nil
+}
+
+// GetOrCreateByUserID returns the user's customer record, creating one
+// without addresses on the user's first order.
+func (r *CustomerRepository) GetOrCreateByUserID(ctx context.Context, userID uuid.UUID) (*models.Customer, error) {
+	_, err := r.db.Exec(ctx, database.Qualify(`
+		INSERT INTO {shop}.customers (user_id)
+		SELECT $1
+		WHERE NOT EXISTS (SELECT 1 FROM {shop}.customers WHERE user_id = $1)
+	`), userID)
+	if err != nil {
+		return nil, err
+	}
+	return r.GetByUserID(ctx, userID)
+}
+
+// Merge folds the secondary customer into the primary one in a single
+// transaction: orders and subscriptions move to the primary customer, the
+// primary keeps its own addresses and phone and takes the secondary's where
+// it has none, and the secondary customer and its user are anonymized so the
+// account can no longer be used. The secondary user is deleted, loses its
+// Google sign-in, refresh tokens, API keys and OAuth tokens. An audit entry
+// attributed to actorID is written in the same transaction. Merging a
+// customer into itself yields ErrMergeSameCustomer.
+func (r *CustomerRepository) Merge(ctx context.Context, primaryID, secondaryID, actorID uuid.UUID) error {
+	if primaryID == secondaryID {
+		return ErrMergeSameCustomer
+	}
+
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		// Lock both customers so neither changes while it is being merged
+		var secondaryUserID *uuid.UUID
+		locked := 0
+		rows, err := tx.Query(ctx, database.Qualify(`
+			SELECT id, user_id
+			FROM {shop}.customers
+			WHERE id = ANY($1)
+			ORDER BY id
+			FOR UPDATE
+		`), []uuid.UUID{primaryID, secondaryID})
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var id uuid.UUID
+			var userID *uuid.UUID
+			if err := rows.Scan(&id, &userID); err != nil {
+				rows.Close()
+				return err
+			}
+			if id == secondaryID {
+				secondaryUserID = userID
+			}
+			locked++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if locked != 2 {
+			return ErrCustomerNotFound
+		}
+
+		ordersTag, err := tx.Exec(ctx, database.Qualify(`
+			UPDATE {shop}.orders SET customer_id = $1 WHERE customer_id = $2
+		`), primaryID, secondaryID)
+		if err != nil {
+			return err
+		}
+
+		subscriptionsTag, err := tx.Exec(ctx, database.Qualify(`
+			UPDATE {shop}.subscriptions SET customer_id = $1 WHERE customer_id = $2
+		`), primaryID, secondaryID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, database.Qualify(`
+			UPDATE {shop}.customers p
+			SET shipping_address = COALESCE(p.shipping_address, s.shipping_address),
+				billing_address = COALESCE(p.billing_address, s.billing_address),
+				phone = COALESCE(p.phone, s.phone)
+			FROM {shop}.customers s
+			WHERE p.id = $1 AND s.id = $2
+		`), primaryID, secondaryID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, database.Qualify(`
+			UPDATE {shop}.customers
+			SET shipping_address = NULL, billing_address = NULL, phone = NULL
+			WHERE id = $1
+		`), secondaryID)
+		if err != nil {
+			return err
+		}
+
+		if secondaryUserID != nil {
+			if err := retireMergedUser(ctx, tx, *secondaryUserID); err != nil {
+				return err
+			}
+		}
+
+		err = insertAuditLog(ctx, tx, &models.AuditLog{
+			ActorID:    nullableUUID(actorID),
+			Action:     "customer.merge",
+			EntityType: "customer",
+			EntityID:   primaryID.String(),
+			Details: map[string]interface{}{
+				"secondary_id":        secondaryID,
+				"orders_moved":        ordersTag.RowsAffected(),
+				"subscriptions_moved": subscriptionsTag.RowsAffected(),
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// retireMergedUser anonymizes and deletes the user of a merged customer and
+// takes away every way of signing in as them: the password, Google
+// sign-in, refresh tokens, API keys and stored OAuth tokens.
+func retireMergedUser(ctx context.Context, tx pgx.Tx, userID uuid.UUID) error {
+	statements := []string{
+		// An empty password hash never matches
+		`UPDATE {auth}.users
+		SET email = 'merged-' || id || '@anonymized.invalid',
+			full_name = 'Merged customer',
+			password_hash = '',
+			avatar_url = NULL,
+			oauth_provider = NULL,
+			oauth_subject = NULL,
+			deleted_at = COALESCE(deleted_at, NOW())
+		WHERE id = $1`,
+		`UPDATE {auth}.refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`,
+		`DELETE FROM {auth}.api_keys WHERE user_id = $1`,
+		`DELETE FROM {auth}.oauth_tokens WHERE user_id = $1`,
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(ctx, database.Qualify(statement), userID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
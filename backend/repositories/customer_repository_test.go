@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+)
+
+// After a merge the secondary customer's orders belong to the primary, and
+// the secondary account is anonymized and can no longer sign in.
+func TestCustomerMerge(t *testing.T) {
+	// Refused before the database is touched
+	same := uuid.New()
+	if err := NewCustomerRepository(nil, nil).Merge(context.Background(), same, same, uuid.Nil); !errors.Is(err, ErrMergeSameCustomer) {
+		t.Errorf("merging a customer into itself: err = %v, want ErrMergeSameCustomer", err)
+	}
+
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewCustomerRepository(pool, nil)
+
+	primary, _ := createTestCustomer(t, pool)
+	secondary, _ := createTestCustomer(t, pool)
+	dbtest.Exec(t, pool, database.Qualify("UPDATE {shop}.customers SET phone = '+256700000000' WHERE id = $1"), secondary.ID)
+	now := time.Now()
+	kept := createTestOrder(t, pool, primary.ID, "delivered", 10, now)
+	moved := []uuid.UUID{
+		createTestOrder(t, pool, secondary.ID, "delivered", 20, now),
+		createTestOrder(t, pool, secondary.ID, "pending", 30, now),
+	}
+
+	if err := repo.Merge(ctx, primary.ID, secondary.ID, uuid.Nil); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range append(moved, kept) {
+		var customerID uuid.UUID
+		if err := pool.QueryRow(ctx, database.Qualify("SELECT customer_id FROM {shop}.orders WHERE id = $1"), id).Scan(&customerID); err != nil {
+			t.Fatal(err)
+		}
+		if customerID != primary.ID {
+			t.Errorf("order %s belongs to %s, want the primary customer", id, customerID)
+		}
+	}
+
+	var phone *string
+	if err := pool.QueryRow(ctx, database.Qualify("SELECT phone FROM {shop}.customers WHERE id = $1"), primary.ID).Scan(&phone); err != nil {
+		t.Fatal(err)
+	}
+	if phone == nil || *phone != "+256700000000" {
+		t.Errorf("primary phone = %v, want the secondary's", phone)
+	}
+
+	var email, fullName, passwordHash string
+	var deleted bool
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		SELECT email, full_name, password_hash, deleted_at IS NOT NULL FROM {auth}.users WHERE id = $1
+	`), secondary.UserID).Scan(&email, &fullName, &passwordHash, &deleted); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(email, "@anonymized.invalid") || fullName != "Merged customer" || passwordHash != "" || !deleted {
+		t.Errorf("secondary user = %s %q, password hash %q, deleted %v; want anonymized and deleted", email, fullName, passwordHash, deleted)
+	}
+
+	var audited int
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		SELECT COUNT(*) FROM {cms}.audit_logs
+		WHERE action = 'customer.merge' AND entity_id = $1 AND details->>'orders_moved' = '2'
+	`), primary.ID.String()).Scan(&audited); err != nil {
+		t.Fatal(err)
+	}
+	if audited != 1 {
+		t.Errorf("%d merge audit entries, want 1 recording two moved orders", audited)
+	}
+
+	if err := repo.Merge(ctx, primary.ID, uuid.New(), uuid.Nil); !errors.Is(err, ErrCustomerNotFound) {
+		t.Errorf("merging an unknown customer: err = %v, want ErrCustomerNotFound", err)
+	}
+}
@@ -0,0 +1,176 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// ErrEmailNotFound is returned by Retry when there is no unsent email with
+// the ID.
+var ErrEmailNotFound = errors.New("email not found")
+
+type EmailQueueRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewEmailQueueRepository(db *pgxpool.Pool) *EmailQueueRepository {
+	return &EmailQueueRepository{db: db}
+}
+
+// Enqueue stores the email for sending as soon as possible.
+func (r *EmailQueueRepository) Enqueue(ctx context.Context, email *models.QueuedEmail) error {
+	query := database.Qualify(`
+		INSERT INTO {cms}.email_send_queue (to_address, subject, body_html, body_text)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, status, attempts, scheduled_at, next_retry_at, created_at, updated_at
+	`)
+
+	return r.db.QueryRow(ctx, query, email.To, email.Subject, email.BodyHTML, email.BodyText).Scan(
+		&email.ID,
+		&email.Status,
+		&email.Attempts,
+		&email.ScheduledAt,
+		&email.NextRetryAt,
+		&email.CreatedAt,
+		&email.UpdatedAt,
+	)
+}
+
+// ClaimDue returns up to limit pending emails that are due at now, and
+// pushes their next_retry_at out to leaseUntil. Other workers skip them
+// meanwhile, and an email whose worker dies is picked up again once the
+// lease runs out.
+func (r *EmailQueueRepository) ClaimDue(ctx context.Context, now, leaseUntil time.Time, limit int) ([]*models.QueuedEmail, error) {
+	query := database.Qualify(`
+		UPDATE {cms}.email_send_queue
+		SET next_retry_at = $2
+		WHERE id IN (
+			SELECT id FROM {cms}.email_send_queue
+			WHERE status = 'pending' AND next_retry_at <= $1
+			ORDER BY next_retry_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, to_address, subject, body_html, body_text, status, attempts, COALESCE(last_error, ''),
+				  scheduled_at, next_retry_at, sent_at, created_at, updated_at
+	`)
+
+	rows, err := r.db.Query(ctx, query, now, leaseUntil, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	emails, _, err := scanQueuedEmails(rows, false)
+	return emails, err
+}
+
+func (r *EmailQueueRepository) MarkSent(ctx context.Context, id uuid.UUID) error {
+	query := database.Qualify(`
+		UPDATE {cms}.email_send_queue
+		SET status = 'sent', attempts = attempts + 1, last_error = NULL, sent_at = NOW()
+		WHERE id = $1
+	`)
+
+	_, err := r.db.Exec(ctx, query, id)
+	return err
+}
+
+// MarkAttemptFailed records a failed send. The email is retried at
+// nextRetryAt, or marked failed for good if that is nil.
+func (r *EmailQueueRepository) MarkAttemptFailed(ctx context.Context, id uuid.UUID, reason string, nextRetryAt *time.Time) error {
+	query := database.Qualify(`
+		UPDATE {cms}.email_send_queue
+		SET attempts = attempts + 1, last_error = $2,
+			status = CASE WHEN $3::timestamptz IS NULL THEN 'failed' ELSE 'pending' END,
+			next_retry_at = COALESCE($3, next_retry_at)
+		WHERE id = $1
+	`)
+
+	_, err := r.db.Exec(ctx, query, id, reason, nextRetryAt)
+	return err
+}
+
+// Retry makes an unsent email due immediately, with its attempts reset.
+func (r *EmailQueueRepository) Retry(ctx context.Context, id uuid.UUID) error {
+	query := database.Qualify(`
+		UPDATE {cms}.email_send_queue
+		SET status = 'pending', attempts = 0, next_retry_at = NOW()
+		WHERE id = $1 AND status <> 'sent'
+	`)
+
+	tag, err := r.db.Exec(ctx, query, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrEmailNotFound
+	}
+	return nil
+}
+
+// ListByStatus returns a page of the emails with the given status, newest
+// first, and their total count.
+func (r *EmailQueueRepository) ListByStatus(ctx context.Context, status string, limit, offset int) ([]*models.QueuedEmail, int, error) {
+	query := database.Qualify(`
+		SELECT id, to_address, subject, body_html, body_text, status, attempts, COALESCE(last_error, ''),
+			   scheduled_at, next_retry_at, sent_at, created_at, updated_at, COUNT(*) OVER()
+		FROM {cms}.email_send_queue
+		WHERE status = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`)
+
+	rows, err := r.db.Query(ctx, query, status, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	return scanQueuedEmails(rows, true)
+}
+
+// scanQueuedEmails reads queue rows. When withTotal is set each row carries
+// a trailing COUNT(*) OVER() column.
+func scanQueuedEmails(rows pgx.Rows, withTotal bool) ([]*models.QueuedEmail, int, error) {
+	emails := []*models.QueuedEmail{}
+	total := 0
+	for rows.Next() {
+		var email models.QueuedEmail
+		dest := []interface{}{
+			&email.ID,
+			&email.To,
+			&email.Subject,
+			&email.BodyHTML,
+			&email.BodyText,
+			&email.Status,
+			&email.Attempts,
+			&email.LastError,
+			&email.ScheduledAt,
+			&email.NextRetryAt,
+			&email.SentAt,
+			&email.CreatedAt,
+			&email.UpdatedAt,
+		}
+		if withTotal {
+			dest = append(dest, &total)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, err
+		}
+		emails = append(emails, &email)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return emails, total, nil
+}
@@ -0,0 +1,78 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// EmailTemplateRepository stores admin overrides of the email templates.
+type EmailTemplateRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewEmailTemplateRepository(db *pgxpool.Pool) *EmailTemplateRepository {
+	return &EmailTemplateRepository{db: db}
+}
+
+// GetByName returns the override of the named template, or nil if there is
+// none.
+func (r *EmailTemplateRepository) GetByName(ctx context.Context, name string) (*models.EmailTemplate, error) {
+	template := models.EmailTemplate{IsCustom: true}
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		SELECT name, description, subject, html_body, text_body, updated_at
+		FROM {cms}.email_templates
+		WHERE name = $1
+	`), name).Scan(
+		&template.Name, &template.Description, &template.Subject, &template.HTMLBody, &template.TextBody, &template.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &template, nil
+}
+
+// List returns every override by template name.
+func (r *EmailTemplateRepository) List(ctx context.Context) (map[string]*models.EmailTemplate, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT name, description, subject, html_body, text_body, updated_at
+		FROM {cms}.email_templates
+	`))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := map[string]*models.EmailTemplate{}
+	for rows.Next() {
+		template := models.EmailTemplate{IsCustom: true}
+		if err := rows.Scan(
+			&template.Name, &template.Description, &template.Subject, &template.HTMLBody, &template.TextBody, &template.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		templates[template.Name] = &template
+	}
+
+	return templates, rows.Err()
+}
+
+// Upsert creates or replaces the override of the template.
+func (r *EmailTemplateRepository) Upsert(ctx context.Context, template *models.EmailTemplate) error {
+	return r.db.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {cms}.email_templates (name, description, subject, html_body, text_body)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE
+		SET description = EXCLUDED.description, subject = EXCLUDED.subject,
+			html_body = EXCLUDED.html_body, text_body = EXCLUDED.text_body, updated_at = NOW()
+		RETURNING updated_at
+	`), template.Name, template.Description, template.Subject, template.HTMLBody, template.TextBody).Scan(&template.UpdatedAt)
+}
@@ -0,0 +1,11 @@
+package repositories
+
+import "errors"
+
+// ErrConflict is returned when an update is based on a stale version of the
+// record, meaning someone else changed it in the meantime.
+var ErrConflict = errors.New("record was modified by someone else")
+
+// ErrInvalidCursor is returned when a pagination cursor does not point at a
+// record of the list, for example because the record has been deleted.
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
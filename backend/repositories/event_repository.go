@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var (
+	ErrTicketNotFound  = errors.New("ticket not found")
+	ErrTicketCheckedIn = errors.New("ticket already checked in")
+)
+
+// EventRepository covers products of type "event" and the tickets issued
+// for them.
+type EventRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewEventRepository(db *pgxpool.Pool) *EventRepository {
+	return &EventRepository{db: db}
+}
+
+// ListUpcoming returns event products whose event has not started yet,
+// soonest first.
+func (r *EventRepository) ListUpcoming(ctx context.Context, limit, offset int) ([]*models.Product, int, error) {
+	query := database.Qualify(`
+		SELECT p.id, p.name, p.slug, p.description, p.price, p.sale_price, p.sku, p.stock,
+			   COALESCE(p.is_featured, FALSE), p.type, p.category_id, p.vendor_id,
+			   p.created_at, p.updated_at,
+			   e.event_date, e.venue, COALESCE(e.address, ''), e.capacity, e.tickets_sold,
+			   e.created_at, e.updated_at,
+			   COUNT(*) OVER()
+		FROM {shop}.products p
+		JOIN {shop}.event_details e ON e.product_id = p.id
+		WHERE p.type = 'event' AND p.status = 'published' AND p.deleted_at IS NULL AND e.event_date > NOW()
+		ORDER BY e.event_date ASC
+		LIMIT $1 OFFSET $2
+	`)
+
+	rows, err := r.db.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	products := []*models.Product{}
+	total := 0
+	for rows.Next() {
+		var product models.Product
+		var event models.EventDetails
+		if err := rows.Scan(
+			&product.ID, &product.Name, &product.Slug, &product.Description, &product.Price, &product.SalePrice,
+			&product.SKU, &product.Stock, &product.IsFeatured, &product.Type,
+			&product.CategoryID, &product.VendorID, &product.CreatedAt, &product.UpdatedAt,
+			&event.EventDate, &event.Venue, &event.Address, &event.Capacity, &event.TicketsSold,
+			&event.CreatedAt, &event.UpdatedAt,
+			&total,
+		); err != nil {
+			return nil, 0, err
+		}
+
+		event.ProductID = product.ID
+		product.Event = &event
+		products = append(products, &product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return products, total, nil
+}
+
+// CheckIn marks a ticket for the given event as used. It fails with
+// ErrTicketNotFound if the ticket does not belong to the event and with
+// ErrTicketCheckedIn if it has already been used.
+func (r *EventRepository) CheckIn(ctx context.Context, productID, ticketID uuid.UUID) (*models.OrderTicket, error) {
+	query := database.Qualify(`
+		UPDATE {shop}.order_tickets t
+		SET checked_in_at = NOW()
+		FROM {shop}.order_items oi
+		WHERE t.order_item_id = oi.id
+		  AND oi.product_id = $1
+		  AND t.ticket_id = $2
+		  AND t.checked_in_at IS NULL
+		RETURNING t.ticket_id, t.order_item_id, t.qr_data, t.checked_in_at, t.created_at
+	`)
+
+	var ticket models.OrderTicket
+	err := r.db.QueryRow(ctx, query, productID, ticketID).Scan(
+		&ticket.TicketID,
+		&ticket.OrderItemID,
+		&ticket.QRData,
+		&ticket.CheckedInAt,
+		&ticket.CreatedAt,
+	)
+	if err == nil {
+		return &ticket, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	// Nothing was updated: work out whether the ticket is unknown or used
+	var exists bool
+	err = r.db.QueryRow(ctx, database.Qualify(`
+		SELECT EXISTS (
+			SELECT 1
+			FROM {shop}.order_tickets t
+			JOIN {shop}.order_items oi ON t.order_item_id = oi.id
+			WHERE oi.product_id = $1 AND t.ticket_id = $2
+		)
+	`), productID, ticketID).Scan(&exists)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, ErrTicketCheckedIn
+	}
+
+	return nil, ErrTicketNotFound
+}
@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+type FeatureFlagRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewFeatureFlagRepository(db *pgxpool.Pool) *FeatureFlagRepository {
+	return &FeatureFlagRepository{db: db}
+}
+
+func (r *FeatureFlagRepository) GetByKey(ctx context.Context, key string) (*models.FeatureFlag, error) {
+	query := database.Qualify(`
+		SELECT id, key, COALESCE(description, ''), enabled, rollout_percent, targeting_rules,
+			   created_at, updated_at
+		FROM {cms}.feature_flags
+		WHERE key = $1
+	`)
+
+	var flag models.FeatureFlag
+	err := r.db.QueryRow(ctx, query, key).Scan(
+		&flag.ID,
+		&flag.Key,
+		&flag.Description,
+		&flag.Enabled,
+		&flag.RolloutPercent,
+		&flag.TargetingRules,
+		&flag.CreatedAt,
+		&flag.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &flag, nil
+}
@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+type FlashSaleRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewFlashSaleRepository(db *pgxpool.Pool) *FlashSaleRepository {
+	return &FlashSaleRepository{db: db}
+}
+
+// GetActive returns the active flash sale running at now, or nil. When sales
+// overlap, the one ending soonest wins. A sale past its end is never
+// returned, even before DeactivateExpired has flagged it.
+func (r *FlashSaleRepository) GetActive(ctx context.Context, now time.Time) (*models.FlashSale, error) {
+	query := database.Qualify(`
+		SELECT id, title, discount_percent, starts_at, ends_at, product_ids, is_active, created_at, updated_at
+		FROM {shop}.flash_sales
+		WHERE is_active AND starts_at <= $1 AND ends_at > $1
+		ORDER BY ends_at
+		LIMIT 1
+	`)
+
+	var sale models.FlashSale
+	err := r.db.QueryRow(ctx, query, now).Scan(
+		&sale.ID,
+		&sale.Title,
+		&sale.DiscountPercent,
+		&sale.StartsAt,
+		&sale.EndsAt,
+		&sale.ProductIDs,
+		&sale.IsActive,
+		&sale.CreatedAt,
+		&sale.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &sale, nil
+}
+
+// DeactivateExpired switches off the sales that ended before now and
+// returns how many there were.
+func (r *FlashSaleRepository) DeactivateExpired(ctx context.Context, now time.Time) (int64, error) {
+	query := database.Qualify(`
+		UPDATE {shop}.flash_sales
+		SET is_active = FALSE
+		WHERE is_active AND ends_at <= $1
+	`)
+
+	tag, err := r.db.Exec(ctx, query, now)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike escapes LIKE/ILIKE wildcards so user input is matched literally.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// nullableUUID maps the zero UUID to NULL.
+func nullableUUID(id uuid.UUID) *uuid.UUID {
+	if id == uuid.Nil {
+		return nil
+	}
+	return &id
+}
+
+// derefTime returns the time t points to, or the zero time for NULL.
+func derefTime(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+// paginate turns the rows of a keyset query, fetched with one row more than
+// limit, into a page. The extra row only signals that there is a next page.
+func paginate[T any](items []T, limit int, id func(T) uuid.UUID) *models.PaginatedResult[T] {
+	result := &models.PaginatedResult[T]{Items: items}
+	if len(items) > limit {
+		result.Items = items[:limit]
+		result.HasMore = true
+		cursor := models.EncodeCursor(id(result.Items[limit-1]))
+		result.NextCursor = &cursor
+	}
+	return result
+}
+
+// listSitemapEntries runs a query selecting slug and updated_at.
+func listSitemapEntries(ctx context.Context, db dbtx, query string) ([]models.SitemapEntry, error) {
+	rows, err := db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.SitemapEntry{}
+	for rows.Next() {
+		var entry models.SitemapEntry
+		if err := rows.Scan(&entry.Slug, &entry.UpdatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
@@ -0,0 +1,73 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+type MediaRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewMediaRepository(db *pgxpool.Pool) *MediaRepository {
+	return &MediaRepository{db: db}
+}
+
+// Create records an uploaded file with the variants stored so far.
+func (r *MediaRepository) Create(ctx context.Context, media *models.Media) error {
+	query := database.Qualify(`
+		INSERT INTO {cms}.media (url, storage_key, content_type, size_bytes, variants, is_private, uploaded_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at, updated_at
+	`)
+
+	variants := media.Variants
+	if variants == nil {
+		variants = map[string]string{}
+	}
+
+	return r.db.QueryRow(ctx, query, media.URL, media.StorageKey, media.ContentType, media.SizeBytes, variants, media.IsPrivate, media.UploadedBy).
+		Scan(&media.ID, &media.CreatedAt, &media.UpdatedAt)
+}
+
+func (r *MediaRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Media, error) {
+	query := database.Qualify(`
+		SELECT id, url, storage_key, content_type, size_bytes, variants, is_private, uploaded_by, created_at, updated_at
+		FROM {cms}.media
+		WHERE id = $1
+	`)
+
+	var media models.Media
+	var variantsJSON []byte
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&media.ID,
+		&media.URL,
+		&media.StorageKey,
+		&media.ContentType,
+		&media.SizeBytes,
+		&variantsJSON,
+		&media.IsPrivate,
+		&media.UploadedBy,
+		&media.CreatedAt,
+		&media.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(variantsJSON, &media.Variants); err != nil {
+		return nil, err
+	}
+
+	return &media, nil
+}
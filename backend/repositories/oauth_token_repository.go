@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+type OAuthTokenRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewOAuthTokenRepository(db *pgxpool.Pool) *OAuthTokenRepository {
+	return &OAuthTokenRepository{db: db}
+}
+
+// Upsert stores the user's tokens for the provider, replacing any stored
+// before.
+func (r *OAuthTokenRepository) Upsert(ctx context.Context, token *models.OAuthToken) error {
+	query := database.Qualify(`
+		INSERT INTO {auth}.oauth_tokens (user_id, provider, access_token_enc, refresh_token_enc, scopes, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, provider) DO UPDATE
+		SET access_token_enc = EXCLUDED.access_token_enc,
+			refresh_token_enc = EXCLUDED.refresh_token_enc,
+			scopes = EXCLUDED.scopes,
+			expires_at = EXCLUDED.expires_at
+		RETURNING id, created_at, updated_at
+	`)
+
+	return r.db.QueryRow(ctx, query,
+		token.UserID,
+		token.Provider,
+		token.AccessTokenEncrypted,
+		token.RefreshTokenEncrypted,
+		token.Scopes,
+		token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt, &token.UpdatedAt)
+}
+
+func (r *OAuthTokenRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.OAuthToken, error) {
+	return r.getOne(ctx, "id = $1", id)
+}
+
+func (r *OAuthTokenRepository) GetByUserAndProvider(ctx context.Context, userID uuid.UUID, provider string) (*models.OAuthToken, error) {
+	return r.getOne(ctx, "user_id = $1 AND provider = $2", userID, provider)
+}
+
+// UpdateTokens replaces the tokens after a refresh. Providers that do not
+// rotate refresh tokens return none, so a nil refresh token keeps the old
+// one.
+func (r *OAuthTokenRepository) UpdateTokens(ctx context.Context, token *models.OAuthToken) error {
+	query := database.Qualify(`
+		UPDATE {auth}.oauth_tokens
+		SET access_token_enc = $2,
+			refresh_token_enc = COALESCE($3, refresh_token_enc),
+			scopes = $4,
+			expires_at = $5
+		WHERE id = $1
+		RETURNING refresh_token_enc, updated_at
+	`)
+
+	return r.db.QueryRow(ctx, query,
+		token.ID,
+		token.AccessTokenEncrypted,
+		token.RefreshTokenEncrypted,
+		token.Scopes,
+		token.ExpiresAt,
+	).Scan(&token.RefreshTokenEncrypted, &token.UpdatedAt)
+}
+
+func (r *OAuthTokenRepository) getOne(ctx context.Context, where string, args ...interface{}) (*models.OAuthToken, error) {
+	query := database.Qualify(`
+		SELECT id, user_id, provider, access_token_enc, refresh_token_enc, scopes, expires_at,
+			   created_at, updated_at
+		FROM {auth}.oauth_tokens
+		WHERE ` + where)
+
+	var token models.OAuthToken
+	err := r.db.QueryRow(ctx, query, args...).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.Provider,
+		&token.AccessTokenEncrypted,
+		&token.RefreshTokenEncrypted,
+		&token.Scopes,
+		&token.ExpiresAt,
+		&token.CreatedAt,
+		&token.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &token, nil
+}
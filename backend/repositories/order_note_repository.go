@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// OrderNoteRepository stores notes attached to orders. Notes are append-only,
+// so there is deliberately no Update method.
+type OrderNoteRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewOrderNoteRepository(db *pgxpool.Pool) *OrderNoteRepository {
+	return &OrderNoteRepository{db: db}
+}
+
+func (r *OrderNoteRepository) Create(ctx context.Context, note *models.OrderNote) error {
+	query := database.Qualify(`
+		INSERT INTO {shop}.order_notes (order_id, author_id, content, is_internal)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`)
+
+	return r.db.QueryRow(ctx, query,
+		note.OrderID,
+		note.AuthorID,
+		note.Content,
+		note.IsInternal,
+	).Scan(&note.ID, &note.CreatedAt)
+}
+
+func (r *OrderNoteRepository) ListByOrder(ctx context.Context, orderID uuid.UUID, includeInternal bool) ([]*models.OrderNote, error) {
+	query := database.Qualify(`
+		SELECT id, order_id, author_id, content, is_internal, created_at
+		FROM {shop}.order_notes
+		WHERE order_id = $1
+	`)
+
+	if !includeInternal {
+		query += " AND is_internal = FALSE"
+	}
+
+	query += " ORDER BY created_at ASC"
+
+	rows, err := r.db.Query(ctx, query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []*models.OrderNote{}
+	for rows.Next() {
+		var note models.OrderNote
+		if err := rows.Scan(
+			&note.ID,
+			&note.OrderID,
+			&note.AuthorID,
+			&note.Content,
+			&note.IsInternal,
+			&note.CreatedAt,
+		); err != nil {
+			return nil, err
+		}
+		notes = append(notes, &note)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
@@ -0,0 +1,835 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var (
+	ErrEventSoldOut = errors.New("not enough tickets left for this event")
+	ErrCartEmpty    = errors.New("cart is empty")
+	ErrCartChanged  = errors.New("cart changed during checkout")
+)
+
+// exportBatchSize is how many rows Export fetches from its cursor at a time.
+const exportBatchSize = 100
+
+// orderSorts maps the sort keys accepted by AdminList to ORDER BY clauses.
+var orderSorts = map[string]string{
+	"created_at_desc": "o.created_at DESC",
+	"created_at_asc":  "o.created_at ASC",
+	"total_desc":      "o.total_amount DESC, o.created_at DESC",
+	"total_asc":       "o.total_amount ASC, o.created_at DESC",
+}
+
+// ValidOrderSort reports whether sort is accepted by AdminList.
+func ValidOrderSort(sort string) bool {
+	_, ok := orderSorts[sort]
+	return ok
+}
+
+// orderDB is what OrderRepository needs of *pgxpool.Pool, so that tests can
+// stand in for the database.
+type orderDB interface {
+	dbtx
+	database.TxBeginner
+}
+
+type OrderRepository struct {
+	db      orderDB
+	tracker *database.TransactionTracker
+}
+
+func NewOrderRepository(db *pgxpool.Pool, tracker *database.TransactionTracker) *OrderRepository {
+	return &OrderRepository{db: db, tracker: tracker}
+}
+
+// PayoutSplitter returns the vendor payouts for an order's items, setting
+// the vendor and commission of each vendor-sold item, with one payout per
+// such item in item order. Orders are created with one. It runs before the
+// order's transaction begins, so that its queries do not take a second
+// connection while the transaction holds one; the payouts are linked to
+// their items and recorded in the transaction.
+type PayoutSplitter func(ctx context.Context, items []*models.OrderItem) ([]*models.VendorPayout, error)
+
+// Create inserts the order and its items, and records their vendor
+// payouts, in one transaction.
+func (r *OrderRepository) Create(ctx context.Context, order *models.Order, split PayoutSplitter) error {
+	payouts, err := split(ctx, order.Items)
+	if err != nil {
+		return err
+	}
+
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		return createOrder(ctx, tx, order, payouts)
+	})
+}
+
+// CreateRenewal creates a subscription's renewal order like Create and, in
+// the same transaction, moves the subscription from its billing date
+// billedAt to nextBillingAt. A renewal is therefore placed once per billing
+// date: ErrConflict is returned, and nothing changes, if the subscription
+// has moved on from billedAt in the meantime.
+func (r *OrderRepository) CreateRenewal(ctx context.Context, order *models.Order, split PayoutSplitter, subscriptionID uuid.UUID, billedAt, nextBillingAt time.Time) error {
+	payouts, err := split(ctx, order.Items)
+	if err != nil {
+		return err
+	}
+
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, database.Qualify(`
+			UPDATE {shop}.subscriptions
+			SET next_billing_at = $3
+			WHERE id = $1 AND next_billing_at = $2
+		`), subscriptionID, billedAt, nextBillingAt)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrConflict
+		}
+
+		return createOrder(ctx, tx, order, payouts)
+	})
+}
+
+func createOrder(ctx context.Context, tx pgx.Tx, order *models.Order, payouts []*models.VendorPayout) error {
+	if err := insertOrder(ctx, tx, order, false); err != nil {
+		return err
+	}
+	if err := insertOrderItems(ctx, tx, order, false); err != nil {
+		return err
+	}
+	return recordPayouts(ctx, tx, order.Items, payouts)
+}
+
+// OrderPricer fills in an order's discount, tax and total from its items
+// and coupon. CreateFromCart runs it before its transaction begins, like a
+// PayoutSplitter; an error stops the order from being placed.
+type OrderPricer func(ctx context.Context, order *models.Order) error
+
+// CreateFromCart places the cart's items as an order. order supplies the
+// customer, addresses, payment method and notes, and is filled in with its
+// items, the cart's coupon and ID; price then works out its discount, tax
+// and total. The order is priced and split before its transaction begins,
+// then the transaction locks the cart and returns ErrCartChanged if its
+// items or coupon changed in the meantime. Each item's stock is taken from
+// its variant or, for items without one, its product; events reserve seats
+// instead. The coupon's use is claimed, the vendor payouts are recorded and
+// the cart is emptied in the same transaction, so if any item is out of
+// stock, ErrOutOfStock is returned and nothing changes. An empty cart
+// yields ErrCartEmpty.
+func (r *OrderRepository) CreateFromCart(ctx context.Context, cartID uuid.UUID, order *models.Order, price OrderPricer, split PayoutSplitter) error {
+	items, couponID, err := readCartOrder(ctx, r.db, cartID)
+	if err != nil {
+		return err
+	}
+	if len(items) == 0 {
+		return ErrCartEmpty
+	}
+	order.Items = items
+	order.CouponID = couponID
+	if err := price(ctx, order); err != nil {
+		return err
+	}
+	payouts, err := split(ctx, order.Items)
+	if err != nil {
+		return err
+	}
+
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		if err := lockCart(ctx, tx, cartID); err != nil {
+			return err
+		}
+
+		items, couponID, err := readCartOrder(ctx, tx, cartID)
+		if err != nil {
+			return err
+		}
+		if !sameOrderItems(order.Items, items) || !sameID(order.CouponID, couponID) {
+			return ErrCartChanged
+		}
+
+		if order.CouponID != nil {
+			if err := incrementCouponUsage(ctx, tx, *order.CouponID); err != nil {
+				return err
+			}
+		}
+		if err := insertOrder(ctx, tx, order, true); err != nil {
+			return err
+		}
+		if err := insertOrderItems(ctx, tx, order, true); err != nil {
+			return err
+		}
+		if err := recordPayouts(ctx, tx, order.Items, payouts); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, database.Qualify(`DELETE FROM {shop}.cart_items WHERE cart_id = $1`), cartID)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(ctx, database.Qualify(`UPDATE {shop}.carts SET coupon_id = NULL WHERE id = $1`), cartID)
+		return err
+	})
+}
+
+// insertOrder inserts the order. stockTaken records whether its items are
+// taken out of stock, for cancelling it to put them back.
+func insertOrder(ctx context.Context, tx pgx.Tx, order *models.Order, stockTaken bool) error {
+	query := database.Qualify(`
+		INSERT INTO {shop}.orders (customer_id, status, total_amount, coupon_id, discount_amount,
+			tax_amount, tax_rate, tax_inclusive,
+			shipping_address, billing_address, payment_method, payment_status, tracking_number, notes,
+			stock_taken)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+		RETURNING id, version, created_at, updated_at
+	`)
+
+	return tx.QueryRow(ctx, query,
+		order.CustomerID,
+		order.Status,
+		order.TotalAmount,
+		order.CouponID,
+		order.DiscountAmount,
+		order.TaxAmount,
+		order.TaxRate,
+		order.TaxInclusive,
+		order.ShippingAddress,
+		order.BillingAddress,
+		order.PaymentMethod,
+		order.PaymentStatus,
+		order.TrackingNumber,
+		order.Notes,
+		stockTaken,
+	).Scan(&order.ID, &order.Version, &order.CreatedAt, &order.UpdatedAt)
+}
+
+// insertOrderItems inserts the order's items, reserving seats for events
+// and issuing their tickets. With takeStock, the other items are taken out
+// of stock.
+func insertOrderItems(ctx context.Context, tx pgx.Tx, order *models.Order, takeStock bool) error {
+	for _, item := range order.Items {
+		isEvent, err := reserveEventSeats(ctx, tx, item.ProductID, item.Quantity)
+		if err != nil {
+			return err
+		}
+		if takeStock && !isEvent {
+			if item.VariantID != nil {
+				err = decrementVariantStock(ctx, tx, *item.VariantID, item.Quantity)
+			} else {
+				err = decrementProductStock(ctx, tx, item.ProductID, item.Quantity)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		item.OrderID = order.ID
+		err = tx.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.order_items (order_id, product_id, variant_id, quantity, price)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id, created_at, updated_at
+		`), item.OrderID, item.ProductID, item.VariantID, item.Quantity, item.Price).Scan(&item.ID, &item.CreatedAt, &item.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		if isEvent {
+			if item.Tickets, err = issueTickets(ctx, tx, item); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// readCartOrder returns the cart's items as order items, and its coupon.
+func readCartOrder(ctx context.Context, db dbtx, cartID uuid.UUID) ([]*models.OrderItem, *uuid.UUID, error) {
+	items, err := listCartOrderItems(ctx, db, cartID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var couponID *uuid.UUID
+	err = db.QueryRow(ctx, database.Qualify(`SELECT coupon_id FROM {shop}.carts WHERE id = $1`), cartID).Scan(&couponID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return items, couponID, nil
+}
+
+// sameOrderItems reports whether two reads of a cart's items agree.
+func sameOrderItems(a, b []*models.OrderItem) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].ProductID != b[i].ProductID || !sameID(a[i].VariantID, b[i].VariantID) ||
+			a[i].Quantity != b[i].Quantity || a[i].Price != b[i].Price {
+			return false
+		}
+	}
+	return true
+}
+
+func sameID(a, b *uuid.UUID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// listCartOrderItems returns the cart's items as order items.
+func listCartOrderItems(ctx context.Context, db dbtx, cartID uuid.UUID) ([]*models.OrderItem, error) {
+	rows, err := db.Query(ctx, database.Qualify(`
+		SELECT product_id, variant_id, quantity, unit_price
+		FROM {shop}.cart_items
+		WHERE cart_id = $1
+		ORDER BY created_at, id
+	`), cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []*models.OrderItem{}
+	for rows.Next() {
+		var item models.OrderItem
+		if err := rows.Scan(&item.ProductID, &item.VariantID, &item.Quantity, &item.Price); err != nil {
+			return nil, err
+		}
+		items = append(items, &item)
+	}
+
+	return items, rows.Err()
+}
+
+// reserveEventSeats claims quantity seats when the product is an event. The
+// event row is locked so concurrent orders cannot oversell it. It reports
+// whether the product is an event at all.
+func reserveEventSeats(ctx context.Context, tx pgx.Tx, productID uuid.UUID, quantity int) (bool, error) {
+	var capacity, ticketsSold int
+	err := tx.QueryRow(ctx, database.Qualify(`
+		SELECT capacity, tickets_sold
+		FROM {shop}.event_details
+		WHERE product_id = $1
+		FOR UPDATE
+	`), productID).Scan(&capacity, &ticketsSold)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	if capacity-ticketsSold < quantity {
+		return true, ErrEventSoldOut
+	}
+
+	_, err = tx.Exec(ctx, database.Qualify(`
+		UPDATE {shop}.event_details
+		SET tickets_sold = tickets_sold + $1
+		WHERE product_id = $2
+	`), quantity, productID)
+	if err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// issueTickets creates one ticket per unit of an event order item.
+func issueTickets(ctx context.Context, tx pgx.Tx, item *models.OrderItem) ([]*models.OrderTicket, error) {
+	tickets := make([]*models.OrderTicket, 0, item.Quantity)
+	for i := 0; i < item.Quantity; i++ {
+		ticket := &models.OrderTicket{
+			TicketID:    uuid.New(),
+			OrderItemID: item.ID,
+		}
+		ticket.QRData = fmt.Sprintf("TICKET:%s:%s", item.ID, ticket.TicketID)
+
+		err := tx.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.order_tickets (ticket_id, order_item_id, qr_data)
+			VALUES ($1, $2, $3)
+			RETURNING created_at
+		`), ticket.TicketID, ticket.OrderItemID, ticket.QRData).Scan(&ticket.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, ticket)
+	}
+
+	return tickets, nil
+}
+
+func (r *OrderRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Order, error) {
+	query := database.Qualify(`
+		SELECT o.id, o.customer_id, o.status, o.total_amount, o.coupon_id, COALESCE(co.code, ''), o.discount_amount,
+			   o.tax_amount, o.tax_rate, o.tax_inclusive, o.shipping_address, o.billing_address,
+			   o.payment_method, o.payment_status, COALESCE(o.tracking_number, ''), COALESCE(o.notes, ''),
+			   o.version, o.created_at, o.updated_at,
+			   COALESCE(u.full_name, ''), COALESCE(u.email, '')
+		FROM {shop}.orders o
+		LEFT JOIN {shop}.coupons co ON o.coupon_id = co.id
+		LEFT JOIN {shop}.customers c ON o.customer_id = c.id
+		LEFT JOIN {auth}.users u ON c.user_id = u.id
+		WHERE o.id = $1
+	`)
+
+	var order models.Order
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&order.ID,
+		&order.CustomerID,
+		&order.Status,
+		&order.TotalAmount,
+		&order.CouponID,
+		&order.CouponCode,
+		&order.DiscountAmount,
+		&order.TaxAmount,
+		&order.TaxRate,
+		&order.TaxInclusive,
+		&order.ShippingAddress,
+		&order.BillingAddress,
+		&order.PaymentMethod,
+		&order.PaymentStatus,
+		&order.TrackingNumber,
+		&order.Notes,
+		&order.Version,
+		&order.CreatedAt,
+		&order.UpdatedAt,
+		&order.CustomerName,
+		&order.CustomerEmail,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Get items
+	itemsQuery := database.Qualify(`
+		SELECT id, order_id, product_id, variant_id, quantity, price, vendor_id, commission_amount, created_at, updated_at
+		FROM {shop}.order_items
+		WHERE order_id = $1
+		ORDER BY created_at ASC
+	`)
+
+	rows, err := r.db.Query(ctx, itemsQuery, order.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	order.Items = []*models.OrderItem{}
+	for rows.Next() {
+		var item models.OrderItem
+		if err := rows.Scan(
+			&item.ID, &item.OrderID, &item.ProductID, &item.VariantID, &item.Quantity, &item.Price,
+			&item.VendorID, &item.CommissionAmount, &item.CreatedAt, &item.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		order.Items = append(order.Items, &item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return &order, nil
+}
+
+func (r *OrderRepository) UpdatePaymentStatus(ctx context.Context, id uuid.UUID, paymentStatus string) error {
+	query := database.Qualify(`
+		UPDATE {shop}.orders
+		SET payment_status = $1, version = version + 1
+		WHERE id = $2
+	`)
+
+	_, err := r.db.Exec(ctx, query, paymentStatus, id)
+	return err
+}
+
+// UpdateStatus moves the order from one status to another and records the
+// change in the audit log, attributed to actorID, in the same transaction.
+// Cancelling or refunding the order also releases what placing it claimed,
+// as releaseOrder does. ErrConflict is returned if the order is no longer
+// in the from status.
+func (r *OrderRepository) UpdateStatus(ctx context.Context, id uuid.UUID, from, to models.OrderStatus, actorID uuid.UUID) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, database.Qualify(`
+			UPDATE {shop}.orders
+			SET status = $3, version = version + 1, updated_at = NOW()
+			WHERE id = $1 AND status = $2
+		`), id, from, to)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return ErrConflict
+		}
+
+		if to == models.OrderStatusCancelled || to == models.OrderStatusRefunded {
+			if err := releaseOrder(ctx, tx, id); err != nil {
+				return err
+			}
+		}
+
+		return insertAuditLog(ctx, tx, &models.AuditLog{
+			ActorID:    nullableUUID(actorID),
+			Action:     "order.status_change",
+			EntityType: "order",
+			EntityID:   id.String(),
+			Details: map[string]interface{}{
+				"from": from,
+				"to":   to,
+			},
+		})
+	})
+}
+
+// releaseOrder undoes what placing the order claimed: its items go back in
+// stock if they were taken, its event seats are freed and their tickets
+// deleted, its coupon use is given back and its pending vendor payouts are
+// dropped, along with their share of any batch not yet transferred. Payouts
+// already paid out are kept.
+func releaseOrder(ctx context.Context, tx pgx.Tx, id uuid.UUID) error {
+	statements := []string{
+		`UPDATE {shop}.products p
+		SET stock = p.stock + taken.quantity
+		FROM (
+			SELECT oi.product_id, SUM(oi.quantity) AS quantity
+			FROM {shop}.order_items oi
+			JOIN {shop}.orders o ON o.id = oi.order_id
+			WHERE oi.order_id = $1 AND o.stock_taken AND oi.variant_id IS NULL
+			GROUP BY oi.product_id
+		) taken
+		WHERE p.id = taken.product_id
+		  AND NOT EXISTS (SELECT 1 FROM {shop}.event_details e WHERE e.product_id = p.id)`,
+		`UPDATE {shop}.product_variants v
+		SET stock = v.stock + taken.quantity
+		FROM (
+			SELECT oi.variant_id, SUM(oi.quantity) AS quantity
+			FROM {shop}.order_items oi
+			JOIN {shop}.orders o ON o.id = oi.order_id
+			WHERE oi.order_id = $1 AND o.stock_taken
+			GROUP BY oi.variant_id
+		) taken
+		WHERE v.id = taken.variant_id`,
+		`UPDATE {shop}.event_details e
+		SET tickets_sold = GREATEST(e.tickets_sold - sold.quantity, 0), updated_at = NOW()
+		FROM (
+			SELECT product_id, SUM(quantity) AS quantity
+			FROM {shop}.order_items
+			WHERE order_id = $1
+			GROUP BY product_id
+		) sold
+		WHERE e.product_id = sold.product_id`,
+		`DELETE FROM {shop}.order_tickets t
+		USING {shop}.order_items oi
+		WHERE oi.order_id = $1 AND t.order_item_id = oi.id`,
+		`UPDATE {shop}.coupons c
+		SET used_count = GREATEST(c.used_count - 1, 0), updated_at = NOW()
+		FROM {shop}.orders o
+		WHERE o.id = $1 AND o.coupon_id = c.id`,
+		`WITH dropped AS (
+			DELETE FROM {shop}.vendor_payouts vp
+			USING {shop}.order_items oi
+			WHERE oi.order_id = $1 AND vp.order_item_id = oi.id AND vp.status = 'pending'
+			RETURNING vp.batch_id, vp.net_amount
+		)
+		UPDATE {shop}.payout_batches b
+		SET total_amount = b.total_amount - d.net_amount, updated_at = NOW()
+		FROM (
+			SELECT batch_id, SUM(net_amount) AS net_amount
+			FROM dropped
+			WHERE batch_id IS NOT NULL
+			GROUP BY batch_id
+		) d
+		WHERE b.id = d.batch_id`,
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(ctx, database.Qualify(statement), id); err != nil {
+			return err
+		}
+	}
+
+	// Batches left without payouts have nothing to transfer
+	_, err := tx.Exec(ctx, database.Qualify(`
+		DELETE FROM {shop}.payout_batches b
+		WHERE b.status <> 'paid'
+		  AND NOT EXISTS (SELECT 1 FROM {shop}.vendor_payouts vp WHERE vp.batch_id = b.id)
+	`))
+	return err
+}
+
+// AdminList returns a page of orders matching the filter, with the
+// customer's name and email filled in, and the total number of matches.
+func (r *OrderRepository) AdminList(ctx context.Context, filter models.OrderAdminFilter, limit, offset int) ([]*models.Order, int, error) {
+	whereClause, args := orderAdminWhere(filter)
+
+	orderBy, ok := orderSorts[filter.Sort]
+	if !ok {
+		orderBy = orderSorts["created_at_desc"]
+	}
+
+	query := fmt.Sprintf(database.Qualify(`
+		SELECT o.id, o.customer_id, o.status, o.total_amount, o.shipping_address, o.billing_address,
+			   o.payment_method, o.payment_status, COALESCE(o.tracking_number, ''), COALESCE(o.notes, ''),
+			   o.version, o.created_at, o.updated_at,
+			   COALESCE(u.full_name, ''), COALESCE(u.email, ''),
+			   COUNT(*) OVER()
+		FROM {shop}.orders o
+		LEFT JOIN {shop}.customers c ON o.customer_id = c.id
+		LEFT JOIN {auth}.users u ON c.user_id = u.id
+		%s
+		ORDER BY %s
+		LIMIT $%d OFFSET $%d
+	`), whereClause, orderBy, len(args)+1, len(args)+2)
+
+	args = append(args, limit, offset)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	orders := []*models.Order{}
+	total := 0
+	for rows.Next() {
+		var order models.Order
+		if err := rows.Scan(
+			&order.ID, &order.CustomerID, &order.Status, &order.TotalAmount, &order.ShippingAddress,
+			&order.BillingAddress, &order.PaymentMethod, &order.PaymentStatus, &order.TrackingNumber,
+			&order.Notes, &order.Version, &order.CreatedAt, &order.UpdatedAt,
+			&order.CustomerName, &order.CustomerEmail,
+			&total,
+		); err != nil {
+			return nil, 0, err
+		}
+		orders = append(orders, &order)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return orders, total, nil
+}
+
+// orderAdminWhere builds the WHERE clause and its arguments for the admin
+// order filter. The clause expects the orders table aliased as o and the
+// users table as u.
+func orderAdminWhere(filter models.OrderAdminFilter) (string, []interface{}) {
+	args := []interface{}{}
+	where := []string{}
+
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where = append(where, fmt.Sprintf("o.status = $%d", len(args)))
+	}
+	if filter.PaymentStatus != "" {
+		args = append(args, filter.PaymentStatus)
+		where = append(where, fmt.Sprintf("o.payment_status = $%d", len(args)))
+	}
+	if filter.CustomerEmail != "" {
+		args = append(args, "%"+escapeLike(filter.CustomerEmail)+"%")
+		where = append(where, fmt.Sprintf("u.email ILIKE $%d", len(args)))
+	}
+	if filter.From != nil {
+		args = append(args, *filter.From)
+		where = append(where, fmt.Sprintf("o.created_at >= $%d", len(args)))
+	}
+	if filter.To != nil {
+		args = append(args, *filter.To)
+		where = append(where, fmt.Sprintf("o.created_at < $%d", len(args)))
+	}
+	if filter.MinTotal != nil {
+		args = append(args, *filter.MinTotal)
+		where = append(where, fmt.Sprintf("o.total_amount >= $%d", len(args)))
+	}
+	if filter.MaxTotal != nil {
+		args = append(args, *filter.MaxTotal)
+		where = append(where, fmt.Sprintf("o.total_amount <= $%d", len(args)))
+	}
+
+	if len(where) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(where, " AND "), args
+}
+
+// Export streams the orders matching the filter, oldest first, to fn. Rows
+// are read through a server-side cursor in batches of exportBatchSize, so
+// memory use does not grow with the size of the export.
+func (r *OrderRepository) Export(ctx context.Context, filter models.OrderAdminFilter, fn func(*models.OrderExportRow) error) error {
+	whereClause, args := orderAdminWhere(filter)
+
+	// Cursors only live inside a transaction. The export only reads, so it
+	// is not registered with the tracker.
+	return database.WithTransaction(ctx, r.db, nil, func(tx pgx.Tx) error {
+		query := fmt.Sprintf(database.Qualify(`
+			DECLARE order_export NO SCROLL CURSOR FOR
+			SELECT o.id, o.created_at, COALESCE(u.email, ''), o.status,
+				   COALESCE(items.subtotal, 0), o.total_amount, o.payment_method, o.payment_status
+			FROM {shop}.orders o
+			LEFT JOIN {shop}.customers c ON o.customer_id = c.id
+			LEFT JOIN {auth}.users u ON c.user_id = u.id
+			LEFT JOIN LATERAL (
+				SELECT SUM(oi.price * oi.quantity) AS subtotal
+				FROM {shop}.order_items oi
+				WHERE oi.order_id = o.id
+			) items ON TRUE
+			%s
+			ORDER BY o.created_at, o.id
+		`), whereClause)
+
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return err
+		}
+
+		fetch := fmt.Sprintf("FETCH %d FROM order_export", exportBatchSize)
+		for {
+			rows, err := tx.Query(ctx, fetch)
+			if err != nil {
+				return err
+			}
+
+			fetched := 0
+			for rows.Next() {
+				fetched++
+				var row models.OrderExportRow
+				if err := rows.Scan(
+					&row.OrderID, &row.CreatedAt, &row.CustomerEmail, &row.Status,
+					&row.Subtotal, &row.Total, &row.PaymentMethod, &row.PaymentStatus,
+				); err != nil {
+					rows.Close()
+					return err
+				}
+				if err := fn(&row); err != nil {
+					rows.Close()
+					return err
+				}
+			}
+			rows.Close()
+
+			if err := rows.Err(); err != nil {
+				return err
+			}
+			if fetched < exportBatchSize {
+				return nil
+			}
+		}
+	})
+}
+
+// Search finds orders whose ID, customer email, item SKUs or note content
+// contain the filter query. It returns the requested page together with the
+// total number of matches.
+func (r *OrderRepository) Search(ctx context.Context, filter models.OrderSearchFilter, limit, offset int) ([]*models.OrderSearchResult, int, error) {
+	pattern := "%" + escapeLike(filter.Query) + "%"
+	args := []interface{}{pattern}
+	where := []string{}
+
+	if filter.DateFrom != nil {
+		args = append(args, *filter.DateFrom)
+		where = append(where, fmt.Sprintf("o.created_at >= $%d", len(args)))
+	}
+	if filter.DateTo != nil {
+		args = append(args, *filter.DateTo)
+		where = append(where, fmt.Sprintf("o.created_at < $%d", len(args)))
+	}
+
+	dateClause := ""
+	if len(where) > 0 {
+		dateClause = "WHERE " + strings.Join(where, " AND ")
+	}
+
+	query := fmt.Sprintf(database.Qualify(`
+		SELECT id, email, status, total_amount, created_at,
+			   id_match, email_match, sku_match, note_match,
+			   COUNT(*) OVER()
+		FROM (
+			SELECT o.id, COALESCE(u.email, '') AS email, o.status, o.total_amount, o.created_at,
+				   o.id::text ILIKE $1 AS id_match,
+				   COALESCE(u.email ILIKE $1, FALSE) AS email_match,
+				   EXISTS (
+					   SELECT 1
+					   FROM {shop}.order_items oi
+					   JOIN {shop}.products p ON p.id = oi.product_id
+					   WHERE oi.order_id = o.id AND p.sku ILIKE $1
+				   ) AS sku_match,
+				   EXISTS (
+					   SELECT 1
+					   FROM {shop}.order_notes n
+					   WHERE n.order_id = o.id AND n.content ILIKE $1
+				   ) AS note_match
+			FROM {shop}.orders o
+			LEFT JOIN {shop}.customers c ON o.customer_id = c.id
+			LEFT JOIN {auth}.users u ON c.user_id = u.id
+			%s
+		) matches
+		WHERE id_match OR email_match OR sku_match OR note_match
+		ORDER BY created_at DESC
+		LIMIT $%d OFFSET $%d
+	`), dateClause, len(args)+1, len(args)+2)
+
+	args = append(args, limit, offset)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results := []*models.OrderSearchResult{}
+	total := 0
+	for rows.Next() {
+		var result models.OrderSearchResult
+		var idMatch, emailMatch, skuMatch, noteMatch bool
+		if err := rows.Scan(
+			&result.OrderID, &result.CustomerEmail, &result.Status, &result.TotalAmount, &result.CreatedAt,
+			&idMatch, &emailMatch, &skuMatch, &noteMatch,
+			&total,
+		); err != nil {
+			return nil, 0, err
+		}
+
+		result.MatchedIn = []string{}
+		if idMatch {
+			result.MatchedIn = append(result.MatchedIn, "id")
+		}
+		if emailMatch {
+			result.MatchedIn = append(result.MatchedIn, "customer_email")
+		}
+		if skuMatch {
+			result.MatchedIn = append(result.MatchedIn, "sku")
+		}
+		if noteMatch {
+			result.MatchedIn = append(result.MatchedIn, "note")
+		}
+
+		results = append(results, &result)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return results, total, nil
+}
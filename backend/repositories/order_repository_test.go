@@ -0,0 +1,438 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pashagolub/pgxmock"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// createTestCustomer creates a customer with a cart. The user, the customer
+// and its orders are deleted when the test ends.
+func createTestCustomer(t *testing.T, pool *pgxpool.Pool) (*models.Customer, *models.Cart) {
+	t.Helper()
+	ctx := context.Background()
+
+	user := &models.User{
+		Email:        dbtest.UniqueName("customer") + "@example.com",
+		PasswordHash: "x",
+		FullName:     "Test Customer",
+		Role:         "customer",
+	}
+	if err := NewUserRepository(pool, nil).Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.users WHERE id = $1"), user.ID)
+	})
+
+	customer, err := NewCustomerRepository(pool, nil).GetOrCreateByUserID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.orders WHERE customer_id = $1"), customer.ID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.customers WHERE id = $1"), customer.ID)
+	})
+
+	cart, err := NewCartRepository(pool, nil).GetOrCreate(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return customer, cart
+}
+
+// createTestProduct creates a physical product with the stock given. It is
+// deleted when the test ends, so it must be created before the customers
+// whose orders refer to it.
+func createTestProduct(t *testing.T, pool *pgxpool.Pool, stock int) uuid.UUID {
+	t.Helper()
+
+	var id uuid.UUID
+	slug := dbtest.UniqueName("product")
+	err := pool.QueryRow(context.Background(), database.Qualify(`
+		INSERT INTO {shop}.products (name, slug, description, price, sku, stock)
+		VALUES ($1, $1, 'A test product', 10, $1, $2)
+		RETURNING id
+	`), slug, stock).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.products WHERE id = $1"), id)
+	})
+	return id
+}
+
+// createTestOrder places an order for the customer with the total given,
+// dated createdAt. It is deleted with the customer's other orders.
+func createTestOrder(t *testing.T, pool *pgxpool.Pool, customerID uuid.UUID, status string, total float64, createdAt time.Time) uuid.UUID {
+	t.Helper()
+
+	var id uuid.UUID
+	err := pool.QueryRow(context.Background(), database.Qualify(`
+		INSERT INTO {shop}.orders (customer_id, status, total_amount, shipping_address, billing_address,
+			payment_method, payment_status, created_at)
+		VALUES ($1, $2, $3, '{}', '{}', 'card', 'paid', $4)
+		RETURNING id
+	`), customerID, status, total, createdAt).Scan(&id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// The order, the stock taken for its items and the emptying of the cart
+// happen in one transaction: when the last item turns out to be out of
+// stock, the earlier item's stock is not taken and the cart is untouched.
+func TestCreateFromCartIsOneTransaction(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	orders := NewOrderRepository(pool, nil)
+	carts := NewCartRepository(pool, nil)
+
+	plenty := createTestProduct(t, pool, 5)
+	last := createTestProduct(t, pool, 1)
+	customer, cart := createTestCustomer(t, pool)
+	for _, productID := range []uuid.UUID{plenty, last} {
+		item := &models.CartItem{CartID: cart.ID, ProductID: productID, Quantity: 1, UnitPrice: 10}
+		if err := carts.AddItem(ctx, item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	price := func(ctx context.Context, order *models.Order) error {
+		order.TotalAmount = 0
+		for _, item := range order.Items {
+			order.TotalAmount += item.Price * float64(item.Quantity)
+		}
+		return nil
+	}
+	split := func(ctx context.Context, items []*models.OrderItem) ([]*models.VendorPayout, error) {
+		return nil, nil
+	}
+	newOrder := func() *models.Order {
+		return &models.Order{
+			CustomerID:    customer.ID,
+			Status:        models.OrderStatusPending,
+			PaymentMethod: "card",
+			PaymentStatus: "pending",
+		}
+	}
+	stockOf := func(productID uuid.UUID) int {
+		t.Helper()
+		var stock int
+		err := pool.QueryRow(ctx, database.Qualify(`SELECT stock FROM {shop}.products WHERE id = $1`), productID).Scan(&stock)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stock
+	}
+	count := func(query string, id uuid.UUID) int {
+		t.Helper()
+		var n int
+		if err := pool.QueryRow(ctx, database.Qualify(query), id).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	const countOrders = `SELECT COUNT(*) FROM {shop}.orders WHERE customer_id = $1`
+	const countCartItems = `SELECT COUNT(*) FROM {shop}.cart_items WHERE cart_id = $1`
+
+	// Someone else buys the last unit after it went into the cart
+	dbtest.Exec(t, pool, database.Qualify("UPDATE {shop}.products SET stock = 0 WHERE id = $1"), last)
+
+	if err := orders.CreateFromCart(ctx, cart.ID, newOrder(), price, split); !errors.Is(err, ErrOutOfStock) {
+		t.Fatalf("CreateFromCart with an item out of stock: err = %v, want ErrOutOfStock", err)
+	}
+	if n := count(countOrders, customer.ID); n != 0 {
+		t.Errorf("%d orders were created", n)
+	}
+	if stock := stockOf(plenty); stock != 5 {
+		t.Errorf("stock of the item in stock = %d, want 5", stock)
+	}
+	if n := count(countCartItems, cart.ID); n != 2 {
+		t.Errorf("cart has %d items, want 2", n)
+	}
+
+	dbtest.Exec(t, pool, database.Qualify("UPDATE {shop}.products SET stock = 1 WHERE id = $1"), last)
+
+	order := newOrder()
+	if err := orders.CreateFromCart(ctx, cart.ID, order, price, split); err != nil {
+		t.Fatalf("CreateFromCart: %v", err)
+	}
+	if len(order.Items) != 2 || order.TotalAmount != 20 {
+		t.Errorf("order = %d items for %v, want 2 for 20", len(order.Items), order.TotalAmount)
+	}
+	if n := count(countOrders, customer.ID); n != 1 {
+		t.Errorf("%d orders were created, want 1", n)
+	}
+	if stock := stockOf(plenty); stock != 4 {
+		t.Errorf("stock after the order = %d, want 4", stock)
+	}
+	if stock := stockOf(last); stock != 0 {
+		t.Errorf("stock of the last unit after the order = %d, want 0", stock)
+	}
+	if n := count(countCartItems, cart.ID); n != 0 {
+		t.Errorf("cart still has %d items after the order", n)
+	}
+}
+
+// expectCartRead expects the cart's items, one line of quantity of the
+// product, and its coupon to be read.
+func expectCartRead(mock pgxmock.PgxPoolIface, cartID, productID uuid.UUID, quantity int) {
+	mock.ExpectQuery("FROM .*cart_items").WithArgs(cartID).WillReturnRows(
+		pgxmock.NewRows([]string{"product_id", "variant_id", "quantity", "unit_price"}).
+			AddRow(productID, nil, quantity, 10.0))
+	mock.ExpectQuery("SELECT coupon_id").WithArgs(cartID).WillReturnRows(
+		pgxmock.NewRows([]string{"coupon_id"}).AddRow(nil))
+}
+
+// The order is priced before its transaction begins, so pricing queries
+// never need a second connection while the transaction holds one. A
+// failed pricing never begins the transaction.
+func TestCreateFromCartPricesBeforeTransaction(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	orders := &OrderRepository{db: mock}
+	cartID, productID := uuid.New(), uuid.New()
+
+	expectCartRead(mock, cartID, productID, 1)
+
+	failure := errors.New("no tax rate")
+	var priced []*models.OrderItem
+	price := func(ctx context.Context, order *models.Order) error {
+		priced = order.Items
+		return failure
+	}
+	split := func(ctx context.Context, items []*models.OrderItem) ([]*models.VendorPayout, error) {
+		t.Error("split ran after pricing failed")
+		return nil, nil
+	}
+
+	if err := orders.CreateFromCart(context.Background(), cartID, &models.Order{}, price, split); !errors.Is(err, failure) {
+		t.Errorf("CreateFromCart: err = %v, want the pricing error", err)
+	}
+	if len(priced) != 1 || priced[0].ProductID != productID || priced[0].Quantity != 1 {
+		t.Errorf("priced items = %+v, want the cart's line", priced)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A cart changed between pricing and the transaction's lock on it fails
+// the checkout rather than placing an order at the old prices.
+func TestCreateFromCartRejectsChangedCart(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	orders := &OrderRepository{db: mock}
+	cartID, productID := uuid.New(), uuid.New()
+
+	expectCartRead(mock, cartID, productID, 1)
+	mock.ExpectBegin()
+	mock.ExpectQuery("FOR UPDATE").WithArgs(cartID).WillReturnRows(pgxmock.NewRows([]string{"id"}).AddRow(cartID))
+	// Another request added one more to the cart after it was priced
+	expectCartRead(mock, cartID, productID, 2)
+	mock.ExpectRollback()
+
+	price := func(ctx context.Context, order *models.Order) error { return nil }
+	split := func(ctx context.Context, items []*models.OrderItem) ([]*models.VendorPayout, error) { return nil, nil }
+
+	if err := orders.CreateFromCart(context.Background(), cartID, &models.Order{}, price, split); !errors.Is(err, ErrCartChanged) {
+		t.Errorf("CreateFromCart: err = %v, want ErrCartChanged", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// Each order is found through one field only, and matched_in names it.
+func TestOrderSearchReportsWhereItMatched(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	orders := NewOrderRepository(pool, nil)
+
+	productID := createTestProduct(t, pool, 1)
+	customer, _ := createTestCustomer(t, pool)
+	other, _ := createTestCustomer(t, pool)
+	var email, sku string
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		SELECT u.email FROM {shop}.customers c JOIN {auth}.users u ON u.id = c.user_id WHERE c.id = $1
+	`), customer.ID).Scan(&email); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.QueryRow(ctx, database.Qualify("SELECT sku FROM {shop}.products WHERE id = $1"), productID).Scan(&sku); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	byEmail := createTestOrder(t, pool, customer.ID, "confirmed", 20, now)
+	bySKU := createTestOrder(t, pool, other.ID, "confirmed", 30, now)
+	dbtest.Exec(t, pool, database.Qualify(`
+		INSERT INTO {shop}.order_items (order_id, product_id, quantity, price) VALUES ($1, $2, 1, 30)
+	`), bySKU, productID)
+	byNote := createTestOrder(t, pool, other.ID, "shipped", 40, now.Add(-48*time.Hour))
+	note := dbtest.UniqueName("parcel")
+	dbtest.Exec(t, pool, database.Qualify(`
+		INSERT INTO {shop}.order_notes (order_id, content, is_internal) VALUES ($1, $2, TRUE)
+	`), byNote, "Left the "+note+" with a neighbour")
+
+	tests := []struct {
+		name  string
+		query string
+		want  uuid.UUID
+		field string
+	}{
+		{"customer email", email, byEmail, "customer_email"},
+		{"item SKU", sku, bySKU, "sku"},
+		{"note content", note, byNote, "note"},
+		{"order ID", byNote.String()[:13], byNote, "id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			results, total, err := orders.Search(ctx, models.OrderSearchFilter{Query: tt.query}, 10, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 1 || len(results) != 1 || results[0].OrderID != tt.want {
+				t.Fatalf("Search(%q) = %d results of %d, want order %s only", tt.query, len(results), total, tt.want)
+			}
+			if got := results[0].MatchedIn; len(got) != 1 || got[0] != tt.field {
+				t.Errorf("matched_in = %v, want [%s]", got, tt.field)
+			}
+		})
+	}
+
+	// The note's order is two days old, so a search from yesterday skips it
+	yesterday := now.Add(-24 * time.Hour)
+	results, total, err := orders.Search(ctx, models.OrderSearchFilter{Query: note, DateFrom: &yesterday}, 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 0 || len(results) != 0 {
+		t.Errorf("Search from yesterday = %d results of %d, want none", len(results), total)
+	}
+}
+
+// Concurrent orders for an event cannot sell more tickets than it has
+// seats: of four orders for two tickets each, only the two that fit the
+// five seats succeed, and each of their tickets is issued once.
+func TestEventOrdersCannotOversell(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	orders := NewOrderRepository(pool, nil)
+
+	eventID := createTestProduct(t, pool, 0)
+	dbtest.Exec(t, pool, database.Qualify(`UPDATE {shop}.products SET type = 'event' WHERE id = $1`), eventID)
+	dbtest.Exec(t, pool, database.Qualify(`
+		INSERT INTO {shop}.event_details (product_id, event_date, venue, capacity)
+		VALUES ($1, NOW() + INTERVAL '30 days', 'Town hall', 5)
+	`), eventID)
+	customer, _ := createTestCustomer(t, pool)
+
+	noPayouts := func(ctx context.Context, items []*models.OrderItem) ([]*models.VendorPayout, error) {
+		return nil, nil
+	}
+	const attempts = 4
+	errs := make(chan error, attempts)
+	for i := 0; i < attempts; i++ {
+		go func() {
+			errs <- orders.Create(ctx, &models.Order{
+				CustomerID:      customer.ID,
+				Status:          models.OrderStatusPending,
+				TotalAmount:     20,
+				ShippingAddress: map[string]string{},
+				BillingAddress:  map[string]string{},
+				PaymentMethod:   "card",
+				PaymentStatus:   "pending",
+				Items:           []*models.OrderItem{{ProductID: eventID, Quantity: 2, Price: 10}},
+			}, noPayouts)
+		}()
+	}
+
+	placed, soldOut := 0, 0
+	for i := 0; i < attempts; i++ {
+		switch err := <-errs; {
+		case err == nil:
+			placed++
+		case errors.Is(err, ErrEventSoldOut):
+			soldOut++
+		default:
+			t.Errorf("Create: %v", err)
+		}
+	}
+	if placed != 2 || soldOut != 2 {
+		t.Errorf("%d orders placed and %d sold out, want 2 and 2", placed, soldOut)
+	}
+
+	var sold, tickets, codes int
+	err := pool.QueryRow(ctx, database.Qualify(`SELECT tickets_sold FROM {shop}.event_details WHERE product_id = $1`), eventID).Scan(&sold)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = pool.QueryRow(ctx, database.Qualify(`
+		SELECT COUNT(*), COUNT(DISTINCT t.qr_data)
+		FROM {shop}.order_tickets t
+		JOIN {shop}.order_items oi ON oi.id = t.order_item_id
+		WHERE oi.product_id = $1
+	`), eventID).Scan(&tickets, &codes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sold != 4 || tickets != 4 || codes != 4 {
+		t.Errorf("tickets_sold = %d with %d tickets and %d QR codes, want 4 of each", sold, tickets, codes)
+	}
+}
+
+// Status, customer email and minimum total combined: each other order
+// misses exactly one of the three filters.
+func TestAdminListCombinesFilters(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	orders := NewOrderRepository(pool, nil)
+
+	customer, _ := createTestCustomer(t, pool)
+	other, _ := createTestCustomer(t, pool)
+	var email string
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		SELECT u.email FROM {shop}.customers c JOIN {auth}.users u ON u.id = c.user_id WHERE c.id = $1
+	`), customer.ID).Scan(&email); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	match := createTestOrder(t, pool, customer.ID, "shipped", 120, now)
+	createTestOrder(t, pool, customer.ID, "pending", 120, now)
+	createTestOrder(t, pool, customer.ID, "shipped", 40, now)
+	createTestOrder(t, pool, other.ID, "shipped", 120, now)
+
+	minTotal := 100.0
+	got, total, err := orders.AdminList(ctx, models.OrderAdminFilter{
+		Status:        "shipped",
+		CustomerEmail: email,
+		MinTotal:      &minTotal,
+	}, 20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || total != 1 || got[0].ID != match {
+		t.Fatalf("AdminList = %d orders of %d, want only %s", len(got), total, match)
+	}
+	if got[0].CustomerEmail != email || got[0].CustomerName != "Test Customer" {
+		t.Errorf("customer = %q <%s>, want Test Customer <%s>", got[0].CustomerName, got[0].CustomerEmail, email)
+	}
+}
@@ -0,0 +1,228 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var (
+	ErrPageNotFound  = errors.New("page not found")
+	ErrPageSlugTaken = errors.New("a page with this slug already exists")
+)
+
+// pageColumns selects a page, to be scanned by scanPage.
+const pageColumns = `id, title, slug, content, COALESCE(meta_title, ''), COALESCE(meta_description, ''),
+		   template, status, created_at, updated_at`
+
+// PageRepository reads and writes CMS pages.
+type PageRepository struct {
+	db        *pgxpool.Pool
+	tracker   *database.TransactionTracker
+	redirects *RedirectRepository
+}
+
+func NewPageRepository(db *pgxpool.Pool, tracker *database.TransactionTracker, redirects *RedirectRepository) *PageRepository {
+	return &PageRepository{db: db, tracker: tracker, redirects: redirects}
+}
+
+func (r *PageRepository) Create(ctx context.Context, page *models.Page) error {
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {cms}.pages (title, slug, content, meta_title, meta_description, template, status)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, ''), $6, $7)
+		RETURNING id, created_at, updated_at
+	`),
+		page.Title,
+		page.Slug,
+		page.Content,
+		page.MetaTitle,
+		page.MetaDescription,
+		page.Template,
+		page.Status,
+	).Scan(&page.ID, &page.CreatedAt, &page.UpdatedAt)
+	return pageWriteError(err)
+}
+
+// GetByID returns the page, whatever its status, or nil.
+func (r *PageRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Page, error) {
+	return r.getPage(ctx, "id = $1", id)
+}
+
+// GetBySlug returns the page, whatever its status, or nil.
+func (r *PageRepository) GetBySlug(ctx context.Context, slug string) (*models.Page, error) {
+	return r.getPage(ctx, "slug = $1", slug)
+}
+
+func (r *PageRepository) getPage(ctx context.Context, condition string, arg interface{}) (*models.Page, error) {
+	page, err := scanPage(r.db.QueryRow(ctx, database.Qualify(`
+		SELECT `+pageColumns+`
+		FROM {cms}.pages
+		WHERE `+condition), arg))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return page, nil
+}
+
+// Update saves the page's content, leaving its status alone. A changed slug
+// leaves a redirect from the old URL.
+func (r *PageRepository) Update(ctx context.Context, page *models.Page) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		var oldSlug string
+		err := tx.QueryRow(ctx, database.Qualify("SELECT slug FROM {cms}.pages WHERE id = $1 FOR UPDATE"), page.ID).Scan(&oldSlug)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrPageNotFound
+			}
+			return err
+		}
+
+		err = tx.QueryRow(ctx, database.Qualify(`
+			UPDATE {cms}.pages
+			SET title = $1, slug = $2, content = $3, meta_title = NULLIF($4, ''), meta_description = NULLIF($5, ''),
+				template = $6, updated_at = NOW()
+			WHERE id = $7
+			RETURNING status, created_at, updated_at
+		`),
+			page.Title,
+			page.Slug,
+			page.Content,
+			page.MetaTitle,
+			page.MetaDescription,
+			page.Template,
+			page.ID,
+		).Scan(&page.Status, &page.CreatedAt, &page.UpdatedAt)
+		if err != nil {
+			return pageWriteError(err)
+		}
+
+		return recordSlugChange(ctx, r.redirects.WithTx(tx), "/pages/", oldSlug, page.Slug)
+	})
+}
+
+// UpdateStatus sets the page's status.
+func (r *PageRepository) UpdateStatus(ctx context.Context, page *models.Page) error {
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		UPDATE {cms}.pages SET status = $1, updated_at = NOW() WHERE id = $2 RETURNING updated_at
+	`), page.Status, page.ID).Scan(&page.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrPageNotFound
+	}
+	return err
+}
+
+func (r *PageRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`DELETE FROM {cms}.pages WHERE id = $1`), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPageNotFound
+	}
+	return nil
+}
+
+// List returns a page of the pages with the given status, or of all of them
+// when status is empty, most recently updated first, together with the total
+// number of matches.
+func (r *PageRepository) List(ctx context.Context, status string, limit, offset int) ([]*models.Page, int, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT `+pageColumns+`, COUNT(*) OVER()
+		FROM {cms}.pages
+		WHERE $1 = '' OR status = $1
+		ORDER BY updated_at DESC, id
+		LIMIT $2 OFFSET $3
+	`), status, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	pages := []*models.Page{}
+	total := 0
+	for rows.Next() {
+		var page models.Page
+		if err := rows.Scan(append(pageDest(&page), &total)...); err != nil {
+			return nil, 0, err
+		}
+		pages = append(pages, &page)
+	}
+
+	return pages, total, rows.Err()
+}
+
+// FindSimilarSlug returns the published page whose slug is closest to slug
+// and at most MaxSlugDistance edits away, or nil. An exact match is not
+// considered similar.
+func (r *PageRepository) FindSimilarSlug(ctx context.Context, slug string) (*models.Page, error) {
+	query := database.Qualify(`
+		SELECT id, title, slug, status, created_at, updated_at
+		FROM {cms}.pages
+		WHERE status = 'published' AND slug <> $1 AND levenshtein(slug, $1) <= $2
+		ORDER BY levenshtein(slug, $1), updated_at DESC
+		LIMIT 1
+	`)
+
+	var page models.Page
+	err := r.db.QueryRow(ctx, query, slug, MaxSlugDistance).Scan(
+		&page.ID,
+		&page.Title,
+		&page.Slug,
+		&page.Status,
+		&page.CreatedAt,
+		&page.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+func pageDest(page *models.Page) []interface{} {
+	return []interface{}{
+		&page.ID, &page.Title, &page.Slug, &page.Content, &page.MetaTitle, &page.MetaDescription,
+		&page.Template, &page.Status, &page.CreatedAt, &page.UpdatedAt,
+	}
+}
+
+func scanPage(row pgx.Row) (*models.Page, error) {
+	var page models.Page
+	if err := row.Scan(pageDest(&page)...); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// pageWriteError reports a taken slug as ErrPageSlugTaken.
+func pageWriteError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrPageSlugTaken
+	}
+	return err
+}
+
+// ListSitemapEntries returns the slug and last update of every published
+// page, most recently updated first.
+func (r *PageRepository) ListSitemapEntries(ctx context.Context) ([]models.SitemapEntry, error) {
+	return listSitemapEntries(ctx, r.db, database.Qualify(`
+		SELECT slug, updated_at
+		FROM {cms}.pages
+		WHERE status = 'published'
+		ORDER BY updated_at DESC
+	`))
+}
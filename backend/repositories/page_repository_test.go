@@ -0,0 +1,96 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+func TestPageRepositoryCRUD(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	redirects := NewRedirectRepository(pool)
+	repo := NewPageRepository(pool, nil, redirects)
+
+	page := &models.Page{
+		Title:    "About us",
+		Slug:     dbtest.UniqueName("about"),
+		Content:  "Who we are",
+		Template: "default",
+		Status:   "draft",
+	}
+	if err := repo.Create(ctx, page); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.pages WHERE id = $1"), page.ID)
+	})
+	oldSlug := page.Slug
+
+	taken := &models.Page{Title: "Copy", Slug: page.Slug, Template: "default", Status: "draft"}
+	if err := repo.Create(ctx, taken); !errors.Is(err, ErrPageSlugTaken) {
+		t.Errorf("creating a page with a taken slug: err = %v, want ErrPageSlugTaken", err)
+	}
+
+	got, err := repo.GetBySlug(ctx, page.Slug)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.ID != page.ID || got.MetaTitle != "" || got.Template != "default" {
+		t.Fatalf("GetBySlug = %+v, want the created page", got)
+	}
+
+	page.Slug = dbtest.UniqueName("about-us")
+	page.MetaTitle = "About us"
+	page.MetaDescription = "Who we are"
+	page.Template = "wide"
+	if err := repo.Update(ctx, page); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.redirects WHERE from_path = $1"), "/pages/"+oldSlug)
+	})
+	if page.Status != "draft" {
+		t.Errorf("status after Update = %s, want draft", page.Status)
+	}
+	got, err = repo.GetByID(ctx, page.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Slug != page.Slug || got.MetaDescription != "Who we are" || got.Template != "wide" {
+		t.Errorf("GetByID after Update = %+v, want the new slug, meta description and template", got)
+	}
+
+	page.Status = "published"
+	if err := repo.UpdateStatus(ctx, page); err != nil {
+		t.Fatal(err)
+	}
+	published, total, err := repo.List(ctx, "published", 1000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, p := range published {
+		if p.Status != "published" {
+			t.Errorf("List(published) returned a %s page", p.Status)
+		}
+		found = found || p.ID == page.ID
+	}
+	if !found || total < 1 {
+		t.Errorf("List(published) = %d pages of %d, want the published page among them", len(published), total)
+	}
+
+	if err := repo.Delete(ctx, page.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := repo.GetByID(ctx, page.ID); err != nil || got != nil {
+		t.Errorf("GetByID after Delete = %v, %v; want nil", got, err)
+	}
+	if err := repo.Delete(ctx, page.ID); !errors.Is(err, ErrPageNotFound) {
+		t.Errorf("deleting a deleted page: err = %v, want ErrPageNotFound", err)
+	}
+}
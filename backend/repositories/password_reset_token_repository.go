@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// ErrPasswordResetTokenUsed is returned by MarkUsed when the token was used
+// in the meantime.
+var ErrPasswordResetTokenUsed = errors.New("password reset token already used")
+
+type PasswordResetTokenRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPasswordResetTokenRepository(db *pgxpool.Pool) *PasswordResetTokenRepository {
+	return &PasswordResetTokenRepository{db: db}
+}
+
+// Create records a newly issued token.
+func (r *PasswordResetTokenRepository) Create(ctx context.Context, token *models.PasswordResetToken) error {
+	return r.db.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {auth}.password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+		RETURNING id
+	`), token.UserID, token.TokenHash, token.ExpiresAt).Scan(&token.ID)
+}
+
+// GetByHash returns the token with the given hash, or nil if there is none.
+func (r *PasswordResetTokenRepository) GetByHash(ctx context.Context, tokenHash string) (*models.PasswordResetToken, error) {
+	var token models.PasswordResetToken
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		SELECT id, user_id, token_hash, expires_at, used_at
+		FROM {auth}.password_reset_tokens
+		WHERE token_hash = $1
+	`), tokenHash).Scan(&token.ID, &token.UserID, &token.TokenHash, &token.ExpiresAt, &token.UsedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &token, nil
+}
+
+// MarkUsed uses up the token. Of several concurrent uses of one token
+// exactly one succeeds; the others get ErrPasswordResetTokenUsed.
+func (r *PasswordResetTokenRepository) MarkUsed(ctx context.Context, id uuid.UUID, now time.Time) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`
+		UPDATE {auth}.password_reset_tokens
+		SET used_at = $2
+		WHERE id = $1 AND used_at IS NULL
+	`), id, now)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrPasswordResetTokenUsed
+	}
+	return nil
+}
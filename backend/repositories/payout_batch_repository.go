@@ -0,0 +1,240 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+type PayoutBatchRepository struct {
+	db      *pgxpool.Pool
+	tracker *database.TransactionTracker
+}
+
+func NewPayoutBatchRepository(db *pgxpool.Pool, tracker *database.TransactionTracker) *PayoutBatchRepository {
+	return &PayoutBatchRepository{db: db, tracker: tracker}
+}
+
+// ListUnbatchedPayouts returns the pending payouts that have not been
+// assigned to a batch yet, across all vendors. Only payouts for orders that
+// have been paid, and not cancelled or refunded since, are returned.
+func (r *PayoutBatchRepository) ListUnbatchedPayouts(ctx context.Context) ([]*models.VendorPayout, error) {
+	query := database.Qualify(`
+		SELECT vp.id, vp.vendor_id, vp.order_item_id, vp.gross_amount, vp.commission_amount,
+			   vp.net_amount, vp.status, vp.created_at, vp.updated_at
+		FROM {shop}.vendor_payouts vp
+		JOIN {shop}.order_items oi ON oi.id = vp.order_item_id
+		JOIN {shop}.orders o ON o.id = oi.order_id
+		WHERE vp.status = 'pending' AND vp.batch_id IS NULL
+		  AND o.payment_status = 'paid' AND o.status NOT IN ('cancelled', 'refunded')
+		ORDER BY vp.vendor_id, vp.created_at
+	`)
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payouts := []*models.VendorPayout{}
+	for rows.Next() {
+		var payout models.VendorPayout
+		if err := rows.Scan(
+			&payout.ID,
+			&payout.VendorID,
+			&payout.OrderItemID,
+			&payout.GrossAmount,
+			&payout.CommissionAmount,
+			&payout.NetAmount,
+			&payout.Status,
+			&payout.CreatedAt,
+			&payout.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		payouts = append(payouts, &payout)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return payouts, nil
+}
+
+// CreateBatch inserts the batch and assigns the given payouts to it in a
+// single transaction. Payouts that were released or batched in the meantime,
+// or whose order has since been cancelled or refunded, are skipped, and
+// ErrConflict is returned if that leaves the batch total out of step with
+// its payouts.
+func (r *PayoutBatchRepository) CreateBatch(ctx context.Context, batch *models.PayoutBatch, payoutIDs []uuid.UUID) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		err := tx.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.payout_batches (id, vendor_id, total_amount, reference, status)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING attempts, created_at, updated_at
+		`),
+			batch.ID,
+			batch.VendorID,
+			batch.TotalAmount,
+			batch.Reference,
+			batch.Status,
+		).Scan(&batch.Attempts, &batch.CreatedAt, &batch.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		tag, err := tx.Exec(ctx, database.Qualify(`
+			UPDATE {shop}.vendor_payouts vp
+			SET batch_id = $1
+			FROM {shop}.order_items oi
+			JOIN {shop}.orders o ON o.id = oi.order_id
+			WHERE vp.id = ANY($2) AND vp.vendor_id = $3 AND vp.status = 'pending' AND vp.batch_id IS NULL
+			  AND oi.id = vp.order_item_id
+			  AND o.payment_status = 'paid' AND o.status NOT IN ('cancelled', 'refunded')
+		`), batch.ID, payoutIDs, batch.VendorID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() != int64(len(payoutIDs)) {
+			return ErrConflict
+		}
+
+		return nil
+	})
+}
+
+// ListDueBatches returns the batches whose transfer should be attempted:
+// new ones and failed ones that have been tried fewer than maxAttempts times.
+func (r *PayoutBatchRepository) ListDueBatches(ctx context.Context, maxAttempts int) ([]*models.PayoutBatch, error) {
+	query := database.Qualify(`
+		SELECT id, vendor_id, total_amount, reference, status, attempts, COALESCE(last_error, ''),
+			   created_at, updated_at
+		FROM {shop}.payout_batches
+		WHERE status = 'pending' OR (status = 'failed' AND attempts < $1)
+		ORDER BY created_at
+	`)
+
+	rows, err := r.db.Query(ctx, query, maxAttempts)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	batches, _, err := scanPayoutBatches(rows, false)
+	return batches, err
+}
+
+// MarkPaid marks the batch and every payout in it as paid.
+func (r *PayoutBatchRepository) MarkPaid(ctx context.Context, id uuid.UUID) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, database.Qualify(`
+			UPDATE {shop}.payout_batches
+			SET status = 'paid', attempts = attempts + 1, last_error = NULL
+			WHERE id = $1
+		`), id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, database.Qualify(`
+			UPDATE {shop}.vendor_payouts
+			SET status = 'paid'
+			WHERE batch_id = $1
+		`), id)
+		if err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// MarkFailed records a failed transfer attempt on the batch.
+func (r *PayoutBatchRepository) MarkFailed(ctx context.Context, id uuid.UUID, reason string) error {
+	query := database.Qualify(`
+		UPDATE {shop}.payout_batches
+		SET status = 'failed', attempts = attempts + 1, last_error = $2
+		WHERE id = $1
+	`)
+
+	_, err := r.db.Exec(ctx, query, id, reason)
+	return err
+}
+
+func (r *PayoutBatchRepository) ListByVendor(ctx context.Context, vendorID uuid.UUID, limit, offset int) ([]*models.PayoutBatch, int, error) {
+	query := database.Qualify(`
+		SELECT id, vendor_id, total_amount, reference, status, attempts, COALESCE(last_error, ''),
+			   created_at, updated_at, COUNT(*) OVER()
+		FROM {shop}.payout_batches
+		WHERE vendor_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`)
+
+	rows, err := r.db.Query(ctx, query, vendorID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	return scanPayoutBatches(rows, true)
+}
+
+// ListOpen returns the batches that have not been paid yet, oldest first.
+func (r *PayoutBatchRepository) ListOpen(ctx context.Context, limit, offset int) ([]*models.PayoutBatch, int, error) {
+	query := database.Qualify(`
+		SELECT id, vendor_id, total_amount, reference, status, attempts, COALESCE(last_error, ''),
+			   created_at, updated_at, COUNT(*) OVER()
+		FROM {shop}.payout_batches
+		WHERE status <> 'paid'
+		ORDER BY created_at
+		LIMIT $1 OFFSET $2
+	`)
+
+	rows, err := r.db.Query(ctx, query, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	return scanPayoutBatches(rows, true)
+}
+
+// scanPayoutBatches reads batch rows. When withTotal is set each row carries
+// a trailing COUNT(*) OVER() column.
+func scanPayoutBatches(rows pgx.Rows, withTotal bool) ([]*models.PayoutBatch, int, error) {
+	batches := []*models.PayoutBatch{}
+	total := 0
+	for rows.Next() {
+		var batch models.PayoutBatch
+		dest := []interface{}{
+			&batch.ID,
+			&batch.VendorID,
+			&batch.TotalAmount,
+			&batch.Reference,
+			&batch.Status,
+			&batch.Attempts,
+			&batch.LastError,
+			&batch.CreatedAt,
+			&batch.UpdatedAt,
+		}
+		if withTotal {
+			dest = append(dest, &total)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, err
+		}
+		batches = append(batches, &batch)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return batches, total, nil
+}
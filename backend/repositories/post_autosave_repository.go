@@ -0,0 +1,79 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+type PostAutosaveRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewPostAutosaveRepository(db *pgxpool.Pool) *PostAutosaveRepository {
+	return &PostAutosaveRepository{db: db}
+}
+
+// Upsert stores the autosave, replacing the user's previous one for the post.
+func (r *PostAutosaveRepository) Upsert(ctx context.Context, autosave *models.PostAutosave) error {
+	query := database.Qualify(`
+		INSERT INTO {blog}.post_autosaves (post_id, user_id, title, content)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (post_id, user_id)
+		DO UPDATE SET title = EXCLUDED.title, content = EXCLUDED.content, saved_at = NOW()
+		RETURNING saved_at
+	`)
+
+	return r.db.QueryRow(ctx, query,
+		autosave.PostID,
+		autosave.UserID,
+		autosave.Title,
+		autosave.Content,
+	).Scan(&autosave.SavedAt)
+}
+
+func (r *PostAutosaveRepository) Get(ctx context.Context, postID, userID uuid.UUID) (*models.PostAutosave, error) {
+	query := database.Qualify(`
+		SELECT post_id, user_id, title, content, saved_at
+		FROM {blog}.post_autosaves
+		WHERE post_id = $1 AND user_id = $2
+	`)
+
+	var autosave models.PostAutosave
+	err := r.db.QueryRow(ctx, query, postID, userID).Scan(
+		&autosave.PostID,
+		&autosave.UserID,
+		&autosave.Title,
+		&autosave.Content,
+		&autosave.SavedAt,
+	)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &autosave, nil
+}
+
+func (r *PostAutosaveRepository) Delete(ctx context.Context, postID, userID uuid.UUID) error {
+	_, err := r.db.Exec(ctx, database.Qualify(`DELETE FROM {blog}.post_autosaves WHERE post_id = $1 AND user_id = $2`), postID, userID)
+	return err
+}
+
+// DeleteSavedBefore removes the autosaves last written before cutoff and
+// returns how many there were.
+func (r *PostAutosaveRepository) DeleteSavedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, database.Qualify(`DELETE FROM {blog}.post_autosaves WHERE saved_at < $1`), cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
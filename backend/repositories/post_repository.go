@@ -2,299 +2,619 @@ package repositories
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
 	"github.com/adrianmcmains/integrated-site/models"
 )
 
+// ErrPostNotFound is returned when deleting or restoring a post that does
+// not exist or is not in the state the change expects.
+var ErrPostNotFound = errors.New("post not found")
+
+// postDB is what PostRepository needs of *pgxpool.Pool, so that tests can
+// stand in for the database.
+type postDB interface {
+	dbtx
+	database.TxBeginner
+}
+
 type PostRepository struct {
-	db *pgxpool.Pool
+	db        postDB
+	tracker   *database.TransactionTracker
+	redirects *RedirectRepository
 }
 
-func NewPostRepository(db *pgxpool.Pool) *PostRepository {
-	return &PostRepository{db: db}
+func NewPostRepository(db *pgxpool.Pool, tracker *database.TransactionTracker, redirects *RedirectRepository) *PostRepository {
+	return &PostRepository{db: db, tracker: tracker, redirects: redirects}
 }
 
-func (r *PostRepository) Create(ctx context.Context, post *models.Post) error {
-	tx, err := r.db.Begin(ctx)
-	if err != nil {
-		return err
+// postAuthorJoins joins a post's author and the author's user. It expects
+// the posts table aliased as p.
+const postAuthorJoins = `LEFT JOIN {blog}.authors a ON p.author_id = a.id
+		LEFT JOIN {auth}.users u ON a.user_id = u.id`
+
+// postAuthorColumns selects the author and user joined by postAuthorJoins,
+// to be scanned into a postAuthorRow.
+const postAuthorColumns = `a.id, a.user_id, COALESCE(a.bio, ''), a.created_at, a.updated_at,
+			   u.id, u.email, u.full_name, u.role, COALESCE(u.avatar_url, ''), u.created_at, u.updated_at`
+
+// postRelationColumns aggregates a post's categories and tags as JSON
+// arrays, to be scanned into a postRelationsRow. It expects the posts table
+// aliased as p.
+const postRelationColumns = `COALESCE((
+				   SELECT json_agg(json_build_object(
+					   'id', c.id, 'name', c.name, 'slug', c.slug, 'description', COALESCE(c.description, ''),
+					   'parent_id', c.parent_id, 'created_at', c.created_at, 'updated_at', c.updated_at
+				   ) ORDER BY c.name)
+				   FROM {blog}.post_categories pc
+				   JOIN {blog}.categories c ON c.id = pc.category_id
+				   WHERE pc.post_id = p.id
+			   ), '[]'),
+			   COALESCE((
+				   SELECT json_agg(json_build_object(
+					   'id', t.id, 'name', t.name, 'slug', t.slug,
+					   'created_at', t.created_at, 'updated_at', t.updated_at
+				   ) ORDER BY t.name)
+				   FROM {blog}.post_tags pt
+				   JOIN {blog}.tags t ON t.id = pt.tag_id
+				   WHERE pt.post_id = p.id
+			   ), '[]')`
+
+// postAuthorRow receives postAuthorColumns. The columns are all NULL for a
+// post without an author row.
+type postAuthorRow struct {
+	authorID, authorUserID           *uuid.UUID
+	bio                              string
+	authorCreatedAt, authorUpdatedAt *time.Time
+	userID                           *uuid.UUID
+	email, fullName, role            *string
+	avatarURL                        string
+	userCreatedAt, userUpdatedAt     *time.Time
+}
+
+func (a *postAuthorRow) dest() []interface{} {
+	return []interface{}{
+		&a.authorID, &a.authorUserID, &a.bio, &a.authorCreatedAt, &a.authorUpdatedAt,
+		&a.userID, &a.email, &a.fullName, &a.role, &a.avatarURL, &a.userCreatedAt, &a.userUpdatedAt,
 	}
-	defer tx.Rollback(ctx)
-
-	// Insert post
-	query := `
-		INSERT INTO blog.posts (title, slug, content, excerpt, featured_image, author_id, status, published_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
-		RETURNING id, created_at, updated_at
-	`
-
-	err = tx.QueryRow(ctx, query,
-		post.Title,
-		post.Slug,
-		post.Content,
-		post.Excerpt,
-		post.FeaturedImage,
-		post.AuthorID,
-		post.Status,
-		post.PublishedAt,
-	).Scan(&post.ID, &post.CreatedAt, &post.UpdatedAt)
-	if err != nil {
+}
+
+// attachTo sets the post's author, leaving it nil when there is none.
+func (a *postAuthorRow) attachTo(post *models.Post) {
+	if a.authorID == nil {
+		return
+	}
+
+	author := &models.Author{
+		ID:        *a.authorID,
+		Bio:       a.bio,
+		CreatedAt: derefTime(a.authorCreatedAt),
+		UpdatedAt: derefTime(a.authorUpdatedAt),
+	}
+	if a.authorUserID != nil {
+		author.UserID = *a.authorUserID
+	}
+	if a.userID != nil {
+		author.User = &models.User{
+			ID:        *a.userID,
+			Email:     *a.email,
+			FullName:  *a.fullName,
+			Role:      *a.role,
+			AvatarURL: a.avatarURL,
+			CreatedAt: derefTime(a.userCreatedAt),
+			UpdatedAt: derefTime(a.userUpdatedAt),
+		}
+	}
+	post.Author = author
+}
+
+// postRelationsRow receives postRelationColumns.
+type postRelationsRow struct {
+	categories, tags []byte
+}
+
+func (r *postRelationsRow) dest() []interface{} {
+	return []interface{}{&r.categories, &r.tags}
+}
+
+func (r *postRelationsRow) attachTo(post *models.Post) error {
+	if err := json.Unmarshal(r.categories, &post.Categories); err != nil {
 		return err
 	}
+	return json.Unmarshal(r.tags, &post.Tags)
+}
 
-	// Insert categories
-	if len(post.Categories) > 0 {
-		for _, category := range post.Categories {
-			_, err = tx.Exec(ctx, `
-				INSERT INTO blog.post_categories (post_id, category_id)
-				VALUES ($1, $2)
-			`, post.ID, category.ID)
-			if err != nil {
-				return err
+func (r *PostRepository) Create(ctx context.Context, post *models.Post) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		// Insert post
+		query := database.Qualify(`
+			INSERT INTO {blog}.posts (title, slug, content, excerpt, featured_image, author_id, status, published_at, scheduled_at, cloned_from)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING id, version, created_at, updated_at
+		`)
+
+		err := tx.QueryRow(ctx, query,
+			post.Title,
+			post.Slug,
+			post.Content,
+			post.Excerpt,
+			post.FeaturedImage,
+			post.AuthorID,
+			post.Status,
+			post.PublishedAt,
+			post.ScheduledAt,
+			post.ClonedFrom,
+		).Scan(&post.ID, &post.Version, &post.CreatedAt, &post.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		// Insert categories
+		if len(post.Categories) > 0 {
+			for _, category := range post.Categories {
+				_, err = tx.Exec(ctx, database.Qualify(`
+					INSERT INTO {blog}.post_categories (post_id, category_id)
+					VALUES ($1, $2)
+				`), post.ID, category.ID)
+				if err != nil {
+					return err
+				}
 			}
 		}
-	}
 
-	// Insert tags
-	if len(post.Tags) > 0 {
-		for _, tag := range post.Tags {
-			_, err = tx.Exec(ctx, `
-				INSERT INTO blog.post_tags (post_id, tag_id)
-				VALUES ($1, $2)
-			`, post.ID, tag.ID)
-			if err != nil {
-				return err
+		// Insert tags
+		if len(post.Tags) > 0 {
+			for _, tag := range post.Tags {
+				_, err = tx.Exec(ctx, database.Qualify(`
+					INSERT INTO {blog}.post_tags (post_id, tag_id)
+					VALUES ($1, $2)
+				`), post.ID, tag.ID)
+				if err != nil {
+					return err
+				}
 			}
 		}
-	}
 
-	return tx.Commit(ctx)
+		return nil
+	})
+}
+
+// AuthorIDForUser returns the ID of the user's author profile, creating an
+// empty one on the user's first post.
+func (r *PostRepository) AuthorIDForUser(ctx context.Context, userID uuid.UUID) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		WITH existing AS (
+			SELECT id FROM {blog}.authors WHERE user_id = $1 ORDER BY created_at LIMIT 1
+		), created AS (
+			INSERT INTO {blog}.authors (user_id)
+			SELECT $1 WHERE NOT EXISTS (SELECT 1 FROM existing)
+			RETURNING id
+		)
+		SELECT id FROM existing
+		UNION ALL
+		SELECT id FROM created
+	`), userID).Scan(&id)
+	return id, err
 }
 
+// GetByID returns the post with its author, categories and tags, or nil.
+// Deleted posts are not returned, here or by any other lookup or list but
+// ListDeleted.
 func (r *PostRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Post, error) {
-	query := `
-		SELECT p.id, p.title, p.slug, p.content, p.excerpt, p.featured_image, 
-			   p.author_id, p.status, p.published_at, p.created_at, p.updated_at,
-			   a.id, a.user_id, a.bio, a.social_media, a.created_at, a.updated_at,
-			   u.id, u.email, u.full_name, u.role, u.avatar_url, u.created_at, u.updated_at
-		FROM blog.posts p
-		LEFT JOIN blog.authors a ON p.author_id = a.id
-		LEFT JOIN auth.users u ON a.user_id = u.id
-		WHERE p.id = $1
-	`
+	return r.getPost(ctx, "p.id = $1", id)
+}
 
-	var post models.Post
-	var author models.Author
-	var user models.User
-	var socialMediaJSON []byte
-	var publishedAt *time.Time
+// List returns a page of the posts matching the filter, newest first, with
+// their author, categories and tags. Posts are ordered by publication date,
+// or creation date for unpublished ones, then by ID, and the page starts
+// after the post with ID after, so pages stay stable while posts are
+// added. It takes a single query: the author is joined and the categories
+// and tags are aggregated as JSON.
+func (r *PostRepository) List(ctx context.Context, filter models.PostFilter, after *uuid.UUID, limit int) (*models.PaginatedResult[*models.Post], error) {
+	whereClause, args := postListWhere(filter)
+
+	if after != nil {
+		var sortedAt time.Time
+		err := r.db.QueryRow(ctx, database.Qualify(`
+			SELECT COALESCE(published_at, created_at) FROM {blog}.posts WHERE id = $1
+		`), *after).Scan(&sortedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, ErrInvalidCursor
+			}
+			return nil, err
+		}
 
-	err := r.db.QueryRow(ctx, query, id).Scan(
-		&post.ID, &post.Title, &post.Slug, &post.Content, &post.Excerpt, &post.FeaturedImage,
-		&post.AuthorID, &post.Status, &publishedAt, &post.CreatedAt, &post.UpdatedAt,
-		&author.ID, &author.UserID, &author.Bio, &socialMediaJSON, &author.CreatedAt, &author.UpdatedAt,
-		&user.ID, &user.Email, &user.FullName, &user.Role, &user.AvatarURL, &user.CreatedAt, &user.UpdatedAt,
-	)
+		args = append(args, sortedAt, *after)
+		whereClause += fmt.Sprintf(" AND (COALESCE(p.published_at, p.created_at), p.id) < ($%d, $%d)", len(args)-1, len(args))
+	}
+
+	query := fmt.Sprintf(database.Qualify(`
+		SELECT p.id, p.title, p.slug, COALESCE(p.excerpt, ''), COALESCE(p.featured_image, ''),
+			   p.author_id, p.status, p.published_at, p.version, p.cloned_from, p.created_at, p.updated_at,
+			   `+postAuthorColumns+`,
+			   `+postRelationColumns+`
+		FROM {blog}.posts p
+		`+postAuthorJoins+`
+		%s
+		ORDER BY COALESCE(p.published_at, p.created_at) DESC, p.id DESC
+		LIMIT $%d
+	`), whereClause, len(args)+1)
+
+	// One row more than the page tells whether there is a next page.
+	args = append(args, limit+1)
 
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return nil, nil
-		}
 		return nil, err
 	}
+	defer rows.Close()
+
+	posts := []*models.Post{}
+	for rows.Next() {
+		var post models.Post
+		var author postAuthorRow
+		var relations postRelationsRow
+		dest := []interface{}{
+			&post.ID, &post.Title, &post.Slug, &post.Excerpt, &post.FeaturedImage,
+			&post.AuthorID, &post.Status, &post.PublishedAt, &post.Version, &post.ClonedFrom, &post.CreatedAt, &post.UpdatedAt,
+		}
+		dest = append(dest, author.dest()...)
+		dest = append(dest, relations.dest()...)
 
-	post.PublishedAt = publishedAt
-	author.User = &user
-	post.Author = &author
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
 
-	// Get categories
-	categoriesQuery := `
-		SELECT c.id, c.name, c.slug, c.description, c.created_at, c.updated_at
-		FROM blog.categories c
-		JOIN blog.post_categories pc ON c.id = pc.category_id
-		WHERE pc.post_id = $1
-	`
+		author.attachTo(&post)
+		if err := relations.attachTo(&post); err != nil {
+			return nil, err
+		}
 
-	categoryRows, err := r.db.Query(ctx, categoriesQuery, post.ID)
-	if err != nil {
+		posts = append(posts, &post)
+	}
+
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-	defer categoryRows.Close()
 
-	post.Categories = []*models.Category{}
-	for categoryRows.Next() {
-		var category models.Category
-		if err := categoryRows.Scan(
-			&category.ID, &category.Name, &category.Slug, &category.Description,
-			&category.CreatedAt, &category.UpdatedAt,
-		); err != nil {
-			return nil, err
-		}
-		post.Categories = append(post.Categories, &category)
+	return paginate(posts, limit, func(post *models.Post) uuid.UUID { return post.ID }), nil
+}
+
+// postListWhere builds the WHERE clause and its arguments for the post list
+// filter. The clause expects the posts table aliased as p and leaves out
+// deleted posts.
+func postListWhere(filter models.PostFilter) (string, []interface{}) {
+	args := []interface{}{}
+	where := []string{"p.deleted_at IS NULL"}
+
+	if filter.Status != "" {
+		args = append(args, filter.Status)
+		where = append(where, fmt.Sprintf("p.status = $%d", len(args)))
+	}
+	if filter.CategorySlug != "" {
+		args = append(args, filter.CategorySlug)
+		where = append(where, fmt.Sprintf(database.Qualify(`EXISTS (
+			SELECT 1
+			FROM {blog}.post_categories fpc
+			JOIN {blog}.categories fc ON fc.id = fpc.category_id
+			WHERE fpc.post_id = p.id AND fc.slug = $%d
+		)`), len(args)))
+	}
+	if filter.TagSlug != "" {
+		args = append(args, filter.TagSlug)
+		where = append(where, fmt.Sprintf(database.Qualify(`EXISTS (
+			SELECT 1
+			FROM {blog}.post_tags fpt
+			JOIN {blog}.tags ft ON ft.id = fpt.tag_id
+			WHERE fpt.post_id = p.id AND ft.slug = $%d
+		)`), len(args)))
+	}
+	if filter.AuthorID != nil {
+		args = append(args, *filter.AuthorID)
+		where = append(where, fmt.Sprintf("p.author_id = $%d", len(args)))
+	}
+	if filter.PublishedFrom != nil {
+		args = append(args, *filter.PublishedFrom)
+		where = append(where, fmt.Sprintf("p.published_at >= $%d", len(args)))
+	}
+	if filter.PublishedTo != nil {
+		args = append(args, *filter.PublishedTo)
+		where = append(where, fmt.Sprintf("p.published_at < $%d", len(args)))
+	}
+
+	return "WHERE " + strings.Join(where, " AND "), args
+}
+
+// ListByCategoryIDs returns posts assigned to any of the given categories,
+// with their categories and tags, together with the total number of
+// matching posts.
+func (r *PostRepository) ListByCategoryIDs(ctx context.Context, categoryIDs []uuid.UUID, limit, offset int, status string) ([]*models.Post, int, error) {
+	query := database.Qualify(`
+		SELECT p.id, p.title, p.slug, COALESCE(p.excerpt, ''), COALESCE(p.featured_image, ''),
+			   p.author_id, p.status, p.published_at, p.version, p.created_at, p.updated_at,
+			   COUNT(*) OVER()
+		FROM {blog}.posts p
+		WHERE p.deleted_at IS NULL AND EXISTS (
+			SELECT 1
+			FROM {blog}.post_categories pc
+			WHERE pc.post_id = p.id AND pc.category_id = ANY($1)
+		)
+	`)
+
+	args := []interface{}{categoryIDs}
+	if status != "" {
+		args = append(args, status)
+		query += fmt.Sprintf(" AND p.status = $%d", len(args))
 	}
 
-	// Get tags
-	tagsQuery := `
-		SELECT t.id, t.name, t.slug, t.created_at, t.updated_at
-		FROM blog.tags t
-		JOIN blog.post_tags pt ON t.id = pt.tag_id
-		WHERE pt.post_id = $1
-	`
+	query += fmt.Sprintf(" ORDER BY p.published_at DESC, p.created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
 
-	tagRows, err := r.db.Query(ctx, tagsQuery, post.ID)
+	rows, err := r.db.Query(ctx, query, args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
-	defer tagRows.Close()
+	defer rows.Close()
 
-	post.Tags = []*models.Tag{}
-	for tagRows.Next() {
-		var tag models.Tag
-		if err := tagRows.Scan(
-			&tag.ID, &tag.Name, &tag.Slug, &tag.CreatedAt, &tag.UpdatedAt,
+	posts := []*models.Post{}
+	total := 0
+	for rows.Next() {
+		var post models.Post
+		if err := rows.Scan(
+			&post.ID, &post.Title, &post.Slug, &post.Excerpt, &post.FeaturedImage,
+			&post.AuthorID, &post.Status, &post.PublishedAt, &post.Version, &post.CreatedAt, &post.UpdatedAt,
+			&total,
 		); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
-		post.Tags = append(post.Tags, &tag)
+		posts = append(posts, &post)
 	}
 
-	return &post, nil
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	if err := r.loadRelations(ctx, posts); err != nil {
+		return nil, 0, err
+	}
+
+	return posts, total, nil
 }
 
-func (r *PostRepository) List(ctx context.Context, limit, offset int, status string) ([]*models.Post, error) {
-	query := `
-		SELECT p.id, p.title, p.slug, p.excerpt, p.featured_image, 
-			   p.author_id, p.status, p.published_at, p.created_at, p.updated_at
-		FROM blog.posts p
-	`
+// ListByCategory returns posts assigned directly to the category.
+func (r *PostRepository) ListByCategory(ctx context.Context, categoryID uuid.UUID, limit, offset int, status string) ([]*models.Post, error) {
+	posts, _, err := r.ListByCategoryIDs(ctx, []uuid.UUID{categoryID}, limit, offset, status)
+	return posts, err
+}
 
-	args := []interface{}{}
+// Search returns posts whose title, excerpt or content contain the query,
+// with their categories and tags, together with the total number of
+// matches.
+func (r *PostRepository) Search(ctx context.Context, query string, limit, offset int, status string) ([]*models.Post, int, error) {
+	sqlQuery := database.Qualify(`
+		SELECT p.id, p.title, p.slug, COALESCE(p.excerpt, ''), COALESCE(p.featured_image, ''),
+			   p.author_id, p.status, p.published_at, p.version, p.created_at, p.updated_at,
+			   COUNT(*) OVER()
+		FROM {blog}.posts p
+		WHERE p.deleted_at IS NULL AND (p.title ILIKE $1 OR p.excerpt ILIKE $1 OR p.content ILIKE $1)
+	`)
+
+	args := []interface{}{"%" + escapeLike(query) + "%"}
 	if status != "" {
-		query += " WHERE p.status = $1"
 		args = append(args, status)
+		sqlQuery += fmt.Sprintf(" AND p.status = $%d", len(args))
 	}
 
-	query += " ORDER BY p.published_at DESC, p.created_at DESC LIMIT $" + 
-		 		string(len(args) + 1) + " OFFSET $" + string(len(args) + 2)
-	
+	sqlQuery += fmt.Sprintf(" ORDER BY p.published_at DESC, p.created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
 	args = append(args, limit, offset)
 
-	rows, err := r.db.Query(ctx, query, args...)
+	rows, err := r.db.Query(ctx, sqlQuery, args...)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
-	var posts []*models.Post
+	posts := []*models.Post{}
+	total := 0
 	for rows.Next() {
 		var post models.Post
-		var publishedAt *time.Time
-
 		if err := rows.Scan(
 			&post.ID, &post.Title, &post.Slug, &post.Excerpt, &post.FeaturedImage,
-			&post.AuthorID, &post.Status, &publishedAt, &post.CreatedAt, &post.UpdatedAt,
+			&post.AuthorID, &post.Status, &post.PublishedAt, &post.Version, &post.CreatedAt, &post.UpdatedAt,
+			&total,
 		); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
-
-		post.PublishedAt = publishedAt
 		posts = append(posts, &post)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return posts, nil
+	if err := r.loadRelations(ctx, posts); err != nil {
+		return nil, 0, err
+	}
+
+	return posts, total, nil
 }
 
+// Update saves the post if post.Version still matches the stored version and
+// bumps post.Version. A stale version yields ErrConflict.
 func (r *PostRepository) Update(ctx context.Context, post *models.Post) error {
-	tx, err := r.db.Begin(ctx)
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		// Lock the row and note its current slug so a rename leaves a redirect
+		var oldSlug string
+		err := tx.QueryRow(ctx, database.Qualify("SELECT slug FROM {blog}.posts WHERE id = $1 FOR UPDATE"), post.ID).Scan(&oldSlug)
+		if err != nil {
+			return err
+		}
+
+		// Update post
+		query := database.Qualify(`
+			UPDATE {blog}.posts
+			SET title = $1, slug = $2, content = $3, excerpt = $4, 
+				featured_image = $5, status = $6, published_at = $7, scheduled_at = $8, version = version + 1
+			WHERE id = $9 AND version = $10
+			RETURNING version, updated_at
+		`)
+
+		err = tx.QueryRow(ctx, query,
+			post.Title,
+			post.Slug,
+			post.Content,
+			post.Excerpt,
+			post.FeaturedImage,
+			post.Status,
+			post.PublishedAt,
+			post.ScheduledAt,
+			post.ID,
+			post.Version,
+		).Scan(&post.Version, &post.UpdatedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrConflict
+			}
+			return err
+		}
+
+		if err := recordSlugChange(ctx, r.redirects.WithTx(tx), "/blog/", oldSlug, post.Slug); err != nil {
+			return err
+		}
+
+		// Delete old categories
+		_, err = tx.Exec(ctx, database.Qualify("DELETE FROM {blog}.post_categories WHERE post_id = $1"), post.ID)
+		if err != nil {
+			return err
+		}
+
+		// Insert new categories
+		if len(post.Categories) > 0 {
+			for _, category := range post.Categories {
+				_, err = tx.Exec(ctx, database.Qualify(`
+					INSERT INTO {blog}.post_categories (post_id, category_id)
+					VALUES ($1, $2)
+				`), post.ID, category.ID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		// Delete old tags
+		_, err = tx.Exec(ctx, database.Qualify("DELETE FROM {blog}.post_tags WHERE post_id = $1"), post.ID)
+		if err != nil {
+			return err
+		}
+
+		// Insert new tags
+		if len(post.Tags) > 0 {
+			for _, tag := range post.Tags {
+				_, err = tx.Exec(ctx, database.Qualify(`
+					INSERT INTO {blog}.post_tags (post_id, tag_id)
+					VALUES ($1, $2)
+				`), post.ID, tag.ID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+// Delete marks the post deleted, hiding it from every lookup and list but
+// ListDeleted. It keeps its slug, categories and tags, so Restore brings it
+// back as it was. A post that does not exist or is already deleted yields
+// ErrPostNotFound.
+func (r *PostRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`
+		UPDATE {blog}.posts SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL
+	`), id)
 	if err != nil {
 		return err
 	}
-	defer tx.Rollback(ctx)
-
-	// Update post
-	query := `
-		UPDATE blog.posts
-		SET title = $1, slug = $2, content = $3, excerpt = $4, 
-			featured_image = $5, status = $6, published_at = $7
-		WHERE id = $8
-		RETURNING updated_at
-	`
-
-	err = tx.QueryRow(ctx, query,
-		post.Title,
-		post.Slug,
-		post.Content,
-		post.Excerpt,
-		post.FeaturedImage,
-		post.Status,
-		post.PublishedAt,
-		post.ID,
-	).Scan(&post.UpdatedAt)
-	if err != nil {
-		return err
+	if tag.RowsAffected() == 0 {
+		return ErrPostNotFound
 	}
+	return nil
+}
 
-	// Delete old categories
-	_, err = tx.Exec(ctx, "DELETE FROM blog.post_categories WHERE post_id = $1", post.ID)
+// Restore undoes Delete. A post that does not exist or is not deleted
+// yields ErrPostNotFound.
+func (r *PostRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`
+		UPDATE {blog}.posts SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL
+	`), id)
 	if err != nil {
 		return err
 	}
-
-	// Insert new categories
-	if len(post.Categories) > 0 {
-		for _, category := range post.Categories {
-			_, err = tx.Exec(ctx, `
-				INSERT INTO blog.post_categories (post_id, category_id)
-				VALUES ($1, $2)
-			`, post.ID, category.ID)
-			if err != nil {
-				return err
-			}
-		}
+	if tag.RowsAffected() == 0 {
+		return ErrPostNotFound
 	}
+	return nil
+}
 
-	// Delete old tags
-	_, err = tx.Exec(ctx, "DELETE FROM blog.post_tags WHERE post_id = $1", post.ID)
+// ListDeleted returns a page of the deleted posts, most recently deleted
+// first, with their categories and tags, together with the total number of
+// deleted posts.
+func (r *PostRepository) ListDeleted(ctx context.Context, limit, offset int) ([]*models.Post, int, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT p.id, p.title, p.slug, COALESCE(p.excerpt, ''), COALESCE(p.featured_image, ''),
+			   p.author_id, p.status, p.published_at, p.version, p.deleted_at, p.created_at, p.updated_at,
+			   COUNT(*) OVER()
+		FROM {blog}.posts p
+		WHERE p.deleted_at IS NOT NULL
+		ORDER BY p.deleted_at DESC, p.id
+		LIMIT $1 OFFSET $2
+	`), limit, offset)
 	if err != nil {
-		return err
+		return nil, 0, err
 	}
+	defer rows.Close()
 
-	// Insert new tags
-	if len(post.Tags) > 0 {
-		for _, tag := range post.Tags {
-			_, err = tx.Exec(ctx, `
-				INSERT INTO blog.post_tags (post_id, tag_id)
-				VALUES ($1, $2)
-			`, post.ID, tag.ID)
-			if err != nil {
-				return err
-			}
+	posts := []*models.Post{}
+	total := 0
+	for rows.Next() {
+		var post models.Post
+		if err := rows.Scan(
+			&post.ID, &post.Title, &post.Slug, &post.Excerpt, &post.FeaturedImage,
+			&post.AuthorID, &post.Status, &post.PublishedAt, &post.Version, &post.DeletedAt, &post.CreatedAt, &post.UpdatedAt,
+			&total,
+		); err != nil {
+			return nil, 0, err
 		}
+		posts = append(posts, &post)
 	}
 
-	return tx.Commit(ctx)
-}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
 
-func (r *PostRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	_, err := r.db.Exec(ctx, "DELETE FROM blog.posts WHERE id = $1", id)
-	return err
+	if err := r.loadRelations(ctx, posts); err != nil {
+		return nil, 0, err
+	}
+
+	return posts, total, nil
 }
 
 func (r *PostRepository) Count(ctx context.Context, status string) (int, error) {
-	query := `SELECT COUNT(*) FROM blog.posts`
+	query := database.Qualify(`SELECT COUNT(*) FROM {blog}.posts WHERE deleted_at IS NULL`)
 	args := []interface{}{}
 
 	if status != "" {
-		query += " WHERE status = $1"
+		query += " AND status = $1"
 		args = append(args, status)
 	}
 
@@ -302,55 +622,220 @@ func (r *PostRepository) Count(ctx context.Context, status string) (int, error)
 	err := r.db.QueryRow(ctx, query, args...).Scan(&count)
 	return count, err
 }
-SELECT t.id, t.name, t.slug, t.created_at, t.updated_at
-		FROM blog.tags t
-		JOIN blog.post_tags pt ON t.id = pt.tag_id
-		WHERE pt.post_id = $1
-	`
 
-	tagRows, err := r.db.Query(ctx, tagsQuery, post.ID)
+// GetBySlug returns the post with its author, categories and tags, or nil.
+func (r *PostRepository) GetBySlug(ctx context.Context, slug string) (*models.Post, error) {
+	return r.getPost(ctx, "p.slug = $1", slug)
+}
+
+// getPost returns the post matching the condition on p, with its author,
+// categories and tags, or nil. It takes a single query.
+func (r *PostRepository) getPost(ctx context.Context, condition string, arg interface{}) (*models.Post, error) {
+	query := database.Qualify(`
+		SELECT p.id, p.title, p.slug, p.content, COALESCE(p.excerpt, ''), COALESCE(p.featured_image, ''),
+			   p.author_id, p.status, p.published_at, p.scheduled_at, p.version, p.cloned_from, p.created_at, p.updated_at,
+			   ` + postAuthorColumns + `,
+			   ` + postRelationColumns + `
+		FROM {blog}.posts p
+		` + postAuthorJoins + `
+		WHERE p.deleted_at IS NULL AND ` + condition)
+
+	var post models.Post
+	var author postAuthorRow
+	var relations postRelationsRow
+	dest := []interface{}{
+		&post.ID, &post.Title, &post.Slug, &post.Content, &post.Excerpt, &post.FeaturedImage,
+		&post.AuthorID, &post.Status, &post.PublishedAt, &post.ScheduledAt, &post.Version, &post.ClonedFrom, &post.CreatedAt, &post.UpdatedAt,
+	}
+	dest = append(dest, author.dest()...)
+	dest = append(dest, relations.dest()...)
+
+	if err := r.db.QueryRow(ctx, query, arg).Scan(dest...); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	author.attachTo(&post)
+	if err := relations.attachTo(&post); err != nil {
+		return nil, err
+	}
+
+	return &post, nil
+}
+
+// ListFeed returns the latest published posts with their content and
+// author, newest first.
+func (r *PostRepository) ListFeed(ctx context.Context, limit int) ([]*models.Post, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT p.id, p.title, p.slug, p.content, COALESCE(p.excerpt, ''), COALESCE(p.featured_image, ''),
+			   p.author_id, p.status, p.published_at, p.version, p.created_at, p.updated_at,
+			   `+postAuthorColumns+`
+		FROM {blog}.posts p
+		`+postAuthorJoins+`
+		WHERE p.status = 'published' AND p.deleted_at IS NULL
+		ORDER BY p.published_at DESC, p.id DESC
+		LIMIT $1
+	`), limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	posts := []*models.Post{}
+	for rows.Next() {
+		var post models.Post
+		var author postAuthorRow
+		dest := []interface{}{
+			&post.ID, &post.Title, &post.Slug, &post.Content, &post.Excerpt, &post.FeaturedImage,
+			&post.AuthorID, &post.Status, &post.PublishedAt, &post.Version, &post.CreatedAt, &post.UpdatedAt,
+		}
+		if err := rows.Scan(append(dest, author.dest()...)...); err != nil {
+			return nil, err
+		}
+		author.attachTo(&post)
+		posts = append(posts, &post)
+	}
+
+	return posts, rows.Err()
+}
+
+// ListWithRelations returns the posts with the given IDs, in that order,
+// with their author, categories and tags. The categories and tags of the
+// whole batch are loaded in one query each. Unknown and deleted IDs are
+// skipped.
+func (r *PostRepository) ListWithRelations(ctx context.Context, ids []uuid.UUID) ([]*models.Post, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT p.id, p.title, p.slug, COALESCE(p.excerpt, ''), COALESCE(p.featured_image, ''),
+			   p.author_id, p.status, p.published_at, p.version, p.cloned_from, p.created_at, p.updated_at,
+			   `+postAuthorColumns+`
+		FROM {blog}.posts p
+		`+postAuthorJoins+`
+		WHERE p.id = ANY($1) AND p.deleted_at IS NULL
+	`), ids)
 	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
+
+	byID := make(map[uuid.UUID]*models.Post, len(ids))
+	for rows.Next() {
+		var post models.Post
+		var author postAuthorRow
+		dest := []interface{}{
+			&post.ID, &post.Title, &post.Slug, &post.Excerpt, &post.FeaturedImage,
+			&post.AuthorID, &post.Status, &post.PublishedAt, &post.Version, &post.ClonedFrom, &post.CreatedAt, &post.UpdatedAt,
+		}
+		if err := rows.Scan(append(dest, author.dest()...)...); err != nil {
+			return nil, err
+		}
+		author.attachTo(&post)
+		byID[post.ID] = &post
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	posts := make([]*models.Post, 0, len(byID))
+	for _, id := range ids {
+		if post, ok := byID[id]; ok {
+			posts = append(posts, post)
+		}
+	}
+
+	if err := r.loadRelations(ctx, posts); err != nil {
+		return nil, err
+	}
+	return posts, nil
+}
+
+// loadRelations sets the categories and tags of a batch of posts with one
+// query for each.
+func (r *PostRepository) loadRelations(ctx context.Context, posts []*models.Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	byID := make(map[uuid.UUID]*models.Post, len(posts))
+	ids := make([]uuid.UUID, 0, len(posts))
+	for _, post := range posts {
+		post.Categories = []*models.Category{}
+		post.Tags = []*models.Tag{}
+		byID[post.ID] = post
+		ids = append(ids, post.ID)
+	}
+
+	categoryRows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT pc.post_id, c.id, c.name, c.slug, COALESCE(c.description, ''), c.parent_id, c.created_at, c.updated_at
+		FROM {blog}.post_categories pc
+		JOIN {blog}.categories c ON c.id = pc.category_id
+		WHERE pc.post_id = ANY($1)
+		ORDER BY c.name
+	`), ids)
+	if err != nil {
+		return err
+	}
+	defer categoryRows.Close()
+
+	for categoryRows.Next() {
+		var postID uuid.UUID
+		var category models.Category
+		if err := categoryRows.Scan(
+			&postID, &category.ID, &category.Name, &category.Slug, &category.Description,
+			&category.ParentID, &category.CreatedAt, &category.UpdatedAt,
+		); err != nil {
+			return err
+		}
+		byID[postID].Categories = append(byID[postID].Categories, &category)
+	}
+	if err := categoryRows.Err(); err != nil {
+		return err
+	}
+
+	tagRows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT pt.post_id, t.id, t.name, t.slug, t.created_at, t.updated_at
+		FROM {blog}.post_tags pt
+		JOIN {blog}.tags t ON t.id = pt.tag_id
+		WHERE pt.post_id = ANY($1)
+		ORDER BY t.name
+	`), ids)
+	if err != nil {
+		return err
+	}
 	defer tagRows.Close()
 
-	post.Tags = []*models.Tag{}
 	for tagRows.Next() {
+		var postID uuid.UUID
 		var tag models.Tag
-		if err := tagRows.Scan(
-			&tag.ID, &tag.Name, &tag.Slug, &tag.CreatedAt, &tag.UpdatedAt,
-		); err != nil {
-			return nil, err
+		if err := tagRows.Scan(&postID, &tag.ID, &tag.Name, &tag.Slug, &tag.CreatedAt, &tag.UpdatedAt); err != nil {
+			return err
 		}
-		post.Tags = append(post.Tags, &tag)
+		byID[postID].Tags = append(byID[postID].Tags, &tag)
 	}
 
-	return &post, nil
+	return tagRows.Err()
 }
 
-func (r *PostRepository) GetBySlug(ctx context.Context, slug string) (*models.Post, error) {
-	query := `
-		SELECT p.id, p.title, p.slug, p.content, p.excerpt, p.featured_image, 
-			   p.author_id, p.status, p.published_at, p.created_at, p.updated_at,
-			   a.id, a.user_id, a.bio, a.social_media, a.created_at, a.updated_at,
-			   u.id, u.email, u.full_name, u.role, u.avatar_url, u.created_at, u.updated_at
-		FROM blog.posts p
-		LEFT JOIN blog.authors a ON p.author_id = a.id
-		LEFT JOIN auth.users u ON a.user_id = u.id
-		WHERE p.slug = $1
-	`
+// FindSimilarSlug returns the published post whose slug is closest to slug
+// and at most MaxSlugDistance edits away, or nil. An exact match is not
+// considered similar.
+func (r *PostRepository) FindSimilarSlug(ctx context.Context, slug string) (*models.Post, error) {
+	query := database.Qualify(`
+		SELECT id, title, slug, status, published_at
+		FROM {blog}.posts
+		WHERE status = 'published' AND deleted_at IS NULL AND slug <> $1 AND levenshtein(slug, $1) <= $2
+		ORDER BY levenshtein(slug, $1), published_at DESC
+		LIMIT 1
+	`)
 
 	var post models.Post
-	var author models.Author
-	var user models.User
-	var socialMediaJSON []byte
-	var publishedAt *time.Time
-
-	err := r.db.QueryRow(ctx, query, slug).Scan(
-		&post.ID, &post.Title, &post.Slug, &post.Content, &post.Excerpt, &post.FeaturedImage,
-		&post.AuthorID, &post.Status, &publishedAt, &post.CreatedAt, &post.UpdatedAt,
-		&author.ID, &author.UserID, &author.Bio, &socialMediaJSON, &author.CreatedAt, &author.UpdatedAt,
-		&user.ID, &user.Email, &user.FullName, &user.Role, &user.AvatarURL, &user.CreatedAt, &user.UpdatedAt,
+	err := r.db.QueryRow(ctx, query, slug, MaxSlugDistance).Scan(
+		&post.ID,
+		&post.Title,
+		&post.Slug,
+		&post.Status,
+		&post.PublishedAt,
 	)
 
 	if err != nil {
@@ -360,35 +845,59 @@ func (r *PostRepository) GetBySlug(ctx context.Context, slug string) (*models.Po
 		return nil, err
 	}
 
-	post.PublishedAt = publishedAt
-	author.User = &user
-	post.Author = &author
-
-	// Get categories
-	categoriesQuery := `
-		SELECT c.id, c.name, c.slug, c.description, c.created_at, c.updated_at
-		FROM blog.categories c
-		JOIN blog.post_categories pc ON c.id = pc.category_id
-		WHERE pc.post_id = $1
-	`
+	return &post, nil
+}
 
-	categoryRows, err := r.db.Query(ctx, categoriesQuery, post.ID)
+// ListDueForPublish returns the scheduled posts whose time has come, with
+// their author, categories and tags, earliest first.
+func (r *PostRepository) ListDueForPublish(ctx context.Context) ([]*models.Post, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT id
+		FROM {blog}.posts
+		WHERE status = 'scheduled' AND scheduled_at <= NOW() AND deleted_at IS NULL
+		ORDER BY scheduled_at
+	`))
 	if err != nil {
 		return nil, err
 	}
-	defer categoryRows.Close()
+	defer rows.Close()
 
-	post.Categories = []*models.Category{}
-	for categoryRows.Next() {
-		var category models.Category
-		if err := categoryRows.Scan(
-			&category.ID, &category.Name, &category.Slug, &category.Description,
-			&category.CreatedAt, &category.UpdatedAt,
-		); err != nil {
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
 			return nil, err
 		}
-		post.Categories = append(post.Categories, &category)
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return r.ListWithRelations(ctx, ids)
+}
+
+// PublishScheduled publishes the post as of now if it is still scheduled,
+// and reports whether it did.
+func (r *PostRepository) PublishScheduled(ctx context.Context, id uuid.UUID) (bool, error) {
+	tag, err := r.db.Exec(ctx, database.Qualify(`
+		UPDATE {blog}.posts
+		SET status = 'published', published_at = NOW(), version = version + 1
+		WHERE id = $1 AND status = 'scheduled' AND deleted_at IS NULL
+	`), id)
+	if err != nil {
+		return false, err
 	}
+	return tag.RowsAffected() == 1, nil
+}
 
-	// Get tags
-	tagsQuery := `
\ No newline at end of file
+// ListSitemapEntries returns the slug and last update of every published
+// post, most recently updated first.
+func (r *PostRepository) ListSitemapEntries(ctx context.Context) ([]models.SitemapEntry, error) {
+	return listSitemapEntries(ctx, r.db, database.Qualify(`
+		SELECT slug, updated_at
+		FROM {blog}.posts
+		WHERE status = 'published' AND deleted_at IS NULL
+		ORDER BY updated_at DESC
+	`))
+}
@@ -0,0 +1,539 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/pashagolub/pgxmock"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// createTestAuthor creates a user with an author profile. The user, the
+// profile and the profile's posts are deleted when the test ends.
+func createTestAuthor(t *testing.T, pool *pgxpool.Pool) (userID, authorID uuid.UUID) {
+	t.Helper()
+	ctx := context.Background()
+
+	user := &models.User{
+		Email:        dbtest.UniqueName("author") + "@example.com",
+		PasswordHash: "x",
+		FullName:     "Test Author",
+		Role:         "contributor",
+	}
+	if err := NewUserRepository(pool, nil).Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.users WHERE id = $1"), user.ID)
+	})
+
+	authorID, err := NewPostRepository(pool, nil, NewRedirectRepository(pool)).AuthorIDForUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.posts WHERE author_id = $1"), authorID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.authors WHERE id = $1"), authorID)
+	})
+
+	return user.ID, authorID
+}
+
+func createTestPost(t *testing.T, repo *PostRepository, authorID uuid.UUID, title, status string) *models.Post {
+	t.Helper()
+
+	post := &models.Post{
+		Title:    title,
+		Slug:     dbtest.UniqueName("post"),
+		Content:  "Content of " + title,
+		AuthorID: authorID,
+		Status:   status,
+	}
+	if status == "published" {
+		now := time.Now()
+		post.PublishedAt = &now
+	}
+	if err := repo.Create(context.Background(), post); err != nil {
+		t.Fatal(err)
+	}
+	return post
+}
+
+// The LIMIT and OFFSET placeholders are numbered after the filter's, so a
+// query is only well-formed if they are counted the same way whether or not
+// the status filter is there.
+func TestPostListPaginationWithAndWithoutStatusFilter(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewPostRepository(pool, nil, NewRedirectRepository(pool))
+
+	_, authorID := createTestAuthor(t, pool)
+	word := dbtest.UniqueName("needle")
+	for _, status := range []string{"published", "published", "draft"} {
+		createTestPost(t, repo, authorID, word+" "+status, status)
+	}
+
+	posts, total, err := repo.Search(ctx, word, 10, 0, "")
+	if err != nil {
+		t.Fatalf("Search without status: %v", err)
+	}
+	if total != 3 || len(posts) != 3 {
+		t.Errorf("Search without status = %d posts of %d, want 3 of 3", len(posts), total)
+	}
+
+	posts, total, err = repo.Search(ctx, word, 1, 1, "published")
+	if err != nil {
+		t.Fatalf("Search with status: %v", err)
+	}
+	if total != 2 || len(posts) != 1 || posts[0].Status != "published" {
+		t.Errorf("Search with status = %d posts of %d, want the second of 2 published", len(posts), total)
+	}
+
+	page, err := repo.List(ctx, models.PostFilter{AuthorID: &authorID}, nil, 2)
+	if err != nil {
+		t.Fatalf("List without status: %v", err)
+	}
+	if len(page.Items) != 2 || !page.HasMore {
+		t.Fatalf("List without status = %d posts, more %v; want 2 and more", len(page.Items), page.HasMore)
+	}
+
+	after := page.Items[1].ID
+	page, err = repo.List(ctx, models.PostFilter{AuthorID: &authorID}, &after, 2)
+	if err != nil {
+		t.Fatalf("List after a cursor: %v", err)
+	}
+	if len(page.Items) != 1 || page.HasMore {
+		t.Errorf("List after a cursor = %d posts, more %v; want the last one", len(page.Items), page.HasMore)
+	}
+
+	page, err = repo.List(ctx, models.PostFilter{Status: "draft", AuthorID: &authorID}, nil, 10)
+	if err != nil {
+		t.Fatalf("List with status: %v", err)
+	}
+	if len(page.Items) != 1 || page.Items[0].Status != "draft" {
+		t.Errorf("List with status = %d posts, want the draft", len(page.Items))
+	}
+}
+
+// A post published while a reader pages through the list shows up on no
+// page they have yet to fetch, and pushes nothing onto a page twice.
+func TestPostListPagesStableWhenPostInserted(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewPostRepository(pool, nil, NewRedirectRepository(pool))
+
+	_, authorID := createTestAuthor(t, pool)
+	var created []*models.Post
+	for i := 0; i < 5; i++ {
+		created = append(created, createTestPost(t, repo, authorID, "Post", "published"))
+	}
+	filter := models.PostFilter{AuthorID: &authorID}
+
+	page, err := repo.List(ctx, filter, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := []uuid.UUID{}
+	for {
+		for _, post := range page.Items {
+			seen = append(seen, post.ID)
+		}
+		if len(seen) == 2 {
+			// Newer than every post listed so far
+			createTestPost(t, repo, authorID, "Inserted", "published")
+		}
+		if !page.HasMore {
+			break
+		}
+		after, err := models.DecodeCursor(*page.NextCursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page, err = repo.List(ctx, filter, &after, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []uuid.UUID{}
+	for i := len(created) - 1; i >= 0; i-- {
+		want = append(want, created[i].ID)
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("pages = %v, want %v", seen, want)
+	}
+}
+
+// Two editors load the same post and save it one after the other; the
+// second still has the version it loaded, so its save must not overwrite
+// the first's.
+func TestPostUpdateRejectsStaleVersion(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewPostRepository(pool, nil, NewRedirectRepository(pool))
+
+	_, authorID := createTestAuthor(t, pool)
+	created := createTestPost(t, repo, authorID, "Original title", "draft")
+
+	first, err := repo.GetByID(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := repo.GetByID(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first.Title = "First editor's title"
+	if err := repo.Update(ctx, first); err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+	if first.Version != created.Version+1 {
+		t.Errorf("version after the first update = %d, want %d", first.Version, created.Version+1)
+	}
+
+	second.Title = "Second editor's title"
+	if err := repo.Update(ctx, second); !errors.Is(err, ErrConflict) {
+		t.Fatalf("second update: err = %v, want ErrConflict", err)
+	}
+
+	stored, err := repo.GetByID(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Title != first.Title || stored.Version != first.Version {
+		t.Errorf("stored post = %q at version %d, want %q at version %d", stored.Title, stored.Version, first.Title, first.Version)
+	}
+}
+
+// Renaming a post twice leaves both of its old paths pointing straight at
+// the current one, and taking an old slug back drops its redirect.
+func TestPostRenameFlattensRedirectChains(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	redirects := NewRedirectRepository(pool)
+	repo := NewPostRepository(pool, nil, redirects)
+
+	_, authorID := createTestAuthor(t, pool)
+	post := createTestPost(t, repo, authorID, "Renamed", "draft")
+	first := post.Slug
+	second, third := first+"-2", first+"-3"
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.redirects WHERE from_path LIKE $1"), "/blog/"+first+"%")
+	})
+
+	rename := func(slug string) {
+		t.Helper()
+		post.Slug = slug
+		if err := repo.Update(ctx, post); err != nil {
+			t.Fatalf("renaming to %s: %v", slug, err)
+		}
+	}
+	target := func(slug string) string {
+		t.Helper()
+		redirect, err := redirects.GetByFromPath(ctx, "/blog/"+slug)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if redirect == nil {
+			return ""
+		}
+		return redirect.ToPath
+	}
+
+	rename(second)
+	rename(third)
+
+	for _, slug := range []string{first, second} {
+		if got := target(slug); got != "/blog/"+third {
+			t.Errorf("/blog/%s redirects to %q, want /blog/%s", slug, got, third)
+		}
+	}
+	if got := target(third); got != "" {
+		t.Errorf("the current path redirects to %q", got)
+	}
+
+	var chained int
+	err := pool.QueryRow(ctx, database.Qualify(`
+		SELECT COUNT(*)
+		FROM {cms}.redirects r
+		JOIN {cms}.redirects next ON next.from_path = r.to_path
+		WHERE r.from_path LIKE $1
+	`), "/blog/"+first+"%").Scan(&chained)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chained != 0 {
+		t.Errorf("%d redirects lead to another redirect", chained)
+	}
+
+	rename(first)
+
+	if got := target(first); got != "" {
+		t.Errorf("/blog/%s still redirects to %q after taking it back", first, got)
+	}
+	for _, slug := range []string{second, third} {
+		if got := target(slug); got != "/blog/"+first {
+			t.Errorf("/blog/%s redirects to %q, want /blog/%s", slug, got, first)
+		}
+	}
+}
+
+// A deleted post drops out of the listing and comes back when restored. It
+// keeps its slug while deleted, so the slug is only free again once the
+// post is removed for good.
+func TestPostDeleteAndRestore(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewPostRepository(pool, nil, NewRedirectRepository(pool))
+
+	_, authorID := createTestAuthor(t, pool)
+	post := createTestPost(t, repo, authorID, "Deleted and restored", "published")
+
+	listed := func() bool {
+		t.Helper()
+		page, err := repo.List(ctx, models.PostFilter{AuthorID: &authorID}, nil, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, item := range page.Items {
+			if item.ID == post.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	if err := repo.Delete(ctx, post.ID); err != nil {
+		t.Fatal(err)
+	}
+	if listed() {
+		t.Error("deleted post is still listed")
+	}
+	if got, err := repo.GetBySlug(ctx, post.Slug); err != nil || got != nil {
+		t.Errorf("GetBySlug of a deleted post = %v, %v; want nil", got, err)
+	}
+	deleted, _, err := repo.ListDeleted(ctx, 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, item := range deleted {
+		found = found || item.ID == post.ID
+	}
+	if !found {
+		t.Error("deleted post is not in ListDeleted")
+	}
+
+	if err := repo.Restore(ctx, post.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !listed() {
+		t.Error("restored post is not listed")
+	}
+	if err := repo.Restore(ctx, post.ID); !errors.Is(err, ErrPostNotFound) {
+		t.Errorf("restoring a post that is not deleted: err = %v, want ErrPostNotFound", err)
+	}
+
+	if err := repo.Delete(ctx, post.ID); err != nil {
+		t.Fatal(err)
+	}
+	reuse := &models.Post{Title: "Same slug", Slug: post.Slug, Content: "Content", AuthorID: authorID, Status: "draft"}
+	if err := repo.Create(ctx, reuse); err == nil {
+		t.Fatal("created a post with the slug of a deleted post")
+	}
+
+	dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.posts WHERE id = $1"), post.ID)
+	if err := repo.Create(ctx, reuse); err != nil {
+		t.Errorf("reusing the slug of a removed post: %v", err)
+	}
+}
+
+// postListOrder is the end of every post list query, after its WHERE clause.
+const postListOrder = " ORDER BY COALESCE(p.published_at, p.created_at) DESC, p.id DESC LIMIT "
+
+// postListColumns names the columns List scans, in order.
+var postListColumns = []string{
+	"id", "title", "slug", "excerpt", "featured_image", "author_id", "status", "published_at",
+	"version", "cloned_from", "created_at", "updated_at",
+	"author_id", "author_user_id", "bio", "author_created_at", "author_updated_at",
+	"user_id", "email", "full_name", "role", "avatar_url", "user_created_at", "user_updated_at",
+	"categories", "tags",
+}
+
+// Each filter adds its own condition and argument to the post list query,
+// in a fixed order, and the limit is always the last argument.
+func TestPostListQueryForEachFilter(t *testing.T) {
+	authorID := uuid.New()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+	category := "EXISTS ( SELECT 1 FROM blog.post_categories fpc JOIN blog.categories fc ON fc.id = fpc.category_id WHERE fpc.post_id = p.id AND fc.slug = "
+	tag := "EXISTS ( SELECT 1 FROM blog.post_tags fpt JOIN blog.tags ft ON ft.id = fpt.tag_id WHERE fpt.post_id = p.id AND ft.slug = "
+
+	tests := []struct {
+		name   string
+		filter models.PostFilter
+		where  string
+		args   []interface{}
+	}{
+		{
+			name:  "no filter",
+			where: "WHERE p.deleted_at IS NULL" + postListOrder + "$1",
+			args:  []interface{}{11},
+		},
+		{
+			name:   "status",
+			filter: models.PostFilter{Status: "published"},
+			where:  "WHERE p.deleted_at IS NULL AND p.status = $1" + postListOrder + "$2",
+			args:   []interface{}{"published", 11},
+		},
+		{
+			name:   "category",
+			filter: models.PostFilter{CategorySlug: "news"},
+			where:  "WHERE p.deleted_at IS NULL AND " + category + "$1 )" + postListOrder + "$2",
+			args:   []interface{}{"news", 11},
+		},
+		{
+			name:   "tag",
+			filter: models.PostFilter{TagSlug: "go"},
+			where:  "WHERE p.deleted_at IS NULL AND " + tag + "$1 )" + postListOrder + "$2",
+			args:   []interface{}{"go", 11},
+		},
+		{
+			name:   "author",
+			filter: models.PostFilter{AuthorID: &authorID},
+			where:  "WHERE p.deleted_at IS NULL AND p.author_id = $1" + postListOrder + "$2",
+			args:   []interface{}{authorID, 11},
+		},
+		{
+			name:   "published range",
+			filter: models.PostFilter{PublishedFrom: &from, PublishedTo: &to},
+			where:  "WHERE p.deleted_at IS NULL AND p.published_at >= $1 AND p.published_at < $2" + postListOrder + "$3",
+			args:   []interface{}{from, to, 11},
+		},
+		{
+			name: "all filters",
+			filter: models.PostFilter{
+				Status: "published", CategorySlug: "news", TagSlug: "go",
+				AuthorID: &authorID, PublishedFrom: &from, PublishedTo: &to,
+			},
+			where: "WHERE p.deleted_at IS NULL AND p.status = $1 AND " + category + "$2 ) AND " + tag + "$3 )" +
+				" AND p.author_id = $4 AND p.published_at >= $5 AND p.published_at < $6" + postListOrder + "$7",
+			args: []interface{}{"published", "news", "go", authorID, from, to, 11},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock, err := pgxmock.NewPool()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer mock.Close()
+			posts := &PostRepository{db: mock}
+
+			mock.ExpectQuery("FROM blog.posts p .*" + regexp.QuoteMeta(tt.where) + "$").
+				WithArgs(tt.args...).
+				WillReturnRows(pgxmock.NewRows(postListColumns))
+
+			result, err := posts.List(context.Background(), tt.filter, nil, 10)
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(result.Items) != 0 || result.HasMore {
+				t.Errorf("List = %d posts, has more %v; want an empty page", len(result.Items), result.HasMore)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+// A cursor is resolved to the sort position of the post it names, which
+// then bounds the page after the filter's own conditions. The rows carry
+// their author and user, and the extra row only marks that more follow.
+func TestPostListAfterCursor(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	posts := &PostRepository{db: mock}
+
+	after := uuid.New()
+	sortedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT COALESCE(published_at, created_at) FROM blog.posts WHERE id = $1")).
+		WithArgs(after).
+		WillReturnRows(pgxmock.NewRows([]string{"sorted_at"}).AddRow(sortedAt))
+
+	rows := pgxmock.NewRows(postListColumns)
+	var ids []uuid.UUID
+	for i := 0; i < 2; i++ {
+		id, authorID, userID := uuid.New(), uuid.New(), uuid.New()
+		ids = append(ids, id)
+		published := sortedAt.Add(-time.Duration(i+1) * time.Hour)
+		email, fullName, role := "author@example.com", "Test Author", "contributor"
+		rows.AddRow(
+			id, "Post", "post", "", "", authorID, "published", &published,
+			1, nil, published, published,
+			&authorID, &userID, "", &published, &published,
+			&userID, &email, &fullName, &role, "", &published, &published,
+			[]byte(`[{"name": "News", "slug": "news"}]`), []byte(`[]`),
+		)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE p.deleted_at IS NULL AND p.status = $1" +
+		" AND (COALESCE(p.published_at, p.created_at), p.id) < ($2, $3)" + postListOrder + "$4")).
+		WithArgs("published", sortedAt, after, 2).
+		WillReturnRows(rows)
+
+	result, err := posts.List(context.Background(), models.PostFilter{Status: "published"}, &after, 1)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(result.Items) != 1 || result.Items[0].ID != ids[0] {
+		t.Fatalf("List = %d posts, want the first row only", len(result.Items))
+	}
+	if !result.HasMore || result.NextCursor == nil || *result.NextCursor != models.EncodeCursor(ids[0]) {
+		t.Errorf("has more = %v, next cursor = %v; want a cursor after the first row", result.HasMore, result.NextCursor)
+	}
+	post := result.Items[0]
+	if post.Author == nil || post.Author.User == nil || post.Author.User.Email != "author@example.com" {
+		t.Errorf("author = %+v, want the joined author and user", post.Author)
+	}
+	if len(post.Categories) != 1 || post.Categories[0].Slug != "news" {
+		t.Errorf("categories = %+v, want news", post.Categories)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+// A cursor naming a post that no longer exists is rejected without
+// running the list query.
+func TestPostListRejectsUnknownCursor(t *testing.T) {
+	mock, err := pgxmock.NewPool()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mock.Close()
+	posts := &PostRepository{db: mock}
+
+	after := uuid.New()
+	mock.ExpectQuery("SELECT COALESCE").WithArgs(after).WillReturnError(pgx.ErrNoRows)
+
+	if _, err := posts.List(context.Background(), models.PostFilter{}, &after, 10); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("List: err = %v, want ErrInvalidCursor", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+const productCategoryColumns = `id, name, slug, COALESCE(description, ''), COALESCE(image, ''), tax_rate, parent_id, created_at, updated_at`
+
+// ProductCategoryRepository reads shop categories, which form a tree
+// through parent_id.
+type ProductCategoryRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewProductCategoryRepository(db *pgxpool.Pool) *ProductCategoryRepository {
+	return &ProductCategoryRepository{db: db}
+}
+
+// GetTree returns the root categories with their descendants nested in
+// Children.
+func (r *ProductCategoryRepository) GetTree(ctx context.Context) ([]*models.ProductCategory, error) {
+	query := database.Qualify(`
+		WITH RECURSIVE tree AS (
+			SELECT id, name, slug, description, image, tax_rate, parent_id, created_at, updated_at, 0 AS depth
+			FROM {shop}.product_categories
+			WHERE parent_id IS NULL
+			UNION ALL
+			SELECT c.id, c.name, c.slug, c.description, c.image, c.tax_rate, c.parent_id, c.created_at, c.updated_at, t.depth + 1
+			FROM {shop}.product_categories c
+			JOIN tree t ON c.parent_id = t.id
+		)
+		SELECT ` + productCategoryColumns + `
+		FROM tree
+		ORDER BY depth, name
+	`)
+
+	rows, err := r.db.Query(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := scanProductCategories(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildProductCategoryTree(categories), nil
+}
+
+// GetBySlug returns the category with its ancestors, root first, or nil.
+func (r *ProductCategoryRepository) GetBySlug(ctx context.Context, slug string) (*models.ProductCategory, error) {
+	query := database.Qualify(`
+		WITH RECURSIVE ancestors AS (
+			SELECT id, name, slug, description, image, tax_rate, parent_id, created_at, updated_at, 0 AS depth
+			FROM {shop}.product_categories
+			WHERE slug = $1
+			UNION ALL
+			SELECT c.id, c.name, c.slug, c.description, c.image, c.tax_rate, c.parent_id, c.created_at, c.updated_at, a.depth + 1
+			FROM {shop}.product_categories c
+			JOIN ancestors a ON c.id = a.parent_id
+		)
+		SELECT ` + productCategoryColumns + `
+		FROM ancestors
+		ORDER BY depth DESC
+	`)
+
+	rows, err := r.db.Query(ctx, query, slug)
+	if err != nil {
+		return nil, err
+	}
+
+	path, err := scanProductCategories(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(path) == 0 {
+		return nil, nil
+	}
+
+	category := path[len(path)-1]
+	category.Ancestors = path[:len(path)-1]
+	return category, nil
+}
+
+func scanProductCategories(rows pgx.Rows) ([]*models.ProductCategory, error) {
+	defer rows.Close()
+
+	categories := []*models.ProductCategory{}
+	for rows.Next() {
+		var category models.ProductCategory
+		if err := rows.Scan(
+			&category.ID,
+			&category.Name,
+			&category.Slug,
+			&category.Description,
+			&category.Image,
+			&category.TaxRate,
+			&category.ParentID,
+			&category.CreatedAt,
+			&category.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		categories = append(categories, &category)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+// buildProductCategoryTree nests categories under their parents. Parents
+// must come before their children in the input, as they do when ordered by
+// depth.
+func buildProductCategoryTree(categories []*models.ProductCategory) []*models.ProductCategory {
+	byID := make(map[uuid.UUID]*models.ProductCategory, len(categories))
+	roots := []*models.ProductCategory{}
+
+	for _, category := range categories {
+		byID[category.ID] = category
+
+		var parent *models.ProductCategory
+		if category.ParentID != nil {
+			parent = byID[*category.ParentID]
+		}
+
+		if parent == nil {
+			roots = append(roots, category)
+			continue
+		}
+		parent.Children = append(parent.Children, category)
+	}
+
+	return roots
+}
@@ -0,0 +1,169 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var ErrInvalidImageOrder = errors.New("image order must list each of the product's images exactly once")
+
+type ProductImageRepository struct {
+	db      *pgxpool.Pool
+	tracker *database.TransactionTracker
+}
+
+func NewProductImageRepository(db *pgxpool.Pool, tracker *database.TransactionTracker) *ProductImageRepository {
+	return &ProductImageRepository{db: db, tracker: tracker}
+}
+
+func (r *ProductImageRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.ProductImage, error) {
+	query := database.Qualify(`
+		SELECT id, product_id, url, alt_text, sort_order, created_at, updated_at
+		FROM {shop}.product_images
+		WHERE id = $1
+	`)
+
+	var image models.ProductImage
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&image.ID,
+		&image.ProductID,
+		&image.URL,
+		&image.AltText,
+		&image.SortOrder,
+		&image.CreatedAt,
+		&image.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &image, nil
+}
+
+func (r *ProductImageRepository) ListByProduct(ctx context.Context, productID uuid.UUID) ([]*models.ProductImage, error) {
+	return listProductImages(ctx, r.db, productID)
+}
+
+// AddImage appends an image to the end of the product's gallery.
+func (r *ProductImageRepository) AddImage(ctx context.Context, productID uuid.UUID, url, altText string) (*models.ProductImage, error) {
+	query := database.Qualify(`
+		INSERT INTO {shop}.product_images (product_id, url, alt_text, sort_order)
+		VALUES ($1, $2, $3, (
+			SELECT COALESCE(MAX(sort_order) + 1, 0)
+			FROM {shop}.product_images
+			WHERE product_id = $1
+		))
+		RETURNING id, sort_order, created_at, updated_at
+	`)
+
+	image := models.ProductImage{ProductID: productID, URL: url, AltText: altText}
+	err := r.db.QueryRow(ctx, query, productID, url, altText).Scan(
+		&image.ID,
+		&image.SortOrder,
+		&image.CreatedAt,
+		&image.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &image, nil
+}
+
+func (r *ProductImageRepository) RemoveImage(ctx context.Context, imageID uuid.UUID) error {
+	_, err := r.db.Exec(ctx, database.Qualify("DELETE FROM {shop}.product_images WHERE id = $1"), imageID)
+	return err
+}
+
+// Reorder sets the gallery order to orderedIDs, which must contain every
+// image of the product exactly once. Anything else fails with
+// ErrInvalidImageOrder and leaves the order unchanged.
+func (r *ProductImageRepository) Reorder(ctx context.Context, productID uuid.UUID, orderedIDs []uuid.UUID) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, database.Qualify("SELECT id FROM {shop}.product_images WHERE product_id = $1 FOR UPDATE"), productID)
+		if err != nil {
+			return err
+		}
+		current := map[uuid.UUID]bool{}
+		for rows.Next() {
+			var id uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			current[id] = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		if len(orderedIDs) != len(current) {
+			return ErrInvalidImageOrder
+		}
+		seen := make(map[uuid.UUID]bool, len(orderedIDs))
+		for _, id := range orderedIDs {
+			if !current[id] || seen[id] {
+				return ErrInvalidImageOrder
+			}
+			seen[id] = true
+		}
+
+		for position, id := range orderedIDs {
+			_, err = tx.Exec(ctx, database.Qualify("UPDATE {shop}.product_images SET sort_order = $1 WHERE id = $2"), position, id)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func listProductImages(ctx context.Context, db dbtx, productID uuid.UUID) ([]*models.ProductImage, error) {
+	query := database.Qualify(`
+		SELECT id, product_id, url, alt_text, sort_order, created_at, updated_at
+		FROM {shop}.product_images
+		WHERE product_id = $1
+		ORDER BY sort_order, created_at
+	`)
+
+	rows, err := db.Query(ctx, query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	images := []*models.ProductImage{}
+	for rows.Next() {
+		var image models.ProductImage
+		if err := rows.Scan(
+			&image.ID,
+			&image.ProductID,
+			&image.URL,
+			&image.AltText,
+			&image.SortOrder,
+			&image.CreatedAt,
+			&image.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		images = append(images, &image)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return images, nil
+}
@@ -0,0 +1,71 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+)
+
+// Reorder takes each of the product's images exactly once; an image of
+// another product is refused and leaves the order as it was.
+func TestProductImageReorder(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewProductImageRepository(pool, nil)
+
+	productID := createTestProduct(t, pool, 1)
+	otherID := createTestProduct(t, pool, 1)
+	var ids []uuid.UUID
+	for _, url := range []string{"https://cdn.example.com/a.jpg", "https://cdn.example.com/b.jpg", "https://cdn.example.com/c.jpg"} {
+		image, err := repo.AddImage(ctx, productID, url, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, image.ID)
+	}
+	foreign, err := repo.AddImage(ctx, otherID, "https://cdn.example.com/d.jpg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	invalid := map[string][]uuid.UUID{
+		"another product's image": {ids[2], ids[1], foreign.ID},
+		"an image missing":        {ids[2], ids[1]},
+		"an image twice":          {ids[2], ids[1], ids[1]},
+	}
+	for name, order := range invalid {
+		if err := repo.Reorder(ctx, productID, order); !errors.Is(err, ErrInvalidImageOrder) {
+			t.Errorf("Reorder with %s: err = %v, want ErrInvalidImageOrder", name, err)
+		}
+	}
+
+	images, err := repo.ListByProduct(ctx, productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != len(ids) {
+		t.Fatalf("ListByProduct = %d images, want %d", len(images), len(ids))
+	}
+	for i, image := range images {
+		if image.ID != ids[i] {
+			t.Fatalf("image %d after refused reorders = %s, want %s", i, image.ID, ids[i])
+		}
+	}
+
+	if err := repo.Reorder(ctx, productID, []uuid.UUID{ids[2], ids[0], ids[1]}); err != nil {
+		t.Fatal(err)
+	}
+	images, err = repo.ListByProduct(ctx, productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []uuid.UUID{ids[2], ids[0], ids[1]}
+	for i, image := range images {
+		if image.ID != want[i] || image.SortOrder != i {
+			t.Errorf("image %d = %s at %d, want %s at %d", i, image.ID, image.SortOrder, want[i], i)
+		}
+	}
+}
@@ -0,0 +1,599 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var (
+	ErrProductCategoryNotFound = errors.New("product category not found")
+	ErrProductNotFound         = errors.New("product not found")
+	// ErrProductInUse is returned when deleting a product variant that has
+	// been ordered.
+	ErrProductInUse = errors.New("product has been ordered")
+	// ErrOutOfStock is returned when fewer units are in stock than asked for.
+	ErrOutOfStock = errors.New("not enough stock")
+)
+
+type ProductRepository struct {
+	db        *pgxpool.Pool
+	tracker   *database.TransactionTracker
+	redirects *RedirectRepository
+}
+
+func NewProductRepository(db *pgxpool.Pool, tracker *database.TransactionTracker, redirects *RedirectRepository) *ProductRepository {
+	return &ProductRepository{db: db, tracker: tracker, redirects: redirects}
+}
+
+// GetByID returns the product with its attributes, images and variants, or
+// nil. Deleted products are not returned, here or by any other lookup or
+// list but ListDeleted.
+func (r *ProductRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Product, error) {
+	query := database.Qualify(`
+		SELECT id, name, slug, description, price, sale_price, sku, stock,
+			   COALESCE(is_featured, FALSE), type, price_includes_tax, tax_rate,
+			   category_id, vendor_id, status, shipping_restrictions, version, created_at, updated_at
+		FROM {shop}.products
+		WHERE id = $1 AND deleted_at IS NULL
+	`)
+
+	var product models.Product
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&product.ID, &product.Name, &product.Slug, &product.Description, &product.Price, &product.SalePrice,
+		&product.SKU, &product.Stock, &product.IsFeatured, &product.Type,
+		&product.PriceIncludesTax, &product.TaxRate,
+		&product.CategoryID, &product.VendorID, &product.Status, &product.ShippingRestrictions,
+		&product.Version, &product.CreatedAt, &product.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if err := r.loadAttributes(ctx, &product); err != nil {
+		return nil, err
+	}
+
+	if product.Images, err = listProductImages(ctx, r.db, product.ID); err != nil {
+		return nil, err
+	}
+
+	if product.Variants, err = listProductVariants(ctx, r.db, product.ID); err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// GetBySlug returns the published product with its attributes and category,
+// if any. Drafts are not visible by slug.
+func (r *ProductRepository) GetBySlug(ctx context.Context, slug string) (*models.Product, error) {
+	query := database.Qualify(`
+		SELECT p.id, p.name, p.slug, p.description, p.price, p.sale_price, p.sku, p.stock,
+			   COALESCE(p.is_featured, FALSE), p.type, p.price_includes_tax, p.tax_rate,
+			   p.category_id, p.vendor_id, p.status, p.shipping_restrictions, p.version, p.created_at, p.updated_at,
+			   pc.id, pc.name, pc.slug, COALESCE(pc.description, ''), COALESCE(pc.image, ''), pc.tax_rate,
+			   pc.created_at, pc.updated_at
+		FROM {shop}.products p
+		LEFT JOIN {shop}.product_categories pc ON p.category_id = pc.id
+		WHERE p.slug = $1 AND p.status = 'published' AND p.deleted_at IS NULL
+	`)
+
+	var product models.Product
+	var categoryID *uuid.UUID
+	var category models.ProductCategory
+	var categoryName, categorySlug *string
+	var categoryTaxRate *float64
+	var categoryCreatedAt, categoryUpdatedAt *time.Time
+	err := r.db.QueryRow(ctx, query, slug).Scan(
+		&product.ID, &product.Name, &product.Slug, &product.Description, &product.Price, &product.SalePrice,
+		&product.SKU, &product.Stock, &product.IsFeatured, &product.Type,
+		&product.PriceIncludesTax, &product.TaxRate,
+		&product.CategoryID, &product.VendorID, &product.Status, &product.ShippingRestrictions,
+		&product.Version, &product.CreatedAt, &product.UpdatedAt,
+		&categoryID, &categoryName, &categorySlug, &category.Description, &category.Image, &categoryTaxRate,
+		&categoryCreatedAt, &categoryUpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	if categoryID != nil {
+		category.ID = *categoryID
+		category.Name = *categoryName
+		category.Slug = *categorySlug
+		category.TaxRate = *categoryTaxRate
+		category.CreatedAt = *categoryCreatedAt
+		category.UpdatedAt = *categoryUpdatedAt
+		product.Category = &category
+	}
+
+	if err := r.loadAttributes(ctx, &product); err != nil {
+		return nil, err
+	}
+
+	if product.Images, err = listProductImages(ctx, r.db, product.ID); err != nil {
+		return nil, err
+	}
+
+	if product.Variants, err = listProductVariants(ctx, r.db, product.ID); err != nil {
+		return nil, err
+	}
+
+	return &product, nil
+}
+
+// MoveToCategory moves the listed products that are in the source category
+// to the target category, and returns the IDs of the products it moved.
+// The move is audited as one entry on the target category. Returns
+// ErrProductCategoryNotFound, before moving anything, if the target does
+// not exist.
+func (r *ProductRepository) MoveToCategory(ctx context.Context, sourceID, targetID uuid.UUID, productIDs []uuid.UUID, actorID uuid.UUID) ([]uuid.UUID, error) {
+	moved := []uuid.UUID{}
+	err := database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		// FOR SHARE keeps the target from being deleted until the move commits
+		var exists bool
+		err := tx.QueryRow(ctx, database.Qualify(`
+			SELECT EXISTS (SELECT 1 FROM {shop}.product_categories WHERE id = $1 FOR SHARE)
+		`), targetID).Scan(&exists)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return ErrProductCategoryNotFound
+		}
+
+		rows, err := tx.Query(ctx, database.Qualify(`
+			UPDATE {shop}.products
+			SET category_id = $1
+			WHERE id = ANY($2) AND category_id = $3 AND deleted_at IS NULL
+			RETURNING id
+		`), targetID, productIDs, sourceID)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id uuid.UUID
+			if err := rows.Scan(&id); err != nil {
+				return err
+			}
+			moved = append(moved, id)
+		}
+		if err := rows.Err(); err != nil {
+			return err
+		}
+		if len(moved) == 0 {
+			return nil
+		}
+
+		return insertAuditLog(ctx, tx, &models.AuditLog{
+			ActorID:    nullableUUID(actorID),
+			Action:     "product.bulk_move",
+			EntityType: "product_category",
+			EntityID:   targetID.String(),
+			Details: map[string]interface{}{
+				"from_category_id": sourceID,
+				"product_ids":      moved,
+			},
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return moved, nil
+}
+
+// ListForOrder returns what pricing an order needs of the products: their
+// name, shipping restrictions and whether their price includes tax.
+func (r *ProductRepository) ListForOrder(ctx context.Context, ids []uuid.UUID) ([]*models.Product, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT id, name, shipping_restrictions, price_includes_tax
+		FROM {shop}.products
+		WHERE id = ANY($1) AND deleted_at IS NULL
+	`), ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []*models.Product{}
+	for rows.Next() {
+		var product models.Product
+		if err := rows.Scan(&product.ID, &product.Name, &product.ShippingRestrictions, &product.PriceIncludesTax); err != nil {
+			return nil, err
+		}
+		products = append(products, &product)
+	}
+
+	return products, rows.Err()
+}
+
+func (r *ProductRepository) loadAttributes(ctx context.Context, product *models.Product) error {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT id, product_id, name, value, created_at, updated_at
+		FROM {shop}.product_attributes
+		WHERE product_id = $1
+		ORDER BY name
+	`), product.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	product.Attributes = []*models.ProductAttribute{}
+	for rows.Next() {
+		var attr models.ProductAttribute
+		if err := rows.Scan(
+			&attr.ID, &attr.ProductID, &attr.Name, &attr.Value, &attr.CreatedAt, &attr.UpdatedAt,
+		); err != nil {
+			return err
+		}
+		product.Attributes = append(product.Attributes, &attr)
+	}
+
+	return rows.Err()
+}
+
+func (r *ProductRepository) Create(ctx context.Context, product *models.Product) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		query := database.Qualify(`
+			INSERT INTO {shop}.products (name, slug, description, price, sale_price, sku, stock, is_featured,
+				type, price_includes_tax, tax_rate, category_id, vendor_id, status, shipping_restrictions)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			RETURNING id, version, created_at, updated_at
+		`)
+
+		err := tx.QueryRow(ctx, query,
+			product.Name,
+			product.Slug,
+			product.Description,
+			product.Price,
+			product.SalePrice,
+			product.SKU,
+			product.Stock,
+			product.IsFeatured,
+			product.Type,
+			product.PriceIncludesTax,
+			product.TaxRate,
+			nullableUUID(product.CategoryID),
+			product.VendorID,
+			product.Status,
+			product.ShippingRestrictions,
+		).Scan(&product.ID, &product.Version, &product.CreatedAt, &product.UpdatedAt)
+		if err != nil {
+			return err
+		}
+
+		if err := insertProductAttributes(ctx, tx, product); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// Update saves the product and replaces its attributes if product.Version
+// still matches the stored version, and bumps product.Version. A stale
+// version yields ErrConflict. The content it replaces is kept as a revision
+// credited to editorID.
+func (r *ProductRepository) Update(ctx context.Context, product *models.Product, editorID uuid.UUID) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		// Lock the row and note its current slug so a rename leaves a redirect
+		var oldSlug string
+		err := tx.QueryRow(ctx, database.Qualify("SELECT slug FROM {shop}.products WHERE id = $1 FOR UPDATE"), product.ID).Scan(&oldSlug)
+		if err != nil {
+			return err
+		}
+
+		if err := insertProductRevision(ctx, tx, product.ID, editorID); err != nil {
+			return err
+		}
+
+		query := database.Qualify(`
+			UPDATE {shop}.products
+			SET name = $1, slug = $2, description = $3, price = $4, sale_price = $5, sku = $6,
+				stock = $7, is_featured = $8, type = $9, price_includes_tax = $10, tax_rate = $11,
+				category_id = $12, vendor_id = $13, shipping_restrictions = $14, version = version + 1
+			WHERE id = $15 AND version = $16
+			RETURNING version, updated_at
+		`)
+
+		err = tx.QueryRow(ctx, query,
+			product.Name,
+			product.Slug,
+			product.Description,
+			product.Price,
+			product.SalePrice,
+			product.SKU,
+			product.Stock,
+			product.IsFeatured,
+			product.Type,
+			product.PriceIncludesTax,
+			product.TaxRate,
+			nullableUUID(product.CategoryID),
+			product.VendorID,
+			product.ShippingRestrictions,
+			product.ID,
+			product.Version,
+		).Scan(&product.Version, &product.UpdatedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrConflict
+			}
+			return err
+		}
+
+		if err := recordSlugChange(ctx, r.redirects.WithTx(tx), "/shop/products/", oldSlug, product.Slug); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, database.Qualify("DELETE FROM {shop}.product_attributes WHERE product_id = $1"), product.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := insertProductAttributes(ctx, tx, product); err != nil {
+			return err
+		}
+
+		return nil
+	})
+}
+
+// UpdatePricing saves the product's pricing section only.
+func (r *ProductRepository) UpdatePricing(ctx context.Context, product *models.Product) error {
+	query := database.Qualify(`
+		UPDATE {shop}.products
+		SET price = $1, sale_price = $2, price_includes_tax = $3, tax_rate = $4, version = version + 1
+		WHERE id = $5
+		RETURNING version, updated_at
+	`)
+
+	return r.db.QueryRow(ctx, query,
+		product.Price,
+		product.SalePrice,
+		product.PriceIncludesTax,
+		product.TaxRate,
+		product.ID,
+	).Scan(&product.Version, &product.UpdatedAt)
+}
+
+func (r *ProductRepository) UpdateStock(ctx context.Context, product *models.Product) error {
+	query := database.Qualify(`
+		UPDATE {shop}.products
+		SET stock = $1
+		WHERE id = $2
+		RETURNING updated_at
+	`)
+
+	return r.db.QueryRow(ctx, query, product.Stock, product.ID).Scan(&product.UpdatedAt)
+}
+
+func (r *ProductRepository) UpdateStatus(ctx context.Context, product *models.Product) error {
+	query := database.Qualify(`
+		UPDATE {shop}.products
+		SET status = $1
+		WHERE id = $2
+		RETURNING updated_at
+	`)
+
+	return r.db.QueryRow(ctx, query, product.Status, product.ID).Scan(&product.UpdatedAt)
+}
+
+// List returns a page of the products matching the filter, whatever their
+// status, newest first. The page starts after the product with ID after, so
+// pages stay stable while products are added.
+func (r *ProductRepository) List(ctx context.Context, filter models.ProductFilter, after *uuid.UUID, limit int) (*models.PaginatedResult[*models.Product], error) {
+	where, args := appendProductFilter([]string{"p.deleted_at IS NULL"}, nil, filter)
+
+	if after != nil {
+		var createdAt time.Time
+		err := r.db.QueryRow(ctx, database.Qualify(`
+			SELECT created_at FROM {shop}.products WHERE id = $1
+		`), *after).Scan(&createdAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return nil, ErrInvalidCursor
+			}
+			return nil, err
+		}
+
+		args = append(args, createdAt, *after)
+		where = append(where, fmt.Sprintf("(p.created_at, p.id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := fmt.Sprintf(database.Qualify(`
+		SELECT p.id, p.name, p.slug, p.description, p.price, p.sale_price, p.sku, p.stock,
+			   COALESCE(p.is_featured, FALSE), p.type, p.price_includes_tax, p.tax_rate,
+			   p.category_id, p.vendor_id, p.status, p.shipping_restrictions, p.version, p.created_at, p.updated_at
+		FROM {shop}.products p
+		WHERE %s
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $%d
+	`), strings.Join(where, " AND "), len(args)+1)
+	args = append(args, limit+1)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []*models.Product{}
+	for rows.Next() {
+		var product models.Product
+		if err := rows.Scan(
+			&product.ID, &product.Name, &product.Slug, &product.Description, &product.Price, &product.SalePrice,
+			&product.SKU, &product.Stock, &product.IsFeatured, &product.Type,
+			&product.PriceIncludesTax, &product.TaxRate,
+			&product.CategoryID, &product.VendorID, &product.Status, &product.ShippingRestrictions,
+			&product.Version, &product.CreatedAt, &product.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		products = append(products, &product)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return paginate(products, limit, func(product *models.Product) uuid.UUID { return product.ID }), nil
+}
+
+// Delete marks the product deleted, hiding it from the shop and from every
+// lookup and list but ListDeleted. Its row stays for the order history and
+// keeps its slug and SKU, so Restore brings it back as it was. A product
+// that does not exist or is already deleted yields ErrProductNotFound.
+func (r *ProductRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`
+		UPDATE {shop}.products SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL
+	`), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
+	return nil
+}
+
+// Restore undoes Delete. A product that does not exist or is not deleted
+// yields ErrProductNotFound.
+func (r *ProductRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`
+		UPDATE {shop}.products SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL
+	`), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductNotFound
+	}
+	return nil
+}
+
+// ListDeleted returns a page of the deleted products, most recently deleted
+// first, together with the total number of deleted products.
+func (r *ProductRepository) ListDeleted(ctx context.Context, limit, offset int) ([]*models.Product, int, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT id, name, slug, description, price, sale_price, sku, stock,
+			   COALESCE(is_featured, FALSE), type, price_includes_tax, tax_rate,
+			   category_id, vendor_id, status, shipping_restrictions, deleted_at, created_at, updated_at,
+			   COUNT(*) OVER()
+		FROM {shop}.products
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id
+		LIMIT $1 OFFSET $2
+	`), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	products := []*models.Product{}
+	total := 0
+	for rows.Next() {
+		var product models.Product
+		if err := rows.Scan(
+			&product.ID, &product.Name, &product.Slug, &product.Description, &product.Price, &product.SalePrice,
+			&product.SKU, &product.Stock, &product.IsFeatured, &product.Type,
+			&product.PriceIncludesTax, &product.TaxRate,
+			&product.CategoryID, &product.VendorID, &product.Status, &product.ShippingRestrictions,
+			&product.DeletedAt, &product.CreatedAt, &product.UpdatedAt,
+			&total,
+		); err != nil {
+			return nil, 0, err
+		}
+		products = append(products, &product)
+	}
+
+	return products, total, rows.Err()
+}
+
+// DecrementStock takes qty units of the product out of stock within the
+// caller's transaction. The product row stays locked until tx ends, so
+// concurrent orders for the last units cannot both succeed; the one that
+// finds too few left gets ErrOutOfStock and the stock is left alone.
+func (r *ProductRepository) DecrementStock(ctx context.Context, tx pgx.Tx, productID uuid.UUID, qty int) error {
+	return decrementProductStock(ctx, tx, productID, qty)
+}
+
+func decrementProductStock(ctx context.Context, tx pgx.Tx, productID uuid.UUID, qty int) error {
+	var stock int
+	err := tx.QueryRow(ctx, database.Qualify(`
+		SELECT stock FROM {shop}.products WHERE id = $1 FOR UPDATE
+	`), productID).Scan(&stock)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrProductNotFound
+		}
+		return err
+	}
+	if stock < qty {
+		return ErrOutOfStock
+	}
+
+	_, err = tx.Exec(ctx, database.Qualify(`
+		UPDATE {shop}.products SET stock = stock - $1 WHERE id = $2
+	`), qty, productID)
+	return err
+}
+
+// SKUExists reports whether another product than excludeID uses the SKU.
+func (r *ProductRepository) SKUExists(ctx context.Context, sku string, excludeID uuid.UUID) (bool, error) {
+	query := database.Qualify(`
+		SELECT EXISTS (
+			SELECT 1 FROM {shop}.products WHERE sku = $1 AND id <> $2
+		)
+	`)
+
+	var exists bool
+	err := r.db.QueryRow(ctx, query, sku, excludeID).Scan(&exists)
+	return exists, err
+}
+
+func insertProductAttributes(ctx context.Context, tx pgx.Tx, product *models.Product) error {
+	for _, attr := range product.Attributes {
+		attr.ProductID = product.ID
+		err := tx.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.product_attributes (product_id, name, value)
+			VALUES ($1, $2, $3)
+			RETURNING id, created_at, updated_at
+		`), attr.ProductID, attr.Name, attr.Value).Scan(&attr.ID, &attr.CreatedAt, &attr.UpdatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ListSitemapEntries returns the slug and last update of every published
+// product, most recently updated first.
+func (r *ProductRepository) ListSitemapEntries(ctx context.Context) ([]models.SitemapEntry, error) {
+	return listSitemapEntries(ctx, r.db, database.Qualify(`
+		SELECT slug, updated_at
+		FROM {shop}.products
+		WHERE status = 'published' AND deleted_at IS NULL
+		ORDER BY updated_at DESC
+	`))
+}
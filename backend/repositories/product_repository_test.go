@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// Two admins load the same product and save it one after the other; the
+// second still has the version it loaded, so its save must not overwrite
+// the first's.
+func TestProductUpdateRejectsStaleVersion(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewProductRepository(pool, nil, NewRedirectRepository(pool))
+
+	editorID, _ := createTestAuthor(t, pool)
+	id := createTestProduct(t, pool, 5)
+
+	first, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := first.Version
+
+	first.Price = 12
+	if err := repo.Update(ctx, first, editorID); err != nil {
+		t.Fatalf("first update: %v", err)
+	}
+	if first.Version != loaded+1 {
+		t.Errorf("version after the first update = %d, want %d", first.Version, loaded+1)
+	}
+
+	second.Price = 8
+	if err := repo.Update(ctx, second, editorID); !errors.Is(err, ErrConflict) {
+		t.Fatalf("second update: err = %v, want ErrConflict", err)
+	}
+
+	stored, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Price != first.Price || stored.Version != first.Version {
+		t.Errorf("stored product = %v at version %d, want %v at version %d", stored.Price, stored.Version, first.Price, first.Version)
+	}
+}
+
+// Taking more units than are in stock fails without touching the stock.
+func TestDecrementStock(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewProductRepository(pool, nil, NewRedirectRepository(pool))
+	id := createTestProduct(t, pool, 3)
+
+	decrement := func(qty int) error {
+		return database.WithTransaction(ctx, pool, nil, func(tx pgx.Tx) error {
+			return repo.DecrementStock(ctx, tx, id, qty)
+		})
+	}
+
+	if err := decrement(2); err != nil {
+		t.Fatalf("taking 2 of 3: %v", err)
+	}
+	if err := decrement(2); !errors.Is(err, ErrOutOfStock) {
+		t.Fatalf("taking 2 of 1: err = %v, want ErrOutOfStock", err)
+	}
+
+	product, err := repo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if product.Stock != 1 {
+		t.Errorf("stock = %d, want 1", product.Stock)
+	}
+}
+
+// A product added while an admin pages through the list shows up on no
+// page they have yet to fetch, and pushes nothing onto a page twice.
+func TestProductListPagesStableWhenProductInserted(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewProductRepository(pool, nil, NewRedirectRepository(pool))
+
+	var categoryID uuid.UUID
+	name := dbtest.UniqueName("paging")
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {shop}.product_categories (name, slug) VALUES ($1, $1) RETURNING id
+	`), name).Scan(&categoryID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.product_categories WHERE id = $1"), categoryID)
+	})
+	addProduct := func() uuid.UUID {
+		id := createTestProduct(t, pool, 1)
+		dbtest.Exec(t, pool, database.Qualify("UPDATE {shop}.products SET category_id = $1 WHERE id = $2"), categoryID, id)
+		return id
+	}
+
+	var created []uuid.UUID
+	for i := 0; i < 5; i++ {
+		created = append(created, addProduct())
+	}
+	filter := models.ProductFilter{CategoryID: &categoryID}
+
+	page, err := repo.List(ctx, filter, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	seen := []uuid.UUID{}
+	for {
+		for _, product := range page.Items {
+			seen = append(seen, product.ID)
+		}
+		if len(seen) == 2 {
+			addProduct()
+		}
+		if !page.HasMore {
+			break
+		}
+		after, err := models.DecodeCursor(*page.NextCursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if page, err = repo.List(ctx, filter, &after, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []uuid.UUID{}
+	for i := len(created) - 1; i >= 0; i-- {
+		want = append(want, created[i])
+	}
+	if !reflect.DeepEqual(seen, want) {
+		t.Errorf("pages = %v, want %v", seen, want)
+	}
+}
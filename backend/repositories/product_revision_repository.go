@@ -0,0 +1,148 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var ErrProductRevisionNotFound = errors.New("product revision not found")
+
+// ProductRevisionRepository keeps the history of product content: name,
+// description, prices and attributes.
+type ProductRevisionRepository struct {
+	db      *pgxpool.Pool
+	tracker *database.TransactionTracker
+}
+
+func NewProductRevisionRepository(db *pgxpool.Pool, tracker *database.TransactionTracker) *ProductRevisionRepository {
+	return &ProductRevisionRepository{db: db, tracker: tracker}
+}
+
+// Create snapshots the product's current content as a revision.
+func (r *ProductRevisionRepository) Create(ctx context.Context, productID, createdBy uuid.UUID) error {
+	return insertProductRevision(ctx, r.db, productID, createdBy)
+}
+
+// ListByProduct returns a page of the product's revisions, newest first.
+func (r *ProductRevisionRepository) ListByProduct(ctx context.Context, productID uuid.UUID, limit, offset int) ([]*models.ProductRevision, int, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT id, product_id, name, description, price, sale_price, attributes_json, created_by, created_at,
+			   COUNT(*) OVER()
+		FROM {shop}.product_revisions
+		WHERE product_id = $1
+		ORDER BY created_at DESC, id
+		LIMIT $2 OFFSET $3
+	`), productID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	revisions := []*models.ProductRevision{}
+	total := 0
+	for rows.Next() {
+		var revision models.ProductRevision
+		var attributesJSON []byte
+		if err := rows.Scan(
+			&revision.ID, &revision.ProductID, &revision.Name, &revision.Description, &revision.Price,
+			&revision.SalePrice, &attributesJSON, &revision.CreatedBy, &revision.CreatedAt, &total,
+		); err != nil {
+			return nil, 0, err
+		}
+		if err := json.Unmarshal(attributesJSON, &revision.Attributes); err != nil {
+			return nil, 0, err
+		}
+		revisions = append(revisions, &revision)
+	}
+
+	return revisions, total, rows.Err()
+}
+
+// Restore copies the revision's content back to the product. The product's
+// current content is saved as a new revision first, so the restore can be
+// undone like any other change. Returns ErrProductRevisionNotFound if the
+// revision does not belong to the product.
+func (r *ProductRevisionRepository) Restore(ctx context.Context, productID, revisionID, restoredBy uuid.UUID) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		// Lock the product so a concurrent update cannot slip in between the
+		// snapshot and the restore
+		_, err := tx.Exec(ctx, database.Qualify("SELECT 1 FROM {shop}.products WHERE id = $1 FOR UPDATE"), productID)
+		if err != nil {
+			return err
+		}
+
+		var revision models.ProductRevision
+		var attributesJSON []byte
+		err = tx.QueryRow(ctx, database.Qualify(`
+			SELECT name, description, price, sale_price, attributes_json
+			FROM {shop}.product_revisions
+			WHERE id = $1 AND product_id = $2
+		`), revisionID, productID).Scan(
+			&revision.Name, &revision.Description, &revision.Price, &revision.SalePrice, &attributesJSON,
+		)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrProductRevisionNotFound
+			}
+			return err
+		}
+		if err := json.Unmarshal(attributesJSON, &revision.Attributes); err != nil {
+			return err
+		}
+
+		if err := insertProductRevision(ctx, tx, productID, restoredBy); err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, database.Qualify(`
+			UPDATE {shop}.products
+			SET name = $1, description = $2, price = $3, sale_price = $4, version = version + 1, updated_at = NOW()
+			WHERE id = $5
+		`), revision.Name, revision.Description, revision.Price, revision.SalePrice, productID)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec(ctx, database.Qualify("DELETE FROM {shop}.product_attributes WHERE product_id = $1"), productID)
+		if err != nil {
+			return err
+		}
+		for _, attr := range revision.Attributes {
+			_, err := tx.Exec(ctx, database.Qualify(`
+				INSERT INTO {shop}.product_attributes (product_id, name, value)
+				VALUES ($1, $2, $3)
+			`), productID, attr.Name, attr.Value)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// insertProductRevision snapshots the product's content as it is stored now.
+// Callers changing the product run it in their transaction, before the
+// change.
+func insertProductRevision(ctx context.Context, db dbtx, productID, createdBy uuid.UUID) error {
+	_, err := db.Exec(ctx, database.Qualify(`
+		INSERT INTO {shop}.product_revisions (product_id, name, description, price, sale_price, attributes_json, created_by)
+		SELECT p.id, p.name, p.description, p.price, p.sale_price,
+			   COALESCE((
+				   SELECT jsonb_agg(jsonb_build_object('name', a.name, 'value', a.value) ORDER BY a.name)
+				   FROM {shop}.product_attributes a
+				   WHERE a.product_id = p.id
+			   ), '[]'),
+			   $2
+		FROM {shop}.products p
+		WHERE p.id = $1
+	`), productID, nullableUUID(createdBy))
+	return err
+}
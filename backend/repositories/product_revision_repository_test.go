@@ -0,0 +1,106 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// An update keeps the old content as a revision. Restoring it brings that
+// content back and keeps the replaced content as a revision in turn, so
+// restoring that one undoes the restore.
+func TestProductRevisionRestoreIsReversible(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	productRepo := NewProductRepository(pool, nil, NewRedirectRepository(pool))
+	revisionRepo := NewProductRevisionRepository(pool, nil)
+
+	editorID, _ := createTestAuthor(t, pool)
+	id := createTestProduct(t, pool, 5)
+
+	type content struct {
+		name       string
+		price      float64
+		attributes []models.RevisionAttribute
+	}
+	current := func() content {
+		t.Helper()
+		product, err := productRepo.GetByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := content{name: product.Name, price: product.Price, attributes: []models.RevisionAttribute{}}
+		for _, attr := range product.Attributes {
+			c.attributes = append(c.attributes, models.RevisionAttribute{Name: attr.Name, Value: attr.Value})
+		}
+		return c
+	}
+	latestRevision := func(wantTotal int) *models.ProductRevision {
+		t.Helper()
+		revisions, total, err := revisionRepo.ListByProduct(ctx, id, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != wantTotal {
+			t.Fatalf("%d revisions, want %d", total, wantTotal)
+		}
+		return revisions[0]
+	}
+	check := func(step string, got, want content) {
+		t.Helper()
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: product = %+v, want %+v", step, got, want)
+		}
+	}
+
+	product, err := productRepo.GetByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	product.Attributes = []*models.ProductAttribute{{Name: "color", Value: "red"}}
+	if err := productRepo.Update(ctx, product, editorID); err != nil {
+		t.Fatal(err)
+	}
+	original := current()
+
+	product.Name += " v2"
+	product.Price = 12
+	product.Attributes = []*models.ProductAttribute{{Name: "color", Value: "blue"}}
+	if err := productRepo.Update(ctx, product, editorID); err != nil {
+		t.Fatal(err)
+	}
+	edited := current()
+
+	revision := latestRevision(2)
+	check("the revision an update kept", content{revision.Name, revision.Price, revision.Attributes}, original)
+	if revision.CreatedBy == nil || *revision.CreatedBy != editorID {
+		t.Errorf("revision created by %v, want %s", revision.CreatedBy, editorID)
+	}
+
+	if err := revisionRepo.Restore(ctx, id, revision.ID, editorID); err != nil {
+		t.Fatal(err)
+	}
+	check("after the restore", current(), original)
+	undo := latestRevision(3)
+	check("the revision the restore kept", content{undo.Name, undo.Price, undo.Attributes}, edited)
+
+	if err := revisionRepo.Restore(ctx, id, undo.ID, editorID); err != nil {
+		t.Fatal(err)
+	}
+	check("after undoing the restore", current(), edited)
+	redo := latestRevision(4)
+	check("the revision the undo kept", content{redo.Name, redo.Price, redo.Attributes}, original)
+
+	if err := revisionRepo.Restore(ctx, id, uuid.New(), editorID); !errors.Is(err, ErrProductRevisionNotFound) {
+		t.Errorf("restoring an unknown revision: err = %v, want ErrProductRevisionNotFound", err)
+	}
+	other := createTestProduct(t, pool, 1)
+	if err := revisionRepo.Restore(ctx, other, redo.ID, editorID); !errors.Is(err, ErrProductRevisionNotFound) {
+		t.Errorf("restoring another product's revision: err = %v, want ErrProductRevisionNotFound", err)
+	}
+}
@@ -0,0 +1,275 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// productPriceBounds split product prices into the ranges reported as
+// facets: below 25, 25 to 50, ..., and 500 or more.
+var productPriceBounds = []float64{25, 50, 100, 250, 500}
+
+// SearchWithFacets returns a page of published products matching the query
+// and filter, and facet counts over all of the matches. The query matches
+// product names and descriptions. Prices are compared on the sale price
+// when there is one.
+func (r *ProductRepository) SearchWithFacets(ctx context.Context, query string, filter models.ProductFilter, limit, offset int) (*models.FacetedSearchResult, error) {
+	whereClause, args := productSearchWhere(query, filter)
+	result := &models.FacetedSearchResult{}
+
+	var err error
+	if result.Products, result.Total, err = r.searchPage(ctx, whereClause, args, limit, offset); err != nil {
+		return nil, err
+	}
+	if result.Facets.Categories, err = r.categoryFacets(ctx, whereClause, args); err != nil {
+		return nil, err
+	}
+	if result.Facets.PriceRanges, result.Facets.InStockCount, err = r.priceFacets(ctx, whereClause, args); err != nil {
+		return nil, err
+	}
+	if result.Facets.AttributeValues, err = r.attributeFacets(ctx, whereClause, args); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (r *ProductRepository) searchPage(ctx context.Context, whereClause string, args []interface{}, limit, offset int) ([]*models.Product, int, error) {
+	query := fmt.Sprintf(database.Qualify(`
+		SELECT p.id, p.name, p.slug, p.description, p.price, p.sale_price, p.sku, p.stock,
+			   COALESCE(p.is_featured, FALSE), p.type, p.price_includes_tax, p.tax_rate,
+			   p.category_id, p.vendor_id, p.status, p.created_at, p.updated_at,
+			   pc.id, pc.name, pc.slug, pc.tax_rate, COUNT(*) OVER()
+		FROM {shop}.products p
+		LEFT JOIN {shop}.product_categories pc ON p.category_id = pc.id
+		%s
+		ORDER BY p.is_featured DESC NULLS LAST, p.created_at DESC
+		LIMIT $%d OFFSET $%d
+	`), whereClause, len(args)+1, len(args)+2)
+
+	rows, err := r.db.Query(ctx, query, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	products := []*models.Product{}
+	total := 0
+	for rows.Next() {
+		var product models.Product
+		var categoryID *uuid.UUID
+		var categoryName, categorySlug *string
+		var categoryTaxRate *float64
+		if err := rows.Scan(
+			&product.ID, &product.Name, &product.Slug, &product.Description, &product.Price, &product.SalePrice,
+			&product.SKU, &product.Stock, &product.IsFeatured, &product.Type,
+			&product.PriceIncludesTax, &product.TaxRate,
+			&product.CategoryID, &product.VendorID, &product.Status, &product.CreatedAt, &product.UpdatedAt,
+			&categoryID, &categoryName, &categorySlug, &categoryTaxRate, &total,
+		); err != nil {
+			return nil, 0, err
+		}
+
+		if categoryID != nil {
+			product.Category = &models.ProductCategory{
+				ID:      *categoryID,
+				Name:    *categoryName,
+				Slug:    *categorySlug,
+				TaxRate: *categoryTaxRate,
+			}
+		}
+		products = append(products, &product)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return products, total, nil
+}
+
+func (r *ProductRepository) categoryFacets(ctx context.Context, whereClause string, args []interface{}) ([]models.CategoryFacet, error) {
+	query := fmt.Sprintf(database.Qualify(`
+		SELECT pc.name, pc.slug, COUNT(*)
+		FROM {shop}.products p
+		JOIN {shop}.product_categories pc ON p.category_id = pc.id
+		%s
+		GROUP BY pc.name, pc.slug
+		ORDER BY COUNT(*) DESC, pc.name
+	`), whereClause)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := []models.CategoryFacet{}
+	for rows.Next() {
+		var facet models.CategoryFacet
+		if err := rows.Scan(&facet.Name, &facet.Slug, &facet.Count); err != nil {
+			return nil, err
+		}
+		facets = append(facets, facet)
+	}
+
+	return facets, rows.Err()
+}
+
+// priceFacets counts the matches in each price range, and those in stock.
+// Every range is reported, including empty ones.
+func (r *ProductRepository) priceFacets(ctx context.Context, whereClause string, args []interface{}) ([]models.PriceRangeFacet, int, error) {
+	query := fmt.Sprintf(database.Qualify(`
+		SELECT width_bucket(COALESCE(p.sale_price, p.price)::float8, $%d::float8[]), COUNT(*),
+			   COUNT(*) FILTER (WHERE p.stock > 0)
+		FROM {shop}.products p
+		%s
+		GROUP BY 1
+	`), len(args)+1, whereClause)
+
+	rows, err := r.db.Query(ctx, query, append(args, productPriceBounds)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	facets := make([]models.PriceRangeFacet, len(productPriceBounds)+1)
+	for i := range facets {
+		if i > 0 {
+			facets[i].From = productPriceBounds[i-1]
+		}
+		if i < len(productPriceBounds) {
+			to := productPriceBounds[i]
+			facets[i].To = &to
+		}
+	}
+
+	inStock := 0
+	for rows.Next() {
+		var bucket, count, inStockCount int
+		if err := rows.Scan(&bucket, &count, &inStockCount); err != nil {
+			return nil, 0, err
+		}
+		facets[bucket].Count = count
+		inStock += inStockCount
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return facets, inStock, nil
+}
+
+// attributeFacets counts the matches having each attribute value, grouped by
+// attribute name, most common values first.
+func (r *ProductRepository) attributeFacets(ctx context.Context, whereClause string, args []interface{}) (map[string][]models.AttributeValueFacet, error) {
+	query := fmt.Sprintf(database.Qualify(`
+		SELECT pa.name, pa.value, COUNT(DISTINCT p.id)
+		FROM {shop}.products p
+		JOIN {shop}.product_attributes pa ON pa.product_id = p.id
+		%s
+		GROUP BY pa.name, pa.value
+		ORDER BY pa.name, COUNT(DISTINCT p.id) DESC, pa.value
+	`), whereClause)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	facets := map[string][]models.AttributeValueFacet{}
+	for rows.Next() {
+		var name string
+		var facet models.AttributeValueFacet
+		if err := rows.Scan(&name, &facet.Value, &facet.Count); err != nil {
+			return nil, err
+		}
+		facets[name] = append(facets[name], facet)
+	}
+
+	return facets, rows.Err()
+}
+
+// productSearchWhere builds the WHERE clause and its arguments for a
+// storefront product search. The clause expects the products table aliased
+// as p.
+func productSearchWhere(query string, filter models.ProductFilter) (string, []interface{}) {
+	args := []interface{}{}
+	where := []string{"p.status = 'published'", "p.deleted_at IS NULL"}
+
+	if query = strings.TrimSpace(query); query != "" {
+		args = append(args, "%"+escapeLike(query)+"%")
+		where = append(where, fmt.Sprintf("(p.name ILIKE $%d OR p.description ILIKE $%d)", len(args), len(args)))
+	}
+	where, args = appendProductFilter(where, args, filter)
+
+	return "WHERE " + strings.Join(where, " AND "), args
+}
+
+// appendProductFilter adds the filter's conditions on p, and their
+// arguments, to where and args. A category filter also matches the
+// products of the category's descendants.
+func appendProductFilter(where []string, args []interface{}, filter models.ProductFilter) ([]string, []interface{}) {
+	if filter.CategoryID != nil {
+		args = append(args, *filter.CategoryID)
+		where = append(where, productCategoryCondition("id", len(args)))
+	}
+	if filter.CategorySlug != "" {
+		args = append(args, filter.CategorySlug)
+		where = append(where, productCategoryCondition("slug", len(args)))
+	}
+	if filter.MinPrice != nil {
+		args = append(args, *filter.MinPrice)
+		where = append(where, fmt.Sprintf("COALESCE(p.sale_price, p.price) >= $%d", len(args)))
+	}
+	if filter.MaxPrice != nil {
+		args = append(args, *filter.MaxPrice)
+		where = append(where, fmt.Sprintf("COALESCE(p.sale_price, p.price) <= $%d", len(args)))
+	}
+	if filter.IsFeatured != nil {
+		args = append(args, *filter.IsFeatured)
+		where = append(where, fmt.Sprintf("COALESCE(p.is_featured, FALSE) = $%d", len(args)))
+	}
+	if filter.InStock {
+		where = append(where, "p.stock > 0")
+	}
+
+	// Sorted so the same filter always yields the same query text
+	names := make([]string, 0, len(filter.Attributes))
+	for name := range filter.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, name, filter.Attributes[name])
+		where = append(where, fmt.Sprintf(database.Qualify(`EXISTS (
+			SELECT 1 FROM {shop}.product_attributes pa
+			WHERE pa.product_id = p.id AND pa.name = $%d AND pa.value = $%d
+		)`), len(args)-1, len(args)))
+	}
+
+	return where, args
+}
+
+// productCategoryCondition matches the products in the category whose
+// column equals parameter param, or in any category below it.
+func productCategoryCondition(column string, param int) string {
+	return fmt.Sprintf(database.Qualify(`p.category_id IN (
+		WITH RECURSIVE descendants AS (
+			SELECT id FROM {shop}.product_categories WHERE %s = $%d
+			UNION ALL
+			SELECT c.id
+			FROM {shop}.product_categories c
+			JOIN descendants d ON c.parent_id = d.id
+		)
+		SELECT id FROM descendants
+	)`), column, param)
+}
@@ -0,0 +1,131 @@
+package repositories
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// Facets count every product matching the search, not just the page, and
+// follow the filter: a parent category also counts its child's products.
+func TestSearchWithFacets(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewProductRepository(pool, nil, NewRedirectRepository(pool))
+
+	// Every seeded product's name carries the token, so searching for it
+	// finds this dataset only
+	token := dbtest.UniqueName("facet")
+	createCategory := func(name string, parentID *uuid.UUID) (uuid.UUID, string) {
+		t.Helper()
+		var id uuid.UUID
+		slug := dbtest.UniqueName(name)
+		if err := pool.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.product_categories (name, slug, parent_id) VALUES ($1, $1, $2) RETURNING id
+		`), slug, parentID).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.product_categories WHERE id = $1"), id)
+		})
+		return id, slug
+	}
+	parentID, parentSlug := createCategory("a-parent", nil)
+	childID, childSlug := createCategory("b-child", &parentID)
+	otherID, otherSlug := createCategory("c-other", nil)
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.products WHERE name LIKE $1"), "%"+token+"%")
+	})
+
+	createProduct := func(price float64, salePrice *float64, stock int, categoryID *uuid.UUID, status string, attributes map[string]string) {
+		t.Helper()
+		var id uuid.UUID
+		slug := dbtest.UniqueName("product")
+		if err := pool.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.products (name, slug, description, price, sale_price, sku, stock, category_id, status)
+			VALUES ($1, $2, 'A test product', $3, $4, $2, $5, $6, $7)
+			RETURNING id
+		`), token+" "+slug, slug, price, salePrice, stock, categoryID, status).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range attributes {
+			dbtest.Exec(t, pool, database.Qualify(`
+				INSERT INTO {shop}.product_attributes (product_id, name, value) VALUES ($1, $2, $3)
+			`), id, name, value)
+		}
+	}
+	sale := 20.0
+	createProduct(10, nil, 5, &childID, "published", map[string]string{"color": "red", "size": "M"})
+	createProduct(30, &sale, 0, &childID, "published", map[string]string{"color": "red"})
+	createProduct(60, nil, 2, &otherID, "published", map[string]string{"color": "blue"})
+	createProduct(600, nil, 1, &otherID, "published", nil)
+	createProduct(40, nil, 3, nil, "published", nil)
+	// Drafts are not found, so they are not counted either
+	createProduct(10, nil, 5, &childID, "draft", map[string]string{"color": "green"})
+
+	result, err := repo.SearchWithFacets(ctx, token, models.ProductFilter{}, 2, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 5 || len(result.Products) != 2 {
+		t.Errorf("%d products of %d, want a page of 2 of 5", len(result.Products), result.Total)
+	}
+	checkFacets(t, "unfiltered", result.Facets,
+		[]models.CategoryFacet{
+			{Name: childSlug, Slug: childSlug, Count: 2},
+			{Name: otherSlug, Slug: otherSlug, Count: 2},
+		},
+		// Sale prices count: the 30 on sale for 20 is below 25
+		[]int{2, 1, 1, 0, 0, 1},
+		4,
+		map[string][]models.AttributeValueFacet{
+			"color": {{Value: "red", Count: 2}, {Value: "blue", Count: 1}},
+			"size":  {{Value: "M", Count: 1}},
+		},
+	)
+
+	result, err = repo.SearchWithFacets(ctx, token, models.ProductFilter{CategorySlug: parentSlug}, 20, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Total != 2 {
+		t.Errorf("%d products in the parent category, want its child's 2", result.Total)
+	}
+	checkFacets(t, "parent category", result.Facets,
+		[]models.CategoryFacet{{Name: childSlug, Slug: childSlug, Count: 2}},
+		[]int{2, 0, 0, 0, 0, 0},
+		1,
+		map[string][]models.AttributeValueFacet{
+			"color": {{Value: "red", Count: 2}},
+			"size":  {{Value: "M", Count: 1}},
+		},
+	)
+}
+
+// checkFacets compares the facets with those wanted. priceCounts are the
+// counts of the price ranges, lowest first.
+func checkFacets(t *testing.T, label string, got models.ProductFacets, categories []models.CategoryFacet, priceCounts []int, inStock int, attributes map[string][]models.AttributeValueFacet) {
+	t.Helper()
+
+	if !reflect.DeepEqual(got.Categories, categories) {
+		t.Errorf("%s: categories = %v, want %v", label, got.Categories, categories)
+	}
+	counts := make([]int, len(got.PriceRanges))
+	for i, priceRange := range got.PriceRanges {
+		counts[i] = priceRange.Count
+	}
+	if !reflect.DeepEqual(counts, priceCounts) {
+		t.Errorf("%s: price range counts = %v, want %v", label, counts, priceCounts)
+	}
+	if got.InStockCount != inStock {
+		t.Errorf("%s: in stock = %d, want %d", label, got.InStockCount, inStock)
+	}
+	if !reflect.DeepEqual(got.AttributeValues, attributes) {
+		t.Errorf("%s: attribute values = %v, want %v", label, got.AttributeValues, attributes)
+	}
+}
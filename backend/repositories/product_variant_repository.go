@@ -0,0 +1,182 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var (
+	ErrProductVariantNotFound = errors.New("product variant not found")
+	ErrVariantSKUTaken        = errors.New("variant SKU is already in use")
+)
+
+type ProductVariantRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewProductVariantRepository(db *pgxpool.Pool) *ProductVariantRepository {
+	return &ProductVariantRepository{db: db}
+}
+
+// ListByProduct returns the product's variants in the order they were
+// added.
+func (r *ProductVariantRepository) ListByProduct(ctx context.Context, productID uuid.UUID) ([]*models.ProductVariant, error) {
+	return listProductVariants(ctx, r.db, productID)
+}
+
+// Create adds a variant to its product. A SKU used by another variant
+// yields ErrVariantSKUTaken.
+func (r *ProductVariantRepository) Create(ctx context.Context, variant *models.ProductVariant) error {
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {shop}.product_variants (product_id, sku, attributes, stock, price)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`), variant.ProductID, variant.SKU, variant.Attributes, variant.Stock, variant.Price).Scan(
+		&variant.ID, &variant.CreatedAt, &variant.UpdatedAt,
+	)
+	return variantWriteError(err)
+}
+
+// Update saves the variant, which must belong to variant.ProductID.
+func (r *ProductVariantRepository) Update(ctx context.Context, variant *models.ProductVariant) error {
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		UPDATE {shop}.product_variants
+		SET sku = $1, attributes = $2, stock = $3, price = $4, updated_at = NOW()
+		WHERE id = $5 AND product_id = $6
+		RETURNING created_at, updated_at
+	`), variant.SKU, variant.Attributes, variant.Stock, variant.Price, variant.ID, variant.ProductID).Scan(
+		&variant.CreatedAt, &variant.UpdatedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrProductVariantNotFound
+	}
+	return variantWriteError(err)
+}
+
+// Delete removes the product's variant. A variant that has been ordered is
+// kept for the order history and yields ErrProductInUse.
+func (r *ProductVariantRepository) Delete(ctx context.Context, productID, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`
+		DELETE FROM {shop}.product_variants WHERE id = $1 AND product_id = $2
+	`), id, productID)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+			return ErrProductInUse
+		}
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrProductVariantNotFound
+	}
+	return nil
+}
+
+// AdjustStock adds delta, which may be negative, to the variant's stock
+// and returns the new stock. Stock never drops below zero: a larger
+// decrease yields ErrOutOfStock and leaves the stock alone.
+func (r *ProductVariantRepository) AdjustStock(ctx context.Context, id uuid.UUID, delta int) (int, error) {
+	var stock int
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		UPDATE {shop}.product_variants
+		SET stock = stock + $1, updated_at = NOW()
+		WHERE id = $2 AND stock + $1 >= 0
+		RETURNING stock
+	`), delta, id).Scan(&stock)
+	if err == nil {
+		return stock, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, err
+	}
+
+	// Tell a missing variant from one without enough stock
+	var exists bool
+	err = r.db.QueryRow(ctx, database.Qualify(`
+		SELECT EXISTS (SELECT 1 FROM {shop}.product_variants WHERE id = $1)
+	`), id).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, ErrProductVariantNotFound
+	}
+	return 0, ErrOutOfStock
+}
+
+// DecrementStock takes qty units of the variant out of stock within the
+// caller's transaction, locking the variant row until tx ends. Too few
+// units left yields ErrOutOfStock and the stock is left alone.
+func (r *ProductVariantRepository) DecrementStock(ctx context.Context, tx pgx.Tx, variantID uuid.UUID, qty int) error {
+	return decrementVariantStock(ctx, tx, variantID, qty)
+}
+
+func decrementVariantStock(ctx context.Context, tx pgx.Tx, variantID uuid.UUID, qty int) error {
+	var stock int
+	err := tx.QueryRow(ctx, database.Qualify(`
+		SELECT stock FROM {shop}.product_variants WHERE id = $1 FOR UPDATE
+	`), variantID).Scan(&stock)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrProductVariantNotFound
+		}
+		return err
+	}
+	if stock < qty {
+		return ErrOutOfStock
+	}
+
+	_, err = tx.Exec(ctx, database.Qualify(`
+		UPDATE {shop}.product_variants SET stock = stock - $1, updated_at = NOW() WHERE id = $2
+	`), qty, variantID)
+	return err
+}
+
+func listProductVariants(ctx context.Context, db dbtx, productID uuid.UUID) ([]*models.ProductVariant, error) {
+	rows, err := db.Query(ctx, database.Qualify(`
+		SELECT id, product_id, sku, attributes, stock, price, created_at, updated_at
+		FROM {shop}.product_variants
+		WHERE product_id = $1
+		ORDER BY created_at, sku
+	`), productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []*models.ProductVariant{}
+	for rows.Next() {
+		var variant models.ProductVariant
+		if err := rows.Scan(
+			&variant.ID,
+			&variant.ProductID,
+			&variant.SKU,
+			&variant.Attributes,
+			&variant.Stock,
+			&variant.Price,
+			&variant.CreatedAt,
+			&variant.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		variants = append(variants, &variant)
+	}
+
+	return variants, rows.Err()
+}
+
+// variantWriteError maps a duplicate SKU to ErrVariantSKUTaken.
+func variantWriteError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrVariantSKUTaken
+	}
+	return err
+}
@@ -0,0 +1,117 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// dbtx is implemented by both the pool and a transaction, so repositories
+// can run the same statements inside another repository's transaction.
+type dbtx interface {
+	Exec(ctx context.Context, sql string, args ...interface{}) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// MaxSlugDistance is the largest edit distance at which a mistyped or
+// outdated slug is still taken to mean an existing one.
+const MaxSlugDistance = 3
+
+// RedirectRepository stores permanent redirects from old URLs to new ones.
+type RedirectRepository struct {
+	db dbtx
+}
+
+func NewRedirectRepository(db *pgxpool.Pool) *RedirectRepository {
+	return &RedirectRepository{db: db}
+}
+
+// WithTx returns a copy of the repository that runs inside tx.
+func (r *RedirectRepository) WithTx(tx pgx.Tx) *RedirectRepository {
+	return &RedirectRepository{db: tx}
+}
+
+// Create adds a redirect, replacing the target of any existing redirect from
+// the same path.
+func (r *RedirectRepository) Create(ctx context.Context, redirect *models.Redirect) error {
+	query := database.Qualify(`
+		INSERT INTO {cms}.redirects (from_path, to_path, status_code)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (from_path) DO UPDATE SET to_path = EXCLUDED.to_path, status_code = EXCLUDED.status_code
+		RETURNING id, created_at, updated_at
+	`)
+
+	return r.db.QueryRow(ctx, query, redirect.FromPath, redirect.ToPath, redirect.StatusCode).
+		Scan(&redirect.ID, &redirect.CreatedAt, &redirect.UpdatedAt)
+}
+
+// GetByFromPath returns the redirect away from path, or nil.
+func (r *RedirectRepository) GetByFromPath(ctx context.Context, path string) (*models.Redirect, error) {
+	query := database.Qualify(`
+		SELECT id, from_path, to_path, status_code, created_at, updated_at
+		FROM {cms}.redirects
+		WHERE from_path = $1
+	`)
+
+	var redirect models.Redirect
+	err := r.db.QueryRow(ctx, query, path).Scan(
+		&redirect.ID,
+		&redirect.FromPath,
+		&redirect.ToPath,
+		&redirect.StatusCode,
+		&redirect.CreatedAt,
+		&redirect.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &redirect, nil
+}
+
+// ChainCompress points every redirect that targets oldPath straight at
+// newPath, so a renamed page never sits behind more than one hop.
+func (r *RedirectRepository) ChainCompress(ctx context.Context, oldPath, newPath string) error {
+	_, err := r.db.Exec(ctx, database.Qualify("UPDATE {cms}.redirects SET to_path = $2 WHERE to_path = $1"), oldPath, newPath)
+	return err
+}
+
+// DeleteFrom removes the redirect away from path, used when a page takes
+// back a path it previously gave up.
+func (r *RedirectRepository) DeleteFrom(ctx context.Context, path string) error {
+	_, err := r.db.Exec(ctx, database.Qualify("DELETE FROM {cms}.redirects WHERE from_path = $1"), path)
+	return err
+}
+
+// recordSlugChange redirects prefix/oldSlug to prefix/newSlug and keeps
+// existing redirects to the old path to a single hop.
+func recordSlugChange(ctx context.Context, redirects *RedirectRepository, prefix, oldSlug, newSlug string) error {
+	if oldSlug == newSlug {
+		return nil
+	}
+
+	oldPath, newPath := prefix+oldSlug, prefix+newSlug
+
+	if err := redirects.ChainCompress(ctx, oldPath, newPath); err != nil {
+		return err
+	}
+	if err := redirects.DeleteFrom(ctx, newPath); err != nil {
+		return err
+	}
+
+	return redirects.Create(ctx, &models.Redirect{
+		FromPath:   oldPath,
+		ToPath:     newPath,
+		StatusCode: 301,
+	})
+}
@@ -0,0 +1,114 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var (
+	// ErrRefreshTokenNotFound is returned for tokens that were never issued,
+	// have expired or have been revoked.
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	// ErrRefreshTokenReused is returned when a refresh token that was already
+	// used is presented again.
+	ErrRefreshTokenReused = errors.New("refresh token already used")
+)
+
+type RefreshTokenRepository struct {
+	db      *pgxpool.Pool
+	tracker *database.TransactionTracker
+}
+
+func NewRefreshTokenRepository(db *pgxpool.Pool, tracker *database.TransactionTracker) *RefreshTokenRepository {
+	return &RefreshTokenRepository{db: db, tracker: tracker}
+}
+
+// Create records a newly issued token.
+func (r *RefreshTokenRepository) Create(ctx context.Context, token *models.RefreshToken) error {
+	return insertRefreshToken(ctx, r.db, token)
+}
+
+// Rotate uses up the token with oldID and records next, its replacement, in
+// the same family. The old token's row is locked, so of several concurrent
+// rotations of one token exactly one succeeds; the others, and any later
+// reuse, get ErrRefreshTokenReused and revoke the whole family, since a
+// token used twice may have been stolen.
+func (r *RefreshTokenRepository) Rotate(ctx context.Context, oldID uuid.UUID, next *models.RefreshToken, now time.Time) error {
+	reused := false
+	err := database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		var old models.RefreshToken
+		err := tx.QueryRow(ctx, database.Qualify(`
+			SELECT id, user_id, family_id, expires_at, used_at, revoked_at
+			FROM {auth}.refresh_tokens
+			WHERE id = $1
+			FOR UPDATE
+		`), oldID).Scan(&old.ID, &old.UserID, &old.FamilyID, &old.ExpiresAt, &old.UsedAt, &old.RevokedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrRefreshTokenNotFound
+			}
+			return err
+		}
+
+		if old.RevokedAt != nil || !now.Before(old.ExpiresAt) {
+			return ErrRefreshTokenNotFound
+		}
+
+		if old.UsedAt != nil {
+			// Committed so the revocation sticks, reported below
+			reused = true
+			_, err := tx.Exec(ctx, database.Qualify(`
+				UPDATE {auth}.refresh_tokens
+				SET revoked_at = $2
+				WHERE family_id = $1 AND revoked_at IS NULL
+			`), old.FamilyID, now)
+			return err
+		}
+
+		_, err = tx.Exec(ctx, database.Qualify(`UPDATE {auth}.refresh_tokens SET used_at = $2 WHERE id = $1`), old.ID, now)
+		if err != nil {
+			return err
+		}
+
+		next.UserID = old.UserID
+		next.FamilyID = old.FamilyID
+		return insertRefreshToken(ctx, tx, next)
+	})
+	if err != nil {
+		return err
+	}
+	if reused {
+		return ErrRefreshTokenReused
+	}
+
+	return nil
+}
+
+// RevokeFamily revokes the token with the given ID and every token in its
+// family, e.g. on logout.
+func (r *RefreshTokenRepository) RevokeFamily(ctx context.Context, id uuid.UUID) error {
+	query := database.Qualify(`
+		UPDATE {auth}.refresh_tokens
+		SET revoked_at = NOW()
+		WHERE revoked_at IS NULL
+		  AND family_id = (SELECT family_id FROM {auth}.refresh_tokens WHERE id = $1)
+	`)
+
+	_, err := r.db.Exec(ctx, query, id)
+	return err
+}
+
+func insertRefreshToken(ctx context.Context, db dbtx, token *models.RefreshToken) error {
+	return db.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {auth}.refresh_tokens (id, user_id, family_id, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING created_at
+	`), token.ID, token.UserID, token.FamilyID, token.ExpiresAt).Scan(&token.CreatedAt)
+}
@@ -0,0 +1,49 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+)
+
+// RevokedTokenRepository records the jti of signed tokens revoked before
+// they expire. It implements services.TokenStore.
+type RevokedTokenRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewRevokedTokenRepository(db *pgxpool.Pool) *RevokedTokenRepository {
+	return &RevokedTokenRepository{db: db}
+}
+
+// Revoke records jti as revoked for ttl, after which the token has expired
+// and the record may be pruned. Revoking a token twice extends its record.
+func (r *RevokedTokenRepository) Revoke(ctx context.Context, jti string, ttl time.Duration) error {
+	_, err := r.db.Exec(ctx, database.Qualify(`
+		INSERT INTO {auth}.revoked_tokens AS t (jti, expires_at)
+		VALUES ($1, $2)
+		ON CONFLICT (jti) DO UPDATE SET expires_at = GREATEST(t.expires_at, EXCLUDED.expires_at)
+	`), jti, time.Now().Add(ttl))
+	return err
+}
+
+// IsRevoked reports whether jti was revoked.
+func (r *RevokedTokenRepository) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	var revoked bool
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		SELECT EXISTS (SELECT 1 FROM {auth}.revoked_tokens WHERE jti = $1)
+	`), jti).Scan(&revoked)
+	return revoked, err
+}
+
+// DeleteExpired forgets the revoked tokens that have expired since and
+// returns how many there were.
+func (r *RevokedTokenRepository) DeleteExpired(ctx context.Context) (int64, error) {
+	tag, err := r.db.Exec(ctx, database.Qualify(`DELETE FROM {auth}.revoked_tokens WHERE expires_at < NOW()`))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
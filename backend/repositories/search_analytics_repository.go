@@ -0,0 +1,83 @@
+package repositories
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+type SearchAnalyticsRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewSearchAnalyticsRepository(db *pgxpool.Pool) *SearchAnalyticsRepository {
+	return &SearchAnalyticsRepository{db: db}
+}
+
+// Upsert adds the counts in stats to the stored totals, creating rows for
+// queries seen for the first time.
+func (r *SearchAnalyticsRepository) Upsert(ctx context.Context, stats []*models.SearchQueryStat) error {
+	query := database.Qualify(`
+		INSERT INTO {blog}.search_analytics (query_normalized, count, zero_result_count, last_searched_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (query_normalized) DO UPDATE
+		SET count = search_analytics.count + EXCLUDED.count,
+			zero_result_count = search_analytics.zero_result_count + EXCLUDED.zero_result_count,
+			last_searched_at = GREATEST(search_analytics.last_searched_at, EXCLUDED.last_searched_at)
+	`)
+
+	for _, stat := range stats {
+		if _, err := r.db.Exec(ctx, query, stat.Query, stat.Count, stat.ZeroResultCount, stat.LastSearchedAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// TopQueries returns the most frequently searched queries.
+func (r *SearchAnalyticsRepository) TopQueries(ctx context.Context, limit int) ([]*models.SearchQueryStat, error) {
+	return r.list(ctx, database.Qualify(`
+		SELECT query_normalized, count, zero_result_count, last_searched_at
+		FROM {blog}.search_analytics
+		ORDER BY count DESC, last_searched_at DESC
+		LIMIT $1
+	`), limit)
+}
+
+// ZeroResultQueries returns queries that have never found anything, most
+// frequent first. These point at content the site is missing.
+func (r *SearchAnalyticsRepository) ZeroResultQueries(ctx context.Context, limit int) ([]*models.SearchQueryStat, error) {
+	return r.list(ctx, database.Qualify(`
+		SELECT query_normalized, count, zero_result_count, last_searched_at
+		FROM {blog}.search_analytics
+		WHERE zero_result_count = count
+		ORDER BY count DESC, last_searched_at DESC
+		LIMIT $1
+	`), limit)
+}
+
+func (r *SearchAnalyticsRepository) list(ctx context.Context, query string, limit int) ([]*models.SearchQueryStat, error) {
+	rows, err := r.db.Query(ctx, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := []*models.SearchQueryStat{}
+	for rows.Next() {
+		var stat models.SearchQueryStat
+		if err := rows.Scan(&stat.Query, &stat.Count, &stat.ZeroResultCount, &stat.LastSearchedAt); err != nil {
+			return nil, err
+		}
+		stats = append(stats, &stat)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// SiteSettingRepository reads and writes the key-value site settings store.
+type SiteSettingRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewSiteSettingRepository(db *pgxpool.Pool) *SiteSettingRepository {
+	return &SiteSettingRepository{db: db}
+}
+
+// GetAll returns every setting by key.
+func (r *SiteSettingRepository) GetAll(ctx context.Context) (map[string]*models.SiteSetting, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT id, key, value, created_at, updated_at
+		FROM {cms}.site_settings
+	`))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	settings := map[string]*models.SiteSetting{}
+	for rows.Next() {
+		var setting models.SiteSetting
+		var valueJSON []byte
+		if err := rows.Scan(&setting.ID, &setting.Key, &valueJSON, &setting.CreatedAt, &setting.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if valueJSON != nil {
+			if err := json.Unmarshal(valueJSON, &setting.Value); err != nil {
+				return nil, err
+			}
+		}
+		settings[setting.Key] = &setting
+	}
+
+	return settings, rows.Err()
+}
+
+// Set stores the setting's value, creating the setting if it does not exist
+// yet. A nil value is stored as NULL.
+func (r *SiteSettingRepository) Set(ctx context.Context, setting *models.SiteSetting) error {
+	var valueJSON []byte
+	if setting.Value != nil {
+		var err error
+		if valueJSON, err = json.Marshal(setting.Value); err != nil {
+			return err
+		}
+	}
+
+	return r.db.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {cms}.site_settings (key, value)
+		VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE
+		SET value = EXCLUDED.value, updated_at = NOW()
+		RETURNING id, created_at, updated_at
+	`), setting.Key, valueJSON).Scan(&setting.ID, &setting.CreatedAt, &setting.UpdatedAt)
+}
@@ -0,0 +1,211 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+type SubscriptionRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewSubscriptionRepository(db *pgxpool.Pool) *SubscriptionRepository {
+	return &SubscriptionRepository{db: db}
+}
+
+func (r *SubscriptionRepository) Create(ctx context.Context, sub *models.Subscription) error {
+	query := database.Qualify(`
+		INSERT INTO {shop}.subscriptions (customer_id, product_id, quantity, billing_interval, next_billing_at, status)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at, updated_at
+	`)
+
+	return r.db.QueryRow(ctx, query,
+		sub.CustomerID,
+		sub.ProductID,
+		sub.Quantity,
+		sub.Interval,
+		sub.NextBillingAt,
+		sub.Status,
+	).Scan(&sub.ID, &sub.CreatedAt, &sub.UpdatedAt)
+}
+
+func (r *SubscriptionRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Subscription, error) {
+	query := database.Qualify(`
+		SELECT id, customer_id, product_id, quantity, billing_interval, next_billing_at, status, created_at, updated_at
+		FROM {shop}.subscriptions
+		WHERE id = $1
+	`)
+
+	var sub models.Subscription
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&sub.ID,
+		&sub.CustomerID,
+		&sub.ProductID,
+		&sub.Quantity,
+		&sub.Interval,
+		&sub.NextBillingAt,
+		&sub.Status,
+		&sub.CreatedAt,
+		&sub.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &sub, nil
+}
+
+func (r *SubscriptionRepository) ListByCustomer(ctx context.Context, customerID uuid.UUID) ([]*models.Subscription, error) {
+	query := database.Qualify(`
+		SELECT id, customer_id, product_id, quantity, billing_interval, next_billing_at, status, created_at, updated_at
+		FROM {shop}.subscriptions
+		WHERE customer_id = $1
+		ORDER BY created_at DESC
+	`)
+
+	rows, err := r.db.Query(ctx, query, customerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanSubscriptions(rows)
+}
+
+// List returns a page of subscriptions, optionally filtered by status, along
+// with the total number of matching rows.
+func (r *SubscriptionRepository) List(ctx context.Context, status string, limit, offset int) ([]*models.Subscription, int, error) {
+	query := database.Qualify(`
+		SELECT id, customer_id, product_id, quantity, billing_interval, next_billing_at, status, created_at, updated_at
+		FROM {shop}.subscriptions
+	`)
+	countQuery := database.Qualify(`SELECT COUNT(*) FROM {shop}.subscriptions`)
+
+	args := []interface{}{}
+	if status != "" {
+		query += " WHERE status = $1"
+		countQuery += " WHERE status = $1"
+		args = append(args, status)
+	}
+
+	var total int
+	if err := r.db.QueryRow(ctx, countQuery, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	query += fmt.Sprintf(" ORDER BY created_at DESC LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	subs, err := scanSubscriptions(rows)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return subs, total, nil
+}
+
+// ListDue returns active subscriptions whose next billing date has passed,
+// with the product price and customer addresses needed to place the order.
+func (r *SubscriptionRepository) ListDue(ctx context.Context, now time.Time) ([]*models.Subscription, error) {
+	query := database.Qualify(`
+		SELECT s.id, s.customer_id, s.product_id, s.quantity, s.billing_interval, s.next_billing_at,
+			   s.status, s.created_at, s.updated_at,
+			   p.name, p.price, p.sale_price,
+			   c.shipping_address, c.billing_address
+		FROM {shop}.subscriptions s
+		JOIN {shop}.products p ON s.product_id = p.id
+		JOIN {shop}.customers c ON s.customer_id = c.id
+		WHERE s.status = 'active' AND s.next_billing_at <= $1
+		ORDER BY s.next_billing_at ASC
+	`)
+
+	rows, err := r.db.Query(ctx, query, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []*models.Subscription{}
+	for rows.Next() {
+		var sub models.Subscription
+		product := models.Product{}
+		customer := models.Customer{}
+		if err := rows.Scan(
+			&sub.ID, &sub.CustomerID, &sub.ProductID, &sub.Quantity, &sub.Interval, &sub.NextBillingAt,
+			&sub.Status, &sub.CreatedAt, &sub.UpdatedAt,
+			&product.Name, &product.Price, &product.SalePrice,
+			&customer.ShippingAddress, &customer.BillingAddress,
+		); err != nil {
+			return nil, err
+		}
+
+		product.ID = sub.ProductID
+		customer.ID = sub.CustomerID
+		sub.Product = &product
+		sub.Customer = &customer
+		subs = append(subs, &sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
+
+func (r *SubscriptionRepository) UpdateStatus(ctx context.Context, id uuid.UUID, status string) error {
+	query := database.Qualify(`
+		UPDATE {shop}.subscriptions
+		SET status = $1
+		WHERE id = $2
+	`)
+
+	_, err := r.db.Exec(ctx, query, status, id)
+	return err
+}
+
+func scanSubscriptions(rows pgx.Rows) ([]*models.Subscription, error) {
+	subs := []*models.Subscription{}
+	for rows.Next() {
+		var sub models.Subscription
+		if err := rows.Scan(
+			&sub.ID,
+			&sub.CustomerID,
+			&sub.ProductID,
+			&sub.Quantity,
+			&sub.Interval,
+			&sub.NextBillingAt,
+			&sub.Status,
+			&sub.CreatedAt,
+			&sub.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		subs = append(subs, &sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return subs, nil
+}
@@ -0,0 +1,59 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+type TagRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewTagRepository(db *pgxpool.Pool) *TagRepository {
+	return &TagRepository{db: db}
+}
+
+// CreateBatch inserts the tags in one statement and returns the ones it
+// created. Tags whose name or slug is already taken, including by an
+// earlier tag of the same batch, are skipped.
+func (r *TagRepository) CreateBatch(ctx context.Context, tags []*models.Tag) ([]*models.Tag, error) {
+	created := []*models.Tag{}
+	if len(tags) == 0 {
+		return created, nil
+	}
+
+	values := make([]string, len(tags))
+	args := make([]interface{}, 0, len(tags)*2)
+	for i, tag := range tags {
+		values[i] = fmt.Sprintf("($%d, $%d)", len(args)+1, len(args)+2)
+		args = append(args, tag.Name, tag.Slug)
+	}
+
+	// A bare ON CONFLICT also covers the unique name, which would otherwise
+	// fail the whole batch
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		INSERT INTO {blog}.tags (name, slug)
+		VALUES `+strings.Join(values, ", ")+`
+		ON CONFLICT DO NOTHING
+		RETURNING id, name, slug, created_at, updated_at
+	`), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tag models.Tag
+		if err := rows.Scan(&tag.ID, &tag.Name, &tag.Slug, &tag.CreatedAt, &tag.UpdatedAt); err != nil {
+			return nil, err
+		}
+		created = append(created, &tag)
+	}
+
+	return created, rows.Err()
+}
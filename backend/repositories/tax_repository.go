@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var (
+	ErrTaxRateNotFound = errors.New("tax rate not found")
+	ErrTaxRateExists   = errors.New("a tax rate for this country, region and postcode already exists")
+)
+
+// TaxRepository stores the tax rates orders are charged by shipping
+// address.
+type TaxRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewTaxRepository(db *pgxpool.Pool) *TaxRepository {
+	return &TaxRepository{db: db}
+}
+
+// List returns every tax rate, the default first, then by country, region
+// and postcode.
+func (r *TaxRepository) List(ctx context.Context) ([]*models.TaxRate, error) {
+	return r.query(ctx, database.Qualify(`
+		SELECT id, country, region, postcode, rate, is_inclusive, created_at, updated_at
+		FROM {shop}.tax_rates
+		ORDER BY country, region, postcode
+	`))
+}
+
+// ListForCountry returns the rates that can apply to an address in the
+// country: the country's own and the default.
+func (r *TaxRepository) ListForCountry(ctx context.Context, country string) ([]*models.TaxRate, error) {
+	return r.query(ctx, database.Qualify(`
+		SELECT id, country, region, postcode, rate, is_inclusive, created_at, updated_at
+		FROM {shop}.tax_rates
+		WHERE country = UPPER($1) OR country = ''
+	`), country)
+}
+
+func (r *TaxRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.TaxRate, error) {
+	rates, err := r.query(ctx, database.Qualify(`
+		SELECT id, country, region, postcode, rate, is_inclusive, created_at, updated_at
+		FROM {shop}.tax_rates
+		WHERE id = $1
+	`), id)
+	if err != nil || len(rates) == 0 {
+		return nil, err
+	}
+	return rates[0], nil
+}
+
+func (r *TaxRepository) Create(ctx context.Context, rate *models.TaxRate) error {
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {shop}.tax_rates (country, region, postcode, rate, is_inclusive)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at, updated_at
+	`), rate.Country, rate.Region, rate.Postcode, rate.Rate, rate.IsInclusive).
+		Scan(&rate.ID, &rate.CreatedAt, &rate.UpdatedAt)
+	return taxRateWriteError(err)
+}
+
+// Update saves the rate, returning ErrTaxRateNotFound if it does not exist.
+func (r *TaxRepository) Update(ctx context.Context, rate *models.TaxRate) error {
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		UPDATE {shop}.tax_rates
+		SET country = $1, region = $2, postcode = $3, rate = $4, is_inclusive = $5, updated_at = NOW()
+		WHERE id = $6
+		RETURNING created_at, updated_at
+	`), rate.Country, rate.Region, rate.Postcode, rate.Rate, rate.IsInclusive, rate.ID).
+		Scan(&rate.CreatedAt, &rate.UpdatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrTaxRateNotFound
+	}
+	return taxRateWriteError(err)
+}
+
+func (r *TaxRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`DELETE FROM {shop}.tax_rates WHERE id = $1`), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrTaxRateNotFound
+	}
+	return nil
+}
+
+func (r *TaxRepository) query(ctx context.Context, query string, args ...interface{}) ([]*models.TaxRate, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []*models.TaxRate{}
+	for rows.Next() {
+		var rate models.TaxRate
+		if err := rows.Scan(
+			&rate.ID, &rate.Country, &rate.Region, &rate.Postcode, &rate.Rate, &rate.IsInclusive,
+			&rate.CreatedAt, &rate.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		rates = append(rates, &rate)
+	}
+
+	return rates, rows.Err()
+}
+
+// taxRateWriteError maps a duplicate country, region and postcode to
+// ErrTaxRateExists.
+func taxRateWriteError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return ErrTaxRateExists
+	}
+	return err
+}
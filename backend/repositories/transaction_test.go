@@ -0,0 +1,46 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+)
+
+// A panic inside a real transaction undoes its writes and hands the
+// connection back to the pool.
+func TestWithTransactionPanicLeavesNoDanglingTransaction(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	path := "/" + dbtest.UniqueName("panic")
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("the panic was swallowed")
+			}
+		}()
+		database.WithTransaction(ctx, pool, nil, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, database.Qualify(`
+				INSERT INTO {cms}.redirects (from_path, to_path) VALUES ($1, '/')
+			`), path); err != nil {
+				t.Errorf("insert: %v", err)
+			}
+			panic("boom")
+		})
+	}()
+
+	if acquired := pool.Stat().AcquiredConns(); acquired != 0 {
+		t.Errorf("%d connections still acquired after the panic", acquired)
+	}
+
+	redirect, err := NewRedirectRepository(pool).GetByFromPath(ctx, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if redirect != nil {
+		t.Error("the insert made before the panic was committed")
+	}
+}
@@ -3,27 +3,36 @@ package repositories
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
-	"github.com/yourusername/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	// ErrLastAdmin is returned when a role change would leave no admin.
+	ErrLastAdmin = errors.New("cannot demote the last admin")
 )
 
 type UserRepository struct {
-	db *pgxpool.Pool
+	db      *pgxpool.Pool
+	tracker *database.TransactionTracker
 }
 
-func NewUserRepository(db *pgxpool.Pool) *UserRepository {
-	return &UserRepository{db: db}
+func NewUserRepository(db *pgxpool.Pool, tracker *database.TransactionTracker) *UserRepository {
+	return &UserRepository{db: db, tracker: tracker}
 }
 
 func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
-	query := `
-		INSERT INTO auth.users (email, password_hash, full_name, role, avatar_url)
-		VALUES ($1, $2, $3, $4, $5)
+	query := database.Qualify(`
+		INSERT INTO {auth}.users (email, password_hash, full_name, role, avatar_url, oauth_provider, oauth_subject)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''))
 		RETURNING id, created_at, updated_at
-	`
+	`)
 
 	return r.db.QueryRow(ctx, query,
 		user.Email,
@@ -31,15 +40,20 @@ func (r *UserRepository) Create(ctx context.Context, user *models.User) error {
 		user.FullName,
 		user.Role,
 		user.AvatarURL,
+		user.OAuthProvider,
+		user.OAuthSubject,
 	).Scan(&user.ID, &user.CreatedAt, &user.UpdatedAt)
 }
 
+// GetByID returns the user, or nil. Deleted users are not returned, here or
+// by any other lookup or list but ListDeleted, so they cannot sign in.
 func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.User, error) {
-	query := `
-		SELECT id, email, password_hash, full_name, role, avatar_url, created_at, updated_at
-		FROM auth.users
-		WHERE id = $1
-	`
+	query := database.Qualify(`
+		SELECT id, email, password_hash, full_name, role, COALESCE(avatar_url, ''),
+			   COALESCE(oauth_provider, ''), COALESCE(oauth_subject, ''), created_at, updated_at
+		FROM {auth}.users
+		WHERE id = $1 AND deleted_at IS NULL
+	`)
 
 	var user models.User
 	err := r.db.QueryRow(ctx, query, id).Scan(
@@ -49,6 +63,8 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 		&user.FullName,
 		&user.Role,
 		&user.AvatarURL,
+		&user.OAuthProvider,
+		&user.OAuthSubject,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -63,12 +79,57 @@ func (r *UserRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Use
 	return &user, nil
 }
 
+// GetByIDs returns the users with the given IDs, keyed by ID. IDs without a
+// user are simply absent from the map.
+func (r *UserRepository) GetByIDs(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]*models.User, error) {
+	users := make(map[uuid.UUID]*models.User, len(ids))
+	if len(ids) == 0 {
+		return users, nil
+	}
+
+	query := database.Qualify(`
+		SELECT id, email, password_hash, full_name, role, COALESCE(avatar_url, ''), created_at, updated_at
+		FROM {auth}.users
+		WHERE id = ANY($1) AND deleted_at IS NULL
+	`)
+
+	rows, err := r.db.Query(ctx, query, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.PasswordHash,
+			&user.FullName,
+			&user.Role,
+			&user.AvatarURL,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		users[user.ID] = &user
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return users, nil
+}
+
 func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
-	query := `
-		SELECT id, email, password_hash, full_name, role, avatar_url, created_at, updated_at
-		FROM auth.users
-		WHERE email = $1
-	`
+	query := database.Qualify(`
+		SELECT id, email, password_hash, full_name, role, COALESCE(avatar_url, ''),
+			   COALESCE(oauth_provider, ''), COALESCE(oauth_subject, ''), created_at, updated_at
+		FROM {auth}.users
+		WHERE email = $1 AND deleted_at IS NULL
+	`)
 
 	var user models.User
 	err := r.db.QueryRow(ctx, query, email).Scan(
@@ -78,6 +139,42 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 		&user.FullName,
 		&user.Role,
 		&user.AvatarURL,
+		&user.OAuthProvider,
+		&user.OAuthSubject,
+		&user.CreatedAt,
+		&user.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+// GetByOAuthSubject returns the user who signed up with the given account
+// at the provider, or nil if there is none.
+func (r *UserRepository) GetByOAuthSubject(ctx context.Context, provider, subject string) (*models.User, error) {
+	query := database.Qualify(`
+		SELECT id, email, password_hash, full_name, role, COALESCE(avatar_url, ''),
+			   oauth_provider, oauth_subject, created_at, updated_at
+		FROM {auth}.users
+		WHERE oauth_provider = $1 AND oauth_subject = $2 AND deleted_at IS NULL
+	`)
+
+	var user models.User
+	err := r.db.QueryRow(ctx, query, provider, subject).Scan(
+		&user.ID,
+		&user.Email,
+		&user.PasswordHash,
+		&user.FullName,
+		&user.Role,
+		&user.AvatarURL,
+		&user.OAuthProvider,
+		&user.OAuthSubject,
 		&user.CreatedAt,
 		&user.UpdatedAt,
 	)
@@ -93,12 +190,12 @@ func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*models.
 }
 
 func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
-	query := `
-		UPDATE auth.users
+	query := database.Qualify(`
+		UPDATE {auth}.users
 		SET email = $1, full_name = $2, role = $3, avatar_url = $4
 		WHERE id = $5
 		RETURNING updated_at
-	`
+	`)
 
 	return r.db.QueryRow(ctx, query,
 		user.Email,
@@ -109,42 +206,215 @@ func (r *UserRepository) Update(ctx context.Context, user *models.User) error {
 	).Scan(&user.UpdatedAt)
 }
 
+// UpdateRole changes the user's role and records the change in the audit log.
+// Demoting an admin fails with ErrLastAdmin if no other admin remains; the
+// admins are locked while counting, so two concurrent demotions cannot both
+// pass the check.
+func (r *UserRepository) UpdateRole(ctx context.Context, id uuid.UUID, role string, actorID uuid.UUID) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		var oldRole string
+		err := tx.QueryRow(ctx, database.Qualify(`SELECT role FROM {auth}.users WHERE id = $1 AND deleted_at IS NULL FOR UPDATE`), id).Scan(&oldRole)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				return ErrUserNotFound
+			}
+			return err
+		}
+		if oldRole == role {
+			return nil
+		}
+
+		if oldRole == "admin" {
+			var admins int
+			err := tx.QueryRow(ctx, database.Qualify(`
+				SELECT COUNT(*) FROM (
+					SELECT id FROM {auth}.users WHERE role = 'admin' AND deleted_at IS NULL FOR UPDATE
+				) admins
+			`)).Scan(&admins)
+			if err != nil {
+				return err
+			}
+			if admins <= 1 {
+				return ErrLastAdmin
+			}
+		}
+
+		_, err = tx.Exec(ctx, database.Qualify(`UPDATE {auth}.users SET role = $1 WHERE id = $2`), role, id)
+		if err != nil {
+			return err
+		}
+
+		return insertAuditLog(ctx, tx, &models.AuditLog{
+			ActorID:    nullableUUID(actorID),
+			Action:     "user.role_change",
+			EntityType: "user",
+			EntityID:   id.String(),
+			Details: map[string]interface{}{
+				"from": oldRole,
+				"to":   role,
+			},
+		})
+	})
+}
+
+// UpdateAvatar sets the user's avatar URL. An empty URL removes it.
+func (r *UserRepository) UpdateAvatar(ctx context.Context, id uuid.UUID, avatarURL string) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`UPDATE {auth}.users SET avatar_url = NULLIF($1, '') WHERE id = $2`), avatarURL, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
 func (r *UserRepository) UpdatePassword(ctx context.Context, id uuid.UUID, passwordHash string) error {
-	query := `
-		UPDATE auth.users
+	query := database.Qualify(`
+		UPDATE {auth}.users
 		SET password_hash = $1
 		WHERE id = $2
-	`
+	`)
 
 	_, err := r.db.Exec(ctx, query, passwordHash, id)
 	return err
 }
 
+// Delete marks the user deleted, hiding them from every lookup and list but
+// ListDeleted. Their row stays, with their orders and posts, so Restore
+// brings them back as they were. A user who does not exist or is already
+// deleted yields ErrUserNotFound.
 func (r *UserRepository) Delete(ctx context.Context, id uuid.UUID) error {
-	query := `
-		DELETE FROM auth.users
-		WHERE id = $1
-	`
+	tag, err := r.db.Exec(ctx, database.Qualify(`
+		UPDATE {auth}.users SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL
+	`), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
 
-	_, err := r.db.Exec(ctx, query, id)
-	return err
+// Restore undoes Delete. A user who does not exist or is not deleted
+// yields ErrUserNotFound.
+func (r *UserRepository) Restore(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`
+		UPDATE {auth}.users SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL
+	`), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrUserNotFound
+	}
+	return nil
 }
 
-func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*models.User, error) {
-	query := `
-		SELECT id, email, password_hash, full_name, role, avatar_url, created_at, updated_at
-		FROM auth.users
-		ORDER BY created_at DESC
+// ListDeleted returns a page of the deleted users, most recently deleted
+// first, together with the total number of deleted users.
+func (r *UserRepository) ListDeleted(ctx context.Context, limit, offset int) ([]*models.User, int, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT id, email, password_hash, full_name, role, COALESCE(avatar_url, ''), deleted_at, created_at, updated_at,
+			   COUNT(*) OVER()
+		FROM {auth}.users
+		WHERE deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC, id
 		LIMIT $1 OFFSET $2
-	`
-
-	rows, err := r.db.Query(ctx, query, limit, offset)
+	`), limit, offset)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 	defer rows.Close()
 
+	users := []*models.User{}
+	total := 0
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(
+			&user.ID,
+			&user.Email,
+			&user.PasswordHash,
+			&user.FullName,
+			&user.Role,
+			&user.AvatarURL,
+			&user.DeletedAt,
+			&user.CreatedAt,
+			&user.UpdatedAt,
+			&total,
+		); err != nil {
+			return nil, 0, err
+		}
+		users = append(users, &user)
+	}
+
+	return users, total, rows.Err()
+}
+
+// userSearchThreshold is the minimum word similarity for a fuzzy user match.
+const userSearchThreshold = 0.3
+
+// List returns a page of users, newest first, together with the total count.
+// A non-empty search fuzzy-matches names and emails with pg_trgm, best
+// matches first.
+func (r *UserRepository) List(ctx context.Context, search string, limit, offset int) ([]*models.User, int, error) {
+	if search == "" {
+		query := database.Qualify(`
+			SELECT id, email, password_hash, full_name, role, COALESCE(avatar_url, ''), created_at, updated_at,
+				   COUNT(*) OVER()
+			FROM {auth}.users
+			WHERE deleted_at IS NULL
+			ORDER BY created_at DESC
+			LIMIT $1 OFFSET $2
+		`)
+
+		rows, err := r.db.Query(ctx, query, limit, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		return scanUserPage(rows)
+	}
+
+	// word_similarity rather than similarity so that a name typed with a typo
+	// still scores well against the much longer "name email" document. The
+	// <% operator can use the trigram index but reads its threshold from a
+	// setting, so it is set for this transaction only.
 	var users []*models.User
+	var total int
+	err := database.WithTransaction(ctx, r.db, nil, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, fmt.Sprintf("SET LOCAL pg_trgm.word_similarity_threshold = %v", userSearchThreshold)); err != nil {
+			return err
+		}
+
+		query := database.Qualify(`
+			SELECT id, email, password_hash, full_name, role, COALESCE(avatar_url, ''), created_at, updated_at,
+				   COUNT(*) OVER()
+			FROM {auth}.users
+			WHERE deleted_at IS NULL AND $1 <% (full_name || ' ' || email)
+			ORDER BY word_similarity($1, full_name || ' ' || email) DESC, created_at DESC
+			LIMIT $2 OFFSET $3
+		`)
+
+		rows, err := tx.Query(ctx, query, search, limit, offset)
+		if err != nil {
+			return err
+		}
+		users, total, err = scanUserPage(rows)
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+func scanUserPage(rows pgx.Rows) ([]*models.User, int, error) {
+	defer rows.Close()
+
+	users := []*models.User{}
+	total := 0
 	for rows.Next() {
 		var user models.User
 		if err := rows.Scan(
@@ -156,26 +426,55 @@ func (r *UserRepository) List(ctx context.Context, limit, offset int) ([]*models
 			&user.AvatarURL,
 			&user.CreatedAt,
 			&user.UpdatedAt,
+			&total,
 		); err != nil {
-			return nil, err
+			return nil, 0, err
 		}
 		users = append(users, &user)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	return users, nil
+	return users, total, nil
 }
 
-func (r *UserRepository) Count(ctx context.Context) (int, error) {
-	query := `
+// Count returns the number of users, only counting those with the given
+// role unless it is empty.
+func (r *UserRepository) Count(ctx context.Context, role string) (int, error) {
+	query := database.Qualify(`
 		SELECT COUNT(*)
-		FROM auth.users
-	`
+		FROM {auth}.users
+		WHERE deleted_at IS NULL AND ($1 = '' OR role = $1)
+	`)
 
 	var count int
-	err := r.db.QueryRow(ctx, query).Scan(&count)
+	err := r.db.QueryRow(ctx, query, role).Scan(&count)
 	return count, err
-}
\ No newline at end of file
+}
+
+// GetPermissions returns the permissions granted to the user, sorted.
+func (r *UserRepository) GetPermissions(ctx context.Context, userID uuid.UUID) ([]string, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT permission
+		FROM {auth}.user_permissions
+		WHERE user_id = $1
+		ORDER BY permission
+	`), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []string{}
+	for rows.Next() {
+		var permission string
+		if err := rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
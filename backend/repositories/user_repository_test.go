@@ -0,0 +1,105 @@
+package repositories
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// A name typed with a typo still finds the user, while the email lookup
+// only matches exactly.
+func TestUserSearch(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewUserRepository(pool, nil)
+
+	alice := &models.User{
+		Email:        dbtest.UniqueName("alice") + "@example.com",
+		PasswordHash: "x",
+		FullName:     "Alice Liddell",
+		Role:         "customer",
+	}
+	if err := repo.Create(ctx, alice); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.users WHERE id = $1"), alice.ID)
+	})
+
+	var similarity float64
+	if err := pool.QueryRow(ctx, "SELECT word_similarity('alce', $1)", alice.FullName+" "+alice.Email).Scan(&similarity); err != nil {
+		t.Fatal(err)
+	}
+	if similarity <= userSearchThreshold {
+		t.Errorf("word_similarity(alce) = %v, want above %v", similarity, userSearchThreshold)
+	}
+
+	users, _, err := repo.List(ctx, "alce", 100, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, user := range users {
+		found = found || user.ID == alice.ID
+	}
+	if !found {
+		t.Errorf("List(alce) = %d users without Alice", len(users))
+	}
+
+	if got, err := repo.GetByEmail(ctx, alice.Email); err != nil || got == nil || got.ID != alice.ID {
+		t.Errorf("GetByEmail = %v, %v; want Alice", got, err)
+	}
+	if got, err := repo.GetByEmail(ctx, "alice"); err != nil || got != nil {
+		t.Errorf("GetByEmail(alice) = %v, %v; want nil", got, err)
+	}
+}
+
+func TestUserGetByIDs(t *testing.T) {
+	// Empty input runs no query, so no database is needed for it
+	users, err := NewUserRepository(nil, nil).GetByIDs(context.Background(), nil)
+	if err != nil || users == nil || len(users) != 0 {
+		t.Errorf("GetByIDs(nil) = %v, %v; want an empty map", users, err)
+	}
+
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewUserRepository(pool, nil)
+
+	var found []uuid.UUID
+	for i := 0; i < 2; i++ {
+		user := &models.User{
+			Email:        dbtest.UniqueName("batch") + "@example.com",
+			PasswordHash: "x",
+			FullName:     "Test User",
+			Role:         "customer",
+		}
+		if err := repo.Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.users WHERE id = $1"), user.ID)
+		})
+		found = append(found, user.ID)
+	}
+
+	missing := uuid.New()
+	users, err = repo.GetByIDs(ctx, []uuid.UUID{found[0], missing, found[1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 {
+		t.Errorf("GetByIDs = %d users, want 2", len(users))
+	}
+	for _, id := range found {
+		if users[id] == nil || users[id].ID != id {
+			t.Errorf("users[%s] = %v, want the user", id, users[id])
+		}
+	}
+	if _, ok := users[missing]; ok {
+		t.Errorf("GetByIDs returned an entry for the missing ID")
+	}
+}
@@ -0,0 +1,208 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+type VendorRepository struct {
+	db      *pgxpool.Pool
+	tracker *database.TransactionTracker
+}
+
+func NewVendorRepository(db *pgxpool.Pool, tracker *database.TransactionTracker) *VendorRepository {
+	return &VendorRepository{db: db, tracker: tracker}
+}
+
+func (r *VendorRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.Vendor, error) {
+	query := database.Qualify(`
+		SELECT id, user_id, name, slug, commission_rate, bank_account, status, created_at, updated_at
+		FROM {shop}.vendors
+		WHERE id = $1
+	`)
+
+	var vendor models.Vendor
+	err := r.db.QueryRow(ctx, query, id).Scan(
+		&vendor.ID,
+		&vendor.UserID,
+		&vendor.Name,
+		&vendor.Slug,
+		&vendor.CommissionRate,
+		&vendor.BankAccount,
+		&vendor.Status,
+		&vendor.CreatedAt,
+		&vendor.UpdatedAt,
+	)
+
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return &vendor, nil
+}
+
+// GetByProductIDs returns the vendor of each given product, keyed by product
+// ID. Products sold by the platform itself are absent from the map.
+func (r *VendorRepository) GetByProductIDs(ctx context.Context, productIDs []uuid.UUID) (map[uuid.UUID]*models.Vendor, error) {
+	query := database.Qualify(`
+		SELECT p.id, v.id, v.user_id, v.name, v.slug, v.commission_rate, v.bank_account, v.status,
+			   v.created_at, v.updated_at
+		FROM {shop}.products p
+		JOIN {shop}.vendors v ON p.vendor_id = v.id
+		WHERE p.id = ANY($1)
+	`)
+
+	rows, err := r.db.Query(ctx, query, productIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	vendors := map[uuid.UUID]*models.Vendor{}
+	for rows.Next() {
+		var productID uuid.UUID
+		var vendor models.Vendor
+		if err := rows.Scan(
+			&productID,
+			&vendor.ID,
+			&vendor.UserID,
+			&vendor.Name,
+			&vendor.Slug,
+			&vendor.CommissionRate,
+			&vendor.BankAccount,
+			&vendor.Status,
+			&vendor.CreatedAt,
+			&vendor.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		vendors[productID] = &vendor
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return vendors, nil
+}
+
+// recordPayouts stores the vendor and commission on each vendor-sold item
+// and inserts the matching payout rows within tx. The payouts are for the
+// vendor-sold items in order, as a PayoutSplitter returns them, and are
+// linked to the items by their position.
+func recordPayouts(ctx context.Context, tx pgx.Tx, items []*models.OrderItem, payouts []*models.VendorPayout) error {
+	var vendorItems []*models.OrderItem
+	for _, item := range items {
+		if item.VendorID != nil {
+			vendorItems = append(vendorItems, item)
+		}
+	}
+	if len(payouts) != len(vendorItems) {
+		return fmt.Errorf("got %d vendor payouts for %d vendor-sold items", len(payouts), len(vendorItems))
+	}
+
+	for _, item := range vendorItems {
+		_, err := tx.Exec(ctx, database.Qualify(`
+			UPDATE {shop}.order_items
+			SET vendor_id = $1, commission_amount = $2
+			WHERE id = $3
+		`), item.VendorID, item.CommissionAmount, item.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, payout := range payouts {
+		payout.OrderItemID = vendorItems[i].ID
+		err := tx.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.vendor_payouts (vendor_id, order_item_id, gross_amount, commission_amount, net_amount, status)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			RETURNING id, created_at, updated_at
+		`),
+			payout.VendorID,
+			payout.OrderItemID,
+			payout.GrossAmount,
+			payout.CommissionAmount,
+			payout.NetAmount,
+			payout.Status,
+		).Scan(&payout.ID, &payout.CreatedAt, &payout.UpdatedAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *VendorRepository) ListPayouts(ctx context.Context, vendorID uuid.UUID, limit, offset int) ([]*models.VendorPayout, int, error) {
+	query := database.Qualify(`
+		SELECT id, vendor_id, batch_id, order_item_id, gross_amount, commission_amount, net_amount, status,
+			   created_at, updated_at, COUNT(*) OVER()
+		FROM {shop}.vendor_payouts
+		WHERE vendor_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`)
+
+	rows, err := r.db.Query(ctx, query, vendorID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	payouts := []*models.VendorPayout{}
+	total := 0
+	for rows.Next() {
+		var payout models.VendorPayout
+		if err := rows.Scan(
+			&payout.ID,
+			&payout.VendorID,
+			&payout.BatchID,
+			&payout.OrderItemID,
+			&payout.GrossAmount,
+			&payout.CommissionAmount,
+			&payout.NetAmount,
+			&payout.Status,
+			&payout.CreatedAt,
+			&payout.UpdatedAt,
+			&total,
+		); err != nil {
+			return nil, 0, err
+		}
+		payouts = append(payouts, &payout)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return payouts, total, nil
+}
+
+// ReleasePendingPayouts marks every pending payout of the vendor as paid and
+// returns how many were released. Payouts already assigned to a batch are
+// left to the payout scheduler.
+func (r *VendorRepository) ReleasePendingPayouts(ctx context.Context, vendorID uuid.UUID) (int64, error) {
+	query := database.Qualify(`
+		UPDATE {shop}.vendor_payouts
+		SET status = 'paid'
+		WHERE vendor_id = $1 AND status = 'pending' AND batch_id IS NULL
+	`)
+
+	tag, err := r.db.Exec(ctx, query, vendorID)
+	if err != nil {
+		return 0, err
+	}
+
+	return tag.RowsAffected(), nil
+}
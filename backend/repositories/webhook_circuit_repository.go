@@ -0,0 +1,77 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// WebhookCircuitRepository stores the circuit breaker state of webhook
+// endpoints, so every worker sees the same state and it survives restarts.
+type WebhookCircuitRepository struct {
+	db      *pgxpool.Pool
+	tracker *database.TransactionTracker
+}
+
+func NewWebhookCircuitRepository(db *pgxpool.Pool, tracker *database.TransactionTracker) *WebhookCircuitRepository {
+	return &WebhookCircuitRepository{db: db, tracker: tracker}
+}
+
+// Get returns the endpoint's circuit, which is closed if it has none stored.
+func (r *WebhookCircuitRepository) Get(ctx context.Context, endpointID uuid.UUID) (*models.WebhookCircuit, error) {
+	return getWebhookCircuit(ctx, r.db, endpointID, false)
+}
+
+// Update runs fn on the endpoint's circuit and saves the result. The row is
+// locked while fn runs, so concurrent deliveries update it one at a time.
+func (r *WebhookCircuitRepository) Update(ctx context.Context, endpointID uuid.UUID, fn func(*models.WebhookCircuit)) error {
+	return database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, database.Qualify(`
+			INSERT INTO {cms}.webhook_circuits (endpoint_id) VALUES ($1)
+			ON CONFLICT DO NOTHING
+		`), endpointID)
+		if err != nil {
+			return err
+		}
+
+		circuit, err := getWebhookCircuit(ctx, tx, endpointID, true)
+		if err != nil {
+			return err
+		}
+
+		fn(circuit)
+
+		_, err = tx.Exec(ctx, database.Qualify(`
+			UPDATE {cms}.webhook_circuits
+			SET state = $1, consecutive_failures = $2, first_failure_at = $3, opened_at = $4
+			WHERE endpoint_id = $5
+		`), circuit.State, circuit.ConsecutiveFailures, circuit.FirstFailureAt, circuit.OpenedAt, endpointID)
+		return err
+	})
+}
+
+func getWebhookCircuit(ctx context.Context, db dbtx, endpointID uuid.UUID, forUpdate bool) (*models.WebhookCircuit, error) {
+	query := `
+		SELECT state, consecutive_failures, first_failure_at, opened_at, updated_at
+		FROM {cms}.webhook_circuits
+		WHERE endpoint_id = $1
+	`
+	if forUpdate {
+		query += " FOR UPDATE"
+	}
+
+	circuit := models.WebhookCircuit{EndpointID: endpointID, State: "closed"}
+	err := db.QueryRow(ctx, database.Qualify(query), endpointID).Scan(
+		&circuit.State, &circuit.ConsecutiveFailures, &circuit.FirstFailureAt, &circuit.OpenedAt, &circuit.UpdatedAt,
+	)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	return &circuit, nil
+}
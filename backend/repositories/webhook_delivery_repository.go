@@ -0,0 +1,229 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// WebhookDeliveryRepository stores the log of webhook delivery attempts.
+type WebhookDeliveryRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewWebhookDeliveryRepository(db *pgxpool.Pool) *WebhookDeliveryRepository {
+	return &WebhookDeliveryRepository{db: db}
+}
+
+func (r *WebhookDeliveryRepository) Create(ctx context.Context, delivery *models.WebhookDelivery) error {
+	return r.db.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {cms}.webhook_deliveries (endpoint_id, event_id, event, attempt, status_code, error, duration_ms, payload)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8)
+		RETURNING id, created_at
+	`),
+		delivery.EndpointID,
+		delivery.EventID,
+		delivery.Event,
+		delivery.Attempt,
+		delivery.StatusCode,
+		delivery.Error,
+		delivery.DurationMs,
+		[]byte(delivery.Payload),
+	).Scan(&delivery.ID, &delivery.CreatedAt)
+}
+
+// GetByID returns the delivery attempt with its payload, or nil.
+func (r *WebhookDeliveryRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.WebhookDelivery, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT `+deadLetterColumns+`
+		FROM {cms}.webhook_deliveries
+		WHERE id = $1
+	`), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return firstDeadLetter(rows)
+}
+
+// ListDeadLetters returns a page of the dead letters not yet retried, most
+// recent first, together with their total number. A dead letter is the
+// last attempt of a delivery that failed every attempt, the only attempt
+// that keeps its payload.
+func (r *WebhookDeliveryRepository) ListDeadLetters(ctx context.Context, limit, offset int) ([]*models.WebhookDelivery, int, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT `+deadLetterColumns+`, COUNT(*) OVER()
+		FROM {cms}.webhook_deliveries
+		WHERE payload IS NOT NULL AND retried_at IS NULL
+		ORDER BY created_at DESC, id
+		LIMIT $1 OFFSET $2
+	`), limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	return scanDeadLetters(rows, true)
+}
+
+// ClaimDeadLetter marks the dead letter retried and returns it, or returns
+// nil if there is no such dead letter or it was already retried, so that
+// it is only ever retried once.
+func (r *WebhookDeliveryRepository) ClaimDeadLetter(ctx context.Context, id uuid.UUID) (*models.WebhookDelivery, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		UPDATE {cms}.webhook_deliveries
+		SET retried_at = NOW()
+		WHERE id = $1 AND payload IS NOT NULL AND retried_at IS NULL
+		RETURNING `+deadLetterColumns+`
+	`), id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return firstDeadLetter(rows)
+}
+
+// ClaimDeadLettersForEndpoint marks up to limit of the endpoint's dead
+// letters retried, oldest first, and returns them. Dead letters claimed by
+// a concurrent call are skipped.
+func (r *WebhookDeliveryRepository) ClaimDeadLettersForEndpoint(ctx context.Context, endpointID uuid.UUID, limit int) ([]*models.WebhookDelivery, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		UPDATE {cms}.webhook_deliveries
+		SET retried_at = NOW()
+		WHERE id IN (
+			SELECT id
+			FROM {cms}.webhook_deliveries
+			WHERE endpoint_id = $1 AND payload IS NOT NULL AND retried_at IS NULL
+			ORDER BY created_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deadLetterColumns+`
+	`), endpointID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries, _, err := scanDeadLetters(rows, false)
+	return deliveries, err
+}
+
+// ReleaseDeadLetter makes a claimed dead letter retriable again, for when
+// the retry could not be made.
+func (r *WebhookDeliveryRepository) ReleaseDeadLetter(ctx context.Context, id uuid.UUID) error {
+	_, err := r.db.Exec(ctx, database.Qualify(`
+		UPDATE {cms}.webhook_deliveries SET retried_at = NULL WHERE id = $1
+	`), id)
+	return err
+}
+
+// ListForEndpoint returns a page of the endpoint's delivery attempts, most
+// recent first, together with the total number of attempts.
+func (r *WebhookDeliveryRepository) ListForEndpoint(ctx context.Context, endpointID uuid.UUID, limit, offset int) ([]*models.WebhookDelivery, int, error) {
+	rows, err := r.db.Query(ctx, database.Qualify(`
+		SELECT id, endpoint_id, event_id, event, attempt, status_code, COALESCE(error, ''), duration_ms, created_at,
+			   COUNT(*) OVER()
+		FROM {cms}.webhook_deliveries
+		WHERE endpoint_id = $1
+		ORDER BY created_at DESC, attempt DESC
+		LIMIT $2 OFFSET $3
+	`), endpointID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	deliveries := []*models.WebhookDelivery{}
+	total := 0
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		if err := rows.Scan(
+			&delivery.ID,
+			&delivery.EndpointID,
+			&delivery.EventID,
+			&delivery.Event,
+			&delivery.Attempt,
+			&delivery.StatusCode,
+			&delivery.Error,
+			&delivery.DurationMs,
+			&delivery.CreatedAt,
+			&total,
+		); err != nil {
+			return nil, 0, err
+		}
+		deliveries = append(deliveries, &delivery)
+	}
+
+	return deliveries, total, rows.Err()
+}
+
+// DeleteBefore forgets the attempts made before cutoff and returns how many
+// there were. Dead letters waiting to be retried are kept however old.
+func (r *WebhookDeliveryRepository) DeleteBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, database.Qualify(`
+		DELETE FROM {cms}.webhook_deliveries
+		WHERE created_at < $1 AND (payload IS NULL OR retried_at IS NOT NULL)
+	`), cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+const deadLetterColumns = `id, endpoint_id, event_id, event, attempt, status_code, COALESCE(error, ''), duration_ms,
+	payload, retried_at, created_at`
+
+// firstDeadLetter returns the first of the rows, or nil if there are none.
+func firstDeadLetter(rows pgx.Rows) (*models.WebhookDelivery, error) {
+	deliveries, _, err := scanDeadLetters(rows, false)
+	if err != nil || len(deliveries) == 0 {
+		return nil, err
+	}
+	return deliveries[0], nil
+}
+
+// scanDeadLetters reads rows of deadLetterColumns. When withTotal is set
+// each row carries a trailing COUNT(*) OVER() column.
+func scanDeadLetters(rows pgx.Rows, withTotal bool) ([]*models.WebhookDelivery, int, error) {
+	deliveries := []*models.WebhookDelivery{}
+	total := 0
+	for rows.Next() {
+		var delivery models.WebhookDelivery
+		var payload []byte
+		dest := []interface{}{
+			&delivery.ID,
+			&delivery.EndpointID,
+			&delivery.EventID,
+			&delivery.Event,
+			&delivery.Attempt,
+			&delivery.StatusCode,
+			&delivery.Error,
+			&delivery.DurationMs,
+			&payload,
+			&delivery.RetriedAt,
+			&delivery.CreatedAt,
+		}
+		if withTotal {
+			dest = append(dest, &total)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, 0, err
+		}
+		delivery.Payload = payload
+		deliveries = append(deliveries, &delivery)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	return deliveries, total, nil
+}
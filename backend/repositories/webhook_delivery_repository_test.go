@@ -0,0 +1,174 @@
+package repositories
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// createTestEndpoint creates an inactive webhook endpoint, so no
+// dispatcher running against the database sends to it. It and its
+// deliveries are deleted when the test ends.
+func createTestEndpoint(t *testing.T, pool *pgxpool.Pool) *models.WebhookEndpoint {
+	t.Helper()
+
+	endpoint := &models.WebhookEndpoint{
+		URL:             "https://hooks.example.com/" + dbtest.UniqueName("endpoint"),
+		Events:          []string{"order.created"},
+		SecretEncrypted: []byte("x"),
+	}
+	if err := NewWebhookEndpointRepository(pool).Create(context.Background(), endpoint); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.webhook_endpoints WHERE id = $1"), endpoint.ID)
+	})
+	return endpoint
+}
+
+// createTestDelivery records a failed attempt to send to the endpoint,
+// a dead letter if payload is set.
+func createTestDelivery(t *testing.T, repo *WebhookDeliveryRepository, endpointID uuid.UUID, payload string) *models.WebhookDelivery {
+	t.Helper()
+
+	delivery := &models.WebhookDelivery{
+		EndpointID: endpointID,
+		EventID:    uuid.New(),
+		Event:      "order.created",
+		Attempt:    5,
+		Error:      "connection refused",
+	}
+	if payload != "" {
+		delivery.Payload = []byte(payload)
+	}
+	if err := repo.Create(context.Background(), delivery); err != nil {
+		t.Fatal(err)
+	}
+	return delivery
+}
+
+// A dead letter is handed out by one claim only, however many retries of it
+// race, until it is released.
+func TestDeadLettersAreClaimedOnce(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewWebhookDeliveryRepository(pool)
+	endpoint := createTestEndpoint(t, pool)
+
+	create := func(payload string) *models.WebhookDelivery {
+		t.Helper()
+		return createTestDelivery(t, repo, endpoint.ID, payload)
+	}
+
+	attempt := create("")
+	if claimed, err := repo.ClaimDeadLetter(ctx, attempt.ID); err != nil || claimed != nil {
+		t.Errorf("claiming an attempt without a payload = %v, %v; want nothing", claimed, err)
+	}
+
+	deadLetter := create(`{"id":"1"}`)
+	const racers = 8
+	start := make(chan struct{})
+	claims := make([]*models.WebhookDelivery, racers)
+	errs := make([]error, racers)
+	var wg sync.WaitGroup
+	for i := 0; i < racers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			claims[i], errs[i] = repo.ClaimDeadLetter(ctx, deadLetter.ID)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	won := 0
+	for i := range claims {
+		if errs[i] != nil {
+			t.Fatalf("claim %d: %v", i, errs[i])
+		}
+		if claims[i] != nil {
+			won++
+		}
+	}
+	if won != 1 {
+		t.Fatalf("%d of %d concurrent claims got the dead letter, want exactly 1", won, racers)
+	}
+
+	if err := repo.ReleaseDeadLetter(ctx, deadLetter.ID); err != nil {
+		t.Fatal(err)
+	}
+	if claimed, err := repo.ClaimDeadLetter(ctx, deadLetter.ID); err != nil || claimed == nil {
+		t.Errorf("claim after release = %v, %v; want the dead letter", claimed, err)
+	}
+
+	// The endpoint's remaining dead letters are handed out at most limit at
+	// a time and never twice
+	for i := 0; i < 3; i++ {
+		create(`{"id":"2"}`)
+	}
+	seen := map[uuid.UUID]bool{}
+	for _, want := range []int{2, 1, 0} {
+		claimed, err := repo.ClaimDeadLettersForEndpoint(ctx, endpoint.ID, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(claimed) != want {
+			t.Fatalf("claimed %d dead letters, want %d", len(claimed), want)
+		}
+		for _, delivery := range claimed {
+			if seen[delivery.ID] || delivery.ID == deadLetter.ID {
+				t.Errorf("dead letter %s was claimed twice", delivery.ID)
+			}
+			seen[delivery.ID] = true
+		}
+	}
+}
+
+// Pruning old attempts keeps the dead letters that were never retried, so
+// an outage longer than the retention period can still be replayed.
+func TestDeleteBeforeKeepsUnretriedDeadLetters(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewWebhookDeliveryRepository(pool)
+	endpoint := createTestEndpoint(t, pool)
+
+	attempt := createTestDelivery(t, repo, endpoint.ID, "")
+	retried := createTestDelivery(t, repo, endpoint.ID, `{"id":"1"}`)
+	waiting := createTestDelivery(t, repo, endpoint.ID, `{"id":"2"}`)
+	if claimed, err := repo.ClaimDeadLetter(ctx, retried.ID); err != nil || claimed == nil {
+		t.Fatalf("ClaimDeadLetter = %v, %v", claimed, err)
+	}
+	dbtest.Exec(t, pool, database.Qualify(`
+		UPDATE {cms}.webhook_deliveries SET created_at = NOW() - INTERVAL '60 days' WHERE endpoint_id = $1
+	`), endpoint.ID)
+
+	if _, err := repo.DeleteBefore(ctx, time.Now().Add(-30*24*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		delivery *models.WebhookDelivery
+		kept     bool
+	}{
+		{"attempt", attempt, false},
+		{"retried dead letter", retried, false},
+		{"dead letter waiting for a retry", waiting, true},
+	} {
+		got, err := repo.GetByID(ctx, tc.delivery.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept := got != nil; kept != tc.kept {
+			t.Errorf("%s kept = %v, want %v", tc.name, kept, tc.kept)
+		}
+	}
+}
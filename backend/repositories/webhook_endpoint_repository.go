@@ -0,0 +1,151 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var ErrWebhookEndpointNotFound = errors.New("webhook endpoint not found")
+
+// webhookEndpointColumns selects an endpoint, to be scanned by
+// scanWebhookEndpoint.
+const webhookEndpointColumns = `id, url, events, secret_encrypted, is_active, created_at, updated_at`
+
+type WebhookEndpointRepository struct {
+	db *pgxpool.Pool
+}
+
+func NewWebhookEndpointRepository(db *pgxpool.Pool) *WebhookEndpointRepository {
+	return &WebhookEndpointRepository{db: db}
+}
+
+func (r *WebhookEndpointRepository) Create(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	query := database.Qualify(`
+		INSERT INTO {cms}.webhook_endpoints (url, events, secret_encrypted, is_active)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at, updated_at
+	`)
+
+	return r.db.QueryRow(ctx, query,
+		endpoint.URL,
+		endpoint.Events,
+		endpoint.SecretEncrypted,
+		endpoint.IsActive,
+	).Scan(&endpoint.ID, &endpoint.CreatedAt, &endpoint.UpdatedAt)
+}
+
+// GetByID returns the endpoint, or nil if there is none.
+func (r *WebhookEndpointRepository) GetByID(ctx context.Context, id uuid.UUID) (*models.WebhookEndpoint, error) {
+	row := r.db.QueryRow(ctx, database.Qualify(`
+		SELECT `+webhookEndpointColumns+`
+		FROM {cms}.webhook_endpoints
+		WHERE id = $1
+	`), id)
+
+	endpoint, err := scanWebhookEndpoint(row)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return endpoint, nil
+}
+
+// List returns every endpoint, oldest first.
+func (r *WebhookEndpointRepository) List(ctx context.Context) ([]*models.WebhookEndpoint, error) {
+	return r.list(ctx, database.Qualify(`
+		SELECT `+webhookEndpointColumns+`
+		FROM {cms}.webhook_endpoints
+		ORDER BY created_at
+	`))
+}
+
+// ListActiveForEvent returns the active endpoints subscribed to the event.
+func (r *WebhookEndpointRepository) ListActiveForEvent(ctx context.Context, event string) ([]*models.WebhookEndpoint, error) {
+	return r.list(ctx, database.Qualify(`
+		SELECT `+webhookEndpointColumns+`
+		FROM {cms}.webhook_endpoints
+		WHERE is_active AND events @> ARRAY[$1::text]
+		ORDER BY created_at
+	`), event)
+}
+
+func (r *WebhookEndpointRepository) list(ctx context.Context, query string, args ...interface{}) ([]*models.WebhookEndpoint, error) {
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []*models.WebhookEndpoint{}
+	for rows.Next() {
+		endpoint, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return endpoints, nil
+}
+
+func (r *WebhookEndpointRepository) Update(ctx context.Context, endpoint *models.WebhookEndpoint) error {
+	err := r.db.QueryRow(ctx, database.Qualify(`
+		UPDATE {cms}.webhook_endpoints
+		SET url = $2, events = $3, secret_encrypted = $4, is_active = $5, updated_at = NOW()
+		WHERE id = $1
+		RETURNING updated_at
+	`),
+		endpoint.ID,
+		endpoint.URL,
+		endpoint.Events,
+		endpoint.SecretEncrypted,
+		endpoint.IsActive,
+	).Scan(&endpoint.UpdatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrWebhookEndpointNotFound
+	}
+	return err
+}
+
+// Delete removes the endpoint along with its circuit and delivery log.
+func (r *WebhookEndpointRepository) Delete(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.db.Exec(ctx, database.Qualify(`DELETE FROM {cms}.webhook_endpoints WHERE id = $1`), id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrWebhookEndpointNotFound
+	}
+	return nil
+}
+
+func scanWebhookEndpoint(row pgx.Row) (*models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+	err := row.Scan(
+		&endpoint.ID,
+		&endpoint.URL,
+		&endpoint.Events,
+		&endpoint.SecretEncrypted,
+		&endpoint.IsActive,
+		&endpoint.CreatedAt,
+		&endpoint.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return &endpoint, nil
+}
@@ -0,0 +1,64 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+)
+
+// WebhookEventRepository remembers which inbound webhook events have been
+// processed.
+type WebhookEventRepository struct {
+	db      *pgxpool.Pool
+	tracker *database.TransactionTracker
+}
+
+func NewWebhookEventRepository(db *pgxpool.Pool, tracker *database.TransactionTracker) *WebhookEventRepository {
+	return &WebhookEventRepository{db: db, tracker: tracker}
+}
+
+// ProcessOnce runs fn unless the provider's event has been processed before,
+// and reports whether it ran. The event is recorded in the same transaction
+// that is open while fn runs: a concurrent delivery of the same event waits
+// for it and is then skipped, and if fn fails the record is rolled back so
+// the provider's retry is processed.
+func (r *WebhookEventRepository) ProcessOnce(ctx context.Context, provider, eventID string, fn func(ctx context.Context) error) (bool, error) {
+	processed := false
+	err := database.WithTransaction(ctx, r.db, r.tracker, func(tx pgx.Tx) error {
+		tag, err := tx.Exec(ctx, database.Qualify(`
+			INSERT INTO {shop}.processed_webhook_events (provider, event_id)
+			VALUES ($1, $2)
+			ON CONFLICT DO NOTHING
+		`), provider, eventID)
+		if err != nil {
+			return err
+		}
+		if tag.RowsAffected() == 0 {
+			return nil
+		}
+
+		if err := fn(ctx); err != nil {
+			return err
+		}
+		processed = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return processed, nil
+}
+
+// DeleteProcessedBefore forgets events processed before cutoff and returns
+// how many there were.
+func (r *WebhookEventRepository) DeleteProcessedBefore(ctx context.Context, cutoff time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, database.Qualify(`DELETE FROM {shop}.processed_webhook_events WHERE processed_at < $1`), cutoff)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,93 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+)
+
+// Delivering the same event twice processes it once; a delivery whose
+// processing failed is not remembered, so the provider's retry goes through.
+func TestProcessOnceIsIdempotent(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	repo := NewWebhookEventRepository(pool, nil)
+
+	eventID := dbtest.UniqueName("evt")
+	failedID := dbtest.UniqueName("evt")
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify(`
+			DELETE FROM {shop}.processed_webhook_events WHERE event_id = ANY($1)
+		`), []string{eventID, failedID})
+	})
+
+	calls := 0
+	handle := func(ctx context.Context) error {
+		calls++
+		return nil
+	}
+	for i, want := range []bool{true, false} {
+		processed, err := repo.ProcessOnce(ctx, "stripe", eventID, handle)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if processed != want {
+			t.Errorf("delivery %d processed = %v, want %v", i+1, processed, want)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want once", calls)
+	}
+
+	// The same ID from another provider is another event
+	if processed, err := repo.ProcessOnce(ctx, "eversend", eventID, handle); err != nil || !processed {
+		t.Errorf("same ID from eversend = %v, %v; want processed", processed, err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify(`
+			DELETE FROM {shop}.processed_webhook_events WHERE provider = 'eversend' AND event_id = $1
+		`), eventID)
+	})
+
+	handlerErr := errors.New("order not found")
+	if _, err := repo.ProcessOnce(ctx, "stripe", failedID, func(ctx context.Context) error { return handlerErr }); !errors.Is(err, handlerErr) {
+		t.Fatalf("failing delivery: err = %v, want the handler's error", err)
+	}
+	if processed, err := repo.ProcessOnce(ctx, "stripe", failedID, handle); err != nil || !processed {
+		t.Errorf("retry after a failure = %v, %v; want processed", processed, err)
+	}
+
+	dbtest.Exec(t, pool, database.Qualify(`
+		UPDATE {shop}.processed_webhook_events SET processed_at = NOW() - INTERVAL '8 days' WHERE event_id = $1
+	`), failedID)
+	if _, err := repo.DeleteProcessedBefore(ctx, time.Now().AddDate(0, 0, -7)); err != nil {
+		t.Fatal(err)
+	}
+	var remaining []string
+	rows, err := pool.Query(ctx, database.Qualify(`
+		SELECT event_id FROM {shop}.processed_webhook_events WHERE event_id = ANY($1)
+	`), []string{eventID, failedID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		remaining = append(remaining, id)
+	}
+	for _, id := range remaining {
+		if id == failedID {
+			t.Errorf("an event processed 8 days ago survived pruning")
+		}
+	}
+	if len(remaining) != 2 {
+		t.Errorf("%d recent events remain, want the two deliveries of %s", len(remaining), eventID)
+	}
+}
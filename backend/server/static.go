@@ -0,0 +1,151 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"html/template"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// StaticURLPrefix is the URL path static assets are served under.
+const StaticURLPrefix = "/static/"
+
+// fingerprintLength is how many hex digits of the SHA-256 hash go into a
+// fingerprinted name.
+const fingerprintLength = 12
+
+// StaticAssetServer serves the files of a directory under fingerprinted
+// names, such as app.abc123def456.js for app.js. A file's name changes with
+// its content, so browsers may cache it forever. Files are only served under
+// their fingerprinted names.
+type StaticAssetServer struct {
+	dir string
+
+	mu sync.RWMutex
+	// fingerprinted maps a file's path to its fingerprinted path, and
+	// originals maps it back. Paths are relative to dir and slash-separated.
+	fingerprinted map[string]string
+	originals     map[string]string
+}
+
+// NewStaticAssetServer fingerprints the files in dir. A missing dir is
+// treated as empty.
+func NewStaticAssetServer(dir string) (*StaticAssetServer, error) {
+	s := &StaticAssetServer{dir: dir}
+	if err := s.Refresh(context.Background()); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Refresh rehashes the files so that changed, added and removed files are
+// picked up. It is run periodically in development.
+func (s *StaticAssetServer) Refresh(ctx context.Context) error {
+	fingerprinted := map[string]string{}
+	originals := map[string]string{}
+
+	err := filepath.WalkDir(s.dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			return ctx.Err()
+		}
+
+		rel, err := filepath.Rel(s.dir, file)
+		if err != nil {
+			return err
+		}
+		sum, err := hashFile(file)
+		if err != nil {
+			return err
+		}
+
+		original := filepath.ToSlash(rel)
+		name := fingerprintName(original, sum)
+		fingerprinted[original] = name
+		originals[name] = original
+		return nil
+	})
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	s.mu.Lock()
+	s.fingerprinted = fingerprinted
+	s.originals = originals
+	s.mu.Unlock()
+
+	return nil
+}
+
+// AssetURL returns the URL of the fingerprinted file for a path relative to
+// the static directory, e.g. "/static/app.abc123def456.js" for "app.js".
+// Unknown paths get an unfingerprinted URL, which is not served.
+func (s *StaticAssetServer) AssetURL(original string) string {
+	original = strings.TrimPrefix(original, "/")
+
+	s.mu.RLock()
+	name, ok := s.fingerprinted[original]
+	s.mu.RUnlock()
+
+	if !ok {
+		return StaticURLPrefix + original
+	}
+	return StaticURLPrefix + name
+}
+
+// FuncMap exposes AssetURL to HTML templates.
+func (s *StaticAssetServer) FuncMap() template.FuncMap {
+	return template.FuncMap{"AssetURL": s.AssetURL}
+}
+
+// Serve handles GET StaticURLPrefix+"*filepath". Fingerprinted files are
+// served with headers letting them be cached for a year; any other path,
+// including a file's original name, is not found.
+func (s *StaticAssetServer) Serve(c *gin.Context) {
+	name := strings.TrimPrefix(c.Param("filepath"), "/")
+
+	s.mu.RLock()
+	original, ok := s.originals[name]
+	s.mu.RUnlock()
+
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Asset not found"})
+		return
+	}
+
+	c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	c.File(filepath.Join(s.dir, filepath.FromSlash(original)))
+}
+
+// fingerprintName inserts the start of the hash before the extension.
+func fingerprintName(original, sum string) string {
+	ext := path.Ext(original)
+	return strings.TrimSuffix(original, ext) + "." + sum[:fingerprintLength] + ext
+}
+
+func hashFile(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func writeStaticFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	file := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStaticAssetServer(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	dir := t.TempDir()
+	writeStaticFile(t, dir, "js/app.js", "console.log(1)\n")
+
+	assets, err := NewStaticAssetServer(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := gin.New()
+	router.GET(StaticURLPrefix+"*filepath", assets.Serve)
+	get := func(url string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+		return w
+	}
+
+	// The first 12 hex digits of the SHA-256 of the file
+	const fingerprinted = "/static/js/app.3879a5d930ae.js"
+	if url := assets.AssetURL("/js/app.js"); url != fingerprinted {
+		t.Fatalf("AssetURL = %q, want %q", url, fingerprinted)
+	}
+
+	w := get(fingerprinted)
+	if w.Code != http.StatusOK || w.Body.String() != "console.log(1)\n" {
+		t.Fatalf("GET %s = %d %q, want the file", fingerprinted, w.Code, w.Body)
+	}
+	if got := w.Header().Get("Cache-Control"); got != "public, max-age=31536000, immutable" {
+		t.Errorf("Cache-Control = %q", got)
+	}
+
+	for _, url := range []string{"/static/js/app.js", "/static/js/app.000000000000.js", "/static/../static.go"} {
+		if w := get(url); w.Code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", url, w.Code)
+		}
+	}
+
+	// A changed file gets a new name and the old one stops being served
+	writeStaticFile(t, dir, "js/app.js", "console.log(2)\n")
+	if err := assets.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if url := assets.AssetURL("js/app.js"); url == fingerprinted {
+		t.Error("AssetURL did not change with the file's content")
+	} else if w := get(url); w.Code != http.StatusOK {
+		t.Errorf("GET %s = %d, want 200", url, w.Code)
+	}
+	if w := get(fingerprinted); w.Code != http.StatusNotFound {
+		t.Errorf("GET of the old name = %d, want 404", w.Code)
+	}
+}
+
+func TestStaticAssetServerMissingDir(t *testing.T) {
+	assets, err := NewStaticAssetServer(filepath.Join(t.TempDir(), "missing"))
+	if err != nil {
+		t.Fatalf("NewStaticAssetServer of a missing dir: %v", err)
+	}
+	if url := assets.AssetURL("app.js"); url != "/static/app.js" {
+		t.Errorf("AssetURL of an unknown file = %q, want /static/app.js", url)
+	}
+}
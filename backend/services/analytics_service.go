@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// dashboardCacheTTL is how long dashboard stats are served from memory.
+// Windows are rounded to it as well, so a dashboard ending "now" keeps
+// hitting the same entry until it expires.
+const dashboardCacheTTL = 5 * time.Minute
+
+// dashboardTopProducts is how many products the dashboard ranks.
+const dashboardTopProducts = 10
+
+type dashboardCacheKey struct {
+	from, to int64
+}
+
+type dashboardCacheEntry struct {
+	stats     *models.DashboardStats
+	expiresAt time.Time
+}
+
+type AnalyticsService struct {
+	analyticsRepo  *repositories.AnalyticsRepository
+	dashboardCache sync.Map
+	now            func() time.Time
+}
+
+func NewAnalyticsService(analyticsRepo *repositories.AnalyticsRepository) *AnalyticsService {
+	return &AnalyticsService{analyticsRepo: analyticsRepo, now: time.Now}
+}
+
+// GetDashboardStats returns the revenue, order count, average order value,
+// new customers and top products by revenue of the orders placed from from
+// up to to, each compared with the window of the same length before it.
+// The window is rounded down to dashboardCacheTTL and the result cached for
+// as long.
+func (s *AnalyticsService) GetDashboardStats(ctx context.Context, from, to time.Time) (*models.DashboardStats, error) {
+	from, to = from.Truncate(dashboardCacheTTL), to.Truncate(dashboardCacheTTL)
+	key := dashboardCacheKey{from: from.Unix(), to: to.Unix()}
+
+	now := s.now()
+	if cached, ok := s.dashboardCache.Load(key); ok {
+		entry := cached.(*dashboardCacheEntry)
+		if now.Before(entry.expiresAt) {
+			return entry.stats, nil
+		}
+	}
+
+	previousFrom := from.Add(-to.Sub(from))
+	current, previous, err := s.analyticsRepo.PeriodTotals(ctx, previousFrom, from, to)
+	if err != nil {
+		return nil, err
+	}
+	topProducts, err := s.analyticsRepo.TopProductsByRevenue(ctx, from, to, dashboardTopProducts)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &models.DashboardStats{
+		From:              from,
+		To:                to,
+		Revenue:           dashboardMetric(current.Revenue, previous.Revenue),
+		OrderCount:        dashboardMetric(float64(current.Orders), float64(previous.Orders)),
+		AverageOrderValue: dashboardMetric(averageOrderValue(current), averageOrderValue(previous)),
+		NewCustomers:      dashboardMetric(float64(current.NewCustomers), float64(previous.NewCustomers)),
+		TopProducts:       topProducts,
+	}
+
+	s.pruneDashboardCache(now)
+	s.dashboardCache.Store(key, &dashboardCacheEntry{stats: stats, expiresAt: now.Add(dashboardCacheTTL)})
+	return stats, nil
+}
+
+// pruneDashboardCache drops the expired entries, so windows that are not
+// asked for again do not pile up.
+func (s *AnalyticsService) pruneDashboardCache(now time.Time) {
+	s.dashboardCache.Range(func(key, value interface{}) bool {
+		if !now.Before(value.(*dashboardCacheEntry).expiresAt) {
+			s.dashboardCache.Delete(key)
+		}
+		return true
+	})
+}
+
+func dashboardMetric(value, previous float64) models.DashboardMetric {
+	metric := models.DashboardMetric{Value: roundCents(value), Previous: roundCents(previous)}
+	if previous != 0 {
+		change := (value - previous) / previous
+		metric.Change = &change
+	}
+	return metric
+}
+
+func averageOrderValue(totals models.PeriodTotals) float64 {
+	if totals.Orders == 0 {
+		return 0
+	}
+	return totals.Revenue / float64(totals.Orders)
+}
+
+// TopCustomersByLTV returns the customers with the highest lifetime value.
+// A non-nil since restricts the calculation to orders placed after it.
+func (s *AnalyticsService) TopCustomersByLTV(ctx context.Context, limit int, since *time.Time) ([]models.CustomerLTV, error) {
+	return s.analyticsRepo.TopCustomersByLTV(ctx, limit, since)
+}
@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// createAnalyticsCustomer creates a customer without a user, joined at
+// createdAt. It is deleted with its orders when the test ends.
+func createAnalyticsCustomer(tb testing.TB, pool *pgxpool.Pool, createdAt time.Time) uuid.UUID {
+	tb.Helper()
+
+	var id uuid.UUID
+	if err := pool.QueryRow(context.Background(), database.Qualify(`
+		INSERT INTO {shop}.customers (created_at) VALUES ($1) RETURNING id
+	`), createdAt).Scan(&id); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		dbtest.Exec(tb, pool, database.Qualify("DELETE FROM {shop}.orders WHERE customer_id = $1"), id)
+		dbtest.Exec(tb, pool, database.Qualify("DELETE FROM {shop}.customers WHERE id = $1"), id)
+	})
+	return id
+}
+
+// createAnalyticsProduct creates a product deleted when the test ends.
+func createAnalyticsProduct(tb testing.TB, pool *pgxpool.Pool, name string) uuid.UUID {
+	tb.Helper()
+
+	var id uuid.UUID
+	slug := dbtest.UniqueName(name)
+	if err := pool.QueryRow(context.Background(), database.Qualify(`
+		INSERT INTO {shop}.products (name, slug, description, price, sku, stock)
+		VALUES ($1, $2, 'A test product', 10, $2, 100)
+		RETURNING id
+	`), name, slug).Scan(&id); err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		dbtest.Exec(tb, pool, database.Qualify("DELETE FROM {shop}.products WHERE id = $1"), id)
+	})
+	return id
+}
+
+func TestDashboardMetric(t *testing.T) {
+	change := func(c float64) *float64 { return &c }
+	// Compared exactly, so worked out at run time as dashboardMetric does
+	value, previous := 10.004, 5.006
+
+	tests := []struct {
+		name            string
+		value, previous float64
+		want            models.DashboardMetric
+	}{
+		{"up", 150, 100, models.DashboardMetric{Value: 150, Previous: 100, Change: change(0.5)}},
+		{"down", 75, 100, models.DashboardMetric{Value: 75, Previous: 100, Change: change(-0.25)}},
+		{"unchanged", 3, 3, models.DashboardMetric{Value: 3, Previous: 3, Change: change(0)}},
+		{"nothing before", 40, 0, models.DashboardMetric{Value: 40}},
+		{"rounded to cents", value, previous, models.DashboardMetric{Value: 10, Previous: 5.01, Change: change((value - previous) / previous)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := dashboardMetric(tt.value, tt.previous)
+			if got.Value != tt.want.Value || got.Previous != tt.want.Previous {
+				t.Errorf("dashboardMetric(%v, %v) = %v / %v, want %v / %v",
+					tt.value, tt.previous, got.Value, got.Previous, tt.want.Value, tt.want.Previous)
+			}
+			if (got.Change == nil) != (tt.want.Change == nil) ||
+				got.Change != nil && *got.Change != *tt.want.Change {
+				t.Errorf("dashboardMetric(%v, %v) change = %v, want %v", tt.value, tt.previous, got.Change, tt.want.Change)
+			}
+		})
+	}
+}
+
+// A week of orders against the week before it, with a cancelled order that
+// must not count. The result is cached until dashboardCacheTTL has passed.
+func TestGetDashboardStats(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	service := NewAnalyticsService(repositories.NewAnalyticsRepository(pool))
+	now := time.Date(2097, 6, 8, 0, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	from, to := time.Date(2097, 6, 1, 0, 0, 0, 0, time.UTC), time.Date(2097, 6, 8, 0, 0, 0, 0, time.UTC)
+	day := func(d int) time.Time { return time.Date(2097, 5, d, 12, 0, 0, 0, time.UTC) }
+
+	scarf, mittens := createAnalyticsProduct(t, pool, "scarf"), createAnalyticsProduct(t, pool, "mittens")
+	current := createAnalyticsCustomer(t, pool, from.Add(time.Hour))
+	previous := createAnalyticsCustomer(t, pool, day(28))
+
+	placeOrder := func(customerID uuid.UUID, status string, total float64, at time.Time, items map[uuid.UUID][2]float64) {
+		t.Helper()
+		var orderID uuid.UUID
+		if err := pool.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.orders (customer_id, status, total_amount, shipping_address, billing_address,
+				payment_method, payment_status, created_at)
+			VALUES ($1, $2, $3, '{}', '{}', 'card', 'paid', $4)
+			RETURNING id
+		`), customerID, status, total, at).Scan(&orderID); err != nil {
+			t.Fatal(err)
+		}
+		for productID, item := range items {
+			dbtest.Exec(t, pool, database.Qualify(`
+				INSERT INTO {shop}.order_items (order_id, product_id, quantity, price) VALUES ($1, $2, $3, $4)
+			`), orderID, productID, int(item[0]), item[1])
+		}
+	}
+
+	placeOrder(current, "delivered", 100, from.Add(2*time.Hour), map[uuid.UUID][2]float64{scarf: {2, 30}, mittens: {4, 10}})
+	placeOrder(current, "confirmed", 50, to.Add(-time.Hour), map[uuid.UUID][2]float64{mittens: {5, 10}})
+	placeOrder(current, "cancelled", 1000, from.Add(3*time.Hour), map[uuid.UUID][2]float64{scarf: {100, 10}})
+	placeOrder(previous, "delivered", 100, day(29), map[uuid.UUID][2]float64{scarf: {1, 100}})
+	placeOrder(previous, "delivered", 999, to, nil) // the window ends before to
+
+	// Windows are rounded down to dashboardCacheTTL
+	stats, err := service.GetDashboardStats(ctx, from.Add(time.Minute), to.Add(2*time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stats.From.Equal(from) || !stats.To.Equal(to) {
+		t.Errorf("window = %v to %v, want %v to %v", stats.From, stats.To, from, to)
+	}
+
+	metrics := []struct {
+		name            string
+		got             models.DashboardMetric
+		value, previous float64
+		change          float64
+	}{
+		{"revenue", stats.Revenue, 150, 100, 0.5},
+		{"order count", stats.OrderCount, 2, 1, 1},
+		{"average order value", stats.AverageOrderValue, 75, 100, -0.25},
+		{"new customers", stats.NewCustomers, 1, 1, 0},
+	}
+	for _, m := range metrics {
+		if m.got.Value != m.value || m.got.Previous != m.previous || m.got.Change == nil || *m.got.Change != m.change {
+			t.Errorf("%s = %v / %v change %v, want %v / %v change %v",
+				m.name, m.got.Value, m.got.Previous, m.got.Change, m.value, m.previous, m.change)
+		}
+	}
+
+	if len(stats.TopProducts) != 2 {
+		t.Fatalf("top products = %+v, want mittens and scarf", stats.TopProducts)
+	}
+	if top := stats.TopProducts[0]; top.ProductID != mittens || top.UnitsSold != 9 || top.Revenue != 90 {
+		t.Errorf("first product = %+v, want mittens with 9 units for 90", top)
+	}
+	if second := stats.TopProducts[1]; second.ProductID != scarf || second.UnitsSold != 2 || second.Revenue != 60 {
+		t.Errorf("second product = %+v, want scarf with 2 units for 60", second)
+	}
+
+	placeOrder(current, "delivered", 25, from.Add(4*time.Hour), nil)
+	cached, err := service.GetDashboardStats(ctx, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Revenue.Value != 150 {
+		t.Errorf("revenue within the cache TTL = %v, want the cached 150", cached.Revenue.Value)
+	}
+
+	now = now.Add(dashboardCacheTTL)
+	fresh, err := service.GetDashboardStats(ctx, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Revenue.Value != 175 || fresh.OrderCount.Value != 3 {
+		t.Errorf("after the cache TTL = %v in %v orders, want 175 in 3", fresh.Revenue.Value, fresh.OrderCount.Value)
+	}
+}
+
+// The dashboard queries over a window of 10 000 orders, uncached, should
+// take well under 100ms each.
+func BenchmarkGetDashboardStats(b *testing.B) {
+	pool := dbtest.Pool(b)
+	ctx := context.Background()
+	repo := repositories.NewAnalyticsRepository(pool)
+
+	from := time.Date(2096, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	var products []uuid.UUID
+	for i := 0; i < 20; i++ {
+		products = append(products, createAnalyticsProduct(b, pool, "bench"))
+	}
+	customerID := createAnalyticsCustomer(b, pool, from)
+
+	// Spread over this window and the one before it, each with two items
+	dbtest.Exec(b, pool, database.Qualify(`
+		WITH placed AS (
+			INSERT INTO {shop}.orders (customer_id, status, total_amount, shipping_address, billing_address,
+				payment_method, payment_status, created_at)
+			SELECT $1, 'delivered', 10 + n % 90, '{}', '{}', 'card', 'paid',
+				   $2::timestamptz + (n % 2 * 2 - 1) * (n * ($3::timestamptz - $2::timestamptz) / 20000)
+			FROM generate_series(1, 20000) n
+			RETURNING id
+		)
+		INSERT INTO {shop}.order_items (order_id, product_id, quantity, price)
+		SELECT placed.id, ($4::uuid[])[1 + (random() * 19)::int], 1 + (random() * 3)::int, 10
+		FROM placed, generate_series(1, 2)
+	`), customerID, from, to, products)
+	dbtest.Exec(b, pool, "ANALYZE "+database.Qualify("{shop}.orders, {shop}.order_items"))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		service := NewAnalyticsService(repo)
+		stats, err := service.GetDashboardStats(ctx, from, to)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if stats.OrderCount.Value != 10000 {
+			b.Fatalf("order count = %v, want 10000", stats.OrderCount.Value)
+		}
+	}
+
+	if perOp := b.Elapsed() / time.Duration(b.N); perOp > 100*time.Millisecond {
+		b.Errorf("GetDashboardStats took %v, want under 100ms", perOp)
+	}
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// The entities the audit middleware records writes to.
+const (
+	AuditEntityOrder   = "order"
+	AuditEntityUser    = "user"
+	AuditEntityProduct = "product"
+	AuditEntityPost    = "post"
+)
+
+var ErrInvalidAuditEntityType = errors.New("entity_type is required")
+
+// postAuditIgnoredFields are post fields that change on every save or are
+// loaded alongside the post rather than edited with it.
+var postAuditIgnoredFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+	"version":    true,
+	"author":     true,
+	"comments":   true,
+}
+
+// productAuditIgnoredFields are product fields that change on every save or
+// are computed for display rather than edited.
+var productAuditIgnoredFields = map[string]bool{
+	"created_at":          true,
+	"updated_at":          true,
+	"images":              true,
+	"category":            true,
+	"event":               true,
+	"price_exc_tax":       true,
+	"price_inc_tax":       true,
+	"flash_sale_price":    true,
+	"flash_sale_ends_at":  true,
+	"can_ship_to_country": true,
+}
+
+// PostAuditService records the fields of a post each update changed.
+type PostAuditService struct {
+	auditRepo *repositories.AuditRepository
+}
+
+func NewPostAuditService(auditRepo *repositories.AuditRepository) *PostAuditService {
+	return &PostAuditService{auditRepo: auditRepo}
+}
+
+// LogUpdate records the fields that differ between before and after as an
+// update by actorID. Nothing is recorded when no field changed.
+func (s *PostAuditService) LogUpdate(ctx context.Context, actorID uuid.UUID, before, after *models.Post) error {
+	return logAuditedUpdate(ctx, s.auditRepo, actorID, "post.update", "post", after.ID, before, after, postAuditIgnoredFields)
+}
+
+// ProductAuditService records the fields of a product each update changed.
+type ProductAuditService struct {
+	auditRepo *repositories.AuditRepository
+}
+
+func NewProductAuditService(auditRepo *repositories.AuditRepository) *ProductAuditService {
+	return &ProductAuditService{auditRepo: auditRepo}
+}
+
+// LogUpdate records the fields that differ between before and after as an
+// update by actorID. Nothing is recorded when no field changed.
+func (s *ProductAuditService) LogUpdate(ctx context.Context, actorID uuid.UUID, before, after *models.Product) error {
+	return logAuditedUpdate(ctx, s.auditRepo, actorID, "product.update", "product", after.ID, before, after, productAuditIgnoredFields)
+}
+
+func logAuditedUpdate(ctx context.Context, auditRepo *repositories.AuditRepository, actorID uuid.UUID, action, entityType string, entityID uuid.UUID, before, after interface{}, ignored map[string]bool) error {
+	changed, oldValue, newValue, err := diffFields(before, after, ignored)
+	if err != nil {
+		return err
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	return auditRepo.Create(ctx, &models.AuditLog{
+		ActorID:       &actorID,
+		Action:        action,
+		EntityType:    entityType,
+		EntityID:      entityID.String(),
+		ChangedFields: changed,
+		OldValue:      oldValue,
+		NewValue:      newValue,
+	})
+}
+
+// diffFields compares two values by their JSON fields and returns the names
+// of the fields that differ, sorted, with their old and new values. A field
+// left out of one side, such as an empty omitempty field, counts as null.
+func diffFields(before, after interface{}, ignored map[string]bool) ([]string, map[string]interface{}, map[string]interface{}, error) {
+	oldFields, err := jsonFields(before)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	newFields, err := jsonFields(after)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	names := make(map[string]bool, len(newFields))
+	for name := range oldFields {
+		names[name] = true
+	}
+	for name := range newFields {
+		names[name] = true
+	}
+
+	changed := []string{}
+	oldValue := map[string]interface{}{}
+	newValue := map[string]interface{}{}
+	for name := range names {
+		if ignored[name] || reflect.DeepEqual(oldFields[name], newFields[name]) {
+			continue
+		}
+		changed = append(changed, name)
+		oldValue[name] = oldFields[name]
+		newValue[name] = newFields[name]
+	}
+	sort.Strings(changed)
+
+	return changed, oldValue, newValue, nil
+}
+
+func jsonFields(v interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	fields := map[string]interface{}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// timestampAuditIgnoredFields are the fields of orders and users that change
+// on every save.
+var timestampAuditIgnoredFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+}
+
+// writeAuditIgnoredFields are the fields left out of the diffs of writes
+// made through the API, by entity type.
+var writeAuditIgnoredFields = map[string]map[string]bool{
+	AuditEntityOrder:   timestampAuditIgnoredFields,
+	AuditEntityUser:    timestampAuditIgnoredFields,
+	AuditEntityProduct: productAuditIgnoredFields,
+	AuditEntityPost:    postAuditIgnoredFields,
+}
+
+// AuditLogService records the writes made through the API and reads the
+// audit log.
+type AuditLogService struct {
+	auditRepo   *repositories.AuditRepository
+	orderRepo   *repositories.OrderRepository
+	userRepo    *repositories.UserRepository
+	productRepo *repositories.ProductRepository
+	postRepo    *repositories.PostRepository
+}
+
+func NewAuditLogService(
+	auditRepo *repositories.AuditRepository,
+	orderRepo *repositories.OrderRepository,
+	userRepo *repositories.UserRepository,
+	productRepo *repositories.ProductRepository,
+	postRepo *repositories.PostRepository,
+) *AuditLogService {
+	return &AuditLogService{
+		auditRepo:   auditRepo,
+		orderRepo:   orderRepo,
+		userRepo:    userRepo,
+		productRepo: productRepo,
+		postRepo:    postRepo,
+	}
+}
+
+// LogWrite records a write made through the API with the fields that differ
+// between the before and after snapshots of the entity. A creation has an
+// empty before snapshot and a deletion an empty after one, so every field is
+// recorded. When either snapshot is nil, as for a write the handler panicked
+// in, the write is recorded without changes.
+func (s *AuditLogService) LogWrite(ctx context.Context, entry *models.AuditLog, before, after map[string]interface{}) error {
+	if before != nil && after != nil {
+		changed, oldValue, newValue, err := diffFields(before, after, writeAuditIgnoredFields[entry.EntityType])
+		if err != nil {
+			return err
+		}
+		entry.ChangedFields = changed
+		entry.OldValue = oldValue
+		entry.NewValue = newValue
+	}
+
+	return s.auditRepo.Create(ctx, entry)
+}
+
+// Snapshot returns the current state of an entity as its JSON fields. It
+// returns nil when the entity does not exist, id is not a valid ID or the
+// entity type is not one of the audited ones.
+func (s *AuditLogService) Snapshot(ctx context.Context, entityType, id string) (map[string]interface{}, error) {
+	entityID, err := uuid.Parse(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	var current interface{}
+	switch entityType {
+	case AuditEntityOrder:
+		order, err := s.orderRepo.GetByID(ctx, entityID)
+		if err != nil || order == nil {
+			return nil, err
+		}
+		current = order
+	case AuditEntityUser:
+		user, err := s.userRepo.GetByID(ctx, entityID)
+		if err != nil || user == nil {
+			return nil, err
+		}
+		current = user
+	case AuditEntityProduct:
+		product, err := s.productRepo.GetByID(ctx, entityID)
+		if err != nil || product == nil {
+			return nil, err
+		}
+		current = product
+	case AuditEntityPost:
+		post, err := s.postRepo.GetByID(ctx, entityID)
+		if err != nil || post == nil {
+			return nil, err
+		}
+		current = post
+	default:
+		return nil, nil
+	}
+
+	return jsonFields(current)
+}
+
+// List returns a page of the audit history of an entity type, or of one
+// entity when entityID is set, newest first. Entries of updates carry their
+// changes field by field.
+func (s *AuditLogService) List(ctx context.Context, entityType, entityID string, limit, offset int) ([]*models.AuditLog, int, error) {
+	if entityType == "" {
+		return nil, 0, ErrInvalidAuditEntityType
+	}
+
+	entries, total, err := s.auditRepo.List(ctx, entityType, entityID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for _, entry := range entries {
+		for _, field := range entry.ChangedFields {
+			entry.Changes = append(entry.Changes, models.FieldChange{
+				Field: field,
+				Old:   entry.OldValue[field],
+				New:   entry.NewValue[field],
+			})
+		}
+	}
+
+	return entries, total, nil
+}
@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// Fields that change on every save are left out of the diff.
+func TestDiffFields(t *testing.T) {
+	now := time.Now()
+	before := &models.Post{Title: "Draft title", Slug: "draft", Status: "draft", Version: 1, UpdatedAt: now}
+	after := *before
+	after.Title = "Final title"
+	after.Status = "archived"
+	after.Version = 2
+	after.UpdatedAt = now.Add(time.Minute)
+
+	changed, oldValue, newValue, err := diffFields(before, &after, postAuditIgnoredFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"status", "title"}; !reflect.DeepEqual(changed, want) {
+		t.Errorf("changed = %v, want %v", changed, want)
+	}
+	if oldValue["title"] != "Draft title" || newValue["title"] != "Final title" {
+		t.Errorf("title %v -> %v, want Draft title -> Final title", oldValue["title"], newValue["title"])
+	}
+
+	product := &models.Product{Name: "Mug", Price: 10, PriceIncTax: 12}
+	repriced := *product
+	repriced.Price = 15
+	repriced.PriceIncTax = 18
+	if changed, _, _, err := diffFields(product, &repriced, productAuditIgnoredFields); err != nil || !reflect.DeepEqual(changed, []string{"price"}) {
+		t.Errorf("product changed = %v, %v; want only price, as price_inc_tax is computed", changed, err)
+	}
+}
+
+// Updating a post's title and status records an entry with exactly those
+// two fields, listed with their old and new values.
+func TestPostAuditLogUpdate(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	postRepo := repositories.NewPostRepository(pool, nil, repositories.NewRedirectRepository(pool))
+	auditRepo := repositories.NewAuditRepository(pool)
+	audit := NewPostAuditService(auditRepo)
+
+	user := createTestUser(t, pool)
+	authorID, err := postRepo.AuthorIDForUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.audit_logs WHERE actor_id = $1"), user.ID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.posts WHERE author_id = $1"), authorID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.authors WHERE id = $1"), authorID)
+	})
+
+	post := &models.Post{
+		Title:    "Draft title",
+		Slug:     dbtest.UniqueName("audited"),
+		Content:  "Content",
+		AuthorID: authorID,
+		Status:   "draft",
+	}
+	if err := postRepo.Create(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+	before, err := postRepo.GetByID(ctx, post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after := *before
+	after.Title = "Final title"
+	after.Status = "archived"
+	after.Version++
+	after.UpdatedAt = after.UpdatedAt.Add(time.Minute)
+
+	if err := audit.LogUpdate(ctx, user.ID, before, &after); err != nil {
+		t.Fatal(err)
+	}
+	// Saving without changes records nothing
+	if err := audit.LogUpdate(ctx, user.ID, &after, &after); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, total, err := NewAuditLogService(auditRepo, nil, nil, nil, nil).List(ctx, AuditEntityPost, post.ID.String(), 10, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 1 {
+		t.Fatalf("%d audit entries, want 1", total)
+	}
+	want := []models.FieldChange{
+		{Field: "status", Old: "draft", New: "archived"},
+		{Field: "title", Old: "Draft title", New: "Final title"},
+	}
+	if entry := entries[0]; entry.Action != "post.update" || !reflect.DeepEqual(entry.Changes, want) {
+		t.Errorf("entry = %s with %+v, want post.update with %+v", entry.Action, entry.Changes, want)
+	}
+}
@@ -2,7 +2,13 @@ package services
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"log"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
@@ -17,14 +23,68 @@ var (
 	ErrInvalidCredentials = errors.New("invalid credentials")
 	ErrUserAlreadyExists  = errors.New("user already exists")
 	ErrInvalidToken       = errors.New("invalid token")
+	ErrTokenAlreadyUsed   = errors.New("refresh token already used")
+	ErrResetTokenInvalid  = errors.New("invalid password reset token")
+	ErrResetTokenExpired  = errors.New("password reset token expired")
+	ErrResetTokenUsed     = repositories.ErrPasswordResetTokenUsed
+	// ErrOAuthAccountConflict rejects an external sign-in whose email
+	// already belongs to an account with a password.
+	ErrOAuthAccountConflict = errors.New("an account with this email already exists; sign in with your password")
+	ErrInvalidAPIKey        = errors.New("invalid API key")
+	ErrAPIKeyNotFound       = repositories.ErrAPIKeyNotFound
+	// ErrAPIKeyScopeNotGranted rejects an API key scope that is not one of
+	// the user's permissions.
+	ErrAPIKeyScopeNotGranted = errors.New("API key scopes must be permissions the user holds")
 )
 
+// passwordResetTTL is how long an emailed password reset link works.
+const passwordResetTTL = time.Hour
+
+// apiKeyPrefix starts every API key, so a leaked key is easy to recognize.
+const apiKeyPrefix = "sk_live_"
+
+// GoogleIdentityVerifier checks a Google ID token and returns the account
+// it was issued for.
+type GoogleIdentityVerifier interface {
+	Verify(ctx context.Context, idToken string) (*GoogleIdentity, error)
+}
+
+// AccountEmailer emails users about their account.
+type AccountEmailer interface {
+	SendWelcome(ctx context.Context, user *models.User) error
+	SendPasswordReset(ctx context.Context, user *models.User, token string) error
+}
+
 type AuthService struct {
-	userRepo *repositories.UserRepository
+	userRepo         *repositories.UserRepository
+	refreshTokenRepo *repositories.RefreshTokenRepository
+	resetTokenRepo   *repositories.PasswordResetTokenRepository
+	apiKeyRepo       *repositories.APIKeyRepository
+	tokens           TokenStore
+	emails           AccountEmailer
+	google           GoogleIdentityVerifier
+	now              func() time.Time
 }
 
-func NewAuthService(userRepo *repositories.UserRepository) *AuthService {
-	return &AuthService{userRepo: userRepo}
+func NewAuthService(
+	userRepo *repositories.UserRepository,
+	refreshTokenRepo *repositories.RefreshTokenRepository,
+	resetTokenRepo *repositories.PasswordResetTokenRepository,
+	apiKeyRepo *repositories.APIKeyRepository,
+	tokens TokenStore,
+	emails AccountEmailer,
+	google GoogleIdentityVerifier,
+) *AuthService {
+	return &AuthService{
+		userRepo:         userRepo,
+		refreshTokenRepo: refreshTokenRepo,
+		resetTokenRepo:   resetTokenRepo,
+		apiKeyRepo:       apiKeyRepo,
+		tokens:           tokens,
+		emails:           emails,
+		google:           google,
+		now:              time.Now,
+	}
 }
 
 func (s *AuthService) Register(ctx context.Context, req *models.RegisterRequest) (*models.User, error) {
@@ -56,6 +116,11 @@ func (s *AuthService) Register(ctx context.Context, req *models.RegisterRequest)
 		return nil, err
 	}
 
+	// The account exists, so a failed email is only logged
+	if err := s.emails.SendWelcome(ctx, user); err != nil {
+		log.Printf("Failed to send welcome email to user %s: %v\n", user.ID, err)
+	}
+
 	return user, nil
 }
 
@@ -75,62 +140,178 @@ func (s *AuthService) Login(ctx context.Context, req *models.LoginRequest) (*mod
 		return nil, ErrInvalidCredentials
 	}
 
-	// Generate tokens
-	token, expiresAt, err := s.generateToken(user)
+	return s.issueTokens(ctx, user)
+}
+
+// LoginWithGoogle signs in the user with the Google account the ID token
+// was issued for, registering a customer the first time the account is
+// used. An email that already belongs to a password account gets
+// ErrOAuthAccountConflict rather than a second account.
+func (s *AuthService) LoginWithGoogle(ctx context.Context, idToken string) (*models.TokenResponse, error) {
+	identity, err := s.google.Verify(ctx, idToken)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByOAuthSubject(ctx, "google", identity.Subject)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		user, err = s.registerGoogleUser(ctx, identity)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s.issueTokens(ctx, user)
+}
+
+// registerGoogleUser creates a customer for a Google account. The password
+// hash is of random bytes nobody knows, so the account can only be signed
+// into through Google, or after a password reset.
+func (s *AuthService) registerGoogleUser(ctx context.Context, identity *GoogleIdentity) (*models.User, error) {
+	existing, err := s.userRepo.GetByEmail(ctx, identity.Email)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, ErrOAuthAccountConflict
+	}
+
+	password := make([]byte, 32)
+	if _, err := rand.Read(password); err != nil {
+		return nil, err
+	}
+	hashedPassword, err := bcrypt.GenerateFromPassword(password, bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	fullName := identity.Name
+	if fullName == "" {
+		fullName = identity.Email
+	}
+
+	user := &models.User{
+		Email:         identity.Email,
+		PasswordHash:  string(hashedPassword),
+		FullName:      fullName,
+		Role:          "customer",
+		AvatarURL:     identity.Picture,
+		OAuthProvider: "google",
+		OAuthSubject:  identity.Subject,
+	}
+	if err := s.userRepo.Create(ctx, user); err != nil {
+		return nil, err
+	}
+
+	// The account exists, so a failed email is only logged
+	if err := s.emails.SendWelcome(ctx, user); err != nil {
+		log.Printf("Failed to send welcome email to user %s: %v\n", user.ID, err)
+	}
+
+	return user, nil
+}
+
+// issueTokens starts a new session for the user, with an access token and a
+// refresh token in a new family.
+func (s *AuthService) issueTokens(ctx context.Context, user *models.User) (*models.TokenResponse, error) {
+	token, expiresAt, err := s.generateToken(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, refreshID, refreshExpiresAt, err := s.generateRefreshToken(user)
 	if err != nil {
 		return nil, err
 	}
 
-	refreshToken, _, err := s.generateRefreshToken(user)
+	// Logging in starts a new token family
+	err = s.refreshTokenRepo.Create(ctx, &models.RefreshToken{
+		ID:        refreshID,
+		UserID:    user.ID,
+		FamilyID:  uuid.New(),
+		ExpiresAt: refreshExpiresAt,
+	})
 	if err != nil {
 		return nil, err
 	}
 
 	return &models.TokenResponse{
-		Token:        token,
-		RefreshToken: refreshToken,
-		ExpiresAt:    expiresAt,
-		User:         *user,
+		Token:            token,
+		RefreshToken:     refreshToken,
+		ExpiresAt:        expiresAt,
+		RefreshExpiresAt: refreshExpiresAt,
+		User:             *user,
 	}, nil
 }
 
-func (s *AuthService) ValidateToken(tokenString string) (*models.JWTClaims, error) {
-	// Parse token
-	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing method
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, ErrInvalidToken
-		}
-		return []byte(viper.GetString("auth.jwt_secret")), nil
-	})
+// ValidateToken checks the access token's signature and expiry and that it
+// has not been revoked, and returns its claims. Refresh tokens are
+// rejected: they are only good for RefreshToken, which also checks that
+// their family has not been revoked.
+func (s *AuthService) ValidateToken(ctx context.Context, tokenString string) (*models.JWTClaims, error) {
+	return s.validateToken(ctx, tokenString, false)
+}
 
+// validateToken validates an access token or, with refresh set, a refresh
+// token, as ValidateToken does. A token of the other kind is rejected.
+func (s *AuthService) validateToken(ctx context.Context, tokenString string, refresh bool) (*models.JWTClaims, error) {
+	// Parse token
+	token, err := parseToken(tokenString)
 	if err != nil {
 		return nil, err
 	}
 
 	// Validate claims
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+		if isRefresh, _ := claims["is_refresh"].(bool); isRefresh != refresh {
+			return nil, ErrInvalidToken
+		}
+
 		// Extract user ID from claims
 		userID, err := uuid.Parse(claims["user_id"].(string))
 		if err != nil {
 			return nil, ErrInvalidToken
 		}
 
+		// Tokens issued before revocation existed carry no jti
+		if jti, _ := claims["jti"].(string); jti != "" {
+			revoked, err := s.tokens.IsRevoked(ctx, jti)
+			if err != nil {
+				return nil, err
+			}
+			if revoked {
+				return nil, ErrInvalidToken
+			}
+		}
+
 		return &models.JWTClaims{
-			UserID: userID,
-			Email:  claims["email"].(string),
-			Role:   claims["role"].(string),
+			UserID:      userID,
+			Email:       claims["email"].(string),
+			Role:        claims["role"].(string),
+			Scopes:      stringsClaim(claims, "scopes"),
+			Permissions: stringsClaim(claims, "permissions"),
 		}, nil
 	}
 
 	return nil, ErrInvalidToken
 }
 
+// RefreshToken exchanges a refresh token for new tokens. Each refresh token
+// can be used once: when the same token is refreshed concurrently exactly
+// one call succeeds, and the others, like any later reuse, fail with
+// ErrTokenAlreadyUsed and revoke every token descended from the same login.
 func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*models.TokenResponse, error) {
 	// Validate refresh token
-	claims, err := s.ValidateToken(refreshToken)
+	claims, err := s.validateToken(ctx, refreshToken, true)
 	if err != nil {
-		return nil, err
+		return nil, ErrInvalidToken
+	}
+	refreshID, err := refreshTokenID(refreshToken)
+	if err != nil {
+		return nil, ErrInvalidToken
 	}
 
 	// Get user by ID
@@ -143,25 +324,254 @@ func (s *AuthService) RefreshToken(ctx context.Context, refreshToken string) (*m
 	}
 
 	// Generate new tokens
-	token, expiresAt, err := s.generateToken(user)
+	token, expiresAt, err := s.generateToken(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+
+	newRefreshToken, newRefreshID, refreshExpiresAt, err := s.generateRefreshToken(user)
 	if err != nil {
 		return nil, err
 	}
 
-	newRefreshToken, _, err := s.generateRefreshToken(user)
+	err = s.refreshTokenRepo.Rotate(ctx, refreshID, &models.RefreshToken{
+		ID:        newRefreshID,
+		ExpiresAt: refreshExpiresAt,
+	}, time.Now())
 	if err != nil {
+		switch {
+		case errors.Is(err, repositories.ErrRefreshTokenReused):
+			return nil, ErrTokenAlreadyUsed
+		case errors.Is(err, repositories.ErrRefreshTokenNotFound):
+			return nil, ErrInvalidToken
+		}
 		return nil, err
 	}
 
 	return &models.TokenResponse{
-		Token:        token,
-		RefreshToken: newRefreshToken,
-		ExpiresAt:    expiresAt,
-		User:         *user,
+		Token:            token,
+		RefreshToken:     newRefreshToken,
+		ExpiresAt:        expiresAt,
+		RefreshExpiresAt: refreshExpiresAt,
+		User:             *user,
+	}, nil
+}
+
+// Logout revokes the token until it expires. A refresh token also revokes
+// every token from the same login. Tokens that do not parse, including
+// expired ones, need no revoking and are ignored.
+func (s *AuthService) Logout(ctx context.Context, tokenString string) error {
+	token, err := parseToken(tokenString)
+	if err != nil {
+		return nil
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil
+	}
+
+	if jti, _ := claims["jti"].(string); jti != "" {
+		exp, _ := claims["exp"].(float64)
+		ttl := time.Until(time.Unix(int64(exp), 0))
+		if ttl > 0 {
+			if err := s.tokens.Revoke(ctx, jti, ttl); err != nil {
+				return err
+			}
+		}
+	}
+
+	if refreshID, err := refreshTokenID(tokenString); err == nil {
+		return s.refreshTokenRepo.RevokeFamily(ctx, refreshID)
+	}
+	return nil
+}
+
+// RequestPasswordReset emails the user with the given email a link to
+// choose a new password, valid for passwordResetTTL. Only the token's hash
+// is stored. An unknown email is not an error, so the response does not
+// tell whether an account exists.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return err
+	}
+	if user == nil {
+		return nil
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(raw)
+
+	err = s.resetTokenRepo.Create(ctx, &models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: hashToken(token),
+		ExpiresAt: s.now().Add(passwordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.emails.SendPasswordReset(ctx, user, token)
+}
+
+// ResetPassword sets the user's new password with a token from a reset
+// email. Unknown tokens get ErrResetTokenInvalid, expired ones
+// ErrResetTokenExpired and tokens used before ErrResetTokenUsed.
+func (s *AuthService) ResetPassword(ctx context.Context, rawToken, newPassword string) error {
+	token, err := s.resetTokenRepo.GetByHash(ctx, hashToken(rawToken))
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return ErrResetTokenInvalid
+	}
+	if token.UsedAt != nil {
+		return ErrResetTokenUsed
+	}
+	now := s.now()
+	if !now.Before(token.ExpiresAt) {
+		return ErrResetTokenExpired
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+
+	if err := s.resetTokenRepo.MarkUsed(ctx, token.ID, now); err != nil {
+		return err
+	}
+
+	return s.userRepo.UpdatePassword(ctx, token.UserID, string(hashedPassword))
+}
+
+// hashToken returns the hex encoded SHA-256 hash of a password reset token
+// or API key, as it is stored.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey issues the user an API key limited to scopes, each of which
+// must be one of the user's permissions. Only the key's hash is stored, so
+// the returned key cannot be shown again.
+func (s *AuthService) CreateAPIKey(ctx context.Context, userID uuid.UUID, label string, scopes []string) (string, error) {
+	permissions, err := s.userRepo.GetPermissions(ctx, userID)
+	if err != nil {
+		return "", err
+	}
+	held := stringSet(permissions)
+	for _, scope := range scopes {
+		if !held[scope] {
+			return "", fmt.Errorf("%w: %s", ErrAPIKeyScopeNotGranted, scope)
+		}
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	rawKey := apiKeyPrefix + hex.EncodeToString(raw)
+
+	err = s.apiKeyRepo.Create(ctx, &models.APIKey{
+		UserID:  userID,
+		KeyHash: hashToken(rawKey),
+		Label:   label,
+		Scopes:  scopes,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return rawKey, nil
+}
+
+// ValidateAPIKey checks that the key exists, has not expired and belongs
+// to a current user, and returns its claims. The permissions are the key's
+// scopes the user still holds, so a revoked permission is revoked for the
+// user's keys too. The role is the user's.
+func (s *AuthService) ValidateAPIKey(ctx context.Context, rawKey string) (*models.APIKeyClaims, error) {
+	if !strings.HasPrefix(rawKey, apiKeyPrefix) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	key, err := s.apiKeyRepo.GetByHash(ctx, hashToken(rawKey))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || (key.ExpiresAt != nil && !s.now().Before(*key.ExpiresAt)) {
+		return nil, ErrInvalidAPIKey
+	}
+
+	user, err := s.userRepo.GetByID(ctx, key.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	permissions, err := s.userRepo.GetPermissions(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	held := stringSet(permissions)
+	granted := []string{}
+	for _, scope := range key.Scopes {
+		if held[scope] {
+			granted = append(granted, scope)
+		}
+	}
+
+	// The key is valid either way, so a failed write is only logged
+	if err := s.apiKeyRepo.TouchLastUsed(ctx, key.ID); err != nil {
+		log.Printf("Failed to record use of API key %s: %v\n", key.ID, err)
+	}
+
+	return &models.APIKeyClaims{
+		JWTClaims: models.JWTClaims{
+			UserID:      user.ID,
+			Email:       user.Email,
+			Role:        user.Role,
+			Scopes:      permissionScopes(granted),
+			Permissions: granted,
+		},
+		KeyID: key.ID,
 	}, nil
 }
 
-func (s *AuthService) generateToken(user *models.User) (string, time.Time, error) {
+// ListAPIKeys returns the user's API keys, newest first.
+func (s *AuthService) ListAPIKeys(ctx context.Context, userID uuid.UUID) ([]*models.APIKey, error) {
+	return s.apiKeyRepo.ListForUser(ctx, userID)
+}
+
+// RevokeAPIKey deletes one of the user's API keys.
+func (s *AuthService) RevokeAPIKey(ctx context.Context, userID, id uuid.UUID) error {
+	return s.apiKeyRepo.Delete(ctx, id, userID)
+}
+
+// PruneRevokedTokens forgets revoked tokens that have expired since, for
+// token stores that keep them until asked.
+func (s *AuthService) PruneRevokedTokens(ctx context.Context) error {
+	pruner, ok := s.tokens.(expiredTokenPruner)
+	if !ok {
+		return nil
+	}
+	_, err := pruner.DeleteExpired(ctx)
+	return err
+}
+
+// generateToken returns a signed access token carrying the user's current
+// permissions. Permissions granted later only show up in the next token.
+func (s *AuthService) generateToken(ctx context.Context, user *models.User) (string, time.Time, error) {
+	permissions, err := s.userRepo.GetPermissions(ctx, user.ID)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
 	// Set expiration time
 	expiryDuration, err := time.ParseDuration(viper.GetString("auth.token_expiry"))
 	if err != nil {
@@ -171,11 +581,14 @@ func (s *AuthService) generateToken(user *models.User) (string, time.Time, error
 
 	// Create claims
 	claims := jwt.MapClaims{
-		"user_id":    user.ID.String(),
-		"email":      user.Email,
-		"role":       user.Role,
-		"exp":        expiresAt.Unix(),
-		"issued_at":  time.Now().Unix(),
+		"user_id":     user.ID.String(),
+		"email":       user.Email,
+		"role":        user.Role,
+		"scopes":      permissionScopes(permissions),
+		"permissions": permissions,
+		"exp":         expiresAt.Unix(),
+		"issued_at":   time.Now().Unix(),
+		"jti":         uuid.New().String(),
 	}
 
 	// Create token
@@ -190,13 +603,15 @@ func (s *AuthService) generateToken(user *models.User) (string, time.Time, error
 	return tokenString, expiresAt, nil
 }
 
-func (s *AuthService) generateRefreshToken(user *models.User) (string, time.Time, error) {
+// generateRefreshToken returns a signed refresh token and its jti.
+func (s *AuthService) generateRefreshToken(user *models.User) (string, uuid.UUID, time.Time, error) {
 	// Set expiration time
 	expiryDuration, err := time.ParseDuration(viper.GetString("auth.refresh_token_expiry"))
 	if err != nil {
 		expiryDuration = 7 * 24 * time.Hour // Default to 7 days
 	}
 	expiresAt := time.Now().Add(expiryDuration)
+	id := uuid.New()
 
 	// Create claims
 	claims := jwt.MapClaims{
@@ -206,6 +621,7 @@ func (s *AuthService) generateRefreshToken(user *models.User) (string, time.Time
 		"exp":        expiresAt.Unix(),
 		"issued_at":  time.Now().Unix(),
 		"is_refresh": true,
+		"jti":        id.String(),
 	}
 
 	// Create token
@@ -214,8 +630,78 @@ func (s *AuthService) generateRefreshToken(user *models.User) (string, time.Time
 	// Sign token
 	tokenString, err := token.SignedString([]byte(viper.GetString("auth.jwt_secret")))
 	if err != nil {
-		return "", time.Time{}, err
+		return "", uuid.Nil, time.Time{}, err
 	}
 
-	return tokenString, expiresAt, nil
+	return tokenString, id, expiresAt, nil
+}
+
+// permissionScopes returns the distinct scopes of "<scope>:<action>"
+// permissions, in the order they first appear.
+func permissionScopes(permissions []string) []string {
+	scopes := []string{}
+	seen := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		scope, _, _ := strings.Cut(permission, ":")
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
+
+func stringSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// stringsClaim returns a list claim as strings. Tokens issued without the
+// claim yield an empty list.
+func stringsClaim(claims jwt.MapClaims, name string) []string {
+	values, _ := claims[name].([]interface{})
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+func parseToken(tokenString string) (*jwt.Token, error) {
+	return jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		// Validate signing method
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, ErrInvalidToken
+		}
+		return []byte(viper.GetString("auth.jwt_secret")), nil
+	})
+}
+
+// refreshTokenID returns the jti of a valid refresh token. Access tokens are
+// rejected.
+func refreshTokenID(tokenString string) (uuid.UUID, error) {
+	token, err := parseToken(tokenString)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return uuid.Nil, ErrInvalidToken
+	}
+	if isRefresh, _ := claims["is_refresh"].(bool); !isRefresh {
+		return uuid.Nil, ErrInvalidToken
+	}
+	jti, _ := claims["jti"].(string)
+
+	id, err := uuid.Parse(jti)
+	if err != nil {
+		return uuid.Nil, ErrInvalidToken
+	}
+	return id, nil
 }
\ No newline at end of file
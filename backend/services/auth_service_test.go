@@ -0,0 +1,207 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// recordingEmailer keeps the password reset tokens it is asked to send.
+type recordingEmailer struct {
+	mu          sync.Mutex
+	resetTokens []string
+}
+
+func (e *recordingEmailer) SendWelcome(ctx context.Context, user *models.User) error {
+	return nil
+}
+
+func (e *recordingEmailer) SendPasswordReset(ctx context.Context, user *models.User, token string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.resetTokens = append(e.resetTokens, token)
+	return nil
+}
+
+func newTestAuthService(t *testing.T, pool *pgxpool.Pool, emails AccountEmailer) *AuthService {
+	t.Helper()
+	viper.Set("auth.jwt_secret", "test-secret")
+	t.Cleanup(func() { viper.Set("auth.jwt_secret", nil) })
+
+	return NewAuthService(
+		repositories.NewUserRepository(pool, nil),
+		repositories.NewRefreshTokenRepository(pool, nil),
+		repositories.NewPasswordResetTokenRepository(pool),
+		repositories.NewAPIKeyRepository(pool),
+		repositories.NewRevokedTokenRepository(pool),
+		emails,
+		nil,
+	)
+}
+
+// createTestUser creates a customer that is deleted, with its tokens, when
+// the test ends.
+func createTestUser(t *testing.T, pool *pgxpool.Pool) *models.User {
+	t.Helper()
+
+	user := &models.User{
+		Email:        dbtest.UniqueName("user") + "@example.com",
+		PasswordHash: "x",
+		FullName:     "Test User",
+		Role:         "customer",
+	}
+	if err := repositories.NewUserRepository(pool, nil).Create(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.users WHERE id = $1"), user.ID)
+	})
+	return user
+}
+
+// Concurrent refreshes of one token are serialised on its row, so exactly
+// one of them gets new tokens.
+func TestRefreshTokenRaceHasOneWinner(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	service := newTestAuthService(t, pool, &recordingEmailer{})
+	user := createTestUser(t, pool)
+
+	tokens, err := service.issueTokens(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const racers = 8
+	start := make(chan struct{})
+	errs := make([]error, racers)
+	var wg sync.WaitGroup
+	for i := 0; i < racers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			_, errs[i] = service.RefreshToken(ctx, tokens.RefreshToken)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	succeeded := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			succeeded++
+		case !errors.Is(err, ErrTokenAlreadyUsed):
+			t.Errorf("refresh failed with %v, want ErrTokenAlreadyUsed", err)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("%d of %d concurrent refreshes succeeded, want exactly 1", succeeded, racers)
+	}
+}
+
+func TestResetPasswordRejectsExpiredAndUsedTokens(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	emails := &recordingEmailer{}
+	service := newTestAuthService(t, pool, emails)
+	user := createTestUser(t, pool)
+
+	requestToken := func() string {
+		t.Helper()
+		if err := service.RequestPasswordReset(ctx, user.Email); err != nil {
+			t.Fatal(err)
+		}
+		return emails.resetTokens[len(emails.resetTokens)-1]
+	}
+
+	if err := service.ResetPassword(ctx, "not-a-token", "new-password"); !errors.Is(err, ErrResetTokenInvalid) {
+		t.Errorf("unknown token: err = %v, want ErrResetTokenInvalid", err)
+	}
+
+	expired := requestToken()
+	service.now = func() time.Time { return time.Now().Add(passwordResetTTL + time.Minute) }
+	if err := service.ResetPassword(ctx, expired, "new-password"); !errors.Is(err, ErrResetTokenExpired) {
+		t.Errorf("expired token: err = %v, want ErrResetTokenExpired", err)
+	}
+	service.now = time.Now
+
+	token := requestToken()
+	if err := service.ResetPassword(ctx, token, "new-password"); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := service.ResetPassword(ctx, token, "other-password"); !errors.Is(err, ErrResetTokenUsed) {
+		t.Errorf("second use: err = %v, want ErrResetTokenUsed", err)
+	}
+
+	stored, err := repositories.NewUserRepository(pool, nil).GetByEmail(ctx, user.Email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored.PasswordHash), []byte("new-password")) != nil {
+		t.Error("the password was not set by the first use of the token")
+	}
+}
+
+// An access token carries the permissions the user held when it was issued.
+// A permission granted afterwards needs a new token.
+func TestAccessTokenCarriesPermissions(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	service := newTestAuthService(t, pool, &recordingEmailer{})
+	user := createTestUser(t, pool)
+
+	grant := func(permission string) {
+		t.Helper()
+		dbtest.Exec(t, pool, database.Qualify(`
+			INSERT INTO {auth}.user_permissions (user_id, permission) VALUES ($1, $2)
+		`), user.ID, permission)
+	}
+	claimsOf := func(tokens *models.TokenResponse) *models.JWTClaims {
+		t.Helper()
+		claims, err := service.ValidateToken(ctx, tokens.Token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return claims
+	}
+
+	grant("posts:write")
+	grant("orders:read")
+	first, err := service.issueTokens(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := claimsOf(first)
+	if want := []string{"orders:read", "posts:write"}; !reflect.DeepEqual(claims.Permissions, want) {
+		t.Errorf("permissions = %v, want %v", claims.Permissions, want)
+	}
+	if want := []string{"orders", "posts"}; !reflect.DeepEqual(claims.Scopes, want) {
+		t.Errorf("scopes = %v, want %v", claims.Scopes, want)
+	}
+
+	grant("posts:publish")
+	if claims := claimsOf(first); len(claims.Permissions) != 2 {
+		t.Errorf("the earlier token now has permissions %v, want the 2 it was issued with", claims.Permissions)
+	}
+
+	second, err := service.issueTokens(ctx, user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"orders:read", "posts:publish", "posts:write"}; !reflect.DeepEqual(claimsOf(second).Permissions, want) {
+		t.Errorf("new token's permissions = %v, want %v", claimsOf(second).Permissions, want)
+	}
+}
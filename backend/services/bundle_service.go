@@ -0,0 +1,66 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+var ErrBundleNotFound = errors.New("bundle not found")
+
+type BundleService struct {
+	bundleRepo *repositories.BundleRepository
+}
+
+func NewBundleService(bundleRepo *repositories.BundleRepository) *BundleService {
+	return &BundleService{bundleRepo: bundleRepo}
+}
+
+// GetBySlug returns the active bundle with its regular total, its price and
+// the difference between them filled in.
+func (s *BundleService) GetBySlug(ctx context.Context, slug string) (*models.ProductBundle, error) {
+	bundle, err := s.bundleRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if bundle == nil {
+		return nil, ErrBundleNotFound
+	}
+
+	bundle.RegularTotal, bundle.Price = s.ComputePrice(bundle)
+	bundle.Savings = roundCents(bundle.RegularTotal - bundle.Price)
+
+	return bundle, nil
+}
+
+// ComputePrice returns what the bundle's items cost bought one by one, at
+// their sale price when they have one, and what the bundle costs. The bundle
+// costs its fixed price when it has one, or else the regular total less its
+// discount, rounded to cents. A bundle price that would exceed the regular
+// total is capped at it, so a bundle never costs more than its items.
+func (s *BundleService) ComputePrice(bundle *models.ProductBundle) (regularTotal, bundlePrice float64) {
+	for _, item := range bundle.Items {
+		price := item.Product.Price
+		if item.Product.SalePrice != nil && *item.Product.SalePrice < price {
+			price = *item.Product.SalePrice
+		}
+		regularTotal += price * float64(item.Quantity)
+	}
+	regularTotal = roundCents(regularTotal)
+
+	switch {
+	case bundle.BundlePrice != nil:
+		bundlePrice = *bundle.BundlePrice
+	case bundle.BundleDiscountPercent != nil:
+		bundlePrice = roundCents(regularTotal * (1 - *bundle.BundleDiscountPercent/100))
+	default:
+		bundlePrice = regularTotal
+	}
+	if bundlePrice > regularTotal {
+		bundlePrice = regularTotal
+	}
+
+	return regularTotal, bundlePrice
+}
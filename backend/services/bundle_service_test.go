@@ -0,0 +1,157 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+func TestComputeBundlePrice(t *testing.T) {
+	product := func(price float64) *models.Product { return &models.Product{Price: price} }
+	onSale := func(price, sale float64) *models.Product { return &models.Product{Price: price, SalePrice: &sale} }
+	amount := func(v float64) *float64 { return &v }
+
+	tests := []struct {
+		name        string
+		bundle      models.ProductBundle
+		wantRegular float64
+		wantPrice   float64
+	}{
+		{
+			name: "fixed price",
+			bundle: models.ProductBundle{
+				Items:       []*models.ProductBundleItem{{Product: product(30), Quantity: 1}, {Product: product(20), Quantity: 2}},
+				BundlePrice: amount(55),
+			},
+			wantRegular: 70,
+			wantPrice:   55,
+		},
+		{
+			name: "discount percent",
+			bundle: models.ProductBundle{
+				Items:                 []*models.ProductBundleItem{{Product: product(30), Quantity: 1}, {Product: product(20), Quantity: 2}},
+				BundleDiscountPercent: amount(15),
+			},
+			wantRegular: 70,
+			wantPrice:   59.5,
+		},
+		{
+			name: "discount rounded to cents",
+			bundle: models.ProductBundle{
+				Items:                 []*models.ProductBundleItem{{Product: product(9.99), Quantity: 1}},
+				BundleDiscountPercent: amount(33),
+			},
+			wantRegular: 9.99,
+			wantPrice:   6.69,
+		},
+		{
+			name: "items on sale count at their sale price",
+			bundle: models.ProductBundle{
+				Items:                 []*models.ProductBundleItem{{Product: onSale(40, 30), Quantity: 1}, {Product: product(20), Quantity: 1}},
+				BundleDiscountPercent: amount(10),
+			},
+			wantRegular: 50,
+			wantPrice:   45,
+		},
+		{
+			name: "fixed price above the items is capped",
+			bundle: models.ProductBundle{
+				Items:       []*models.ProductBundleItem{{Product: product(10), Quantity: 2}},
+				BundlePrice: amount(25),
+			},
+			wantRegular: 20,
+			wantPrice:   20,
+		},
+	}
+
+	service := NewBundleService(nil)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			regular, price := service.ComputePrice(&tt.bundle)
+			if regular != tt.wantRegular || price != tt.wantPrice {
+				t.Errorf("ComputePrice = %v, %v; want %v, %v", regular, price, tt.wantRegular, tt.wantPrice)
+			}
+		})
+	}
+}
+
+// The storefront gets the regular total, the bundle price and the savings.
+func TestGetBundleBySlugReportsSavings(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	service := NewBundleService(repositories.NewBundleRepository(pool))
+
+	createProduct := func(price float64) uuid.UUID {
+		t.Helper()
+		slug := dbtest.UniqueName("product")
+		var id uuid.UUID
+		if err := pool.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.products (name, slug, description, price, sku, stock)
+			VALUES ($1, $1, 'A test product', $2, $1, 10)
+			RETURNING id
+		`), slug, price).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.products WHERE id = $1"), id)
+		})
+		return id
+	}
+	createBundle := func(fixedPrice, discountPercent *float64, items map[uuid.UUID]int) string {
+		t.Helper()
+		slug := dbtest.UniqueName("bundle")
+		var id uuid.UUID
+		if err := pool.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.product_bundles (name, slug, bundle_price, bundle_discount_percent)
+			VALUES ($1, $1, $2, $3)
+			RETURNING id
+		`), slug, fixedPrice, discountPercent).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.product_bundles WHERE id = $1"), id)
+		})
+		for productID, quantity := range items {
+			dbtest.Exec(t, pool, database.Qualify(`
+				INSERT INTO {shop}.product_bundle_items (bundle_id, product_id, quantity) VALUES ($1, $2, $3)
+			`), id, productID, quantity)
+		}
+		return slug
+	}
+
+	camera, lens := createProduct(300), createProduct(100)
+	items := map[uuid.UUID]int{camera: 1, lens: 2}
+	fixed, percent := 420.0, 20.0
+
+	tests := []struct {
+		name        string
+		slug        string
+		wantPrice   float64
+		wantSavings float64
+	}{
+		{"fixed price", createBundle(&fixed, nil, items), 420, 80},
+		{"discount percent", createBundle(nil, &percent, items), 400, 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			bundle, err := service.GetBySlug(ctx, tt.slug)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bundle.RegularTotal != 500 || bundle.Price != tt.wantPrice || bundle.Savings != tt.wantSavings {
+				t.Errorf("regular %v, price %v, savings %v; want 500, %v, %v",
+					bundle.RegularTotal, bundle.Price, bundle.Savings, tt.wantPrice, tt.wantSavings)
+			}
+		})
+	}
+
+	if _, err := service.GetBySlug(ctx, dbtest.UniqueName("missing")); !errors.Is(err, ErrBundleNotFound) {
+		t.Errorf("unknown slug: err = %v, want ErrBundleNotFound", err)
+	}
+}
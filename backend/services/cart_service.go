@@ -0,0 +1,328 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+var (
+	ErrCartItemNotFound    = repositories.ErrCartItemNotFound
+	ErrCartBundleItem      = repositories.ErrCartBundleItem
+	ErrVariantRequired     = errors.New("choose a variant of this product")
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponExpired       = errors.New("coupon has expired")
+	ErrCouponUsedUp        = repositories.ErrCouponUsedUp
+	ErrCouponMinimumNotMet = errors.New("order is below the coupon's minimum amount")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to any item in the cart")
+)
+
+type CartService struct {
+	cartRepo    *repositories.CartRepository
+	productRepo *repositories.ProductRepository
+	couponRepo  *repositories.CouponRepository
+	flashSales  *FlashSaleService
+	bundles     *BundleService
+	now         func() time.Time
+}
+
+func NewCartService(cartRepo *repositories.CartRepository, productRepo *repositories.ProductRepository, couponRepo *repositories.CouponRepository, flashSales *FlashSaleService, bundles *BundleService) *CartService {
+	return &CartService{
+		cartRepo:    cartRepo,
+		productRepo: productRepo,
+		couponRepo:  couponRepo,
+		flashSales:  flashSales,
+		bundles:     bundles,
+		now:         time.Now,
+	}
+}
+
+// GetCart returns the user's cart with its items, subtotal, discount and
+// total. A user without a cart gets a new, empty one. A coupon that no
+// longer applies, for example because it expired, is still shown but
+// gives no discount.
+func (s *CartService) GetCart(ctx context.Context, userID uuid.UUID) (*models.Cart, error) {
+	cart, err := s.cartRepo.GetOrCreate(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	cart, err = s.cartRepo.GetWithItems(ctx, cart.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, item := range cart.Items {
+		cart.Subtotal += item.UnitPrice * float64(item.Quantity)
+	}
+	cart.Subtotal = roundCents(cart.Subtotal)
+
+	if cart.CouponID != nil {
+		coupon, err := s.couponRepo.GetByID(ctx, *cart.CouponID)
+		if err != nil {
+			return nil, err
+		}
+		if coupon != nil {
+			cart.Discount, _ = couponDiscount(coupon, cart.Items, s.now())
+		}
+	}
+	cart.Total = roundCents(cart.Subtotal - cart.Discount)
+
+	return cart, nil
+}
+
+// ApplyCoupon applies the coupon with the code to the cart, replacing any
+// other, and returns the discount it gives. The coupon must not have
+// expired or been used up, the cart must reach its minimum amount and hold
+// at least one of the products it applies to.
+func (s *CartService) ApplyCoupon(ctx context.Context, cartID uuid.UUID, code string) (float64, error) {
+	coupon, err := s.couponRepo.FindByCode(ctx, code)
+	if err != nil {
+		return 0, err
+	}
+	if coupon == nil {
+		return 0, ErrCouponNotFound
+	}
+
+	cart, err := s.cartRepo.GetWithItems(ctx, cartID)
+	if err != nil {
+		return 0, err
+	}
+	if cart == nil || len(cart.Items) == 0 {
+		return 0, ErrCartEmpty
+	}
+
+	discount, err := couponDiscount(coupon, cart.Items, s.now())
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.cartRepo.SetCoupon(ctx, cartID, &coupon.ID); err != nil {
+		return 0, err
+	}
+	return discount, nil
+}
+
+// RemoveCoupon removes the coupon from the cart, if it has one.
+func (s *CartService) RemoveCoupon(ctx context.Context, cartID uuid.UUID) error {
+	return s.cartRepo.SetCoupon(ctx, cartID, nil)
+}
+
+// AddToCart adds a published product, or one of its variants, to the user's
+// cart at its current price, adding to the quantity if it is already there.
+// A product in the running flash sale is added at the flash sale price. It
+// fails with ErrOutOfStock if the cart would then hold more than is in
+// stock.
+func (s *CartService) AddToCart(ctx context.Context, userID uuid.UUID, req *models.AddCartItemRequest) (*models.Cart, error) {
+	product, err := s.productRepo.GetByID(ctx, req.ProductID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil || product.Status != "published" {
+		return nil, ErrProductNotFound
+	}
+
+	unitPrice := sellingPrice(product)
+	if req.VariantID != nil {
+		variant := findVariant(product.Variants, *req.VariantID)
+		if variant == nil {
+			return nil, ErrProductVariantNotFound
+		}
+		if variant.Price != nil {
+			unitPrice = *variant.Price
+		}
+	} else if len(product.Variants) > 0 {
+		return nil, ErrVariantRequired
+	}
+
+	sale, err := s.flashSales.GetActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if sale != nil && saleIncludes(sale, product.ID) {
+		unitPrice = s.flashSales.ComputePrice(&models.Product{Price: unitPrice}, sale)
+	}
+
+	cart, err := s.cartRepo.GetOrCreate(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.cartRepo.AddItem(ctx, &models.CartItem{
+		CartID:    cart.ID,
+		ProductID: product.ID,
+		VariantID: req.VariantID,
+		Quantity:  req.Quantity,
+		UnitPrice: unitPrice,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.GetCart(ctx, userID)
+}
+
+// AddBundle adds req.Quantity of the active bundle to the user's cart, one
+// line per product, each priced at its share of the bundle price. The lines
+// are added together or not at all, and can only be removed together.
+func (s *CartService) AddBundle(ctx context.Context, userID uuid.UUID, req *models.AddCartBundleRequest) (*models.Cart, error) {
+	bundle, err := s.bundles.GetBySlug(ctx, req.Slug)
+	if err != nil {
+		return nil, err
+	}
+	if len(bundle.Items) == 0 {
+		return nil, ErrBundleNotFound
+	}
+
+	cart, err := s.cartRepo.GetOrCreate(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	prices := bundleLinePrices(bundle)
+	items := make([]*models.CartItem, 0, len(bundle.Items))
+	for i, bundleItem := range bundle.Items {
+		if bundleItem.Product.Status != "published" {
+			return nil, ErrProductNotFound
+		}
+		items = append(items, &models.CartItem{
+			ProductID: bundleItem.Product.ID,
+			BundleID:  &bundle.ID,
+			Quantity:  bundleItem.Quantity * req.Quantity,
+			UnitPrice: prices[i],
+		})
+	}
+
+	if err := s.cartRepo.AddItems(ctx, cart.ID, items); err != nil {
+		return nil, err
+	}
+
+	return s.GetCart(ctx, userID)
+}
+
+// UpdateItem sets the quantity of an item in the user's cart.
+func (s *CartService) UpdateItem(ctx context.Context, userID, itemID uuid.UUID, req *models.UpdateCartItemRequest) (*models.Cart, error) {
+	cart, err := s.cartRepo.GetOrCreate(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cartRepo.UpdateItemQty(ctx, cart.ID, itemID, req.Quantity); err != nil {
+		return nil, err
+	}
+
+	return s.GetCart(ctx, userID)
+}
+
+// RemoveItem removes an item from the user's cart.
+func (s *CartService) RemoveItem(ctx context.Context, userID, itemID uuid.UUID) (*models.Cart, error) {
+	cart, err := s.cartRepo.GetOrCreate(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.cartRepo.RemoveItem(ctx, cart.ID, itemID); err != nil {
+		return nil, err
+	}
+
+	return s.GetCart(ctx, userID)
+}
+
+// couponDiscount returns what the coupon takes off the items, or why it
+// does not apply to them at now. The minimum amount is checked against the
+// whole cart, the discount only against the items the coupon applies to.
+// Usage is checked here as well, but only claimed when an order is placed.
+func couponDiscount(coupon *models.Coupon, items []*models.CartItem, now time.Time) (float64, error) {
+	if coupon.ExpiresAt != nil && !now.Before(*coupon.ExpiresAt) {
+		return 0, ErrCouponExpired
+	}
+	if coupon.MaxUses != nil && coupon.UsedCount >= *coupon.MaxUses {
+		return 0, ErrCouponUsedUp
+	}
+
+	subtotal, applicable := 0.0, 0.0
+	for _, item := range items {
+		lineTotal := item.UnitPrice * float64(item.Quantity)
+		subtotal += lineTotal
+		if couponAppliesTo(coupon, item.ProductID) {
+			applicable += lineTotal
+		}
+	}
+
+	if coupon.MinOrderAmount != nil && subtotal < *coupon.MinOrderAmount {
+		return 0, ErrCouponMinimumNotMet
+	}
+	if applicable == 0 {
+		return 0, ErrCouponNotApplicable
+	}
+
+	if coupon.Type == models.CouponTypePercent {
+		return roundCents(applicable * coupon.Value / 100), nil
+	}
+	return roundCents(math.Min(coupon.Value, applicable)), nil
+}
+
+func couponAppliesTo(coupon *models.Coupon, productID uuid.UUID) bool {
+	if len(coupon.ApplicableProductIDs) == 0 {
+		return true
+	}
+	for _, id := range coupon.ApplicableProductIDs {
+		if id == productID {
+			return true
+		}
+	}
+	return false
+}
+
+// bundleLinePrices returns the unit price of each of the bundle's items
+// when bought as part of it: the item's selling price scaled down by the
+// bundle's discount, rounded to cents. The rounding difference goes on an
+// item bought once, so that the lines add up to the bundle price; when
+// every item is bought more than once they may be off by a few cents.
+func bundleLinePrices(bundle *models.ProductBundle) []float64 {
+	prices := make([]float64, len(bundle.Items))
+	if bundle.RegularTotal == 0 {
+		return prices
+	}
+
+	ratio := bundle.Price / bundle.RegularTotal
+	total := 0.0
+	for i, item := range bundle.Items {
+		prices[i] = roundCents(sellingPrice(item.Product) * ratio)
+		total += prices[i] * float64(item.Quantity)
+	}
+
+	if diff := roundCents(bundle.Price - total); diff != 0 {
+		for i, item := range bundle.Items {
+			if item.Quantity == 1 && prices[i]+diff >= 0 {
+				prices[i] = roundCents(prices[i] + diff)
+				break
+			}
+		}
+	}
+
+	return prices
+}
+
+// sellingPrice returns the product's price, or its sale price when it has
+// a lower one.
+func sellingPrice(product *models.Product) float64 {
+	if product.SalePrice != nil && *product.SalePrice < product.Price {
+		return *product.SalePrice
+	}
+	return product.Price
+}
+
+func findVariant(variants []*models.ProductVariant, id uuid.UUID) *models.ProductVariant {
+	for _, variant := range variants {
+		if variant.ID == id {
+			return variant
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+func TestCouponDiscount(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	shirt, mug := uuid.New(), uuid.New()
+	items := []*models.CartItem{
+		{ProductID: shirt, UnitPrice: 20, Quantity: 2},
+		{ProductID: mug, UnitPrice: 9.99, Quantity: 1},
+	}
+	intPtr := func(n int) *int { return &n }
+	floatPtr := func(f float64) *float64 { return &f }
+
+	tests := []struct {
+		name    string
+		coupon  models.Coupon
+		want    float64
+		wantErr error
+	}{
+		{
+			name:   "percent of the cart",
+			coupon: models.Coupon{Type: models.CouponTypePercent, Value: 10},
+			want:   5,
+		},
+		{
+			name:   "fixed amount",
+			coupon: models.Coupon{Type: models.CouponTypeFixed, Value: 15},
+			want:   15,
+		},
+		{
+			name:   "fixed amount capped at the applicable items",
+			coupon: models.Coupon{Type: models.CouponTypeFixed, Value: 15, ApplicableProductIDs: []uuid.UUID{mug}},
+			want:   9.99,
+		},
+		{
+			name:   "percent of the applicable items only",
+			coupon: models.Coupon{Type: models.CouponTypePercent, Value: 25, ApplicableProductIDs: []uuid.UUID{shirt}},
+			want:   10,
+		},
+		{
+			name:    "no applicable items",
+			coupon:  models.Coupon{Type: models.CouponTypePercent, Value: 25, ApplicableProductIDs: []uuid.UUID{uuid.New()}},
+			wantErr: ErrCouponNotApplicable,
+		},
+		{
+			name:   "minimum met by the whole cart",
+			coupon: models.Coupon{Type: models.CouponTypeFixed, Value: 5, MinOrderAmount: floatPtr(49.99), ApplicableProductIDs: []uuid.UUID{mug}},
+			want:   5,
+		},
+		{
+			name:    "minimum not met",
+			coupon:  models.Coupon{Type: models.CouponTypeFixed, Value: 5, MinOrderAmount: floatPtr(50)},
+			wantErr: ErrCouponMinimumNotMet,
+		},
+		{
+			name:    "expired",
+			coupon:  models.Coupon{Type: models.CouponTypeFixed, Value: 5, ExpiresAt: &past},
+			wantErr: ErrCouponExpired,
+		},
+		{
+			name:    "expiring right now",
+			coupon:  models.Coupon{Type: models.CouponTypeFixed, Value: 5, ExpiresAt: &now},
+			wantErr: ErrCouponExpired,
+		},
+		{
+			name:   "not expired yet",
+			coupon: models.Coupon{Type: models.CouponTypeFixed, Value: 5, ExpiresAt: &future},
+			want:   5,
+		},
+		{
+			name:    "used up",
+			coupon:  models.Coupon{Type: models.CouponTypeFixed, Value: 5, MaxUses: intPtr(3), UsedCount: 3},
+			wantErr: ErrCouponUsedUp,
+		},
+		{
+			name:   "uses left",
+			coupon: models.Coupon{Type: models.CouponTypeFixed, Value: 5, MaxUses: intPtr(3), UsedCount: 2},
+			want:   5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := couponDiscount(&tt.coupon, items, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("discount = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBundleLinePrices(t *testing.T) {
+	product := func(price float64) *models.Product { return &models.Product{Price: price} }
+	onSale := func(price, sale float64) *models.Product { return &models.Product{Price: price, SalePrice: &sale} }
+
+	tests := []struct {
+		name   string
+		bundle models.ProductBundle
+		want   []float64
+	}{
+		{
+			name: "rounding difference on an item bought once",
+			bundle: models.ProductBundle{
+				Items: []*models.ProductBundleItem{
+					{Product: product(10), Quantity: 1},
+					{Product: product(10), Quantity: 1},
+					{Product: product(10), Quantity: 1},
+				},
+				RegularTotal: 30,
+				Price:        20,
+			},
+			want: []float64{6.66, 6.67, 6.67},
+		},
+		{
+			name: "scaled from the sale price",
+			bundle: models.ProductBundle{
+				Items: []*models.ProductBundleItem{
+					{Product: onSale(20, 10), Quantity: 2},
+					{Product: product(10), Quantity: 1},
+				},
+				RegularTotal: 30,
+				Price:        24,
+			},
+			want: []float64{8, 8},
+		},
+		{
+			name: "no item bought once to take the difference",
+			bundle: models.ProductBundle{
+				Items: []*models.ProductBundleItem{
+					{Product: product(10), Quantity: 3},
+					{Product: product(10), Quantity: 3},
+				},
+				RegularTotal: 60,
+				Price:        50,
+			},
+			want: []float64{8.33, 8.33},
+		},
+		{
+			name: "free items",
+			bundle: models.ProductBundle{
+				Items: []*models.ProductBundleItem{{Product: product(0), Quantity: 1}},
+			},
+			want: []float64{0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := bundleLinePrices(&tt.bundle)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("bundleLinePrices = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+var ErrCategoryNotFound = errors.New("category not found")
+
+type CategoryService struct {
+	categoryRepo *repositories.CategoryRepository
+}
+
+func NewCategoryService(categoryRepo *repositories.CategoryRepository) *CategoryService {
+	return &CategoryService{categoryRepo: categoryRepo}
+}
+
+// GetTree returns the blog categories as a tree of root categories.
+func (s *CategoryService) GetTree(ctx context.Context) ([]*models.Category, error) {
+	return s.categoryRepo.GetTree(ctx)
+}
+
+// GetBySlug returns the category with its breadcrumb trail, root first and
+// ending with the category itself.
+func (s *CategoryService) GetBySlug(ctx context.Context, slug string) (*models.Category, error) {
+	category, err := s.categoryRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if category == nil {
+		return nil, ErrCategoryNotFound
+	}
+
+	path, err := s.categoryRepo.GetBreadcrumb(ctx, category.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	category.Breadcrumb = make([]*models.CategoryBrief, 0, len(path))
+	for _, ancestor := range path {
+		category.Breadcrumb = append(category.Breadcrumb, &models.CategoryBrief{
+			ID:   ancestor.ID,
+			Name: ancestor.Name,
+			Slug: ancestor.Slug,
+		})
+	}
+
+	return category, nil
+}
+
+// Delete removes a category that has no children. It returns
+// repositories.ErrCategoryHasChildren otherwise.
+func (s *CategoryService) Delete(ctx context.Context, id uuid.UUID) error {
+	category, err := s.categoryRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if category == nil {
+		return ErrCategoryNotFound
+	}
+
+	return s.categoryRepo.Delete(ctx, id)
+}
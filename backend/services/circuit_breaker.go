@@ -0,0 +1,92 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+const (
+	// circuitFailureThreshold consecutive failures within circuitFailureWindow
+	// open an endpoint's circuit.
+	circuitFailureThreshold = 5
+	circuitFailureWindow    = 10 * time.Minute
+	// circuitOpenDuration is how long an open circuit blocks deliveries
+	// before a trial delivery is let through.
+	circuitOpenDuration = 30 * time.Minute
+)
+
+var ErrCircuitOpen = errors.New("circuit open, endpoint is failing")
+
+// CircuitBreaker stops webhook deliveries to endpoints that keep failing.
+// A circuit is closed while deliveries succeed. It opens after
+// circuitFailureThreshold consecutive failures within circuitFailureWindow
+// and blocks deliveries for circuitOpenDuration. Then it is half-open: the
+// next delivery is a trial that closes the circuit if it succeeds and opens
+// it again if it fails.
+type CircuitBreaker struct {
+	circuitRepo *repositories.WebhookCircuitRepository
+	now         func() time.Time
+}
+
+func NewCircuitBreaker(circuitRepo *repositories.WebhookCircuitRepository) *CircuitBreaker {
+	return &CircuitBreaker{circuitRepo: circuitRepo, now: time.Now}
+}
+
+// CanAttempt reports whether a delivery to the endpoint may be made now.
+func (b *CircuitBreaker) CanAttempt(ctx context.Context, endpointID uuid.UUID) (bool, error) {
+	circuit, err := b.circuitRepo.Get(ctx, endpointID)
+	if err != nil {
+		return false, err
+	}
+	if circuit.State != "open" {
+		return true, nil
+	}
+	if b.now().Before(circuit.OpenedAt.Add(circuitOpenDuration)) {
+		return false, nil
+	}
+
+	err = b.circuitRepo.Update(ctx, endpointID, func(circuit *models.WebhookCircuit) {
+		if circuit.State == "open" {
+			circuit.State = "half_open"
+		}
+	})
+	return err == nil, err
+}
+
+// RecordSuccess closes the endpoint's circuit.
+func (b *CircuitBreaker) RecordSuccess(ctx context.Context, endpointID uuid.UUID) error {
+	return b.circuitRepo.Update(ctx, endpointID, func(circuit *models.WebhookCircuit) {
+		circuit.State = "closed"
+		circuit.ConsecutiveFailures = 0
+		circuit.FirstFailureAt = nil
+	})
+}
+
+// RecordFailure counts a failed delivery and opens the circuit when the
+// threshold is reached, or when the trial delivery of a half-open circuit
+// failed.
+func (b *CircuitBreaker) RecordFailure(ctx context.Context, endpointID uuid.UUID) error {
+	now := b.now()
+	return b.circuitRepo.Update(ctx, endpointID, func(circuit *models.WebhookCircuit) {
+		recordCircuitFailure(circuit, now)
+	})
+}
+
+func recordCircuitFailure(circuit *models.WebhookCircuit, now time.Time) {
+	// Failures spread out over more than the window start a new run
+	if circuit.FirstFailureAt == nil || now.Sub(*circuit.FirstFailureAt) > circuitFailureWindow {
+		circuit.ConsecutiveFailures = 0
+		circuit.FirstFailureAt = &now
+	}
+	circuit.ConsecutiveFailures++
+
+	if circuit.State == "half_open" || circuit.ConsecutiveFailures >= circuitFailureThreshold {
+		circuit.State = "open"
+		circuit.OpenedAt = &now
+	}
+}
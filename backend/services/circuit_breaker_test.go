@@ -0,0 +1,131 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// Failures only open the circuit when the run of them fits in the window.
+func TestRecordCircuitFailure(t *testing.T) {
+	start := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		every time.Duration
+		want  string
+	}{
+		{"within the window", time.Minute, "open"},
+		{"spread over more than the window", 3 * time.Minute, "closed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			circuit := &models.WebhookCircuit{State: "closed"}
+			for i := 0; i < circuitFailureThreshold; i++ {
+				recordCircuitFailure(circuit, start.Add(time.Duration(i)*tt.every))
+			}
+			if circuit.State != tt.want {
+				t.Errorf("state after %d failures = %s, want %s", circuitFailureThreshold, circuit.State, tt.want)
+			}
+		})
+	}
+
+	circuit := &models.WebhookCircuit{State: "half_open"}
+	recordCircuitFailure(circuit, start)
+	if circuit.State != "open" || circuit.OpenedAt == nil || !circuit.OpenedAt.Equal(start) {
+		t.Errorf("failed trial: state %s opened at %v, want open at %v", circuit.State, circuit.OpenedAt, start)
+	}
+}
+
+// Five failures open the circuit, which blocks deliveries for 30 minutes and
+// then lets a trial through. A breaker started afterwards, as after a
+// worker restart, sees the same state.
+func TestCircuitBreakerOpensThenHalfOpens(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+
+	endpointRepo := repositories.NewWebhookEndpointRepository(pool)
+	endpoint := &models.WebhookEndpoint{
+		URL:             "https://hooks.example.com/" + dbtest.UniqueName("endpoint"),
+		Events:          []string{"order.created"},
+		SecretEncrypted: []byte("x"),
+	}
+	if err := endpointRepo.Create(ctx, endpoint); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.webhook_endpoints WHERE id = $1"), endpoint.ID)
+	})
+
+	circuitRepo := repositories.NewWebhookCircuitRepository(pool, nil)
+	clock := time.Now()
+	newBreaker := func() *CircuitBreaker {
+		breaker := NewCircuitBreaker(circuitRepo)
+		breaker.now = func() time.Time { return clock }
+		return breaker
+	}
+	breaker := newBreaker()
+	canAttempt := func(want bool, when string) {
+		t.Helper()
+		got, err := breaker.CanAttempt(ctx, endpoint.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("CanAttempt %s = %v, want %v", when, got, want)
+		}
+	}
+	state := func() string {
+		t.Helper()
+		circuit, err := circuitRepo.Get(ctx, endpoint.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return circuit.State
+	}
+
+	for i := 1; i <= circuitFailureThreshold; i++ {
+		canAttempt(true, "before the circuit opens")
+		if err := breaker.RecordFailure(ctx, endpoint.ID); err != nil {
+			t.Fatal(err)
+		}
+		clock = clock.Add(time.Minute)
+	}
+	if got := state(); got != "open" {
+		t.Fatalf("state after %d failures = %s, want open", circuitFailureThreshold, got)
+	}
+	canAttempt(false, "right after the circuit opened")
+
+	breaker = newBreaker()
+	clock = clock.Add(circuitOpenDuration - 2*time.Minute)
+	canAttempt(false, "just before 30 minutes have passed")
+	clock = clock.Add(time.Minute)
+	canAttempt(true, "30 minutes after the circuit opened")
+	if got := state(); got != "half_open" {
+		t.Errorf("state after 30 minutes = %s, want half_open", got)
+	}
+
+	// The trial fails, so the circuit opens for another 30 minutes
+	if err := breaker.RecordFailure(ctx, endpoint.ID); err != nil {
+		t.Fatal(err)
+	}
+	canAttempt(false, "after the trial failed")
+	clock = clock.Add(circuitOpenDuration)
+	canAttempt(true, "30 minutes after the failed trial")
+
+	if err := breaker.RecordSuccess(ctx, endpoint.ID); err != nil {
+		t.Fatal(err)
+	}
+	circuit, err := circuitRepo.Get(ctx, endpoint.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if circuit.State != "closed" || circuit.ConsecutiveFailures != 0 {
+		t.Errorf("after a successful trial: %s with %d failures, want closed with none", circuit.State, circuit.ConsecutiveFailures)
+	}
+}
@@ -0,0 +1,216 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// CommentFlagThreshold is the number of reports that flags a comment for
+// moderation.
+const CommentFlagThreshold = 3
+
+var (
+	ErrCommentNotFound          = repositories.ErrCommentNotFound
+	ErrInvalidCommentParent     = errors.New("parent comment is not on this post")
+	ErrInvalidCommentTransition = errors.New("comment cannot move to this status")
+)
+
+// commentTransitions lists the statuses a moderator may move a comment to
+// from each status. Comments start out pending; flagged is only reached
+// through reports. Spam is final, short of an admin override.
+var commentTransitions = map[string][]string{
+	"pending":  {"approved", "rejected", "spam"},
+	"approved": {"rejected", "spam"},
+	"flagged":  {"approved", "rejected", "spam"},
+	"rejected": {"approved", "spam"},
+	"spam":     {},
+}
+
+// CommentApprovedNotifier tells a post's author about a newly approved
+// comment on it.
+type CommentApprovedNotifier interface {
+	SendCommentApproved(ctx context.Context, author *models.Author, post *models.Post, comment *models.Comment) error
+}
+
+type CommentService struct {
+	commentRepo *repositories.CommentRepository
+	reportRepo  *repositories.CommentReportRepository
+	postRepo    *repositories.PostRepository
+	notifier    CommentApprovedNotifier
+}
+
+func NewCommentService(commentRepo *repositories.CommentRepository, reportRepo *repositories.CommentReportRepository, postRepo *repositories.PostRepository, notifier CommentApprovedNotifier) *CommentService {
+	return &CommentService{
+		commentRepo: commentRepo,
+		reportRepo:  reportRepo,
+		postRepo:    postRepo,
+		notifier:    notifier,
+	}
+}
+
+// Create adds a reader's comment to a published post, awaiting moderation.
+// A reply's parent must be on the same post.
+func (s *CommentService) Create(ctx context.Context, postID, userID uuid.UUID, req *models.CreateCommentRequest) (*models.Comment, error) {
+	post, err := s.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil || post.Status != "published" {
+		return nil, ErrPostNotFound
+	}
+
+	if req.ParentID != nil {
+		parent, err := s.commentRepo.GetByID(ctx, *req.ParentID)
+		if err != nil {
+			return nil, err
+		}
+		if parent == nil || parent.PostID != postID {
+			return nil, ErrInvalidCommentParent
+		}
+	}
+
+	comment := &models.Comment{
+		PostID:   postID,
+		UserID:   userID,
+		Content:  req.Content,
+		ParentID: req.ParentID,
+		Status:   "pending",
+	}
+	if err := s.commentRepo.Create(ctx, comment); err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// GetThreaded returns the approved comments of a post as a tree. Replies to
+// a comment that is not approved are hidden along with it.
+func (s *CommentService) GetThreaded(ctx context.Context, postID uuid.UUID) ([]*models.Comment, error) {
+	comments, err := s.commentRepo.GetThreaded(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	return approvedComments(comments), nil
+}
+
+func approvedComments(comments []*models.Comment) []*models.Comment {
+	approved := []*models.Comment{}
+	for _, comment := range comments {
+		if comment.Status != "approved" {
+			continue
+		}
+		comment.Replies = approvedComments(comment.Replies)
+		approved = append(approved, comment)
+	}
+	return approved
+}
+
+// Report records a reader's report and flags the comment once it has
+// CommentFlagThreshold reports. A reader reporting the same comment twice
+// gets repositories.ErrAlreadyReported.
+func (s *CommentService) Report(ctx context.Context, commentID, reporterID uuid.UUID, reason string) (*models.CommentReport, error) {
+	comment, err := s.commentRepo.GetByID(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
+	if comment == nil {
+		return nil, ErrCommentNotFound
+	}
+
+	report := &models.CommentReport{
+		CommentID:  commentID,
+		ReporterID: reporterID,
+		Reason:     reason,
+	}
+	if err := s.reportRepo.Create(ctx, report); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.commentRepo.FlagIfReported(ctx, commentID, CommentFlagThreshold); err != nil {
+		return nil, err
+	}
+
+	return report, nil
+}
+
+// ListByStatus returns a page of comments in the given status, e.g. the
+// flagged ones awaiting review.
+func (s *CommentService) ListByStatus(ctx context.Context, status string, limit, offset int) ([]*models.Comment, int, error) {
+	return s.commentRepo.ListByStatus(ctx, status, limit, offset)
+}
+
+// SetStatus records a moderator's decision on the comment, attributed to
+// actorID in the audit log. The move must be allowed by commentTransitions,
+// or ErrInvalidCommentTransition is returned, unless req.Override is set;
+// only an override can send a comment back to pending. Keeping the current
+// status is always allowed. Approving a flagged comment clears its reports,
+// so it is only flagged again by new ones. Approving a pending comment tells
+// the post's author about it.
+func (s *CommentService) SetStatus(ctx context.Context, id, actorID uuid.UUID, req *models.UpdateCommentStatusRequest) (*models.Comment, error) {
+	comment, err := s.commentRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if comment == nil {
+		return nil, ErrCommentNotFound
+	}
+	if comment.Status == req.Status {
+		return comment, nil
+	}
+	if !req.Override && !canMoveComment(comment.Status, req.Status) {
+		return nil, ErrInvalidCommentTransition
+	}
+
+	if err := s.commentRepo.UpdateStatus(ctx, id, comment.Status, req.Status, actorID); err != nil {
+		return nil, err
+	}
+
+	if req.Status == "approved" && comment.Status == "flagged" {
+		if err := s.reportRepo.DeleteForComment(ctx, id); err != nil {
+			return nil, err
+		}
+	}
+
+	previous := comment.Status
+	comment.Status = req.Status
+
+	// The status change is saved, so a failed email is only logged
+	if comment.Status == "approved" && previous == "pending" {
+		if err := s.notifyAuthor(ctx, comment); err != nil {
+			log.Printf("Failed to notify author of approved comment %s: %v\n", id, err)
+		}
+	}
+
+	return comment, nil
+}
+
+func canMoveComment(from, to string) bool {
+	for _, allowed := range commentTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// notifyAuthor emails the author of the comment's post, unless the author
+// wrote the comment.
+func (s *CommentService) notifyAuthor(ctx context.Context, comment *models.Comment) error {
+	post, err := s.postRepo.GetByID(ctx, comment.PostID)
+	if err != nil {
+		return err
+	}
+	if post == nil {
+		return ErrPostNotFound
+	}
+	if post.Author != nil && post.Author.UserID == comment.UserID {
+		return nil
+	}
+
+	return s.notifier.SendCommentApproved(ctx, post.Author, post, comment)
+}
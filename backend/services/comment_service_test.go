@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+func TestCommentTransitions(t *testing.T) {
+	statuses := []string{"pending", "approved", "flagged", "rejected", "spam"}
+	for _, status := range statuses {
+		if _, ok := commentTransitions[status]; !ok {
+			t.Errorf("commentTransitions has no entry for %s", status)
+		}
+	}
+
+	allowed := []struct{ from, to string }{
+		{"pending", "approved"},
+		{"pending", "spam"},
+		{"approved", "rejected"},
+		{"flagged", "approved"},
+		{"rejected", "approved"},
+	}
+	for _, move := range allowed {
+		if !canMoveComment(move.from, move.to) {
+			t.Errorf("%s -> %s is refused, want allowed", move.from, move.to)
+		}
+	}
+
+	// Only an override sends a comment back to pending, and flagged is
+	// only reached through reports
+	for _, from := range statuses {
+		for _, to := range []string{"pending", "flagged"} {
+			if canMoveComment(from, to) {
+				t.Errorf("%s -> %s is allowed, want refused", from, to)
+			}
+		}
+	}
+
+	for _, to := range statuses {
+		if canMoveComment("spam", to) {
+			t.Errorf("spam -> %s is allowed, want spam to be final", to)
+		}
+	}
+}
+
+// The third report flags an approved comment; approving it again clears the
+// reports so it takes three new ones to flag it again.
+func TestCommentReportsFlagAtThreshold(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	postRepo := repositories.NewPostRepository(pool, nil, repositories.NewRedirectRepository(pool))
+	reportRepo := repositories.NewCommentReportRepository(pool)
+	service := NewCommentService(
+		repositories.NewCommentRepository(pool, nil, repositories.NewUserRepository(pool, nil)),
+		reportRepo,
+		postRepo,
+		nil,
+	)
+
+	// Created first so that they are deleted after their reports
+	commenter := createTestUser(t, pool)
+	var reporters []uuid.UUID
+	for i := 0; i < CommentFlagThreshold+1; i++ {
+		reporters = append(reporters, createTestUser(t, pool).ID)
+	}
+
+	authorID, err := postRepo.AuthorIDForUser(ctx, commenter.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.posts WHERE author_id = $1"), authorID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.authors WHERE id = $1"), authorID)
+	})
+	var postID, commentID uuid.UUID
+	slug := dbtest.UniqueName("reported")
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.posts (title, slug, content, author_id, status, published_at)
+		VALUES ($1, $1, 'Content', $2, 'published', NOW())
+		RETURNING id
+	`), slug, authorID).Scan(&postID); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.comments (post_id, user_id, content, status)
+		VALUES ($1, $2, 'Rude words', 'approved')
+		RETURNING id
+	`), postID, commenter.ID).Scan(&commentID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.audit_logs WHERE entity_id = $1"), commentID.String())
+	})
+
+	status := func() string {
+		t.Helper()
+		var s string
+		if err := pool.QueryRow(ctx, database.Qualify("SELECT status FROM {blog}.comments WHERE id = $1"), commentID).Scan(&s); err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	for i := 0; i < CommentFlagThreshold-1; i++ {
+		if _, err := service.Report(ctx, commentID, reporters[i], "offensive"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := status(); got != "approved" {
+		t.Errorf("status after %d reports = %s, want approved", CommentFlagThreshold-1, got)
+	}
+	if _, err := service.Report(ctx, commentID, reporters[0], "offensive"); !errors.Is(err, repositories.ErrAlreadyReported) {
+		t.Errorf("second report by the same reader: err = %v, want ErrAlreadyReported", err)
+	}
+	if got := status(); got != "approved" {
+		t.Errorf("status after a duplicate report = %s, want approved", got)
+	}
+
+	if _, err := service.Report(ctx, commentID, reporters[CommentFlagThreshold-1], "offensive"); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != "flagged" {
+		t.Fatalf("status after %d reports = %s, want flagged", CommentFlagThreshold, got)
+	}
+
+	if _, err := service.SetStatus(ctx, commentID, uuid.Nil, &models.UpdateCommentStatusRequest{Status: "approved"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Report(ctx, commentID, reporters[CommentFlagThreshold], "offensive"); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(); got != "approved" {
+		t.Errorf("status after one report on a re-approved comment = %s, want approved", got)
+	}
+}
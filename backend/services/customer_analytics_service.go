@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// CustomerAnalyticsService reports on a single customer's purchase history.
+type CustomerAnalyticsService struct {
+	analyticsRepo *repositories.AnalyticsRepository
+}
+
+func NewCustomerAnalyticsService(analyticsRepo *repositories.AnalyticsRepository) *CustomerAnalyticsService {
+	return &CustomerAnalyticsService{analyticsRepo: analyticsRepo}
+}
+
+// GetCustomerAnalytics returns the customer's purchase analytics, or
+// repositories.ErrCustomerNotFound.
+func (s *CustomerAnalyticsService) GetCustomerAnalytics(ctx context.Context, customerID uuid.UUID) (*models.CustomerAnalytics, error) {
+	analytics, err := s.analyticsRepo.CustomerOrderSummary(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+	if analytics == nil {
+		return nil, repositories.ErrCustomerNotFound
+	}
+
+	analytics.MostPurchasedProduct, analytics.RepeatProductCount, err = s.analyticsRepo.CustomerProductStats(ctx, customerID)
+	if err != nil {
+		return nil, err
+	}
+
+	// The gaps between consecutive orders add up to the span from the first
+	// order to the last, so their mean needs no per-order query
+	if analytics.TotalOrders > 1 {
+		span := analytics.LastOrderAt.Sub(*analytics.FirstOrderAt)
+		avgDays := span.Hours() / 24 / float64(analytics.TotalOrders-1)
+		analytics.AvgDaysBetweenOrders = &avgDays
+	}
+
+	return analytics, nil
+}
@@ -0,0 +1,119 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// Five orders on known dates, and a cancelled one that must not count.
+func TestGetCustomerAnalytics(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	service := NewCustomerAnalyticsService(repositories.NewAnalyticsRepository(pool))
+
+	products := map[string]uuid.UUID{}
+	for _, name := range []string{"apron", "basket", "candle"} {
+		slug := dbtest.UniqueName(name)
+		var id uuid.UUID
+		if err := pool.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.products (name, slug, description, price, sku, stock)
+			VALUES ($1, $2, 'A test product', 10, $2, 100)
+			RETURNING id
+		`), name, slug).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.products WHERE id = $1"), id)
+		})
+		products[name] = id
+	}
+
+	newCustomer := func() uuid.UUID {
+		t.Helper()
+		user := createTestUser(t, pool)
+		customer, err := repositories.NewCustomerRepository(pool, nil).GetOrCreateByUserID(ctx, user.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.orders WHERE customer_id = $1"), customer.ID)
+			dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.customers WHERE id = $1"), customer.ID)
+		})
+		return customer.ID
+	}
+	day := func(month time.Month, d int) time.Time { return time.Date(2099, month, d, 12, 0, 0, 0, time.UTC) }
+	placeOrder := func(customerID uuid.UUID, status string, total float64, method string, at time.Time, units map[string]int) {
+		t.Helper()
+		var orderID uuid.UUID
+		if err := pool.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.orders (customer_id, status, total_amount, shipping_address, billing_address,
+				payment_method, payment_status, created_at)
+			VALUES ($1, $2, $3, '{}', '{}', $4, 'paid', $5)
+			RETURNING id
+		`), customerID, status, total, method, at).Scan(&orderID); err != nil {
+			t.Fatal(err)
+		}
+		for name, quantity := range units {
+			dbtest.Exec(t, pool, database.Qualify(`
+				INSERT INTO {shop}.order_items (order_id, product_id, quantity, price) VALUES ($1, $2, $3, 10)
+			`), orderID, products[name], quantity)
+		}
+	}
+
+	customerID := newCustomer()
+	placeOrder(customerID, "delivered", 10, "card", day(1, 1), map[string]int{"apron": 2})
+	placeOrder(customerID, "delivered", 20, "paypal", day(1, 11), map[string]int{"basket": 5})
+	placeOrder(customerID, "delivered", 30, "paypal", day(1, 31), map[string]int{"apron": 1})
+	placeOrder(customerID, "shipped", 40, "card", day(2, 10), map[string]int{"candle": 1})
+	placeOrder(customerID, "confirmed", 50, "paypal", day(3, 2), map[string]int{"candle": 1})
+	placeOrder(customerID, "cancelled", 1000, "card", day(1, 5), map[string]int{"apron": 100, "basket": 100})
+
+	analytics, err := service.GetCustomerAnalytics(ctx, customerID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analytics.FirstOrderAt == nil || !analytics.FirstOrderAt.Equal(day(1, 1)) {
+		t.Errorf("first order at %v, want %v", analytics.FirstOrderAt, day(1, 1))
+	}
+	if analytics.LastOrderAt == nil || !analytics.LastOrderAt.Equal(day(3, 2)) {
+		t.Errorf("last order at %v, want %v", analytics.LastOrderAt, day(3, 2))
+	}
+	if analytics.TotalOrders != 5 || analytics.TotalSpent != 150 {
+		t.Errorf("%d orders totalling %v, want 5 totalling 150", analytics.TotalOrders, analytics.TotalSpent)
+	}
+	// 60 days from 1 January to 2 March, over 4 gaps
+	if avg := analytics.AvgDaysBetweenOrders; avg == nil || *avg != 15 {
+		t.Errorf("avg days between orders = %v, want 15", avg)
+	}
+	if p := analytics.MostPurchasedProduct; p == nil || p.ProductID != products["basket"] || p.Name != "basket" || p.TotalUnits != 5 {
+		t.Errorf("most purchased = %+v, want 5 units of basket", p)
+	}
+	if analytics.RepeatProductCount != 2 {
+		t.Errorf("repeat products = %d, want 2 (apron and candle)", analytics.RepeatProductCount)
+	}
+	if m := analytics.PreferredPaymentMethod; m == nil || *m != "paypal" {
+		t.Errorf("preferred payment method = %v, want paypal", m)
+	}
+
+	oneOrder := newCustomer()
+	placeOrder(oneOrder, "delivered", 25, "card", day(4, 1), map[string]int{"apron": 1})
+	analytics, err = service.GetCustomerAnalytics(ctx, oneOrder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if analytics.TotalOrders != 1 || analytics.AvgDaysBetweenOrders != nil || analytics.RepeatProductCount != 0 {
+		t.Errorf("one order: %d orders, avg %v, %d repeats; want 1, nil, 0",
+			analytics.TotalOrders, analytics.AvgDaysBetweenOrders, analytics.RepeatProductCount)
+	}
+
+	if _, err := service.GetCustomerAnalytics(ctx, uuid.New()); !errors.Is(err, repositories.ErrCustomerNotFound) {
+		t.Errorf("unknown customer: err = %v, want ErrCustomerNotFound", err)
+	}
+}
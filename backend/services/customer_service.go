@@ -0,0 +1,24 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+var ErrMergeSameCustomer = repositories.ErrMergeSameCustomer
+
+type CustomerService struct {
+	customerRepo *repositories.CustomerRepository
+}
+
+func NewCustomerService(customerRepo *repositories.CustomerRepository) *CustomerService {
+	return &CustomerService{customerRepo: customerRepo}
+}
+
+// Merge folds a duplicate customer account into the primary one on behalf
+// of the admin actorID. The secondary account is anonymized.
+func (s *CustomerService) Merge(ctx context.Context, actorID, primaryID, secondaryID uuid.UUID) error {
+	return s.customerRepo.Merge(ctx, primaryID, secondaryID, actorID)
+}
@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// EmailService emails users about their account and their orders, and
+// authors about their posts. Emails are rendered from the email templates and queued; EmailWorker
+// sends them through the configured Mailer and retries failures.
+type EmailService struct {
+	queueRepo *repositories.EmailQueueRepository
+	templates *EmailTemplateService
+	siteName  string
+	siteURL   string
+}
+
+func NewEmailService(queueRepo *repositories.EmailQueueRepository, templates *EmailTemplateService, siteName, siteURL string) *EmailService {
+	return &EmailService{
+		queueRepo: queueRepo,
+		templates: templates,
+		siteName:  siteName,
+		siteURL:   strings.TrimRight(siteURL, "/"),
+	}
+}
+
+// SendOrderConfirmation tells the customer that their order was placed.
+func (s *EmailService) SendOrderConfirmation(ctx context.Context, order *models.Order) error {
+	return s.sendOrderEmail(ctx, "order_confirmation", order)
+}
+
+// SendShippingNotification tells the customer that their order is on its
+// way.
+func (s *EmailService) SendShippingNotification(ctx context.Context, order *models.Order) error {
+	return s.sendOrderEmail(ctx, "order_shipped", order)
+}
+
+// SendPasswordReset sends the user a link to choose a new password with the
+// given reset token.
+func (s *EmailService) SendPasswordReset(ctx context.Context, user *models.User, token string) error {
+	return s.send(ctx, user.Email, "password_reset", map[string]string{
+		"Name":     user.FullName,
+		"URL":      s.siteURL + "/reset-password?token=" + url.QueryEscape(token),
+		"SiteName": s.siteName,
+	})
+}
+
+// SendWelcome greets a newly registered user.
+func (s *EmailService) SendWelcome(ctx context.Context, user *models.User) error {
+	return s.send(ctx, user.Email, "welcome", map[string]string{
+		"Name":     user.FullName,
+		"URL":      s.siteURL,
+		"SiteName": s.siteName,
+	})
+}
+
+// SendPostPublished tells the author that their post is live, with a link
+// to it.
+func (s *EmailService) SendPostPublished(ctx context.Context, author *models.Author, post *models.Post) error {
+	if author == nil || author.User == nil {
+		return errors.New("post author has no user account")
+	}
+
+	publishedAt := time.Now()
+	if post.PublishedAt != nil {
+		publishedAt = *post.PublishedAt
+	}
+
+	return s.send(ctx, author.User.Email, "post_published", map[string]string{
+		"Name":        author.User.FullName,
+		"Title":       post.Title,
+		"PublishedAt": publishedAt.UTC().Format("January 2, 2006 at 15:04 MST"),
+		"URL":         s.siteURL + "/blog/" + post.Slug,
+		"SiteName":    s.siteName,
+	})
+}
+
+// SendCommentApproved tells the author that a comment on their post was
+// approved, quoting the start of it.
+func (s *EmailService) SendCommentApproved(ctx context.Context, author *models.Author, post *models.Post, comment *models.Comment) error {
+	if author == nil || author.User == nil {
+		return errors.New("post author has no user account")
+	}
+
+	return s.send(ctx, author.User.Email, "comment_approved", map[string]string{
+		"Name":     author.User.FullName,
+		"Title":    post.Title,
+		"Comment":  truncateRunes(comment.Content, 280),
+		"URL":      s.siteURL + "/blog/" + post.Slug + "#comment-" + comment.ID.String(),
+		"SiteName": s.siteName,
+	})
+}
+
+// sendOrderEmail sends an email about the order to its customer. The order
+// must have the customer's name and email filled in.
+func (s *EmailService) sendOrderEmail(ctx context.Context, name string, order *models.Order) error {
+	if order.CustomerEmail == "" {
+		return errors.New("order customer has no email address")
+	}
+
+	return s.send(ctx, order.CustomerEmail, name, map[string]string{
+		"Name":        order.CustomerName,
+		"OrderNumber": strings.ToUpper(order.ID.String()[:8]),
+		"Total":       fmt.Sprintf("%.2f", order.TotalAmount),
+		"URL":         s.siteURL + "/account/orders/" + order.ID.String(),
+		"SiteName":    s.siteName,
+	})
+}
+
+func (s *EmailService) send(ctx context.Context, to, name string, data map[string]string) error {
+	email, err := s.templates.Render(ctx, name, data)
+	if err != nil {
+		return err
+	}
+
+	return s.queueRepo.Enqueue(ctx, &models.QueuedEmail{
+		To:       to,
+		Subject:  email.Subject,
+		BodyHTML: email.HTML,
+		BodyText: email.Text,
+	})
+}
+
+// truncateRunes shortens s to at most n runes, marking the cut with an
+// ellipsis.
+func truncateRunes(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
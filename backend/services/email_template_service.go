@@ -0,0 +1,429 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"sort"
+	"sync"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+var (
+	ErrEmailTemplateNotFound = errors.New("email template not found")
+	ErrInvalidEmailTemplate  = errors.New("invalid email template")
+)
+
+// builtinEmailTemplate is an email the site sends, with the template it uses
+// until an admin overrides it and the data its preview is rendered with.
+type builtinEmailTemplate struct {
+	models.EmailTemplate
+	sample map[string]string
+}
+
+var builtinEmailTemplates = map[string]*builtinEmailTemplate{
+	"comment_approved": {
+		EmailTemplate: models.EmailTemplate{
+			Name: "comment_approved",
+			Description: "Sent to the author when a comment on their post is approved. Variables: " +
+				"{{.Name}} the author's full name, {{.Title}} the post title, " +
+				"{{.Comment}} the start of the comment, {{.URL}} the comment's address, " +
+				"{{.SiteName}} the site name.",
+			Subject: "New comment on {{.Title}}",
+			HTMLBody: `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+  <p>Hi {{.Name}},</p>
+  <p>A new comment on your post <strong>{{.Title}}</strong> was approved:</p>
+  <blockquote style="margin: 0 0 16px; padding-left: 12px; border-left: 3px solid #ccc;">{{.Comment}}</blockquote>
+  <p>
+    <a href="{{.URL}}" style="display: inline-block; padding: 10px 20px; background: #2563eb; color: #fff; text-decoration: none; border-radius: 4px;">View Comment</a>
+  </p>
+  <p>{{.SiteName}}</p>
+</body>
+</html>
+`,
+			TextBody: `Hi {{.Name}},
+
+A new comment on your post "{{.Title}}" was approved:
+
+{{.Comment}}
+
+View it at {{.URL}}
+
+{{.SiteName}}
+`,
+		},
+		sample: map[string]string{
+			"Name":     "Jane Doe",
+			"Title":    "Hello World",
+			"Comment":  "Great post, thanks for writing it up!",
+			"URL":      "https://example.com/blog/hello-world#comment-1",
+			"SiteName": "Integrated Site",
+		},
+	},
+	"order_confirmation": {
+		EmailTemplate: models.EmailTemplate{
+			Name: "order_confirmation",
+			Description: "Sent to the customer when they place an order. Variables: " +
+				"{{.Name}} the customer's full name, {{.OrderNumber}} the order's short reference, " +
+				"{{.Total}} the order total, {{.URL}} the order's address, " +
+				"{{.SiteName}} the site name.",
+			Subject: "Thanks for your order {{.OrderNumber}}",
+			HTMLBody: `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+  <p>Hi {{.Name}},</p>
+  <p>Thanks for your order <strong>{{.OrderNumber}}</strong> ({{.Total}}). We will let you know when it ships.</p>
+  <p>
+    <a href="{{.URL}}" style="display: inline-block; padding: 10px 20px; background: #2563eb; color: #fff; text-decoration: none; border-radius: 4px;">View Order</a>
+  </p>
+  <p>{{.SiteName}}</p>
+</body>
+</html>
+`,
+			TextBody: `Hi {{.Name}},
+
+Thanks for your order {{.OrderNumber}} ({{.Total}}). We will let you know when it ships.
+
+View it at {{.URL}}
+
+{{.SiteName}}
+`,
+		},
+		sample: map[string]string{
+			"Name":        "Jane Doe",
+			"OrderNumber": "1A2B3C4D",
+			"Total":       "49.99",
+			"URL":         "https://example.com/account/orders/1a2b3c4d-0000-0000-0000-000000000000",
+			"SiteName":    "Integrated Site",
+		},
+	},
+	"order_shipped": {
+		EmailTemplate: models.EmailTemplate{
+			Name: "order_shipped",
+			Description: "Sent to the customer when their order ships. Variables: " +
+				"{{.Name}} the customer's full name, {{.OrderNumber}} the order's short reference, " +
+				"{{.Total}} the order total, {{.URL}} the order's address, " +
+				"{{.SiteName}} the site name.",
+			Subject: "Your order {{.OrderNumber}} has shipped",
+			HTMLBody: `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+  <p>Hi {{.Name}},</p>
+  <p>Your order <strong>{{.OrderNumber}}</strong> ({{.Total}}) is on its way.</p>
+  <p>
+    <a href="{{.URL}}" style="display: inline-block; padding: 10px 20px; background: #2563eb; color: #fff; text-decoration: none; border-radius: 4px;">View Order</a>
+  </p>
+  <p>{{.SiteName}}</p>
+</body>
+</html>
+`,
+			TextBody: `Hi {{.Name}},
+
+Your order {{.OrderNumber}} ({{.Total}}) is on its way.
+
+View it at {{.URL}}
+
+{{.SiteName}}
+`,
+		},
+		sample: map[string]string{
+			"Name":        "Jane Doe",
+			"OrderNumber": "1A2B3C4D",
+			"Total":       "49.99",
+			"URL":         "https://example.com/account/orders/1a2b3c4d-0000-0000-0000-000000000000",
+			"SiteName":    "Integrated Site",
+		},
+	},
+	"password_reset": {
+		EmailTemplate: models.EmailTemplate{
+			Name: "password_reset",
+			Description: "Sent to a user who asked to reset their password. Variables: " +
+				"{{.Name}} the user's full name, {{.URL}} the address to choose a new password at, " +
+				"{{.SiteName}} the site name.",
+			Subject: "Reset your {{.SiteName}} password",
+			HTMLBody: `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+  <p>Hi {{.Name}},</p>
+  <p>Someone asked to reset the password of your account. If it was you, choose a new password below.</p>
+  <p>If it was not you, ignore this email; your password stays as it is.</p>
+  <p>
+    <a href="{{.URL}}" style="display: inline-block; padding: 10px 20px; background: #2563eb; color: #fff; text-decoration: none; border-radius: 4px;">Reset Password</a>
+  </p>
+  <p>{{.SiteName}}</p>
+</body>
+</html>
+`,
+			TextBody: `Hi {{.Name}},
+
+Someone asked to reset the password of your account. If it was you, choose a new password at:
+
+{{.URL}}
+
+If it was not you, ignore this email; your password stays as it is.
+
+{{.SiteName}}
+`,
+		},
+		sample: map[string]string{
+			"Name":     "Jane Doe",
+			"URL":      "https://example.com/reset-password?token=abc123",
+			"SiteName": "Integrated Site",
+		},
+	},
+	"post_published": {
+		EmailTemplate: models.EmailTemplate{
+			Name: "post_published",
+			Description: "Sent to the author when a scheduled post is published. Variables: " +
+				"{{.Name}} the author's full name, {{.Title}} the post title, " +
+				"{{.PublishedAt}} the publication time, {{.URL}} the post's address, " +
+				"{{.SiteName}} the site name.",
+			Subject: "Your post is live: {{.Title}}",
+			HTMLBody: `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+  <p>Hi {{.Name}},</p>
+  <p>Your post <strong>{{.Title}}</strong> was published on {{.PublishedAt}}.</p>
+  <p>
+    <a href="{{.URL}}" style="display: inline-block; padding: 10px 20px; background: #2563eb; color: #fff; text-decoration: none; border-radius: 4px;">View Post</a>
+  </p>
+  <p>{{.SiteName}}</p>
+</body>
+</html>
+`,
+			TextBody: `Hi {{.Name}},
+
+Your post "{{.Title}}" was published on {{.PublishedAt}}.
+
+View it at {{.URL}}
+
+{{.SiteName}}
+`,
+		},
+		sample: map[string]string{
+			"Name":        "Jane Doe",
+			"Title":       "Hello World",
+			"PublishedAt": "January 2, 2006 at 15:04 UTC",
+			"URL":         "https://example.com/blog/hello-world",
+			"SiteName":    "Integrated Site",
+		},
+	},
+	"welcome": {
+		EmailTemplate: models.EmailTemplate{
+			Name: "welcome",
+			Description: "Sent to a user when they register. Variables: " +
+				"{{.Name}} the user's full name, {{.URL}} the site's address, " +
+				"{{.SiteName}} the site name.",
+			Subject: "Welcome to {{.SiteName}}",
+			HTMLBody: `<!DOCTYPE html>
+<html>
+<body style="font-family: sans-serif; color: #222;">
+  <p>Hi {{.Name}},</p>
+  <p>Thanks for signing up to {{.SiteName}}. Your account is ready to use.</p>
+  <p>
+    <a href="{{.URL}}" style="display: inline-block; padding: 10px 20px; background: #2563eb; color: #fff; text-decoration: none; border-radius: 4px;">Visit {{.SiteName}}</a>
+  </p>
+  <p>{{.SiteName}}</p>
+</body>
+</html>
+`,
+			TextBody: `Hi {{.Name}},
+
+Thanks for signing up to {{.SiteName}}. Your account is ready to use.
+
+Visit us at {{.URL}}
+
+{{.SiteName}}
+`,
+		},
+		sample: map[string]string{
+			"Name":     "Jane Doe",
+			"URL":      "https://example.com",
+			"SiteName": "Integrated Site",
+		},
+	},
+}
+
+// emailTemplateCacheTTL bounds how long another instance's edit takes to be
+// picked up. Edits made through this instance apply immediately.
+const emailTemplateCacheTTL = time.Minute
+
+// compiledEmailTemplate is a parsed template, cached with when it was loaded.
+type compiledEmailTemplate struct {
+	subject  *texttemplate.Template
+	html     *htmltemplate.Template
+	text     *texttemplate.Template
+	loadedAt time.Time
+}
+
+// RenderedEmail is an email template executed with data.
+type RenderedEmail struct {
+	Subject string `json:"subject"`
+	HTML    string `json:"html"`
+	Text    string `json:"text"`
+}
+
+// EmailTemplateService renders the site's emails from their templates. An
+// admin override stored in the database takes the place of the built-in
+// template of the same name.
+type EmailTemplateService struct {
+	templateRepo *repositories.EmailTemplateRepository
+	now          func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]*compiledEmailTemplate
+}
+
+func NewEmailTemplateService(templateRepo *repositories.EmailTemplateRepository) *EmailTemplateService {
+	return &EmailTemplateService{
+		templateRepo: templateRepo,
+		now:          time.Now,
+		cache:        map[string]*compiledEmailTemplate{},
+	}
+}
+
+// List returns every email template, overridden or built-in, by name.
+func (s *EmailTemplateService) List(ctx context.Context) ([]*models.EmailTemplate, error) {
+	overrides, err := s.templateRepo.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := make([]*models.EmailTemplate, 0, len(builtinEmailTemplates))
+	for name, builtin := range builtinEmailTemplates {
+		if override, ok := overrides[name]; ok {
+			templates = append(templates, override)
+			continue
+		}
+		template := builtin.EmailTemplate
+		templates = append(templates, &template)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+
+	return templates, nil
+}
+
+// Update overrides the named built-in template. The template must parse.
+func (s *EmailTemplateService) Update(ctx context.Context, name string, req *models.UpdateEmailTemplateRequest) (*models.EmailTemplate, error) {
+	builtin, ok := builtinEmailTemplates[name]
+	if !ok {
+		return nil, ErrEmailTemplateNotFound
+	}
+
+	template := &models.EmailTemplate{
+		Name:        name,
+		Description: builtin.Description,
+		Subject:     req.Subject,
+		HTMLBody:    req.HTMLBody,
+		TextBody:    req.TextBody,
+		IsCustom:    true,
+	}
+	compiled, err := compileEmailTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.templateRepo.Upsert(ctx, template); err != nil {
+		return nil, err
+	}
+
+	compiled.loadedAt = s.now()
+	s.mu.Lock()
+	s.cache[name] = compiled
+	s.mu.Unlock()
+
+	return template, nil
+}
+
+// Preview renders the named template with sample data.
+func (s *EmailTemplateService) Preview(ctx context.Context, name string) (*RenderedEmail, error) {
+	builtin, ok := builtinEmailTemplates[name]
+	if !ok {
+		return nil, ErrEmailTemplateNotFound
+	}
+	return s.Render(ctx, name, builtin.sample)
+}
+
+// Render executes the named template with data. Variables missing from
+// data render empty.
+func (s *EmailTemplateService) Render(ctx context.Context, name string, data map[string]string) (*RenderedEmail, error) {
+	compiled, err := s.load(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	var subject, html, text bytes.Buffer
+	if err := compiled.subject.Execute(&subject, data); err != nil {
+		return nil, err
+	}
+	if err := compiled.html.Execute(&html, data); err != nil {
+		return nil, err
+	}
+	if err := compiled.text.Execute(&text, data); err != nil {
+		return nil, err
+	}
+
+	return &RenderedEmail{Subject: subject.String(), HTML: html.String(), Text: text.String()}, nil
+}
+
+// load returns the named template from the cache, or else the override from
+// the database, or else the built-in template.
+func (s *EmailTemplateService) load(ctx context.Context, name string) (*compiledEmailTemplate, error) {
+	builtin, ok := builtinEmailTemplates[name]
+	if !ok {
+		return nil, ErrEmailTemplateNotFound
+	}
+
+	now := s.now()
+	s.mu.Lock()
+	compiled, ok := s.cache[name]
+	s.mu.Unlock()
+	if ok && now.Sub(compiled.loadedAt) < emailTemplateCacheTTL {
+		return compiled, nil
+	}
+
+	template, err := s.templateRepo.GetByName(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if template == nil {
+		template = &builtin.EmailTemplate
+	}
+
+	compiled, err = compileEmailTemplate(template)
+	if err != nil {
+		return nil, err
+	}
+	compiled.loadedAt = now
+
+	s.mu.Lock()
+	s.cache[name] = compiled
+	s.mu.Unlock()
+
+	return compiled, nil
+}
+
+func compileEmailTemplate(template *models.EmailTemplate) (*compiledEmailTemplate, error) {
+	subject, err := texttemplate.New("subject").Option("missingkey=zero").Parse(template.Subject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: subject: %v", ErrInvalidEmailTemplate, err)
+	}
+	html, err := htmltemplate.New("html").Option("missingkey=zero").Parse(template.HTMLBody)
+	if err != nil {
+		return nil, fmt.Errorf("%w: html_body: %v", ErrInvalidEmailTemplate, err)
+	}
+	text, err := texttemplate.New("text").Option("missingkey=zero").Parse(template.TextBody)
+	if err != nil {
+		return nil, fmt.Errorf("%w: text_body: %v", ErrInvalidEmailTemplate, err)
+	}
+
+	return &compiledEmailTemplate{subject: subject, html: html, text: text}, nil
+}
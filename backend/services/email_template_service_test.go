@@ -0,0 +1,104 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+func TestUpdateRejectsTemplatesThatDoNotParse(t *testing.T) {
+	// Rejected before the repository is used, so none is needed
+	service := NewEmailTemplateService(nil)
+
+	_, err := service.Update(context.Background(), "welcome", &models.UpdateEmailTemplateRequest{
+		Subject:  "Welcome {{.Name",
+		HTMLBody: "<p>Hi</p>",
+	})
+	if !errors.Is(err, ErrInvalidEmailTemplate) {
+		t.Errorf("err = %v, want ErrInvalidEmailTemplate", err)
+	}
+	if _, err := service.Update(context.Background(), "unknown", &models.UpdateEmailTemplateRequest{}); !errors.Is(err, ErrEmailTemplateNotFound) {
+		t.Errorf("unknown template: err = %v, want ErrEmailTemplateNotFound", err)
+	}
+}
+
+// Without an override an email renders from its built-in template; with one
+// it renders from the override, and once the override is gone it falls
+// back again. The overrides live in their own prefixed schema, so other
+// tests keep seeing the built-in templates.
+func TestEmailTemplateFallsBackToBuiltin(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+
+	prefix := strings.ReplaceAll(dbtest.UniqueName("test"), "-", "") + "_"
+	dbtest.Exec(t, pool, "CREATE SCHEMA "+prefix+"cms")
+	t.Cleanup(func() { dbtest.Exec(t, pool, "DROP SCHEMA "+prefix+"cms CASCADE") })
+	dbtest.Exec(t, pool, "CREATE TABLE "+prefix+"cms.email_templates (LIKE cms.email_templates INCLUDING ALL)")
+	if err := database.SetSchemaPrefix(prefix); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.SetSchemaPrefix("") })
+
+	templateRepo := repositories.NewEmailTemplateRepository(pool)
+	service := NewEmailTemplateService(templateRepo)
+	clock := time.Now()
+	service.now = func() time.Time { return clock }
+	data := map[string]string{"Name": "Ada", "SiteName": "Integrated Site", "URL": "https://example.com"}
+
+	email, err := service.Render(ctx, "welcome", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Subject != "Welcome to Integrated Site" || !strings.Contains(email.HTML, "<p>Hi Ada,</p>") {
+		t.Errorf("without an override: %q, %q; want the built-in welcome", email.Subject, email.HTML)
+	}
+
+	if _, err := service.Update(ctx, "welcome", &models.UpdateEmailTemplateRequest{
+		Subject:  "Hello {{.Name}}",
+		HTMLBody: "<p>Custom welcome to {{.SiteName}}</p>",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	email, err = service.Render(ctx, "welcome", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Subject != "Hello Ada" || email.HTML != "<p>Custom welcome to Integrated Site</p>" {
+		t.Errorf("with an override: %q, %q; want the override", email.Subject, email.HTML)
+	}
+
+	// Another instance has nothing cached and reads the override back
+	fresh, err := NewEmailTemplateService(templateRepo).Render(ctx, "welcome", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Subject != "Hello Ada" {
+		t.Errorf("another instance renders %q, want the stored override", fresh.Subject)
+	}
+
+	// Other templates are still built in
+	reset, err := service.Render(ctx, "password_reset", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reset.Subject != "Reset your Integrated Site password" {
+		t.Errorf("password reset subject = %q, want the built-in one", reset.Subject)
+	}
+
+	dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.email_templates WHERE name = 'welcome'"))
+	clock = clock.Add(emailTemplateCacheTTL)
+	email, err = service.Render(ctx, "welcome", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if email.Subject != "Welcome to Integrated Site" {
+		t.Errorf("after the override was removed: %q, want the built-in welcome", email.Subject)
+	}
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// emailRetryDelays are the waits before each retry of a failed send. An
+// email is sent once and retried once per delay; if the last retry fails
+// too it is marked failed.
+var emailRetryDelays = []time.Duration{30 * time.Second, 5 * time.Minute, 30 * time.Minute, 3 * time.Hour}
+
+const (
+	// emailBatchSize is how many emails one run claims from the queue.
+	emailBatchSize = 50
+	// emailSendLease keeps claimed emails from other workers while they are
+	// sent. It outlasts any SMTP timeout.
+	emailSendLease = 10 * time.Minute
+)
+
+var ErrInvalidEmailStatus = errors.New("invalid email status")
+
+// EmailWorker sends the queued emails.
+type EmailWorker struct {
+	queueRepo *repositories.EmailQueueRepository
+	mailer    Mailer
+	now       func() time.Time
+}
+
+func NewEmailWorker(queueRepo *repositories.EmailQueueRepository, mailer Mailer) *EmailWorker {
+	return &EmailWorker{queueRepo: queueRepo, mailer: mailer, now: time.Now}
+}
+
+// ProcessQueue sends the emails that are due. A failed send is scheduled
+// for a retry, or marked failed once the retries are used up; it is not an
+// error of the run. Only queue updates that fail are returned.
+func (w *EmailWorker) ProcessQueue(ctx context.Context) error {
+	now := w.now()
+	emails, err := w.queueRepo.ClaimDue(ctx, now, now.Add(emailSendLease), emailBatchSize)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, email := range emails {
+		if err := w.send(ctx, email); err != nil {
+			errs = append(errs, fmt.Errorf("email %s: %w", email.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (w *EmailWorker) send(ctx context.Context, email *models.QueuedEmail) error {
+	sendErr := w.mailer.Send(ctx, email)
+	if sendErr == nil {
+		return w.queueRepo.MarkSent(ctx, email.ID)
+	}
+
+	return w.queueRepo.MarkAttemptFailed(ctx, email.ID, sendErr.Error(), nextEmailRetry(email.Attempts, w.now()))
+}
+
+// nextEmailRetry returns when to retry an email that has just failed after
+// the given number of earlier attempts, or nil if it should be given up.
+func nextEmailRetry(previousAttempts int, now time.Time) *time.Time {
+	if previousAttempts >= len(emailRetryDelays) {
+		return nil
+	}
+	next := now.Add(emailRetryDelays[previousAttempts])
+	return &next
+}
+
+// EmailQueueService lets admins inspect the send queue and retry emails.
+type EmailQueueService struct {
+	queueRepo *repositories.EmailQueueRepository
+}
+
+func NewEmailQueueService(queueRepo *repositories.EmailQueueRepository) *EmailQueueService {
+	return &EmailQueueService{queueRepo: queueRepo}
+}
+
+// List returns a page of the queued emails with the given status.
+func (s *EmailQueueService) List(ctx context.Context, status string, limit, offset int) ([]*models.QueuedEmail, int, error) {
+	switch status {
+	case "pending", "sent", "failed":
+	default:
+		return nil, 0, ErrInvalidEmailStatus
+	}
+	return s.queueRepo.ListByStatus(ctx, status, limit, offset)
+}
+
+// Retry sends the email again on the worker's next run, with a fresh set of
+// retries. Sent emails cannot be retried.
+func (s *EmailQueueService) Retry(ctx context.Context, id uuid.UUID) error {
+	return s.queueRepo.Retry(ctx, id)
+}
@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// failingMailer stands in for an SMTP server. Sends fail with err while it
+// is set.
+type failingMailer struct {
+	err   error
+	sends int
+}
+
+func (m *failingMailer) Send(ctx context.Context, email *models.QueuedEmail) error {
+	m.sends++
+	return m.err
+}
+
+func TestNextEmailRetry(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 5 * time.Minute},
+		{2, 30 * time.Minute},
+		{3, 3 * time.Hour},
+	}
+	for _, tt := range tests {
+		if got := nextEmailRetry(tt.attempts, now); got == nil || got.Sub(now) != tt.want {
+			t.Errorf("nextEmailRetry(%d) = %v, want now + %v", tt.attempts, got, tt.want)
+		}
+	}
+	if got := nextEmailRetry(len(emailRetryDelays), now); got != nil {
+		t.Errorf("nextEmailRetry after every retry = %v, want nil", got)
+	}
+}
+
+// While SMTP is down an email is retried after 30s, 5m, 30m and 3h, then
+// marked failed. An admin's retry sends it again once SMTP is back. The
+// queue lives in its own prefixed schema, so the worker only sees it.
+func TestEmailWorkerRetriesFailedSends(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+
+	prefix := strings.ReplaceAll(dbtest.UniqueName("test"), "-", "") + "_"
+	dbtest.Exec(t, pool, "CREATE SCHEMA "+prefix+"cms")
+	t.Cleanup(func() { dbtest.Exec(t, pool, "DROP SCHEMA "+prefix+"cms CASCADE") })
+	dbtest.Exec(t, pool, "CREATE TABLE "+prefix+"cms.email_send_queue (LIKE cms.email_send_queue INCLUDING DEFAULTS)")
+	if err := database.SetSchemaPrefix(prefix); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { database.SetSchemaPrefix("") })
+
+	queueRepo := repositories.NewEmailQueueRepository(pool)
+	mailer := &failingMailer{err: errors.New("421 service not available")}
+	worker := NewEmailWorker(queueRepo, mailer)
+	clock := time.Now().Add(time.Minute)
+	worker.now = func() time.Time { return clock }
+
+	email := &models.QueuedEmail{To: "reader@example.com", Subject: "Welcome", BodyHTML: "<p>Hi</p>"}
+	if err := queueRepo.Enqueue(ctx, email); err != nil {
+		t.Fatal(err)
+	}
+	stored := func(status string) *models.QueuedEmail {
+		t.Helper()
+		emails, _, err := queueRepo.ListByStatus(ctx, status, 10, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(emails) != 1 {
+			t.Fatalf("%d %s emails, want the queued one", len(emails), status)
+		}
+		return emails[0]
+	}
+
+	for i, delay := range emailRetryDelays {
+		if err := worker.ProcessQueue(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if mailer.sends != i+1 {
+			t.Fatalf("%d sends, want %d", mailer.sends, i+1)
+		}
+		got := stored("pending")
+		if got.Attempts != i+1 || got.LastError != "421 service not available" {
+			t.Errorf("after send %d: attempts %d, last error %q", i+1, got.Attempts, got.LastError)
+		}
+		if want := clock.Add(delay); got.NextRetryAt.Sub(want).Abs() > time.Millisecond {
+			t.Errorf("after send %d: next retry at %v, want %v later", i+1, got.NextRetryAt, delay)
+		}
+
+		// Not due until the delay has passed
+		clock = clock.Add(delay - time.Second)
+		if err := worker.ProcessQueue(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if mailer.sends != i+1 {
+			t.Fatalf("sent again %v after send %d, before the %v delay", delay-time.Second, i+1, delay)
+		}
+		clock = clock.Add(time.Second)
+	}
+
+	if err := worker.ProcessQueue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := stored("failed"); got.Attempts != len(emailRetryDelays)+1 {
+		t.Errorf("failed after %d attempts, want %d", got.Attempts, len(emailRetryDelays)+1)
+	}
+	clock = clock.Add(24 * time.Hour)
+	if err := worker.ProcessQueue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if mailer.sends != len(emailRetryDelays)+1 {
+		t.Errorf("%d sends, want a failed email left alone", mailer.sends)
+	}
+
+	// The admin retries it once SMTP is back
+	if err := queueRepo.Retry(ctx, email.ID); err != nil {
+		t.Fatal(err)
+	}
+	mailer.err = nil
+	if err := worker.ProcessQueue(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := stored("sent"); got.SentAt == nil || got.LastError != "" {
+		t.Errorf("after the retry: sent at %v, last error %q; want sent", got.SentAt, got.LastError)
+	}
+	if err := queueRepo.Retry(ctx, email.ID); !errors.Is(err, repositories.ErrEmailNotFound) {
+		t.Errorf("retrying a sent email: err = %v, want ErrEmailNotFound", err)
+	}
+}
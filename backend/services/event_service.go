@@ -0,0 +1,27 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+type EventService struct {
+	eventRepo *repositories.EventRepository
+}
+
+func NewEventService(eventRepo *repositories.EventRepository) *EventService {
+	return &EventService{eventRepo: eventRepo}
+}
+
+// ListUpcoming returns events that have not started yet, soonest first.
+func (s *EventService) ListUpcoming(ctx context.Context, limit, offset int) ([]*models.Product, int, error) {
+	return s.eventRepo.ListUpcoming(ctx, limit, offset)
+}
+
+// CheckIn records attendance for a ticket of the given event.
+func (s *EventService) CheckIn(ctx context.Context, eventID, ticketID uuid.UUID) (*models.OrderTicket, error) {
+	return s.eventRepo.CheckIn(ctx, eventID, ticketID)
+}
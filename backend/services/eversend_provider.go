@@ -0,0 +1,59 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EversendProvider talks to the Eversend payments API.
+type EversendProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+func NewEversendProvider(baseURL, apiKey string) *EversendProvider {
+	return &EversendProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (p *EversendProvider) Name() string {
+	return "eversend"
+}
+
+// Ping calls the Eversend status endpoint, giving up after two seconds.
+func (p *EversendProvider) Ping(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/v1/status", nil)
+	if err != nil {
+		return err
+	}
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("eversend status endpoint returned %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// Check lets the provider be used as a health check.
+func (p *EversendProvider) Check(ctx context.Context) error {
+	return p.Ping(ctx)
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+type FeatureFlagService struct {
+	flagRepo *repositories.FeatureFlagRepository
+}
+
+func NewFeatureFlagService(flagRepo *repositories.FeatureFlagRepository) *FeatureFlagService {
+	return &FeatureFlagService{flagRepo: flagRepo}
+}
+
+// IsEnabledForUser reports whether the flag is on for the user. Unknown
+// flags are off.
+func (s *FeatureFlagService) IsEnabledForUser(ctx context.Context, key string, userID uuid.UUID, role string) (bool, error) {
+	flag, err := s.flagRepo.GetByKey(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	if flag == nil {
+		return false, nil
+	}
+
+	return flagEnabledFor(flag, userID, role), nil
+}
+
+// flagEnabledFor evaluates a flag for one user. Users matched by the
+// targeting rules always get the feature; everyone else is bucketed by the
+// first byte of their ID, so a user stays in or out of a rollout as long as
+// its percentage does not change.
+func flagEnabledFor(flag *models.FeatureFlag, userID uuid.UUID, role string) bool {
+	if !flag.Enabled {
+		return false
+	}
+
+	for _, targeted := range flag.TargetingRules.Roles {
+		if targeted == role {
+			return true
+		}
+	}
+	for _, targeted := range flag.TargetingRules.UserIDs {
+		if targeted == userID {
+			return true
+		}
+	}
+
+	return int(userID[0])%100 < flag.RolloutPercent
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// userWithBucket returns a user ID whose first byte is b.
+func userWithBucket(b byte) uuid.UUID {
+	id := uuid.New()
+	id[0] = b
+	return id
+}
+
+func TestFlagEnabledFor(t *testing.T) {
+	flag := func(percent int, targets models.FeatureFlagTargets) *models.FeatureFlag {
+		return &models.FeatureFlag{Key: "new-checkout", Enabled: true, RolloutPercent: percent, TargetingRules: targets}
+	}
+
+	t.Run("50 percent is stable per user", func(t *testing.T) {
+		half := flag(50, models.FeatureFlagTargets{})
+		tests := []struct {
+			bucket byte
+			want   bool
+		}{
+			{0, true}, {49, true}, {50, false}, {99, false}, {149, true}, {150, false},
+		}
+		for _, tt := range tests {
+			user := userWithBucket(tt.bucket)
+			for i := 0; i < 3; i++ {
+				if got := flagEnabledFor(half, user, "customer"); got != tt.want {
+					t.Errorf("bucket %d, call %d: enabled = %v, want %v", tt.bucket, i, got, tt.want)
+				}
+			}
+		}
+	})
+
+	t.Run("0 and 100 percent", func(t *testing.T) {
+		for b := 0; b < 256; b++ {
+			user := userWithBucket(byte(b))
+			if flagEnabledFor(flag(0, models.FeatureFlagTargets{}), user, "customer") {
+				t.Errorf("bucket %d is enabled at 0 percent", b)
+			}
+			if !flagEnabledFor(flag(100, models.FeatureFlagTargets{}), user, "customer") {
+				t.Errorf("bucket %d is disabled at 100 percent", b)
+			}
+		}
+	})
+
+	t.Run("targeting overrides the percentage", func(t *testing.T) {
+		targeted := userWithBucket(99)
+		rules := models.FeatureFlagTargets{Roles: []string{"admin"}, UserIDs: []uuid.UUID{targeted}}
+		closed := flag(0, rules)
+
+		if !flagEnabledFor(closed, userWithBucket(99), "admin") {
+			t.Error("admin role is not enabled at 0 percent")
+		}
+		if !flagEnabledFor(closed, targeted, "customer") {
+			t.Error("targeted user is not enabled at 0 percent")
+		}
+		if flagEnabledFor(closed, userWithBucket(0), "customer") {
+			t.Error("untargeted customer is enabled at 0 percent")
+		}
+
+		closed.Enabled = false
+		if flagEnabledFor(closed, targeted, "admin") {
+			t.Error("a disabled flag is enabled for a targeted admin")
+		}
+	})
+}
@@ -0,0 +1,250 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"strings"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// BlogFeed is the latest published posts, newest first. LastModified is
+// the latest update of any of them, and ETag changes whenever a post is
+// added to, edited in or dropped from the feed.
+type BlogFeed struct {
+	Posts        []*models.Post
+	LastModified time.Time
+	ETag         string
+}
+
+// RSSFeed is an RSS 2.0 document. The content and Dublin Core namespaces
+// are only declared by feeds that use them.
+type RSSFeed struct {
+	XMLName      xml.Name   `xml:"rss"`
+	Version      string     `xml:"version,attr"`
+	XmlnsContent string     `xml:"xmlns:content,attr,omitempty"`
+	XmlnsDC      string     `xml:"xmlns:dc,attr,omitempty"`
+	Channel      RSSChannel `xml:"channel"`
+}
+
+type RSSChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []RSSItem `xml:"item"`
+}
+
+// RSSItem is a post in a feed. Creator is the author's name: RSS' own
+// author element must be an email address.
+type RSSItem struct {
+	Title          string  `xml:"title"`
+	Link           string  `xml:"link"`
+	Description    string  `xml:"description,omitempty"`
+	ContentEncoded string  `xml:"content:encoded,omitempty"`
+	Creator        string  `xml:"dc:creator,omitempty"`
+	GUID           RSSGUID `xml:"guid"`
+	PubDate        string  `xml:"pubDate,omitempty"`
+}
+
+type RSSGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// AtomFeed is an Atom 1.0 document.
+type AtomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []AtomLink  `xml:"link"`
+	Author  AtomAuthor  `xml:"author"`
+	Entries []AtomEntry `xml:"entry"`
+}
+
+type AtomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Link      AtomLink    `xml:"link"`
+	Published string      `xml:"published,omitempty"`
+	Updated   string      `xml:"updated"`
+	Author    *AtomAuthor `xml:"author,omitempty"`
+	Summary   *AtomText   `xml:"summary,omitempty"`
+	Content   *AtomText   `xml:"content,omitempty"`
+}
+
+type AtomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+}
+
+type AtomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type AtomText struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// FeedService builds the RSS and Atom feeds of the blog. Links
+// are made absolute against siteURL.
+type FeedService struct {
+	postRepo *repositories.PostRepository
+	siteName string
+	siteURL  string
+}
+
+func NewFeedService(postRepo *repositories.PostRepository, siteName, siteURL string) *FeedService {
+	return &FeedService{postRepo: postRepo, siteName: siteName, siteURL: strings.TrimRight(siteURL, "/")}
+}
+
+// Latest returns the limit latest published posts with their content and
+// author.
+func (s *FeedService) Latest(ctx context.Context, limit int) (*BlogFeed, error) {
+	posts, err := s.postRepo.ListFeed(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	feed := &BlogFeed{Posts: posts}
+	hash := sha256.New()
+	for _, post := range posts {
+		if post.UpdatedAt.After(feed.LastModified) {
+			feed.LastModified = post.UpdatedAt
+		}
+		hash.Write([]byte(post.ID.String() + post.UpdatedAt.UTC().Format(time.RFC3339Nano)))
+	}
+	feed.ETag = `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+
+	return feed, nil
+}
+
+// RSS renders the feed as RSS 2.0. Items carry the excerpt as their
+// description and the post's HTML as content:encoded.
+func (s *FeedService) RSS(feed *BlogFeed) *RSSFeed {
+	channel := RSSChannel{
+		Title:       s.siteName,
+		Link:        s.siteURL + "/blog",
+		Description: "Latest posts from " + s.siteName,
+		Items:       make([]RSSItem, 0, len(feed.Posts)),
+	}
+	if !feed.LastModified.IsZero() {
+		channel.LastBuildDate = feed.LastModified.Format(time.RFC1123Z)
+	}
+
+	for _, post := range feed.Posts {
+		channel.Items = append(channel.Items, s.rssItem(post))
+	}
+
+	return &RSSFeed{
+		Version:      "2.0",
+		XmlnsContent: "http://purl.org/rss/1.0/modules/content/",
+		XmlnsDC:      "http://purl.org/dc/elements/1.1/",
+		Channel:      channel,
+	}
+}
+
+// CategoryRSS renders the RSS feed of a blog category from its latest
+// posts, newest first. The posts are listed without their content or
+// author, so items only carry the excerpt.
+func (s *FeedService) CategoryRSS(category *models.Category, posts []*models.Post) *RSSFeed {
+	channel := RSSChannel{
+		Title:       s.siteName + " - " + category.Name,
+		Link:        s.siteURL + "/blog/categories/" + category.Slug,
+		Description: category.Description,
+		Items:       make([]RSSItem, 0, len(posts)),
+	}
+
+	for _, post := range posts {
+		channel.Items = append(channel.Items, s.rssItem(post))
+	}
+
+	// Posts are newest first, so the first one dates the feed
+	if len(posts) > 0 && posts[0].PublishedAt != nil {
+		channel.LastBuildDate = posts[0].PublishedAt.Format(time.RFC1123Z)
+	}
+
+	return &RSSFeed{Version: "2.0", Channel: channel}
+}
+
+// rssItem renders a post as a feed item. The content and author are left
+// out when the post was loaded without them.
+func (s *FeedService) rssItem(post *models.Post) RSSItem {
+	link := s.postURL(post)
+	item := RSSItem{
+		Title:          post.Title,
+		Link:           link,
+		Description:    post.Excerpt,
+		ContentEncoded: post.Content,
+		Creator:        authorName(post),
+		GUID:           RSSGUID{Value: link, IsPermaLink: true},
+	}
+	if post.PublishedAt != nil {
+		item.PubDate = post.PublishedAt.Format(time.RFC1123Z)
+	}
+	return item
+}
+
+// Atom renders the feed as Atom 1.0. The site is the feed's author, which
+// covers posts without one of their own.
+func (s *FeedService) Atom(feed *BlogFeed) *AtomFeed {
+	updated := feed.LastModified
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+
+	atom := &AtomFeed{
+		Title:   s.siteName,
+		ID:      s.siteURL + "/feed/atom",
+		Updated: updated.UTC().Format(time.RFC3339),
+		Links: []AtomLink{
+			{Href: s.siteURL + "/feed/atom", Rel: "self", Type: "application/atom+xml"},
+			{Href: s.siteURL + "/blog", Rel: "alternate", Type: "text/html"},
+		},
+		Author:  AtomAuthor{Name: s.siteName},
+		Entries: make([]AtomEntry, 0, len(feed.Posts)),
+	}
+
+	for _, post := range feed.Posts {
+		link := s.postURL(post)
+		entry := AtomEntry{
+			Title:   post.Title,
+			ID:      link,
+			Link:    AtomLink{Href: link, Rel: "alternate", Type: "text/html"},
+			Updated: post.UpdatedAt.UTC().Format(time.RFC3339),
+			Content: &AtomText{Type: "html", Value: post.Content},
+		}
+		if post.PublishedAt != nil {
+			entry.Published = post.PublishedAt.UTC().Format(time.RFC3339)
+		}
+		if name := authorName(post); name != "" {
+			entry.Author = &AtomAuthor{Name: name}
+		}
+		if post.Excerpt != "" {
+			entry.Summary = &AtomText{Type: "text", Value: post.Excerpt}
+		}
+		atom.Entries = append(atom.Entries, entry)
+	}
+
+	return atom
+}
+
+func (s *FeedService) postURL(post *models.Post) string {
+	return s.siteURL + "/blog/" + post.Slug
+}
+
+// authorName returns the full name of the post's author, or "" when the
+// post has none.
+func authorName(post *models.Post) string {
+	if post.Author == nil || post.Author.User == nil {
+		return ""
+	}
+	return post.Author.User.FullName
+}
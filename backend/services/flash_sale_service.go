@@ -0,0 +1,71 @@
+package services
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+type FlashSaleService struct {
+	flashSaleRepo *repositories.FlashSaleRepository
+	now           func() time.Time
+}
+
+func NewFlashSaleService(flashSaleRepo *repositories.FlashSaleRepository) *FlashSaleService {
+	return &FlashSaleService{flashSaleRepo: flashSaleRepo, now: time.Now}
+}
+
+// GetActive returns the flash sale running right now, or nil.
+func (s *FlashSaleService) GetActive(ctx context.Context) (*models.FlashSale, error) {
+	return s.flashSaleRepo.GetActive(ctx, s.now())
+}
+
+// ComputePrice applies the sale's discount to the product's current selling
+// price, its sale price when it has one, rounded to cents.
+func (s *FlashSaleService) ComputePrice(product *models.Product, sale *models.FlashSale) float64 {
+	price := product.Price
+	if product.SalePrice != nil && *product.SalePrice < price {
+		price = *product.SalePrice
+	}
+	return roundCents(price * (1 - sale.DiscountPercent/100))
+}
+
+// ApplyToProduct fills in the flash sale price and end time when the product
+// is part of the given sale.
+func (s *FlashSaleService) ApplyToProduct(product *models.Product, sale *models.FlashSale) {
+	if sale == nil || !s.now().Before(sale.EndsAt) {
+		return
+	}
+
+	if saleIncludes(sale, product.ID) {
+		price := s.ComputePrice(product, sale)
+		endsAt := sale.EndsAt
+		product.FlashSalePrice = &price
+		product.FlashSaleEndsAt = &endsAt
+	}
+}
+
+func saleIncludes(sale *models.FlashSale, productID uuid.UUID) bool {
+	for _, id := range sale.ProductIDs {
+		if id == productID {
+			return true
+		}
+	}
+	return false
+}
+
+// DeactivateExpired switches off the sales whose end has passed.
+func (s *FlashSaleService) DeactivateExpired(ctx context.Context) error {
+	count, err := s.flashSaleRepo.DeactivateExpired(ctx, s.now())
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		log.Printf("Deactivated %d expired flash sales\n", count)
+	}
+	return nil
+}
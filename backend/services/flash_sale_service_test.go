@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+func TestFlashSalePrice(t *testing.T) {
+	service := NewFlashSaleService(nil)
+	sale := &models.FlashSale{DiscountPercent: 15}
+
+	salePrice := 80.0
+	higherSalePrice := 120.0
+	tests := []struct {
+		name    string
+		product models.Product
+		want    float64
+	}{
+		{"list price", models.Product{Price: 100}, 85},
+		{"sale price", models.Product{Price: 100, SalePrice: &salePrice}, 68},
+		{"sale price above the list price", models.Product{Price: 100, SalePrice: &higherSalePrice}, 85},
+		{"rounded to cents", models.Product{Price: 9.99}, 8.49},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.ComputePrice(&tt.product, sale); got != tt.want {
+				t.Errorf("ComputePrice = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// The discount applies to the sale's products until it ends, and not a
+// moment after, whether or not the expiry job has run yet.
+func TestFlashSaleAppliesUntilItEnds(t *testing.T) {
+	endsAt := time.Date(2026, 11, 27, 23, 59, 0, 0, time.UTC)
+	inSale := models.Product{ID: uuid.New(), Price: 50}
+	sale := &models.FlashSale{DiscountPercent: 20, EndsAt: endsAt, ProductIDs: []uuid.UUID{inSale.ID}}
+
+	service := NewFlashSaleService(nil)
+	service.now = func() time.Time { return endsAt.Add(-time.Minute) }
+
+	product := inSale
+	service.ApplyToProduct(&product, sale)
+	if product.FlashSalePrice == nil || *product.FlashSalePrice != 40 || !product.FlashSaleEndsAt.Equal(endsAt) {
+		t.Errorf("during the sale: price %v ending %v, want 40 ending %v", product.FlashSalePrice, product.FlashSaleEndsAt, endsAt)
+	}
+
+	other := models.Product{ID: uuid.New(), Price: 50}
+	service.ApplyToProduct(&other, sale)
+	if other.FlashSalePrice != nil {
+		t.Errorf("product outside the sale got flash price %v", *other.FlashSalePrice)
+	}
+
+	service.now = func() time.Time { return endsAt }
+	product = inSale
+	service.ApplyToProduct(&product, sale)
+	if product.FlashSalePrice != nil {
+		t.Errorf("after the sale: flash price %v, want none", *product.FlashSalePrice)
+	}
+}
+
+func TestFlashSaleActivation(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	service := NewFlashSaleService(repositories.NewFlashSaleRepository(pool))
+
+	// Far enough ahead not to meet other sales in the database
+	startsAt := time.Date(2097, 6, 1, 9, 0, 0, 0, time.UTC)
+	endsAt := startsAt.Add(6 * time.Hour)
+	var id uuid.UUID
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {shop}.flash_sales (title, discount_percent, starts_at, ends_at)
+		VALUES ($1, 25, $2, $3)
+		RETURNING id
+	`), dbtest.UniqueName("sale"), startsAt, endsAt).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.flash_sales WHERE id = $1"), id)
+	})
+
+	active := func(at time.Time) bool {
+		t.Helper()
+		service.now = func() time.Time { return at }
+		sale, err := service.GetActive(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sale != nil && sale.ID == id
+	}
+
+	if active(startsAt.Add(-time.Second)) {
+		t.Error("sale is active before it starts")
+	}
+	if !active(startsAt) || !active(endsAt.Add(-time.Second)) {
+		t.Error("sale is not active between its start and end")
+	}
+	if active(endsAt) {
+		t.Error("sale is active at its end, before the expiry job ran")
+	}
+
+	service.now = func() time.Time { return endsAt.Add(-time.Second) }
+	if err := service.DeactivateExpired(ctx); err != nil {
+		t.Fatal(err)
+	}
+	var isActive bool
+	if err := pool.QueryRow(ctx, database.Qualify("SELECT is_active FROM {shop}.flash_sales WHERE id = $1"), id).Scan(&isActive); err != nil {
+		t.Fatal(err)
+	}
+	if !isActive {
+		t.Fatal("the expiry job switched off a sale that had not ended")
+	}
+
+	service.now = func() time.Time { return endsAt }
+	if err := service.DeactivateExpired(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.QueryRow(ctx, database.Qualify("SELECT is_active FROM {shop}.flash_sales WHERE id = $1"), id).Scan(&isActive); err != nil {
+		t.Fatal(err)
+	}
+	if isActive {
+		t.Error("the expiry job left an ended sale active")
+	}
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/webp"
+)
+
+// imageVariant is a resized copy generated for every uploaded image. A
+// variant with a height is cropped to fill exactly that size; one without
+// keeps the image's proportions.
+type imageVariant struct {
+	name   string
+	suffix string
+	width  int
+	height int
+}
+
+var imageVariants = []imageVariant{
+	{name: "thumbnail", suffix: "-thumb", width: 150, height: 150},
+	{name: "medium", suffix: "-md", width: 640},
+	{name: "large", suffix: "-lg", width: 1280},
+}
+
+// maxImagePixels is the largest image, in pixels, that is decoded. A small
+// file can declare a huge image, and decoding takes 4 bytes per pixel, so
+// larger ones are refused from their header alone.
+const maxImagePixels = 40_000_000
+
+var ErrImageTooLarge = errors.New("image has too many pixels")
+
+// ImageVariants are the WebP encoded copies of an uploaded image. The
+// readers are seekable, so storage backends can retry them.
+type ImageVariants struct {
+	Thumbnail io.Reader
+	Medium    io.Reader
+	Large     io.Reader
+}
+
+// ImageService resizes uploaded images. It only transforms bytes, so it
+// can be used without any storage.
+type ImageService struct{}
+
+func NewImageService() *ImageService {
+	return &ImageService{}
+}
+
+// GenerateVariants decodes a JPEG, PNG or WebP image, honouring its EXIF
+// orientation, and returns its thumbnail, medium and large variants encoded
+// as WebP. Images are never scaled up: one narrower than a variant keeps
+// its own width for it. Images of more than maxImagePixels are refused with
+// ErrImageTooLarge before they are decoded.
+func (s *ImageService) GenerateVariants(r io.Reader) (*ImageVariants, error) {
+	// The header read for the size is replayed for the full decode
+	var header bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &header))
+	if err != nil {
+		return nil, err
+	}
+	if int64(config.Width)*int64(config.Height) > maxImagePixels {
+		return nil, ErrImageTooLarge
+	}
+
+	img, err := imaging.Decode(io.MultiReader(&header, r), imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, err
+	}
+
+	encoded := make([]io.Reader, len(imageVariants))
+	for i, variant := range imageVariants {
+		var buf bytes.Buffer
+		if err := nativewebp.Encode(&buf, resizeForVariant(img, variant), nil); err != nil {
+			return nil, err
+		}
+		encoded[i] = bytes.NewReader(buf.Bytes())
+	}
+
+	return &ImageVariants{
+		Thumbnail: encoded[0],
+		Medium:    encoded[1],
+		Large:     encoded[2],
+	}, nil
+}
+
+func resizeForVariant(img image.Image, variant imageVariant) image.Image {
+	if variant.height > 0 {
+		return imaging.Fill(img, variant.width, variant.height, imaging.Center, imaging.Lanczos)
+	}
+	if img.Bounds().Dx() <= variant.width {
+		return img
+	}
+	return imaging.Resize(img, variant.width, 0, imaging.Lanczos)
+}
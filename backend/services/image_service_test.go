@@ -0,0 +1,112 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+// pngHeader returns the start of a PNG declaring a width×height RGBA image,
+// with no pixel data.
+func pngHeader(width, height uint32) []byte {
+	ihdr := make([]byte, 13)
+	binary.BigEndian.PutUint32(ihdr[0:], width)
+	binary.BigEndian.PutUint32(ihdr[4:], height)
+	ihdr[8], ihdr[9] = 8, 6 // 8-bit RGBA
+
+	var buf bytes.Buffer
+	buf.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&buf, binary.BigEndian, uint32(len(ihdr)))
+	chunk := append([]byte("IHDR"), ihdr...)
+	buf.Write(chunk)
+	binary.Write(&buf, binary.BigEndian, crc32.ChecksumIEEE(chunk))
+	return buf.Bytes()
+}
+
+func TestGenerateVariantsRejectsHugeImages(t *testing.T) {
+	_, err := NewImageService().GenerateVariants(bytes.NewReader(pngHeader(20000, 20000)))
+	if !errors.Is(err, ErrImageTooLarge) {
+		t.Fatalf("err = %v, want ErrImageTooLarge", err)
+	}
+}
+
+func TestGenerateVariantsNeverScalesUp(t *testing.T) {
+	variants, err := NewImageService().GenerateVariants(bytes.NewReader(syntheticPNG(t, 300, 200)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, variant := range []struct {
+		name  string
+		r     io.Reader
+		width int
+	}{
+		{"thumbnail", variants.Thumbnail, 150},
+		{"medium", variants.Medium, 300},
+		{"large", variants.Large, 300},
+	} {
+		config, _, err := image.DecodeConfig(variant.r)
+		if err != nil {
+			t.Fatalf("%s: %v", variant.name, err)
+		}
+		if config.Width != variant.width {
+			t.Errorf("%s is %dpx wide, want %d", variant.name, config.Width, variant.width)
+		}
+	}
+}
+
+// noisyJPEG returns a JPEG of random pixels, which compresses badly, of
+// roughly the given size in bytes.
+func noisyJPEG(b *testing.B, size int) []byte {
+	b.Helper()
+	rng := rand.New(rand.NewSource(1))
+	for width := 1000; ; width += 250 {
+		img := image.NewRGBA(image.Rect(0, 0, width, width*3/4))
+		for i := range img.Pix {
+			img.Pix[i] = uint8(rng.Intn(256))
+		}
+
+		var buf bytes.Buffer
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			b.Fatal(err)
+		}
+		if buf.Len() >= size {
+			return buf.Bytes()
+		}
+	}
+}
+
+func BenchmarkGenerateVariants4MBJPEG(b *testing.B) {
+	original := noisyJPEG(b, 4<<20)
+	service := NewImageService()
+	b.SetBytes(int64(len(original)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := service.GenerateVariants(bytes.NewReader(original)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkResizeForVariant(b *testing.B) {
+	img, err := jpeg.Decode(bytes.NewReader(noisyJPEG(b, 4<<20)))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+
+	for _, variant := range imageVariants {
+		b.Run(variant.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				resizeForVariant(img, variant)
+			}
+		})
+	}
+}
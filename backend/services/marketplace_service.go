@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+var ErrVendorNotFound = errors.New("vendor not found")
+
+type MarketplaceService struct {
+	vendorRepo *repositories.VendorRepository
+	batchRepo  *repositories.PayoutBatchRepository
+}
+
+func NewMarketplaceService(vendorRepo *repositories.VendorRepository, batchRepo *repositories.PayoutBatchRepository) *MarketplaceService {
+	return &MarketplaceService{vendorRepo: vendorRepo, batchRepo: batchRepo}
+}
+
+// ComputeCommission splits an item's gross amount into the platform's
+// commission and the vendor's net share, rounded to cents.
+func ComputeCommission(price float64, quantity int, rate float64) (gross, commission, net float64) {
+	gross = roundCents(price * float64(quantity))
+	commission = roundCents(gross * rate)
+	net = roundCents(gross - commission)
+	return gross, commission, net
+}
+
+// SplitRevenue sets the vendor and commission on every vendor-sold item and
+// returns a pending payout for each of them, in item order. Items sold by
+// the platform itself are left untouched. It is the PayoutSplitter orders
+// are created with, so the payouts are recorded with the order, which links
+// them to the items once they are inserted.
+func (s *MarketplaceService) SplitRevenue(ctx context.Context, items []*models.OrderItem) ([]*models.VendorPayout, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	productIDs := make([]uuid.UUID, 0, len(items))
+	for _, item := range items {
+		productIDs = append(productIDs, item.ProductID)
+	}
+
+	vendors, err := s.vendorRepo.GetByProductIDs(ctx, productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	var payouts []*models.VendorPayout
+	for _, item := range items {
+		vendor, ok := vendors[item.ProductID]
+		if !ok {
+			continue
+		}
+
+		gross, commission, net := ComputeCommission(item.Price, item.Quantity, vendor.CommissionRate)
+
+		vendorID := vendor.ID
+		item.VendorID = &vendorID
+		item.CommissionAmount = commission
+
+		payouts = append(payouts, &models.VendorPayout{
+			VendorID:         vendor.ID,
+			GrossAmount:      gross,
+			CommissionAmount: commission,
+			NetAmount:        net,
+			Status:           "pending",
+		})
+	}
+
+	return payouts, nil
+}
+
+func (s *MarketplaceService) ListPayouts(ctx context.Context, vendorID uuid.UUID, limit, offset int) ([]*models.VendorPayout, int, error) {
+	if err := s.ensureVendor(ctx, vendorID); err != nil {
+		return nil, 0, err
+	}
+
+	return s.vendorRepo.ListPayouts(ctx, vendorID, limit, offset)
+}
+
+// ReleasePayouts marks the vendor's pending payouts as paid.
+func (s *MarketplaceService) ReleasePayouts(ctx context.Context, vendorID uuid.UUID) (int64, error) {
+	if err := s.ensureVendor(ctx, vendorID); err != nil {
+		return 0, err
+	}
+
+	return s.vendorRepo.ReleasePendingPayouts(ctx, vendorID)
+}
+
+func (s *MarketplaceService) ListPayoutBatches(ctx context.Context, vendorID uuid.UUID, limit, offset int) ([]*models.PayoutBatch, int, error) {
+	if err := s.ensureVendor(ctx, vendorID); err != nil {
+		return nil, 0, err
+	}
+
+	return s.batchRepo.ListByVendor(ctx, vendorID, limit, offset)
+}
+
+// ListOpenPayoutBatches returns the batches, across all vendors, that are
+// still waiting for a transfer or have failed.
+func (s *MarketplaceService) ListOpenPayoutBatches(ctx context.Context, limit, offset int) ([]*models.PayoutBatch, int, error) {
+	return s.batchRepo.ListOpen(ctx, limit, offset)
+}
+
+func (s *MarketplaceService) ensureVendor(ctx context.Context, vendorID uuid.UUID) error {
+	vendor, err := s.vendorRepo.GetByID(ctx, vendorID)
+	if err != nil {
+		return err
+	}
+	if vendor == nil {
+		return ErrVendorNotFound
+	}
+	return nil
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
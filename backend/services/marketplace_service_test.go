@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+func TestComputeCommission(t *testing.T) {
+	tests := []struct {
+		price                  float64
+		quantity               int
+		rate                   float64
+		gross, commission, net float64
+	}{
+		{price: 25, quantity: 2, rate: 0.1, gross: 50, commission: 5, net: 45},
+		{price: 19.99, quantity: 3, rate: 0.15, gross: 59.97, commission: 9, net: 50.97},
+		{price: 0.33, quantity: 1, rate: 0.125, gross: 0.33, commission: 0.04, net: 0.29},
+		{price: 10, quantity: 1, rate: 0, gross: 10, commission: 0, net: 10},
+	}
+	for _, tt := range tests {
+		gross, commission, net := ComputeCommission(tt.price, tt.quantity, tt.rate)
+		if gross != tt.gross || commission != tt.commission || net != tt.net {
+			t.Errorf("ComputeCommission(%v, %d, %v) = %v, %v, %v; want %v, %v, %v",
+				tt.price, tt.quantity, tt.rate, gross, commission, net, tt.gross, tt.commission, tt.net)
+		}
+		if roundCents(commission+net) != gross {
+			t.Errorf("ComputeCommission(%v, %d, %v): commission and net do not add up to gross", tt.price, tt.quantity, tt.rate)
+		}
+	}
+}
+
+// An order with items from two vendors and one sold by the platform yields
+// one payout per vendor item at that vendor's rate.
+func TestSplitRevenueAcrossVendors(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	service := NewMarketplaceService(repositories.NewVendorRepository(pool, nil), nil)
+
+	vendor := func(rate float64) uuid.UUID {
+		t.Helper()
+		var id uuid.UUID
+		err := pool.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.vendors (name, slug, commission_rate, status) VALUES ($1, $1, $2, 'active') RETURNING id
+		`), dbtest.UniqueName("vendor"), rate).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.vendors WHERE id = $1"), id)
+		})
+		return id
+	}
+	product := func(vendorID *uuid.UUID) uuid.UUID {
+		t.Helper()
+		var id uuid.UUID
+		err := pool.QueryRow(ctx, database.Qualify(`
+			INSERT INTO {shop}.products (name, slug, description, price, sku, stock, vendor_id)
+			VALUES ($1, $1, 'A test product', 10, $1, 10, $2)
+			RETURNING id
+		`), dbtest.UniqueName("product"), vendorID).Scan(&id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.products WHERE id = $1"), id)
+		})
+		return id
+	}
+
+	books, prints := vendor(0.1), vendor(0.25)
+	items := []*models.OrderItem{
+		{ProductID: product(&books), Quantity: 2, Price: 12.5},
+		{ProductID: product(nil), Quantity: 1, Price: 40},
+		{ProductID: product(&prints), Quantity: 3, Price: 9.99},
+	}
+
+	payouts, err := service.SplitRevenue(ctx, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []models.VendorPayout{
+		{VendorID: books, GrossAmount: 25, CommissionAmount: 2.5, NetAmount: 22.5, Status: "pending"},
+		{VendorID: prints, GrossAmount: 29.97, CommissionAmount: 7.49, NetAmount: 22.48, Status: "pending"},
+	}
+	if len(payouts) != len(want) {
+		t.Fatalf("SplitRevenue = %d payouts, want %d", len(payouts), len(want))
+	}
+	for i, w := range want {
+		got := payouts[i]
+		if got.VendorID != w.VendorID || got.GrossAmount != w.GrossAmount || got.CommissionAmount != w.CommissionAmount ||
+			got.NetAmount != w.NetAmount || got.Status != w.Status {
+			t.Errorf("payout %d = %+v, want %+v", i, *got, w)
+		}
+	}
+
+	if items[0].VendorID == nil || *items[0].VendorID != books || items[0].CommissionAmount != 2.5 {
+		t.Errorf("first item = vendor %v, commission %v; want the book vendor and 2.5", items[0].VendorID, items[0].CommissionAmount)
+	}
+	if items[1].VendorID != nil || items[1].CommissionAmount != 0 {
+		t.Errorf("platform item got vendor %v and commission %v", items[1].VendorID, items[1].CommissionAmount)
+	}
+	if items[2].VendorID == nil || *items[2].VendorID != prints || items[2].CommissionAmount != 7.49 {
+		t.Errorf("third item = vendor %v, commission %v; want the print vendor and 7.49", items[2].VendorID, items[2].CommissionAmount)
+	}
+}
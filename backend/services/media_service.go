@@ -0,0 +1,209 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+var (
+	ErrMediaNotFound        = errors.New("media not found")
+	ErrMediaTooLarge        = errors.New("file is too large")
+	ErrUnsupportedMediaType = errors.New("file type is not allowed")
+	ErrMediaNotImage        = errors.New("media is not an image")
+	ErrInvalidImage         = errors.New("image could not be read")
+	ErrMediaPrivate         = errors.New("private media cannot be shown publicly")
+)
+
+// DownloadURLExpiry is how long a download link to a private file works.
+const DownloadURLExpiry = 15 * time.Minute
+
+// uploadExtensions lists the content types that may be uploaded, with the
+// extension their files are stored under.
+var uploadExtensions = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+type MediaService struct {
+	mediaRepo *repositories.MediaRepository
+	storage   StorageBackend
+	images    *ImageService
+	maxBytes  int64
+	now       func() time.Time
+}
+
+func NewMediaService(mediaRepo *repositories.MediaRepository, storage StorageBackend, images *ImageService, maxBytes int64) *MediaService {
+	return &MediaService{
+		mediaRepo: mediaRepo,
+		storage:   storage,
+		images:    images,
+		maxBytes:  maxBytes,
+		now:       time.Now,
+	}
+}
+
+// MaxUploadBytes is the largest file Upload accepts.
+func (s *MediaService) MaxUploadBytes() int64 {
+	return s.maxBytes
+}
+
+// Get returns the media with its original URL and the URLs of the variants
+// generated so far.
+func (s *MediaService) Get(ctx context.Context, id uuid.UUID) (*models.Media, error) {
+	media, err := s.mediaRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if media == nil {
+		return nil, ErrMediaNotFound
+	}
+	return media, nil
+}
+
+// ImageURL returns the URL of an uploaded image, for use as a featured or
+// gallery image.
+func (s *MediaService) ImageURL(ctx context.Context, id uuid.UUID) (string, error) {
+	media, err := s.Get(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if !strings.HasPrefix(media.ContentType, "image/") {
+		return "", ErrMediaNotImage
+	}
+	if media.IsPrivate {
+		return "", ErrMediaPrivate
+	}
+	return media.URL, nil
+}
+
+// GetDownloadURL returns the URL for userID to download the media from:
+// the public URL of a public file, or a signed URL that works for duration
+// for a private one. Private files can only be downloaded by their
+// uploader and by admins; to anyone else they are ErrMediaNotFound, so
+// their IDs cannot be probed.
+func (s *MediaService) GetDownloadURL(ctx context.Context, mediaID, userID uuid.UUID, isAdmin bool, duration time.Duration) (string, error) {
+	media, err := s.Get(ctx, mediaID)
+	if err != nil {
+		return "", err
+	}
+	if !media.IsPrivate {
+		return media.URL, nil
+	}
+	if !isAdmin && (media.UploadedBy == nil || *media.UploadedBy != userID) {
+		return "", ErrMediaNotFound
+	}
+	return s.storage.PresignGet(ctx, media.StorageKey, duration)
+}
+
+// Upload stores a file uploaded by uploaderID and records it as media. The
+// content type is sniffed from the file itself rather than trusted from the
+// client, and must be one of uploadExtensions. Public images also get their
+// thumbnail, medium and large WebP variants, stored as
+// variants/<uuid>-<thumb|md|lg>.webp with the original's UUID. Private files are stored
+// under the private/ prefix, without variants or a public URL. Either every
+// file is stored and recorded or, on failure, none is kept.
+func (s *MediaService) Upload(ctx context.Context, uploaderID uuid.UUID, file io.ReadSeeker, size int64, isPrivate bool) (*models.Media, error) {
+	if size > s.maxBytes {
+		return nil, ErrMediaTooLarge
+	}
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+	ext, ok := uploadExtensions[contentType]
+	if !ok {
+		return nil, ErrUnsupportedMediaType
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var variants *ImageVariants
+	if strings.HasPrefix(contentType, "image/") && !isPrivate {
+		if variants, err = s.images.GenerateVariants(file); err != nil {
+			if errors.Is(err, ErrImageTooLarge) {
+				return nil, err
+			}
+			return nil, ErrInvalidImage
+		}
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	prefix := "uploads/"
+	if isPrivate {
+		prefix = "private/"
+	}
+	id := uuid.NewString()
+	media := &models.Media{
+		StorageKey:  prefix + s.now().UTC().Format("2006/01/") + id + ext,
+		ContentType: contentType,
+		SizeBytes:   size,
+		Variants:    map[string]string{},
+		IsPrivate:   isPrivate,
+		UploadedBy:  &uploaderID,
+	}
+
+	stored, err := s.storeFiles(ctx, media, id, file, variants)
+	if err == nil {
+		err = s.mediaRepo.Create(ctx, media)
+	}
+	if err != nil {
+		// Nothing refers to the files without their media row
+		for _, key := range stored {
+			if delErr := s.storage.Delete(ctx, key); delErr != nil {
+				log.Printf("Failed to delete orphaned upload %s: %v\n", key, delErr)
+			}
+		}
+		return nil, err
+	}
+
+	return media, nil
+}
+
+// storeFiles uploads the original file and its image variants, if any,
+// filling in the media's URLs. It returns the keys stored so far, also on
+// failure.
+func (s *MediaService) storeFiles(ctx context.Context, media *models.Media, id string, file io.Reader, variants *ImageVariants) ([]string, error) {
+	var stored []string
+
+	url, err := s.storage.Upload(ctx, media.StorageKey, media.ContentType, file)
+	if err != nil {
+		return stored, err
+	}
+	stored = append(stored, media.StorageKey)
+	if !media.IsPrivate {
+		media.URL = url
+	}
+
+	if variants == nil {
+		return stored, nil
+	}
+	for i, r := range []io.Reader{variants.Thumbnail, variants.Medium, variants.Large} {
+		variant := imageVariants[i]
+		key := "variants/" + id + variant.suffix + ".webp"
+		url, err := s.storage.Upload(ctx, key, "image/webp", r)
+		if err != nil {
+			return stored, err
+		}
+		stored = append(stored, key)
+		media.Variants[variant.name] = url
+	}
+
+	return stored, nil
+}
@@ -0,0 +1,273 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// fakeS3 records the objects put into it.
+type fakeS3 struct {
+	objects map[string][]byte
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, err := io.ReadAll(params.Body)
+	if err != nil {
+		return nil, err
+	}
+	f.objects[*params.Key] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error) {
+	delete(f.objects, *params.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func syntheticPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for x := 0; x < width; x++ {
+		for y := 0; y < height; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestStoreFilesUploadsImageVariants(t *testing.T) {
+	client := &fakeS3{objects: map[string][]byte{}}
+	service := &MediaService{storage: &S3Backend{client: client, bucket: "media", baseURL: "https://cdn.example.com"}}
+
+	original := syntheticPNG(t, 2000, 1200)
+	variants, err := NewImageService().GenerateVariants(bytes.NewReader(original))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := uuid.NewString()
+	media := &models.Media{StorageKey: "uploads/2026/10/" + id + ".png", ContentType: "image/png", Variants: map[string]string{}}
+	stored, err := service.storeFiles(context.Background(), media, id, bytes.NewReader(original), variants)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stored) != 4 || len(client.objects) != 4 {
+		t.Fatalf("stored %v, want the original and three variants", stored)
+	}
+	if media.URL != "https://cdn.example.com/"+media.StorageKey {
+		t.Errorf("URL = %q", media.URL)
+	}
+
+	wantSizes := map[string][2]int{"thumbnail": {150, 150}, "medium": {640, 384}, "large": {1280, 768}}
+	suffixes := map[string]string{"thumbnail": "-thumb", "medium": "-md", "large": "-lg"}
+	for name, size := range wantSizes {
+		key := "variants/" + id + suffixes[name] + ".webp"
+		if got := media.Variants[name]; got != "https://cdn.example.com/"+key {
+			t.Errorf("%s URL = %q", name, got)
+		}
+		body, ok := client.objects[key]
+		if !ok {
+			t.Errorf("%s was not uploaded to %s", name, key)
+			continue
+		}
+		config, format, err := image.DecodeConfig(bytes.NewReader(body))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if format != "webp" || config.Width != size[0] || config.Height != size[1] {
+			t.Errorf("%s is a %dx%d %s, want a %dx%d webp", name, config.Width, config.Height, format, size[0], size[1])
+		}
+	}
+}
+
+func TestStoreFilesKeepsPrivateFilesWithoutURL(t *testing.T) {
+	client := &fakeS3{objects: map[string][]byte{}}
+	service := &MediaService{storage: &S3Backend{client: client, bucket: "media", baseURL: "https://cdn.example.com"}}
+
+	id := uuid.NewString()
+	media := &models.Media{StorageKey: "private/2026/10/" + id + ".pdf", IsPrivate: true, Variants: map[string]string{}}
+	if _, err := service.storeFiles(context.Background(), media, id, strings.NewReader("%PDF-1.4"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if media.URL != "" {
+		t.Errorf("private file got URL %q", media.URL)
+	}
+	if _, ok := client.objects[media.StorageKey]; !ok {
+		t.Errorf("private file was not uploaded to %s", media.StorageKey)
+	}
+}
+
+// testS3Backend returns a backend for the media bucket with fixed
+// credentials, which can presign URLs but is never sent a request.
+func testS3Backend() *S3Backend {
+	client := s3.New(s3.Options{
+		Region: "eu-west-1",
+		Credentials: aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
+			return aws.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "secret"}, nil
+		}),
+	})
+	return &S3Backend{
+		client:    client,
+		presigner: s3.NewPresignClient(client),
+		bucket:    "media",
+		baseURL:   "https://cdn.example.com",
+	}
+}
+
+func TestS3BackendPresignGet(t *testing.T) {
+	signed, err := testS3Backend().PresignGet(context.Background(), "private/report.pdf", DownloadURLExpiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Scheme != "https" || !strings.HasSuffix(u.Path, "/private/report.pdf") {
+		t.Errorf("signed URL %s is not for private/report.pdf over HTTPS", signed)
+	}
+	query := u.Query()
+	if query.Get("X-Amz-Signature") == "" {
+		t.Errorf("signed URL %s has no signature", signed)
+	}
+	if got := query.Get("X-Amz-Expires"); got != "900" {
+		t.Errorf("X-Amz-Expires = %q, want 900", got)
+	}
+	if !strings.HasPrefix(query.Get("X-Amz-Credential"), "AKIDEXAMPLE/") {
+		t.Errorf("X-Amz-Credential = %q, want the backend's key", query.Get("X-Amz-Credential"))
+	}
+}
+
+// Public files are downloaded from their CDN URL and private ones from a
+// signed link to the bucket, which only their uploader and admins get.
+func TestGetDownloadURL(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	mediaRepo := repositories.NewMediaRepository(pool)
+	service := NewMediaService(mediaRepo, testS3Backend(), nil, 1<<20)
+	uploader := createTestUser(t, pool)
+
+	create := func(key string, isPrivate bool) *models.Media {
+		t.Helper()
+		media := &models.Media{
+			StorageKey:  key,
+			ContentType: "application/pdf",
+			SizeBytes:   1024,
+			IsPrivate:   isPrivate,
+			UploadedBy:  &uploader.ID,
+		}
+		if !isPrivate {
+			media.URL = "https://cdn.example.com/" + key
+		}
+		if err := mediaRepo.Create(ctx, media); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.media WHERE id = $1"), media.ID)
+		})
+		return media
+	}
+	public := create("uploads/"+uuid.NewString()+".pdf", false)
+	private := create("private/"+uuid.NewString()+".pdf", true)
+
+	got, err := service.GetDownloadURL(ctx, public.ID, uuid.New(), false, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != public.URL {
+		t.Errorf("public download URL = %s, want %s", got, public.URL)
+	}
+
+	got, err = service.GetDownloadURL(ctx, private.ID, uploader.ID, false, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(got, "/"+private.StorageKey+"?") || !strings.Contains(got, "X-Amz-Signature=") {
+		t.Errorf("private download URL %s is not a signed link to %s", got, private.StorageKey)
+	}
+	if strings.HasPrefix(got, "https://cdn.example.com/") {
+		t.Errorf("private download URL %s goes through the CDN", got)
+	}
+
+	if _, err := service.GetDownloadURL(ctx, private.ID, uuid.New(), true, time.Minute); err != nil {
+		t.Errorf("admin download of a private file: %v", err)
+	}
+	if _, err := service.GetDownloadURL(ctx, private.ID, uuid.New(), false, time.Minute); err != ErrMediaNotFound {
+		t.Errorf("another user's private file: err = %v, want ErrMediaNotFound", err)
+	}
+
+	if _, err := service.GetDownloadURL(ctx, uuid.New(), uploader.ID, false, time.Minute); err != ErrMediaNotFound {
+		t.Errorf("unknown media: err = %v, want ErrMediaNotFound", err)
+	}
+}
+
+// Local private files are only reachable through an unexpired link signed
+// for their key, never through the public uploads URL.
+func TestLocalDiskBackendSignedLinks(t *testing.T) {
+	dir := t.TempDir()
+	backend := NewLocalDiskBackend(dir, "http://localhost/uploads", "http://localhost/files", []byte("test-key"))
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	backend.now = func() time.Time { return now }
+
+	const key = "private/report.pdf"
+	signed, err := backend.PresignGet(context.Background(), key, DownloadURLExpiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Path != "/files/"+key {
+		t.Errorf("signed URL path = %s, want /files/%s", u.Path, key)
+	}
+	expires, signature := u.Query().Get("expires"), u.Query().Get("signature")
+
+	if _, err := backend.SignedPath(key, expires, signature); err != nil {
+		t.Errorf("SignedPath for a fresh link: %v", err)
+	}
+	if _, err := backend.SignedPath("private/other.pdf", expires, signature); err != ErrInvalidDownloadLink {
+		t.Errorf("link used for another key: err = %v, want ErrInvalidDownloadLink", err)
+	}
+	if _, err := backend.SignedPath(key, expires+"0", signature); err != ErrInvalidDownloadLink {
+		t.Errorf("link with a changed expiry: err = %v, want ErrInvalidDownloadLink", err)
+	}
+
+	now = now.Add(DownloadURLExpiry + time.Second)
+	if _, err := backend.SignedPath(key, expires, signature); err != ErrInvalidDownloadLink {
+		t.Errorf("expired link: err = %v, want ErrInvalidDownloadLink", err)
+	}
+
+	for _, key := range []string{"private/report.pdf", "uploads/../private/report.pdf", "private"} {
+		if _, err := backend.PublicPath(key); err == nil {
+			t.Errorf("PublicPath(%q) served a private file", key)
+		}
+	}
+	if _, err := backend.PublicPath("uploads/photo.jpg"); err != nil {
+		t.Errorf("PublicPath for a public file: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// AdminNotification is pushed to connected admins as it happens.
+type AdminNotification struct {
+	Type    string    `json:"type"`
+	OrderID uuid.UUID `json:"order_id"`
+	Total   float64   `json:"total"`
+}
+
+// NotificationHub fans notifications out to the admins currently connected
+// to the notification stream. Each admin has a single stream; connecting
+// again closes the previous one.
+type NotificationHub struct {
+	mu      sync.Mutex
+	clients map[uuid.UUID]chan AdminNotification
+}
+
+func NewNotificationHub() *NotificationHub {
+	return &NotificationHub{clients: map[uuid.UUID]chan AdminNotification{}}
+}
+
+// Subscribe registers the admin's stream. The returned function removes it
+// again and must be called when the connection ends.
+func (h *NotificationHub) Subscribe(adminID uuid.UUID) (<-chan AdminNotification, func()) {
+	ch := make(chan AdminNotification, 16)
+
+	h.mu.Lock()
+	if previous, ok := h.clients[adminID]; ok {
+		close(previous)
+	}
+	h.clients[adminID] = ch
+	h.mu.Unlock()
+
+	unsubscribe := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		// A newer connection may already have replaced this one
+		if h.clients[adminID] == ch {
+			delete(h.clients, adminID)
+			close(ch)
+		}
+	}
+
+	return ch, unsubscribe
+}
+
+// BroadcastToAdmins sends the notification to every connected admin. Admins
+// whose buffer is full miss it rather than holding up the caller.
+func (h *NotificationHub) BroadcastToAdmins(notification AdminNotification) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, ch := range h.clients {
+		select {
+		case ch <- notification:
+		default:
+		}
+	}
+}
+
+// Close ends every open stream. It is registered to run on server shutdown,
+// which otherwise waits for these long-lived connections to finish.
+func (h *NotificationHub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for adminID, ch := range h.clients {
+		close(ch)
+		delete(h.clients, adminID)
+	}
+}
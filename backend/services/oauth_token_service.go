@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// oauthExpiryLeeway refreshes tokens shortly before they expire, so a token
+// handed out does not run out during the call it is used for.
+const oauthExpiryLeeway = time.Minute
+
+var (
+	ErrOAuthTokenNotFound   = errors.New("oauth token not found")
+	ErrUnknownOAuthProvider = errors.New("unknown oauth provider")
+	ErrOAuthReauthRequired  = errors.New("oauth token expired and cannot be refreshed")
+)
+
+// OAuthTokenSet is a set of tokens as issued by a provider. ExpiresAt is nil
+// for tokens that do not expire.
+type OAuthTokenSet struct {
+	AccessToken  string
+	RefreshToken string
+	Scopes       []string
+	ExpiresAt    *time.Time
+}
+
+// OAuthTokenRefresher exchanges a refresh token for new tokens.
+type OAuthTokenRefresher interface {
+	RefreshToken(ctx context.Context, refreshToken string) (*OAuthTokenSet, error)
+}
+
+// OAuthTokenService keeps users' provider tokens encrypted at rest and hands
+// out access tokens, refreshing them first when they have expired.
+type OAuthTokenService struct {
+	tokenRepo  *repositories.OAuthTokenRepository
+	cipher     *SecretCipher
+	refreshers map[string]OAuthTokenRefresher
+	now        func() time.Time
+}
+
+// NewOAuthTokenService takes the refresher for each provider, keyed by
+// provider name.
+func NewOAuthTokenService(tokenRepo *repositories.OAuthTokenRepository, cipher *SecretCipher, refreshers map[string]OAuthTokenRefresher) *OAuthTokenService {
+	return &OAuthTokenService{
+		tokenRepo:  tokenRepo,
+		cipher:     cipher,
+		refreshers: refreshers,
+		now:        time.Now,
+	}
+}
+
+// Store saves the tokens a provider issued to the user, replacing earlier
+// ones.
+func (s *OAuthTokenService) Store(ctx context.Context, userID uuid.UUID, provider string, set *OAuthTokenSet) (*models.OAuthToken, error) {
+	token := &models.OAuthToken{
+		UserID:    userID,
+		Provider:  provider,
+		Scopes:    set.Scopes,
+		ExpiresAt: set.ExpiresAt,
+	}
+	if token.Scopes == nil {
+		token.Scopes = []string{}
+	}
+	if err := s.encryptTokens(token, set); err != nil {
+		return nil, err
+	}
+
+	if err := s.tokenRepo.Upsert(ctx, token); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// AccessToken returns the user's access token for the provider, refreshed
+// first if it has expired. Callers should fetch it right before each API
+// call rather than keep it.
+func (s *OAuthTokenService) AccessToken(ctx context.Context, userID uuid.UUID, provider string) (string, error) {
+	token, err := s.tokenRepo.GetByUserAndProvider(ctx, userID, provider)
+	if err != nil {
+		return "", err
+	}
+	if token == nil {
+		return "", ErrOAuthTokenNotFound
+	}
+
+	if err := s.refreshIfExpired(ctx, token); err != nil {
+		return "", err
+	}
+
+	return s.cipher.Decrypt(token.AccessTokenEncrypted)
+}
+
+// RefreshIfExpired refreshes the stored token if it has expired or is about
+// to.
+func (s *OAuthTokenService) RefreshIfExpired(ctx context.Context, tokenID uuid.UUID) error {
+	token, err := s.tokenRepo.GetByID(ctx, tokenID)
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return ErrOAuthTokenNotFound
+	}
+
+	return s.refreshIfExpired(ctx, token)
+}
+
+func (s *OAuthTokenService) refreshIfExpired(ctx context.Context, token *models.OAuthToken) error {
+	if !s.expired(token) {
+		return nil
+	}
+
+	refresher, ok := s.refreshers[token.Provider]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownOAuthProvider, token.Provider)
+	}
+	if len(token.RefreshTokenEncrypted) == 0 {
+		return ErrOAuthReauthRequired
+	}
+
+	refreshToken, err := s.cipher.Decrypt(token.RefreshTokenEncrypted)
+	if err != nil {
+		return err
+	}
+
+	set, err := refresher.RefreshToken(ctx, refreshToken)
+	if err != nil {
+		return fmt.Errorf("refresh %s token: %w", token.Provider, err)
+	}
+
+	if err := s.encryptTokens(token, set); err != nil {
+		return err
+	}
+	token.ExpiresAt = set.ExpiresAt
+	if len(set.Scopes) > 0 {
+		token.Scopes = set.Scopes
+	}
+
+	return s.tokenRepo.UpdateTokens(ctx, token)
+}
+
+func (s *OAuthTokenService) expired(token *models.OAuthToken) bool {
+	return token.ExpiresAt != nil && !s.now().Add(oauthExpiryLeeway).Before(*token.ExpiresAt)
+}
+
+// encryptTokens encrypts the set's tokens onto token. An empty refresh token
+// is left nil.
+func (s *OAuthTokenService) encryptTokens(token *models.OAuthToken, set *OAuthTokenSet) error {
+	access, err := s.cipher.Encrypt(set.AccessToken)
+	if err != nil {
+		return err
+	}
+	token.AccessTokenEncrypted = access
+
+	token.RefreshTokenEncrypted = nil
+	if set.RefreshToken != "" {
+		if token.RefreshTokenEncrypted, err = s.cipher.Encrypt(set.RefreshToken); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// OAuth2TokenEndpoint refreshes tokens with a standard OAuth 2.0
+// refresh_token grant.
+type OAuth2TokenEndpoint struct {
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	client       *http.Client
+}
+
+func NewOAuth2TokenEndpoint(tokenURL, clientID, clientSecret string) *OAuth2TokenEndpoint {
+	return &OAuth2TokenEndpoint{
+		tokenURL:     tokenURL,
+		clientID:     clientID,
+		clientSecret: clientSecret,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *OAuth2TokenEndpoint) RefreshToken(ctx context.Context, refreshToken string) (*OAuthTokenSet, error) {
+	form := url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {e.clientID},
+		"client_secret": {e.clientSecret},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("token endpoint returned %d", resp.StatusCode)
+	}
+
+	var body struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		Scope        string `json:"scope"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return nil, err
+	}
+	if body.AccessToken == "" {
+		return nil, errors.New("token endpoint returned no access token")
+	}
+
+	set := &OAuthTokenSet{
+		AccessToken:  body.AccessToken,
+		RefreshToken: body.RefreshToken,
+		Scopes:       strings.Fields(body.Scope),
+	}
+	if body.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(body.ExpiresIn) * time.Second)
+		set.ExpiresAt = &expiresAt
+	}
+
+	return set, nil
+}
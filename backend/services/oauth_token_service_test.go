@@ -0,0 +1,114 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// countingRefresher hands out a new access token on each refresh.
+type countingRefresher struct {
+	calls     int
+	refreshed []string
+	expiresAt time.Time
+}
+
+func (r *countingRefresher) RefreshToken(ctx context.Context, refreshToken string) (*OAuthTokenSet, error) {
+	r.calls++
+	r.refreshed = append(r.refreshed, refreshToken)
+	return &OAuthTokenSet{AccessToken: "access-2", RefreshToken: "refresh-2", ExpiresAt: &r.expiresAt}, nil
+}
+
+func TestOAuth2TokenEndpointRefresh(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if r.Form.Get("grant_type") != "refresh_token" || r.Form.Get("refresh_token") != "refresh-1" ||
+			r.Form.Get("client_id") != "client" || r.Form.Get("client_secret") != "secret" {
+			t.Errorf("token request form = %v", r.Form)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"access_token":"access-2","refresh_token":"refresh-2","expires_in":3600,"scope":"read write"}`))
+	}))
+	defer server.Close()
+
+	before := time.Now()
+	set, err := NewOAuth2TokenEndpoint(server.URL, "client", "secret").RefreshToken(context.Background(), "refresh-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.AccessToken != "access-2" || set.RefreshToken != "refresh-2" || len(set.Scopes) != 2 {
+		t.Errorf("set = %+v, want the new tokens and both scopes", set)
+	}
+	if set.ExpiresAt == nil || set.ExpiresAt.Before(before.Add(time.Hour)) {
+		t.Errorf("ExpiresAt = %v, want an hour from now", set.ExpiresAt)
+	}
+}
+
+// Tokens are stored encrypted and read back as issued. An expired access
+// token is refreshed before it is handed out, a current one is not.
+func TestOAuthTokenRefreshIfExpired(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	user := createTestUser(t, pool)
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {auth}.oauth_tokens WHERE user_id = $1"), user.ID)
+	})
+
+	now := time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC)
+	refresher := &countingRefresher{expiresAt: now.Add(time.Hour)}
+	service := NewOAuthTokenService(repositories.NewOAuthTokenRepository(pool), testSecretCipher(t),
+		map[string]OAuthTokenRefresher{"google": refresher})
+	service.now = func() time.Time { return now }
+
+	expiresAt := now.Add(30 * time.Minute)
+	token, err := service.Store(ctx, user.ID, "google", &OAuthTokenSet{
+		AccessToken:  "access-1",
+		RefreshToken: "refresh-1",
+		Scopes:       []string{"profile"},
+		ExpiresAt:    &expiresAt,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(token.AccessTokenEncrypted, []byte("access-1")) || bytes.Contains(token.RefreshTokenEncrypted, []byte("refresh-1")) {
+		t.Fatal("tokens are stored in plain text")
+	}
+
+	access, err := service.AccessToken(ctx, user.ID, "google")
+	if err != nil || access != "access-1" || refresher.calls != 0 {
+		t.Fatalf("current token: AccessToken = %q, %v after %d refreshes; want access-1 without a refresh", access, err, refresher.calls)
+	}
+
+	// Within the leeway of the expiry counts as expired
+	now = expiresAt.Add(-oauthExpiryLeeway / 2)
+	access, err = service.AccessToken(ctx, user.ID, "google")
+	if err != nil || access != "access-2" {
+		t.Fatalf("expired token: AccessToken = %q, %v; want the refreshed access-2", access, err)
+	}
+	if refresher.calls != 1 || refresher.refreshed[0] != "refresh-1" {
+		t.Errorf("refresher got %v, want one refresh with refresh-1", refresher.refreshed)
+	}
+
+	if err := service.RefreshIfExpired(ctx, token.ID); err != nil || refresher.calls != 1 {
+		t.Errorf("RefreshIfExpired on the refreshed token = %v after %d refreshes, want no refresh", err, refresher.calls)
+	}
+
+	now = refresher.expiresAt
+	if err := service.RefreshIfExpired(ctx, token.ID); err != nil || refresher.calls != 2 || refresher.refreshed[1] != "refresh-2" {
+		t.Errorf("RefreshIfExpired after expiry = %v with %v, want a refresh with refresh-2", err, refresher.refreshed)
+	}
+
+	if _, err := service.AccessToken(ctx, user.ID, "github"); !errors.Is(err, ErrOAuthTokenNotFound) {
+		t.Errorf("unknown provider token: err = %v, want ErrOAuthTokenNotFound", err)
+	}
+}
@@ -0,0 +1,503 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+var (
+	ErrOrderNotFound          = errors.New("order not found")
+	ErrOrderForbidden         = errors.New("order does not belong to this customer")
+	ErrCartEmpty              = repositories.ErrCartEmpty
+	ErrCartChanged            = repositories.ErrCartChanged
+	ErrInvalidOrderTransition = errors.New("order cannot move to this status")
+)
+
+// orderTransitions lists the statuses an order may move to from each
+// status. Orders start out pending; cancelled and refunded are final.
+var orderTransitions = map[models.OrderStatus][]models.OrderStatus{
+	models.OrderStatusPending:    {models.OrderStatusConfirmed, models.OrderStatusCancelled},
+	models.OrderStatusConfirmed:  {models.OrderStatusProcessing, models.OrderStatusCancelled, models.OrderStatusRefunded},
+	models.OrderStatusProcessing: {models.OrderStatusShipped, models.OrderStatusCancelled, models.OrderStatusRefunded},
+	models.OrderStatusShipped:    {models.OrderStatusDelivered, models.OrderStatusRefunded},
+	models.OrderStatusDelivered:  {models.OrderStatusRefunded},
+	models.OrderStatusCancelled:  {},
+	models.OrderStatusRefunded:   {},
+}
+
+// OrderEmailer emails customers about their orders.
+type OrderEmailer interface {
+	SendOrderConfirmation(ctx context.Context, order *models.Order) error
+	SendShippingNotification(ctx context.Context, order *models.Order) error
+}
+
+// ErrShippingNotAvailable rejects an order containing a product that cannot
+// be shipped to the order's shipping country.
+type ErrShippingNotAvailable struct {
+	ProductName      string
+	AllowedCountries []string
+}
+
+func (e *ErrShippingNotAvailable) Error() string {
+	return fmt.Sprintf("%s can only be shipped to %s", e.ProductName, strings.Join(e.AllowedCountries, ", "))
+}
+
+type OrderService struct {
+	orderRepo    *repositories.OrderRepository
+	productRepo  *repositories.ProductRepository
+	customerRepo *repositories.CustomerRepository
+	noteRepo     *repositories.OrderNoteRepository
+	cartRepo     *repositories.CartRepository
+	couponRepo   *repositories.CouponRepository
+	tax          *TaxService
+	marketplace  *MarketplaceService
+	hub          *NotificationHub
+	emails       OrderEmailer
+	webhooks     *WebhookDispatcher
+}
+
+func NewOrderService(
+	orderRepo *repositories.OrderRepository,
+	productRepo *repositories.ProductRepository,
+	customerRepo *repositories.CustomerRepository,
+	noteRepo *repositories.OrderNoteRepository,
+	cartRepo *repositories.CartRepository,
+	couponRepo *repositories.CouponRepository,
+	tax *TaxService,
+	marketplace *MarketplaceService,
+	hub *NotificationHub,
+	emails OrderEmailer,
+	webhooks *WebhookDispatcher,
+) *OrderService {
+	return &OrderService{
+		orderRepo:    orderRepo,
+		productRepo:  productRepo,
+		customerRepo: customerRepo,
+		noteRepo:     noteRepo,
+		cartRepo:     cartRepo,
+		couponRepo:   couponRepo,
+		tax:          tax,
+		marketplace:  marketplace,
+		hub:          hub,
+		emails:       emails,
+		webhooks:     webhooks,
+	}
+}
+
+// CreateOrder checks that every item can be shipped to the shipping
+// address, totals and taxes the items, persists the order together with the
+// vendor payouts for any marketplace items and notifies connected admins
+// and webhook endpoints.
+func (s *OrderService) CreateOrder(ctx context.Context, order *models.Order) error {
+	if err := s.prepareOrder(ctx, order); err != nil {
+		return err
+	}
+
+	if err := s.orderRepo.Create(ctx, order, s.marketplace.SplitRevenue); err != nil {
+		return err
+	}
+
+	s.orderPlaced(ctx, order)
+	return nil
+}
+
+// CreateRenewalOrder creates the renewal order for a subscription like
+// CreateOrder, and moves the subscription to its next billing date in the
+// same transaction. If another run renewed the subscription first,
+// repositories.ErrConflict is returned and no order is created.
+func (s *OrderService) CreateRenewalOrder(ctx context.Context, order *models.Order, sub *models.Subscription, nextBillingAt time.Time) error {
+	if err := s.prepareOrder(ctx, order); err != nil {
+		return err
+	}
+
+	err := s.orderRepo.CreateRenewal(ctx, order, s.marketplace.SplitRevenue, sub.ID, sub.NextBillingAt, nextBillingAt)
+	if err != nil {
+		return err
+	}
+
+	s.orderPlaced(ctx, order)
+	return nil
+}
+
+// prepareOrder prices the order as priceOrder does and fills in its
+// initial statuses.
+func (s *OrderService) prepareOrder(ctx context.Context, order *models.Order) error {
+	if err := s.priceOrder(ctx, order); err != nil {
+		return err
+	}
+
+	if order.Status == "" {
+		order.Status = models.OrderStatusPending
+	}
+	if order.PaymentStatus == "" {
+		order.PaymentStatus = "pending"
+	}
+	return nil
+}
+
+// Checkout places the contents of the user's cart as an order and empties
+// the cart. Stock is taken in the same transaction, so an item that ran out
+// since it was added fails the whole order with ErrOutOfStock. The cart's
+// coupon, if any, is taken off the order and one of its uses claimed; a
+// coupon that no longer applies fails the order with the reason. Tax is
+// charged on what is left after the discount. The order is priced before
+// the transaction begins; if the cart changes in the meantime the order
+// fails with ErrCartChanged.
+func (s *OrderService) Checkout(ctx context.Context, userID uuid.UUID, req *models.CheckoutRequest) (*models.Order, error) {
+	customer, err := s.customerRepo.GetOrCreateByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	cart, err := s.cartRepo.GetOrCreate(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	order := &models.Order{
+		CustomerID:      customer.ID,
+		Status:          models.OrderStatusPending,
+		ShippingAddress: req.ShippingAddress,
+		BillingAddress:  req.BillingAddress,
+		PaymentMethod:   req.PaymentMethod,
+		PaymentStatus:   "pending",
+		Notes:           req.Notes,
+	}
+	if order.BillingAddress == nil {
+		order.BillingAddress = order.ShippingAddress
+	}
+
+	if err := s.orderRepo.CreateFromCart(ctx, cart.ID, order, s.priceOrder, s.marketplace.SplitRevenue); err != nil {
+		return nil, err
+	}
+
+	s.orderPlaced(ctx, order)
+	return order, nil
+}
+
+// priceOrder checks that every item can be shipped to the shipping address
+// and fills in the order's discount, tax and total from its items: its
+// coupon, if any, comes off first and tax is charged on what is left.
+func (s *OrderService) priceOrder(ctx context.Context, order *models.Order) error {
+	ids := make([]uuid.UUID, len(order.Items))
+	for i, item := range order.Items {
+		ids[i] = item.ProductID
+	}
+	products, err := s.productRepo.ListForOrder(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	if err := checkShipping(order, products); err != nil {
+		return err
+	}
+
+	order.DiscountAmount = 0
+	if order.CouponID != nil {
+		if err := s.applyCoupon(ctx, order); err != nil {
+			return err
+		}
+	}
+
+	rate, err := s.tax.ResolveRate(ctx, order.ShippingAddress)
+	if err != nil {
+		return err
+	}
+	applyOrderTax(order, products, rate)
+	return nil
+}
+
+// applyCoupon sets the order's coupon code and discount from its coupon.
+func (s *OrderService) applyCoupon(ctx context.Context, order *models.Order) error {
+	coupon, err := s.couponRepo.GetByID(ctx, *order.CouponID)
+	if err != nil {
+		return err
+	}
+	if coupon == nil {
+		return ErrCouponNotFound
+	}
+
+	items := make([]*models.CartItem, len(order.Items))
+	for i, item := range order.Items {
+		items[i] = &models.CartItem{ProductID: item.ProductID, Quantity: item.Quantity, UnitPrice: item.Price}
+	}
+
+	order.DiscountAmount, err = couponDiscount(coupon, items, time.Now())
+	if err != nil {
+		return err
+	}
+	order.CouponCode = coupon.Code
+	return nil
+}
+
+// applyOrderTax sets the order's tax and total from the rate for its
+// shipping address, after the discount, which is spread over the items in
+// proportion to their amounts. An item whose price already includes tax,
+// because the rate is inclusive or the product is priced with tax, has the
+// tax extracted from it; on the other items it is added on top. Orders to
+// addresses without a rate are not taxed.
+func applyOrderTax(order *models.Order, products []*models.Product, rate *models.TaxRate) {
+	includesTax := make(map[uuid.UUID]bool, len(products))
+	for _, product := range products {
+		includesTax[product.ID] = product.PriceIncludesTax
+	}
+
+	subtotal := 0.0
+	for _, item := range order.Items {
+		subtotal += item.Price * float64(item.Quantity)
+	}
+	taxable := math.Max(0, subtotal-order.DiscountAmount)
+
+	order.TaxAmount, order.TaxRate, order.TaxInclusive = 0, 0, false
+	if rate == nil || subtotal == 0 {
+		order.TotalAmount = roundCents(taxable)
+		return
+	}
+
+	inclusive := &models.TaxRate{Rate: rate.Rate, IsInclusive: true}
+	tax, added := 0.0, 0.0
+	allInclusive := true
+	for _, item := range order.Items {
+		amount := taxable * item.Price * float64(item.Quantity) / subtotal
+		if rate.IsInclusive || includesTax[item.ProductID] {
+			tax += taxOn(inclusive, amount)
+			continue
+		}
+		lineTax := taxOn(rate, amount)
+		tax += lineTax
+		added += lineTax
+		allInclusive = false
+	}
+
+	order.TaxAmount = roundCents(tax)
+	order.TaxRate = rate.Rate
+	order.TaxInclusive = allInclusive
+	order.TotalAmount = roundCents(taxable + added)
+}
+
+// orderPlaced emails the customer a confirmation and notifies connected
+// admins and webhook endpoints.
+func (s *OrderService) orderPlaced(ctx context.Context, order *models.Order) {
+	// The order is already placed, so a failed email is logged rather than
+	// surfaced to the customer
+	if err := s.sendConfirmation(ctx, order.ID); err != nil {
+		log.Printf("Failed to send confirmation for order %s: %v\n", order.ID, err)
+	}
+
+	s.hub.BroadcastToAdmins(AdminNotification{
+		Type:    "new_order",
+		OrderID: order.ID,
+		Total:   order.TotalAmount,
+	})
+
+	if err := s.webhooks.Dispatch(ctx, WebhookEventOrderCreated, order); err != nil {
+		log.Printf("Failed to dispatch webhook for order %s: %v\n", order.ID, err)
+	}
+}
+
+// sendConfirmation emails the order's customer a confirmation. The order is
+// read back for the customer's name and email.
+func (s *OrderService) sendConfirmation(ctx context.Context, orderID uuid.UUID) error {
+	order, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if order == nil {
+		return ErrOrderNotFound
+	}
+
+	return s.emails.SendOrderConfirmation(ctx, order)
+}
+
+// checkShipping returns an *ErrShippingNotAvailable for the first of the
+// order's products whose shipping restrictions exclude the order's
+// shipping country.
+func checkShipping(order *models.Order, products []*models.Product) error {
+	country := strings.TrimSpace(order.ShippingAddress["country"])
+	for _, product := range products {
+		if !product.CanShipTo(country) {
+			return &ErrShippingNotAvailable{
+				ProductName:      product.Name,
+				AllowedCountries: product.ShippingRestrictions,
+			}
+		}
+	}
+
+	return nil
+}
+
+// UpdatePaymentStatus records the outcome of a payment attempt on an order.
+func (s *OrderService) UpdatePaymentStatus(ctx context.Context, orderID uuid.UUID, paymentStatus string) error {
+	return s.orderRepo.UpdatePaymentStatus(ctx, orderID, paymentStatus)
+}
+
+// Transition moves the order to newStatus, attributed to actorID in the
+// audit log. The move must be allowed by orderTransitions, or
+// ErrInvalidOrderTransition is returned. Shipping an order emails the
+// customer. Cancelling or refunding one restocks its items, frees its event
+// seats, gives back its coupon use and drops its pending vendor payouts,
+// with the status change, and notifies connected admins.
+func (s *OrderService) Transition(ctx context.Context, orderID uuid.UUID, newStatus models.OrderStatus, actorID uuid.UUID) error {
+	order, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return err
+	}
+	if order == nil {
+		return ErrOrderNotFound
+	}
+
+	return s.transition(ctx, order, newStatus, actorID)
+}
+
+// Cancel cancels one of the customer's own orders. Customers can only
+// cancel orders that are still pending.
+func (s *OrderService) Cancel(ctx context.Context, orderID, userID uuid.UUID) error {
+	order, err := s.getAccessibleOrder(ctx, orderID, userID, "customer")
+	if err != nil {
+		return err
+	}
+	if order.Status != models.OrderStatusPending {
+		return ErrInvalidOrderTransition
+	}
+
+	return s.transition(ctx, order, models.OrderStatusCancelled, userID)
+}
+
+func (s *OrderService) transition(ctx context.Context, order *models.Order, newStatus models.OrderStatus, actorID uuid.UUID) error {
+	if !canMoveOrder(order.Status, newStatus) {
+		return ErrInvalidOrderTransition
+	}
+
+	if err := s.orderRepo.UpdateStatus(ctx, order.ID, order.Status, newStatus, actorID); err != nil {
+		return err
+	}
+	order.Status = newStatus
+
+	// The status change is saved, so a failed email is only logged
+	switch newStatus {
+	case models.OrderStatusShipped:
+		if err := s.emails.SendShippingNotification(ctx, order); err != nil {
+			log.Printf("Failed to notify customer of shipped order %s: %v\n", order.ID, err)
+		}
+	case models.OrderStatusCancelled, models.OrderStatusRefunded:
+		s.hub.BroadcastToAdmins(AdminNotification{
+			Type:    "order_" + string(newStatus),
+			OrderID: order.ID,
+			Total:   order.TotalAmount,
+		})
+	}
+
+	return nil
+}
+
+func canMoveOrder(from, to models.OrderStatus) bool {
+	for _, allowed := range orderTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// GetOrder returns an order with its notes. Admins see every note and any
+// order; everyone else only sees their own orders and non-internal notes.
+func (s *OrderService) GetOrder(ctx context.Context, orderID, userID uuid.UUID, role string) (*models.Order, error) {
+	order, err := s.getAccessibleOrder(ctx, orderID, userID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := s.noteRepo.ListByOrder(ctx, order.ID, role == "admin")
+	if err != nil {
+		return nil, err
+	}
+	order.OrderNotes = notes
+
+	return order, nil
+}
+
+// AddCustomerNote attaches a customer-visible note to one of the customer's
+// own orders.
+func (s *OrderService) AddCustomerNote(ctx context.Context, orderID, userID uuid.UUID, content string) (*models.OrderNote, error) {
+	order, err := s.getAccessibleOrder(ctx, orderID, userID, "customer")
+	if err != nil {
+		return nil, err
+	}
+
+	return s.addNote(ctx, order.ID, userID, content, false)
+}
+
+// AddInternalNote attaches a staff-only note to any order.
+func (s *OrderService) AddInternalNote(ctx context.Context, orderID, authorID uuid.UUID, content string) (*models.OrderNote, error) {
+	order, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+
+	return s.addNote(ctx, order.ID, authorID, content, true)
+}
+
+// SearchOrders runs an admin search across order IDs, customer emails, item
+// SKUs and note content.
+func (s *OrderService) SearchOrders(ctx context.Context, filter models.OrderSearchFilter, limit, offset int) ([]*models.OrderSearchResult, int, error) {
+	return s.orderRepo.Search(ctx, filter, limit, offset)
+}
+
+func (s *OrderService) ListOrders(ctx context.Context, filter models.OrderAdminFilter, limit, offset int) ([]*models.Order, int, error) {
+	return s.orderRepo.AdminList(ctx, filter, limit, offset)
+}
+
+// ExportOrders streams the orders matching the filter to fn, oldest first.
+func (s *OrderService) ExportOrders(ctx context.Context, filter models.OrderAdminFilter, fn func(*models.OrderExportRow) error) error {
+	return s.orderRepo.Export(ctx, filter, fn)
+}
+
+func (s *OrderService) addNote(ctx context.Context, orderID, authorID uuid.UUID, content string, internal bool) (*models.OrderNote, error) {
+	note := &models.OrderNote{
+		OrderID:    orderID,
+		AuthorID:   authorID,
+		Content:    content,
+		IsInternal: internal,
+	}
+
+	if err := s.noteRepo.Create(ctx, note); err != nil {
+		return nil, err
+	}
+
+	return note, nil
+}
+
+func (s *OrderService) getAccessibleOrder(ctx context.Context, orderID, userID uuid.UUID, role string) (*models.Order, error) {
+	order, err := s.orderRepo.GetByID(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if order == nil {
+		return nil, ErrOrderNotFound
+	}
+
+	if role == "admin" {
+		return order, nil
+	}
+
+	customer, err := s.customerRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil || customer.ID != order.CustomerID {
+		return nil, ErrOrderForbidden
+	}
+
+	return order, nil
+}
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+func TestOrderTransitions(t *testing.T) {
+	statuses := []models.OrderStatus{
+		models.OrderStatusPending,
+		models.OrderStatusConfirmed,
+		models.OrderStatusProcessing,
+		models.OrderStatusShipped,
+		models.OrderStatusDelivered,
+		models.OrderStatusCancelled,
+		models.OrderStatusRefunded,
+	}
+	for _, status := range statuses {
+		if _, ok := orderTransitions[status]; !ok {
+			t.Errorf("orderTransitions has no entry for %s", status)
+		}
+	}
+
+	allowed := []struct{ from, to models.OrderStatus }{
+		{models.OrderStatusPending, models.OrderStatusConfirmed},
+		{models.OrderStatusPending, models.OrderStatusCancelled},
+		{models.OrderStatusConfirmed, models.OrderStatusProcessing},
+		{models.OrderStatusProcessing, models.OrderStatusShipped},
+		{models.OrderStatusShipped, models.OrderStatusDelivered},
+		{models.OrderStatusDelivered, models.OrderStatusRefunded},
+	}
+	for _, move := range allowed {
+		if !canMoveOrder(move.from, move.to) {
+			t.Errorf("%s -> %s is refused, want allowed", move.from, move.to)
+		}
+	}
+
+	refused := []struct{ from, to models.OrderStatus }{
+		{models.OrderStatusPending, models.OrderStatusShipped},
+		{models.OrderStatusPending, models.OrderStatusRefunded},
+		{models.OrderStatusShipped, models.OrderStatusCancelled},
+		{models.OrderStatusDelivered, models.OrderStatusPending},
+		{models.OrderStatusConfirmed, models.OrderStatusPending},
+	}
+	for _, move := range refused {
+		if canMoveOrder(move.from, move.to) {
+			t.Errorf("%s -> %s is allowed, want refused", move.from, move.to)
+		}
+	}
+
+	// Cancelled and refunded orders are final
+	for _, final := range []models.OrderStatus{models.OrderStatusCancelled, models.OrderStatusRefunded} {
+		for _, to := range statuses {
+			if canMoveOrder(final, to) {
+				t.Errorf("%s -> %s is allowed, want %s to be final", final, to, final)
+			}
+		}
+	}
+}
+
+func TestApplyOrderTax(t *testing.T) {
+	plain, taxIncluded := uuid.New(), uuid.New()
+	products := []*models.Product{
+		{ID: plain},
+		{ID: taxIncluded, PriceIncludesTax: true},
+	}
+	exclusive := &models.TaxRate{Rate: 0.2}
+	inclusive := &models.TaxRate{Rate: 0.2, IsInclusive: true}
+
+	tests := []struct {
+		name          string
+		items         []*models.OrderItem
+		discount      float64
+		rate          *models.TaxRate
+		wantTax       float64
+		wantTotal     float64
+		wantInclusive bool
+	}{
+		{
+			name:      "no rate for the address",
+			items:     []*models.OrderItem{{ProductID: plain, Price: 10, Quantity: 2}},
+			discount:  5,
+			wantTotal: 15,
+		},
+		{
+			name:      "tax added on top",
+			items:     []*models.OrderItem{{ProductID: plain, Price: 10, Quantity: 2}},
+			rate:      exclusive,
+			wantTax:   4,
+			wantTotal: 24,
+		},
+		{
+			name:      "tax on what is left after the discount",
+			items:     []*models.OrderItem{{ProductID: plain, Price: 10, Quantity: 2}},
+			discount:  5,
+			rate:      exclusive,
+			wantTax:   3,
+			wantTotal: 18,
+		},
+		{
+			name:          "inclusive rate",
+			items:         []*models.OrderItem{{ProductID: plain, Price: 12, Quantity: 1}},
+			rate:          inclusive,
+			wantTax:       2,
+			wantTotal:     12,
+			wantInclusive: true,
+		},
+		{
+			name:          "products priced with tax under an exclusive rate",
+			items:         []*models.OrderItem{{ProductID: taxIncluded, Price: 12, Quantity: 1}},
+			rate:          exclusive,
+			wantTax:       2,
+			wantTotal:     12,
+			wantInclusive: true,
+		},
+		{
+			name: "tax added only to the items priced without it",
+			items: []*models.OrderItem{
+				{ProductID: taxIncluded, Price: 12, Quantity: 1},
+				{ProductID: plain, Price: 10, Quantity: 1},
+			},
+			rate:      exclusive,
+			wantTax:   4,
+			wantTotal: 24,
+		},
+		{
+			name:     "discount larger than the order",
+			items:    []*models.OrderItem{{ProductID: plain, Price: 10, Quantity: 1}},
+			discount: 15,
+			rate:     exclusive,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order := &models.Order{Items: tt.items, DiscountAmount: tt.discount}
+			applyOrderTax(order, products, tt.rate)
+			if order.TaxAmount != tt.wantTax || order.TotalAmount != tt.wantTotal || order.TaxInclusive != tt.wantInclusive {
+				t.Errorf("tax %v, total %v, inclusive %v; want %v, %v, %v",
+					order.TaxAmount, order.TotalAmount, order.TaxInclusive, tt.wantTax, tt.wantTotal, tt.wantInclusive)
+			}
+		})
+	}
+}
+
+func TestCheckShipping(t *testing.T) {
+	anywhere := &models.Product{Name: "Poster"}
+	euOnly := &models.Product{Name: "Cheese", ShippingRestrictions: []string{"FR", "DE"}}
+	products := []*models.Product{anywhere, euOnly}
+
+	for _, country := range []string{"FR", " de "} {
+		order := &models.Order{ShippingAddress: map[string]string{"country": country}}
+		if err := checkShipping(order, products); err != nil {
+			t.Errorf("shipping to %q: %v", country, err)
+		}
+	}
+
+	order := &models.Order{ShippingAddress: map[string]string{"country": "US"}}
+	err := checkShipping(order, products)
+	var notAvailable *ErrShippingNotAvailable
+	if !errors.As(err, &notAvailable) {
+		t.Fatalf("shipping to US: err = %v, want ErrShippingNotAvailable", err)
+	}
+	if notAvailable.ProductName != "Cheese" {
+		t.Errorf("product = %q, want Cheese", notAvailable.ProductName)
+	}
+	if got := err.Error(); got != "Cheese can only be shipped to FR, DE" {
+		t.Errorf("message = %q", got)
+	}
+
+	if err := checkShipping(order, []*models.Product{anywhere}); err != nil {
+		t.Errorf("unrestricted product: %v", err)
+	}
+}
+
+// Customers see the notes on their own orders except internal ones, and
+// cannot add notes to anyone else's order.
+func TestOrderNotes(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	customerRepo := repositories.NewCustomerRepository(pool, nil)
+	service := NewOrderService(repositories.NewOrderRepository(pool, nil), nil, customerRepo,
+		repositories.NewOrderNoteRepository(pool), nil, nil, nil, nil, nil, nil, nil)
+
+	owner, other, admin := createTestUser(t, pool), createTestUser(t, pool), createTestUser(t, pool)
+	customer, err := customerRepo.GetOrCreateByUserID(ctx, owner.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.customers WHERE id = $1"), customer.ID)
+	})
+	var orderID uuid.UUID
+	err = pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {shop}.orders (customer_id, status, total_amount, shipping_address, billing_address, payment_method, payment_status)
+		VALUES ($1, 'pending', 10, '{}', '{}', 'card', 'pending')
+		RETURNING id
+	`), customer.ID).Scan(&orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.orders WHERE id = $1"), orderID)
+	})
+
+	if _, err := service.AddCustomerNote(ctx, orderID, owner.ID, "Please gift wrap it"); err != nil {
+		t.Fatalf("AddCustomerNote by the owner: %v", err)
+	}
+	if _, err := service.AddInternalNote(ctx, orderID, admin.ID, "Customer called twice"); err != nil {
+		t.Fatalf("AddInternalNote: %v", err)
+	}
+	if _, err := service.AddCustomerNote(ctx, orderID, other.ID, "Not my order"); !errors.Is(err, ErrOrderForbidden) {
+		t.Errorf("AddCustomerNote on another user's order: err = %v, want ErrOrderForbidden", err)
+	}
+
+	tests := []struct {
+		name      string
+		userID    uuid.UUID
+		role      string
+		wantNotes int
+	}{
+		{"owner", owner.ID, "customer", 1},
+		{"admin", admin.ID, "admin", 2},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			order, err := service.GetOrder(ctx, orderID, tc.userID, tc.role)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(order.OrderNotes) != tc.wantNotes {
+				t.Fatalf("got %d notes, want %d", len(order.OrderNotes), tc.wantNotes)
+			}
+			for _, note := range order.OrderNotes {
+				if note.IsInternal && tc.role != "admin" {
+					t.Errorf("internal note %q shown to a customer", note.Content)
+				}
+			}
+		})
+	}
+}
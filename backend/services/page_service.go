@@ -0,0 +1,150 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/util"
+)
+
+// defaultPageTemplate is the layout of pages that do not pick one.
+const defaultPageTemplate = "default"
+
+var (
+	ErrPageNotFound       = repositories.ErrPageNotFound
+	ErrPageSlugTaken      = repositories.ErrPageSlugTaken
+	ErrInvalidPageSlug    = errors.New("page needs a slug or title with letters or digits")
+	ErrPageNotPublishable = errors.New("meta_title and meta_description are required to publish a page")
+)
+
+// PageService manages CMS pages. Pages are created as drafts and only shown
+// to visitors once published.
+type PageService struct {
+	pageRepo *repositories.PageRepository
+}
+
+func NewPageService(pageRepo *repositories.PageRepository) *PageService {
+	return &PageService{pageRepo: pageRepo}
+}
+
+// GetPublishedBySlug returns the published page with the slug.
+func (s *PageService) GetPublishedBySlug(ctx context.Context, slug string) (*models.Page, error) {
+	page, err := s.pageRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if page == nil || page.Status != "published" {
+		return nil, ErrPageNotFound
+	}
+	return page, nil
+}
+
+// GetByID returns the page, whatever its status.
+func (s *PageService) GetByID(ctx context.Context, id uuid.UUID) (*models.Page, error) {
+	page, err := s.pageRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if page == nil {
+		return nil, ErrPageNotFound
+	}
+	return page, nil
+}
+
+// List returns a page of the pages with the given status, or of all of them
+// when status is empty, most recently updated first.
+func (s *PageService) List(ctx context.Context, status string, limit, offset int) ([]*models.Page, int, error) {
+	return s.pageRepo.List(ctx, status, limit, offset)
+}
+
+// Create adds the page as a draft.
+func (s *PageService) Create(ctx context.Context, req *models.PageRequest) (*models.Page, error) {
+	page := &models.Page{Status: "draft"}
+	if err := applyPageRequest(page, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.pageRepo.Create(ctx, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Update replaces the page's content. A published page stays published, so
+// the meta fields it was published with cannot be cleared.
+func (s *PageService) Update(ctx context.Context, id uuid.UUID, req *models.PageRequest) (*models.Page, error) {
+	page, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyPageRequest(page, req); err != nil {
+		return nil, err
+	}
+	if page.Status == "published" && !pagePublishable(page) {
+		return nil, ErrPageNotPublishable
+	}
+
+	if err := s.pageRepo.Update(ctx, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+func (s *PageService) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.pageRepo.Delete(ctx, id)
+}
+
+// Publish shows the page to visitors. It needs a meta title and description
+// and yields ErrPageNotPublishable without them.
+func (s *PageService) Publish(ctx context.Context, id uuid.UUID) error {
+	page, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if !pagePublishable(page) {
+		return ErrPageNotPublishable
+	}
+
+	page.Status = "published"
+	return s.pageRepo.UpdateStatus(ctx, page)
+}
+
+// Unpublish takes the page back to a draft.
+func (s *PageService) Unpublish(ctx context.Context, id uuid.UUID) error {
+	page, err := s.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	page.Status = "draft"
+	return s.pageRepo.UpdateStatus(ctx, page)
+}
+
+func applyPageRequest(page *models.Page, req *models.PageRequest) error {
+	page.Title = strings.TrimSpace(req.Title)
+	page.Slug = util.Slugify(req.Slug)
+	if page.Slug == "" {
+		page.Slug = util.Slugify(page.Title)
+	}
+	if page.Slug == "" {
+		return ErrInvalidPageSlug
+	}
+
+	page.Content = req.Content
+	page.MetaTitle = strings.TrimSpace(req.MetaTitle)
+	page.MetaDescription = strings.TrimSpace(req.MetaDescription)
+	page.Template = strings.TrimSpace(req.Template)
+	if page.Template == "" {
+		page.Template = defaultPageTemplate
+	}
+	return nil
+}
+
+func pagePublishable(page *models.Page) bool {
+	return page.MetaTitle != "" && page.MetaDescription != ""
+}
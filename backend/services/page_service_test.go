@@ -0,0 +1,58 @@
+package services
+
+import (
+	"context"
+	"testing"
+
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// A page is only published once it has a meta title and description, and
+// stays hidden from visitors until then.
+func TestPublishRequiresMetaFields(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	service := NewPageService(repositories.NewPageRepository(pool, nil, repositories.NewRedirectRepository(pool)))
+
+	page, err := service.Create(ctx, &models.PageRequest{Title: "Terms", Slug: dbtest.UniqueName("terms"), Content: "The terms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.pages WHERE id = $1"), page.ID)
+	})
+
+	if err := service.Publish(ctx, page.ID); err != ErrPageNotPublishable {
+		t.Fatalf("publishing without meta fields: err = %v, want ErrPageNotPublishable", err)
+	}
+	if _, err := service.GetPublishedBySlug(ctx, page.Slug); err != ErrPageNotFound {
+		t.Errorf("draft page by slug: err = %v, want ErrPageNotFound", err)
+	}
+
+	_, err = service.Update(ctx, page.ID, &models.PageRequest{
+		Title:           "Terms",
+		Slug:            page.Slug,
+		Content:         "The terms",
+		MetaTitle:       "Terms of service",
+		MetaDescription: "The terms of using the site",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.Publish(ctx, page.ID); err != nil {
+		t.Fatalf("publishing with meta fields: %v", err)
+	}
+	if _, err := service.GetPublishedBySlug(ctx, page.Slug); err != nil {
+		t.Errorf("published page by slug: %v", err)
+	}
+
+	if err := service.Unpublish(ctx, page.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.GetPublishedBySlug(ctx, page.Slug); err != ErrPageNotFound {
+		t.Errorf("unpublished page by slug: err = %v, want ErrPageNotFound", err)
+	}
+}
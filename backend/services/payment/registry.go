@@ -0,0 +1,114 @@
+// Package payment holds the payment providers. Each provider registers a
+// factory under its name from an init function, so adding one means
+// implementing PaymentProvider, registering it and importing its package.
+package payment
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+var ErrUnknownProvider = errors.New("unknown payment provider")
+
+// PaymentRequest describes a payment to collect for an order. Amount is in
+// major units of Currency, e.g. 12.50 USD.
+type PaymentRequest struct {
+	OrderID       uuid.UUID
+	Amount        float64
+	Currency      string
+	Description   string
+	CustomerEmail string
+}
+
+// PaymentResult is the provider's answer to a new payment. Reference
+// identifies the payment with the provider. ClientSecret or RedirectURL,
+// depending on the provider, lets the customer complete it.
+type PaymentResult struct {
+	Provider     string `json:"provider"`
+	Reference    string `json:"reference"`
+	Status       string `json:"status"`
+	ClientSecret string `json:"client_secret,omitempty"`
+	RedirectURL  string `json:"redirect_url,omitempty"`
+}
+
+type PaymentProvider interface {
+	Name() string
+	InitPayment(ctx context.Context, req *PaymentRequest) (*PaymentResult, error)
+}
+
+// Factory builds a provider from the application configuration.
+type Factory func(cfg *viper.Viper) PaymentProvider
+
+// Registry maps provider names to factories.
+type Registry struct {
+	mu        sync.RWMutex
+	cfg       *viper.Viper
+	factories map[string]Factory
+}
+
+// NewRegistry creates an empty registry whose providers are built from cfg.
+func NewRegistry(cfg *viper.Viper) *Registry {
+	return &Registry{cfg: cfg, factories: map[string]Factory{}}
+}
+
+// Register adds a provider factory. Registering the same name twice is a
+// programming error and panics.
+func (r *Registry) Register(name string, factory Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.factories[name]; exists {
+		panic(fmt.Sprintf("payment provider %q registered twice", name))
+	}
+	r.factories[name] = factory
+}
+
+// Get builds the provider registered under name.
+func (r *Registry) Get(name string) (PaymentProvider, error) {
+	r.mu.RLock()
+	factory, ok := r.factories[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	return factory(r.cfg), nil
+}
+
+// Names lists the registered providers in alphabetical order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DefaultRegistry is the registry providers add themselves to. It builds
+// them from the global viper configuration.
+var DefaultRegistry = NewRegistry(viper.GetViper())
+
+// Register adds a provider factory to DefaultRegistry.
+func Register(name string, factory Factory) {
+	DefaultRegistry.Register(name, factory)
+}
+
+// Get builds a provider from DefaultRegistry.
+func Get(name string) (PaymentProvider, error) {
+	return DefaultRegistry.Get(name)
+}
+
+// NewPaymentProvider builds the named provider from DefaultRegistry.
+func NewPaymentProvider(name string) (PaymentProvider, error) {
+	return Get(name)
+}
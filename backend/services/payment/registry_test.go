@@ -0,0 +1,83 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+// mockProvider records the payments it is asked to start.
+type mockProvider struct {
+	apiKey   string
+	requests []*PaymentRequest
+}
+
+func (p *mockProvider) Name() string { return "mock" }
+
+func (p *mockProvider) InitPayment(ctx context.Context, req *PaymentRequest) (*PaymentResult, error) {
+	p.requests = append(p.requests, req)
+	return &PaymentResult{Provider: "mock", Reference: "ref-1", Status: "pending"}, nil
+}
+
+func TestRegistry(t *testing.T) {
+	cfg := viper.New()
+	cfg.Set("payment.mock.api_key", "key-1")
+	registry := NewRegistry(cfg)
+
+	mock := &mockProvider{}
+	registry.Register("mock", func(cfg *viper.Viper) PaymentProvider {
+		mock.apiKey = cfg.GetString("payment.mock.api_key")
+		return mock
+	})
+
+	provider, err := registry.Get("mock")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mock.apiKey != "key-1" {
+		t.Errorf("factory read api key %q, want key-1 from the registry's config", mock.apiKey)
+	}
+
+	req := &PaymentRequest{OrderID: uuid.New(), Amount: 12.5, Currency: "USD", Description: "Order", CustomerEmail: "a@example.com"}
+	result, err := provider.InitPayment(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mock.requests) != 1 || *mock.requests[0] != *req {
+		t.Errorf("mock was called with %v, want the request once", mock.requests)
+	}
+	if result.Reference != "ref-1" {
+		t.Errorf("result = %+v, want the mock's", result)
+	}
+
+	if _, err := registry.Get("paypal"); !errors.Is(err, ErrUnknownProvider) {
+		t.Errorf("Get(paypal) err = %v, want ErrUnknownProvider", err)
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("registering mock twice did not panic")
+			}
+		}()
+		registry.Register("mock", func(cfg *viper.Viper) PaymentProvider { return &mockProvider{} })
+	}()
+
+	if names := registry.Names(); len(names) != 1 || names[0] != "mock" {
+		t.Errorf("Names = %v, want [mock]", names)
+	}
+}
+
+// Importing the package is enough for its providers to be available.
+func TestBuiltInProvidersRegisterThemselves(t *testing.T) {
+	provider, err := NewPaymentProvider("stripe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.Name() != "stripe" {
+		t.Errorf("NewPaymentProvider(stripe).Name() = %q", provider.Name())
+	}
+}
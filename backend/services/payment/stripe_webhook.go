@@ -0,0 +1,87 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StripeSignatureHeader carries the signature of Stripe webhook deliveries.
+const StripeSignatureHeader = "Stripe-Signature"
+
+// stripeSignatureTolerance bounds the age of a delivery, against replays.
+const stripeSignatureTolerance = 5 * time.Minute
+
+var ErrInvalidWebhookSignature = errors.New("invalid webhook signature")
+
+// StripeEvent is the envelope of a Stripe webhook delivery.
+type StripeEvent struct {
+	ID   string `json:"id"`
+	Type string `json:"type"`
+	Data struct {
+		Object json.RawMessage `json:"object"`
+	} `json:"data"`
+}
+
+// StripePaymentIntent holds the PaymentIntent fields the webhooks use.
+type StripePaymentIntent struct {
+	ID       string            `json:"id"`
+	Status   string            `json:"status"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// OrderID returns the order the intent was created for by InitPayment.
+func (pi *StripePaymentIntent) OrderID() (uuid.UUID, bool) {
+	id, err := uuid.Parse(pi.Metadata["order_id"])
+	return id, err == nil
+}
+
+// VerifyStripeSignature checks a Stripe-Signature header of the form
+// "t=<unix time>,v1=<hex HMAC-SHA256 of t.payload>" against the endpoint
+// secret, and rejects deliveries older than five minutes.
+func VerifyStripeSignature(payload []byte, header, secret string, now time.Time) error {
+	var timestamp string
+	var signatures []string
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		case "t":
+			timestamp = value
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrInvalidWebhookSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); age > stripeSignatureTolerance || age < -stripeSignatureTolerance {
+		return ErrInvalidWebhookSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+
+	for _, signature := range signatures {
+		decoded, err := hex.DecodeString(signature)
+		if err == nil && hmac.Equal(decoded, expected) {
+			return nil
+		}
+	}
+
+	return ErrInvalidWebhookSignature
+}
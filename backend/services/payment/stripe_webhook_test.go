@@ -0,0 +1,57 @@
+package payment
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func stripeSignature(payload []byte, secret string, at time.Time) string {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	return "t=" + timestamp + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyStripeSignature(t *testing.T) {
+	payload := []byte(`{"id":"evt_1","type":"payment_intent.succeeded"}`)
+	secret := "whsec_test"
+	now := time.Unix(1760000000, 0)
+	valid := stripeSignature(payload, secret, now)
+
+	tests := []struct {
+		name    string
+		payload []byte
+		header  string
+		secret  string
+		wantErr bool
+	}{
+		{"valid", payload, valid, secret, false},
+		{"valid among rotated signatures", payload, valid + ",v1=" + hex.EncodeToString([]byte("old")), secret, false},
+		{"slightly old", payload, stripeSignature(payload, secret, now.Add(-4*time.Minute)), secret, false},
+		{"too old", payload, stripeSignature(payload, secret, now.Add(-6*time.Minute)), secret, true},
+		{"from the future", payload, stripeSignature(payload, secret, now.Add(6*time.Minute)), secret, true},
+		{"tampered payload", []byte(`{"id":"evt_2","type":"payment_intent.succeeded"}`), valid, secret, true},
+		{"wrong secret", payload, valid, "whsec_other", true},
+		{"no signature", payload, "t=" + strconv.FormatInt(now.Unix(), 10), secret, true},
+		{"no timestamp", payload, "v1=abc", secret, true},
+		{"empty header", payload, "", secret, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := VerifyStripeSignature(tt.payload, tt.header, tt.secret, now)
+			if tt.wantErr && !errors.Is(err, ErrInvalidWebhookSignature) {
+				t.Errorf("err = %v, want ErrInvalidWebhookSignature", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("err = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// MaxPayoutAttempts is how many times a batch transfer is tried before it is
+// left failed for manual follow-up: the first attempt plus three daily
+// retries.
+const MaxPayoutAttempts = 4
+
+// BankTransferProvider sends a payout batch to the vendor's bank account.
+type BankTransferProvider interface {
+	Transfer(ctx context.Context, batch *models.PayoutBatch) error
+}
+
+// StubBankTransferProvider accepts every transfer without moving any money.
+// It stands in until a real provider is integrated.
+type StubBankTransferProvider struct{}
+
+func (StubBankTransferProvider) Transfer(ctx context.Context, batch *models.PayoutBatch) error {
+	log.Printf("Stub bank transfer of %.2f for vendor %s (%s)\n", batch.TotalAmount, batch.VendorID, batch.Reference)
+	return nil
+}
+
+type PayoutScheduler struct {
+	batchRepo *repositories.PayoutBatchRepository
+	provider  BankTransferProvider
+}
+
+func NewPayoutScheduler(batchRepo *repositories.PayoutBatchRepository, provider BankTransferProvider) *PayoutScheduler {
+	return &PayoutScheduler{batchRepo: batchRepo, provider: provider}
+}
+
+// AggregatePayouts groups the payouts by vendor and sums their net amounts,
+// rounded to cents.
+func AggregatePayouts(payouts []*models.VendorPayout) map[uuid.UUID]float64 {
+	totals := map[uuid.UUID]float64{}
+	for _, payout := range payouts {
+		totals[payout.VendorID] = roundCents(totals[payout.VendorID] + payout.NetAmount)
+	}
+	return totals
+}
+
+// ProcessPendingPayouts batches the pending payouts per vendor and transfers
+// every due batch. A failed transfer marks its batch failed so that the next
+// run retries it; the errors of all failed batches are returned together.
+func (s *PayoutScheduler) ProcessPendingPayouts(ctx context.Context) error {
+	if err := s.createBatches(ctx); err != nil {
+		return err
+	}
+
+	batches, err := s.batchRepo.ListDueBatches(ctx, MaxPayoutAttempts)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, batch := range batches {
+		if err := s.provider.Transfer(ctx, batch); err != nil {
+			errs = append(errs, fmt.Errorf("batch %s: %w", batch.Reference, err))
+			if err := s.batchRepo.MarkFailed(ctx, batch.ID, err.Error()); err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		if err := s.batchRepo.MarkPaid(ctx, batch.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *PayoutScheduler) createBatches(ctx context.Context) error {
+	payouts, err := s.batchRepo.ListUnbatchedPayouts(ctx)
+	if err != nil {
+		return err
+	}
+
+	payoutIDs := map[uuid.UUID][]uuid.UUID{}
+	for _, payout := range payouts {
+		payoutIDs[payout.VendorID] = append(payoutIDs[payout.VendorID], payout.ID)
+	}
+
+	for vendorID, total := range AggregatePayouts(payouts) {
+		id := uuid.New()
+		batch := &models.PayoutBatch{
+			ID:          id,
+			VendorID:    vendorID,
+			TotalAmount: total,
+			Reference:   payoutReference(id, time.Now()),
+			Status:      "pending",
+		}
+
+		err := s.batchRepo.CreateBatch(ctx, batch, payoutIDs[vendorID])
+		if errors.Is(err, repositories.ErrConflict) {
+			// The vendor's payouts changed underneath us; they are picked up
+			// again on the next run.
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func payoutReference(id uuid.UUID, now time.Time) string {
+	return fmt.Sprintf("PO-%s-%s", now.Format("20060102"), strings.ToUpper(id.String()[:8]))
+}
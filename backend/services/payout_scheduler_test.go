@@ -0,0 +1,36 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+func TestAggregatePayouts(t *testing.T) {
+	potter, weaver, smith := uuid.New(), uuid.New(), uuid.New()
+	payouts := []*models.VendorPayout{
+		{VendorID: potter, NetAmount: 0.1},
+		{VendorID: weaver, NetAmount: 25.5},
+		{VendorID: potter, NetAmount: 0.2},
+		{VendorID: potter, NetAmount: 17.99},
+		{VendorID: weaver, NetAmount: 4.45},
+		{VendorID: smith, NetAmount: 9.99},
+	}
+
+	got := AggregatePayouts(payouts)
+
+	want := map[uuid.UUID]float64{potter: 18.29, weaver: 29.95, smith: 9.99}
+	if len(got) != len(want) {
+		t.Fatalf("AggregatePayouts = %v, want one batch per vendor", got)
+	}
+	for vendor, total := range want {
+		if got[vendor] != total {
+			t.Errorf("vendor total = %v, want %v", got[vendor], total)
+		}
+	}
+
+	if got := AggregatePayouts(nil); len(got) != 0 {
+		t.Errorf("AggregatePayouts(nil) = %v, want no batches", got)
+	}
+}
@@ -0,0 +1,435 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+var (
+	ErrPostNotFound    = repositories.ErrPostNotFound
+	ErrPostForbidden   = errors.New("not allowed to manage this post")
+	ErrInvalidSchedule = errors.New("scheduled posts need a scheduled_at in the future")
+)
+
+// postAutosaveRetention is how long an autosave outlives its last write.
+const postAutosaveRetention = 7 * 24 * time.Hour
+
+type PostService struct {
+	postRepo     *repositories.PostRepository
+	categoryRepo *repositories.CategoryRepository
+	autosaveRepo *repositories.PostAutosaveRepository
+	seo          *SEOScorer
+	audit        *PostAuditService
+	media        *MediaService
+	webhooks     *WebhookDispatcher
+	now          func() time.Time
+}
+
+func NewPostService(postRepo *repositories.PostRepository, categoryRepo *repositories.CategoryRepository, autosaveRepo *repositories.PostAutosaveRepository, seo *SEOScorer, audit *PostAuditService, media *MediaService, webhooks *WebhookDispatcher) *PostService {
+	return &PostService{
+		postRepo:     postRepo,
+		categoryRepo: categoryRepo,
+		autosaveRepo: autosaveRepo,
+		seo:          seo,
+		audit:        audit,
+		media:        media,
+		webhooks:     webhooks,
+		now:          time.Now,
+	}
+}
+
+// ListPublished returns the page of published posts after the post with ID
+// after, or the first page when after is nil.
+func (s *PostService) ListPublished(ctx context.Context, after *uuid.UUID, limit int) (*models.PaginatedResult[*models.Post], error) {
+	return s.postRepo.List(ctx, models.PostFilter{Status: "published"}, after, limit)
+}
+
+// SearchPublished returns published posts matching the query.
+func (s *PostService) SearchPublished(ctx context.Context, query string, limit, offset int) ([]*models.Post, int, error) {
+	return s.postRepo.Search(ctx, query, limit, offset, "published")
+}
+
+// ListPublishedByCategory returns published posts in the category with the
+// given slug. With includeChildren, posts from every descendant category are
+// included too.
+func (s *PostService) ListPublishedByCategory(ctx context.Context, categorySlug string, includeChildren bool, limit, offset int) ([]*models.Post, int, error) {
+	category, err := s.categoryRepo.GetBySlug(ctx, categorySlug)
+	if err != nil {
+		return nil, 0, err
+	}
+	if category == nil {
+		return nil, 0, ErrCategoryNotFound
+	}
+
+	categoryIDs := []uuid.UUID{category.ID}
+	if includeChildren {
+		if categoryIDs, err = s.categoryRepo.GetDescendantIDs(ctx, category.ID); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return s.postRepo.ListByCategoryIDs(ctx, categoryIDs, limit, offset, "published")
+}
+
+// ListCategoryFeed returns the category with the given slug and its latest
+// published posts, newest first.
+func (s *PostService) ListCategoryFeed(ctx context.Context, categorySlug string, limit int) (*models.Category, []*models.Post, error) {
+	category, err := s.categoryRepo.GetBySlug(ctx, categorySlug)
+	if err != nil {
+		return nil, nil, err
+	}
+	if category == nil {
+		return nil, nil, ErrCategoryNotFound
+	}
+
+	posts, err := s.postRepo.ListByCategory(ctx, category.ID, limit, 0, "published")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return category, posts, nil
+}
+
+// GetPublishedBySlug returns a published post. Drafts are reported as not
+// found so their slugs don't leak.
+func (s *PostService) GetPublishedBySlug(ctx context.Context, slug string) (*models.Post, error) {
+	post, err := s.postRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil || post.Status != "published" {
+		return nil, ErrPostNotFound
+	}
+
+	return post, nil
+}
+
+// GetStats returns content statistics for the post with the given slug. Only
+// admins and the post's author may see them.
+func (s *PostService) GetStats(ctx context.Context, slug string, userID uuid.UUID, role string) (*models.PostStats, error) {
+	post, err := s.postRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, ErrPostNotFound
+	}
+	if !canEditPost(post, userID, role) {
+		return nil, ErrPostForbidden
+	}
+
+	return ComputePostStats(post), nil
+}
+
+// GetSEOScore scores the post with the given slug on basic SEO criteria.
+// Only admins and the post's author may see it.
+func (s *PostService) GetSEOScore(ctx context.Context, slug string, userID uuid.UUID, role string) (*models.SEOScore, error) {
+	post, err := s.postRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, ErrPostNotFound
+	}
+	if !canEditPost(post, userID, role) {
+		return nil, ErrPostForbidden
+	}
+
+	return s.seo.Score(post, SEOMetadataForPost(post)), nil
+}
+
+// UpdatePost replaces the post's content on behalf of an admin or the post's
+// author, and records the changed fields in the audit log. Webhook
+// endpoints are notified when the update publishes the post. It fails with
+// repositories.ErrConflict when req.Version is stale.
+func (s *PostService) UpdatePost(ctx context.Context, id, userID uuid.UUID, role string, req *models.UpdatePostRequest) (*models.Post, error) {
+	post, err := s.postRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, ErrPostNotFound
+	}
+	if !canEditPost(post, userID, role) {
+		return nil, ErrPostForbidden
+	}
+	before := *post
+
+	post.Title = req.Title
+	post.Slug = req.Slug
+	post.Content = req.Content
+	post.Excerpt = req.Excerpt
+	post.FeaturedImage = req.FeaturedImage
+	post.Status = req.Status
+	post.Version = req.Version
+	if err := s.applyFeaturedMedia(ctx, post, req.FeaturedMediaID); err != nil {
+		return nil, err
+	}
+	if err := s.applySchedule(post, req.ScheduledAt); err != nil {
+		return nil, err
+	}
+
+	post.Categories = make([]*models.Category, 0, len(req.CategoryIDs))
+	for _, categoryID := range req.CategoryIDs {
+		post.Categories = append(post.Categories, &models.Category{ID: categoryID})
+	}
+	post.Tags = make([]*models.Tag, 0, len(req.TagIDs))
+	for _, tagID := range req.TagIDs {
+		post.Tags = append(post.Tags, &models.Tag{ID: tagID})
+	}
+
+	if err := s.postRepo.Update(ctx, post); err != nil {
+		return nil, err
+	}
+
+	// The saved post supersedes the editor's autosave. A leftover row is
+	// harmless: it is older than the post, so it is no longer offered.
+	if err := s.autosaveRepo.Delete(ctx, id, userID); err != nil {
+		log.Printf("Failed to clear autosave of post %s: %v\n", id, err)
+	}
+
+	// Reload so the response carries full categories and tags
+	updated, err := s.postRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	// The update is already saved, so a failed audit entry is only logged
+	if err := s.audit.LogUpdate(ctx, userID, &before, updated); err != nil {
+		log.Printf("Failed to audit update of post %s: %v\n", id, err)
+	}
+
+	if updated.Status == "published" && before.Status != "published" {
+		dispatchPostPublished(ctx, s.webhooks, updated)
+	}
+
+	return updated, nil
+}
+
+// CreatePost creates a post by the user. A scheduled post needs a
+// scheduled_at in the future and is published by the scheduler then; a
+// post created published is sent to webhook endpoints right away.
+func (s *PostService) CreatePost(ctx context.Context, userID uuid.UUID, req *models.CreatePostRequest) (*models.Post, error) {
+	post := &models.Post{
+		Title:         req.Title,
+		Slug:          req.Slug,
+		Content:       req.Content,
+		Excerpt:       req.Excerpt,
+		FeaturedImage: req.FeaturedImage,
+		Status:        req.Status,
+	}
+	if err := s.applyFeaturedMedia(ctx, post, req.FeaturedMediaID); err != nil {
+		return nil, err
+	}
+	if err := s.applySchedule(post, req.ScheduledAt); err != nil {
+		return nil, err
+	}
+
+	post.Categories = make([]*models.Category, 0, len(req.CategoryIDs))
+	for _, categoryID := range req.CategoryIDs {
+		post.Categories = append(post.Categories, &models.Category{ID: categoryID})
+	}
+	post.Tags = make([]*models.Tag, 0, len(req.TagIDs))
+	for _, tagID := range req.TagIDs {
+		post.Tags = append(post.Tags, &models.Tag{ID: tagID})
+	}
+
+	authorID, err := s.postRepo.AuthorIDForUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	post.AuthorID = authorID
+
+	if err := s.postRepo.Create(ctx, post); err != nil {
+		return nil, err
+	}
+
+	created, err := s.postRepo.GetByID(ctx, post.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if created != nil && created.Status == "published" {
+		dispatchPostPublished(ctx, s.webhooks, created)
+	}
+
+	return created, nil
+}
+
+// dispatchPostPublished sends the post.published webhook. The post is
+// already saved, so a failure is only logged.
+func dispatchPostPublished(ctx context.Context, webhooks *WebhookDispatcher, post *models.Post) {
+	if err := webhooks.Dispatch(ctx, WebhookEventPostPublished, post); err != nil {
+		log.Printf("Failed to dispatch webhook for published post %s: %v\n", post.ID, err)
+	}
+}
+
+// applyFeaturedMedia sets the post's featured image to the uploaded image
+// with the given ID, if any.
+func (s *PostService) applyFeaturedMedia(ctx context.Context, post *models.Post, mediaID *uuid.UUID) error {
+	if mediaID == nil {
+		return nil
+	}
+	url, err := s.media.ImageURL(ctx, *mediaID)
+	if err != nil {
+		return err
+	}
+	post.FeaturedImage = url
+	return nil
+}
+
+// applySchedule sets the post's publish and schedule times for its status.
+// A scheduled post keeps scheduledAt, which must be in the future; a post
+// being published without a past publish time is published as of now.
+func (s *PostService) applySchedule(post *models.Post, scheduledAt *time.Time) error {
+	post.ScheduledAt = nil
+	switch post.Status {
+	case "scheduled":
+		if scheduledAt == nil || !scheduledAt.After(s.now()) {
+			return ErrInvalidSchedule
+		}
+		post.ScheduledAt = scheduledAt
+		post.PublishedAt = nil
+	case "published":
+		if post.PublishedAt == nil || post.PublishedAt.After(s.now()) {
+			now := s.now()
+			post.PublishedAt = &now
+		}
+	}
+	return nil
+}
+
+// DuplicatePost copies a post as a new draft titled "Copy of ..." with the
+// same categories and tags, recording the source in ClonedFrom. Only admins
+// and the post's author may duplicate it.
+func (s *PostService) DuplicatePost(ctx context.Context, id, userID uuid.UUID, role string) (*models.Post, error) {
+	source, err := s.postRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, ErrPostNotFound
+	}
+	if !canEditPost(source, userID, role) {
+		return nil, ErrPostForbidden
+	}
+
+	// Leave room for the suffix within the 255 character slug column
+	base := source.Slug
+	if len(base) > 240 {
+		base = strings.TrimRight(base[:240], "-")
+	}
+
+	post := &models.Post{
+		Title:         "Copy of " + source.Title,
+		Slug:          base + "-copy-" + strings.ToLower(uuid.New().String()[:8]),
+		Content:       source.Content,
+		Excerpt:       source.Excerpt,
+		FeaturedImage: source.FeaturedImage,
+		AuthorID:      source.AuthorID,
+		Status:        "draft",
+		ClonedFrom:    &source.ID,
+		Categories:    source.Categories,
+		Tags:          source.Tags,
+	}
+	if title := []rune(post.Title); len(title) > 255 {
+		post.Title = string(title[:255])
+	}
+
+	if err := s.postRepo.Create(ctx, post); err != nil {
+		return nil, err
+	}
+
+	return s.postRepo.GetByID(ctx, post.ID)
+}
+
+// Delete moves the post to the trash, from where Restore brings it back.
+func (s *PostService) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.postRepo.Delete(ctx, id)
+}
+
+// Restore brings a deleted post back with its slug, categories and tags,
+// and returns it.
+func (s *PostService) Restore(ctx context.Context, id uuid.UUID) (*models.Post, error) {
+	if err := s.postRepo.Restore(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.postRepo.GetByID(ctx, id)
+}
+
+// ListDeleted returns a page of the deleted posts, most recently deleted
+// first.
+func (s *PostService) ListDeleted(ctx context.Context, limit, offset int) ([]*models.Post, int, error) {
+	return s.postRepo.ListDeleted(ctx, limit, offset)
+}
+
+// Autosave stores the user's unsaved edits of a post, replacing their
+// previous autosave.
+func (s *PostService) Autosave(ctx context.Context, id, userID uuid.UUID, role string, req *models.AutosavePostRequest) (*models.PostAutosave, error) {
+	if _, err := s.getEditablePost(ctx, id, userID, role); err != nil {
+		return nil, err
+	}
+
+	autosave := &models.PostAutosave{
+		PostID:  id,
+		UserID:  userID,
+		Title:   req.Title,
+		Content: req.Content,
+	}
+	if err := s.autosaveRepo.Upsert(ctx, autosave); err != nil {
+		return nil, err
+	}
+
+	return autosave, nil
+}
+
+// GetAutosave returns the user's autosave of the post, or nil if there is
+// none newer than the post's last save.
+func (s *PostService) GetAutosave(ctx context.Context, id, userID uuid.UUID, role string) (*models.PostAutosave, error) {
+	post, err := s.getEditablePost(ctx, id, userID, role)
+	if err != nil {
+		return nil, err
+	}
+
+	autosave, err := s.autosaveRepo.Get(ctx, id, userID)
+	if err != nil {
+		return nil, err
+	}
+	if autosave == nil || !autosave.SavedAt.After(post.UpdatedAt) {
+		return nil, nil
+	}
+
+	return autosave, nil
+}
+
+// PruneAutosaves deletes the autosaves not written to for a week.
+func (s *PostService) PruneAutosaves(ctx context.Context) error {
+	_, err := s.autosaveRepo.DeleteSavedBefore(ctx, s.now().Add(-postAutosaveRetention))
+	return err
+}
+
+func (s *PostService) getEditablePost(ctx context.Context, id, userID uuid.UUID, role string) (*models.Post, error) {
+	post, err := s.postRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if post == nil {
+		return nil, ErrPostNotFound
+	}
+	if !canEditPost(post, userID, role) {
+		return nil, ErrPostForbidden
+	}
+	return post, nil
+}
+
+// canEditPost reports whether the user is an admin or the post's author.
+func canEditPost(post *models.Post, userID uuid.UUID, role string) bool {
+	return role == "admin" || (post.Author != nil && post.Author.UserID == userID)
+}
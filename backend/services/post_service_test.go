@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// A duplicate is a new draft with its own slug, the source's categories and
+// tags, and a reference back to the source.
+func TestDuplicatePost(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	postRepo := repositories.NewPostRepository(pool, nil, repositories.NewRedirectRepository(pool))
+	service := NewPostService(postRepo, nil, nil, nil, nil, nil, nil)
+
+	user := createTestUser(t, pool)
+	authorID, err := postRepo.AuthorIDForUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.posts WHERE author_id = $1"), authorID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.authors WHERE id = $1"), authorID)
+	})
+
+	name := dbtest.UniqueName("template")
+	category := &models.Category{}
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.categories (name, slug) VALUES ($1, $1) RETURNING id
+	`), name).Scan(&category.ID); err != nil {
+		t.Fatal(err)
+	}
+	tag := &models.Tag{}
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		INSERT INTO {blog}.tags (name, slug) VALUES ($1, $1) RETURNING id
+	`), name).Scan(&tag.ID); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.categories WHERE id = $1"), category.ID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.tags WHERE id = $1"), tag.ID)
+	})
+
+	publishedAt := time.Now()
+	source := &models.Post{
+		Title:       "Weekly menu",
+		Slug:        name,
+		Content:     "Monday: soup",
+		AuthorID:    authorID,
+		Status:      "published",
+		PublishedAt: &publishedAt,
+		Categories:  []*models.Category{category},
+		Tags:        []*models.Tag{tag},
+	}
+	if err := postRepo.Create(ctx, source); err != nil {
+		t.Fatal(err)
+	}
+
+	copied, err := service.DuplicatePost(ctx, source.ID, user.ID, user.Role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.ID == source.ID || copied.Slug == source.Slug {
+		t.Errorf("duplicate has ID %s and slug %q, want new ones", copied.ID, copied.Slug)
+	}
+	if copied.Title != "Copy of Weekly menu" || copied.Status != "draft" || copied.PublishedAt != nil {
+		t.Errorf("duplicate = %q %s published %v, want an unpublished draft titled Copy of Weekly menu",
+			copied.Title, copied.Status, copied.PublishedAt)
+	}
+	if copied.ClonedFrom == nil || *copied.ClonedFrom != source.ID {
+		t.Errorf("cloned_from = %v, want %s", copied.ClonedFrom, source.ID)
+	}
+	if len(copied.Categories) != 1 || copied.Categories[0].ID != category.ID {
+		t.Errorf("categories = %v, want the source's", copied.Categories)
+	}
+	if len(copied.Tags) != 1 || copied.Tags[0].ID != tag.ID {
+		t.Errorf("tags = %v, want the source's", copied.Tags)
+	}
+
+	if _, err := service.DuplicatePost(ctx, source.ID, uuid.New(), "contributor"); !errors.Is(err, ErrPostForbidden) {
+		t.Errorf("another contributor duplicating: err = %v, want ErrPostForbidden", err)
+	}
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/util"
+	"github.com/google/uuid"
+)
+
+// wordsPerMinute is the reading speed used for reading time estimates.
+const wordsPerMinute = 200
+
+var (
+	htmlTagPattern        = regexp.MustCompile(`<[^>]*>`)
+	paragraphBreakPattern = regexp.MustCompile(`\n\s*\n`)
+	sentenceEndPattern    = regexp.MustCompile(`[.!?]+(\s|$)`)
+)
+
+// ComputePostStats derives readability statistics from the post's content.
+// HTML tags are ignored.
+func ComputePostStats(post *models.Post) *models.PostStats {
+	text := strings.TrimSpace(htmlTagPattern.ReplaceAllString(post.Content, " "))
+
+	stats := &models.PostStats{
+		PostID:         post.ID,
+		CharCount:      utf8.RuneCountInString(text),
+		UniqueTagCount: countUniqueTags(post.Tags),
+	}
+
+	for _, paragraph := range paragraphBreakPattern.Split(text, -1) {
+		if strings.TrimSpace(paragraph) != "" {
+			stats.ParagraphCount++
+		}
+	}
+
+	syllables := 0
+	for _, field := range strings.Fields(text) {
+		if !strings.ContainsFunc(field, unicode.IsLetter) && !strings.ContainsFunc(field, unicode.IsDigit) {
+			continue
+		}
+		stats.WordCount++
+		syllables += util.CountSyllables(field)
+	}
+
+	if stats.WordCount == 0 {
+		return stats
+	}
+
+	stats.SentenceCount = len(sentenceEndPattern.FindAllString(text, -1))
+	// Trailing text without final punctuation still forms a sentence
+	if stats.SentenceCount == 0 || !strings.ContainsAny(text[len(text)-1:], ".!?") {
+		stats.SentenceCount++
+	}
+
+	stats.ReadingTimeMinutes = int(math.Ceil(float64(stats.WordCount) / wordsPerMinute))
+
+	wordsPerSentence := float64(stats.WordCount) / float64(stats.SentenceCount)
+	syllablesPerWord := float64(syllables) / float64(stats.WordCount)
+	stats.FleschReadingEase = math.Round((206.835-1.015*wordsPerSentence-84.6*syllablesPerWord)*100) / 100
+
+	return stats
+}
+
+func countUniqueTags(tags []*models.Tag) int {
+	seen := make(map[uuid.UUID]bool, len(tags))
+	for _, tag := range tags {
+		seen[tag.ID] = true
+	}
+	return len(seen)
+}
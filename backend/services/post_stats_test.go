@@ -0,0 +1,46 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+func TestComputePostStats(t *testing.T) {
+	news := uuid.New()
+	post := &models.Post{
+		ID:      uuid.New(),
+		Content: "<p>The cat sat on the mat. It was happy!</p>\n\n<p>Dogs barked loudly</p>",
+		Tags:    []*models.Tag{{ID: news}, {ID: uuid.New()}, {ID: news}},
+	}
+
+	got := ComputePostStats(post)
+
+	// 12 words of 14 syllables in 3 sentences, the last one unpunctuated:
+	// 206.835 - 1.015*(12/3) - 84.6*(14/12)
+	want := models.PostStats{
+		PostID:             post.ID,
+		WordCount:          12,
+		CharCount:          59,
+		SentenceCount:      3,
+		ParagraphCount:     2,
+		ReadingTimeMinutes: 1,
+		UniqueTagCount:     2,
+		FleschReadingEase:  104.08,
+	}
+	flesch := got.FleschReadingEase
+	got.FleschReadingEase = want.FleschReadingEase
+	if *got != want {
+		t.Errorf("ComputePostStats = %+v, want %+v", *got, want)
+	}
+	if math.Abs(flesch-want.FleschReadingEase) > 0.01 {
+		t.Errorf("FleschReadingEase = %v, want %v", flesch, want.FleschReadingEase)
+	}
+
+	empty := ComputePostStats(&models.Post{Content: "<p> </p>"})
+	if empty.WordCount != 0 || empty.SentenceCount != 0 || empty.FleschReadingEase != 0 {
+		t.Errorf("stats of an empty post = %+v, want zeros", *empty)
+	}
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"context"
+
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+var ErrProductCategoryNotFound = repositories.ErrProductCategoryNotFound
+
+type ProductCategoryService struct {
+	categoryRepo *repositories.ProductCategoryRepository
+}
+
+func NewProductCategoryService(categoryRepo *repositories.ProductCategoryRepository) *ProductCategoryService {
+	return &ProductCategoryService{categoryRepo: categoryRepo}
+}
+
+// GetTree returns the product categories as a tree of root categories.
+func (s *ProductCategoryService) GetTree(ctx context.Context) ([]*models.ProductCategory, error) {
+	return s.categoryRepo.GetTree(ctx)
+}
+
+// GetBySlug returns the category with its ancestors, root first.
+func (s *ProductCategoryService) GetBySlug(ctx context.Context, slug string) (*models.ProductCategory, error) {
+	category, err := s.categoryRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if category == nil {
+		return nil, ErrProductCategoryNotFound
+	}
+	return category, nil
+}
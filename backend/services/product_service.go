@@ -0,0 +1,628 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/util"
+)
+
+var (
+	ErrProductNotFound             = repositories.ErrProductNotFound
+	ErrProductInUse                = repositories.ErrProductInUse
+	ErrOutOfStock                  = repositories.ErrOutOfStock
+	ErrAttributeDefinitionNotFound = errors.New("attribute definition not found")
+	ErrInvalidAttributeValue       = errors.New("invalid attribute value")
+	ErrProductImageNotFound        = errors.New("product image not found")
+	ErrProductVariantNotFound      = repositories.ErrProductVariantNotFound
+	ErrProductNotPublishable       = errors.New("product is not ready to be published")
+	ErrSKUTaken                    = errors.New("SKU is already in use")
+)
+
+type ProductService struct {
+	productRepo   *repositories.ProductRepository
+	revisionRepo  *repositories.ProductRevisionRepository
+	attributeRepo *repositories.AttributeDefinitionRepository
+	imageRepo     *repositories.ProductImageRepository
+	variantRepo   *repositories.ProductVariantRepository
+	tax           *TaxService
+	flashSales    *FlashSaleService
+	audit         *ProductAuditService
+	media         *MediaService
+}
+
+func NewProductService(
+	productRepo *repositories.ProductRepository,
+	revisionRepo *repositories.ProductRevisionRepository,
+	attributeRepo *repositories.AttributeDefinitionRepository,
+	imageRepo *repositories.ProductImageRepository,
+	variantRepo *repositories.ProductVariantRepository,
+	tax *TaxService,
+	flashSales *FlashSaleService,
+	audit *ProductAuditService,
+	media *MediaService,
+) *ProductService {
+	return &ProductService{
+		productRepo:   productRepo,
+		revisionRepo:  revisionRepo,
+		attributeRepo: attributeRepo,
+		imageRepo:     imageRepo,
+		variantRepo:   variantRepo,
+		tax:           tax,
+		flashSales:    flashSales,
+		audit:         audit,
+		media:         media,
+	}
+}
+
+// GetBySlug returns the product with its prices including and excluding tax
+// filled in, and its flash sale price while it is in an active sale.
+func (s *ProductService) GetBySlug(ctx context.Context, slug string) (*models.Product, error) {
+	product, err := s.productRepo.GetBySlug(ctx, slug)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+
+	s.tax.ApplyDisplayPrices(product)
+
+	sale, err := s.flashSales.GetActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.flashSales.ApplyToProduct(product, sale)
+
+	return product, nil
+}
+
+// Search returns a page of published products with facet counts for
+// filtered navigation. Products get the same display prices as GetBySlug.
+func (s *ProductService) Search(ctx context.Context, query string, filter models.ProductFilter, limit, offset int) (*models.FacetedSearchResult, error) {
+	result, err := s.productRepo.SearchWithFacets(ctx, query, filter, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	sale, err := s.flashSales.GetActive(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, product := range result.Products {
+		s.tax.ApplyDisplayPrices(product)
+		s.flashSales.ApplyToProduct(product, sale)
+	}
+
+	return result, nil
+}
+
+func (s *ProductService) Create(ctx context.Context, req *models.ProductRequest) (*models.Product, error) {
+	product := &models.Product{Status: "published"}
+	applyProductRequest(product, req)
+
+	if err := s.normalizeAttributes(ctx, product.Attributes); err != nil {
+		return nil, err
+	}
+
+	if err := s.productRepo.Create(ctx, product); err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// List returns the page of products matching the filter, drafts included,
+// after the product with ID after, or the first page when after is nil.
+func (s *ProductService) List(ctx context.Context, filter models.ProductFilter, after *uuid.UUID, limit int) (*models.PaginatedResult[*models.Product], error) {
+	return s.productRepo.List(ctx, filter, after, limit)
+}
+
+// Delete moves the product to the trash, from where Restore brings it back.
+// Orders of it keep referring to it.
+func (s *ProductService) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.productRepo.Delete(ctx, id)
+}
+
+// Restore brings a deleted product back and returns it.
+func (s *ProductService) Restore(ctx context.Context, id uuid.UUID) (*models.Product, error) {
+	if err := s.productRepo.Restore(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.getProduct(ctx, id)
+}
+
+// ListDeleted returns a page of the deleted products, most recently deleted
+// first.
+func (s *ProductService) ListDeleted(ctx context.Context, limit, offset int) ([]*models.Product, int, error) {
+	return s.productRepo.ListDeleted(ctx, limit, offset)
+}
+
+// Update replaces the product's content. The previous content is kept as a
+// revision credited to editorID, and the changed fields are audited. It
+// fails with repositories.ErrConflict when req.Version is stale.
+func (s *ProductService) Update(ctx context.Context, id, editorID uuid.UUID, req *models.ProductRequest) (*models.Product, error) {
+	product, err := s.productRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+	before := *product
+
+	applyProductRequest(product, req)
+	product.Version = req.Version
+
+	if err := s.normalizeAttributes(ctx, product.Attributes); err != nil {
+		return nil, err
+	}
+
+	if err := s.productRepo.Update(ctx, product, editorID); err != nil {
+		return nil, err
+	}
+
+	// The update is already saved, so a failed audit entry is only logged
+	if err := s.audit.LogUpdate(ctx, editorID, &before, product); err != nil {
+		log.Printf("Failed to audit update of product %s: %v\n", id, err)
+	}
+
+	return product, nil
+}
+
+// BulkMove moves the requested products from the source category to the
+// target category on behalf of actorID, and returns how many it moved.
+// Products that do not exist or are not in the source category are left
+// alone.
+func (s *ProductService) BulkMove(ctx context.Context, actorID, sourceID uuid.UUID, req *models.BulkMoveProductsRequest) (int, error) {
+	moved, err := s.productRepo.MoveToCategory(ctx, sourceID, req.TargetCategoryID, req.ProductIDs, actorID)
+	if err != nil {
+		return 0, err
+	}
+	return len(moved), nil
+}
+
+// ListRevisions returns a page of the product's revisions, newest first.
+func (s *ProductService) ListRevisions(ctx context.Context, productID uuid.UUID, limit, offset int) ([]*models.ProductRevision, int, error) {
+	return s.revisionRepo.ListByProduct(ctx, productID, limit, offset)
+}
+
+// RestoreRevision puts the revision's content back on the product and
+// returns the product. The content it replaces becomes a new revision, so
+// restoring can be undone.
+func (s *ProductService) RestoreRevision(ctx context.Context, productID, revisionID, userID uuid.UUID) (*models.Product, error) {
+	if err := s.revisionRepo.Restore(ctx, productID, revisionID, userID); err != nil {
+		return nil, err
+	}
+
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+
+	return product, nil
+}
+
+// CreateDraft creates an unpublished product from its basic info. A missing
+// SKU is generated, and so is a missing slug, from the name.
+func (s *ProductService) CreateDraft(ctx context.Context, req *models.CreateProductRequest) (*models.Product, error) {
+	suffix := strings.ToLower(uuid.New().String()[:8])
+
+	product := &models.Product{
+		Name:                 strings.TrimSpace(req.Name),
+		Slug:                 strings.TrimSpace(req.Slug),
+		Description:          req.Description,
+		SKU:                  strings.TrimSpace(req.SKU),
+		Type:                 req.Type,
+		VendorID:             req.VendorID,
+		Status:               "draft",
+		Attributes:           []*models.ProductAttribute{},
+		ShippingRestrictions: []string{},
+	}
+	if product.Slug == "" {
+		base := util.Slugify(product.Name)
+		if base == "" {
+			base = "product"
+		}
+		product.Slug = base + "-" + suffix
+	}
+	if product.SKU == "" {
+		product.SKU = "SKU-" + strings.ToUpper(suffix)
+	}
+	if product.Type == "" {
+		product.Type = "physical"
+	}
+	if req.CategoryID != nil {
+		product.CategoryID = *req.CategoryID
+	}
+
+	taken, err := s.productRepo.SKUExists(ctx, product.SKU, uuid.Nil)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, ErrSKUTaken
+	}
+
+	if err := s.productRepo.Create(ctx, product); err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+func (s *ProductService) UpdatePricing(ctx context.Context, id uuid.UUID, req *models.UpdateProductPricingRequest) (*models.Product, error) {
+	product, err := s.getProduct(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	product.Price = req.Price
+	product.SalePrice = req.SalePrice
+	product.PriceIncludesTax = req.PriceIncludesTax
+	product.TaxRate = req.TaxRate
+
+	if err := s.productRepo.UpdatePricing(ctx, product); err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+func (s *ProductService) UpdateStock(ctx context.Context, id uuid.UUID, req *models.UpdateProductStockRequest) (*models.Product, error) {
+	product, err := s.getProduct(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	product.Stock = req.Stock
+
+	if err := s.productRepo.UpdateStock(ctx, product); err != nil {
+		return nil, err
+	}
+
+	return product, nil
+}
+
+// Publish makes the product visible in the shop. It fails with
+// ErrProductNotPublishable, alongside the violations, when the product is
+// incomplete.
+func (s *ProductService) Publish(ctx context.Context, id uuid.UUID) (*models.Product, []models.ValidationError, error) {
+	product, err := s.getProduct(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	violations, err := s.validateForPublish(ctx, product)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(violations) > 0 {
+		return nil, violations, ErrProductNotPublishable
+	}
+
+	product.Status = "published"
+	if err := s.productRepo.UpdateStatus(ctx, product); err != nil {
+		return nil, nil, err
+	}
+
+	return product, nil, nil
+}
+
+// ValidateForPublish lists everything that keeps the product from being
+// published. An empty list means it is ready.
+func (s *ProductService) ValidateForPublish(ctx context.Context, productID uuid.UUID) ([]models.ValidationError, error) {
+	product, err := s.getProduct(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.validateForPublish(ctx, product)
+}
+
+func (s *ProductService) validateForPublish(ctx context.Context, product *models.Product) ([]models.ValidationError, error) {
+	violations := ValidateProductFields(product)
+
+	if product.SKU != "" {
+		taken, err := s.productRepo.SKUExists(ctx, product.SKU, product.ID)
+		if err != nil {
+			return nil, err
+		}
+		if taken {
+			violations = append(violations, models.ValidationError{Field: "sku", Message: "SKU is used by another product"})
+		}
+	}
+
+	return violations, nil
+}
+
+// ValidateProductFields checks the publish requirements that need nothing
+// but the product itself: a name, a positive price, a SKU and at least one
+// image.
+func ValidateProductFields(product *models.Product) []models.ValidationError {
+	violations := []models.ValidationError{}
+
+	if strings.TrimSpace(product.Name) == "" {
+		violations = append(violations, models.ValidationError{Field: "name", Message: "Name is required"})
+	}
+	if product.Price <= 0 {
+		violations = append(violations, models.ValidationError{Field: "price", Message: "Price must be greater than zero"})
+	}
+	if strings.TrimSpace(product.SKU) == "" {
+		violations = append(violations, models.ValidationError{Field: "sku", Message: "SKU is required"})
+	}
+	if len(product.Images) == 0 {
+		violations = append(violations, models.ValidationError{Field: "images", Message: "At least one image is required"})
+	}
+
+	return violations
+}
+
+func applyProductRequest(product *models.Product, req *models.ProductRequest) {
+	product.Name = req.Name
+	product.Slug = req.Slug
+	product.Description = req.Description
+	product.Price = req.Price
+	product.SalePrice = req.SalePrice
+	product.SKU = req.SKU
+	product.Stock = req.Stock
+	product.IsFeatured = req.IsFeatured
+	// Event products keep their type; their event details are managed separately
+	if product.Type != "event" {
+		product.Type = req.Type
+		if product.Type == "" {
+			product.Type = "physical"
+		}
+	}
+	product.PriceIncludesTax = req.PriceIncludesTax
+	product.TaxRate = req.TaxRate
+	product.CategoryID = uuid.Nil
+	if req.CategoryID != nil {
+		product.CategoryID = *req.CategoryID
+	}
+	product.VendorID = req.VendorID
+	product.ShippingRestrictions = make([]string, 0, len(req.ShippingRestrictions))
+	product.ShippingRestrictions = append(product.ShippingRestrictions, req.ShippingRestrictions...)
+
+	product.Attributes = make([]*models.ProductAttribute, 0, len(req.Attributes))
+	for _, attr := range req.Attributes {
+		product.Attributes = append(product.Attributes, &models.ProductAttribute{
+			Name:  strings.TrimSpace(attr.Name),
+			Value: strings.TrimSpace(attr.Value),
+		})
+	}
+}
+
+// normalizeAttributes checks attribute values against their definitions,
+// lowercasing values of case-insensitive attributes. Attributes without a
+// definition are let through with a warning so new ones can be introduced
+// before the vocabulary catches up.
+func (s *ProductService) normalizeAttributes(ctx context.Context, attrs []*models.ProductAttribute) error {
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(attrs))
+	for _, attr := range attrs {
+		names = append(names, attr.Name)
+	}
+
+	defs, err := s.attributeRepo.GetByNames(ctx, names)
+	if err != nil {
+		return err
+	}
+
+	for _, attr := range attrs {
+		def, ok := defs[strings.ToLower(attr.Name)]
+		if !ok {
+			log.Printf("Product attribute %q has no definition; storing value %q as is\n", attr.Name, attr.Value)
+			continue
+		}
+
+		value, err := NormalizeAttributeValue(def, attr.Value)
+		if err != nil {
+			return err
+		}
+		attr.Name = def.Name
+		attr.Value = value
+	}
+
+	return nil
+}
+
+// NormalizeAttributeValue returns the value as it should be stored for the
+// definition, or ErrInvalidAttributeValue when it is not in the allowed list.
+func NormalizeAttributeValue(def *models.AttributeDefinition, value string) (string, error) {
+	if !def.IsCaseSensitive {
+		value = strings.ToLower(value)
+	}
+
+	if len(def.AllowedValues) == 0 {
+		return value, nil
+	}
+
+	for _, allowed := range def.AllowedValues {
+		if !def.IsCaseSensitive {
+			allowed = strings.ToLower(allowed)
+		}
+		if value == allowed {
+			return value, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: %q is not allowed for %s", ErrInvalidAttributeValue, value, def.Name)
+}
+
+// AddImage appends an image to the product's gallery, either by URL or an
+// uploaded image.
+func (s *ProductService) AddImage(ctx context.Context, productID uuid.UUID, req *models.AddProductImageRequest) (*models.ProductImage, error) {
+	if err := s.ensureProduct(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	url := req.URL
+	if req.MediaID != nil {
+		var err error
+		if url, err = s.media.ImageURL(ctx, *req.MediaID); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.imageRepo.AddImage(ctx, productID, url, req.AltText)
+}
+
+func (s *ProductService) RemoveImage(ctx context.Context, productID, imageID uuid.UUID) error {
+	image, err := s.imageRepo.GetByID(ctx, imageID)
+	if err != nil {
+		return err
+	}
+	if image == nil || image.ProductID != productID {
+		return ErrProductImageNotFound
+	}
+
+	return s.imageRepo.RemoveImage(ctx, imageID)
+}
+
+// ReorderImages sets the gallery order and returns the reordered images.
+func (s *ProductService) ReorderImages(ctx context.Context, productID uuid.UUID, orderedIDs []uuid.UUID) ([]*models.ProductImage, error) {
+	if err := s.ensureProduct(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	if err := s.imageRepo.Reorder(ctx, productID, orderedIDs); err != nil {
+		return nil, err
+	}
+
+	return s.imageRepo.ListByProduct(ctx, productID)
+}
+
+// CreateVariant adds a variant to the product.
+func (s *ProductService) CreateVariant(ctx context.Context, productID uuid.UUID, req *models.ProductVariantRequest) (*models.ProductVariant, error) {
+	if err := s.ensureProduct(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	variant := &models.ProductVariant{ProductID: productID}
+	applyProductVariantRequest(variant, req)
+
+	if err := s.variantRepo.Create(ctx, variant); err != nil {
+		return nil, variantError(err)
+	}
+	return variant, nil
+}
+
+// UpdateVariant replaces one of the product's variants.
+func (s *ProductService) UpdateVariant(ctx context.Context, productID, variantID uuid.UUID, req *models.ProductVariantRequest) (*models.ProductVariant, error) {
+	variant := &models.ProductVariant{ID: variantID, ProductID: productID}
+	applyProductVariantRequest(variant, req)
+
+	if err := s.variantRepo.Update(ctx, variant); err != nil {
+		return nil, variantError(err)
+	}
+	return variant, nil
+}
+
+// DeleteVariant deletes one of the product's variants that has never been
+// ordered.
+func (s *ProductService) DeleteVariant(ctx context.Context, productID, variantID uuid.UUID) error {
+	return s.variantRepo.Delete(ctx, productID, variantID)
+}
+
+func applyProductVariantRequest(variant *models.ProductVariant, req *models.ProductVariantRequest) {
+	variant.SKU = strings.TrimSpace(req.SKU)
+	variant.Attributes = req.Attributes
+	variant.Stock = req.Stock
+	variant.Price = req.Price
+}
+
+// variantError reports a taken variant SKU like a taken product SKU.
+func variantError(err error) error {
+	if errors.Is(err, repositories.ErrVariantSKUTaken) {
+		return ErrSKUTaken
+	}
+	return err
+}
+
+func (s *ProductService) ensureProduct(ctx context.Context, productID uuid.UUID) error {
+	_, err := s.getProduct(ctx, productID)
+	return err
+}
+
+func (s *ProductService) getProduct(ctx context.Context, productID uuid.UUID) (*models.Product, error) {
+	product, err := s.productRepo.GetByID(ctx, productID)
+	if err != nil {
+		return nil, err
+	}
+	if product == nil {
+		return nil, ErrProductNotFound
+	}
+	return product, nil
+}
+
+func (s *ProductService) ListAttributeDefinitions(ctx context.Context) ([]*models.AttributeDefinition, error) {
+	return s.attributeRepo.List(ctx)
+}
+
+func (s *ProductService) CreateAttributeDefinition(ctx context.Context, req *models.AttributeDefinitionRequest) (*models.AttributeDefinition, error) {
+	def := &models.AttributeDefinition{}
+	applyAttributeDefinitionRequest(def, req)
+
+	if err := s.attributeRepo.Create(ctx, def); err != nil {
+		return nil, err
+	}
+
+	return def, nil
+}
+
+func (s *ProductService) UpdateAttributeDefinition(ctx context.Context, id uuid.UUID, req *models.AttributeDefinitionRequest) (*models.AttributeDefinition, error) {
+	def, err := s.attributeRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if def == nil {
+		return nil, ErrAttributeDefinitionNotFound
+	}
+
+	applyAttributeDefinitionRequest(def, req)
+
+	if err := s.attributeRepo.Update(ctx, def); err != nil {
+		return nil, err
+	}
+
+	return def, nil
+}
+
+func (s *ProductService) DeleteAttributeDefinition(ctx context.Context, id uuid.UUID) error {
+	def, err := s.attributeRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if def == nil {
+		return ErrAttributeDefinitionNotFound
+	}
+
+	return s.attributeRepo.Delete(ctx, id)
+}
+
+func applyAttributeDefinitionRequest(def *models.AttributeDefinition, req *models.AttributeDefinitionRequest) {
+	def.Name = strings.TrimSpace(req.Name)
+	def.IsCaseSensitive = req.IsCaseSensitive
+
+	def.AllowedValues = make([]string, 0, len(req.AllowedValues))
+	for _, value := range req.AllowedValues {
+		value = strings.TrimSpace(value)
+		if !def.IsCaseSensitive {
+			value = strings.ToLower(value)
+		}
+		def.AllowedValues = append(def.AllowedValues, value)
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+func TestNormalizeAttributeValue(t *testing.T) {
+	colour := &models.AttributeDefinition{Name: "colour", AllowedValues: []string{"Red", "Blue"}}
+	size := &models.AttributeDefinition{Name: "size", AllowedValues: []string{"S", "M", "L"}, IsCaseSensitive: true}
+	material := &models.AttributeDefinition{Name: "material"}
+
+	tests := []struct {
+		name    string
+		def     *models.AttributeDefinition
+		value   string
+		want    string
+		invalid bool
+	}{
+		{"case-insensitive value is lowercased", colour, "RED", "red", false},
+		{"allowed value in another case", colour, "blue", "blue", false},
+		{"value outside the allowed list", colour, "green", "", true},
+		{"case-sensitive exact match", size, "M", "M", false},
+		{"case-sensitive wrong case", size, "m", "", true},
+		{"open vocabulary", material, "Cotton", "cotton", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeAttributeValue(tt.def, tt.value)
+			if tt.invalid {
+				if !errors.Is(err, ErrInvalidAttributeValue) {
+					t.Errorf("NormalizeAttributeValue(%q) = %q, %v; want ErrInvalidAttributeValue", tt.value, got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("NormalizeAttributeValue(%q) = %q, %v; want %q", tt.value, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateProductFields(t *testing.T) {
+	image := []*models.ProductImage{{URL: "https://cdn.example.com/mug.jpg"}}
+	tests := []struct {
+		name    string
+		product models.Product
+		want    []string
+	}{
+		{"complete", models.Product{Name: "Mug", Price: 12, SKU: "MUG-1", Images: image}, nil},
+		{"blank name", models.Product{Name: "  ", Price: 12, SKU: "MUG-1", Images: image}, []string{"name"}},
+		{"zero price", models.Product{Name: "Mug", SKU: "MUG-1", Images: image}, []string{"price"}},
+		{"no sku", models.Product{Name: "Mug", Price: 12, Images: image}, []string{"sku"}},
+		{"no images", models.Product{Name: "Mug", Price: 12, SKU: "MUG-1"}, []string{"images"}},
+		{"empty", models.Product{}, []string{"name", "price", "sku", "images"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ValidateProductFields(&tt.product)
+			fields := []string{}
+			for _, violation := range got {
+				fields = append(fields, violation.Field)
+			}
+			if len(fields) != len(tt.want) {
+				t.Fatalf("violations = %v, want %v", fields, tt.want)
+			}
+			for i := range fields {
+				if fields[i] != tt.want[i] {
+					t.Errorf("violations = %v, want %v", fields, tt.want)
+				}
+			}
+		})
+	}
+}
+
+// A draft is filled in one section at a time and only publishes once
+// complete.
+func TestProductDraftToPublish(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	productRepo := repositories.NewProductRepository(pool, nil, repositories.NewRedirectRepository(pool))
+	imageRepo := repositories.NewProductImageRepository(pool, nil)
+	service := NewProductService(productRepo, nil, nil, imageRepo, nil, nil, nil, nil, nil)
+
+	draft, err := service.CreateDraft(ctx, &models.CreateProductRequest{Name: "Stoneware mug", Description: "Glazed"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {shop}.products WHERE id = $1"), draft.ID)
+	})
+	if draft.Status != "draft" || draft.SKU == "" || draft.Slug == "" {
+		t.Fatalf("draft = %s with SKU %q and slug %q, want a draft with both generated", draft.Status, draft.SKU, draft.Slug)
+	}
+
+	if _, err := service.CreateDraft(ctx, &models.CreateProductRequest{Name: "Copy", SKU: draft.SKU}); !errors.Is(err, ErrSKUTaken) {
+		t.Errorf("draft with a taken SKU: err = %v, want ErrSKUTaken", err)
+	}
+
+	_, violations, err := service.Publish(ctx, draft.ID)
+	if !errors.Is(err, ErrProductNotPublishable) || len(violations) != 2 {
+		t.Fatalf("publishing the bare draft = %v, %v; want the price and images violations", violations, err)
+	}
+
+	if _, err := service.UpdatePricing(ctx, draft.ID, &models.UpdateProductPricingRequest{Price: 14.5}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.UpdateStock(ctx, draft.ID, &models.UpdateProductStockRequest{Stock: 30}); err != nil {
+		t.Fatal(err)
+	}
+	violations, err = service.ValidateForPublish(ctx, draft.ID)
+	if err != nil || len(violations) != 1 || violations[0].Field != "images" {
+		t.Fatalf("ValidateForPublish with pricing and stock = %v, %v; want only the images violation", violations, err)
+	}
+
+	if _, err := imageRepo.AddImage(ctx, draft.ID, "https://cdn.example.com/mug.jpg", "Mug"); err != nil {
+		t.Fatal(err)
+	}
+	published, violations, err := service.Publish(ctx, draft.ID)
+	if err != nil {
+		t.Fatalf("publishing the complete product: %v %v", violations, err)
+	}
+	if published.Status != "published" || published.Price != 14.5 || published.Stock != 30 {
+		t.Errorf("published = %s at %v with %d in stock, want published at 14.5 with 30", published.Status, published.Price, published.Stock)
+	}
+}
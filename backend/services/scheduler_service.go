@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// PostPublishedNotifier tells an author that their post went live.
+type PostPublishedNotifier interface {
+	SendPostPublished(ctx context.Context, author *models.Author, post *models.Post) error
+}
+
+// SchedulerService publishes scheduled posts once their time has come.
+type SchedulerService struct {
+	postRepo *repositories.PostRepository
+	notifier PostPublishedNotifier
+	webhooks *WebhookDispatcher
+	now      func() time.Time
+}
+
+func NewSchedulerService(postRepo *repositories.PostRepository, notifier PostPublishedNotifier, webhooks *WebhookDispatcher) *SchedulerService {
+	return &SchedulerService{
+		postRepo: postRepo,
+		notifier: notifier,
+		webhooks: webhooks,
+		now:      time.Now,
+	}
+}
+
+// PublishDuePosts publishes every scheduled post that is due. A post that
+// fails does not hold up the others; the failures are returned together and
+// those posts are tried again on the next run.
+func (s *SchedulerService) PublishDuePosts(ctx context.Context) error {
+	posts, err := s.postRepo.ListDueForPublish(ctx)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	published := 0
+	for _, post := range posts {
+		ok, err := s.publishPost(ctx, post)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("post %s: %w", post.ID, err))
+			continue
+		}
+		if ok {
+			published++
+		}
+	}
+	if published > 0 {
+		log.Printf("Published %d scheduled posts\n", published)
+	}
+
+	return errors.Join(errs...)
+}
+
+// publishPost publishes the post, emails its author and notifies webhook
+// endpoints, and reports whether it published it. Only the publish itself
+// can fail: a failed email or webhook is logged, since retrying would
+// publish the post a second time.
+func (s *SchedulerService) publishPost(ctx context.Context, post *models.Post) (bool, error) {
+	published, err := s.postRepo.PublishScheduled(ctx, post.ID)
+	if err != nil {
+		return false, err
+	}
+	if !published {
+		// Unscheduled or published by someone else in the meantime
+		return false, nil
+	}
+
+	post.Status = "published"
+	now := s.now()
+	post.PublishedAt = &now
+	if err := s.notifier.SendPostPublished(ctx, post.Author, post); err != nil {
+		log.Printf("Failed to notify author of published post %s: %v\n", post.ID, err)
+	}
+
+	// The due list leaves out the content, so endpoints get the post as
+	// stored now
+	stored, err := s.postRepo.GetByID(ctx, post.ID)
+	if err != nil {
+		log.Printf("Failed to load published post %s for webhooks: %v\n", post.ID, err)
+	} else if stored != nil {
+		dispatchPostPublished(ctx, s.webhooks, stored)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,88 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// recordingNotifier counts the published-post emails per post and keeps
+// the address each was sent to.
+type recordingNotifier struct {
+	mu   sync.Mutex
+	sent map[uuid.UUID]int
+	to   map[uuid.UUID]string
+	err  error
+}
+
+func (n *recordingNotifier) SendPostPublished(ctx context.Context, author *models.Author, post *models.Post) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.sent[post.ID]++
+	if author != nil && author.User != nil {
+		n.to[post.ID] = author.User.Email
+	}
+	return n.err
+}
+
+// Each due post is published once and its author emailed once, even when
+// the email fails and the scheduler runs again.
+func TestPublishDuePostsNotifiesAuthorOnce(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	postRepo := repositories.NewPostRepository(pool, nil, repositories.NewRedirectRepository(pool))
+
+	user := createTestUser(t, pool)
+	authorID, err := postRepo.AuthorIDForUser(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.posts WHERE author_id = $1"), authorID)
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.authors WHERE id = $1"), authorID)
+	})
+
+	due := time.Now().Add(-time.Minute)
+	post := &models.Post{
+		Title:       "Scheduled",
+		Slug:        dbtest.UniqueName("scheduled"),
+		Content:     "Content",
+		AuthorID:    authorID,
+		Status:      "scheduled",
+		ScheduledAt: &due,
+	}
+	if err := postRepo.Create(ctx, post); err != nil {
+		t.Fatal(err)
+	}
+
+	notifier := &recordingNotifier{sent: map[uuid.UUID]int{}, to: map[uuid.UUID]string{}, err: errors.New("smtp down")}
+	scheduler := NewSchedulerService(postRepo, notifier, NewWebhookDispatcher(nil, nil, nil, nil))
+
+	for run := 1; run <= 2; run++ {
+		if err := scheduler.PublishDuePosts(ctx); err != nil {
+			t.Fatalf("run %d: %v", run, err)
+		}
+	}
+
+	if got := notifier.sent[post.ID]; got != 1 {
+		t.Errorf("author emailed %d times, want once", got)
+	}
+	if got := notifier.to[post.ID]; got != user.Email {
+		t.Errorf("emailed %q, want the author %q", got, user.Email)
+	}
+	stored, err := postRepo.GetByID(ctx, post.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "published" || stored.PublishedAt == nil {
+		t.Errorf("post is %s, published at %v; want published", stored.Status, stored.PublishedAt)
+	}
+}
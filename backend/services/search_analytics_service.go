@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// maxSearchQueryLength matches the width of search_analytics.query_normalized.
+const maxSearchQueryLength = 255
+
+type searchEvent struct {
+	query       string
+	resultCount int
+	at          time.Time
+}
+
+// SearchAnalyticsService records what visitors search for. Track only queues
+// the search; Flush writes the queued searches to the database in bulk.
+type SearchAnalyticsService struct {
+	searchRepo *repositories.SearchAnalyticsRepository
+	events     chan searchEvent
+}
+
+func NewSearchAnalyticsService(searchRepo *repositories.SearchAnalyticsRepository, bufferSize int) *SearchAnalyticsService {
+	return &SearchAnalyticsService{
+		searchRepo: searchRepo,
+		events:     make(chan searchEvent, bufferSize),
+	}
+}
+
+// NormalizeSearchQuery lowercases the query and collapses whitespace so that
+// trivially different spellings are counted together.
+func NormalizeSearchQuery(query string) string {
+	normalized := strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	if len(normalized) > maxSearchQueryLength {
+		normalized = strings.ToValidUTF8(normalized[:maxSearchQueryLength], "")
+	}
+	return normalized
+}
+
+// Track queues a search without blocking the request. When the buffer is
+// full the search is dropped; analytics are not worth slowing visitors down.
+func (s *SearchAnalyticsService) Track(ctx context.Context, query string, resultCount int) {
+	query = NormalizeSearchQuery(query)
+	if query == "" {
+		return
+	}
+
+	select {
+	case s.events <- searchEvent{query: query, resultCount: resultCount, at: time.Now()}:
+	default:
+	}
+}
+
+// Flush aggregates every queued search per query and upserts the totals.
+func (s *SearchAnalyticsService) Flush(ctx context.Context) error {
+	byQuery := map[string]*models.SearchQueryStat{}
+drain:
+	for {
+		select {
+		case event := <-s.events:
+			stat, ok := byQuery[event.query]
+			if !ok {
+				stat = &models.SearchQueryStat{Query: event.query}
+				byQuery[event.query] = stat
+			}
+			stat.Count++
+			if event.resultCount == 0 {
+				stat.ZeroResultCount++
+			}
+			if event.at.After(stat.LastSearchedAt) {
+				stat.LastSearchedAt = event.at
+			}
+		default:
+			break drain
+		}
+	}
+
+	if len(byQuery) == 0 {
+		return nil
+	}
+
+	stats := make([]*models.SearchQueryStat, 0, len(byQuery))
+	for _, stat := range byQuery {
+		stats = append(stats, stat)
+	}
+
+	return s.searchRepo.Upsert(ctx, stats)
+}
+
+func (s *SearchAnalyticsService) TopQueries(ctx context.Context, limit int) ([]*models.SearchQueryStat, error) {
+	return s.searchRepo.TopQueries(ctx, limit)
+}
+
+func (s *SearchAnalyticsService) ZeroResultQueries(ctx context.Context, limit int) ([]*models.SearchQueryStat, error) {
+	return s.searchRepo.ZeroResultQueries(ctx, limit)
+}
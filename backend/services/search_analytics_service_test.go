@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+func TestNormalizeSearchQuery(t *testing.T) {
+	tests := []struct{ query, want string }{
+		{"Golang", "golang"},
+		{"  Go   Generics\t", "go generics"},
+		{"GO\nGENERICS", "go generics"},
+		{"   ", ""},
+		{strings.Repeat("a", 300), strings.Repeat("a", maxSearchQueryLength)},
+		// A multibyte character cut in half at the limit is dropped
+		{strings.Repeat("a", 254) + "é", strings.Repeat("a", 254)},
+	}
+	for _, tt := range tests {
+		if got := NormalizeSearchQuery(tt.query); got != tt.want {
+			t.Errorf("NormalizeSearchQuery(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+// Spellings of a query that only differ in case and spacing are counted
+// together, and each flush adds to the stored totals.
+func TestSearchAnalyticsFlushUpserts(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	service := NewSearchAnalyticsService(repositories.NewSearchAnalyticsRepository(pool), 10)
+
+	query := dbtest.UniqueName("needle")
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.search_analytics WHERE query_normalized = $1"), query)
+	})
+	stored := func() (count, zeroResults int) {
+		t.Helper()
+		err := pool.QueryRow(ctx, database.Qualify(`
+			SELECT count, zero_result_count FROM {blog}.search_analytics WHERE query_normalized = $1
+		`), query).Scan(&count, &zeroResults)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return count, zeroResults
+	}
+
+	service.Track(ctx, strings.ToUpper(query), 0)
+	service.Track(ctx, "  "+query+" ", 3)
+	service.Track(ctx, "   ", 0)
+	if err := service.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if count, zero := stored(); count != 2 || zero != 1 {
+		t.Errorf("after the first flush: count %d with %d zero results, want 2 with 1", count, zero)
+	}
+
+	service.Track(ctx, query, 0)
+	if err := service.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if count, zero := stored(); count != 3 || zero != 2 {
+		t.Errorf("after the second flush: count %d with %d zero results, want 3 with 2", count, zero)
+	}
+}
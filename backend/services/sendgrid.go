@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// SendGridConfig holds the API key of the SendGrid account and the sender
+// address.
+type SendGridConfig struct {
+	APIKey string
+	From   string
+}
+
+// SendGridMailer sends email through the SendGrid API.
+type SendGridMailer struct {
+	client *sendgrid.Client
+	from   *mail.Email
+}
+
+func NewSendGridMailer(cfg SendGridConfig) *SendGridMailer {
+	return &SendGridMailer{
+		client: sendgrid.NewSendClient(cfg.APIKey),
+		from:   mail.NewEmail("", cfg.From),
+	}
+}
+
+// Send delivers the email as HTML, with the plain text alternative when the
+// email has one. SendGrid answers a rejected email with an error status
+// rather than an error, so any status outside 2xx fails the send.
+func (m *SendGridMailer) Send(ctx context.Context, email *models.QueuedEmail) error {
+	msg := mail.NewSingleEmail(m.from, email.Subject, mail.NewEmail("", email.To), email.BodyText, email.BodyHTML)
+	if email.BodyText == "" {
+		msg.Content = []*mail.Content{mail.NewContent("text/html", email.BodyHTML)}
+	}
+
+	resp, err := m.client.SendWithContext(ctx, msg)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("sendgrid returned %d: %s", resp.StatusCode, resp.Body)
+	}
+	return nil
+}
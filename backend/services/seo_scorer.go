@@ -0,0 +1,136 @@
+package services
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+var (
+	imgTagPattern   = regexp.MustCompile(`(?i)<img\b[^>]*>`)
+	imgAltPattern   = regexp.MustCompile(`(?i)\balt\s*=\s*("([^"]*)"|'([^']*)')`)
+	linkHrefPattern = regexp.MustCompile(`(?i)<a\b[^>]*\bhref\s*=\s*["']([^"']+)["']`)
+)
+
+// SEOMetadata is what search engines show for a post. Posts have no
+// dedicated meta fields, so it is derived from the title and excerpt.
+type SEOMetadata struct {
+	MetaTitle       string
+	MetaDescription string
+}
+
+func SEOMetadataForPost(post *models.Post) *SEOMetadata {
+	return &SEOMetadata{
+		MetaTitle:       post.Title,
+		MetaDescription: post.Excerpt,
+	}
+}
+
+// seoCheck is one weighted criterion of the SEO score. The weights add up
+// to 100.
+type seoCheck struct {
+	name   string
+	weight int
+	run    func(post *models.Post, meta *SEOMetadata) (bool, string)
+}
+
+// SEOScorer rates posts on basic on-page SEO criteria. Links to siteURL or
+// to relative paths count as internal.
+type SEOScorer struct {
+	siteURL string
+	checks  []seoCheck
+}
+
+func NewSEOScorer(siteURL string) *SEOScorer {
+	s := &SEOScorer{siteURL: strings.TrimRight(siteURL, "/")}
+	s.checks = []seoCheck{
+		{"keyword_in_title", 20, checkKeywordInTitle},
+		{"meta_description_length", 15, checkMetaDescriptionLength},
+		{"content_length", 20, checkContentLength},
+		{"image_alt_text", 15, checkImageAltText},
+		{"internal_links", 15, s.checkInternalLinks},
+		{"meta_title_length", 15, checkMetaTitleLength},
+	}
+	return s
+}
+
+func (s *SEOScorer) Score(post *models.Post, meta *SEOMetadata) *models.SEOScore {
+	score := &models.SEOScore{PostID: post.ID, Checks: make([]models.SEOCheck, 0, len(s.checks))}
+
+	for _, check := range s.checks {
+		passed, suggestion := check.run(post, meta)
+		if passed {
+			score.TotalScore += check.weight
+			suggestion = ""
+		}
+		score.Checks = append(score.Checks, models.SEOCheck{Name: check.name, Passed: passed, Suggestion: suggestion})
+	}
+
+	return score
+}
+
+// checkKeywordInTitle treats the post's first tag as its focus keyword.
+func checkKeywordInTitle(post *models.Post, meta *SEOMetadata) (bool, string) {
+	if len(post.Tags) == 0 {
+		return false, "Add a tag; the first tag is used as the focus keyword"
+	}
+
+	keyword := post.Tags[0].Name
+	if strings.Contains(strings.ToLower(post.Title), strings.ToLower(keyword)) {
+		return true, ""
+	}
+	return false, fmt.Sprintf("Use the keyword %q in the title", keyword)
+}
+
+func checkMetaDescriptionLength(post *models.Post, meta *SEOMetadata) (bool, string) {
+	length := utf8.RuneCountInString(strings.TrimSpace(meta.MetaDescription))
+	if length >= 50 && length <= 160 {
+		return true, ""
+	}
+	return false, fmt.Sprintf("Keep the meta description (excerpt) between 50 and 160 characters; it has %d", length)
+}
+
+func checkContentLength(post *models.Post, meta *SEOMetadata) (bool, string) {
+	words := ComputePostStats(post).WordCount
+	if words > 300 {
+		return true, ""
+	}
+	return false, fmt.Sprintf("Write more than 300 words; the post has %d", words)
+}
+
+func checkImageAltText(post *models.Post, meta *SEOMetadata) (bool, string) {
+	missing := 0
+	for _, img := range imgTagPattern.FindAllString(post.Content, -1) {
+		match := imgAltPattern.FindStringSubmatch(img)
+		if match == nil || strings.TrimSpace(match[2]+match[3]) == "" {
+			missing++
+		}
+	}
+
+	if missing == 0 {
+		return true, ""
+	}
+	return false, fmt.Sprintf("Add alt text to %d image(s)", missing)
+}
+
+func (s *SEOScorer) checkInternalLinks(post *models.Post, meta *SEOMetadata) (bool, string) {
+	for _, match := range linkHrefPattern.FindAllStringSubmatch(post.Content, -1) {
+		href := match[1]
+		if (strings.HasPrefix(href, "/") && !strings.HasPrefix(href, "//")) ||
+			(s.siteURL != "" && strings.HasPrefix(href, s.siteURL)) {
+			return true, ""
+		}
+	}
+	return false, "Link to at least one other page on the site"
+}
+
+func checkMetaTitleLength(post *models.Post, meta *SEOMetadata) (bool, string) {
+	length := utf8.RuneCountInString(strings.TrimSpace(meta.MetaTitle))
+	if length >= 50 && length <= 60 {
+		return true, ""
+	}
+	return false, fmt.Sprintf("Keep the meta title between 50 and 60 characters; it has %d", length)
+}
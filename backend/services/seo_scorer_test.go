@@ -0,0 +1,75 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+func TestSEOScore(t *testing.T) {
+	body := strings.Repeat("Feed the starter every day with equal weights of flour and water. ", 30)
+	complete := func() *models.Post {
+		return &models.Post{
+			Title:   "Sourdough starter basics: feeding, timing and flour",
+			Excerpt: "How to keep a sourdough starter lively with a simple daily routine.",
+			Content: `<p>` + body + `</p><img src="/img/jar.jpg" alt="Starter in a jar">` +
+				`<p>See <a href="/blog/baking-your-first-loaf">your first loaf</a>.</p>`,
+			Tags: []*models.Tag{{Name: "Sourdough"}, {Name: "Baking"}},
+		}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(post *models.Post)
+		failed string
+	}{
+		{"complete", func(post *models.Post) {}, ""},
+		{"keyword missing from title", func(post *models.Post) {
+			post.Title = "Starter basics: feeding, timing and choosing your flour"
+		}, "keyword_in_title"},
+		{"no tags", func(post *models.Post) { post.Tags = nil }, "keyword_in_title"},
+		{"short meta description", func(post *models.Post) { post.Excerpt = "Keep it lively." }, "meta_description_length"},
+		{"long meta description", func(post *models.Post) { post.Excerpt = strings.Repeat("a", 161) }, "meta_description_length"},
+		{"thin content", func(post *models.Post) {
+			post.Content = strings.Replace(post.Content, body, "Feed it daily.", 1)
+		}, "content_length"},
+		{"image without alt text", func(post *models.Post) {
+			post.Content += `<img src="/img/crumb.jpg" alt="">`
+		}, "image_alt_text"},
+		{"only external links", func(post *models.Post) {
+			post.Content = strings.Replace(post.Content, "/blog/baking-your-first-loaf", "https://other.example.org/loaf", 1)
+		}, "internal_links"},
+		{"protocol-relative link", func(post *models.Post) {
+			post.Content = strings.Replace(post.Content, "/blog/baking-your-first-loaf", "//other.example.org/loaf", 1)
+		}, "internal_links"},
+		{"short meta title", func(post *models.Post) { post.Title = "Sourdough basics" }, "meta_title_length"},
+	}
+
+	scorer := NewSEOScorer("https://example.com")
+	weights := map[string]int{}
+	for _, check := range scorer.checks {
+		weights[check.name] = check.weight
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			post := complete()
+			tt.modify(post)
+			score := scorer.Score(post, SEOMetadataForPost(post))
+
+			for _, check := range score.Checks {
+				wantPassed := check.Name != tt.failed
+				if check.Passed != wantPassed {
+					t.Errorf("%s passed = %v, want %v", check.Name, check.Passed, wantPassed)
+				}
+				if check.Passed != (check.Suggestion == "") {
+					t.Errorf("%s passed = %v with suggestion %q", check.Name, check.Passed, check.Suggestion)
+				}
+			}
+			if want := 100 - weights[tt.failed]; score.TotalScore != want {
+				t.Errorf("TotalScore = %d, want %d", score.TotalScore, want)
+			}
+		})
+	}
+}
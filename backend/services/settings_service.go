@@ -0,0 +1,200 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/adrianmcmains/integrated-site/config"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+var (
+	ErrSettingNotFound   = errors.New("setting not found")
+	ErrInvalidSettingKey = errors.New("setting key must be 1 to 100 characters")
+	// ErrSettingType is returned when a setting's value cannot be read as
+	// the type asked for.
+	ErrSettingType = errors.New("setting has the wrong type")
+	// ErrSettingRequired is returned when unsetting a setting the site
+	// cannot start without.
+	ErrSettingRequired = errors.New("setting is required and cannot be empty")
+)
+
+// maxSettingKeyLength is the length of the key column.
+const maxSettingKeyLength = 100
+
+// SettingsService reads and writes the site settings. All settings are
+// cached together on first use, and the cache is dropped whenever one is
+// set, so the next read loads them again.
+type SettingsService struct {
+	settingRepo *repositories.SiteSettingRepository
+
+	mu       sync.RWMutex
+	settings map[string]*models.SiteSetting
+	// generation counts the invalidations, so a load that raced with Set
+	// does not cache what it read before the change
+	generation uint64
+}
+
+func NewSettingsService(settingRepo *repositories.SiteSettingRepository) *SettingsService {
+	return &SettingsService{settingRepo: settingRepo}
+}
+
+// All returns every setting, sorted by key.
+func (s *SettingsService) All(ctx context.Context) ([]*models.SiteSetting, error) {
+	settings, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	all := make([]*models.SiteSetting, 0, len(settings))
+	for _, setting := range settings {
+		all = append(all, setting)
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].Key < all[j].Key })
+	return all, nil
+}
+
+// GetString returns a string setting. Numbers and booleans are formatted.
+func (s *SettingsService) GetString(ctx context.Context, key string) (string, error) {
+	value, err := s.value(ctx, key)
+	if err != nil {
+		return "", err
+	}
+
+	switch v := value.(type) {
+	case string:
+		return v, nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	}
+	return "", settingTypeError(key, value, "string")
+}
+
+// GetBool returns a boolean setting. Strings such as "true" and "0" are
+// parsed.
+func (s *SettingsService) GetBool(ctx context.Context, key string) (bool, error) {
+	value, err := s.value(ctx, key)
+	if err != nil {
+		return false, err
+	}
+
+	switch v := value.(type) {
+	case bool:
+		return v, nil
+	case string:
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b, nil
+		}
+	}
+	return false, settingTypeError(key, value, "boolean")
+}
+
+// GetInt returns an integer setting. Whole numbers stored as floats or
+// strings are converted.
+func (s *SettingsService) GetInt(ctx context.Context, key string) (int, error) {
+	value, err := s.value(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+
+	switch v := value.(type) {
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt32 && v <= math.MaxInt32 {
+			return int(v), nil
+		}
+	case string:
+		if i, err := strconv.Atoi(v); err == nil {
+			return i, nil
+		}
+	}
+	return 0, settingTypeError(key, value, "integer")
+}
+
+// GetJSON decodes the setting's value into out, as json.Unmarshal would.
+func (s *SettingsService) GetJSON(ctx context.Context, key string, out interface{}) error {
+	value, err := s.value(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrSettingType, key, err)
+	}
+	return nil
+}
+
+// Set stores the setting's value, which may be any JSON value. A nil value
+// unsets it, which the required site settings refuse.
+func (s *SettingsService) Set(ctx context.Context, key string, value interface{}) error {
+	if key == "" || len(key) > maxSettingKeyLength {
+		return ErrInvalidSettingKey
+	}
+	if config.IsRequiredSiteSetting(key) && (value == nil || value == "") {
+		return ErrSettingRequired
+	}
+
+	if err := s.settingRepo.Set(ctx, &models.SiteSetting{Key: key, Value: value}); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.settings = nil
+	s.generation++
+	s.mu.Unlock()
+
+	return nil
+}
+
+// value returns the setting's value. Unset settings yield
+// ErrSettingNotFound.
+func (s *SettingsService) value(ctx context.Context, key string) (interface{}, error) {
+	settings, err := s.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	setting, ok := settings[key]
+	if !ok || setting.Value == nil {
+		return nil, fmt.Errorf("%w: %s", ErrSettingNotFound, key)
+	}
+	return setting.Value, nil
+}
+
+// load returns the cached settings, loading them if the cache is empty.
+func (s *SettingsService) load(ctx context.Context) (map[string]*models.SiteSetting, error) {
+	s.mu.RLock()
+	settings, generation := s.settings, s.generation
+	s.mu.RUnlock()
+	if settings != nil {
+		return settings, nil
+	}
+
+	settings, err := s.settingRepo.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if s.generation == generation {
+		s.settings = settings
+	}
+	s.mu.Unlock()
+	return settings, nil
+}
+
+func settingTypeError(key string, value interface{}, want string) error {
+	return fmt.Errorf("%w: %s is %T, not %s", ErrSettingType, key, value, want)
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"encoding/xml"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// sitemapNamespace is the XML namespace of the sitemap protocol.
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// SitemapURLSet is a sitemap document.
+type SitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []SitemapURL `xml:"url"`
+}
+
+// SitemapURL is one page of the site. LastMod is a W3C datetime.
+type SitemapURL struct {
+	Loc        string  `xml:"loc"`
+	LastMod    string  `xml:"lastmod,omitempty"`
+	Changefreq string  `xml:"changefreq,omitempty"`
+	Priority   float64 `xml:"priority,omitempty"`
+}
+
+// SitemapProvider lists the URLs of one type of content. Loc is a path,
+// made absolute by the SitemapService.
+type SitemapProvider interface {
+	SitemapURLs(ctx context.Context) ([]SitemapURL, error)
+}
+
+// SitemapService builds the sitemap from the URLs of its providers.
+type SitemapService struct {
+	siteURL   string
+	providers []SitemapProvider
+}
+
+func NewSitemapService(siteURL string, providers ...SitemapProvider) *SitemapService {
+	return &SitemapService{siteURL: strings.TrimRight(siteURL, "/"), providers: providers}
+}
+
+// Generate queries every provider concurrently and returns their URLs in
+// provider order. It fails if any provider does.
+func (s *SitemapService) Generate(ctx context.Context) (*SitemapURLSet, error) {
+	results := make([][]SitemapURL, len(s.providers))
+	errs := make([]error, len(s.providers))
+
+	var wg sync.WaitGroup
+	for i, provider := range s.providers {
+		wg.Add(1)
+		go func(i int, provider SitemapProvider) {
+			defer wg.Done()
+			results[i], errs[i] = provider.SitemapURLs(ctx)
+		}(i, provider)
+	}
+	wg.Wait()
+
+	urlSet := &SitemapURLSet{Xmlns: sitemapNamespace, URLs: []SitemapURL{}}
+	for i, urls := range results {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		for _, url := range urls {
+			url.Loc = s.siteURL + url.Loc
+			urlSet.URLs = append(urlSet.URLs, url)
+		}
+	}
+
+	return urlSet, nil
+}
+
+// sitemapSource lists the published entries of a content type.
+type sitemapSource interface {
+	ListSitemapEntries(ctx context.Context) ([]models.SitemapEntry, error)
+}
+
+// contentSitemapProvider lists the entries of a source under pathPrefix.
+type contentSitemapProvider struct {
+	source     sitemapSource
+	pathPrefix string
+	changefreq string
+	priority   float64
+}
+
+// NewPostSitemapProvider lists published blog posts.
+func NewPostSitemapProvider(postRepo *repositories.PostRepository) SitemapProvider {
+	return &contentSitemapProvider{source: postRepo, pathPrefix: "/blog/", changefreq: "weekly", priority: 0.7}
+}
+
+// NewPageSitemapProvider lists published CMS pages.
+func NewPageSitemapProvider(pageRepo *repositories.PageRepository) SitemapProvider {
+	return &contentSitemapProvider{source: pageRepo, pathPrefix: "/pages/", changefreq: "monthly", priority: 0.5}
+}
+
+// NewProductSitemapProvider lists published products.
+func NewProductSitemapProvider(productRepo *repositories.ProductRepository) SitemapProvider {
+	return &contentSitemapProvider{source: productRepo, pathPrefix: "/shop/products/", changefreq: "daily", priority: 0.8}
+}
+
+func (p *contentSitemapProvider) SitemapURLs(ctx context.Context) ([]SitemapURL, error) {
+	entries, err := p.source.ListSitemapEntries(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	urls := make([]SitemapURL, 0, len(entries))
+	for _, entry := range entries {
+		urls = append(urls, SitemapURL{
+			Loc:        p.pathPrefix + entry.Slug,
+			LastMod:    entry.UpdatedAt.UTC().Format(time.RFC3339),
+			Changefreq: p.changefreq,
+			Priority:   p.priority,
+		})
+	}
+
+	return urls, nil
+}
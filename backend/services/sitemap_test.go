@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// fakeSitemapSource returns fixed entries, or err.
+type fakeSitemapSource struct {
+	entries []models.SitemapEntry
+	err     error
+}
+
+func (f fakeSitemapSource) ListSitemapEntries(ctx context.Context) ([]models.SitemapEntry, error) {
+	return f.entries, f.err
+}
+
+func TestSitemapGenerate(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+	posts := &contentSitemapProvider{
+		source: fakeSitemapSource{entries: []models.SitemapEntry{
+			{Slug: "hello", UpdatedAt: time.Date(2026, 10, 1, 14, 30, 0, 0, berlin)},
+		}},
+		pathPrefix: "/blog/",
+		changefreq: "weekly",
+		priority:   0.7,
+	}
+	products := &contentSitemapProvider{
+		source: fakeSitemapSource{entries: []models.SitemapEntry{
+			{Slug: "mug", UpdatedAt: time.Date(2026, 9, 30, 8, 0, 0, 0, time.UTC)},
+			{Slug: "tee", UpdatedAt: time.Date(2026, 9, 29, 23, 59, 59, 0, time.UTC)},
+		}},
+		pathPrefix: "/shop/products/",
+		changefreq: "daily",
+		priority:   0.8,
+	}
+
+	urlSet, err := NewSitemapService("https://example.com/", posts, products).Generate(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []SitemapURL{
+		{Loc: "https://example.com/blog/hello", LastMod: "2026-10-01T12:30:00Z", Changefreq: "weekly", Priority: 0.7},
+		{Loc: "https://example.com/shop/products/mug", LastMod: "2026-09-30T08:00:00Z", Changefreq: "daily", Priority: 0.8},
+		{Loc: "https://example.com/shop/products/tee", LastMod: "2026-09-29T23:59:59Z", Changefreq: "daily", Priority: 0.8},
+	}
+	if urlSet.Xmlns != sitemapNamespace {
+		t.Errorf("xmlns = %q, want %q", urlSet.Xmlns, sitemapNamespace)
+	}
+	if len(urlSet.URLs) != len(want) {
+		t.Fatalf("URLs = %+v, want %+v", urlSet.URLs, want)
+	}
+	for i := range want {
+		if urlSet.URLs[i] != want[i] {
+			t.Errorf("URL %d = %+v, want %+v", i, urlSet.URLs[i], want[i])
+		}
+	}
+}
+
+func TestSitemapGenerateFailsWithAProvider(t *testing.T) {
+	sourceErr := errors.New("query failed")
+	service := NewSitemapService("https://example.com",
+		&contentSitemapProvider{source: fakeSitemapSource{}, pathPrefix: "/pages/"},
+		&contentSitemapProvider{source: fakeSitemapSource{err: sourceErr}, pathPrefix: "/blog/"},
+	)
+
+	if _, err := service.Generate(context.Background()); !errors.Is(err, sourceErr) {
+		t.Errorf("err = %v, want the provider's error", err)
+	}
+}
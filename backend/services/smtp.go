@@ -0,0 +1,108 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+// Mailer sends an email. EmailWorker hands it the emails from the send
+// queue.
+type Mailer interface {
+	Send(ctx context.Context, email *models.QueuedEmail) error
+}
+
+// LogMailer only logs the emails it is given. It stands in when no SMTP
+// server is configured.
+type LogMailer struct{}
+
+func (LogMailer) Send(ctx context.Context, email *models.QueuedEmail) error {
+	log.Printf("Email to %s not sent, no SMTP server configured: %s\n", email.To, email.Subject)
+	return nil
+}
+
+// SMTPMailer sends email through the configured SMTP server.
+type SMTPMailer struct {
+	cfg SMTPConfig
+}
+
+func NewSMTPMailer(cfg SMTPConfig) *SMTPMailer {
+	return &SMTPMailer{cfg: cfg}
+}
+
+// Send delivers the email as HTML, with the plain text alternative when the
+// email has one.
+func (m *SMTPMailer) Send(ctx context.Context, email *models.QueuedEmail) error {
+	if strings.ContainsAny(email.To, "\r\n") {
+		return fmt.Errorf("invalid recipient %q", email.To)
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", m.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", email.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", email.Subject))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+
+	if email.BodyText == "" {
+		msg.WriteString("Content-Type: text/html; charset=UTF-8\r\n\r\n")
+		msg.WriteString(email.BodyHTML)
+	} else {
+		parts := multipart.NewWriter(&msg)
+		fmt.Fprintf(&msg, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", parts.Boundary())
+		// Clients show the last part they can render, so HTML goes last
+		for _, part := range []struct{ contentType, body string }{
+			{"text/plain; charset=UTF-8", email.BodyText},
+			{"text/html; charset=UTF-8", email.BodyHTML},
+		} {
+			w, err := parts.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+			if err != nil {
+				return err
+			}
+			if _, err := io.WriteString(w, part.body); err != nil {
+				return err
+			}
+		}
+		if err := parts.Close(); err != nil {
+			return err
+		}
+	}
+
+	var auth smtp.Auth
+	if m.cfg.Username != "" {
+		auth = smtp.PlainAuth("", m.cfg.Username, m.cfg.Password, m.cfg.Host)
+	}
+
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	return smtp.SendMail(addr, auth, m.cfg.From, []string{email.To}, msg.Bytes())
+}
+
+// SMTPConfig holds the address of the outgoing mail server, the credentials
+// to log in with, if any, and the sender address.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+// SMTPHealthCheck checks that the SMTP server accepts TCP connections.
+func SMTPHealthCheck(cfg SMTPConfig) error {
+	conn, err := net.DialTimeout("tcp", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), 2*time.Second)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
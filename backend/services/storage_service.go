@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// StorageBackend stores uploaded files under a key and serves them at a
+// public URL. Files under the private/ prefix are not served publicly;
+// PresignGet links to one for a limited time instead.
+type StorageBackend interface {
+	Upload(ctx context.Context, key, contentType string, r io.Reader) (url string, err error)
+	Delete(ctx context.Context, key string) error
+	PresignGet(ctx context.Context, key string, expires time.Duration) (url string, err error)
+}
+
+// ErrInvalidDownloadLink is returned for a signed local download link that
+// was tampered with or has expired.
+var ErrInvalidDownloadLink = errors.New("download link is invalid or has expired")
+
+// LocalDiskBackend keeps uploads in a directory on disk, served by the app
+// itself under baseURL. Private files are not served there: PresignGet
+// links to them under signedURL with an HMAC signature of the key and
+// expiry, which the app checks with SignedPath before serving the file.
+// It is meant for development.
+type LocalDiskBackend struct {
+	dir        string
+	baseURL    string
+	signedURL  string
+	signingKey []byte
+	now        func() time.Time
+}
+
+func NewLocalDiskBackend(dir, baseURL, signedURL string, signingKey []byte) *LocalDiskBackend {
+	return &LocalDiskBackend{
+		dir:        dir,
+		baseURL:    strings.TrimRight(baseURL, "/"),
+		signedURL:  strings.TrimRight(signedURL, "/"),
+		signingKey: signingKey,
+		now:        time.Now,
+	}
+}
+
+// Upload writes the file to a temporary name first, so a failed upload
+// never leaves a partial file under the key.
+func (b *LocalDiskBackend) Upload(ctx context.Context, key, contentType string, r io.Reader) (string, error) {
+	path, err := b.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", err
+	}
+
+	return b.baseURL + "/" + key, nil
+}
+
+func (b *LocalDiskBackend) Delete(ctx context.Context, key string) error {
+	path, err := b.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// PresignGet returns a link to the file under signedURL that works until
+// expires from now.
+func (b *LocalDiskBackend) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	if _, err := b.path(key); err != nil {
+		return "", err
+	}
+	if len(b.signingKey) == 0 {
+		return "", errors.New("no signing key configured for local downloads")
+	}
+	expiresAt := b.now().Add(expires).Unix()
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expiresAt, 10)},
+		"signature": {b.sign(key, expiresAt)},
+	}
+	return b.signedURL + "/" + key + "?" + query.Encode(), nil
+}
+
+// SignedPath returns the file a link made by PresignGet points to, or
+// ErrInvalidDownloadLink if its signature does not match or it has
+// expired.
+func (b *LocalDiskBackend) SignedPath(key, expires, signature string) (string, error) {
+	expiresAt, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || len(b.signingKey) == 0 {
+		return "", ErrInvalidDownloadLink
+	}
+	if !hmac.Equal([]byte(signature), []byte(b.sign(key, expiresAt))) {
+		return "", ErrInvalidDownloadLink
+	}
+	if b.now().Unix() > expiresAt {
+		return "", ErrInvalidDownloadLink
+	}
+	return b.path(key)
+}
+
+// PublicPath returns the file served at baseURL for key, refusing keys
+// under the private/ prefix.
+func (b *LocalDiskBackend) PublicPath(key string) (string, error) {
+	if cleaned := path.Clean("/" + key); strings.HasPrefix(cleaned, "/private/") || cleaned == "/private" {
+		return "", fmt.Errorf("storage key %q is private", key)
+	}
+	return b.path(key)
+}
+
+func (b *LocalDiskBackend) sign(key string, expiresAt int64) string {
+	mac := hmac.New(sha256.New, b.signingKey)
+	fmt.Fprintf(mac, "%s\n%d", key, expiresAt)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// path maps a key to a file under the upload directory, rejecting keys
+// that would escape it.
+func (b *LocalDiskBackend) path(key string) (string, error) {
+	path := filepath.FromSlash(key)
+	if !filepath.IsLocal(path) {
+		return "", fmt.Errorf("invalid storage key %q", key)
+	}
+	return filepath.Join(b.dir, path), nil
+}
+
+// S3Config holds the bucket uploads go to and the URL they are served
+// from. BaseURL defaults to the bucket's own S3 address; set it when the
+// bucket is behind a CDN. Credentials come from the usual AWS environment
+// variables, shared config or instance role.
+type S3Config struct {
+	Bucket  string
+	Region  string
+	BaseURL string
+}
+
+// s3API is the part of the S3 client that S3Backend uses.
+type s3API interface {
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error)
+	DeleteObject(ctx context.Context, params *s3.DeleteObjectInput, optFns ...func(*s3.Options)) (*s3.DeleteObjectOutput, error)
+}
+
+// S3Backend keeps uploads in an S3 bucket. The bucket's policy must only
+// make the uploads/ and variants/ prefixes public, not private/.
+type S3Backend struct {
+	client    s3API
+	presigner *s3.PresignClient
+	bucket    string
+	baseURL   string
+}
+
+func NewS3Backend(ctx context.Context, cfg S3Config) (*S3Backend, error) {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx, awsconfig.WithRegion(cfg.Region))
+	if err != nil {
+		return nil, err
+	}
+
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", cfg.Bucket, cfg.Region)
+	}
+
+	client := s3.NewFromConfig(awsCfg)
+	return &S3Backend{
+		client:    client,
+		presigner: s3.NewPresignClient(client),
+		bucket:    cfg.Bucket,
+		baseURL:   strings.TrimRight(baseURL, "/"),
+	}, nil
+}
+
+func (b *S3Backend) Upload(ctx context.Context, key, contentType string, r io.Reader) (string, error) {
+	_, err := b.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(b.bucket),
+		Key:         aws.String(key),
+		Body:        r,
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return "", err
+	}
+	return b.baseURL + "/" + key, nil
+}
+
+func (b *S3Backend) Delete(ctx context.Context, key string) error {
+	_, err := b.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// PresignGet returns a signed S3 URL for the file that stops working after
+// expires.
+func (b *S3Backend) PresignGet(ctx context.Context, key string, expires time.Duration) (string, error) {
+	req, err := b.presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expires))
+	if err != nil {
+		return "", err
+	}
+	return req.URL, nil
+}
@@ -0,0 +1,205 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services/payment"
+)
+
+var (
+	ErrSubscriptionNotFound = errors.New("subscription not found")
+	ErrInvalidInterval      = errors.New("invalid subscription interval")
+)
+
+// PaymentProcessor charges the customer for an order. It returns the
+// order's payment status after the attempt: "paid" when the charge went
+// through, or "pending" when the provider reports the outcome later, as
+// Stripe does through its webhook.
+type PaymentProcessor interface {
+	ProcessPayment(ctx context.Context, order *models.Order) (string, error)
+}
+
+// ProviderPaymentProcessor charges orders through a payment provider from
+// the payment registry, in the given currency.
+type ProviderPaymentProcessor struct {
+	provider payment.PaymentProvider
+	currency string
+}
+
+func NewProviderPaymentProcessor(provider payment.PaymentProvider, currency string) *ProviderPaymentProcessor {
+	return &ProviderPaymentProcessor{provider: provider, currency: currency}
+}
+
+func (p *ProviderPaymentProcessor) ProcessPayment(ctx context.Context, order *models.Order) (string, error) {
+	result, err := p.provider.InitPayment(ctx, &payment.PaymentRequest{
+		OrderID:       order.ID,
+		Amount:        order.TotalAmount,
+		Currency:      p.currency,
+		Description:   fmt.Sprintf("Order %s", order.ID),
+		CustomerEmail: order.CustomerEmail,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if result.Status == "succeeded" {
+		return "paid", nil
+	}
+	return "pending", nil
+}
+
+type SubscriptionService struct {
+	subscriptionRepo *repositories.SubscriptionRepository
+	customerRepo     *repositories.CustomerRepository
+	orderService     *OrderService
+	payments         PaymentProcessor
+}
+
+func NewSubscriptionService(
+	subscriptionRepo *repositories.SubscriptionRepository,
+	customerRepo *repositories.CustomerRepository,
+	orderService *OrderService,
+	payments PaymentProcessor,
+) *SubscriptionService {
+	return &SubscriptionService{
+		subscriptionRepo: subscriptionRepo,
+		customerRepo:     customerRepo,
+		orderService:     orderService,
+		payments:         payments,
+	}
+}
+
+// NextBillingDate returns the billing date that follows from for the given
+// interval.
+func NextBillingDate(from time.Time, interval string) (time.Time, error) {
+	switch interval {
+	case "weekly":
+		return from.AddDate(0, 0, 7), nil
+	case "monthly":
+		return from.AddDate(0, 1, 0), nil
+	case "quarterly":
+		return from.AddDate(0, 3, 0), nil
+	default:
+		return time.Time{}, ErrInvalidInterval
+	}
+}
+
+// ProcessDueSubscriptions places a renewal order for every active
+// subscription that is due, charges it, and moves the subscription to its
+// next billing date. A failed charge moves the subscription to past_due.
+func (s *SubscriptionService) ProcessDueSubscriptions(ctx context.Context) error {
+	now := time.Now()
+
+	subs, err := s.subscriptionRepo.ListDue(ctx, now)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sub := range subs {
+		if err := s.renew(ctx, sub, now); err != nil {
+			errs = append(errs, fmt.Errorf("subscription %s: %w", sub.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (s *SubscriptionService) renew(ctx context.Context, sub *models.Subscription, now time.Time) error {
+	// Work out the next billing date first so a bad interval never creates an order
+	next, err := NextBillingDate(sub.NextBillingAt, sub.Interval)
+	if err != nil {
+		return err
+	}
+	// Skip over any periods missed while the job was not running
+	for !next.After(now) {
+		if next, err = NextBillingDate(next, sub.Interval); err != nil {
+			return err
+		}
+	}
+
+	price := sub.Product.Price
+	if sub.Product.SalePrice != nil {
+		price = *sub.Product.SalePrice
+	}
+
+	order := &models.Order{
+		CustomerID:      sub.CustomerID,
+		ShippingAddress: sub.Customer.ShippingAddress,
+		BillingAddress:  sub.Customer.BillingAddress,
+		PaymentMethod:   "subscription",
+		Notes:           fmt.Sprintf("Subscription renewal %s", sub.ID),
+		Items: []*models.OrderItem{
+			{ProductID: sub.ProductID, Quantity: sub.Quantity, Price: price},
+		},
+	}
+
+	// The order and the move to the next billing date are saved together,
+	// so a failure in between cannot renew the subscription twice
+	err = s.orderService.CreateRenewalOrder(ctx, order, sub, next)
+	if errors.Is(err, repositories.ErrConflict) {
+		// Renewed by another run in the meantime
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	paymentStatus, err := s.payments.ProcessPayment(ctx, order)
+	if err != nil {
+		log.Printf("Payment failed for subscription %s order %s: %v\n", sub.ID, order.ID, err)
+
+		if err := s.orderService.UpdatePaymentStatus(ctx, order.ID, "failed"); err != nil {
+			return err
+		}
+		return s.subscriptionRepo.UpdateStatus(ctx, sub.ID, "past_due")
+	}
+
+	if paymentStatus == order.PaymentStatus {
+		return nil
+	}
+	return s.orderService.UpdatePaymentStatus(ctx, order.ID, paymentStatus)
+}
+
+// ListForUser returns the subscriptions belonging to the customer record of
+// the given user.
+func (s *SubscriptionService) ListForUser(ctx context.Context, userID uuid.UUID) ([]*models.Subscription, error) {
+	customer, err := s.customerRepo.GetByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if customer == nil {
+		return []*models.Subscription{}, nil
+	}
+
+	return s.subscriptionRepo.ListByCustomer(ctx, customer.ID)
+}
+
+func (s *SubscriptionService) List(ctx context.Context, status string, limit, offset int) ([]*models.Subscription, int, error) {
+	return s.subscriptionRepo.List(ctx, status, limit, offset)
+}
+
+// UpdateStatus lets an admin pause, resume or cancel a subscription.
+func (s *SubscriptionService) UpdateStatus(ctx context.Context, id uuid.UUID, status string) (*models.Subscription, error) {
+	sub, err := s.subscriptionRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub == nil {
+		return nil, ErrSubscriptionNotFound
+	}
+
+	if err := s.subscriptionRepo.UpdateStatus(ctx, id, status); err != nil {
+		return nil, err
+	}
+	sub.Status = status
+
+	return sub, nil
+}
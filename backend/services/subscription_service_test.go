@@ -0,0 +1,34 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNextBillingDate(t *testing.T) {
+	from := time.Date(2026, 1, 15, 9, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		interval string
+		want     time.Time
+	}{
+		{"weekly", time.Date(2026, 1, 22, 9, 30, 0, 0, time.UTC)},
+		{"monthly", time.Date(2026, 2, 15, 9, 30, 0, 0, time.UTC)},
+		{"quarterly", time.Date(2026, 4, 15, 9, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		got, err := NextBillingDate(from, tt.interval)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.interval, err)
+		}
+		if !got.Equal(tt.want) {
+			t.Errorf("%s: NextBillingDate = %v, want %v", tt.interval, got, tt.want)
+		}
+	}
+
+	if _, err := NextBillingDate(from, "yearly"); !errors.Is(err, ErrInvalidInterval) {
+		t.Errorf("unknown interval: err = %v, want ErrInvalidInterval", err)
+	}
+}
@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/util"
+)
+
+var ErrInvalidTag = errors.New("tag needs a name or slug with letters or digits")
+
+type TagService struct {
+	tagRepo *repositories.TagRepository
+}
+
+func NewTagService(tagRepo *repositories.TagRepository) *TagService {
+	return &TagService{tagRepo: tagRepo}
+}
+
+// CreateBatch creates the requested tags, skipping the ones that already
+// exist. Slugs are normalized, and generated from the name when missing.
+func (s *TagService) CreateBatch(ctx context.Context, req *models.CreateTagsRequest) (*models.TagBatchResult, error) {
+	tags := make([]*models.Tag, len(req.Tags))
+	for i, tagReq := range req.Tags {
+		name := strings.TrimSpace(tagReq.Name)
+		slug := util.Slugify(tagReq.Slug)
+		if slug == "" {
+			slug = util.Slugify(name)
+		}
+		if name == "" || slug == "" {
+			return nil, ErrInvalidTag
+		}
+		tags[i] = &models.Tag{Name: name, Slug: slug}
+	}
+
+	created, err := s.tagRepo.CreateBatch(ctx, tags)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.TagBatchResult{
+		Created: len(created),
+		Skipped: len(tags) - len(created),
+		Tags:    created,
+	}, nil
+}
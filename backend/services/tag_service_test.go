@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+func TestCreateBatchRejectsTagsWithoutSlug(t *testing.T) {
+	// Rejected before the repository is used, so none is needed
+	service := NewTagService(nil)
+
+	req := &models.CreateTagsRequest{Tags: []models.TagRequest{{Name: "golang"}, {Name: "!!!"}}}
+	if _, err := service.CreateBatch(context.Background(), req); !errors.Is(err, ErrInvalidTag) {
+		t.Errorf("err = %v, want ErrInvalidTag", err)
+	}
+}
+
+// Existing tags and repeats within the batch are skipped, and names are
+// stored as given rather than spliced into the SQL.
+func TestCreateBatchCountsCreatedAndSkipped(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	service := NewTagService(repositories.NewTagRepository(pool))
+
+	prefix := dbtest.UniqueName("import")
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {blog}.tags WHERE slug LIKE $1"), prefix+"%")
+	})
+	dbtest.Exec(t, pool, database.Qualify(`
+		INSERT INTO {blog}.tags (name, slug) VALUES ($1, $1)
+	`), prefix+"-existing")
+
+	malicious := prefix + `'), ('x', 'y'); DROP TABLE blog.tags; --`
+	result, err := service.CreateBatch(ctx, &models.CreateTagsRequest{Tags: []models.TagRequest{
+		{Name: prefix + "-existing", Slug: prefix + "-existing"},
+		{Name: prefix + "-go", Slug: prefix + "-go"},
+		{Name: prefix + " Postgres"},
+		{Name: malicious, Slug: prefix + "-injection"},
+		// The same slug twice in one batch creates it once
+		{Name: prefix + "-go again", Slug: prefix + "-go"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Created != 3 || result.Skipped != 2 {
+		t.Errorf("created %d, skipped %d; want 3 and 2", result.Created, result.Skipped)
+	}
+	slugs := map[string]string{}
+	for _, tag := range result.Tags {
+		slugs[tag.Slug] = tag.Name
+	}
+	if name, ok := slugs[prefix+"-postgres"]; !ok || name != prefix+" Postgres" {
+		t.Errorf("created %v, want a slug generated from %q", slugs, prefix+" Postgres")
+	}
+
+	var name string
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		SELECT name FROM {blog}.tags WHERE slug = $1
+	`), prefix+"-injection").Scan(&name); err != nil {
+		t.Fatal(err)
+	}
+	if name != malicious {
+		t.Errorf("stored name = %q, want it verbatim", name)
+	}
+	var injected int
+	if err := pool.QueryRow(ctx, database.Qualify(`
+		SELECT COUNT(*) FROM {blog}.tags WHERE name = 'x' AND slug = 'y'
+	`)).Scan(&injected); err != nil {
+		t.Fatal(err)
+	}
+	if injected != 0 {
+		t.Errorf("%d tags inserted by the name's SQL", injected)
+	}
+}
@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+var (
+	ErrTaxRateNotFound = repositories.ErrTaxRateNotFound
+	ErrTaxRateExists   = repositories.ErrTaxRateExists
+)
+
+// TaxBreakdown splits an amount into its net part and the tax on it.
+type TaxBreakdown struct {
+	Net   float64 `json:"net"`
+	Tax   float64 `json:"tax"`
+	Gross float64 `json:"gross"`
+}
+
+// TaxService works out tax two ways: per product, from the product's or its
+// category's rate, for displayed prices; and per order, from the rate
+// configured for the shipping address.
+type TaxService struct {
+	taxRepo *repositories.TaxRepository
+}
+
+func NewTaxService(taxRepo *repositories.TaxRepository) *TaxService {
+	return &TaxService{taxRepo: taxRepo}
+}
+
+// EffectiveRate returns the product's own tax rate, falling back to its
+// category's rate and then to zero.
+func (s *TaxService) EffectiveRate(product *models.Product) float64 {
+	if product.TaxRate != nil {
+		return *product.TaxRate
+	}
+	if product.Category != nil {
+		return product.Category.TaxRate
+	}
+	return 0
+}
+
+// Calculate works out the tax on quantity units at unitPrice. Prices that
+// already include tax have it extracted rather than added a second time.
+func (s *TaxService) Calculate(product *models.Product, unitPrice float64, quantity int) TaxBreakdown {
+	rate := s.EffectiveRate(product)
+	amount := unitPrice * float64(quantity)
+
+	if product.PriceIncludesTax {
+		net := roundCents(amount / (1 + rate))
+		gross := roundCents(amount)
+		return TaxBreakdown{Net: net, Tax: roundCents(gross - net), Gross: gross}
+	}
+
+	net := roundCents(amount)
+	tax := roundCents(amount * rate)
+	return TaxBreakdown{Net: net, Tax: tax, Gross: roundCents(net + tax)}
+}
+
+// ApplyDisplayPrices fills in the product's price with and without tax.
+func (s *TaxService) ApplyDisplayPrices(product *models.Product) {
+	breakdown := s.Calculate(product, product.Price, 1)
+	product.PriceExcTax = breakdown.Net
+	product.PriceIncTax = breakdown.Gross
+}
+
+// CalculateTax returns the tax on subtotal for an order shipped to addr,
+// and the rate applied. For inclusive rates the tax is the part of subtotal
+// that is tax; otherwise it is charged on top. Without a matching rate
+// there is no tax.
+func (s *TaxService) CalculateTax(ctx context.Context, subtotal float64, addr map[string]string) (taxAmount float64, rateApplied float64, err error) {
+	rate, err := s.ResolveRate(ctx, addr)
+	if err != nil || rate == nil {
+		return 0, 0, err
+	}
+	return taxOn(rate, subtotal), rate.Rate, nil
+}
+
+// ResolveRate returns the most specific rate matching the address's
+// country, state and postal_code: a postcode rate over a region rate over
+// the country's rate over the default. It returns nil when none matches.
+func (s *TaxService) ResolveRate(ctx context.Context, addr map[string]string) (*models.TaxRate, error) {
+	country := strings.ToUpper(strings.TrimSpace(addr["country"]))
+	rates, err := s.taxRepo.ListForCountry(ctx, country)
+	if err != nil {
+		return nil, err
+	}
+	return resolveTaxRate(rates, country, addr["state"], addr["postal_code"]), nil
+}
+
+func (s *TaxService) ListRates(ctx context.Context) ([]*models.TaxRate, error) {
+	return s.taxRepo.List(ctx)
+}
+
+func (s *TaxService) CreateRate(ctx context.Context, req *models.TaxRateRequest) (*models.TaxRate, error) {
+	rate := &models.TaxRate{}
+	applyTaxRateRequest(rate, req)
+
+	if err := s.taxRepo.Create(ctx, rate); err != nil {
+		return nil, err
+	}
+	return rate, nil
+}
+
+func (s *TaxService) UpdateRate(ctx context.Context, id uuid.UUID, req *models.TaxRateRequest) (*models.TaxRate, error) {
+	rate := &models.TaxRate{ID: id}
+	applyTaxRateRequest(rate, req)
+
+	if err := s.taxRepo.Update(ctx, rate); err != nil {
+		return nil, err
+	}
+	return rate, nil
+}
+
+func (s *TaxService) DeleteRate(ctx context.Context, id uuid.UUID) error {
+	return s.taxRepo.Delete(ctx, id)
+}
+
+// applyTaxRateRequest copies the request into the rate, normalised the way
+// addresses are matched against it.
+func applyTaxRateRequest(rate *models.TaxRate, req *models.TaxRateRequest) {
+	rate.Country = strings.ToUpper(strings.TrimSpace(req.Country))
+	rate.Region = strings.TrimSpace(req.Region)
+	rate.Postcode = normalizePostcode(req.Postcode)
+	rate.Rate = req.Rate
+	rate.IsInclusive = req.IsInclusive
+}
+
+// resolveTaxRate picks the most specific of the rates matching the
+// address. A rate matches when each of its country, region and postcode is
+// empty or equal to the address's; regions are compared case-insensitively
+// and postcodes ignoring case and spaces.
+func resolveTaxRate(rates []*models.TaxRate, country, region, postcode string) *models.TaxRate {
+	region = strings.TrimSpace(region)
+	postcode = normalizePostcode(postcode)
+
+	var best *models.TaxRate
+	bestScore := -1
+	for _, rate := range rates {
+		if rate.Country != "" && rate.Country != country ||
+			rate.Region != "" && !strings.EqualFold(rate.Region, region) ||
+			rate.Postcode != "" && rate.Postcode != postcode {
+			continue
+		}
+
+		score := 0
+		if rate.Postcode != "" {
+			score += 4
+		}
+		if rate.Region != "" {
+			score += 2
+		}
+		if rate.Country != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = rate, score
+		}
+	}
+	return best
+}
+
+func normalizePostcode(postcode string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(postcode), ""))
+}
+
+// taxOn returns the tax in amount at the rate: extracted from it for an
+// inclusive rate, charged on top of it otherwise.
+func taxOn(rate *models.TaxRate, amount float64) float64 {
+	if rate.IsInclusive {
+		return roundCents(amount - amount/(1+rate.Rate))
+	}
+	return roundCents(amount * rate.Rate)
+}
@@ -0,0 +1,105 @@
+package services
+
+import (
+	"testing"
+
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+func TestResolveTaxRate(t *testing.T) {
+	fallback := &models.TaxRate{Rate: 0.05}
+	country := &models.TaxRate{Country: "US", Rate: 0.06}
+	region := &models.TaxRate{Country: "US", Region: "CA", Rate: 0.0725}
+	postcode := &models.TaxRate{Country: "US", Region: "CA", Postcode: "94105", Rate: 0.08625}
+	ukPostcode := &models.TaxRate{Country: "GB", Postcode: "SW1A1AA", Rate: 0.2}
+	rates := []*models.TaxRate{fallback, country, region, postcode, ukPostcode}
+
+	tests := []struct {
+		name                      string
+		country, region, postcode string
+		want                      *models.TaxRate
+	}{
+		{"postcode beats region", "US", "CA", "94105", postcode},
+		{"region beats country", "US", "CA", "90001", region},
+		{"region matched ignoring case", "US", " ca ", "", region},
+		{"country beats the default", "US", "NY", "10001", country},
+		{"default for other countries", "FR", "", "75001", fallback},
+		{"postcode matched ignoring case and spaces", "GB", "", "sw1a 1aa", ukPostcode},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := resolveTaxRate(rates, tt.country, tt.region, tt.postcode); got != tt.want {
+				t.Errorf("resolveTaxRate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if got := resolveTaxRate([]*models.TaxRate{country}, "FR", "", ""); got != nil {
+		t.Errorf("resolveTaxRate without a match = %+v, want nil", got)
+	}
+}
+
+func TestTaxServiceCalculate(t *testing.T) {
+	rate := func(r float64) *float64 { return &r }
+	service := &TaxService{}
+
+	tests := []struct {
+		name      string
+		product   models.Product
+		unitPrice float64
+		quantity  int
+		want      TaxBreakdown
+	}{
+		{
+			name:      "tax added on top",
+			product:   models.Product{TaxRate: rate(0.2)},
+			unitPrice: 10,
+			quantity:  3,
+			want:      TaxBreakdown{Net: 30, Tax: 6, Gross: 36},
+		},
+		{
+			name:      "tax extracted from an inclusive price",
+			product:   models.Product{TaxRate: rate(0.2), PriceIncludesTax: true},
+			unitPrice: 12,
+			quantity:  1,
+			want:      TaxBreakdown{Net: 10, Tax: 2, Gross: 12},
+		},
+		{
+			name:      "category rate when the product has none",
+			product:   models.Product{Category: &models.ProductCategory{TaxRate: 0.1}},
+			unitPrice: 19.99,
+			quantity:  1,
+			want:      TaxBreakdown{Net: 19.99, Tax: 2, Gross: 21.99},
+		},
+		{
+			name:      "the product's rate over its category's",
+			product:   models.Product{TaxRate: rate(0), Category: &models.ProductCategory{TaxRate: 0.1}},
+			unitPrice: 5,
+			quantity:  2,
+			want:      TaxBreakdown{Net: 10, Tax: 0, Gross: 10},
+		},
+		{
+			name:      "no rate at all",
+			product:   models.Product{},
+			unitPrice: 7.5,
+			quantity:  2,
+			want:      TaxBreakdown{Net: 15, Tax: 0, Gross: 15},
+		},
+		{
+			name:      "rounded to cents",
+			product:   models.Product{TaxRate: rate(0.0725), PriceIncludesTax: true},
+			unitPrice: 9.99,
+			quantity:  1,
+			want:      TaxBreakdown{Net: 9.31, Tax: 0.68, Gross: 9.99},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := service.Calculate(&tt.product, tt.unitPrice, tt.quantity); got != tt.want {
+				t.Errorf("Calculate = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
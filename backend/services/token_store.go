@@ -0,0 +1,20 @@
+package services
+
+import (
+	"context"
+	"time"
+)
+
+// TokenStore remembers signed tokens revoked before their expiry, by jti.
+// A revoked jti only needs remembering for ttl, until the token would have
+// expired anyway.
+type TokenStore interface {
+	Revoke(ctx context.Context, jti string, ttl time.Duration) error
+	IsRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// expiredTokenPruner is implemented by token stores that do not expire
+// their records by themselves.
+type expiredTokenPruner interface {
+	DeleteExpired(ctx context.Context) (int64, error)
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+	"github.com/spf13/viper"
+)
+
+// mockTokenStore keeps revoked jtis in memory with the ttl they were
+// revoked for.
+type mockTokenStore struct {
+	revoked map[string]time.Duration
+	err     error
+}
+
+func (m *mockTokenStore) Revoke(ctx context.Context, jti string, ttl time.Duration) error {
+	m.revoked[jti] = ttl
+	return nil
+}
+
+func (m *mockTokenStore) IsRevoked(ctx context.Context, jti string) (bool, error) {
+	if m.err != nil {
+		return false, m.err
+	}
+	_, ok := m.revoked[jti]
+	return ok, nil
+}
+
+// signTestToken signs an access token with the claims, on top of those
+// every access token has.
+func signTestToken(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	all := jwt.MapClaims{
+		"user_id": uuid.NewString(),
+		"email":   "user@example.com",
+		"role":    "customer",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range claims {
+		all[name] = value
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, all).SignedString([]byte(viper.GetString("auth.jwt_secret")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// Logging out revokes the access token's jti until the token expires, after
+// which ValidateToken rejects it.
+func TestLogoutRevokesAccessToken(t *testing.T) {
+	viper.Set("auth.jwt_secret", "test-secret")
+	t.Cleanup(func() { viper.Set("auth.jwt_secret", nil) })
+	store := &mockTokenStore{revoked: map[string]time.Duration{}}
+	service := NewAuthService(nil, nil, nil, nil, store, nil, nil)
+	ctx := context.Background()
+
+	jti := uuid.NewString()
+	token := signTestToken(t, jwt.MapClaims{"jti": jti})
+	if _, err := service.ValidateToken(ctx, token); err != nil {
+		t.Fatalf("before logout: %v", err)
+	}
+
+	if err := service.Logout(ctx, token); err != nil {
+		t.Fatal(err)
+	}
+	ttl, ok := store.revoked[jti]
+	if !ok {
+		t.Fatalf("jti %s was not revoked", jti)
+	}
+	if ttl <= 0 || ttl > time.Hour {
+		t.Errorf("revoked for %v, want until the token expires in an hour", ttl)
+	}
+
+	if _, err := service.ValidateToken(ctx, token); err != ErrInvalidToken {
+		t.Errorf("after logout: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestLogoutIgnoresTokensThatNeedNoRevoking(t *testing.T) {
+	viper.Set("auth.jwt_secret", "test-secret")
+	t.Cleanup(func() { viper.Set("auth.jwt_secret", nil) })
+	store := &mockTokenStore{revoked: map[string]time.Duration{}}
+	service := NewAuthService(nil, nil, nil, nil, store, nil, nil)
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"malformed", "not-a-token"},
+		{"expired", signTestToken(t, jwt.MapClaims{"jti": uuid.NewString(), "exp": time.Now().Add(-time.Minute).Unix()})},
+		{"without jti", signTestToken(t, nil)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := service.Logout(context.Background(), tt.token); err != nil {
+				t.Errorf("Logout = %v, want nil", err)
+			}
+		})
+	}
+	if len(store.revoked) != 0 {
+		t.Errorf("revoked %v, want nothing", store.revoked)
+	}
+}
+
+// A token cannot be accepted when the store cannot tell whether it was
+// revoked.
+func TestValidateTokenFailsWhenStoreFails(t *testing.T) {
+	viper.Set("auth.jwt_secret", "test-secret")
+	t.Cleanup(func() { viper.Set("auth.jwt_secret", nil) })
+	storeErr := errors.New("store unavailable")
+	service := NewAuthService(nil, nil, nil, nil, &mockTokenStore{err: storeErr}, nil, nil)
+
+	token := signTestToken(t, jwt.MapClaims{"jti": uuid.NewString()})
+	if _, err := service.ValidateToken(context.Background(), token); !errors.Is(err, storeErr) {
+		t.Errorf("err = %v, want the store's error", err)
+	}
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// MinUserSearchLength keeps very short queries, which match nearly every
+// trigram, from scanning the whole users table.
+const MinUserSearchLength = 3
+
+var (
+	ErrSearchTooShort = errors.New("search query is too short")
+	ErrInvalidRole    = errors.New("invalid role")
+	// ErrInvalidAvatarURL is returned for avatar URLs that are not HTTPS or
+	// not on an allowed host.
+	ErrInvalidAvatarURL = errors.New("avatar URL must be an HTTPS URL on an allowed host")
+	// ErrLastAdmin is returned when demoting the only remaining admin.
+	ErrLastAdmin = repositories.ErrLastAdmin
+)
+
+// userRoles are the roles a user can hold.
+var userRoles = map[string]bool{"admin": true, "contributor": true, "customer": true}
+
+// maxAvatarURLLength is the size of the avatar_url column.
+const maxAvatarURLLength = 255
+
+type UserService struct {
+	userRepo    *repositories.UserRepository
+	avatarHosts []string
+}
+
+// NewUserService creates the service. Avatars may only be served from
+// avatarHosts or their subdomains.
+func NewUserService(userRepo *repositories.UserRepository, avatarHosts []string) *UserService {
+	return &UserService{userRepo: userRepo, avatarHosts: avatarHosts}
+}
+
+// List returns a page of users. A non-empty search fuzzy-matches names and
+// emails and must be at least MinUserSearchLength characters long.
+func (s *UserService) List(ctx context.Context, search string, limit, offset int) ([]*models.User, int, error) {
+	if search != "" && len([]rune(search)) < MinUserSearchLength {
+		return nil, 0, ErrSearchTooShort
+	}
+
+	return s.userRepo.List(ctx, search, limit, offset)
+}
+
+// FindByEmail looks a user up by exact email address.
+func (s *UserService) FindByEmail(ctx context.Context, email string) (*models.User, error) {
+	return s.userRepo.GetByEmail(ctx, email)
+}
+
+// UpdateRole gives the target user a new role on behalf of the actor and
+// records the change in the audit log. Demoting the last admin fails with
+// ErrLastAdmin, since nobody could manage the site afterwards.
+func (s *UserService) UpdateRole(ctx context.Context, actorID, targetID uuid.UUID, newRole string) error {
+	if !userRoles[newRole] {
+		return ErrInvalidRole
+	}
+
+	return s.userRepo.UpdateRole(ctx, targetID, newRole, actorID)
+}
+
+// UpdateAvatar sets the user's avatar. The URL must use HTTPS and point to
+// one of the allowed hosts; an empty URL removes the avatar, so the
+// Gravatar fallback is shown instead.
+func (s *UserService) UpdateAvatar(ctx context.Context, userID uuid.UUID, avatarURL string) error {
+	avatarURL = strings.TrimSpace(avatarURL)
+	if avatarURL != "" && !s.validAvatarURL(avatarURL) {
+		return ErrInvalidAvatarURL
+	}
+
+	return s.userRepo.UpdateAvatar(ctx, userID, avatarURL)
+}
+
+func (s *UserService) validAvatarURL(raw string) bool {
+	if len(raw) > maxAvatarURLLength {
+		return false
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.User != nil {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range s.avatarHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,246 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// Outbound webhook events.
+const (
+	WebhookEventOrderCreated  = "order.created"
+	WebhookEventPostPublished = "post.published"
+)
+
+// WebhookEvents lists the events endpoints can subscribe to.
+var WebhookEvents = []string{WebhookEventOrderCreated, WebhookEventPostPublished}
+
+const (
+	// webhookMaxAttempts is the first delivery attempt and up to three
+	// retries, webhookRetryBackoff apart at first and doubling after each.
+	webhookMaxAttempts  = 4
+	webhookRetryBackoff = time.Second
+)
+
+// webhookEnvelope is the body of every outbound webhook. ID is the same on
+// every retry, so receivers can skip events they already handled.
+type webhookEnvelope struct {
+	ID        uuid.UUID   `json:"id"`
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// WebhookDispatcher POSTs events to the endpoints subscribed to them. Each
+// request carries an X-Signature-256 header computed with the endpoint's
+// secret. Failed attempts are retried with exponential backoff and every
+// attempt is logged. Endpoints whose circuit is open are skipped. Without
+// a cipher, webhooks are disabled and Dispatch does nothing.
+type WebhookDispatcher struct {
+	endpointRepo *repositories.WebhookEndpointRepository
+	deliveryRepo *repositories.WebhookDeliveryRepository
+	cipher       *SecretCipher
+	breaker      *CircuitBreaker
+	signer       WebhookSigner
+	client       *http.Client
+	backoff      time.Duration
+	inFlight     sync.WaitGroup
+}
+
+func NewWebhookDispatcher(endpointRepo *repositories.WebhookEndpointRepository, deliveryRepo *repositories.WebhookDeliveryRepository, cipher *SecretCipher, breaker *CircuitBreaker) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		endpointRepo: endpointRepo,
+		deliveryRepo: deliveryRepo,
+		cipher:       cipher,
+		breaker:      breaker,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		backoff:      webhookRetryBackoff,
+	}
+}
+
+// Dispatch sends the event to every subscribed endpoint in the background,
+// each in its own goroutine, so a slow endpoint does not hold up the
+// caller or the other endpoints. Only looking up the endpoints and
+// encoding the payload can fail; delivery failures are logged.
+func (d *WebhookDispatcher) Dispatch(ctx context.Context, event string, data interface{}) error {
+	if d.cipher == nil {
+		return nil
+	}
+
+	endpoints, err := d.endpointRepo.ListActiveForEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+	if len(endpoints) == 0 {
+		return nil
+	}
+
+	envelope := webhookEnvelope{ID: uuid.New(), Event: event, CreatedAt: time.Now().UTC(), Data: data}
+	payload, err := json.Marshal(envelope)
+	if err != nil {
+		return err
+	}
+
+	// Deliveries outlive the request that triggered them
+	ctx = context.WithoutCancel(ctx)
+	for _, endpoint := range endpoints {
+		d.inFlight.Add(1)
+		go func(endpoint *models.WebhookEndpoint) {
+			defer d.inFlight.Done()
+			if err := d.deliver(ctx, endpoint, envelope.ID, event, payload); err != nil {
+				log.Printf("Failed to deliver %s webhook to %s: %v\n", event, endpoint.URL, err)
+			}
+		}(endpoint)
+	}
+
+	return nil
+}
+
+// Redeliver sends the claimed dead letters to the endpoint again in the
+// background, one after the other, each with the full set of attempts. A
+// dead letter that cannot be sent because the endpoint's circuit is open is
+// released, so it can be retried later.
+func (d *WebhookDispatcher) Redeliver(ctx context.Context, endpoint *models.WebhookEndpoint, deadLetters []*models.WebhookDelivery) {
+	ctx = context.WithoutCancel(ctx)
+	d.inFlight.Add(1)
+	go func() {
+		defer d.inFlight.Done()
+		for _, deadLetter := range deadLetters {
+			err := d.deliver(ctx, endpoint, deadLetter.EventID, deadLetter.Event, deadLetter.Payload)
+			if errors.Is(err, ErrCircuitOpen) {
+				if err := d.deliveryRepo.ReleaseDeadLetter(ctx, deadLetter.ID); err != nil {
+					log.Printf("Failed to release webhook dead letter %s: %v\n", deadLetter.ID, err)
+				}
+				continue
+			}
+			if err != nil {
+				log.Printf("Failed to redeliver %s webhook to %s: %v\n", deadLetter.Event, endpoint.URL, err)
+			}
+		}
+	}()
+}
+
+// Wait blocks until every delivery in progress has finished or ctx is
+// done, in which case ctx.Err() is returned.
+func (d *WebhookDispatcher) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		d.inFlight.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// deliver sends the payload unless the endpoint's circuit is open, retrying
+// failed attempts, and records the outcome on the circuit.
+func (d *WebhookDispatcher) deliver(ctx context.Context, endpoint *models.WebhookEndpoint, eventID uuid.UUID, event string, payload []byte) error {
+	ok, err := d.breaker.CanAttempt(ctx, endpoint.ID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrCircuitOpen
+	}
+
+	var sendErr error
+	for attempt := 1; attempt <= webhookMaxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(d.backoff << (attempt - 2))
+		}
+
+		start := time.Now()
+		var statusCode int
+		statusCode, sendErr = d.send(ctx, endpoint, event, payload)
+		// The last failed attempt keeps the payload, as a dead letter
+		var deadLetter []byte
+		if sendErr != nil && attempt == webhookMaxAttempts {
+			deadLetter = payload
+		}
+		d.recordAttempt(ctx, endpoint, eventID, event, attempt, statusCode, sendErr, time.Since(start), deadLetter)
+		if sendErr == nil {
+			break
+		}
+	}
+
+	if sendErr != nil {
+		err = d.breaker.RecordFailure(ctx, endpoint.ID)
+	} else {
+		err = d.breaker.RecordSuccess(ctx, endpoint.ID)
+	}
+	if err != nil {
+		log.Printf("Failed to update circuit of webhook endpoint %s: %v\n", endpoint.ID, err)
+	}
+
+	return sendErr
+}
+
+// recordAttempt adds an attempt to the delivery log. statusCode is 0 when
+// no response came back; deadLetter is the payload when this was the last
+// attempt and it failed.
+func (d *WebhookDispatcher) recordAttempt(ctx context.Context, endpoint *models.WebhookEndpoint, eventID uuid.UUID, event string, attempt, statusCode int, sendErr error, duration time.Duration, deadLetter []byte) {
+	delivery := &models.WebhookDelivery{
+		EndpointID: endpoint.ID,
+		EventID:    eventID,
+		Event:      event,
+		Attempt:    attempt,
+		DurationMs: int(duration.Milliseconds()),
+		Payload:    deadLetter,
+	}
+	if statusCode != 0 {
+		delivery.StatusCode = &statusCode
+	}
+	if sendErr != nil {
+		delivery.Error = sendErr.Error()
+	}
+
+	// The log is for debugging only, so failing to write it does not fail
+	// the delivery
+	if err := d.deliveryRepo.Create(ctx, delivery); err != nil {
+		log.Printf("Failed to log delivery to webhook endpoint %s: %v\n", endpoint.ID, err)
+	}
+}
+
+// send makes one delivery attempt and returns the response's status code,
+// or 0 when there was no response.
+func (d *WebhookDispatcher) send(ctx context.Context, endpoint *models.WebhookEndpoint, event string, payload []byte) (int, error) {
+	secret, err := d.cipher.Decrypt(endpoint.SecretEncrypted)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Webhook-Event", event)
+	req.Header.Set(WebhookSignatureHeader, d.signer.Sign(payload, secret))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+
+	return resp.StatusCode, nil
+}
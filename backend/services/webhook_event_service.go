@@ -0,0 +1,80 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/adrianmcmains/integrated-site/repositories"
+	"github.com/adrianmcmains/integrated-site/services/payment"
+)
+
+// processedWebhookRetention is how long handled event IDs are remembered.
+// Providers stop redelivering well within it.
+const processedWebhookRetention = 7 * 24 * time.Hour
+
+var ErrInvalidWebhookEvent = errors.New("invalid webhook event")
+
+// WebhookEventService handles inbound provider webhooks, processing each
+// event at most once however often it is delivered.
+type WebhookEventService struct {
+	eventRepo    *repositories.WebhookEventRepository
+	orderService *OrderService
+	now          func() time.Time
+}
+
+func NewWebhookEventService(eventRepo *repositories.WebhookEventRepository, orderService *OrderService) *WebhookEventService {
+	return &WebhookEventService{
+		eventRepo:    eventRepo,
+		orderService: orderService,
+		now:          time.Now,
+	}
+}
+
+// HandleOnce runs fn for the provider's event unless it has been processed
+// already, and reports whether it ran. Every inbound webhook goes through
+// it.
+func (s *WebhookEventService) HandleOnce(ctx context.Context, provider, eventID string, fn func(ctx context.Context) error) (bool, error) {
+	if eventID == "" {
+		return false, ErrInvalidWebhookEvent
+	}
+	return s.eventRepo.ProcessOnce(ctx, provider, eventID, fn)
+}
+
+// HandleStripeEvent applies a Stripe event to the order its payment intent
+// belongs to. Event types that do not concern payments are acknowledged and
+// ignored.
+func (s *WebhookEventService) HandleStripeEvent(ctx context.Context, event *payment.StripeEvent) (bool, error) {
+	return s.HandleOnce(ctx, "stripe", event.ID, func(ctx context.Context) error {
+		var paymentStatus string
+		switch event.Type {
+		case "payment_intent.succeeded":
+			paymentStatus = "paid"
+		case "payment_intent.payment_failed":
+			paymentStatus = "failed"
+		default:
+			return nil
+		}
+
+		var intent payment.StripePaymentIntent
+		if err := json.Unmarshal(event.Data.Object, &intent); err != nil {
+			return ErrInvalidWebhookEvent
+		}
+		orderID, ok := intent.OrderID()
+		if !ok {
+			// Not one of ours, e.g. created from the Stripe dashboard
+			log.Printf("Stripe event %s: payment intent %s has no order_id\n", event.ID, intent.ID)
+			return nil
+		}
+
+		return s.orderService.UpdatePaymentStatus(ctx, orderID, paymentStatus)
+	})
+}
+
+// PruneProcessed forgets the events handled more than a week ago.
+func (s *WebhookEventService) PruneProcessed(ctx context.Context) error {
+	_, err := s.eventRepo.DeleteProcessedBefore(ctx, s.now().Add(-processedWebhookRetention))
+	return err
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+const (
+	// webhookDeliveryRetention is how long delivery attempts are kept.
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+	// webhookRetryAllLimit caps the dead letters one retry-all call sends
+	// again, so a long outage is not replayed all at once.
+	webhookRetryAllLimit = 100
+)
+
+var (
+	ErrWebhookEndpointNotFound = repositories.ErrWebhookEndpointNotFound
+	ErrUnknownWebhookEvent     = errors.New("unknown webhook event")
+	ErrWebhookSecretRequired   = errors.New("a secret is required to register a webhook endpoint")
+	ErrWebhooksDisabled        = errors.New("webhooks are disabled: no webhook secret key is configured")
+	ErrDeadLetterNotFound      = errors.New("dead letter not found")
+	ErrWebhookEndpointInactive = errors.New("webhook endpoint is inactive")
+)
+
+// WebhookService manages the endpoints that outbound webhooks are sent to,
+// their delivery log and their dead letters. Secrets are stored encrypted
+// with the cipher; without one, endpoints cannot be registered or given a
+// new secret and dead letters cannot be retried.
+type WebhookService struct {
+	endpointRepo *repositories.WebhookEndpointRepository
+	deliveryRepo *repositories.WebhookDeliveryRepository
+	cipher       *SecretCipher
+	dispatcher   *WebhookDispatcher
+	now          func() time.Time
+}
+
+func NewWebhookService(endpointRepo *repositories.WebhookEndpointRepository, deliveryRepo *repositories.WebhookDeliveryRepository, cipher *SecretCipher, dispatcher *WebhookDispatcher) *WebhookService {
+	return &WebhookService{
+		endpointRepo: endpointRepo,
+		deliveryRepo: deliveryRepo,
+		cipher:       cipher,
+		dispatcher:   dispatcher,
+		now:          time.Now,
+	}
+}
+
+// List returns every endpoint, oldest first.
+func (s *WebhookService) List(ctx context.Context) ([]*models.WebhookEndpoint, error) {
+	return s.endpointRepo.List(ctx)
+}
+
+func (s *WebhookService) GetByID(ctx context.Context, id uuid.UUID) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.endpointRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint == nil {
+		return nil, ErrWebhookEndpointNotFound
+	}
+	return endpoint, nil
+}
+
+// Create registers an endpoint, active unless the request says otherwise.
+func (s *WebhookService) Create(ctx context.Context, req *models.WebhookEndpointRequest) (*models.WebhookEndpoint, error) {
+	if req.Secret == "" {
+		return nil, ErrWebhookSecretRequired
+	}
+
+	endpoint := &models.WebhookEndpoint{IsActive: true}
+	if err := s.applyRequest(endpoint, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.endpointRepo.Create(ctx, endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+// Update replaces the endpoint's URL and events, and its secret and active
+// flag when the request has them.
+func (s *WebhookService) Update(ctx context.Context, id uuid.UUID, req *models.WebhookEndpointRequest) (*models.WebhookEndpoint, error) {
+	endpoint, err := s.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.applyRequest(endpoint, req); err != nil {
+		return nil, err
+	}
+
+	if err := s.endpointRepo.Update(ctx, endpoint); err != nil {
+		return nil, err
+	}
+	return endpoint, nil
+}
+
+func (s *WebhookService) Delete(ctx context.Context, id uuid.UUID) error {
+	return s.endpointRepo.Delete(ctx, id)
+}
+
+// ListDeliveries returns a page of the endpoint's delivery attempts, most
+// recent first.
+func (s *WebhookService) ListDeliveries(ctx context.Context, id uuid.UUID, limit, offset int) ([]*models.WebhookDelivery, int, error) {
+	if _, err := s.GetByID(ctx, id); err != nil {
+		return nil, 0, err
+	}
+	return s.deliveryRepo.ListForEndpoint(ctx, id, limit, offset)
+}
+
+// ListDeadLetters returns a page of the deliveries that failed every
+// attempt and have not been retried, most recent first.
+func (s *WebhookService) ListDeadLetters(ctx context.Context, limit, offset int) ([]*models.WebhookDelivery, int, error) {
+	return s.deliveryRepo.ListDeadLetters(ctx, limit, offset)
+}
+
+// RetryDeadLetter sends the dead letter to its endpoint again in the
+// background, starting over from the first attempt. Retrying a dead letter
+// that is already being retried does nothing, so it is never sent twice.
+// If its endpoint is gone or inactive the dead letter is left to be
+// retried later.
+func (s *WebhookService) RetryDeadLetter(ctx context.Context, id uuid.UUID) error {
+	if s.cipher == nil {
+		return ErrWebhooksDisabled
+	}
+
+	deadLetter, err := s.deliveryRepo.ClaimDeadLetter(ctx, id)
+	if err != nil {
+		return err
+	}
+	if deadLetter == nil {
+		delivery, err := s.deliveryRepo.GetByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if delivery == nil || delivery.Payload == nil {
+			return ErrDeadLetterNotFound
+		}
+		return nil
+	}
+
+	endpoint, err := s.endpointRepo.GetByID(ctx, deadLetter.EndpointID)
+	switch {
+	case err != nil:
+		return s.releaseDeadLetter(ctx, id, err)
+	case endpoint == nil:
+		return s.releaseDeadLetter(ctx, id, ErrWebhookEndpointNotFound)
+	case !endpoint.IsActive:
+		return s.releaseDeadLetter(ctx, id, ErrWebhookEndpointInactive)
+	}
+	s.dispatcher.Redeliver(ctx, endpoint, []*models.WebhookDelivery{deadLetter})
+	return nil
+}
+
+// releaseDeadLetter undoes the claim on a dead letter that could not be
+// retried and returns cause.
+func (s *WebhookService) releaseDeadLetter(ctx context.Context, id uuid.UUID, cause error) error {
+	if err := s.deliveryRepo.ReleaseDeadLetter(ctx, id); err != nil {
+		log.Printf("Failed to release dead letter %s: %v", id, err)
+	}
+	return cause
+}
+
+// RetryAllDeadLetters sends up to 100 of the endpoint's dead letters again,
+// oldest first, as RetryDeadLetter does, and returns how many.
+func (s *WebhookService) RetryAllDeadLetters(ctx context.Context, endpointID uuid.UUID) (int, error) {
+	if s.cipher == nil {
+		return 0, ErrWebhooksDisabled
+	}
+
+	endpoint, err := s.GetByID(ctx, endpointID)
+	if err != nil {
+		return 0, err
+	}
+	if !endpoint.IsActive {
+		return 0, ErrWebhookEndpointInactive
+	}
+
+	deadLetters, err := s.deliveryRepo.ClaimDeadLettersForEndpoint(ctx, endpointID, webhookRetryAllLimit)
+	if err != nil {
+		return 0, err
+	}
+	if len(deadLetters) > 0 {
+		s.dispatcher.Redeliver(ctx, endpoint, deadLetters)
+	}
+	return len(deadLetters), nil
+}
+
+// PruneDeliveries forgets the delivery attempts made more than 30 days ago,
+// except dead letters that were never retried.
+func (s *WebhookService) PruneDeliveries(ctx context.Context) error {
+	_, err := s.deliveryRepo.DeleteBefore(ctx, s.now().Add(-webhookDeliveryRetention))
+	return err
+}
+
+// applyRequest sets the endpoint's fields from the request, encrypting a
+// new secret.
+func (s *WebhookService) applyRequest(endpoint *models.WebhookEndpoint, req *models.WebhookEndpointRequest) error {
+	for _, event := range req.Events {
+		if !isWebhookEvent(event) {
+			return fmt.Errorf("%w: %q", ErrUnknownWebhookEvent, event)
+		}
+	}
+
+	if req.Secret != "" {
+		if s.cipher == nil {
+			return ErrWebhooksDisabled
+		}
+		encrypted, err := s.cipher.Encrypt(req.Secret)
+		if err != nil {
+			return err
+		}
+		endpoint.SecretEncrypted = encrypted
+	}
+
+	endpoint.URL = req.URL
+	endpoint.Events = req.Events
+	if req.IsActive != nil {
+		endpoint.IsActive = *req.IsActive
+	}
+	return nil
+}
+
+func isWebhookEvent(event string) bool {
+	for _, known := range WebhookEvents {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
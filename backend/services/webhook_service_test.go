@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/adrianmcmains/integrated-site/database"
+	"github.com/adrianmcmains/integrated-site/database/dbtest"
+	"github.com/adrianmcmains/integrated-site/models"
+	"github.com/adrianmcmains/integrated-site/repositories"
+)
+
+// Dead letters of an inactive endpoint are not sent, and stay waiting to
+// be retried once the endpoint is active again.
+func TestRetryDeadLetterToInactiveEndpoint(t *testing.T) {
+	pool := dbtest.Pool(t)
+	ctx := context.Background()
+	endpointRepo := repositories.NewWebhookEndpointRepository(pool)
+	deliveryRepo := repositories.NewWebhookDeliveryRepository(pool)
+	// The dispatcher is left out: nothing may be sent
+	service := NewWebhookService(endpointRepo, deliveryRepo, testSecretCipher(t), nil)
+
+	endpoint := &models.WebhookEndpoint{
+		URL:             "https://hooks.example.com/" + dbtest.UniqueName("endpoint"),
+		Events:          []string{"order.created"},
+		SecretEncrypted: []byte("x"),
+	}
+	if err := endpointRepo.Create(ctx, endpoint); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		dbtest.Exec(t, pool, database.Qualify("DELETE FROM {cms}.webhook_endpoints WHERE id = $1"), endpoint.ID)
+	})
+	deadLetter := &models.WebhookDelivery{
+		EndpointID: endpoint.ID,
+		EventID:    uuid.New(),
+		Event:      "order.created",
+		Attempt:    5,
+		Error:      "connection refused",
+		Payload:    []byte(`{"id":"1"}`),
+	}
+	if err := deliveryRepo.Create(ctx, deadLetter); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.RetryDeadLetter(ctx, deadLetter.ID); !errors.Is(err, ErrWebhookEndpointInactive) {
+		t.Errorf("RetryDeadLetter: err = %v, want ErrWebhookEndpointInactive", err)
+	}
+	if _, err := service.RetryAllDeadLetters(ctx, endpoint.ID); !errors.Is(err, ErrWebhookEndpointInactive) {
+		t.Errorf("RetryAllDeadLetters: err = %v, want ErrWebhookEndpointInactive", err)
+	}
+
+	got, err := deliveryRepo.GetByID(ctx, deadLetter.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got == nil || got.RetriedAt != nil {
+		t.Errorf("dead letter after the failed retry = %+v, want it still waiting", got)
+	}
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// WebhookSignatureHeader carries the payload signature on outbound webhooks.
+const WebhookSignatureHeader = "X-Signature-256"
+
+// WebhookSigner signs webhook payloads the way GitHub does: an HMAC-SHA256
+// of the raw body, hex encoded and prefixed with "sha256=".
+type WebhookSigner struct{}
+
+func (WebhookSigner) Sign(payload []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature matches the payload, comparing in
+// constant time.
+func (s WebhookSigner) Verify(payload []byte, secret, signature string) bool {
+	return hmac.Equal([]byte(s.Sign(payload, secret)), []byte(signature))
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/adrianmcmains/integrated-site/models"
+)
+
+func TestWebhookSignerRoundTrip(t *testing.T) {
+	var signer WebhookSigner
+	payload := []byte(`{"event":"order.created","data":{"id":"42"}}`)
+	secret := "endpoint-secret"
+
+	signature := signer.Sign(payload, secret)
+	// The hex HMAC-SHA256 of the payload with the secret, as receivers
+	// compute it
+	if want := "sha256=24cbca07c06b03b702f7939a0ffdadcc54870f527293472a5faf9a5f752bdf13"; signature != want {
+		t.Fatalf("Sign = %q, want %q", signature, want)
+	}
+	if !signer.Verify(payload, secret, signature) {
+		t.Error("Verify rejected the payload's own signature")
+	}
+
+	tampered := bytes.Replace(payload, []byte("42"), []byte("43"), 1)
+	if signer.Verify(tampered, secret, signature) {
+		t.Error("Verify accepted a tampered payload")
+	}
+	if signer.Verify(payload, "other-secret", signature) {
+		t.Error("Verify accepted a signature made with another secret")
+	}
+	if signer.Verify(payload, secret, "sha256=") {
+		t.Error("Verify accepted an empty signature")
+	}
+}
+
+func testSecretCipher(t *testing.T) *SecretCipher {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatal(err)
+	}
+	cipher, err := NewSecretCipher(base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cipher
+}
+
+func TestSecretCipherRoundTrip(t *testing.T) {
+	cipher := testSecretCipher(t)
+
+	ciphertext, err := cipher.Encrypt("endpoint-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(ciphertext, []byte("endpoint-secret")) {
+		t.Fatal("ciphertext contains the secret")
+	}
+
+	secret, err := cipher.Decrypt(ciphertext)
+	if err != nil || secret != "endpoint-secret" {
+		t.Fatalf("Decrypt = %q, %v; want the secret back", secret, err)
+	}
+
+	ciphertext[len(ciphertext)-1] ^= 1
+	if _, err := cipher.Decrypt(ciphertext); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Errorf("Decrypt of a tampered ciphertext: err = %v, want ErrInvalidCiphertext", err)
+	}
+	if _, err := testSecretCipher(t).Decrypt(ciphertext[:len(ciphertext)-1]); !errors.Is(err, ErrInvalidCiphertext) {
+		t.Errorf("Decrypt with another key: err = %v, want ErrInvalidCiphertext", err)
+	}
+
+	if _, err := NewSecretCipher(base64.StdEncoding.EncodeToString(make([]byte, 16))); err == nil {
+		t.Error("NewSecretCipher accepted a 16-byte key")
+	}
+}
+
+// The receiving end can check the signature of what the dispatcher sends
+// with the endpoint's secret.
+func TestWebhookDispatcherSignsRequests(t *testing.T) {
+	var signer WebhookSigner
+	var received []byte
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(WebhookSignatureHeader)
+	}))
+	defer server.Close()
+
+	cipher := testSecretCipher(t)
+	encrypted, err := cipher.Encrypt("endpoint-secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher := &WebhookDispatcher{cipher: cipher, client: server.Client()}
+	endpoint := &models.WebhookEndpoint{URL: server.URL, SecretEncrypted: encrypted}
+	payload := []byte(`{"event":"order.created"}`)
+
+	status, err := dispatcher.send(context.Background(), endpoint, "order.created", payload)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("send = %d, %v", status, err)
+	}
+	if !bytes.Equal(received, payload) {
+		t.Fatalf("received %q, want %q", received, payload)
+	}
+	if !signer.Verify(received, "endpoint-secret", signature) {
+		t.Errorf("signature %q does not verify with the endpoint's secret", signature)
+	}
+}
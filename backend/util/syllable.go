@@ -0,0 +1,54 @@
+package util
+
+import (
+	"strings"
+	"unicode"
+)
+
+// CountSyllables estimates the syllables in an English word by counting
+// vowel groups after dropping silent endings. It is a heuristic and will be
+// off by one on some irregular words.
+func CountSyllables(word string) int {
+	word = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) {
+			return unicode.ToLower(r)
+		}
+		return -1
+	}, word)
+
+	if word == "" {
+		return 0
+	}
+	if len(word) <= 3 {
+		return 1
+	}
+
+	// Silent endings: "-es" and "-ed" (but not "-ted"/"-ded"), and a final "e"
+	// that is not part of "-le"
+	switch {
+	case strings.HasSuffix(word, "es") || strings.HasSuffix(word, "ed"):
+		if !strings.HasSuffix(word, "ted") && !strings.HasSuffix(word, "ded") {
+			word = word[:len(word)-2]
+		}
+	case strings.HasSuffix(word, "e") && !strings.HasSuffix(word, "le"):
+		word = word[:len(word)-1]
+	}
+
+	// A leading "y" is a consonant
+	word = strings.TrimPrefix(word, "y")
+
+	count := 0
+	inVowelGroup := false
+	for _, r := range word {
+		isVowel := strings.ContainsRune("aeiouy", r)
+		if isVowel && !inVowelGroup {
+			count++
+		}
+		inVowelGroup = isVowel
+	}
+
+	if count == 0 {
+		return 1
+	}
+	return count
+}
@@ -0,0 +1,27 @@
+package util
+
+import "testing"
+
+func TestCountSyllables(t *testing.T) {
+	tests := []struct {
+		word string
+		want int
+	}{
+		{"cat", 1},
+		{"Happy", 2},
+		{"barked", 1},
+		{"wanted", 2},
+		{"table", 2},
+		{"make", 1},
+		{"little", 2},
+		{"yellow", 2},
+		{"beautiful", 3},
+		{"mat.", 1},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := CountSyllables(tt.word); got != tt.want {
+			t.Errorf("CountSyllables(%q) = %d, want %d", tt.word, got, tt.want)
+		}
+	}
+}
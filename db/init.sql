@@ -5,11 +5,14 @@ CREATE DATABASE integrated_site;
 -- Create extensions
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 CREATE EXTENSION IF NOT EXISTS "pgcrypto";
+CREATE EXTENSION IF NOT EXISTS "pg_trgm";
+CREATE EXTENSION IF NOT EXISTS "fuzzystrmatch";
 
 -- Create schemas
 CREATE SCHEMA blog;
 CREATE SCHEMA shop;
 CREATE SCHEMA auth;
+CREATE SCHEMA cms;
 
 -- User management (shared)
 CREATE TABLE auth.users (
@@ -19,10 +22,95 @@ CREATE TABLE auth.users (
     full_name VARCHAR(255) NOT NULL,
     role VARCHAR(50) NOT NULL CHECK (role IN ('admin', 'customer', 'contributor')),
     avatar_url VARCHAR(255),
+    -- Set for users who signed up with an external provider, e.g. 'google'
+    oauth_provider VARCHAR(50),
+    oauth_subject VARCHAR(255),
+    -- Set when the user is deleted; the row is kept so they can be restored
+    deleted_at TIMESTAMP WITH TIME ZONE,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+CREATE UNIQUE INDEX idx_user_oauth_subject ON auth.users(oauth_provider, oauth_subject) WHERE oauth_provider IS NOT NULL;
+
+-- Issued refresh tokens, keyed by the token's jti claim. Each refresh uses
+-- up its token and issues the next one in the same family; using a token a
+-- second time revokes the whole family.
+CREATE TABLE auth.refresh_tokens (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    family_id UUID NOT NULL,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    revoked_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_refresh_token_family ON auth.refresh_tokens(family_id);
+
+-- Signed tokens revoked before their expiry, by jti. A row is only needed
+-- until the token would have expired anyway.
+CREATE TABLE auth.revoked_tokens (
+    jti VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_revoked_token_expires_at ON auth.revoked_tokens(expires_at);
+
+-- Password reset links. Only the SHA-256 hash of the emailed token is kept;
+-- a token can be used once, before it expires.
+CREATE TABLE auth.password_reset_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- API keys for programmatic access on a user's behalf. Only the SHA-256
+-- hash of a key is kept. scopes are the permissions the key is limited to;
+-- a key without an expires_at does not expire.
+CREATE TABLE auth.api_keys (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    key_hash VARCHAR(64) NOT NULL UNIQUE,
+    label VARCHAR(100) NOT NULL,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    last_used_at TIMESTAMP WITH TIME ZONE,
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_api_key_user ON auth.api_keys(user_id);
+
+-- OAuth tokens for calling provider APIs on a user's behalf. Tokens are
+-- encrypted with AES-GCM under the application's secret key.
+CREATE TABLE auth.oauth_tokens (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    provider VARCHAR(50) NOT NULL,
+    access_token_enc BYTEA NOT NULL,
+    refresh_token_enc BYTEA,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    expires_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (user_id, provider)
+);
+
+-- Permissions granted to a user on top of their role, named
+-- "<scope>:<action>" (e.g. "orders:export"). They are copied into access
+-- tokens when issued, so a grant takes effect with the user's next token.
+CREATE TABLE auth.user_permissions (
+    user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    permission VARCHAR(100) NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    PRIMARY KEY (user_id, permission)
+);
+
 -- Blog section
 CREATE TABLE blog.authors (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -38,6 +126,7 @@ CREATE TABLE blog.categories (
     name VARCHAR(100) UNIQUE NOT NULL,
     slug VARCHAR(100) UNIQUE NOT NULL,
     description TEXT,
+    parent_id UUID REFERENCES blog.categories(id) ON DELETE RESTRICT,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
@@ -58,8 +147,14 @@ CREATE TABLE blog.posts (
     excerpt TEXT,
     featured_image VARCHAR(255),
     author_id UUID REFERENCES blog.authors(id),
-    status VARCHAR(50) NOT NULL CHECK (status IN ('draft', 'published', 'archived')),
+    -- A scheduled post is published automatically at scheduled_at
+    status VARCHAR(50) NOT NULL CHECK (status IN ('draft', 'scheduled', 'published', 'archived')),
     published_at TIMESTAMP WITH TIME ZONE,
+    scheduled_at TIMESTAMP WITH TIME ZONE,
+    version INTEGER NOT NULL DEFAULT 1,
+    cloned_from UUID REFERENCES blog.posts(id) ON DELETE SET NULL,
+    -- Set when the post is deleted; it keeps its slug so it can be restored
+    deleted_at TIMESTAMP WITH TIME ZONE,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
@@ -82,18 +177,66 @@ CREATE TABLE blog.comments (
     user_id UUID REFERENCES auth.users(id),
     content TEXT NOT NULL,
     parent_id UUID REFERENCES blog.comments(id),
-    status VARCHAR(50) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'spam')),
+    status VARCHAR(50) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'flagged', 'rejected', 'spam')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Reader reports of inappropriate comments. Enough of them flag the comment
+-- for moderation.
+CREATE TABLE blog.comment_reports (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    comment_id UUID NOT NULL REFERENCES blog.comments(id) ON DELETE CASCADE,
+    reporter_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (comment_id, reporter_id)
+);
+
+-- Unsaved edits, one per post and author, kept until the post is saved.
+-- Rows older than a week are pruned.
+CREATE TABLE blog.post_autosaves (
+    post_id UUID NOT NULL REFERENCES blog.posts(id) ON DELETE CASCADE,
+    user_id UUID NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    saved_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (post_id, user_id)
+);
+
+CREATE INDEX idx_post_autosave_saved_at ON blog.post_autosaves(saved_at);
+
+CREATE TABLE blog.search_analytics (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    query_normalized VARCHAR(255) UNIQUE NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    zero_result_count INTEGER NOT NULL DEFAULT 0,
+    last_searched_at TIMESTAMP WITH TIME ZONE NOT NULL,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
 -- E-commerce section
+CREATE TABLE shop.vendors (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID REFERENCES auth.users(id),
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(255) UNIQUE NOT NULL,
+    commission_rate DECIMAL(5, 4) NOT NULL DEFAULT 0 CHECK (commission_rate >= 0 AND commission_rate <= 1),
+    bank_account JSONB,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'active', 'suspended')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
 CREATE TABLE shop.product_categories (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     name VARCHAR(100) UNIQUE NOT NULL,
     slug VARCHAR(100) UNIQUE NOT NULL,
     description TEXT,
     image VARCHAR(255),
+    tax_rate DECIMAL(5, 4) NOT NULL DEFAULT 0 CHECK (tax_rate >= 0 AND tax_rate < 1),
+    parent_id UUID REFERENCES shop.product_categories(id) ON DELETE RESTRICT,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
@@ -108,8 +251,18 @@ CREATE TABLE shop.products (
     sku VARCHAR(100) UNIQUE NOT NULL,
     stock INT NOT NULL DEFAULT 0,
     is_featured BOOLEAN DEFAULT FALSE,
-    images JSONB,
+    type VARCHAR(20) NOT NULL DEFAULT 'physical' CHECK (type IN ('physical', 'digital', 'event')),
+    price_includes_tax BOOLEAN NOT NULL DEFAULT FALSE,
+    tax_rate DECIMAL(5, 4) CHECK (tax_rate >= 0 AND tax_rate < 1),
     category_id UUID REFERENCES shop.product_categories(id),
+    vendor_id UUID REFERENCES shop.vendors(id),
+    status VARCHAR(20) NOT NULL DEFAULT 'published' CHECK (status IN ('draft', 'published')),
+    -- ISO 3166-1 alpha-2 codes of the countries the product ships to; empty ships anywhere
+    shipping_restrictions TEXT[] NOT NULL DEFAULT '{}',
+    -- Bumped by every full edit so concurrent edits are detected
+    version INTEGER NOT NULL DEFAULT 1,
+    -- Set when the product is deleted; ordered products stay for the order history
+    deleted_at TIMESTAMP WITH TIME ZONE,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
@@ -123,6 +276,68 @@ CREATE TABLE shop.product_attributes (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+CREATE TABLE shop.product_images (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_id UUID NOT NULL REFERENCES shop.products(id) ON DELETE CASCADE,
+    url VARCHAR(512) NOT NULL,
+    alt_text VARCHAR(255) NOT NULL DEFAULT '',
+    sort_order INT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Variants of a product, such as sizes and colours, each with its own SKU
+-- and stock. attributes holds e.g. {"size": "M", "color": "red"}; a NULL
+-- price means the product's price.
+CREATE TABLE shop.product_variants (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_id UUID NOT NULL REFERENCES shop.products(id) ON DELETE CASCADE,
+    sku VARCHAR(100) UNIQUE NOT NULL,
+    attributes JSONB NOT NULL DEFAULT '{}',
+    stock INT NOT NULL DEFAULT 0 CHECK (stock >= 0),
+    price DECIMAL(10, 2),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_product_variant_product ON shop.product_variants(product_id);
+
+-- Snapshots of a product's content taken before each change, for rollback.
+-- attributes_json holds the attributes as [{"name": ..., "value": ...}].
+CREATE TABLE shop.product_revisions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    product_id UUID NOT NULL REFERENCES shop.products(id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    description TEXT NOT NULL,
+    price DECIMAL(10, 2) NOT NULL,
+    sale_price DECIMAL(10, 2),
+    attributes_json JSONB NOT NULL DEFAULT '[]',
+    created_by UUID REFERENCES auth.users(id),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_product_revision_product ON shop.product_revisions(product_id, created_at DESC);
+
+CREATE TABLE shop.attribute_definitions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) NOT NULL,
+    allowed_values TEXT[] NOT NULL DEFAULT '{}',
+    is_case_sensitive BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE shop.event_details (
+    product_id UUID PRIMARY KEY REFERENCES shop.products(id) ON DELETE CASCADE,
+    event_date TIMESTAMP WITH TIME ZONE NOT NULL,
+    venue VARCHAR(255) NOT NULL,
+    address TEXT,
+    capacity INT NOT NULL CHECK (capacity >= 0),
+    tickets_sold INT NOT NULL DEFAULT 0 CHECK (tickets_sold >= 0 AND tickets_sold <= capacity),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
 CREATE TABLE shop.customers (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     user_id UUID REFERENCES auth.users(id),
@@ -133,27 +348,168 @@ CREATE TABLE shop.customers (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- Orders are taxed at the most specific rate matching their shipping
+-- address: postcode, then region, then country. Empty region and postcode
+-- match any, and the rate with an empty country is the default.
+CREATE TABLE shop.tax_rates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    country VARCHAR(2) NOT NULL DEFAULT '',
+    region VARCHAR(100) NOT NULL DEFAULT '',
+    postcode VARCHAR(20) NOT NULL DEFAULT '',
+    rate DECIMAL(5, 4) NOT NULL CHECK (rate >= 0 AND rate < 1),
+    is_inclusive BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    UNIQUE (country, region, postcode)
+);
+
+-- Codes are matched case-insensitively. An empty applicable_product_ids
+-- applies the coupon to every product.
+CREATE TABLE shop.coupons (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    code VARCHAR(50) NOT NULL,
+    type VARCHAR(20) NOT NULL CHECK (type IN ('percent', 'fixed')),
+    value DECIMAL(10, 2) NOT NULL CHECK (value > 0 AND (type <> 'percent' OR value <= 100)),
+    min_order_amount DECIMAL(10, 2) CHECK (min_order_amount >= 0),
+    max_uses INT CHECK (max_uses > 0),
+    used_count INT NOT NULL DEFAULT 0 CHECK (used_count >= 0),
+    expires_at TIMESTAMP WITH TIME ZONE,
+    applicable_product_ids UUID[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_coupon_code ON shop.coupons (UPPER(code));
+
 CREATE TABLE shop.orders (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     customer_id UUID REFERENCES shop.customers(id),
-    status VARCHAR(50) NOT NULL CHECK (status IN ('pending', 'processing', 'shipped', 'delivered', 'cancelled')),
+    status VARCHAR(50) NOT NULL CHECK (status IN ('pending', 'confirmed', 'processing', 'shipped', 'delivered', 'cancelled', 'refunded')),
     total_amount DECIMAL(10, 2) NOT NULL,
+    coupon_id UUID REFERENCES shop.coupons(id) ON DELETE SET NULL,
+    discount_amount DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (discount_amount >= 0),
+    tax_amount DECIMAL(10, 2) NOT NULL DEFAULT 0 CHECK (tax_amount >= 0),
+    tax_rate DECIMAL(5, 4) NOT NULL DEFAULT 0,
+    tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE,
     shipping_address JSONB NOT NULL,
     billing_address JSONB NOT NULL,
     payment_method VARCHAR(50) NOT NULL,
     payment_status VARCHAR(50) NOT NULL CHECK (payment_status IN ('pending', 'paid', 'refunded', 'failed')),
     tracking_number VARCHAR(100),
     notes TEXT,
+    -- Whether placing the order took its items out of stock, so that
+    -- cancelling it puts them back
+    stock_taken BOOLEAN NOT NULL DEFAULT FALSE,
+    version INTEGER NOT NULL DEFAULT 1,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- Products sold together. A bundle is priced either at bundle_price or at
+-- its items' total less bundle_discount_percent; exactly one is set.
+CREATE TABLE shop.product_bundles (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(255) NOT NULL,
+    slug VARCHAR(255) UNIQUE NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    bundle_price DECIMAL(10, 2) CHECK (bundle_price >= 0),
+    bundle_discount_percent DECIMAL(5, 2) CHECK (bundle_discount_percent > 0 AND bundle_discount_percent <= 100),
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    CHECK ((bundle_price IS NULL) <> (bundle_discount_percent IS NULL))
+);
+
+CREATE TABLE shop.product_bundle_items (
+    bundle_id UUID NOT NULL REFERENCES shop.product_bundles(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES shop.products(id) ON DELETE RESTRICT,
+    quantity INT NOT NULL DEFAULT 1 CHECK (quantity > 0),
+    PRIMARY KEY (bundle_id, product_id)
+);
+
+-- Each user has at most one cart. unit_price is the price when the item was
+-- added or last changed.
+CREATE TABLE shop.carts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id UUID UNIQUE NOT NULL REFERENCES auth.users(id) ON DELETE CASCADE,
+    coupon_id UUID REFERENCES shop.coupons(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE shop.cart_items (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    cart_id UUID NOT NULL REFERENCES shop.carts(id) ON DELETE CASCADE,
+    product_id UUID NOT NULL REFERENCES shop.products(id) ON DELETE CASCADE,
+    variant_id UUID REFERENCES shop.product_variants(id) ON DELETE CASCADE,
+    quantity INT NOT NULL CHECK (quantity > 0),
+    unit_price DECIMAL(10, 2) NOT NULL,
+    -- Set on the lines added as part of a bundle, which are priced at their
+    -- share of the bundle price
+    bundle_id UUID REFERENCES shop.product_bundles(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- One line per product, variant and bundle
+CREATE UNIQUE INDEX idx_cart_item_line ON shop.cart_items
+    (cart_id, product_id, COALESCE(variant_id, '00000000-0000-0000-0000-000000000000'),
+     COALESCE(bundle_id, '00000000-0000-0000-0000-000000000000'));
+
 CREATE TABLE shop.order_items (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     order_id UUID REFERENCES shop.orders(id) ON DELETE CASCADE,
     product_id UUID REFERENCES shop.products(id),
+    variant_id UUID REFERENCES shop.product_variants(id),
     quantity INT NOT NULL,
     price DECIMAL(10, 2) NOT NULL,
+    vendor_id UUID REFERENCES shop.vendors(id),
+    commission_amount DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE shop.order_tickets (
+    ticket_id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_item_id UUID NOT NULL REFERENCES shop.order_items(id) ON DELETE CASCADE,
+    qr_data TEXT UNIQUE NOT NULL,
+    checked_in_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE shop.flash_sales (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    title VARCHAR(255) NOT NULL,
+    discount_percent DECIMAL(5, 2) NOT NULL CHECK (discount_percent > 0 AND discount_percent <= 100),
+    starts_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    ends_at TIMESTAMP WITH TIME ZONE NOT NULL CHECK (ends_at > starts_at),
+    product_ids UUID[] NOT NULL DEFAULT '{}',
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE shop.payout_batches (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    vendor_id UUID NOT NULL REFERENCES shop.vendors(id),
+    total_amount DECIMAL(10, 2) NOT NULL,
+    reference VARCHAR(50) UNIQUE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'paid', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE shop.vendor_payouts (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    vendor_id UUID NOT NULL REFERENCES shop.vendors(id),
+    batch_id UUID REFERENCES shop.payout_batches(id),
+    order_item_id UUID NOT NULL UNIQUE REFERENCES shop.order_items(id) ON DELETE CASCADE,
+    gross_amount DECIMAL(10, 2) NOT NULL,
+    commission_amount DECIMAL(10, 2) NOT NULL,
+    net_amount DECIMAL(10, 2) NOT NULL,
+    status VARCHAR(50) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'paid')),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
@@ -170,6 +526,38 @@ CREATE TABLE shop.payments (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- Inbound webhook events already handled, so redeliveries are skipped.
+-- Rows older than a week are pruned.
+CREATE TABLE shop.processed_webhook_events (
+    provider VARCHAR(50) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    processed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (provider, event_id)
+);
+
+CREATE INDEX idx_processed_webhook_event_at ON shop.processed_webhook_events(processed_at);
+
+CREATE TABLE shop.order_notes (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    order_id UUID NOT NULL REFERENCES shop.orders(id) ON DELETE CASCADE,
+    author_id UUID REFERENCES auth.users(id),
+    content TEXT NOT NULL,
+    is_internal BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE shop.subscriptions (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    customer_id UUID NOT NULL REFERENCES shop.customers(id),
+    product_id UUID NOT NULL REFERENCES shop.products(id),
+    quantity INT NOT NULL DEFAULT 1 CHECK (quantity > 0),
+    billing_interval VARCHAR(20) NOT NULL CHECK (billing_interval IN ('weekly', 'monthly', 'quarterly')),
+    next_billing_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'paused', 'past_due', 'cancelled')),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
 -- Content management
 CREATE TABLE cms.site_settings (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
@@ -179,6 +567,11 @@ CREATE TABLE cms.site_settings (
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- The server refuses to start without these
+INSERT INTO cms.site_settings (key, value) VALUES
+    ('site_name', '"Integrated Site"'),
+    ('site_url', '"http://localhost:3000"');
+
 CREATE TABLE cms.pages (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     title VARCHAR(255) NOT NULL,
@@ -186,18 +579,198 @@ CREATE TABLE cms.pages (
     content TEXT NOT NULL,
     meta_title VARCHAR(255),
     meta_description TEXT,
+    -- Frontend layout the page is rendered with
+    template VARCHAR(50) NOT NULL DEFAULT 'default',
     status VARCHAR(50) NOT NULL CHECK (status IN ('draft', 'published', 'archived')),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
+-- Uploaded files. variants maps a size name (thumbnail, medium, large) to
+-- the URL of the optimized WebP copy of an image, generated on upload.
+CREATE TABLE cms.media (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    url VARCHAR(512) NOT NULL,
+    storage_key VARCHAR(512) NOT NULL,
+    content_type VARCHAR(100) NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    variants JSONB NOT NULL DEFAULT '{}',
+    -- Private files are stored under the private/ prefix, have no public
+    -- URL and are only handed out as short-lived signed links
+    is_private BOOLEAN NOT NULL DEFAULT FALSE,
+    uploaded_by UUID REFERENCES auth.users(id) ON DELETE SET NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Outgoing email. Sends that fail are retried with backoff until the email
+-- is marked failed for an admin to look at.
+CREATE TABLE cms.email_send_queue (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    to_address VARCHAR(255) NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    body_html TEXT NOT NULL,
+    body_text TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'sent', 'failed')),
+    attempts INT NOT NULL DEFAULT 0,
+    last_error TEXT,
+    scheduled_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    next_retry_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    sent_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Admin overrides of the built-in email templates, by template name.
+-- description lists the variables the template can use.
+CREATE TABLE cms.email_templates (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    name VARCHAR(100) UNIQUE NOT NULL,
+    subject VARCHAR(255) NOT NULL,
+    html_body TEXT NOT NULL,
+    text_body TEXT NOT NULL DEFAULT '',
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Feature flags. A flag that is enabled applies to the users its targeting
+-- rules name and to rollout_percent of everyone else.
+CREATE TABLE cms.feature_flags (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    key VARCHAR(100) UNIQUE NOT NULL,
+    description TEXT,
+    enabled BOOLEAN NOT NULL DEFAULT FALSE,
+    rollout_percent INT NOT NULL DEFAULT 100 CHECK (rollout_percent BETWEEN 0 AND 100),
+    targeting_rules JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE TABLE cms.redirects (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    from_path VARCHAR(512) UNIQUE NOT NULL,
+    to_path VARCHAR(512) NOT NULL,
+    status_code INT NOT NULL DEFAULT 301 CHECK (status_code IN (301, 302, 307, 308)),
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
 -- Create indexes for performance
 CREATE INDEX idx_post_slug ON blog.posts(slug);
 CREATE INDEX idx_post_published_at ON blog.posts(published_at);
+CREATE INDEX idx_post_list_keyset ON blog.posts((COALESCE(published_at, created_at)) DESC, id DESC);
+CREATE INDEX idx_redirect_to_path ON cms.redirects(to_path);
+
+-- Outbound webhooks. The signing secret is encrypted with AES-GCM under
+-- security.webhook_secret_key.
+CREATE TABLE cms.webhook_endpoints (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    url VARCHAR(512) NOT NULL,
+    events TEXT[] NOT NULL DEFAULT '{}',
+    secret_encrypted BYTEA NOT NULL,
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhook_endpoint_events ON cms.webhook_endpoints USING GIN (events) WHERE is_active;
+
+-- Circuit breaker state of each webhook endpoint, shared by every worker.
+CREATE TABLE cms.webhook_circuits (
+    endpoint_id UUID PRIMARY KEY REFERENCES cms.webhook_endpoints(id) ON DELETE CASCADE,
+    state VARCHAR(20) NOT NULL DEFAULT 'closed' CHECK (state IN ('closed', 'open', 'half_open')),
+    consecutive_failures INT NOT NULL DEFAULT 0,
+    first_failure_at TIMESTAMP WITH TIME ZONE,
+    opened_at TIMESTAMP WITH TIME ZONE,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+-- Attempts at delivering outbound webhooks, kept for debugging. Retries of
+-- an event share its event_id; status_code is NULL when no response came
+-- back. Rows older than 30 days are pruned.
+CREATE TABLE cms.webhook_deliveries (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    endpoint_id UUID NOT NULL REFERENCES cms.webhook_endpoints(id) ON DELETE CASCADE,
+    event_id UUID NOT NULL,
+    event VARCHAR(100) NOT NULL,
+    attempt INT NOT NULL,
+    status_code INT,
+    error TEXT,
+    duration_ms INT NOT NULL,
+    -- Kept on the last attempt of a delivery that failed every attempt, a
+    -- dead letter, so it can be retried by hand; retried_at is set once it
+    -- has been
+    payload JSONB,
+    retried_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_webhook_delivery_endpoint ON cms.webhook_deliveries(endpoint_id, created_at DESC);
+CREATE INDEX idx_webhook_delivery_created_at ON cms.webhook_deliveries(created_at);
+CREATE INDEX idx_webhook_delivery_dead_letter ON cms.webhook_deliveries(endpoint_id, created_at)
+    WHERE payload IS NOT NULL AND retried_at IS NULL;
+
+-- Record of administrative actions. actor_id is NULL for system actions.
+CREATE TABLE cms.audit_logs (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    actor_id UUID REFERENCES auth.users(id),
+    action VARCHAR(100) NOT NULL,
+    entity_type VARCHAR(50) NOT NULL,
+    entity_id VARCHAR(100) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    -- Field-level changes of updates: the old and new values of each field
+    -- in changed_fields, keyed by field name
+    old_value JSONB,
+    new_value JSONB,
+    changed_fields TEXT[] NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX idx_audit_log_entity ON cms.audit_logs(entity_type, entity_id, created_at DESC);
+
+CREATE INDEX idx_category_parent ON blog.categories(parent_id);
+CREATE INDEX idx_comment_status_created ON blog.comments(status, created_at);
+CREATE INDEX idx_search_analytics_count ON blog.search_analytics(count DESC);
 CREATE INDEX idx_product_slug ON shop.products(slug);
 CREATE INDEX idx_product_category ON shop.products(category_id);
+CREATE INDEX idx_product_category_parent ON shop.product_categories(parent_id);
+CREATE INDEX idx_product_vendor ON shop.products(vendor_id);
+CREATE INDEX idx_product_list_keyset ON shop.products(created_at DESC, id DESC);
+CREATE INDEX idx_product_image_product_order ON shop.product_images(product_id, sort_order);
+CREATE INDEX idx_product_attribute_product ON shop.product_attributes(product_id);
+CREATE INDEX idx_product_attribute_name_value ON shop.product_attributes(name, value);
+CREATE UNIQUE INDEX idx_attribute_definition_name_lower ON shop.attribute_definitions(LOWER(name));
+CREATE INDEX idx_event_date ON shop.event_details(event_date);
+CREATE INDEX idx_order_ticket_item ON shop.order_tickets(order_item_id);
+CREATE INDEX idx_vendor_payout_vendor_status ON shop.vendor_payouts(vendor_id, status);
+CREATE INDEX idx_vendor_payout_batch ON shop.vendor_payouts(batch_id);
+CREATE INDEX idx_flash_sale_window ON shop.flash_sales(starts_at, ends_at) WHERE is_active;
+CREATE INDEX idx_payout_batch_vendor ON shop.payout_batches(vendor_id, created_at);
+CREATE INDEX idx_payout_batch_open ON shop.payout_batches(status) WHERE status <> 'paid';
 CREATE INDEX idx_order_customer ON shop.orders(customer_id);
 CREATE INDEX idx_order_status ON shop.orders(status);
+CREATE INDEX idx_order_note_order ON shop.order_notes(order_id);
+CREATE INDEX idx_order_note_content_trgm ON shop.order_notes USING GIN (content gin_trgm_ops);
+CREATE INDEX idx_user_email_trgm ON auth.users USING GIN (email gin_trgm_ops);
+CREATE INDEX idx_user_search_trgm ON auth.users USING GIN ((full_name || ' ' || email) gin_trgm_ops);
+CREATE INDEX idx_order_created_at ON shop.orders(created_at);
+CREATE INDEX idx_order_status_created ON shop.orders(status, created_at);
+CREATE INDEX idx_order_payment_status_created ON shop.orders(payment_status, created_at);
+CREATE INDEX idx_order_total_amount ON shop.orders(total_amount);
+CREATE INDEX idx_customer_user ON shop.customers(user_id);
+CREATE INDEX idx_customer_created_at ON shop.customers(created_at);
+CREATE INDEX idx_order_item_order ON shop.order_items(order_id);
+CREATE INDEX idx_order_customer_status_created ON shop.orders(customer_id, status, created_at);
+CREATE INDEX idx_subscription_customer ON shop.subscriptions(customer_id);
+CREATE INDEX idx_post_scheduled ON blog.posts(scheduled_at) WHERE status = 'scheduled';
+CREATE INDEX idx_post_deleted ON blog.posts(deleted_at DESC) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_product_deleted ON shop.products(deleted_at DESC) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_user_deleted ON auth.users(deleted_at DESC) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_email_queue_due ON cms.email_send_queue(next_retry_at) WHERE status = 'pending';
+CREATE INDEX idx_email_queue_status ON cms.email_send_queue(status, created_at);
+CREATE INDEX idx_subscription_due ON shop.subscriptions(next_billing_at) WHERE status = 'active';
 
 -- Create triggers for updating timestamps
 CREATE OR REPLACE FUNCTION update_timestamp()
@@ -215,8 +788,9 @@ DECLARE
 BEGIN
     FOR t IN 
         SELECT table_schema, table_name 
-        FROM information_schema.tables 
+        FROM information_schema.columns 
         WHERE table_schema IN ('auth', 'blog', 'shop', 'cms')
+          AND column_name = 'updated_at'
     LOOP
         EXECUTE format('CREATE TRIGGER set_updated_at
                         BEFORE UPDATE ON %I.%I